@@ -0,0 +1,42 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// absoluteKey is the key of the request context marking the requests that asked for absolute URIs
+type absoluteKey struct{}
+
+// isAbsolute tells if the request of the context asked for absolute URIs
+func isAbsolute(ctx context.Context) bool {
+	absolute, _ := ctx.Value(absoluteKey{}).(bool)
+	return absolute
+}
+
+// withAbsolute reads the absolute parameter of the request. If it is true, the returned request is marked in its context and
+// carries the origin its URIs are prefixed with: the one told by the trusted proxies, or the host the request was sent to.
+// The public URL of the service takes precedence over both
+func withAbsolute(r *http.Request) (*http.Request, error) {
+	value := r.URL.Query().Get("absolute")
+	if value == "" {
+		return r, nil
+	}
+	absolute, err := strconv.ParseBool(value)
+	if err != nil {
+		return r, ErrInvalidAbsolute
+	}
+	if !absolute {
+		return r, nil
+	}
+	ctx := context.WithValue(r.Context(), absoluteKey{}, true)
+	if originFromContext(ctx) == "" && r.Host != "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		ctx = context.WithValue(ctx, originKey{}, scheme+"://"+r.Host)
+	}
+	return r.WithContext(ctx), nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestAbsolute(t *testing.T) {
+	setup := func(spec *config.Specification) (*Controller, *httptest.Server) {
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		router := httprouter.New()
+		router.POST("/start", ctrls.StartStreamHandler)
+		router.GET("/list", ctrls.ListStreamHandler)
+		router.GET("/status/:id", ctrls.StatusHandler)
+		return ctrls, httptest.NewServer(router)
+	}
+	start := func(server *httptest.Server, query string) (*http.Response, StreamDto) {
+		b, err := json.Marshal(StreamDto{URI: generateURI()})
+		assert.Nil(t, err)
+		res, err := http.Post(fmt.Sprintf("%s/start%s", server.URL, query), "application/json", bytes.NewBuffer(b))
+		assert.Nil(t, err)
+		var result StreamDto
+		json.NewDecoder(res.Body).Decode(&result)
+		return res, result
+	}
+	get := func(url string, v interface{}) *http.Response {
+		res, err := http.Get(url)
+		assert.Nil(t, err)
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(v))
+		return res
+	}
+
+	t.Run("Should return the URIs with the host the request was sent to", func(t *testing.T) {
+		_, server := setup(config.InitConfig())
+		defer server.Close()
+
+		_, relative := start(server, "")
+		assert.Equal(t, fmt.Sprintf("/stream/%s/index.m3u8", relative.ID), relative.URI)
+		res, result := start(server, "?absolute=true")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		uri := fmt.Sprintf("%s/stream/%s/index.m3u8", server.URL, result.ID)
+		assert.Equal(t, uri, result.URI)
+
+		var status StatusDto
+		get(fmt.Sprintf("%s/status/%s?absolute=true", server.URL, result.ID), &status)
+		assert.Equal(t, uri, status.URI)
+		assert.Equal(t, fmt.Sprintf("/stream/%s/index.m3u8", result.ID), status.Path)
+		status = StatusDto{}
+		get(fmt.Sprintf("%s/status/%s", server.URL, result.ID), &status)
+		assert.Empty(t, status.URI)
+
+		list := []SummariseDto{}
+		get(fmt.Sprintf("%s/list?absolute=true", server.URL), &list)
+		uris := []string{}
+		for _, item := range list {
+			uris = append(uris, item.URI)
+		}
+		assert.ElementsMatch(t, []string{uri, server.URL + relative.URI}, uris)
+	})
+
+	t.Run("Should prefer the public URL of the service", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.PublicURL = "https://video.example.com"
+		_, server := setup(&conf)
+		defer server.Close()
+
+		_, result := start(server, "?absolute=1")
+		assert.Equal(t, fmt.Sprintf("https://video.example.com/stream/%s/index.m3u8", result.ID), result.URI)
+		list := []SummariseDto{}
+		get(fmt.Sprintf("%s/list?absolute=true", server.URL), &list)
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, result.URI, list[0].URI)
+		}
+	})
+
+	t.Run("Should refuse the absolute values that are not booleans", func(t *testing.T) {
+		ctrls, server := setup(config.InitConfig())
+		defer server.Close()
+
+		res, _ := start(server, "?absolute=yes")
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Empty(t, ctrls.streams)
+		var errDto ErrorDto
+		res = get(fmt.Sprintf("%s/list?absolute=yes", server.URL), &errDto)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_absolute", errDto.Error.Code)
+	})
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Roverr/rtsp-stream/core/access"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+)
+
+// originKey is the key of the origin the client sent the request to in the context of the request
+type originKey struct{}
+
+// originFromContext returns the origin the client sent the request to, empty if it was not told by a trusted proxy
+func originFromContext(ctx context.Context) string {
+	origin, _ := ctx.Value(originKey{}).(string)
+	return origin
+}
+
+// clientAddress returns the address of the client of the request, the one told by the trusted proxies if it was sent by one.
+// It is the address the request was sent from if it cannot be parsed
+func (c *Controller) clientAddress(r *http.Request) string {
+	if ip := c.current().access.ClientIP(r); ip != nil {
+		return ip.String()
+	}
+	return clientIP(r)
+}
+
+// withAccess refuses the requests sent from the addresses denied by the access lists. Media routes are checked
+// against the lists of the files of the streams, the rest against the lists of the management endpoints.
+// The origin told by the trusted proxies is put into the context, so the URIs of the responses can be absolute
+func (c *Controller) withAccess(media bool, handle httprouter.Handle) httprouter.Handle {
+	routes := "management"
+	if media {
+		routes = "streams"
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		policy := c.current().access
+		if origin := policy.Origin(r); origin != "" {
+			r = r.WithContext(context.WithValue(r.Context(), originKey{}, origin))
+		}
+		list := policy.Management
+		if media {
+			list = policy.Streams
+		}
+		if !list.Enabled() {
+			handle(w, r, ps)
+			return
+		}
+		ip := policy.ClientIP(r)
+		if !list.Allowed(ip) {
+			c.logger(r.Context()).Warnf("%s %s is denied from %s by the access lists", r.Method, r.URL.Path, ip)
+			c.metrics.Denied(routes)
+			c.SendError(w, access.ErrAccessDenied, http.StatusForbidden)
+			return
+		}
+		handle(w, r, ps)
+	}
+}
+
+// pinSource checks the host of the source against the source lists, returns the URI the processes have to connect to.
+// Local sources are checked against the allowed paths instead
+func (c *Controller) pinSource(ctx context.Context, uri string) (string, error) {
+	if streaming.IsLocal(uri) {
+		if err := c.checkLocalSource(uri); err != nil {
+			c.logger(ctx).Warnf("%s cannot be started || Error: %s", uri, err)
+			return "", err
+		}
+		return uri, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.spec().ProbeTimeout)
+	defer cancel()
+	source, err := c.current().sources.Pin(ctx, uri)
+	if err != nil {
+		c.logger(ctx).Warnf("%s cannot be started || Error: %s", streaming.RedactURI(uri), err)
+		return "", err
+	}
+	return source, nil
+}
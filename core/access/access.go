@@ -0,0 +1,174 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// ErrAccessDenied describes an error for requests sent from an address that is not allowed
+var ErrAccessDenied = errors.New("Access is denied from this address")
+
+// ErrInvalidNetworkFn describes an error for entries that are neither an IP address nor a CIDR range
+var ErrInvalidNetworkFn = func(entry string) error {
+	return fmt.Errorf("%s is not an IP address or a CIDR range", entry)
+}
+
+// ParseNetworks parses the CIDR ranges, a single address is parsed as a range of its own
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, ErrInvalidNetworkFn(entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
+
+// contains indicates if the address is inside any of the ranges
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// List decides if an address is allowed by its allowlist and denylist. The denylist takes precedence,
+// every address that is not denied is allowed if the allowlist is empty
+type List struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewList creates a new instance of List from the given CIDR ranges
+func NewList(allow, deny []string) (*List, error) {
+	allowed, err := ParseNetworks(allow)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := ParseNetworks(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &List{allowed, denied}, nil
+}
+
+// Enabled indicates if any range is configured
+func (l List) Enabled() bool {
+	return len(l.allow) > 0 || len(l.deny) > 0
+}
+
+// Allowed indicates if the address can call the endpoints, unknown addresses are only allowed if no range is configured
+func (l List) Allowed(ip net.IP) bool {
+	if !l.Enabled() {
+		return true
+	}
+	if ip == nil || contains(l.deny, ip) {
+		return false
+	}
+	return len(l.allow) == 0 || contains(l.allow, ip)
+}
+
+// Policy describes the lists of the management endpoints and the files of the streams,
+// with the proxies trusted to tell the address of the clients
+type Policy struct {
+	Management *List
+	Streams    *List
+	proxies    []*net.IPNet
+}
+
+// NewPolicy creates a new instance of Policy from the configuration
+func NewPolicy(spec config.Access) (*Policy, error) {
+	management, err := NewList(spec.ManagementAllow, spec.ManagementDeny)
+	if err != nil {
+		return nil, err
+	}
+	streams, err := NewList(spec.StreamsAllow, spec.StreamsDeny)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := ParseNetworks(spec.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{management, streams, proxies}, nil
+}
+
+// peer returns the address the request was sent from and indicates if it is a trusted proxy, the address is nil if it cannot be parsed
+func (p Policy) peer(r *http.Request) (net.IP, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip, ip != nil && contains(p.proxies, ip)
+}
+
+// ClientIP returns the address the request was sent from. If it was sent by a trusted proxy, the X-Forwarded-For
+// header is read from right to left, the first address that is not a trusted proxy is the client. Without the header
+// the X-Real-IP header of the proxy is the client. Returns nil if the address cannot be parsed
+func (p Policy) ClientIP(r *http.Request) net.IP {
+	ip, trusted := p.peer(r)
+	if !trusted {
+		return ip
+	}
+	if len(r.Header["X-Forwarded-For"]) == 0 {
+		if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+			return real
+		}
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		// The hops before a malformed one cannot be trusted, the last trusted proxy is the client then
+		if hop == nil {
+			return ip
+		}
+		ip = hop
+		if !contains(p.proxies, hop) {
+			return hop
+		}
+	}
+	return ip
+}
+
+// Origin returns the scheme and the host the client sent the request to, like https://streams.example.com, if the request was sent
+// by a trusted proxy telling them in the X-Forwarded-Host and X-Forwarded-Proto headers. The first entry of the headers is the one
+// of the client if they were extended by a chain of proxies. Returns empty for the other requests and for the malformed headers
+func (p Policy) Origin(r *http.Request) string {
+	if _, trusted := p.peer(r); !trusted {
+		return ""
+	}
+	host := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0])
+	if u, err := url.Parse("//" + host); host == "" || err != nil || u.Host != host || u.User != nil || u.Hostname() == "" {
+		return ""
+	}
+	scheme := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]))
+	switch {
+	case scheme == "" && r.TLS != nil:
+		scheme = "https"
+	case scheme == "":
+		scheme = "http"
+	case scheme != "http" && scheme != "https":
+		return ""
+	}
+	return scheme + "://" + host
+}
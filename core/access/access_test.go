@@ -0,0 +1,131 @@
+package access
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32", "::1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::/32", "::1/128"}, []string{
+		networks[0].String(), networks[1].String(), networks[2].String(), networks[3].String(),
+	})
+	_, err = ParseNetworks([]string{"10.0.0.0/33"})
+	assert.Equal(t, ErrInvalidNetworkFn("10.0.0.0/33"), err)
+	_, err = ParseNetworks([]string{"localhost"})
+	assert.Equal(t, ErrInvalidNetworkFn("localhost"), err)
+}
+
+func TestListAllowed(t *testing.T) {
+	tt := []struct {
+		Allow    []string
+		Deny     []string
+		IP       string
+		Expected bool
+	}{
+		{IP: "203.0.113.1", Expected: true},
+		{IP: "", Expected: true},
+		{Allow: []string{"10.0.0.0/8"}, IP: "10.1.2.3", Expected: true},
+		{Allow: []string{"10.0.0.0/8"}, IP: "11.1.2.3", Expected: false},
+		{Allow: []string{"10.0.0.0/8"}, IP: "", Expected: false},
+		{Allow: []string{"10.0.0.0/8"}, IP: "::ffff:10.1.2.3", Expected: true},
+		{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.5"}, IP: "10.0.0.5", Expected: false},
+		{Deny: []string{"10.0.0.0/8"}, IP: "192.0.2.1", Expected: true},
+		{Deny: []string{"10.0.0.0/8"}, IP: "10.9.9.9", Expected: false},
+		{Allow: []string{"2001:db8::/32"}, IP: "2001:db8:1::7", Expected: true},
+		{Allow: []string{"2001:db8::/32"}, IP: "2001:db9::7", Expected: false},
+		{Deny: []string{"2001:db8::/32"}, IP: "2001:db8::1", Expected: false},
+	}
+	for i, testCase := range tt {
+		list, err := NewList(testCase.Allow, testCase.Deny)
+		assert.Nil(t, err)
+		if list.Allowed(net.ParseIP(testCase.IP)) != testCase.Expected {
+			t.Error(fmt.Errorf("%d testcase is failing for TestListAllowed", i))
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	policy, err := NewPolicy(config.Access{TrustedProxies: []string{"10.0.0.0/8", "fd00::/8"}})
+	assert.Nil(t, err)
+	tt := []struct {
+		RemoteAddr string
+		Forwarded  []string
+		RealIP     string
+		Expected   string
+	}{
+		{RemoteAddr: "203.0.113.1:4000", Expected: "203.0.113.1"},
+		{RemoteAddr: "203.0.113.1:4000", Forwarded: []string{"198.51.100.1"}, Expected: "203.0.113.1"},
+		{RemoteAddr: "10.0.0.1:4000", Expected: "10.0.0.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{"198.51.100.1"}, Expected: "198.51.100.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{"1.1.1.1, 198.51.100.1, 10.0.0.2"}, Expected: "198.51.100.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{"1.1.1.1", "198.51.100.1"}, Expected: "198.51.100.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{"198.51.100.1, garbage"}, Expected: "10.0.0.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{"10.0.0.3"}, Expected: "10.0.0.3"},
+		{RemoteAddr: "[fd00::1]:4000", Forwarded: []string{"2001:db8::9"}, Expected: "2001:db8::9"},
+		{RemoteAddr: "[2001:db8::1]:4000", Expected: "2001:db8::1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{" 198.51.100.1 ,10.0.0.2 "}, Expected: "198.51.100.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{""}, Expected: "10.0.0.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{"198.51.100.1:4000"}, Expected: "10.0.0.1"},
+		{RemoteAddr: "10.0.0.1:4000", RealIP: "198.51.100.7", Expected: "198.51.100.7"},
+		{RemoteAddr: "10.0.0.1:4000", RealIP: "unknown", Expected: "10.0.0.1"},
+		{RemoteAddr: "10.0.0.1:4000", Forwarded: []string{"198.51.100.1"}, RealIP: "198.51.100.7", Expected: "198.51.100.1"},
+		{RemoteAddr: "203.0.113.1:4000", RealIP: "198.51.100.7", Expected: "203.0.113.1"},
+	}
+	for i, testCase := range tt {
+		req := httptest.NewRequest("GET", "/start", nil)
+		req.RemoteAddr = testCase.RemoteAddr
+		for _, forwarded := range testCase.Forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if testCase.RealIP != "" {
+			req.Header.Set("X-Real-IP", testCase.RealIP)
+		}
+		if !assert.Equal(t, testCase.Expected, policy.ClientIP(req).String()) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestClientIP", i))
+		}
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	policy, err := NewPolicy(config.Access{TrustedProxies: []string{"10.0.0.0/8"}})
+	assert.Nil(t, err)
+	tt := []struct {
+		RemoteAddr string
+		Host       string
+		Proto      string
+		Expected   string
+	}{
+		{RemoteAddr: "10.0.0.1:4000", Host: "streams.example.com", Proto: "https", Expected: "https://streams.example.com"},
+		{RemoteAddr: "10.0.0.1:4000", Host: "streams.example.com:8443", Proto: "HTTPS", Expected: "https://streams.example.com:8443"},
+		{RemoteAddr: "10.0.0.1:4000", Host: "streams.example.com", Expected: "http://streams.example.com"},
+		{RemoteAddr: "10.0.0.1:4000", Host: "streams.example.com, internal.lan", Proto: "https, http", Expected: "https://streams.example.com"},
+		{RemoteAddr: "10.0.0.1:4000", Host: "[2001:db8::1]:8080", Proto: "http", Expected: "http://[2001:db8::1]:8080"},
+		{RemoteAddr: "10.0.0.1:4000", Proto: "https", Expected: ""},
+		{RemoteAddr: "10.0.0.1:4000", Host: "streams.example.com", Proto: "javascript", Expected: ""},
+		{RemoteAddr: "10.0.0.1:4000", Host: "evil.example.com/path", Proto: "https", Expected: ""},
+		{RemoteAddr: "10.0.0.1:4000", Host: "user@evil.example.com", Proto: "https", Expected: ""},
+		{RemoteAddr: "10.0.0.1:4000", Host: "evil example.com", Proto: "https", Expected: ""},
+		{RemoteAddr: "203.0.113.1:4000", Host: "evil.example.com", Proto: "https", Expected: ""},
+	}
+	for i, testCase := range tt {
+		req := httptest.NewRequest("GET", "/start", nil)
+		req.RemoteAddr = testCase.RemoteAddr
+		if testCase.Host != "" {
+			req.Header.Set("X-Forwarded-Host", testCase.Host)
+		}
+		if testCase.Proto != "" {
+			req.Header.Set("X-Forwarded-Proto", testCase.Proto)
+		}
+		if !assert.Equal(t, testCase.Expected, policy.Origin(req)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestOrigin", i))
+		}
+	}
+}
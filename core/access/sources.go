@@ -0,0 +1,130 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// ErrSourceDenied describes an error for sources whose host is not allowed to be streamed from
+var ErrSourceDenied = errors.New("Source host is not allowed")
+
+// ErrUnresolvedSource describes an error for sources whose host cannot be resolved
+var ErrUnresolvedSource = errors.New("Source host could not be resolved")
+
+// Sources decides which hosts the streams can be started from. Hosts are matched by their name and by the
+// addresses they resolve to, loopback and link-local addresses are refused unless a range allows them explicitly
+type Sources struct {
+	allowHosts    []string
+	allowNetworks []*net.IPNet
+	denyHosts     []string
+	denyNetworks  []*net.IPNet
+	lookup        func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// splitEntries separates the host names of the entries from their addresses and ranges
+func splitEntries(entries []string) ([]string, []*net.IPNet, error) {
+	names, ranges := []string{}, []string{}
+	for _, entry := range entries {
+		if _, _, err := net.ParseCIDR(entry); err == nil || net.ParseIP(entry) != nil {
+			ranges = append(ranges, entry)
+			continue
+		}
+		names = append(names, strings.ToLower(entry))
+	}
+	networks, err := ParseNetworks(ranges)
+	return names, networks, err
+}
+
+// NewSources creates a new instance of Sources from the configuration, nil if the hosts are not checked
+func NewSources(spec config.Sources) (*Sources, error) {
+	if !spec.Enabled() {
+		return nil, nil
+	}
+	allowHosts, allowNetworks, err := splitEntries(spec.SourceAllow)
+	if err != nil {
+		return nil, err
+	}
+	denyHosts, denyNetworks, err := splitEntries(spec.SourceDeny)
+	if err != nil {
+		return nil, err
+	}
+	return &Sources{allowHosts, allowNetworks, denyHosts, denyNetworks, net.DefaultResolver.LookupIPAddr}, nil
+}
+
+// matchesHost indicates if the host is one of the names or a subdomain of a wildcard domain like *.example.com
+func matchesHost(names []string, host string) bool {
+	for _, name := range names {
+		if name == host || (strings.HasPrefix(name, "*.") && strings.HasSuffix(host, name[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocal indicates if the address belongs to the host itself or its link
+func isLocal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// allowed indicates if the address of the host can be streamed from
+func (s Sources) allowed(hostAllowed bool, ip net.IP) bool {
+	if contains(s.denyNetworks, ip) {
+		return false
+	}
+	if contains(s.allowNetworks, ip) {
+		return true
+	}
+	if isLocal(ip) {
+		return false
+	}
+	return hostAllowed || (len(s.allowHosts) == 0 && len(s.allowNetworks) == 0)
+}
+
+// Pin resolves the host of the source and checks its addresses. The returned URI has the host replaced by the first
+// allowed address, so the processes connect to the checked address instead of resolving the host again
+func (s *Sources) Pin(ctx context.Context, uri string) (string, error) {
+	if s == nil {
+		return uri, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return "", ErrSourceDenied
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if matchesHost(s.denyHosts, host) {
+		return "", ErrSourceDenied
+	}
+	addresses := []net.IP{}
+	if ip := net.ParseIP(host); ip != nil {
+		addresses = append(addresses, ip)
+	} else {
+		resolved, err := s.lookup(ctx, host)
+		if err != nil || len(resolved) == 0 {
+			return "", ErrUnresolvedSource
+		}
+		for _, address := range resolved {
+			addresses = append(addresses, address.IP)
+		}
+	}
+	hostAllowed, port := matchesHost(s.allowHosts, host), u.Port()
+	for _, ip := range addresses {
+		if !s.allowed(hostAllowed, ip) {
+			continue
+		}
+		switch {
+		case port != "":
+			u.Host = net.JoinHostPort(ip.String(), port)
+		case ip.To4() == nil:
+			u.Host = "[" + ip.String() + "]"
+		default:
+			u.Host = ip.String()
+		}
+		return u.String(), nil
+	}
+	return "", ErrSourceDenied
+}
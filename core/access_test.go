@@ -0,0 +1,89 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestWithAccess(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) { w.WriteHeader(http.StatusOK) }
+	conf := *config.InitConfig()
+	conf.ManagementAllow = []string{"10.1.0.0/16", "2001:db8:1::/48"}
+	conf.StreamsAllow = []string{"198.51.100.0/24"}
+	conf.StreamsDeny = []string{"198.51.100.66"}
+	conf.TrustedProxies = []string{"10.9.0.1"}
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	defer ctrls.Shutdown(context.Background())
+	tt := []struct {
+		Media      bool
+		RemoteAddr string
+		Forwarded  string
+		Status     int
+	}{
+		{Media: false, RemoteAddr: "10.1.2.3:5000", Status: http.StatusOK},
+		{Media: false, RemoteAddr: "[2001:db8:1::10]:5000", Status: http.StatusOK},
+		{Media: false, RemoteAddr: "[2001:db8:2::10]:5000", Status: http.StatusForbidden},
+		{Media: false, RemoteAddr: "198.51.100.1:5000", Status: http.StatusForbidden},
+		{Media: true, RemoteAddr: "198.51.100.1:5000", Status: http.StatusOK},
+		{Media: true, RemoteAddr: "198.51.100.66:5000", Status: http.StatusForbidden},
+		{Media: true, RemoteAddr: "10.1.2.3:5000", Status: http.StatusForbidden},
+		{Media: true, RemoteAddr: "10.9.0.1:5000", Forwarded: "198.51.100.1", Status: http.StatusOK},
+		{Media: true, RemoteAddr: "10.1.2.3:5000", Forwarded: "198.51.100.1", Status: http.StatusForbidden},
+	}
+	for i, testCase := range tt {
+		r := httptest.NewRequest(http.MethodGet, "/start", nil)
+		r.RemoteAddr = testCase.RemoteAddr
+		if testCase.Forwarded != "" {
+			r.Header.Set("X-Forwarded-For", testCase.Forwarded)
+		}
+		w := httptest.NewRecorder()
+		ctrls.withAccess(testCase.Media, ok)(w, r, nil)
+		if !assert.Equal(t, testCase.Status, w.Code) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestWithAccess", i))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, ctrls.metrics.Write(buf, 0))
+	assert.Contains(t, buf.String(), "rtsp_stream_denied_requests_total{routes=\"management\"} 2\n")
+	assert.Contains(t, buf.String(), "rtsp_stream_denied_requests_total{routes=\"streams\"} 3\n")
+}
+
+func TestStartSourceLists(t *testing.T) {
+	conf := *config.InitConfig()
+	conf.SourceAllow = []string{"192.168.0.0/24"}
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	defer ctrls.Shutdown(context.Background())
+	tt := []struct {
+		URI    string
+		Status int
+	}{
+		{URI: "rtsp://192.168.0.10/live", Status: http.StatusOK},
+		{URI: "rtsp://192.168.1.10/live", Status: http.StatusForbidden},
+		{URI: "rtsp://127.0.0.1:8554/live", Status: http.StatusForbidden},
+		{URI: "rtsp://[fe80::1]/live", Status: http.StatusForbidden},
+		{URI: "rtsp://camera.invalid/live", Status: http.StatusUnprocessableEntity},
+	}
+	for i, testCase := range tt {
+		b, err := json.Marshal(StreamDto{URI: testCase.URI})
+		assert.Nil(t, err)
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		if !assert.Equal(t, testCase.Status, rr.Code) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestStartSourceLists", i))
+		}
+	}
+	assert.Len(t, ctrls.snapshotStreams(), 1)
+}
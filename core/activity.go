@@ -0,0 +1,32 @@
+package core
+
+import "time"
+
+// activityCheck is the period the output of the streams counting it as their activity is checked with
+const activityCheck = time.Second
+
+// activityLoop records the output written by the streams as their activity until the service is shut down.
+// One loop checks every stream, the streams only counting the requests of their clients are skipped
+func (c *Controller) activityLoop() {
+	ticker := time.NewTicker(activityCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.recordOutputs()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// recordOutputs records the last output of the running streams counting it as their activity,
+// so they are kept running by their transcoding like by the requests of their files
+func (c *Controller) recordOutputs() {
+	for _, strm := range c.snapshotStreams() {
+		if !strm.CountsOutput() || strm.IsStopping() || !strm.Streak.IsActive() {
+			continue
+		}
+		strm.RecordOutput(strm.LastOutputAt())
+	}
+}
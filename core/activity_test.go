@@ -0,0 +1,52 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activity")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+	started := time.Now().Add(-time.Minute)
+	written := time.Now().Add(-time.Second).Truncate(time.Second)
+
+	streams := map[string]*streaming.Stream{}
+	for _, activity := range []string{streaming.ActivityHTTP, streaming.ActivityOutput, streaming.ActivityBoth} {
+		generated := generateStream(nil, "")
+		generated.strm.Streak.Activate()
+		generated.strm.Options = streaming.Options{IdleTimeout: 60, Activity: activity}
+		generated.strm.StorePath = filepath.Join(dir, activity)
+		generated.strm.StartedAt, generated.strm.LastActivity = started, started
+		assert.Nil(t, os.MkdirAll(generated.strm.StorePath, os.ModePerm))
+		writeAged(t, generated.strm.PlaylistFile(), 10, written)
+		ctrls.setStream(generated.dirPath, &generated.strm)
+		streams[activity] = &generated.strm
+	}
+	ctrls.recordOutputs()
+	assert.Equal(t, started, streams[streaming.ActivityHTTP].LastActivity)
+	assert.Equal(t, written, streams[streaming.ActivityOutput].LastActivity)
+	assert.Equal(t, written, streams[streaming.ActivityBoth].LastActivity)
+
+	rr := httptest.NewRecorder()
+	ctrls.ListStreamHandler(rr, httptest.NewRequest(http.MethodGet, "/list", nil), nil)
+	var list []SummariseDto
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	activities := map[string]int{}
+	for _, item := range list {
+		activities[item.Activity]++
+	}
+	assert.Equal(t, map[string]int{"http": 1, "output": 1, "both": 1}, activities)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"regexp"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+)
+
+// aliasPattern matches the aliases that can be used as a segment of the path of the streams
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// canonicalPattern matches the ids derived from the URIs, aliases cannot look like them
+var canonicalPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// validateAlias checks if the alias can be used as the id of a stream, empty aliases are accepted
+func validateAlias(alias string) error {
+	if alias == "" {
+		return nil
+	}
+	if !aliasPattern.MatchString(alias) || canonicalPattern.MatchString(alias) {
+		return ErrInvalidAlias
+	}
+	return nil
+}
+
+// resolveID returns the id the stream is registered with, so the streams with an alias
+// can be referred to with the id derived from their URI as well
+func (c *Controller) resolveID(id string) string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if _, ok := c.streams[id]; ok {
+		return id
+	}
+	for alias, canonical := range c.aliases {
+		if canonical == id {
+			return alias
+		}
+	}
+	return id
+}
+
+// streamID returns the id of the stream of the canonical id for the requested alias.
+// Without an alias the stream keeps the alias it was started with, if any
+func (c *Controller) streamID(canonical, alias string) string {
+	if alias != "" {
+		return alias
+	}
+	return c.resolveID(canonical)
+}
+
+// hasAlias indicates if the alias belongs to the stream of the canonical id
+func (c *Controller) hasAlias(alias, canonical string) bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.aliases[alias] == canonical
+}
+
+// canonicalOf returns the id derived from the URI of the stream registered with the alias, empty if it has no alias
+func (c *Controller) canonicalOf(alias string) string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.aliases[alias]
+}
+
+// claimAlias reserves the alias for the stream of the canonical id. Aliases of the active streams cannot be taken by other
+// sources and the streams cannot change their alias, the aliases of the streams that are not watched anymore are released
+func (c *Controller) claimAlias(alias, canonical string) error {
+	c.mux.Lock()
+	current, taken := c.aliases[alias]
+	if err := c.aliasConflict(alias, canonical); err != nil {
+		c.mux.Unlock()
+		return err
+	}
+	c.aliases[alias] = canonical
+	c.mux.Unlock()
+	if taken && current != canonical {
+		c.evict(alias)
+	}
+	return nil
+}
+
+// checkAlias returns the error the claim of the alias for the stream of the canonical id would be refused with, nil if it can be claimed
+func (c *Controller) checkAlias(alias, canonical string) error {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.aliasConflict(alias, canonical)
+}
+
+// aliasConflict returns the error the claim of the alias for the stream of the canonical id is refused with, nil if it can be claimed.
+// The lock of the controller has to be held
+func (c *Controller) aliasConflict(alias, canonical string) error {
+	if current, taken := c.aliases[alias]; taken && current != canonical {
+		if strm, ok := c.streams[alias]; ok && (strm.Streak.IsActive() || strm.IsAlive(c.now())) {
+			return ErrAliasTaken
+		}
+	}
+	if _, ok := c.streams[canonical]; ok {
+		return ErrAliasRename
+	}
+	for other, id := range c.aliases {
+		if id == canonical && other != alias {
+			return ErrAliasRename
+		}
+	}
+	return nil
+}
+
+// releaseAlias gives up the claim of the alias if its stream could not be registered
+func (c *Controller) releaseAlias(alias, canonical string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.streams[alias]; !ok && c.aliases[alias] == canonical {
+		delete(c.aliases, alias)
+	}
+}
+
+// evict removes the idle stream that held the alias before, together with its files,
+// so the stream claiming the alias does not continue its playlist
+func (c *Controller) evict(alias string) {
+	c.mux.Lock()
+	strm, ok := c.streams[alias]
+	if ok {
+		delete(c.streams, alias)
+	}
+	c.mux.Unlock()
+	if !ok {
+		return
+	}
+	c.unsyncStream(alias)
+	c.metrics.RemoveStream(alias)
+	c.log.Infof("%s is released by its idle stream", alias)
+	if err := strm.StopRecording(); err != nil {
+		c.log.Error(err)
+	}
+	if err := strm.CleanProcess(); err != nil {
+		c.log.Error(err)
+	}
+	strm.ClearFiles()
+	c.publish(events.Stopped, alias, strm, "alias")
+}
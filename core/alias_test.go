@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tt := []struct {
+		Alias string
+		Err   error
+	}{
+		{Alias: "", Err: nil},
+		{Alias: "front-door", Err: nil},
+		{Alias: "Camera_01", Err: nil},
+		{Alias: "-front", Err: ErrInvalidAlias},
+		{Alias: "front/door", Err: ErrInvalidAlias},
+		{Alias: "..", Err: ErrInvalidAlias},
+		{Alias: "front door", Err: ErrInvalidAlias},
+		{Alias: strings.Repeat("a", 65), Err: ErrInvalidAlias},
+		{Alias: "5d41402abc4b2a76b9719d911017c592", Err: ErrInvalidAlias},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Err, validateAlias(testCase.Alias)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestValidateAlias", i))
+		}
+	}
+}
+
+func TestStartWithAlias(t *testing.T) {
+	setup := func() *Controller {
+		spawned := int32(0)
+		ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{spawned: &spawned}
+		return ctrls
+	}
+	start := func(ctrls *Controller, uri, alias string) (*httptest.ResponseRecorder, StreamDto) {
+		b, _ := json.Marshal(StreamDto{URI: uri, Alias: alias})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		var dto StreamDto
+		json.Unmarshal(rr.Body.Bytes(), &dto)
+		return rr, dto
+	}
+	first, second := "rtsp://192.168.0.10/live", "rtsp://192.168.0.11/live"
+	canonical, _ := streaming.GetURIDirectory(first)
+
+	t.Run("Should register the stream with its alias", func(t *testing.T) {
+		ctrls := setup()
+		defer ctrls.Shutdown(context.Background())
+		rr, dto := start(ctrls, first, "front-door")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "front-door", dto.ID)
+		assert.Equal(t, "front-door", dto.Alias)
+		assert.Equal(t, "/stream/front-door/index.m3u8", dto.URI)
+		strm, ok := ctrls.getStream("front-door")
+		assert.True(t, ok)
+		assert.Equal(t, "front-door", strm.Options.Directory)
+
+		// The id derived from the URI refers to the same stream
+		rr = httptest.NewRecorder()
+		ctrls.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status/"+canonical, nil), httprouter.Params{{Key: "id", Value: canonical}})
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// Starting the source again returns the stream, with or without its alias
+		rr, dto = start(ctrls, first, "front-door")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "front-door", dto.ID)
+		rr, dto = start(ctrls, first, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "front-door", dto.ID)
+		assert.Len(t, ctrls.snapshotStreams(), 1)
+	})
+
+	t.Run("Should refuse the conflicting aliases", func(t *testing.T) {
+		ctrls := setup()
+		defer ctrls.Shutdown(context.Background())
+		rr, _ := start(ctrls, first, "front-door")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr, _ = start(ctrls, second, "front-door")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "alias_conflict")
+		rr, _ = start(ctrls, first, "back-door")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		rr, _ = start(ctrls, first, "-front")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "invalid_alias")
+		assert.Len(t, ctrls.snapshotStreams(), 1)
+	})
+
+	t.Run("Should reuse the alias of the streams that are gone", func(t *testing.T) {
+		ctrls := setup()
+		defer ctrls.Shutdown(context.Background())
+		rr, _ := start(ctrls, first, "front-door")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		// Cleaned up streams give up their alias
+		strm, _ := ctrls.getStream("front-door")
+		strm.Streak.Deactivate()
+		rr, _ = start(ctrls, second, "front-door")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		strm, _ = ctrls.getStream("front-door")
+		assert.Equal(t, second, strm.OriginalURI)
+
+		// Stopped streams give up their alias
+		rr = httptest.NewRecorder()
+		ctrls.StopStreamHandler(rr, httptest.NewRequest(http.MethodDelete, "/stream/front-door", nil), httprouter.Params{{Key: "id", Value: "front-door"}})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr, _ = start(ctrls, first, "front-door")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, canonical, ctrls.canonicalOf("front-door"))
+		assert.Len(t, ctrls.snapshotStreams(), 1)
+	})
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/julienschmidt/httprouter"
+)
+
+// contextKey is the type of the values the middlewares attach to the context of the requests
+type contextKey string
+
+// apiKeyContext is the key of the name of the API key the request is authorized with
+const apiKeyContext contextKey = "apiKey"
+
+// withAPIKey protects the handler with the API keys of the configuration, if there is any configured.
+// The key has to be allowed to do the given operation, media routes only require a key if the files of the streams are protected.
+// The name of the key is attached to the context of the request, the key itself is never logged
+func (c *Controller) withAPIKey(permission string, media bool, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		current := c.current()
+		if !current.keys.Enabled() || (media && !current.spec.APIKeyStreams) {
+			handle(w, r, ps)
+			return
+		}
+		name, err := current.keys.Verify(r, permission)
+		if err != nil {
+			c.publishAuthFailure(r, err)
+		}
+		if err == auth.ErrInsufficientPermissions {
+			c.logger(r.Context()).Warnf("API key %s is not allowed to %s, refused %s %s", name, permission, r.Method, r.URL.Path)
+			c.SendError(w, err, http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			c.logger(r.Context()).Debugf("Request of %s is refused || Error: %s", r.URL.Path, err)
+			c.SendError(w, err, http.StatusUnauthorized)
+			return
+		}
+		c.logger(r.Context()).Debugf("%s %s is requested by API key %s", r.Method, r.URL.Path, name)
+		handle(w, r.WithContext(context.WithValue(r.Context(), apiKeyContext, name)), ps)
+	}
+}
+
+// apiKeyName returns the name of the API key the request is authorized with, empty if it did not need one
+func apiKeyName(r *http.Request) string {
+	return apiKeyFromContext(r.Context())
+}
+
+// apiKeyFromContext returns the name of the API key carried by the context of a request, empty if there is none
+func apiKeyFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyContext).(string)
+	return name
+}
+
+// requestedBy describes the API key of a request for the logs
+func requestedBy(key string) string {
+	if key == "" {
+		return ""
+	}
+	return " by API key " + key
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+)
+
+func TestWithAPIKey(t *testing.T) {
+	tt := []struct {
+		Keys       []string
+		Streams    bool
+		Media      bool
+		Key        string
+		Permission string
+		Status     int
+		Name       string
+	}{
+		{Permission: "start", Status: http.StatusOK},
+		{Keys: []string{"ingest:k3y:start"}, Permission: "start", Status: http.StatusUnauthorized},
+		{Keys: []string{"ingest:k3y:start"}, Key: "wrong", Permission: "start", Status: http.StatusUnauthorized},
+		{Keys: []string{"ingest:k3y:start"}, Key: "k3y", Permission: "start", Status: http.StatusOK, Name: "ingest"},
+		{Keys: []string{"ingest:k3y:start"}, Key: "k3y", Permission: "stop", Status: http.StatusForbidden},
+		{Keys: []string{"ingest:k3y:start", "admin:4dm1n:*"}, Key: "4dm1n", Permission: "stop", Status: http.StatusOK, Name: "admin"},
+		{Keys: []string{"ingest:k3y:start"}, Media: true, Permission: "read", Status: http.StatusOK},
+		{Keys: []string{"ingest:k3y:start"}, Streams: true, Media: true, Permission: "read", Status: http.StatusUnauthorized},
+		{Keys: []string{"player:pl4y:read"}, Streams: true, Media: true, Key: "pl4y", Permission: "read", Status: http.StatusOK, Name: "player"},
+	}
+	for i, testCase := range tt {
+		conf := *config.InitConfig()
+		conf.APIKeys = testCase.Keys
+		conf.APIKeyStreams = testCase.Streams
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		name := ""
+		handle := ctrls.withAPIKey(testCase.Permission, testCase.Media, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			name = apiKeyName(r)
+		})
+		r := httptest.NewRequest(http.MethodGet, "/list", nil)
+		if testCase.Key != "" {
+			r.Header.Set(auth.APIKeyHeader, testCase.Key)
+		}
+		w := httptest.NewRecorder()
+		handle(w, r, nil)
+		ctrls.Shutdown(context.Background())
+		if !assert.Equal(t, testCase.Status, w.Code) || !assert.Equal(t, testCase.Name, name) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestWithAPIKey", i))
+		}
+	}
+}
+
+func TestAPIKeyEvents(t *testing.T) {
+	conf := *config.InitConfig()
+	conf.APIKeys = []string{"ingest:k3y:start|stop"}
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	defer ctrls.Shutdown(context.Background())
+	sub := ctrls.events.Subscribe()
+	defer ctrls.events.Unsubscribe(sub)
+
+	b, err := json.Marshal(StreamDto{URI: generateURI()})
+	assert.Nil(t, err)
+	req := newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b))
+	req.Header.Set(auth.APIKeyHeader, "k3y")
+	rr := httptest.NewRecorder()
+	ctrls.withAPIKey("start", false, ctrls.StartStreamHandler)(rr, req, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	select {
+	case event := <-sub.Events():
+		assert.Equal(t, events.Started, event.Type)
+		assert.Equal(t, "ingest", event.APIKey)
+	case <-time.After(time.Second):
+		t.Error("Started event is not published")
+	}
+}
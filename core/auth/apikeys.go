@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// APIKeyHeader is the header of the requests carrying the API key
+const APIKeyHeader = "X-API-Key"
+
+// ErrMissingAPIKey is returned when the request has no API key
+var ErrMissingAPIKey = errors.New("Missing API key")
+
+// ErrInvalidAPIKey is returned when the API key of the request is not configured
+var ErrInvalidAPIKey = errors.New("Invalid API key")
+
+// ErrInsufficientPermissions is returned when the API key is not allowed to do the requested operation
+var ErrInsufficientPermissions = errors.New("API key is not allowed to do this operation")
+
+// apiKey is a configured key with the hash it is compared by
+type apiKey struct {
+	name        string
+	hash        [sha256.Size]byte
+	permissions map[string]bool
+}
+
+// APIKeys validates the API keys of the requests and the operations they are allowed to do
+type APIKeys struct {
+	keys []apiKey
+}
+
+// NewAPIKeys returns a new pointer for the keys of the configuration
+func NewAPIKeys(settings config.Auth) (*APIKeys, error) {
+	parsed, err := settings.ParseAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]apiKey, len(parsed))
+	for i, key := range parsed {
+		permissions := map[string]bool{}
+		for _, permission := range key.Permissions {
+			permissions[permission] = true
+		}
+		keys[i] = apiKey{key.Name, sha256.Sum256([]byte(key.Key)), permissions}
+	}
+	return &APIKeys{keys}, nil
+}
+
+// Enabled indicates if any key is configured
+func (a APIKeys) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Verify checks if the key of the request is configured and allowed to do the given operation, returns the name of the key.
+// Every key is compared, so the timing does not tell which one, if any, matched
+func (a APIKeys) Verify(r *http.Request, permission string) (string, error) {
+	given := r.Header.Get(APIKeyHeader)
+	if given == "" {
+		return "", ErrMissingAPIKey
+	}
+	hash := sha256.Sum256([]byte(given))
+	var match *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], a.keys[i].hash[:]) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		return "", ErrInvalidAPIKey
+	}
+	if !match.permissions["*"] && !match.permissions[permission] {
+		return match.name, ErrInsufficientPermissions
+	}
+	return match.name, nil
+}
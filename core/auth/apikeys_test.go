@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestAPIKeysVerify(t *testing.T) {
+	keys, err := NewAPIKeys(config.Auth{APIKeys: []string{"ingest:k3y:start|stop", "dashboard:d4sh:*"}})
+	assert.Nil(t, err)
+	assert.True(t, keys.Enabled())
+	tt := []struct {
+		Key        string
+		Permission string
+		Name       string
+		Err        error
+	}{
+		{Key: "k3y", Permission: "start", Name: "ingest"},
+		{Key: "k3y", Permission: "stop", Name: "ingest"},
+		{Key: "k3y", Permission: "list", Name: "ingest", Err: ErrInsufficientPermissions},
+		{Key: "d4sh", Permission: "admin", Name: "dashboard"},
+		{Key: "k3", Permission: "start", Err: ErrInvalidAPIKey},
+		{Key: "", Permission: "start", Err: ErrMissingAPIKey},
+	}
+	for i, testCase := range tt {
+		req := httptest.NewRequest("GET", "/list", nil)
+		if testCase.Key != "" {
+			req.Header.Set(APIKeyHeader, testCase.Key)
+		}
+		name, err := keys.Verify(req, testCase.Permission)
+		if !assert.Equal(t, testCase.Err, err) || !assert.Equal(t, testCase.Name, name) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestAPIKeysVerify", i))
+		}
+	}
+
+	keys, err = NewAPIKeys(config.Auth{})
+	assert.Nil(t, err)
+	assert.False(t, keys.Enabled())
+	_, err = NewAPIKeys(config.Auth{APIKeys: []string{"ingest"}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// BasicChallenge is the WWW-Authenticate header of the requests refused by basic authentication
+const BasicChallenge = `Basic realm="rtsp-stream", charset="UTF-8"`
+
+// ErrMissingCredentials is returned when the request has no username and password
+var ErrMissingCredentials = errors.New("Missing username and password")
+
+// ErrInvalidCredentials is returned when the username or the password does not match
+var ErrInvalidCredentials = errors.New("Invalid username or password")
+
+// BasicAuth validates the username and password of the requests. Only their hashes are kept,
+// so the comparison takes the same time whatever the length of the given credentials is
+type BasicAuth struct {
+	username [sha256.Size]byte
+	password [sha256.Size]byte
+}
+
+// NewBasicAuth returns a new pointer for the created basic authentication
+func NewBasicAuth(settings config.Auth) *BasicAuth {
+	return &BasicAuth{sha256.Sum256([]byte(settings.BasicUsername)), sha256.Sum256([]byte(settings.BasicPassword))}
+}
+
+// Verify checks if the request has the configured username and password
+func (ba BasicAuth) Verify(r *http.Request) error {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return ErrMissingCredentials
+	}
+	givenUsername, givenPassword := sha256.Sum256([]byte(username)), sha256.Sum256([]byte(password))
+	// Both are compared every time, so the timing does not tell which one is wrong
+	usernameMatch := subtle.ConstantTimeCompare(givenUsername[:], ba.username[:])
+	passwordMatch := subtle.ConstantTimeCompare(givenPassword[:], ba.password[:])
+	if usernameMatch&passwordMatch != 1 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
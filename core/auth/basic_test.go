@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicAuthVerify(t *testing.T) {
+	basic := NewBasicAuth(config.Auth{BasicUsername: "admin", BasicPassword: "p@ss:word"})
+	tt := []struct {
+		Username string
+		Password string
+		Missing  bool
+		Err      error
+	}{
+		{Username: "admin", Password: "p@ss:word"},
+		{Username: "admin", Password: "p@ss", Err: ErrInvalidCredentials},
+		{Username: "Admin", Password: "p@ss:word", Err: ErrInvalidCredentials},
+		{Username: "", Password: "", Err: ErrInvalidCredentials},
+		{Missing: true, Err: ErrMissingCredentials},
+	}
+	for i, testCase := range tt {
+		req := httptest.NewRequest("GET", "/list", nil)
+		if !testCase.Missing {
+			req.SetBasicAuth(testCase.Username, testCase.Password)
+		}
+		if !assert.Equal(t, testCase.Err, basic.Verify(req)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestBasicAuthVerify", i))
+		}
+	}
+	req := httptest.NewRequest("GET", "/list", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	assert.Equal(t, ErrMissingCredentials, basic.Verify(req))
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rsa"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -11,9 +12,22 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ErrMissingToken is returned when there is no token to validate
+var ErrMissingToken = errors.New("Missing authorization token")
+
+// ErrMalformedToken is returned when the token cannot be parsed
+var ErrMalformedToken = errors.New("Malformed authorization token")
+
+// ErrExpiredToken is returned when the token is not valid anymore
+var ErrExpiredToken = errors.New("Expired authorization token")
+
+// ErrInvalidToken is returned when the token is not valid for any other reason
+var ErrInvalidToken = errors.New("Invalid authorization token")
+
 // JWT interface describes how token validation looks like
 type JWT interface {
 	Validate(token string) bool
+	Verify(token string) error
 }
 
 // JWTProvider implements the validate method
@@ -45,13 +59,35 @@ func NewJWTProvider(settings config.Auth) (*JWTProvider, error) {
 
 // Validate is for validating if the given token is authenticated
 func (jp JWTProvider) Validate(tokenString string) bool {
-	ts := strings.Replace(tokenString, "Bearer ", "", -1)
+	return jp.Verify(tokenString) == nil
+}
+
+// Verify is for validating the given token, returning the reason in case it is not authenticated
+func (jp JWTProvider) Verify(tokenString string) error {
+	ts := strings.TrimSpace(strings.Replace(tokenString, "Bearer ", "", -1))
+	if ts == "" {
+		logrus.Errorln("Missing token at token verification")
+		return ErrMissingToken
+	}
 	token, err := jwt.Parse(ts, jp.verify)
 	if err != nil {
+		if validationErr, ok := err.(*jwt.ValidationError); ok {
+			switch {
+			case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+				logrus.Errorln("Malformed token at token verification ", err)
+				return ErrMalformedToken
+			case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+				logrus.Errorln("Expired token at token verification ", err)
+				return ErrExpiredToken
+			}
+		}
 		logrus.Errorln("Error at token verification ", err)
-		return false
+		return ErrInvalidToken
+	}
+	if !token.Valid {
+		return ErrInvalidToken
 	}
-	return token.Valid
+	return nil
 }
 
 // verify is to check the signing method and return the secret
@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Roverr/rtsp-stream/core/config"
 	jwt "github.com/dgrijalva/jwt-go"
@@ -34,3 +35,32 @@ func TestJWTAuthWithRSA(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, provider.Validate(tokenString))
 }
+
+func TestJWTVerify(t *testing.T) {
+	spec := config.InitConfig()
+	provider, err := NewJWTProvider(spec.Auth)
+	assert.Nil(t, err)
+
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})
+	expiredString, err := expired.SignedString([]byte(spec.Auth.JWTSecret))
+	assert.Nil(t, err)
+	wrongSecret := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{})
+	wrongSecretString, err := wrongSecret.SignedString([]byte("not the secret"))
+	assert.Nil(t, err)
+
+	tt := []struct {
+		Input string
+		Err   error
+	}{
+		{Input: "", Err: ErrMissingToken},
+		{Input: "Bearer ", Err: ErrMissingToken},
+		{Input: "Bearer not.a.token", Err: ErrMalformedToken},
+		{Input: fmt.Sprintf("Bearer %s", expiredString), Err: ErrExpiredToken},
+		{Input: fmt.Sprintf("Bearer %s", wrongSecretString), Err: ErrInvalidToken},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Err, provider.Verify(testCase.Input)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestJWTVerify", i))
+		}
+	}
+}
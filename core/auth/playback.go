@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// PlaybackTokenHeader is the header the playback token of a stream can be sent in instead of the query
+const PlaybackTokenHeader = "X-Playback-Token"
+
+// PlaybackTokenQuery is the query parameter of the playback token of a stream
+const PlaybackTokenQuery = "token"
+
+// playbackTokenBytes is the number of random bytes of a playback token
+const playbackTokenBytes = 32
+
+// ErrMissingPlaybackToken is returned when the request of the files of a stream has no playback token
+var ErrMissingPlaybackToken = errors.New("Missing playback token")
+
+// ErrInvalidPlaybackToken is returned when the playback token does not belong to the stream or it was revoked
+var ErrInvalidPlaybackToken = errors.New("Invalid playback token")
+
+// NewPlaybackToken creates a random token allowing to watch a stream
+func NewPlaybackToken() (string, error) {
+	b := make([]byte, playbackTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GivenPlaybackToken returns the playback token of the request, the query is checked before the header
+func GivenPlaybackToken(r *http.Request) string {
+	if token := r.URL.Query().Get(PlaybackTokenQuery); token != "" {
+		return token
+	}
+	return r.Header.Get(PlaybackTokenHeader)
+}
+
+// VerifyPlaybackToken checks if the request has the given playback token of the stream. The hashes of the tokens are compared,
+// so the comparison takes the same time whatever the length of the given token is. Revoked streams have an empty token
+func VerifyPlaybackToken(r *http.Request, token string) error {
+	given := GivenPlaybackToken(r)
+	if given == "" {
+		return ErrMissingPlaybackToken
+	}
+	givenHash, tokenHash := sha256.Sum256([]byte(given)), sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(givenHash[:], tokenHash[:]) != 1 || token == "" {
+		return ErrInvalidPlaybackToken
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaybackToken(t *testing.T) {
+	token, err := NewPlaybackToken()
+	assert.Nil(t, err)
+	assert.Len(t, token, playbackTokenBytes*2)
+	other, _ := NewPlaybackToken()
+	assert.NotEqual(t, token, other)
+
+	tt := []struct {
+		Query  string
+		Header string
+		Token  string
+		Err    error
+	}{
+		{Query: token, Token: token},
+		{Header: token, Token: token},
+		{Query: token, Header: other, Token: token},
+		{Token: token, Err: ErrMissingPlaybackToken},
+		{Query: other, Token: token, Err: ErrInvalidPlaybackToken},
+		{Header: token[:10], Token: token, Err: ErrInvalidPlaybackToken},
+		{Query: token, Token: "", Err: ErrInvalidPlaybackToken},
+	}
+	for i, testCase := range tt {
+		req := httptest.NewRequest(http.MethodGet, "/stream/id/index.m3u8", nil)
+		if testCase.Query != "" {
+			req = httptest.NewRequest(http.MethodGet, "/stream/id/index.m3u8?token="+testCase.Query, nil)
+		}
+		if testCase.Header != "" {
+			req.Header.Set(PlaybackTokenHeader, testCase.Header)
+		}
+		if !assert.Equal(t, testCase.Err, VerifyPlaybackToken(req, testCase.Token)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestPlaybackToken", i))
+		}
+	}
+}
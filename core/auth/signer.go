@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// ErrMissingSignature is returned when the request has no signature or expiry
+var ErrMissingSignature = errors.New("Missing URL signature")
+
+// ErrExpiredSignature is returned when the signature of the URL is not valid anymore
+var ErrExpiredSignature = errors.New("Expired URL signature")
+
+// ErrInvalidSignature is returned when the signature does not match the URL
+var ErrInvalidSignature = errors.New("Invalid URL signature")
+
+// URLSigner creates and validates expiring HMAC signatures for stream URLs
+type URLSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewURLSigner returns a new pointer for the created signer
+func NewURLSigner(settings config.Auth) *URLSigner {
+	return &URLSigner{
+		key: []byte(settings.URLSigningKey),
+		ttl: settings.URLSigningTTL,
+		now: time.Now,
+	}
+}
+
+// Sign creates the query parameters that authorize access to the files of the given stream
+func (us URLSigner) Sign(id string) url.Values {
+	expires := strconv.FormatInt(us.now().Add(us.ttl).Unix(), 10)
+	return url.Values{
+		"expires": []string{expires},
+		"sig":     []string{us.signature(id, expires)},
+	}
+}
+
+// Verify checks if the query parameters authorize access to the files of the given stream
+func (us URLSigner) Verify(id string, query url.Values) error {
+	expires, sig := query.Get("expires"), query.Get("sig")
+	if expires == "" || sig == "" {
+		return ErrMissingSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(us.signature(id, expires))) {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if us.now().After(time.Unix(unix, 0)) {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+// signature calculates the HMAC of the stream id and the expiry
+func (us URLSigner) signature(id, expires string) string {
+	mac := hmac.New(sha256.New, us.key)
+	mac.Write([]byte(fmt.Sprintf("%s:%s", id, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLSigner(t *testing.T) {
+	spec := config.InitConfig()
+	spec.Auth.URLSigningKey = "secret"
+	spec.Auth.URLSigningTTL = time.Hour
+	signer := NewURLSigner(spec.Auth)
+	signed := signer.Sign("stream")
+
+	expired := NewURLSigner(spec.Auth)
+	expired.now = func() time.Time { return time.Now().Add(-time.Hour * 2) }
+	expiredSigned := expired.Sign("stream")
+
+	tampered := url.Values{"expires": []string{fmt.Sprintf("%d", time.Now().Add(time.Hour*24).Unix())}, "sig": signed["sig"]}
+
+	tt := []struct {
+		ID    string
+		Query url.Values
+		Err   error
+	}{
+		{ID: "stream", Query: signed, Err: nil},
+		{ID: "stream", Query: url.Values{}, Err: ErrMissingSignature},
+		{ID: "stream", Query: url.Values{"expires": signed["expires"]}, Err: ErrMissingSignature},
+		{ID: "other", Query: signed, Err: ErrInvalidSignature},
+		{ID: "stream", Query: tampered, Err: ErrInvalidSignature},
+		{ID: "stream", Query: expiredSigned, Err: ErrExpiredSignature},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Err, signer.Verify(testCase.ID, testCase.Query)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestURLSigner", i))
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/julienschmidt/httprouter"
+)
+
+// withBasicAuth protects the handler with the username and password of the configuration, if basic authentication is enabled.
+// Media routes, the ones the players request, are only protected if the files of the streams have to be protected as well.
+// The configuration is read on every request, so the credentials can be changed by a reload
+func (c *Controller) withBasicAuth(media bool, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		current := c.current()
+		if !current.spec.BasicEnabled || (media && !current.spec.BasicStreams) {
+			handle(w, r, ps)
+			return
+		}
+		if err := current.basic.Verify(r); err != nil {
+			// Only the path is logged, the header carries the credentials
+			c.logger(r.Context()).Debugf("Request of %s is refused by basic authentication || Error: %s", r.URL.Path, err)
+			c.publishAuthFailure(r, err)
+			w.Header().Set("WWW-Authenticate", auth.BasicChallenge)
+			c.SendError(w, err, http.StatusUnauthorized)
+			return
+		}
+		handle(w, r, ps)
+	}
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestWithBasicAuth(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) { w.WriteHeader(http.StatusOK) }
+	tt := []struct {
+		Enabled     bool
+		Streams     bool
+		Media       bool
+		Credentials bool
+		Password    string
+		Status      int
+	}{
+		{Enabled: false, Media: false, Status: http.StatusOK},
+		{Enabled: true, Media: false, Status: http.StatusUnauthorized},
+		{Enabled: true, Media: false, Credentials: true, Password: "wrong", Status: http.StatusUnauthorized},
+		{Enabled: true, Media: false, Credentials: true, Password: "secret", Status: http.StatusOK},
+		{Enabled: true, Media: true, Status: http.StatusOK},
+		{Enabled: true, Streams: true, Media: true, Status: http.StatusUnauthorized},
+		{Enabled: true, Streams: true, Media: true, Credentials: true, Password: "secret", Status: http.StatusOK},
+	}
+	for i, testCase := range tt {
+		conf := *config.InitConfig()
+		conf.BasicEnabled = testCase.Enabled
+		conf.BasicStreams = testCase.Streams
+		conf.BasicUsername = "admin"
+		conf.BasicPassword = "secret"
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		r := httptest.NewRequest(http.MethodGet, "/list", nil)
+		if testCase.Credentials {
+			r.SetBasicAuth("admin", testCase.Password)
+		}
+		w := httptest.NewRecorder()
+		ctrls.withBasicAuth(testCase.Media, ok)(w, r, nil)
+		ctrls.Shutdown(context.Background())
+		if !assert.Equal(t, testCase.Status, w.Code) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestWithBasicAuth", i))
+			continue
+		}
+		challenge := ""
+		if testCase.Status == http.StatusUnauthorized {
+			challenge = auth.BasicChallenge
+		}
+		if !assert.Equal(t, challenge, w.Header().Get("WWW-Authenticate")) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestWithBasicAuth", i))
+		}
+	}
+}
+
+func TestBasicAuthReload(t *testing.T) {
+	conf := *config.InitConfig()
+	conf.BasicEnabled = true
+	conf.BasicUsername = "admin"
+	conf.BasicPassword = "secret"
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	defer ctrls.Shutdown(context.Background())
+	handle := ctrls.withBasicAuth(false, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {})
+
+	next := conf
+	next.BasicPassword = "rotated"
+	_, err := ctrls.Reload(&next)
+	assert.Nil(t, err)
+	for password, status := range map[string]int{"secret": http.StatusUnauthorized, "rotated": http.StatusOK} {
+		r := httptest.NewRequest(http.MethodGet, "/list", nil)
+		r.SetBasicAuth("admin", password)
+		w := httptest.NewRecorder()
+		handle(w, r, nil)
+		assert.Equal(t, status, w.Code)
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// maxBatchSize is the maximum number of streams a batch can start
+const maxBatchSize = 100
+
+// BatchStartDto describes the body of the /start/batch call. Streams listed with their URI only use the
+// default options, the ones that need their own options are given as entries of streams like the body of /start
+type BatchStartDto struct {
+	URIs    []string    `json:"uris"`
+	Streams []StreamDto `json:"streams"`
+}
+
+// BatchResultDto describes the outcome of the start of one stream of a batch, either the stream or the error
+type BatchResultDto struct {
+	URI    string        `json:"uri"`
+	Status int           `json:"status"`
+	Stream *StreamDto    `json:"stream,omitempty"`
+	Error  *ErrorBodyDto `json:"error,omitempty"`
+}
+
+// entries returns the streams of the batch in the order they were given, the URIs first
+func (b BatchStartDto) entries() []StreamDto {
+	entries := make([]StreamDto, 0, len(b.URIs)+len(b.Streams))
+	for _, uri := range b.URIs {
+		entries = append(entries, StreamDto{URI: uri})
+	}
+	return append(entries, b.Streams...)
+}
+
+// batchResult creates the result of an entry of the batch from the outcome of its start
+func batchResult(uri string, result startResult) BatchResultDto {
+	dto := BatchResultDto{URI: streaming.RedactURI(uri), Status: result.status}
+	if result.err != nil {
+		dto.Error = &ErrorBodyDto{errorCode(result.err, result.status), streaming.RedactURI(result.err.Error()), ""}
+		return dto
+	}
+	dto.Stream = &result.dto
+	return dto
+}
+
+// BatchStartHandler is the HTTP handler of the POST /start/batch call, which starts multiple streams with one request.
+// Responds with the results in the order of the entries, with 207 Multi-Status if any of them failed
+func (c *Controller) BatchStartHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	var batch BatchStartDto
+	if err := json.Unmarshal(body, &batch); err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	entries := batch.entries()
+	if len(entries) == 0 || len(entries) > maxBatchSize {
+		c.SendError(w, ErrInvalidBatchSize, http.StatusBadRequest)
+		return
+	}
+	results, status := c.startBatch(r, entries)
+	b, _ := json.Marshal(results)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// startBatch starts the entries BATCH_PARALLELISM at a time, the same URI given multiple times is only started once.
+// Returns the results in the order of the entries, with 207 Multi-Status if any of them failed
+func (c *Controller) startBatch(r *http.Request, entries []StreamDto) ([]BatchResultDto, int) {
+	results := make([]BatchResultDto, len(entries))
+	// Entries of the same normalized URI and alias share the result of the first one
+	first := map[string]int{}
+	duplicates := map[int]int{}
+	starts := []int{}
+	for i, entry := range entries {
+		normalized, err := c.sourceURI(&entries[i])
+		if err != nil {
+			c.metrics.StartRequested()
+			c.metrics.StartFailed()
+			results[i] = batchResult(entry.URI, startResult{StreamDto{}, http.StatusBadRequest, err, 0})
+			continue
+		}
+		key := normalized + " " + entry.Alias
+		if j, ok := first[key]; ok {
+			duplicates[i] = j
+			continue
+		}
+		first[key] = i
+		entries[i].URI = normalized
+		starts = append(starts, i)
+	}
+
+	c.logger(r.Context()).Infof("Batch of %d streams is getting started%s", len(starts), requestedBy(apiKeyName(r)))
+	c.inParallel(len(starts), func(j int) {
+		i := starts[j]
+		c.metrics.StartRequested()
+		results[i] = batchResult(entries[i].URI, c.start(r, entries[i]))
+	})
+
+	status := http.StatusOK
+	for i := range results {
+		if j, ok := duplicates[i]; ok {
+			results[i] = results[j]
+			results[i].URI = streaming.RedactURI(entries[i].URI)
+		}
+		if results[i].Error != nil {
+			status = http.StatusMultiStatus
+		}
+	}
+	return results, status
+}
+
+// inParallel calls the operation for every index below count, BATCH_PARALLELISM at a time, and waits for all of them
+func (c *Controller) inParallel(count int, operation func(i int)) {
+	runParallel(count, c.spec().BatchParallelism, nil, operation)
+}
+
+// runParallel calls the operation for every index below count, parallelism of them at the same time, and waits for all of them.
+// No more operations are started once stop is closed, only the ones in progress are waited for
+func runParallel(count, parallelism int, stop <-chan struct{}, operation func(i int)) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < count && !isClosed(stop); i++ {
+		select {
+		case slots <- struct{}{}:
+		case <-stop:
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			operation(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// isClosed indicates if the channel is closed, a nil channel is never closed
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
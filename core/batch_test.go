@@ -0,0 +1,100 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestBatchStartHandler(t *testing.T) {
+	setup := func(conf *config.Specification) (*Controller, *int32) {
+		spawned := int32(0)
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{spawned: &spawned}
+		return ctrls, &spawned
+	}
+	start := func(ctrls *Controller, body string) (*httptest.ResponseRecorder, []BatchResultDto) {
+		rr := httptest.NewRecorder()
+		ctrls.BatchStartHandler(rr, httptest.NewRequest(http.MethodPost, "/start/batch", bytes.NewBufferString(body)), nil)
+		var results []BatchResultDto
+		json.Unmarshal(rr.Body.Bytes(), &results)
+		return rr, results
+	}
+
+	t.Run("Should start every stream of the batch", func(t *testing.T) {
+		conf := config.InitConfig()
+		conf.BatchParallelism = 2
+		ctrls, spawned := setup(conf)
+		defer ctrls.Shutdown(context.Background())
+		rr, results := start(ctrls, `{"uris": ["rtsp://192.168.0.10/live", "rtsp://192.168.0.11/live", "rtsp://192.168.0.12/live"]}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Len(t, results, 3)
+		for _, result := range results {
+			assert.Equal(t, http.StatusOK, result.Status)
+			assert.NotNil(t, result.Stream)
+			assert.Nil(t, result.Error)
+		}
+		assert.Equal(t, "rtsp://192.168.0.11/live", results[1].URI)
+		assert.Equal(t, int32(3), atomic.LoadInt32(spawned))
+	})
+
+	t.Run("Should start the duplicated URIs only once", func(t *testing.T) {
+		ctrls, spawned := setup(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		rr, results := start(ctrls, `{"uris": ["rtsp://192.168.0.10/live", "RTSP://192.168.0.10:554/live"], "streams": [{"uri": "rtsp://192.168.0.10/live", "mode": "copy"}]}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Len(t, results, 3)
+		assert.Equal(t, results[0].Stream.ID, results[1].Stream.ID)
+		assert.Equal(t, results[0].Stream.ID, results[2].Stream.ID)
+		assert.Equal(t, "RTSP://192.168.0.10:554/live", results[1].URI)
+		assert.Equal(t, int32(1), atomic.LoadInt32(spawned))
+		assert.Len(t, ctrls.snapshotStreams(), 1)
+	})
+
+	t.Run("Should report the failing entries with Multi-Status", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.SourceAllow = []string{"192.168.0.0/24"}
+		ctrls, spawned := setup(&conf)
+		defer ctrls.Shutdown(context.Background())
+		rr, results := start(ctrls, `{"uris": ["rtsp://192.168.0.10/live", "not a uri", "rtsp://10.0.0.1/live"], "streams": [{"uri": "rtsp://192.168.0.11/live", "mode": "unknown"}]}`)
+		assert.Equal(t, http.StatusMultiStatus, rr.Code)
+		assert.Len(t, results, 4)
+		assert.Equal(t, http.StatusOK, results[0].Status)
+		expected := []struct {
+			Status int
+			Code   string
+		}{
+			{Status: http.StatusBadRequest, Code: "invalid_uri"},
+			{Status: http.StatusForbidden, Code: "source_denied"},
+			{Status: http.StatusBadRequest, Code: "invalid_options"},
+		}
+		for i, e := range expected {
+			result := results[i+1]
+			assert.Equal(t, e.Status, result.Status)
+			assert.Nil(t, result.Stream)
+			if assert.NotNil(t, result.Error) {
+				assert.Equal(t, e.Code, result.Error.Code)
+			}
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(spawned))
+	})
+
+	t.Run("Should refuse the batches that cannot be started", func(t *testing.T) {
+		ctrls, _ := setup(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		rr, _ := start(ctrls, `{"uris": "rtsp://192.168.0.10/live"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr, _ = start(ctrls, `{"uris": []}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "invalid_batch_size")
+	})
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// errBodyTooLarge is the message of the error of http.MaxBytesReader once the limit is reached
+const errBodyTooLarge = "http: request body too large"
+
+// decodeBody decodes the JSON body of the request into the value. The body has to be sent as application/json,
+// it cannot be larger than the limit in bytes and it cannot have fields the value does not know. Returns the status to send the error with
+func decodeBody(w http.ResponseWriter, r *http.Request, limit int64, value interface{}) (int, error) {
+	if kind, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || kind != "application/json" {
+		return http.StatusUnsupportedMediaType, ErrInvalidBodyType
+	}
+	if r.ContentLength > limit {
+		return http.StatusRequestEntityTooLarge, ErrBodyTooLargeFn(limit)
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return bodyError(err, limit)
+	}
+	// Only a single value can be sent
+	if _, err := decoder.Token(); err != io.EOF {
+		if err != nil {
+			return bodyError(err, limit)
+		}
+		return http.StatusBadRequest, ErrInvalidBody
+	}
+	return http.StatusOK, nil
+}
+
+// bodyError returns the error of the body that could not be decoded with the status to send it with
+func bodyError(err error, limit int64) (int, error) {
+	message := err.Error()
+	switch {
+	case message == errBodyTooLarge:
+		return http.StatusRequestEntityTooLarge, ErrBodyTooLargeFn(limit)
+	case strings.HasPrefix(message, "json: unknown field "):
+		return http.StatusBadRequest, ErrUnknownFieldFn(strings.TrimPrefix(message, "json: unknown field "))
+	case err == streaming.ErrInvalidIdleTimeout || err == streaming.ErrInvalidResolution || err == ErrInvalidTTL || err == streaming.ErrInvalidDVRWindow:
+		return http.StatusBadRequest, err
+	}
+	return http.StatusBadRequest, ErrInvalidBody
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newJSONRequest creates a request with a JSON body, like the clients of the API send it
+func newJSONRequest(method, target string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestStartBody(t *testing.T) {
+	conf := *config.InitConfig()
+	conf.StartMaxBodySize = 256
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	start := func(contentType string, body io.Reader) (int, ErrorDto) {
+		r := httptest.NewRequest(http.MethodPost, "/start", body)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, r, nil)
+		var errDto ErrorDto
+		json.NewDecoder(rr.Body).Decode(&errDto)
+		return rr.Code, errDto
+	}
+	valid := func() string {
+		b, err := json.Marshal(StreamDto{URI: generateURI()})
+		assert.Nil(t, err)
+		return string(b)
+	}
+
+	t.Run("Should start the streams with a JSON body", func(t *testing.T) {
+		status, _ := start("application/json; charset=utf-8", strings.NewReader(valid()))
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("Should refuse the bodies that are not sent as JSON", func(t *testing.T) {
+		for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded", "application/json;;"} {
+			status, errDto := start(contentType, strings.NewReader(valid()))
+			assert.Equal(t, http.StatusUnsupportedMediaType, status, contentType)
+			assert.Equal(t, ErrorBodyDto{"invalid_content_type", ErrInvalidBodyType.Error(), ""}, errDto.Error)
+		}
+	})
+
+	t.Run("Should refuse the bodies above the limit", func(t *testing.T) {
+		body := `{"uri": "rtsp://host/` + strings.Repeat("a", 300) + `"}`
+		status, errDto := start("application/json", strings.NewReader(body))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+		assert.Equal(t, ErrorBodyDto{"body_too_large", ErrBodyTooLargeFn(256).Error(), ""}, errDto.Error)
+
+		// The bodies sent without their length are cut at the limit
+		status, errDto = start("application/json", ioutil.NopCloser(io.MultiReader(strings.NewReader(body))))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+		assert.Equal(t, "body_too_large", errDto.Error.Code)
+	})
+
+	t.Run("Should refuse the unknown fields", func(t *testing.T) {
+		status, errDto := start("application/json", strings.NewReader(`{"url": "rtsp://host/live"}`))
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, ErrorBodyDto{"invalid_request", `Request body has an unknown field "url"`, ""}, errDto.Error)
+	})
+
+	t.Run("Should refuse the bodies that are not a single JSON object", func(t *testing.T) {
+		for _, body := range []string{"", "{", "[]", valid() + valid(), valid() + "}"} {
+			status, errDto := start("application/json", bytes.NewBufferString(body))
+			assert.Equal(t, http.StatusBadRequest, status, body)
+			assert.Equal(t, ErrorBodyDto{"invalid_body", ErrInvalidBody.Error(), ""}, errDto.Error, body)
+		}
+	})
+
+	t.Run("Should keep the errors of the options", func(t *testing.T) {
+		status, errDto := start("application/json", strings.NewReader(`{"uri": "rtsp://host/live", "ttl": -1}`))
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_ttl", errDto.Error.Code)
+	})
+}
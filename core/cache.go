@@ -0,0 +1,59 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// cacheControl returns the Cache-Control header value of a response cached for the given time
+func cacheControl(maxAge time.Duration, immutable bool) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	value := fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+	if immutable {
+		value += ", immutable"
+	}
+	return value
+}
+
+// etag returns an ETag based on the size and the modification time of the file
+func etag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// cacheHandler wraps the file server of the given directory, so playlists are revalidated
+// frequently while segments, which never change once they are listed, are cached for long.
+// Both carry an ETag, so conditional requests are answered with 304 by the file server.
+// The content types of the stream files are set as well, as they are not known by every system
+func cacheHandler(spec config.Cache, root string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if !isInsideDir(root, name) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || info.IsDir() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if contentType := streamContentType(name); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		switch {
+		case isManifest(name):
+			w.Header().Set("Cache-Control", cacheControl(spec.PlaylistMaxAge, false))
+		case isSegment(name):
+			w.Header().Set("Cache-Control", cacheControl(spec.SegmentMaxAge, true))
+		}
+		w.Header().Set("ETag", etag(info))
+		handler.ServeHTTP(w, r)
+	})
+}
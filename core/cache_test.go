@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheControl(t *testing.T) {
+	tt := []struct {
+		MaxAge    time.Duration
+		Immutable bool
+		Expected  string
+	}{
+		{MaxAge: 0, Expected: "no-cache"},
+		{MaxAge: 0, Immutable: true, Expected: "no-cache"},
+		{MaxAge: 2 * time.Second, Expected: "public, max-age=2"},
+		{MaxAge: 24 * time.Hour, Immutable: true, Expected: "public, max-age=86400, immutable"},
+	}
+
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Expected, cacheControl(testCase.MaxAge, testCase.Immutable)) {
+			t.Error(fmt.Errorf("%d testcase is failing", i))
+		}
+	}
+}
+
+func TestCacheHandler(t *testing.T) {
+	root, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "id"), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "id", "index.m3u8"), []byte("#EXTM3U\n0.ts\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "id", "0.ts"), []byte("segment"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "id", "manifest.mpd"), []byte("<MPD></MPD>"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "id", "chunk-0-00001.m4s"), []byte("segment"), 0644))
+
+	spec := config.Cache{PlaylistMaxAge: 0, SegmentMaxAge: time.Hour}
+	server := httptest.NewServer(cacheHandler(spec, root, http.FileServer(newStoreFileSystem(root))))
+	defer server.Close()
+
+	tt := []struct {
+		Path         string
+		Status       int
+		CacheControl string
+		ContentType  string
+	}{
+		{Path: "/id/index.m3u8", Status: http.StatusOK, CacheControl: "no-cache", ContentType: "application/vnd.apple.mpegurl"},
+		{Path: "/id/0.ts", Status: http.StatusOK, CacheControl: "public, max-age=3600, immutable", ContentType: "video/mp2t"},
+		{Path: "/id/manifest.mpd", Status: http.StatusOK, CacheControl: "no-cache", ContentType: "application/dash+xml"},
+		{Path: "/id/chunk-0-00001.m4s", Status: http.StatusOK, CacheControl: "public, max-age=3600, immutable", ContentType: "video/iso.segment"},
+		{Path: "/id/1.ts", Status: http.StatusNotFound, CacheControl: ""},
+	}
+
+	for i, testCase := range tt {
+		res, err := http.Get(server.URL + testCase.Path)
+		assert.Nil(t, err)
+		if !assert.Equal(t, testCase.Status, res.StatusCode) ||
+			!assert.Equal(t, testCase.CacheControl, res.Header.Get("Cache-Control")) ||
+			(testCase.ContentType != "" && !assert.Equal(t, testCase.ContentType, res.Header.Get("Content-Type"))) {
+			t.Error(fmt.Errorf("%d testcase is failing for %s", i, testCase.Path))
+		}
+		if testCase.Status != http.StatusOK {
+			assert.Empty(t, res.Header.Get("ETag"))
+			continue
+		}
+		tag := res.Header.Get("ETag")
+		assert.NotEmpty(t, tag)
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+testCase.Path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("If-None-Match", tag)
+		res, err = http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	}
+
+	// The ETag of the playlist changes with its content
+	res, err := http.Get(server.URL + "/id/index.m3u8")
+	assert.Nil(t, err)
+	tag := res.Header.Get("ETag")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "id", "index.m3u8"), []byte("#EXTM3U\n0.ts\n1.ts\n"), 0644))
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/id/index.m3u8", nil)
+	assert.Nil(t, err)
+	req.Header.Set("If-None-Match", tag)
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotEqual(t, tag, res.Header.Get("ETag"))
+}
@@ -0,0 +1,171 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidClientCA describes an error for client CA files without a PEM encoded certificate
+var ErrInvalidClientCA = errors.New("Client CA file does not contain any certificate")
+
+// cipherSuites are the suites accepted for TLS 1.2, only forward secret AEAD ones. TLS 1.3 suites are not configurable
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+// Reloader serves the TLS configuration of the listener. The certificate and the client CAs are read again on
+// every reload, so renewed certificates are used for the new connections without restarting the service
+type Reloader struct {
+	mux      *sync.RWMutex
+	spec     config.TLS
+	current  *tls.Config
+	modTimes map[string]time.Time
+}
+
+// NewReloader creates a new instance of Reloader with the files of the configuration read, returns nil if TLS is not enabled
+func NewReloader(spec config.TLS) (*Reloader, error) {
+	if !spec.Enabled() {
+		return nil, nil
+	}
+	r := &Reloader{&sync.RWMutex{}, spec, nil, map[string]time.Time{}}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// files returns the files the configuration is read from
+func (r *Reloader) files() []string {
+	files := []string{r.spec.TLSCertFile, r.spec.TLSKeyFile}
+	if r.spec.TLSClientCAFile != "" {
+		files = append(files, r.spec.TLSClientCAFile)
+	}
+	return files
+}
+
+// load reads the files into a new TLS configuration
+func (r *Reloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.spec.TLSCertFile, r.spec.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := baseConfig(r.spec)
+	conf.Certificates = []tls.Certificate{cert}
+	conf.NextProtos = []string{"h2", "http/1.1"}
+	if r.spec.TLSClientCAFile == "" {
+		return conf, nil
+	}
+	pem, err := ioutil.ReadFile(r.spec.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrInvalidClientCA
+	}
+	conf.ClientCAs = pool
+	conf.ClientAuth = tls.RequireAndVerifyClientCert
+	return conf, nil
+}
+
+// baseConfig returns the protocol settings of the listener without its certificates
+func baseConfig(spec config.TLS) *tls.Config {
+	conf := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CipherSuites:     cipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}
+	if spec.TLSMinVersion == "1.3" {
+		conf.MinVersion = tls.VersionTLS13
+	}
+	return conf
+}
+
+// Reload reads the files of the configuration again. The previous configuration is kept if they cannot be used,
+// like while a renewal has only written the certificate and not the key yet
+func (r *Reloader) Reload() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	conf, err := r.load()
+	if err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.current = conf
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed indicates if any of the files was modified since they were read
+func (r *Reloader) changed() bool {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err == nil && !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the configuration whenever its files are modified, checking them with the given interval until done is closed
+func (r *Reloader) Watch(interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				logrus.Errorf("Renewed certificate could not be loaded || Error: %s", err)
+				continue
+			}
+			logrus.Info("Renewed certificate is loaded")
+		case <-done:
+			return
+		}
+	}
+}
+
+// latest returns the last loaded configuration
+func (r *Reloader) latest() *tls.Config {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.current
+}
+
+// TLSConfig returns the configuration of the listener, every new connection gets the latest loaded one
+func (r *Reloader) TLSConfig() *tls.Config {
+	conf := baseConfig(r.spec)
+	conf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return r.latest(), nil
+	}
+	conf.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &r.latest().Certificates[0], nil
+	}
+	return conf
+}
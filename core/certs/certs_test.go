@@ -0,0 +1,205 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert writes a new self signed certificate and its key into the directory with the given serial number
+func writeCert(t *testing.T, dir, name string, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
+
+// serve starts an HTTPS server with the configuration of the reloader, returning its address
+func serve(t *testing.T, reloader *Reloader) (string, func()) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	assert.Nil(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})}
+	go server.Serve(listener)
+	return listener.Addr().String(), func() { server.Close() }
+}
+
+// dialSerial connects to the server and returns the serial number of the certificate it presented
+func dialSerial(addr string, conf *tls.Config) (int64, error) {
+	conn, err := tls.Dial("tcp", addr, conf)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		return 0, err
+	}
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestNewReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	writeCert(t, dir, "server", 1)
+
+	reloader, err := NewReloader(config.TLS{})
+	assert.Nil(t, err)
+	assert.Nil(t, reloader)
+
+	_, err = NewReloader(config.TLS{TLSCertFile: filepath.Join(dir, "server.crt"), TLSKeyFile: filepath.Join(dir, "missing.key")})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "empty.pem"), []byte("empty"), 0600))
+	_, err = NewReloader(config.TLS{TLSCertFile: filepath.Join(dir, "server.crt"), TLSKeyFile: filepath.Join(dir, "server.key"), TLSClientCAFile: filepath.Join(dir, "empty.pem")})
+	assert.Equal(t, ErrInvalidClientCA, err)
+
+	reloader, err = NewReloader(config.TLS{TLSCertFile: filepath.Join(dir, "server.crt"), TLSKeyFile: filepath.Join(dir, "server.key"), TLSMinVersion: "1.3"})
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), reloader.TLSConfig().MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), reloader.latest().MinVersion)
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	first := writeCert(t, dir, "server", 1)
+	reloader, err := NewReloader(config.TLS{TLSCertFile: filepath.Join(dir, "server.crt"), TLSKeyFile: filepath.Join(dir, "server.key")})
+	assert.Nil(t, err)
+	addr, stop := serve(t, reloader)
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(first)
+	serial, err := dialSerial(addr, &tls.Config{RootCAs: roots})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), serial)
+
+	// Clients below the minimum version are refused
+	_, err = dialSerial(addr, &tls.Config{RootCAs: roots, MaxVersion: tls.VersionTLS11})
+	assert.NotNil(t, err)
+
+	// A half written renewal keeps the previous certificate
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "server.key"), []byte("partial"), 0600))
+	assert.NotNil(t, reloader.Reload())
+	serial, err = dialSerial(addr, &tls.Config{RootCAs: roots})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), serial)
+
+	second := writeCert(t, dir, "server", 2)
+	assert.Nil(t, reloader.Reload())
+	roots.AddCert(second)
+	serial, err = dialSerial(addr, &tls.Config{RootCAs: roots})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), serial)
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	writeCert(t, dir, "server", 1)
+	reloader, err := NewReloader(config.TLS{TLSCertFile: filepath.Join(dir, "server.crt"), TLSKeyFile: filepath.Join(dir, "server.key")})
+	assert.Nil(t, err)
+	assert.False(t, reloader.changed())
+
+	done := make(chan struct{})
+	defer close(done)
+	go reloader.Watch(10*time.Millisecond, done)
+	writeCert(t, dir, "server", 2)
+	// The modification times of the files have to differ from the first ones
+	later := time.Now().Add(time.Second)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "server.crt"), later, later))
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && serialOf(reloader) != 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int64(2), serialOf(reloader))
+}
+
+// serialOf returns the serial number of the certificate the reloader serves
+func serialOf(reloader *Reloader) int64 {
+	cert, err := x509.ParseCertificate(reloader.latest().Certificates[0].Certificate[0])
+	if err != nil {
+		return 0
+	}
+	return cert.SerialNumber.Int64()
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	server := writeCert(t, dir, "server", 1)
+	writeCert(t, dir, "client", 2)
+	writeCert(t, dir, "stranger", 3)
+	reloader, err := NewReloader(config.TLS{
+		TLSCertFile:     filepath.Join(dir, "server.crt"),
+		TLSKeyFile:      filepath.Join(dir, "server.key"),
+		TLSClientCAFile: filepath.Join(dir, "client.crt"),
+	})
+	assert.Nil(t, err)
+	addr, stop := serve(t, reloader)
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server)
+	assert.NotNil(t, request(addr, &tls.Config{RootCAs: roots}))
+	for name, accepted := range map[string]bool{"client": true, "stranger": false} {
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key"))
+		assert.Nil(t, err)
+		err = request(addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}})
+		assert.Equal(t, accepted, err == nil, name)
+	}
+}
+
+// request sends a request to the server and reads the first byte of the response.
+// With TLS 1.3 refused client certificates are only reported once the client reads
+func request(addr string, conf *tls.Config) error {
+	conn, err := tls.Dial("tcp", addr, conf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		return err
+	}
+	_, err = conn.Read(make([]byte, 1))
+	return err
+}
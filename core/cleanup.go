@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// Outcomes of the cleaning of a stream by a cleanup pass
+const (
+	cleanKept = iota
+	cleanReaped
+	cleanTimedOut
+)
+
+// cleanUnused is for stopping all transcoding for streams that are not watched anymore. The streams are cleaned
+// CLEANUP_PARALLELISM at a time, the ones not cleaned within CLEANUP_STREAM_TIMEOUT are skipped so the pass can finish.
+// No more streams are cleaned once the service is shut down
+func (c *Controller) cleanUnused() {
+	// The cleanup is skipped while every stream is being stopped, the recordings are not restarted meanwhile
+	if !c.spawns.enter() {
+		return
+	}
+	defer c.spawns.leave()
+	started := time.Now()
+	c.metrics.CleanupRan()
+	ids, streams := c.sortedStreams()
+	var reaped, timedOut int32
+	runParallel(len(ids), c.spec().CleanupParallelism, c.done, func(i int) {
+		switch c.cleanWithTimeout(ids[i], streams[ids[i]]) {
+		case cleanReaped:
+			atomic.AddInt32(&reaped, 1)
+		case cleanTimedOut:
+			atomic.AddInt32(&timedOut, 1)
+		}
+	})
+	duration := time.Since(started)
+	c.metrics.CleanupFinished(duration, int(reaped), int(timedOut))
+	c.log.Debugf("Cleanup took %s, %d streams are cleaned, %d timed out", duration.Round(time.Millisecond), reaped, timedOut)
+	c.persist()
+}
+
+// cleanWithTimeout cleans the stream unless it is still being cleaned by an earlier pass. It gives up waiting for
+// the cleaning after CLEANUP_STREAM_TIMEOUT or once the service is shut down, the cleaning carries on in the background
+func (c *Controller) cleanWithTimeout(id string, strm *streaming.Stream) int {
+	if !c.cleaning.begin(id) {
+		c.log.Warnf("%s is still being cleaned by an earlier cleanup, skipping it", id)
+		return cleanTimedOut
+	}
+	result := make(chan bool, 1)
+	go func() {
+		defer c.cleaning.end(id)
+		result <- c.cleanStream(id, strm)
+	}()
+	var expired <-chan time.Time
+	if timeout := c.spec().CleanupStreamTimeout; timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case cleaned := <-result:
+		if cleaned {
+			return cleanReaped
+		}
+		return cleanKept
+	case <-expired:
+		c.log.Warnf("%s could not be cleaned within %s, skipping it", id, c.spec().CleanupStreamTimeout)
+		return cleanTimedOut
+	case <-c.done:
+		return cleanKept
+	}
+}
+
+// cleanStream stops the transcoding of the stream if it is not used anymore, returns true if it was stopped
+func (c *Controller) cleanStream(name string, data *streaming.Stream) bool {
+	// Paused streams have no process to clean, they are kept until they are resumed or stopped
+	if data.IsPaused() {
+		return false
+	}
+	// Recordings that run regardless of the viewers are restarted if they exited
+	if data.Options.Recording.Always {
+		c.record(name, data)
+	}
+	// The streams stopped already, like the lazy and the recovered ones or the ones cleaned by an earlier pass, are not cleaned again,
+	// so they are not reported as inactive on every pass
+	if !data.Streak.IsActive() && !data.IsProcessAlive() {
+		return false
+	}
+	// If the streak is active or the clients keep it alive, there is no need for stopping
+	if c.isAlive(name, data) {
+		c.log.Infof("%s is active, skipping cleaning process", name)
+		return false
+	}
+	c.log.Infof("%s is getting cleaned", name)
+	c.metrics.RemoveStream(name)
+	if !data.Options.Recording.Always {
+		if err := data.StopRecording(); err != nil {
+			c.log.Error(err)
+		}
+	}
+	// Lazy streams and the ones recorded always stay registered, only their process is stopped
+	var err error
+	if c.spec().CleanupRemove && !data.Options.Lazy && !data.Options.Recording.Always {
+		ctx, cancel := context.WithTimeout(context.Background(), c.spec().ShutdownGrace)
+		err = data.Stop(ctx, true)
+		cancel()
+		go c.removeIdle(name, data)
+	} else {
+		err = data.CleanProcess()
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "signal: killed") {
+			c.log.Infof("\n%s is cleaned", name)
+			return true
+		}
+		c.log.Error(err)
+	}
+	c.log.Infof("%s is cleaned", name)
+	c.publish(events.Inactive, name, data, "")
+	return true
+}
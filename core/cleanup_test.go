@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunParallel(t *testing.T) {
+	t.Run("Should stop starting the operations once it is stopped", func(t *testing.T) {
+		stop := make(chan struct{})
+		ran := make(chan int, 10)
+		runParallel(10, 1, stop, func(i int) {
+			ran <- i
+			if i == 2 {
+				close(stop)
+			}
+		})
+		close(ran)
+		indexes := []int{}
+		for i := range ran {
+			indexes = append(indexes, i)
+		}
+		assert.Equal(t, []int{0, 1, 2}, indexes)
+	})
+}
+
+func TestCleanUnusedTimeouts(t *testing.T) {
+	setup := func(timeout time.Duration) (*Controller, *streaming.Stream, *streaming.Stream) {
+		conf := *config.InitConfig()
+		conf.CleanupParallelism = 2
+		conf.CleanupStreamTimeout = timeout
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.processor = mockProcessor{}
+		// Both streams are running, their streak ran out
+		stuck := generateStream(nil, "")
+		startFake(&stuck.strm)
+		stuck.strm.Streak.Deactivate()
+		idle := generateStream(nil, "")
+		startFake(&idle.strm)
+		idle.strm.Streak.Deactivate()
+		ctrls.setStream("stuck", &stuck.strm)
+		ctrls.setStream("idle", &idle.strm)
+		return ctrls, &stuck.strm, &idle.strm
+	}
+	metrics := func(ctrls *Controller) string {
+		buf := &bytes.Buffer{}
+		assert.Nil(t, ctrls.metrics.Write(buf, 0))
+		return buf.String()
+	}
+
+	t.Run("Should skip the streams not cleaned in time and finish the pass", func(t *testing.T) {
+		ctrls, stuck, _ := setup(time.Millisecond * 100)
+		// The stream cannot be cleaned while it is locked, like a stop hanging on the removal of its directory
+		stuck.Mux.Lock()
+		ctrls.cleanUnused()
+		output := metrics(ctrls)
+		assert.Contains(t, output, "rtsp_stream_cleanup_reaped 1\n")
+		assert.Contains(t, output, "rtsp_stream_cleanup_timeouts_total 1\n")
+		assert.True(t, ctrls.cleaning.busy("stuck"))
+
+		// The next pass does not wait for it again
+		started := time.Now()
+		ctrls.cleanUnused()
+		assert.True(t, time.Since(started) < time.Millisecond*100)
+		assert.Contains(t, metrics(ctrls), "rtsp_stream_cleanup_timeouts_total 2\n")
+
+		stuck.Mux.Unlock()
+		assert.True(t, waitUntil(func() bool { return !ctrls.cleaning.busy("stuck") }, time.Second))
+		assert.False(t, stuck.Streak.IsActive())
+	})
+
+	t.Run("Should give up the pass once the service is shut down", func(t *testing.T) {
+		ctrls, stuck, _ := setup(0)
+		stuck.Mux.Lock()
+		defer stuck.Mux.Unlock()
+		finished := make(chan struct{})
+		go func() {
+			ctrls.cleanUnused()
+			close(finished)
+		}()
+		assert.True(t, waitUntil(func() bool { return ctrls.cleaning.busy("stuck") }, time.Second))
+		ctrls.stopOnce.Do(func() { close(ctrls.done) })
+		select {
+		case <-finished:
+		case <-time.After(time.Second):
+			t.Error("the cleanup was not given up on shutdown")
+		}
+	})
+}
+
+func TestCleanUnusedOnce(t *testing.T) {
+	t.Run("Should only clean and report the streams that were running", func(t *testing.T) {
+		ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		ctrls.processor = mockProcessor{}
+		sub := ctrls.events.Subscribe()
+		defer ctrls.events.Unsubscribe(sub)
+		idle := generateStream(nil, "")
+		startFake(&idle.strm)
+		idle.strm.Streak.Deactivate()
+		// The stream recovered as stopped has no process to clean
+		stopped := generateStream(nil, "")
+		stopped.strm.Streak.Deactivate()
+		ctrls.setStream("idle", &idle.strm)
+		ctrls.setStream("stopped", &stopped.strm)
+
+		ctrls.cleanUnused()
+		ctrls.cleanUnused()
+		assert.False(t, idle.strm.IsProcessAlive())
+		received := []events.Event{}
+		for done := false; !done; {
+			select {
+			case event := <-sub.Events():
+				received = append(received, event)
+			case <-time.After(time.Millisecond * 100):
+				done = true
+			}
+		}
+		if assert.Len(t, received, 1) {
+			assert.Equal(t, events.Inactive, received[0].Type)
+			assert.Equal(t, "idle", received[0].StreamID)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipSuffix marks the ETags of the compressed responses, so they differ from the uncompressed ones
+const gzipSuffix = "-gzip"
+
+// acceptsGzip is for deciding if the client accepts gzip encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(value, ";")
+		encoding := strings.TrimSpace(parts[0])
+		if encoding != "gzip" && encoding != "*" {
+			continue
+		}
+		if len(parts) > 1 && strings.Replace(strings.TrimSpace(parts[1]), " ", "", -1) == "q=0" {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// gzipETag returns the ETag of the compressed representation
+func gzipETag(tag string) string {
+	if !strings.HasSuffix(tag, `"`) {
+		return tag
+	}
+	return strings.TrimSuffix(tag, `"`) + gzipSuffix + `"`
+}
+
+// plainETags returns the given If-None-Match header with the ETags of the uncompressed representation
+func plainETags(header string) string {
+	return strings.Replace(header, gzipSuffix+`"`, `"`, -1)
+}
+
+// gzipBytes compresses the content
+func gzipBytes(content []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tt := []struct {
+		Header  string
+		Accepts bool
+	}{
+		{Header: "", Accepts: false},
+		{Header: "gzip", Accepts: true},
+		{Header: "deflate, gzip;q=1.0, *;q=0.5", Accepts: true},
+		{Header: "br", Accepts: false},
+		{Header: "*", Accepts: true},
+		{Header: "gzip;q=0", Accepts: false},
+		{Header: "identity, gzip; q=0", Accepts: false},
+	}
+
+	for i, testCase := range tt {
+		r := &http.Request{Header: http.Header{"Accept-Encoding": []string{testCase.Header}}}
+		if !assert.Equal(t, testCase.Accepts, acceptsGzip(r)) {
+			t.Error(fmt.Errorf("%d testcase is failing", i))
+		}
+	}
+}
+
+func TestGzipETag(t *testing.T) {
+	assert.Equal(t, `"5d-1c"`, plainETags(gzipETag(`"5d-1c"`)))
+	assert.Equal(t, `"5d-1c-gzip"`, gzipETag(`"5d-1c"`))
+	assert.Equal(t, `W/"5d-1c-gzip"`, gzipETag(`W/"5d-1c"`))
+	assert.Equal(t, `"a", "b"`, plainETags(`"a-gzip", "b"`))
+}
+
+func TestGzipBytes(t *testing.T) {
+	content := []byte("#EXTM3U\n#EXT-X-TARGETDURATION:1\n0.ts\n")
+	compressed, err := gzipBytes(content)
+	assert.Nil(t, err)
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	assert.Nil(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content, decompressed)
+}
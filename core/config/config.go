@@ -1,7 +1,14 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -9,47 +16,537 @@ import (
 
 // CORS is the ptions for cross origin handling
 type CORS struct {
-	Enabled          bool     `envconfig:"CORS_ENABLED" default:"false"`           // Indicates if cors should be handled as configured or as default
-	AllowedOrigins   []string `envconfig:"CORS_ALLOWED_ORIGINS" default:""`        // A list of origins a cross-domain request can be executed from.
-	AllowCredentials bool     `envconfig:"CORS_ALLOW_CREDENTIALS" default:"false"` // Indicates whether the request can include user credentials like cookies, HTTP authentication or client side SSL certificates.
-	MaxAge           int      `envconfig:"CORS_MAX_AGE" default:"0"`               // Indicates how long (in seconds) the results of a preflight request can be cached.
+	Enabled          bool     `envconfig:"CORS_ENABLED" default:"false"`                              // Indicates if cors should be handled as configured or as default
+	AllowedOrigins   []string `envconfig:"CORS_ALLOWED_ORIGINS" default:""`                           // A list of origins a cross-domain request can be executed from.
+	AllowedMethods   []string `envconfig:"CORS_ALLOWED_METHODS" default:"GET,POST,DELETE,PATCH"`      // A list of methods the client is allowed to use with cross-domain requests.
+	AllowedHeaders   []string `envconfig:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type"` // A list of non simple headers the client is allowed to use with cross-domain requests.
+	AllowCredentials bool     `envconfig:"CORS_ALLOW_CREDENTIALS" default:"false"`                    // Indicates whether the request can include user credentials like cookies, HTTP authentication or client side SSL certificates.
+	MaxAge           int      `envconfig:"CORS_MAX_AGE" default:"0"`                                  // Indicates how long (in seconds) the results of a preflight request can be cached.
 }
 
 // Auth describes information regarding authentication
 type Auth struct {
-	JWTEnabled    bool   `envconfig:"AUTH_JWT_ENABLED" default:"false"`      // Indicates if JWT authentication is enabled or not
-	JWTSecret     string `envconfig:"AUTH_JWT_SECRET" default:"macilaci"`    // Secret of the JWT encryption
-	JWTMethod     string `envconfig:"AUTH_JWT_METHOD" default:"secret"`      // Can be "secret" or "rsa", defines the decoding method
-	JWTPubKeyPath string `envconfig:"AUTH_JWT_PUB_PATH" default:"./key.pub"` // Path to the public RSA key
+	JWTEnabled        bool          `envconfig:"AUTH_JWT_ENABLED" default:"false"`         // Indicates if JWT authentication is enabled or not
+	JWTSecret         string        `envconfig:"AUTH_JWT_SECRET" default:"macilaci"`       // Secret of the JWT encryption
+	JWTMethod         string        `envconfig:"AUTH_JWT_METHOD" default:"secret"`         // Can be "secret" or "rsa", defines the decoding method
+	JWTPubKeyPath     string        `envconfig:"AUTH_JWT_PUB_PATH" default:"./key.pub"`    // Path to the public RSA key
+	JWTStreams        bool          `envconfig:"AUTH_JWT_STREAMS" default:"true"`          // Indicates if the file serving of streams requires authentication as well
+	URLSigningEnabled bool          `envconfig:"AUTH_URL_SIGNING_ENABLED" default:"false"` // Indicates if stream URLs are signed and validated
+	URLSigningKey     string        `envconfig:"AUTH_URL_SIGNING_KEY" default:""`          // Key of the HMAC signature of the stream URLs
+	URLSigningTTL     time.Duration `envconfig:"AUTH_URL_SIGNING_TTL" default:"1h"`        // Time period the signed stream URLs are valid for
+	PlaybackTokens    bool          `envconfig:"AUTH_PLAYBACK_TOKENS" default:"false"`     // Indicates if the files of the streams require the token issued when they were started
+	PlaybackRotate    bool          `envconfig:"AUTH_PLAYBACK_ROTATE" default:"false"`     // Indicates if the restarts through /restart issue a new playback token
+	BasicEnabled      bool          `envconfig:"AUTH_BASIC_ENABLED" default:"false"`       // Indicates if the management endpoints require a username and password
+	BasicUsername     string        `envconfig:"AUTH_BASIC_USERNAME" default:""`           // Username of the basic authentication
+	BasicPassword     string        `envconfig:"AUTH_BASIC_PASSWORD" default:""`           // Password of the basic authentication
+	BasicStreams      bool          `envconfig:"AUTH_BASIC_STREAMS" default:"false"`       // Indicates if the files of the streams require the username and password as well
+	APIKeys           []string      `envconfig:"AUTH_API_KEYS" default:""`                 // Keys of the services calling the API as name:key:permissions, the permissions are separated by |
+	APIKeyStreams     bool          `envconfig:"AUTH_API_KEY_STREAMS" default:"true"`      // Indicates if the files of the streams require an API key with the read permission as well
+}
+
+// Permissions are the operations an API key can be allowed to do, * allows all of them
+var Permissions = []string{"start", "stop", "list", "read", "admin"}
+
+// APIKey describes a key of a service calling the API
+type APIKey struct {
+	Name        string
+	Key         string
+	Permissions []string
+}
+
+// ParseAPIKeys returns the configured API keys, the error describes the first entry that cannot be used
+func (a Auth) ParseAPIKeys() ([]APIKey, error) {
+	keys := []APIKey{}
+	names := map[string]bool{}
+	for _, entry := range a.APIKeys {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, ErrInvalidConfigFn("AUTH_API_KEYS", "entries have to be written as name:key:permissions")
+		}
+		if names[parts[0]] {
+			return nil, ErrInvalidConfigFn("AUTH_API_KEYS", fmt.Sprintf("%s is configured more than once", parts[0]))
+		}
+		names[parts[0]] = true
+		permissions := strings.Split(parts[2], "|")
+		for _, permission := range permissions {
+			if err := oneOf("AUTH_API_KEYS", permission, append([]string{"*"}, Permissions...)...); err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, APIKey{parts[0], parts[1], permissions})
+	}
+	return keys, nil
+}
+
+// RequestLog describes information regarding the logging of the HTTP requests
+type RequestLog struct {
+	RequestLogEnabled      bool     `envconfig:"REQUEST_LOG" default:"false"`           // Turns on / off the logging of every request
+	RequestLogFormat       string   `envconfig:"REQUEST_LOG_FORMAT" default:"text"`     // Can be "text" or "json"
+	RequestLogSegmentEvery int      `envconfig:"REQUEST_LOG_SEGMENT_EVERY" default:"1"` // Only every n-th request of the segments is logged, since they are the most frequent ones
+	RequestLogLevels       []string `envconfig:"REQUEST_LOG_LEVELS" default:""`         // Levels of the requests of the matching paths, like *.ts:debug,/health:off
+}
+
+// PathLevel describes the level the requests of the paths matching the pattern are logged on
+type PathLevel struct {
+	Pattern string
+	Level   string
+}
+
+// RequestLogLevelValues are the levels the requests can be logged on, off drops them
+var RequestLogLevelValues = []string{"debug", "info", "warn", "error", "off"}
+
+// ParseRequestLogLevels returns the configured levels of the paths, the error describes the first entry that cannot be used
+func (r RequestLog) ParseRequestLogLevels() ([]PathLevel, error) {
+	levels := []PathLevel{}
+	for _, entry := range r.RequestLogLevels {
+		index := strings.LastIndex(entry, ":")
+		if index <= 0 {
+			return nil, ErrInvalidConfigFn("REQUEST_LOG_LEVELS", "entries have to be written as pattern:level")
+		}
+		pattern, level := entry[:index], strings.ToLower(entry[index+1:])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, ErrInvalidConfigFn("REQUEST_LOG_LEVELS", fmt.Sprintf("%q is not a valid pattern", pattern))
+		}
+		if err := oneOf("REQUEST_LOG_LEVELS", level, RequestLogLevelValues...); err != nil {
+			return nil, err
+		}
+		levels = append(levels, PathLevel{pattern, level})
+	}
+	return levels, nil
 }
 
 // ProcessLogging describes information about the logging mechanism of the transcoding FFMPEG process
 type ProcessLogging struct {
-	Enabled    bool   `envconfig:"PROCESS_LOGGING" default:"false"`                    // Option to set logging for transcoding processes
-	Directory  string `envconfig:"PROCESS_LOGGING_DIR" default:"/var/log/rtsp-stream"` // Directory for the logs
-	MaxSize    int    `envconfig:"PROCESS_LOGGING_MAX_SIZE" default:"500"`             // Maximum size of kept logging files in megabytes
-	MaxBackups int    `envconfig:"PROCESS_LOGGING_MAX_BACKUPS" default:"3"`            // Maximum number of old log files to retain
-	MaxAge     int    `envconfig:"PROCESS_LOGGING_MAX_AGE" default:"7"`                // Maximum number of days to retain an old log file.
-	Compress   bool   `envconfig:"PROCESS_LOGGING_COMPRESS" default:"true"`            // Indicates if the log rotation should compress the log files
+	Enabled     bool   `envconfig:"PROCESS_LOGGING" default:"false"`                    // Option to set logging for transcoding processes
+	Directory   string `envconfig:"PROCESS_LOGGING_DIR" default:"/var/log/rtsp-stream"` // Directory for the logs
+	MaxSize     int    `envconfig:"PROCESS_LOGGING_MAX_SIZE" default:"500"`             // Maximum size of kept logging files in megabytes
+	MaxBackups  int    `envconfig:"PROCESS_LOGGING_MAX_BACKUPS" default:"3"`            // Maximum number of old log files to retain
+	MaxAge      int    `envconfig:"PROCESS_LOGGING_MAX_AGE" default:"7"`                // Maximum number of days to retain an old log file.
+	Compress    bool   `envconfig:"PROCESS_LOGGING_COMPRESS" default:"true"`            // Indicates if the log rotation should compress the log files
+	BufferLines int    `envconfig:"PROCESS_LOGGING_BUFFER_LINES" default:"500"`         // Number of the last stderr lines of the process kept for the logs endpoint
+	Debug       bool   `envconfig:"PROCESS_LOGGING_DEBUG" default:"false"`              // Indicates if the stderr lines of the processes are written to the debug log of the service
 }
 
 // Process describes information regarding the transcoding process
 type Process struct {
-	CleanupTime time.Duration `envconfig:"CLEANUP_TIME" default:"2m0s"`  // Time period between process cleaning
-	StoreDir    string        `envconfig:"STORE_DIR" default:"./videos"` // Directory to store / service video chunks
-	KeepFiles   bool          `envconfig:"KEEP_FILES" default:"false"`   // Option for not deleting files
+	CleanupTime            time.Duration `envconfig:"CLEANUP_TIME" default:"2m0s"`           // Time period between process cleaning
+	CleanupRemove          bool          `envconfig:"CLEANUP_REMOVE" default:"false"`        // Indicates if the cleanup removes the idle streams and their directories, even if the files are kept otherwise
+	CleanupRemoveGrace     time.Duration `envconfig:"CLEANUP_REMOVE_GRACE" default:"30s"`    // Time the files of the idle streams are still served after their process is stopped, before they are removed
+	CleanupParallelism     int           `envconfig:"CLEANUP_PARALLELISM" default:"4"`       // Number of streams the cleanup stops at the same time
+	CleanupStreamTimeout   time.Duration `envconfig:"CLEANUP_STREAM_TIMEOUT" default:"30s"`  // Time the cleanup waits for the stop of a stream before it skips it, 0 means no limit
+	StreakHitLimit         int           `envconfig:"STREAK_HIT_LIMIT" default:"10"`         // Number of requests of the files of a stream its streak turns hot after, so it is kept running regardless of its idle timeout
+	StreakHotWait          time.Duration `envconfig:"STREAK_HOT_WAIT" default:"2m"`          // Time the hot streak of a stream stays active without requests
+	StoreDir               string        `envconfig:"STORE_DIR" default:"./videos"`          // Directory to store / service video chunks
+	DirectoryTemplate      string        `envconfig:"DIRECTORY_TEMPLATE" default:"{alias}"`  // Directory of the streams inside the store directory, can use {id}, {alias}, {date} and {metadata.<key>}
+	SegmentTemplate        string        `envconfig:"SEGMENT_TEMPLATE" default:"%d"`         // Name of the HLS segments without their extension, has to contain their number like %d or %05d
+	KeepFiles              bool          `envconfig:"KEEP_FILES" default:"false"`            // Option for not deleting files
+	HLSTime                int           `envconfig:"HLS_TIME" default:"1"`                  // Duration of the HLS segments in seconds
+	HLSListSize            int           `envconfig:"HLS_LIST_SIZE" default:"3"`             // Number of segments kept in the HLS playlist
+	HLSProgramDateTime     bool          `envconfig:"HLS_PROGRAM_DATE_TIME" default:"false"` // Indicates if the HLS playlists carry the wall clock time of their segments
+	SegmentType            string        `envconfig:"SEGMENT_TYPE" default:"ts"`             // Can be "ts" or "fmp4", defines the container of the HLS segments
+	Renditions             []string      `envconfig:"RENDITIONS" default:""`                 // Default rendition ladder for adaptive bitrate streams like 1080:4M,720:2M
+	Mode                   string        `envconfig:"MODE" default:"auto"`                   // Can be "auto", "copy" or "transcode", defines how the video is processed
+	Format                 string        `envconfig:"FORMAT" default:"hls"`                  // Can be "hls", "dash" or "both", defines the output format of the streams
+	Transport              string        `envconfig:"RTSP_TRANSPORT" default:"tcp"`          // Can be "tcp", "udp", "udp_multicast", "http" or "auto", defines how the sources are received
+	CopyStrict             bool          `envconfig:"COPY_STRICT" default:"false"`           // Indicates if copy mode fails for incompatible sources instead of transcoding them
+	Audio                  string        `envconfig:"AUDIO" default:""`                      // Can be "drop", "copy" or "aac", copy mode copies and other modes transcode the audio if empty
+	AudioBitrate           string        `envconfig:"AUDIO_BITRATE" default:"128k"`          // Bitrate of the audio transcoded to AAC
+	Lazy                   bool          `envconfig:"LAZY" default:"false"`                  // Indicates if the transcoding only starts when the playlist of the stream is requested
+	LazyTimeout            time.Duration `envconfig:"LAZY_TIMEOUT" default:"15s"`            // Time the first playlist request of a lazy stream waits for the segments
+	Lifecycle              string        `envconfig:"LIFECYCLE" default:"activity"`          // Can be "activity" or "viewers", defines if the streams are stopped without requests or without viewers
+	Activity               string        `envconfig:"ACTIVITY" default:"http"`               // Can be "http", "output" or "both", defines if the requests of the clients or the segments written by the streams count as their activity
+	CrashBackoffBase       time.Duration `envconfig:"CRASH_BACKOFF_BASE" default:"1s"`       // Delay before the first restart of a crashed process
+	CrashBackoffMultiplier float64       `envconfig:"CRASH_BACKOFF_MULTIPLIER" default:"2"`  // Multiplier of the delay between the consecutive restarts of a crashed process
+	CrashMaxAttempts       int           `envconfig:"CRASH_MAX_ATTEMPTS" default:"5"`        // Number of consecutive restarts before a stream is marked as errored
+	CrashMaxDelay          time.Duration `envconfig:"CRASH_MAX_DELAY" default:"0s"`          // Longest delay between the restarts of a crashed process, 0 means no limit
+	CrashJitter            float64       `envconfig:"CRASH_JITTER" default:"0"`              // Fraction of the delay between the restarts it is randomly lengthened or shortened by, so the streams of a host are not restarted at once
+	CrashGiveUpAfter       time.Duration `envconfig:"CRASH_GIVE_UP_AFTER" default:"0s"`      // Time since the first of the consecutive crashes the restarts can be made within, 0 means no limit
+	CrashMaxReconnects     int           `envconfig:"CRASH_MAX_RECONNECTS" default:"0"`      // Number of crashed streams reconnecting to their source at the same time, 0 means no limit
+	CrashHostCooldown      time.Duration `envconfig:"CRASH_HOST_COOLDOWN" default:"0s"`      // Shortest time between the reconnects of the crashed streams of the same source host
+	StartRetry             bool          `envconfig:"START_RETRY" default:"false"`           // Indicates if the source of a new stream that cannot be probed is tried again with the retry policy, within the start timeout
+	Probe                  bool          `envconfig:"PROBE" default:"true"`                  // Indicates if the sources are probed before starting their transcoding, new streams with unreachable sources are refused
+	ProbeTimeout           time.Duration `envconfig:"PROBE_TIMEOUT" default:"10s"`           // Time the probing of a source can take before it is killed
+	StartTimeout           time.Duration `envconfig:"START_TIMEOUT" default:"30s"`           // Time the start of a new stream can take, from the check of its source until its first playlist is written
+	StartMaxBodySize       int           `envconfig:"START_MAX_BODY_SIZE" default:"8192"`    // Largest body of the /start and PATCH /stream/:id requests in bytes
+	FirstSegmentTimeout    time.Duration `envconfig:"FIRST_SEGMENT_TIMEOUT" default:"20s"`   // Time the process of a new stream has to write its first segment before it is killed, 0 turns it off
+	StallTimeout           time.Duration `envconfig:"STALL_TIMEOUT" default:"0s"`            // Time the running process can go without writing a segment before it is restarted, 0 turns it off
+	StallMaxRestarts       int           `envconfig:"STALL_MAX_RESTARTS" default:"3"`        // Number of restarts after stalls within the stall window before the stream is marked as errored
+	StallWindow            time.Duration `envconfig:"STALL_WINDOW" default:"10m"`            // Time period the restarts after stalls are counted in
+	PausedServeFiles       bool          `envconfig:"PAUSED_SERVE_FILES" default:"true"`     // Indicates if the last files of the paused streams are still served, their playlists are refused otherwise
+	MaxStreams             int           `envconfig:"MAX_STREAMS" default:"0"`               // Maximum number of streams running at the same time for new URIs, 0 means no limit
+	QueueSize              int           `envconfig:"QUEUE_SIZE" default:"0"`                // Number of starts of new streams waiting for a free slot while MAX_STREAMS are running, 0 refuses them
+	QueueMaxWait           time.Duration `envconfig:"QUEUE_MAX_WAIT" default:"5m"`           // Time the queued starts wait for a free slot before they are dropped
+	BatchParallelism       int           `envconfig:"BATCH_PARALLELISM" default:"4"`         // Number of streams of a batch start, a group operation or a stop of every stream that are processed at the same time
+	ShutdownGrace          time.Duration `envconfig:"SHUTDOWN_GRACE" default:"10s"`          // Time the requests and the processes have to finish on shutdown
+	Record                 bool          `envconfig:"RECORD" default:"false"`                // Indicates if the streams are recorded into MP4 files next to the HLS output
+	RecordAlways           bool          `envconfig:"RECORD_ALWAYS" default:"false"`         // Indicates if the recording keeps running while the stream is not watched
+	RecordSegmentTime      time.Duration `envconfig:"RECORD_SEGMENT_TIME" default:"1h"`      // Duration of the recorded MP4 files
+	RecordingsDir          string        `envconfig:"RECORDINGS_DIR" default:"./recordings"` // Directory to store the recordings, should be outside of the store directory
+	KeepRecordings         bool          `envconfig:"KEEP_RECORDINGS" default:"true"`        // Indicates if the recordings are kept when the stream is stopped, unless the request overrides it
+	MPEGTSEnabled          bool          `envconfig:"MPEGTS_ENABLED" default:"false"`        // Indicates if the streams are also served as continuous MPEG-TS over HTTP, which holds long-lived connections
+	Profiles               []string      `envconfig:"PROFILES" default:""`                   // Named encoder settings the streams can be started with, like low:preset=veryfast|crf=28|height=480|fps=15|audio=aac
+	DefaultProfile         string        `envconfig:"DEFAULT_PROFILE" default:""`            // Profile of the streams started without one, none if empty
+	ResolutionMaxWidth     int           `envconfig:"RESOLUTION_MAX_WIDTH" default:"3840"`   // Widest output resolution that can be requested
+	ResolutionMaxHeight    int           `envconfig:"RESOLUTION_MAX_HEIGHT" default:"2160"`  // Highest output resolution that can be requested
+	MaxFPS                 int           `envconfig:"MAX_FPS" default:"0"`                   // Frame rate the transcoded streams are capped at, 0 keeps the rate of the sources
+}
+
+// Encryption describes information regarding the AES-128 encryption of the HLS segments
+type Encryption struct {
+	Enabled bool   `envconfig:"ENCRYPTION_ENABLED" default:"false"`   // Indicates if the segments should be encrypted
+	KeysDir string `envconfig:"ENCRYPTION_KEYS_DIR" default:"./keys"` // Directory to store the keys, should be outside of the store directory
+}
+
+// Hardware describes information regarding the hardware accelerated transcoding
+type Hardware struct {
+	Accel             string   `envconfig:"HARDWARE_ACCEL" default:"none"`              // Can be "vaapi", "nvenc", "qsv" or "none", defines the encoder used for transcoding
+	Device            string   `envconfig:"HARDWARE_DEVICE" default:""`                 // Device of the acceleration, like /dev/dri/renderD128
+	Devices           []string `envconfig:"HARDWARE_DEVICES" default:""`                // Devices the accelerated streams are spread across, like 0,1 or /dev/dri/renderD128,/dev/dri/renderD129
+	DeviceAssignment  string   `envconfig:"HARDWARE_DEVICE_ASSIGNMENT" default:"first"` // Can be "first" or "least-loaded", defines the device of the streams started without one
+	DeviceMaxSessions int      `envconfig:"HARDWARE_DEVICE_MAX_SESSIONS" default:"0"`   // Number of streams a device can encode at the same time, 0 if it is not limited
+	DeviceFallback    string   `envconfig:"HARDWARE_DEVICE_FALLBACK" default:"next"`    // Can be "next" or "software", defines where the streams of full devices are encoded
+}
+
+// HardwareDevices returns the devices the accelerated streams can be assigned to, the single HARDWARE_DEVICE if none are configured
+func (h Hardware) HardwareDevices() []string {
+	devices := []string{}
+	for _, device := range h.Devices {
+		if device = strings.TrimSpace(device); device != "" {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		return []string{h.Device}
+	}
+	return devices
+}
+
+// HasDevice indicates if the device is one of the devices the accelerated streams can be assigned to
+func (h Hardware) HasDevice(device string) bool {
+	for _, d := range h.HardwareDevices() {
+		if d == device {
+			return true
+		}
+	}
+	return false
+}
+
+// Persistence describes information regarding the storing of the stream registrations
+type Persistence struct {
+	Enabled bool   `envconfig:"PERSISTENCE_ENABLED" default:"false"`             // Indicates if the registered streams are stored to survive restarts
+	Path    string `envconfig:"PERSISTENCE_PATH" default:"./state/streams.json"` // Path of the file storing the streams, should be outside of the store directory
+	Resume  bool   `envconfig:"PERSISTENCE_RESUME" default:"true"`               // Indicates if streams that were running are restarted, otherwise they are listed as stopped
+	// PersistenceKey is the base64 encoded 32 byte key the credentials of the stored streams are encrypted with,
+	// PersistenceKeyFile is the path of a file holding it instead. Streams with credentials are not stored without one of them
+	PersistenceKey     string `envconfig:"PERSISTENCE_KEY" default:""`
+	PersistenceKeyFile string `envconfig:"PERSISTENCE_KEY_FILE" default:""`
+}
+
+// EncryptionKey returns the key the credentials of the stored streams are encrypted with, nil if none is configured
+func (p Persistence) EncryptionKey() ([]byte, error) {
+	name, encoded := "PERSISTENCE_KEY", p.PersistenceKey
+	if p.PersistenceKeyFile != "" {
+		if p.PersistenceKey != "" {
+			return nil, ErrInvalidConfigFn("PERSISTENCE_KEY_FILE", "cannot be set together with PERSISTENCE_KEY")
+		}
+		b, err := ioutil.ReadFile(p.PersistenceKeyFile)
+		if err != nil {
+			return nil, ErrInvalidConfigFn("PERSISTENCE_KEY_FILE", "the file cannot be read")
+		}
+		name, encoded = "PERSISTENCE_KEY_FILE", strings.TrimSpace(string(b))
+	}
+	if p.PersistenceKeyFile == "" && encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidConfigFn(name, "has to be a 32 byte key encoded in base64")
+	}
+	return key, nil
+}
+
+// Health describes information regarding the health checks of the streams
+type Health struct {
+	HealthMaxAge   time.Duration `envconfig:"HEALTH_MAX_AGE" default:"30s"`  // Age of the playlist after which a running stream is considered stalled
+	HealthCacheTTL time.Duration `envconfig:"HEALTH_CACHE_TTL" default:"5s"` // Time the result of the health check of a stream is reused for
+}
+
+// Viewers describes information regarding the counting of the clients watching the streams
+type Viewers struct {
+	ViewerWindow      time.Duration `envconfig:"VIEWER_WINDOW" default:"30s"`         // Time a client counts as a viewer of a stream after its last playlist request
+	ViewerMaxSessions int           `envconfig:"VIEWER_MAX_SESSIONS" default:"10000"` // Maximum number of viewer sessions tracked at the same time, the least recently seen ones are dropped beyond it
+	IgnoredAgents     []string      `envconfig:"VIEWER_IGNORE_AGENTS" default:""`     // Parts of the user agents of the clients that are not viewers, like health checks and CDNs
+	IgnoredIPs        []string      `envconfig:"VIEWER_IGNORE_IPS" default:""`        // Addresses and CIDR ranges of the clients that are not viewers
+}
+
+// RateLimit describes information regarding the rate limiting of the stream starts
+type RateLimit struct {
+	Enabled     bool    `envconfig:"RATE_LIMIT_ENABLED" default:"false"`     // Indicates if the starts of new streams are rate limited
+	GlobalRate  float64 `envconfig:"RATE_LIMIT_GLOBAL_RATE" default:"5"`     // Number of starts allowed per second from all clients
+	GlobalBurst float64 `envconfig:"RATE_LIMIT_GLOBAL_BURST" default:"20"`   // Number of starts allowed at once from all clients
+	ClientRate  float64 `envconfig:"RATE_LIMIT_CLIENT_RATE" default:"0.5"`   // Number of starts allowed per second from a given client IP
+	ClientBurst float64 `envconfig:"RATE_LIMIT_CLIENT_BURST" default:"5"`    // Number of starts allowed at once from a given client IP
+	MaxClients  int     `envconfig:"RATE_LIMIT_MAX_CLIENTS" default:"10000"` // Maximum number of client IPs tracked at the same time
+}
+
+// Cache describes information regarding the caching of the files of the streams by clients and CDNs
+type Cache struct {
+	PlaylistMaxAge time.Duration `envconfig:"CACHE_PLAYLIST_MAX_AGE" default:"0s"` // Time the playlists can be cached for, they are revalidated on every request if 0
+	SegmentMaxAge  time.Duration `envconfig:"CACHE_SEGMENT_MAX_AGE" default:"24h"` // Time the segments can be cached for, they are revalidated on every request if 0
+}
+
+// Storage describes information regarding the backend the files of the streams are uploaded to
+type Storage struct {
+	Backend      string        `envconfig:"STORAGE_BACKEND" default:"disk"`                         // Can be "disk" or "s3", defines where the files of the streams are served from
+	SyncInterval time.Duration `envconfig:"STORAGE_SYNC_INTERVAL" default:"1s"`                     // Time period between the uploads of the new files of the streams
+	S3Endpoint   string        `envconfig:"STORAGE_S3_ENDPOINT" default:"https://s3.amazonaws.com"` // Endpoint of the S3 compatible service, like the address of a MinIO server
+	S3Region     string        `envconfig:"STORAGE_S3_REGION" default:"us-east-1"`                  // Region of the bucket
+	S3Bucket     string        `envconfig:"STORAGE_S3_BUCKET" default:""`                           // Name of the bucket the files are uploaded to
+	S3Prefix     string        `envconfig:"STORAGE_S3_PREFIX" default:""`                           // Prefix of the keys of the uploaded files
+	S3AccessKey  string        `envconfig:"STORAGE_S3_ACCESS_KEY" default:""`                       // Access key of the bucket
+	S3SecretKey  string        `envconfig:"STORAGE_S3_SECRET_KEY" default:""`                       // Secret key of the bucket
+	S3PathStyle  bool          `envconfig:"STORAGE_S3_PATH_STYLE" default:"false"`                  // Indicates if the bucket is addressed in the path instead of the host, required by MinIO
+	S3PublicURL  string        `envconfig:"STORAGE_S3_PUBLIC_URL" default:""`                       // URL the prefix of the bucket is served from, like a CDN. The files are served by the service if empty
+}
+
+// Retention describes information regarding the deletion of the stored segments and recordings
+type Retention struct {
+	RetentionStreamSize       int           `envconfig:"RETENTION_STREAM_SIZE" default:"0"`            // Maximum size of the files of a stream in megabytes, 0 means no limit
+	RetentionTotalSize        int           `envconfig:"RETENTION_TOTAL_SIZE" default:"0"`             // Maximum size of the files of every stream in megabytes, 0 means no limit
+	RetentionMaxAge           time.Duration `envconfig:"RETENTION_MAX_AGE" default:"0s"`               // Age after which the segments and recordings are deleted, 0 means no limit
+	RetentionStoreLimit       int           `envconfig:"RETENTION_STORE_LIMIT" default:"0"`            // Hard limit of the size of the files in the store in megabytes, new streams are refused once it is reached, 0 means no limit
+	RetentionOrphanAge        time.Duration `envconfig:"RETENTION_ORPHAN_AGE" default:"0s"`            // Age after which the directories of the store not belonging to any stream are deleted at startup and on demand, 0 turns it off
+	RetentionOrphanReportOnly bool          `envconfig:"RETENTION_ORPHAN_REPORT_ONLY" default:"false"` // Indicates if the orphaned directories of the store are only reported instead of deleted
+}
+
+// Snapshot describes information regarding the JPEG snapshots of the streams
+type Snapshot struct {
+	SnapshotWidth    int           `envconfig:"SNAPSHOT_WIDTH" default:"0"`      // Default width of the snapshots in pixels, 0 keeps the width of the video
+	SnapshotCacheTTL time.Duration `envconfig:"SNAPSHOT_CACHE_TTL" default:"5s"` // Time the snapshot of a stream is reused for
+}
+
+// Thumbnail describes information regarding the poster images written next to the segments of the streams
+type Thumbnail struct {
+	ThumbnailInterval time.Duration `envconfig:"THUMBNAIL_INTERVAL" default:"0s"` // Time period between the refreshes of the poster images, 0 turns them off
+	ThumbnailWidth    int           `envconfig:"THUMBNAIL_WIDTH" default:"320"`   // Width of the poster images in pixels, 0 keeps the aspect ratio based on the height
+	ThumbnailHeight   int           `envconfig:"THUMBNAIL_HEIGHT" default:"0"`    // Height of the poster images in pixels, 0 keeps the aspect ratio based on the width
+}
+
+// LowLatency describes information regarding the low latency HLS mode of the streams
+type LowLatency struct {
+	LLHLSEnabled      bool          `envconfig:"LL_HLS_ENABLED" default:"false"`       // Indicates if streams can be started in low latency mode and their playlists can be reloaded blocking
+	LLHLSPartDuration time.Duration `envconfig:"LL_HLS_PART_DURATION" default:"500ms"` // Duration of the parts of the segments of the low latency streams
+	LLHLSBlockTimeout time.Duration `envconfig:"LL_HLS_BLOCK_TIMEOUT" default:"0s"`    // Time a blocking playlist reload waits for the requested segment, three times the segment duration if 0
+}
+
+// DVR describes information regarding the rolling history of the streams that can be rewound
+type DVR struct {
+	DVRMaxWindow time.Duration `envconfig:"DVR_MAX_WINDOW" default:"30m"` // Longest DVR window a stream can be started with, 0 turns the DVR windows off
+	// DVRBitrate is the bitrate in kbit/s the footprint of the DVR windows is estimated with, the windows that cannot fit into the size limits are refused
+	DVRBitrate int `envconfig:"DVR_BITRATE" default:"4000"`
+}
+
+// FFmpeg describes information regarding the ffmpeg processes
+type FFmpeg struct {
+	Transcoder       string   `envconfig:"TRANSCODER" default:"ffmpeg"`        // Can be "ffmpeg" or "fake", which writes an empty playlist instead of transcoding the sources
+	FFmpegPath       string   `envconfig:"FFMPEG_PATH" default:"ffmpeg"`       // Path of the ffmpeg binary, looked up in the PATH if it is only a name
+	FFmpegInputArgs  []string `envconfig:"FFMPEG_INPUT_ARGS" default:""`       // A list of arguments added before the input of the sources, like -stimeout,5000000
+	FFmpegOutputArgs []string `envconfig:"FFMPEG_OUTPUT_ARGS" default:""`      // A list of arguments added before the output path of the streams
+	FFmpegUnsafeArgs bool     `envconfig:"FFMPEG_UNSAFE_ARGS" default:"false"` // Indicates if the start requests can add arguments to the ffmpeg processes
+	// The limits of the ffmpeg processes are applied where the platform supports them, the zero values are not applied
+	ProcessNice        int     `envconfig:"PROCESS_NICE" default:"0"`                                 // Niceness of the processes, between -20 and 19
+	ProcessCPUAffinity string  `envconfig:"PROCESS_CPU_AFFINITY" default:""`                          // CPUs the processes are pinned to, like 0-3,6
+	ProcessCPUQuota    float64 `envconfig:"PROCESS_CPU_QUOTA" default:"0"`                            // Number of CPUs the processes of a stream can use at most, like 1.5
+	ProcessCgroupRoot  string  `envconfig:"PROCESS_CGROUP_ROOT" default:"/sys/fs/cgroup/rtsp-stream"` // cgroup v2 directory the cgroups of the streams are created in
+	ProcessCPUBudget   float64 `envconfig:"PROCESS_CPU_BUDGET" default:"0"`                           // Number of CPUs the quotas of the running streams can add up to
+	// ProcessSampleInterval is the time between the samples of the resource usage of the processes, 0 turns the sampling off
+	ProcessSampleInterval time.Duration `envconfig:"PROCESS_SAMPLE_INTERVAL" default:"10s"`
+	// ProcessKillGrace is the time the processes have to exit after they are asked to, with the processes they spawned, before they are killed
+	ProcessKillGrace time.Duration `envconfig:"PROCESS_KILL_GRACE" default:"5s"`
+	// The states of the running processes are stored to find them again after an unclean exit of the service, the directory should be outside of the store directory
+	ProcessStateDir string `envconfig:"PROCESS_STATE_DIR" default:"./state/processes"` // Directory of the states of the processes, empty turns it off
+	OrphanPolicy    string `envconfig:"ORPHAN_POLICY" default:"terminate"`             // Can be "terminate" or "adopt", what is done with the processes found still running at startup
+	// The input options of the udp:// and rtp:// sources, the ones given in the query of the URI are kept
+	UDPFifoSize        int    `envconfig:"SOURCE_UDP_FIFO_SIZE" default:"50000"`       // Number of 188 byte packets ffmpeg buffers of the udp:// sources, 0 leaves it to ffmpeg
+	UDPOverrunNonfatal bool   `envconfig:"SOURCE_UDP_OVERRUN_NONFATAL" default:"true"` // Indicates if the udp:// sources drop the packets instead of failing once their buffer is full
+	UDPLocalAddress    string `envconfig:"SOURCE_UDP_LOCAL_ADDRESS" default:""`        // Address of the local interface the packets are received and the multicast groups joined on
+	SDPDir             string `envconfig:"SOURCE_SDP_DIR" default:""`                  // Directory of the SDP files of the streams, rtsp-stream-sdp of the temporary directory if empty
+}
+
+// TLS describes information regarding the HTTPS listener of the service
+type TLS struct {
+	TLSCertFile      string        `envconfig:"TLS_CERT_FILE" default:""`        // Path of the PEM encoded certificate chain, the service listens on HTTP if empty
+	TLSKeyFile       string        `envconfig:"TLS_KEY_FILE" default:""`         // Path of the PEM encoded private key of the certificate
+	TLSClientCAFile  string        `envconfig:"TLS_CLIENT_CA_FILE" default:""`   // Path of the PEM encoded CAs the client certificates are verified with, they are not required if empty
+	TLSMinVersion    string        `envconfig:"TLS_MIN_VERSION" default:"1.2"`   // Can be "1.2" or "1.3", the oldest TLS version accepted from the clients
+	TLSWatchInterval time.Duration `envconfig:"TLS_WATCH_INTERVAL" default:"1m"` // Time period between the checks of the certificate files for renewals, 0 turns them off
+}
+
+// Enabled indicates if the service listens on HTTPS
+func (t TLS) Enabled() bool {
+	return t.TLSCertFile != ""
+}
+
+// Listener describes information regarding the Unix domain socket and the admin listener of the service
+type Listener struct {
+	ListenSocket     string   `envconfig:"LISTEN_SOCKET" default:""`          // Path of a Unix domain socket the service listens on next to the port, like for a reverse proxy on the same host
+	ListenSocketMode string   `envconfig:"LISTEN_SOCKET_MODE" default:"0660"` // Permissions of the socket file in octal
+	AdminAddress     string   `envconfig:"ADMIN_ADDRESS" default:""`          // Address of the listener of the endpoints not in PUBLIC_GROUPS, like 127.0.0.1:8081. Every endpoint is served on the port if empty
+	PublicGroups     []string `envconfig:"PUBLIC_GROUPS" default:"media"`     // Groups of the endpoints served on the port if ADMIN_ADDRESS is set: media, management, metrics or debug
+}
+
+// SocketMode returns the permissions of the socket file, 0660 if they cannot be parsed
+func (l Listener) SocketMode() os.FileMode {
+	mode, err := strconv.ParseUint(l.ListenSocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0660
+	}
+	return os.FileMode(mode)
+}
+
+// HTTP2 describes information regarding the HTTP/2 connections of the clients, which are used over TLS automatically
+type HTTP2 struct {
+	H2CEnabled       bool          `envconfig:"H2C_ENABLED" default:"false"`     // Turns on / off HTTP/2 without TLS (h2c), for the deployments behind a TLS terminating load balancer
+	HTTP2MaxStreams  uint32        `envconfig:"HTTP2_MAX_STREAMS" default:"250"` // Maximum number of concurrent requests on a single HTTP/2 connection
+	HTTP2IdleTimeout time.Duration `envconfig:"HTTP2_IDLE_TIMEOUT" default:"2m"` // Time an HTTP/2 connection without requests is kept open for
+}
+
+// Access describes information regarding the addresses the endpoints can be called from
+type Access struct {
+	ManagementAllow []string `envconfig:"ACCESS_MANAGEMENT_ALLOW" default:""` // CIDR ranges allowed to call the management endpoints, every address is allowed if empty
+	ManagementDeny  []string `envconfig:"ACCESS_MANAGEMENT_DENY" default:""`  // CIDR ranges denied from the management endpoints, even if they are allowed
+	StreamsAllow    []string `envconfig:"ACCESS_STREAMS_ALLOW" default:""`    // CIDR ranges allowed to request the files of the streams, every address is allowed if empty
+	StreamsDeny     []string `envconfig:"ACCESS_STREAMS_DENY" default:""`     // CIDR ranges denied from the files of the streams, even if they are allowed
+	TrustedProxies  []string `envconfig:"ACCESS_TRUSTED_PROXIES" default:""`  // CIDR ranges of the proxies whose X-Forwarded-For header is used for the client address
+}
+
+// Sources describes information regarding the hosts the streams can be started from
+type Sources struct {
+	SourceAllow   []string `envconfig:"SOURCE_ALLOW" default:""`                            // Hosts, *.domains or CIDR ranges the streams can be started from, every public host is allowed if empty
+	SourceDeny    []string `envconfig:"SOURCE_DENY" default:""`                             // Hosts, *.domains or CIDR ranges the streams cannot be started from, even if they are allowed
+	SourceSchemes []string `envconfig:"SOURCE_SCHEMES" default:"rtsp,rtsps,rtmp,rtmps,srt"` // Schemes of the URIs the streams can be started from
+	// LocalEnabled lets the streams be started from file:// URIs of local files and capture devices like file:///dev/video0.
+	// It is off by default, as the local sources can disclose the files of the host
+	LocalEnabled bool     `envconfig:"SOURCE_LOCAL_ENABLED" default:"false"`
+	LocalPaths   []string `envconfig:"SOURCE_LOCAL_PATHS" default:""` // Files, directories and devices the local sources can be read from
+	// HTTPEnabled lets the streams be started from http:// and https:// URIs, like the MJPEG streams of cheap cameras
+	HTTPEnabled bool `envconfig:"SOURCE_HTTP_ENABLED" default:"false"`
+	// UDPEnabled lets the streams be started from udp:// and rtp:// URIs and from SDP files, like the multicast feeds of the local network
+	UDPEnabled bool `envconfig:"SOURCE_UDP_ENABLED" default:"false"`
+	// FallbackCredentials are the username:password pairs tried in order once a source refuses the credentials of its stream,
+	// after the ones of the start request
+	FallbackCredentials []string `envconfig:"SOURCE_FALLBACK_CREDENTIALS" default:""`
+}
+
+// Credentials describes the username and the password a source is connected with
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// ParseFallbackCredentials returns the configured fallback credentials, the error describes the first entry that cannot be used
+func (s Sources) ParseFallbackCredentials() ([]Credentials, error) {
+	credentials := []Credentials{}
+	for _, entry := range s.FallbackCredentials {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, ErrInvalidConfigFn("SOURCE_FALLBACK_CREDENTIALS", "entries have to be written as username:password")
+		}
+		credentials = append(credentials, Credentials{parts[0], parts[1]})
+	}
+	return credentials, nil
+}
+
+// Enabled indicates if the hosts of the sources are checked against the lists
+func (s Sources) Enabled() bool {
+	return len(s.SourceAllow) > 0 || len(s.SourceDeny) > 0
+}
+
+// Schemes returns the schemes of the URIs the streams can be started from, http, https, udp and rtp are added if they are enabled
+func (s Sources) Schemes() []string {
+	schemes := append([]string{}, s.SourceSchemes...)
+	if s.HTTPEnabled {
+		schemes = append(schemes, "http", "https")
+	}
+	if s.UDPEnabled {
+		schemes = append(schemes, "udp", "rtp")
+	}
+	return schemes
+}
+
+// Discovery describes information regarding the discovery of the ONVIF cameras of the local network
+type Discovery struct {
+	DiscoveryEnabled  bool          `envconfig:"DISCOVERY_ENABLED" default:"false"` // Turns on / off the endpoint discovering the ONVIF cameras of the local network
+	DiscoveryWait     time.Duration `envconfig:"DISCOVERY_WAIT" default:"3s"`       // Time the answers of the cameras to the probe are collected for
+	DiscoveryTimeout  time.Duration `envconfig:"DISCOVERY_TIMEOUT" default:"10s"`   // Time a whole discovery can take, the queries of the stream URIs included
+	DiscoveryUsername string        `envconfig:"DISCOVERY_USERNAME" default:""`     // Username the cameras are queried with if the request does not give one
+	DiscoveryPassword string        `envconfig:"DISCOVERY_PASSWORD" default:""`     // Password the cameras are queried with if the request does not give one
+}
+
+// WHEP describes information regarding the WebRTC playback of the streams, it requires the build with the webrtc tag
+type WHEP struct {
+	WHEPEnabled    bool     `envconfig:"WHEP_ENABLED" default:"false"`  // Turns on / off the WHEP endpoints playing the streams over WebRTC
+	WHEPMaxViewers int      `envconfig:"WHEP_MAX_VIEWERS" default:"10"` // Maximum number of WebRTC sessions of a stream at the same time
+	WHEPICEServers []string `envconfig:"WHEP_ICE_SERVERS" default:""`   // A list of STUN and TURN URLs, like stun:stun.l.google.com:19302, only host candidates are gathered if empty
+}
+
+// Webhooks describes information regarding the notifications sent about the lifecycle of the streams
+type Webhooks struct {
+	WebhookURLs     []string      `envconfig:"WEBHOOK_URLS" default:""`      // A list of URLs the lifecycle events of the streams are posted to
+	WebhookSecret   string        `envconfig:"WEBHOOK_SECRET" default:""`    // Key of the HMAC signature of the payloads, they are not signed if empty
+	WebhookTimeout  time.Duration `envconfig:"WEBHOOK_TIMEOUT" default:"5s"` // Time a single delivery of a payload can take
+	WebhookAttempts int           `envconfig:"WEBHOOK_ATTEMPTS" default:"3"` // Number of attempts to deliver a payload before it is dropped
+	WebhookBackoff  time.Duration `envconfig:"WEBHOOK_BACKOFF" default:"1s"` // Delay after the first failed attempt, doubled after every further one
 }
 
 // Specification describes the application context settings
 type Specification struct {
-	Debug        bool `envconfig:"DEBUG" default:"false"`         // Indicates if debug log should be enabled or not
-	Port         int  `envconfig:"PORT" default:"8080"`           // Port that the application listens on
-	ListEndpoint bool `envconfig:"LIST_ENDPOINT" default:"false"` // Turns on / off the stream listing endpoint feature
+	Debug           bool   `envconfig:"DEBUG" default:"false"`                  // Indicates if debug log should be enabled or not
+	Port            int    `envconfig:"PORT" default:"8080"`                    // Port that the application listens on, 0 turns the TCP listener off if a socket is configured
+	PublicURL       string `envconfig:"PUBLIC_URL" default:""`                  // Base URL the URIs of the responses are prefixed with, like https://streams.example.com, they are relative if empty
+	PathPrefix      string `envconfig:"PATH_PREFIX" default:""`                 // Path the service is mounted under behind a reverse proxy, like /video. The routes are served under it and the returned URIs carry it
+	ListEndpoint    bool   `envconfig:"LIST_ENDPOINT" default:"false"`          // Turns on / off the stream listing endpoint feature
+	MetricsEndpoint bool   `envconfig:"METRICS_ENDPOINT" default:"false"`       // Turns on / off the prometheus metrics endpoint feature
+	LegacyErrors    bool   `envconfig:"LEGACY_ERRORS" default:"false"`          // Indicates if errors are sent only with their message, like before the error codes
+	GzipPlaylists   bool   `envconfig:"GZIP_PLAYLISTS" default:"true"`          // Indicates if playlists are compressed for the clients accepting it
+	EventsEndpoint  bool   `envconfig:"EVENTS_ENDPOINT" default:"false"`        // Turns on / off the WebSocket feed of the stream lifecycle events
+	EventsBuffer    int    `envconfig:"EVENTS_BUFFER" default:"64"`             // Number of events buffered for each subscriber of the feed, later events are dropped for slow subscribers
+	EventLogSize    int    `envconfig:"EVENT_LOG_SIZE" default:"1000"`          // Number of the last events kept in memory for /events/log, 0 turns the log off
+	ReloadEndpoint  bool   `envconfig:"RELOAD_ENDPOINT" default:"false"`        // Turns on / off the endpoint reloading the configuration at runtime
+	DebugEndpoint   bool   `envconfig:"DEBUG_ENDPOINT" default:"false"`         // Turns on / off the pprof profiles and the expvar variables under /debug
+	DebugAddress    string `envconfig:"DEBUG_ADDRESS" default:"127.0.0.1:6060"` // Address of the separate listener of the debug endpoints, they are mounted on the router if empty
+	DocsEndpoint    bool   `envconfig:"DOCS_ENDPOINT" default:"false"`          // Turns on / off the Swagger UI of the API under /docs
+	ConfigFile      string `ignored:"true"`                                     // Path of the configuration file the settings were loaded from, empty if only the environment is used
+
+	Flags map[string]string `ignored:"true"` // Values of the command-line flags the settings were loaded with, keyed by their environment variable
 
 	CORS
 	Auth
 	Process
 	ProcessLogging
+	RequestLog
+	Encryption
+	Hardware
+	Persistence
+	Health
+	Viewers
+	RateLimit
+	Cache
+	Storage
+	Retention
+	Snapshot
+	Thumbnail
+	LowLatency
+	DVR
+	Webhooks
+	FFmpeg
+	TLS
+	Listener
+	HTTP2
+	Access
+	Sources
+	Discovery
+	WHEP
 }
 
 // InitConfig is to initalise the config
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// envPrefix is the prefix of the environment variables of the configuration
+const envPrefix = "RTSP_STREAM"
+
+// secretSettings are the keys of the settings that are redacted in the effective configuration
+var secretSettings = map[string]bool{
+	"AUTH_JWT_SECRET":             true,
+	"AUTH_URL_SIGNING_KEY":        true,
+	"AUTH_BASIC_PASSWORD":         true,
+	"AUTH_API_KEYS":               true,
+	"PERSISTENCE_KEY":             true,
+	"STORAGE_S3_ACCESS_KEY":       true,
+	"STORAGE_S3_SECRET_KEY":       true,
+	"SOURCE_FALLBACK_CREDENTIALS": true,
+	"DISCOVERY_PASSWORD":          true,
+	"WEBHOOK_SECRET":              true,
+}
+
+// userinfoPattern matches the credentials in the URLs of the settings, like the ones of the webhooks
+var userinfoPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.\-]*://)[^/?#\s]*@`)
+
+// ErrUnknownFormat describes an error for configuration files that are neither YAML nor JSON
+var ErrUnknownFormat = errors.New("Configuration file has to be .yml, .yaml or .json")
+
+// errUnsupportedValue describes an error for values that are neither scalars nor lists of scalars
+var errUnsupportedValue = errors.New("Value has to be a scalar or a list of scalars")
+
+// ErrUnknownKeyFn describes an error for keys of the configuration file that are not part of the configuration
+var ErrUnknownKeyFn = func(key string) error {
+	return fmt.Errorf("Unknown configuration key %s", key)
+}
+
+// ErrInvalidValueFn describes an error for values of the configuration file that cannot be used for their key
+var ErrInvalidValueFn = func(key string, value interface{}) error {
+	return fmt.Errorf("Invalid value of %s: %v", key, value)
+}
+
+// LoadConfig creates the configuration from the environment variables and the given configuration file.
+// The environment variables override the values of the file, the file is skipped if the path is empty.
+// The result is validated, so the service does not start with an unusable configuration
+func LoadConfig(path string) (*Specification, error) {
+	return Load(path, nil)
+}
+
+// Load creates the configuration like LoadConfig, then applies the values of the command-line flags keyed by their
+// environment variable without the prefix. The flags override the environment variables and the file
+func Load(path string, flags map[string]string) (*Specification, error) {
+	var s Specification
+	if err := envconfig.Process(envPrefix, &s); err != nil {
+		return nil, err
+	}
+	s.ConfigFile, s.Flags = path, flags
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values, err := parseFile(filepath.Ext(path), content)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.apply(values, os.LookupEnv); err != nil {
+			return nil, err
+		}
+	}
+	settable := fields(reflect.ValueOf(&s).Elem(), map[string]reflect.Value{})
+	for key, value := range flags {
+		field, ok := settable[key]
+		if !ok {
+			return nil, ErrUnknownKeyFn(key)
+		}
+		if err := setField(field, value); err != nil {
+			return nil, ErrInvalidValueFn(key, value)
+		}
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// parseFile parses the content of a configuration file with the given extension into its keys and values.
+// Nested maps are flattened by joining their keys with underscores, so cors: {enabled: true} sets CORS_ENABLED
+func parseFile(ext string, content []byte) (map[string]interface{}, error) {
+	var tree map[string]interface{}
+	switch strings.ToLower(ext) {
+	case ".json":
+		if err := json.Unmarshal(content, &tree); err != nil {
+			return nil, err
+		}
+	case ".yml", ".yaml":
+		// Duplicated keys are refused instead of the last one winning
+		if err := yaml.UnmarshalStrict(content, &tree); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+	values := map[string]interface{}{}
+	flatten("", tree, values)
+	return values, nil
+}
+
+// flatten copies the values of the tree into the given map, keyed by their uppercased path
+func flatten(prefix string, tree map[string]interface{}, values map[string]interface{}) {
+	for key, value := range tree {
+		key = strings.ToUpper(strings.Replace(key, "-", "_", -1))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch nested := value.(type) {
+		case map[string]interface{}:
+			flatten(key, nested, values)
+		case map[interface{}]interface{}:
+			// The nested maps of YAML can be keyed by any scalar
+			keyed := map[string]interface{}{}
+			for k, v := range nested {
+				keyed[fmt.Sprint(k)] = v
+			}
+			flatten(key, keyed, values)
+		default:
+			values[key] = value
+		}
+	}
+}
+
+// fields returns the settable fields of the configuration keyed by their environment variable without the prefix
+func fields(v reflect.Value, result map[string]reflect.Value) map[string]reflect.Value {
+	for i := 0; i < v.NumField(); i++ {
+		field, info := v.Field(i), v.Type().Field(i)
+		if info.Anonymous && field.Kind() == reflect.Struct {
+			fields(field, result)
+			continue
+		}
+		if key := info.Tag.Get("envconfig"); key != "" {
+			result[key] = field
+		}
+	}
+	return result
+}
+
+// Diff returns the keys of the settings that are different in the two configurations
+func Diff(a, b *Specification) []string {
+	before := fields(reflect.ValueOf(a).Elem(), map[string]reflect.Value{})
+	after := fields(reflect.ValueOf(b).Elem(), map[string]reflect.Value{})
+	keys := []string{}
+	for key, value := range before {
+		// Empty lists are the same, whether they were read from the environment or the file
+		if value.Kind() == reflect.Slice && value.Len() == 0 && after[key].Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(value.Interface(), after[key].Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Settings returns the effective configuration keyed by the environment variables of the settings. The secrets that are set
+// are replaced with ***, the credentials of the URLs are masked and the durations are written like 30s
+func (s *Specification) Settings() map[string]interface{} {
+	settings := map[string]interface{}{}
+	for key, field := range fields(reflect.ValueOf(s).Elem(), map[string]reflect.Value{}) {
+		settings[envPrefix+"_"+key] = setting(key, field)
+	}
+	return settings
+}
+
+// setting returns the value of the setting as it is shown in the effective configuration
+func setting(key string, field reflect.Value) interface{} {
+	switch {
+	case secretSettings[key]:
+		// The secrets are strings or lists of them, the empty ones are shown so it is clear they are not set
+		if field.Len() == 0 {
+			return field.Interface()
+		}
+		return "***"
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		return field.Interface().(time.Duration).String()
+	case field.Kind() == reflect.String:
+		return userinfoPattern.ReplaceAllString(field.String(), "${1}***@")
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		values := make([]string, field.Len())
+		for i := range values {
+			values[i] = userinfoPattern.ReplaceAllString(field.Index(i).String(), "${1}***@")
+		}
+		return values
+	}
+	return field.Interface()
+}
+
+// apply sets the values of the configuration file, except for the keys set by environment variables.
+// Like envconfig, a variable counts with or without the prefix
+func (s *Specification) apply(values map[string]interface{}, lookupEnv func(string) (string, bool)) error {
+	settable := fields(reflect.ValueOf(s).Elem(), map[string]reflect.Value{})
+	for key, value := range values {
+		field, ok := settable[key]
+		if !ok {
+			return ErrUnknownKeyFn(key)
+		}
+		if _, ok := lookupEnv(envPrefix + "_" + key); ok {
+			continue
+		}
+		if _, ok := lookupEnv(key); ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return ErrInvalidValueFn(key, value)
+		}
+	}
+	return nil
+}
+
+// scalar returns the text of a single value of the configuration file
+func scalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", errUnsupportedValue
+	}
+}
+
+// setField sets the field to the value of the configuration file, parsed the same way as an environment variable
+func setField(field reflect.Value, value interface{}) error {
+	if field.Kind() == reflect.Slice {
+		items, ok := value.([]interface{})
+		if !ok {
+			text, err := scalar(value)
+			if err != nil {
+				return err
+			}
+			items = []interface{}{}
+			if text != "" {
+				for _, item := range strings.Split(text, ",") {
+					items = append(items, item)
+				}
+			}
+		}
+		list := make([]string, len(items))
+		for i, item := range items {
+			text, err := scalar(item)
+			if err != nil {
+				return err
+			}
+			list[i] = text
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+	text, err := scalar(value)
+	if err != nil {
+		return err
+	}
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(text)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		i, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(i))
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return errUnsupportedValue
+	}
+	return nil
+}
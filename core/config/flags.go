@@ -0,0 +1,155 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Flags describes the command-line flags of the configuration. There is a flag for every environment variable,
+// named after the variable without the prefix, like --store-dir for RTSP_STREAM_STORE_DIR
+type Flags struct {
+	set    *flag.FlagSet
+	output io.Writer
+	config *string
+	values map[string]string // Values of the given flags keyed by their environment variable without the prefix
+}
+
+// flagValue is the value of the flag of a single setting, checked the same way as the values of the configuration file
+type flagValue struct {
+	key    string
+	kind   reflect.Type
+	values map[string]string
+}
+
+// String returns the given value of the flag
+func (v *flagValue) String() string {
+	if v == nil || v.values == nil {
+		return ""
+	}
+	return v.values[v.key]
+}
+
+// Set checks if the text can be used for the setting and keeps it
+func (v *flagValue) Set(text string) error {
+	if err := setField(reflect.New(v.kind).Elem(), text); err != nil {
+		return fmt.Errorf("has to be %s", typeDescription(v.kind))
+	}
+	v.values[v.key] = text
+	return nil
+}
+
+// IsBoolFlag lets the boolean flags be given without a value, like --debug
+func (v *flagValue) IsBoolFlag() bool {
+	return v.kind.Kind() == reflect.Bool
+}
+
+// typeName returns the name of the type of a setting shown by the help
+func typeName(kind reflect.Type) string {
+	switch {
+	case kind == reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case kind.Kind() == reflect.Slice:
+		return "list"
+	case kind.Kind() == reflect.Float64:
+		return "float"
+	default:
+		return kind.Kind().String()
+	}
+}
+
+// typeDescription describes the values accepted for the type of a setting
+func typeDescription(kind reflect.Type) string {
+	switch typeName(kind) {
+	case "duration":
+		return "a duration like 2m30s"
+	case "bool":
+		return "true or false"
+	case "int":
+		return "an integer"
+	case "float":
+		return "a number"
+	default:
+		return "a " + typeName(kind)
+	}
+}
+
+// flagName returns the name of the flag of the given environment variable without the prefix
+func flagName(key string) string {
+	return strings.ToLower(strings.Replace(key, "_", "-", -1))
+}
+
+// NewFlags defines the flags of every setting and the one of the configuration file. The help is written into the output
+func NewFlags(name string, output io.Writer) *Flags {
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+	// The errors are returned instead, so they can be reported on a single line
+	set.SetOutput(ioutil.Discard)
+	set.Usage = func() {}
+	f := &Flags{set, output, nil, map[string]string{}}
+	f.config = set.String("config", "", "Path of a YAML or JSON configuration file, environment variables and flags override its values")
+	for key, field := range fields(reflect.ValueOf(&Specification{}).Elem(), map[string]reflect.Value{}) {
+		set.Var(&flagValue{key, field.Type(), f.values}, flagName(key), envPrefix+"_"+key)
+	}
+	return f
+}
+
+// Parse parses the arguments. If the help is requested it is written and flag.ErrHelp is returned
+func (f *Flags) Parse(args []string) error {
+	err := f.set.Parse(args)
+	if err == flag.ErrHelp {
+		f.PrintHelp()
+	}
+	return err
+}
+
+// PrintHelp writes the flags with their environment variable, their type and their default
+func (f *Flags) PrintHelp() {
+	defaults := defaultValues(reflect.TypeOf(Specification{}), map[string]string{})
+	fmt.Fprintf(f.output, "Usage of %s:\n", f.set.Name())
+	f.set.VisitAll(func(fl *flag.Flag) {
+		value, ok := fl.Value.(*flagValue)
+		if !ok {
+			fmt.Fprintf(f.output, "  --%s string\n    \t%s\n", fl.Name, fl.Usage)
+			return
+		}
+		fmt.Fprintf(f.output, "  --%s %s\n    \t%s", fl.Name, typeName(value.kind), fl.Usage)
+		if def := defaults[value.key]; def != "" {
+			fmt.Fprintf(f.output, " (default %s)", def)
+		}
+		fmt.Fprintln(f.output)
+	})
+}
+
+// defaultValues returns the defaults of the settings keyed by their environment variable without the prefix
+func defaultValues(t reflect.Type, result map[string]string) map[string]string {
+	for i := 0; i < t.NumField(); i++ {
+		info := t.Field(i)
+		if info.Anonymous && info.Type.Kind() == reflect.Struct {
+			defaultValues(info.Type, result)
+			continue
+		}
+		if key := info.Tag.Get("envconfig"); key != "" {
+			result[key] = info.Tag.Get("default")
+		}
+	}
+	return result
+}
+
+// ConfigFile returns the path of the configuration file given by the flags, empty if there is none
+func (f *Flags) ConfigFile() string {
+	return *f.config
+}
+
+// Values returns the values of the given flags keyed by their environment variable without the prefix
+func (f *Flags) Values() map[string]string {
+	return f.values
+}
+
+// Load creates the configuration from the configuration file, the environment variables and the flags
+func (f *Flags) Load() (*Specification, error) {
+	return Load(f.ConfigFile(), f.Values())
+}
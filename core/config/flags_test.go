@@ -0,0 +1,86 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlags(t *testing.T) {
+	t.Run("Should override the environment and the file with the flags", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "flags")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "config.yml")
+		assert.Nil(t, ioutil.WriteFile(path, []byte("port: 9090\nstore_dir: ./file\nhls_time: 4\n"), 0644))
+		assert.Nil(t, os.Setenv("RTSP_STREAM_STORE_DIR", "./env"))
+		defer os.Unsetenv("RTSP_STREAM_STORE_DIR")
+
+		flags := NewFlags("rtsp-stream", ioutil.Discard)
+		assert.Nil(t, flags.Parse([]string{"--config", path, "--port", "7070", "--debug", "--cleanup-time=2m30s", "--renditions", "1080:4M,720:2M"}))
+		spec, err := flags.Load()
+		if assert.Nil(t, err) {
+			assert.Equal(t, 7070, spec.Port)
+			assert.Equal(t, "./env", spec.StoreDir)
+			assert.Equal(t, 4, spec.HLSTime)
+			assert.True(t, spec.Debug)
+			assert.Equal(t, time.Minute*2+time.Second*30, spec.CleanupTime)
+			assert.Equal(t, []string{"1080:4M", "720:2M"}, spec.Renditions)
+			assert.Equal(t, path, spec.ConfigFile)
+		}
+
+		flags = NewFlags("rtsp-stream", ioutil.Discard)
+		assert.Nil(t, flags.Parse([]string{"--store-dir", "./flag"}))
+		spec, err = flags.Load()
+		if assert.Nil(t, err) {
+			assert.Equal(t, "./flag", spec.StoreDir)
+			assert.Equal(t, 8080, spec.Port)
+		}
+	})
+
+	t.Run("Should refuse the values that cannot be used on a single line", func(t *testing.T) {
+		tt := []struct {
+			Args []string
+			Err  string
+		}{
+			{Args: []string{"--port", "http"}, Err: `invalid value "http" for flag -port: has to be an integer`},
+			{Args: []string{"--cleanup-time", "2 minutes"}, Err: `invalid value "2 minutes" for flag -cleanup-time: has to be a duration like 2m30s`},
+			{Args: []string{"--debug=maybe"}, Err: `invalid boolean value "maybe" for -debug: has to be true or false`},
+			{Args: []string{"--verbose"}, Err: "flag provided but not defined: -verbose"},
+		}
+		for i, testCase := range tt {
+			var output bytes.Buffer
+			err := NewFlags("rtsp-stream", &output).Parse(testCase.Args)
+			if !assert.NotNil(t, err) || !assert.Equal(t, testCase.Err, err.Error()) || !assert.Empty(t, output.String()) {
+				t.Error(fmt.Errorf("%d testcase is failing for TestFlags", i))
+			}
+		}
+
+		flags := NewFlags("rtsp-stream", ioutil.Discard)
+		assert.Nil(t, flags.Parse([]string{"--mode", "fast"}))
+		_, err := flags.Load()
+		assert.Equal(t, ErrInvalidConfigFn("MODE", `"fast" has to be one of auto, copy, transcode`), err)
+	})
+
+	t.Run("Should write the help of every setting", func(t *testing.T) {
+		var output bytes.Buffer
+		assert.Equal(t, flag.ErrHelp, NewFlags("rtsp-stream", &output).Parse([]string{"--help"}))
+		help := output.String()
+		assert.Contains(t, help, "Usage of rtsp-stream:\n")
+		assert.Contains(t, help, "  --port int\n    \tRTSP_STREAM_PORT (default 8080)\n")
+		assert.Contains(t, help, "  --cleanup-time duration\n    \tRTSP_STREAM_CLEANUP_TIME (default 2m0s)\n")
+		assert.Contains(t, help, "  --renditions list\n    \tRTSP_STREAM_RENDITIONS\n")
+		assert.Contains(t, help, "  --config string\n")
+		for key := range fields(reflect.ValueOf(&Specification{}).Elem(), map[string]reflect.Value{}) {
+			assert.Contains(t, help, "  --"+flagName(key)+" ")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// layoutDateFormat is how the {date} variable of the layout templates is written
+const layoutDateFormat = "2006-01-02"
+
+// layoutVariable matches the variables of the layout templates, like {alias} or {metadata.site}
+var layoutVariable = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// layoutValue describes the values the variables of the layout templates can be replaced with, so they cannot leave the store directory
+var layoutValue = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// layoutName describes the characters the segment names and the elements of the directories can be written with
+var layoutName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// segmentNumber matches the number of the segment in the segment template, like %d or %05d
+var segmentNumber = regexp.MustCompile(`%(0[1-9])?d`)
+
+// LayoutValues are the values the variables of the layout templates are replaced with for a stream
+type LayoutValues struct {
+	ID       string            // {id}, the id derived from the URI of the stream
+	Alias    string            // {alias}, the alias of the stream, or its id if it has none
+	Date     time.Time         // {date}, the day the stream is created on
+	Metadata map[string]string // {metadata.<key>}, the metadata of the start request
+}
+
+// ExpandLayout returns the directory of the stream relative to the store directory and the name of its segments without
+// their extension. The error describes the variable whose value is missing or cannot be used in a path
+func (p Process) ExpandLayout(values LayoutValues) (dir, segment string, err error) {
+	if dir, err = expandLayout(p.DirectoryTemplate, values); err != nil {
+		return "", "", err
+	}
+	if segment, err = expandLayout(p.SegmentTemplate, values); err != nil {
+		return "", "", err
+	}
+	return dir, segment, nil
+}
+
+// expandLayout replaces the variables of the template with the values of the stream
+func expandLayout(template string, values LayoutValues) (string, error) {
+	var err error
+	expanded := layoutVariable.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[1 : len(match)-1]
+		value := ""
+		switch {
+		case name == "id":
+			value = values.ID
+		case name == "alias":
+			value = values.Alias
+		case name == "date":
+			value = values.Date.Format(layoutDateFormat)
+		case strings.HasPrefix(name, "metadata."):
+			value = values.Metadata[strings.TrimPrefix(name, "metadata.")]
+		}
+		if !layoutValue.MatchString(value) && err == nil {
+			err = fmt.Errorf("%s has to be set to letters, digits, dots, dashes or underscores", match)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// validateLayout checks if the layout templates only use known variables and always give a path inside the store directory
+func (p Process) validateLayout() error {
+	sample := LayoutValues{ID: "id", Alias: "alias", Date: time.Now(), Metadata: map[string]string{}}
+	templates := []struct{ key, template string }{{"DIRECTORY_TEMPLATE", p.DirectoryTemplate}, {"SEGMENT_TEMPLATE", p.SegmentTemplate}}
+	for _, t := range templates {
+		for _, match := range layoutVariable.FindAllStringSubmatch(t.template, -1) {
+			switch name := match[1]; {
+			case name == "id", name == "alias", name == "date":
+			case strings.HasPrefix(name, "metadata.") && len(name) > len("metadata."):
+				sample.Metadata[strings.TrimPrefix(name, "metadata.")] = "metadata"
+			default:
+				return ErrInvalidConfigFn(t.key, fmt.Sprintf("%s is not one of {id}, {alias}, {date} or {metadata.<key>}", match[0]))
+			}
+		}
+	}
+	// Every stream needs a directory of its own
+	if !strings.Contains(p.DirectoryTemplate, "{id}") && !strings.Contains(p.DirectoryTemplate, "{alias}") {
+		return ErrInvalidConfigFn("DIRECTORY_TEMPLATE", fmt.Sprintf("%q has to contain {id} or {alias}", p.DirectoryTemplate))
+	}
+	dir, segment, _ := p.ExpandLayout(sample)
+	for _, element := range strings.Split(dir, "/") {
+		if !layoutName.MatchString(element) || element == "." || element == ".." {
+			return ErrInvalidConfigFn("DIRECTORY_TEMPLATE", fmt.Sprintf("%q has to be a relative path of letters, digits, dots, dashes or underscores", p.DirectoryTemplate))
+		}
+	}
+	if len(segmentNumber.FindAllString(segment, -1)) != 1 || !layoutName.MatchString(segmentNumber.ReplaceAllString(segment, "0")) {
+		return ErrInvalidConfigFn("SEGMENT_TEMPLATE", fmt.Sprintf("%q has to contain the number of the segment like %%d once, besides letters, digits, dots, dashes or underscores", p.SegmentTemplate))
+	}
+	// The init sections and the DASH chunks are written next to the segments
+	if strings.HasPrefix(segment, "init") || strings.HasPrefix(segment, "chunk-") {
+		return ErrInvalidConfigFn("SEGMENT_TEMPLATE", fmt.Sprintf("%q cannot start with init or chunk-", p.SegmentTemplate))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandLayout(t *testing.T) {
+	date := time.Date(2026, 10, 14, 23, 0, 0, 0, time.UTC)
+	tt := []struct {
+		Directory string
+		Segment   string
+		Values    LayoutValues
+		Dir       string
+		Name      string
+		Err       error
+	}{
+		{Directory: "{alias}", Segment: "%d", Values: LayoutValues{ID: "abc", Alias: "front"}, Dir: "front", Name: "%d"},
+		{
+			Directory: "{metadata.site}/{date}/{id}",
+			Segment:   "{alias}-%05d",
+			Values:    LayoutValues{ID: "abc", Alias: "front", Date: date, Metadata: map[string]string{"site": "north"}},
+			Dir:       "north/2026-10-14/abc",
+			Name:      "front-%05d",
+		},
+		{
+			Directory: "{metadata.site}/{alias}",
+			Segment:   "%d",
+			Values:    LayoutValues{ID: "abc", Alias: "front"},
+			Err:       errors.New("{metadata.site} has to be set to letters, digits, dots, dashes or underscores"),
+		},
+		{
+			Directory: "{metadata.site}/{alias}",
+			Segment:   "%d",
+			Values:    LayoutValues{ID: "abc", Alias: "front", Metadata: map[string]string{"site": "../etc"}},
+			Err:       errors.New("{metadata.site} has to be set to letters, digits, dots, dashes or underscores"),
+		},
+	}
+	for i, testCase := range tt {
+		p := Process{DirectoryTemplate: testCase.Directory, SegmentTemplate: testCase.Segment}
+		dir, name, err := p.ExpandLayout(testCase.Values)
+		if !assert.Equal(t, testCase.Err, err) || !assert.Equal(t, testCase.Dir, dir) || !assert.Equal(t, testCase.Name, name) {
+			t.Error(fmt.Errorf("%d testcase is failing for ExpandLayout", i))
+		}
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	tt := []struct {
+		Directory string
+		Segment   string
+		Err       error
+	}{
+		{Directory: "{alias}", Segment: "%d"},
+		{Directory: "{metadata.site}/{date}/{id}", Segment: "{alias}-%05d"},
+		{Directory: "{region}/{alias}", Segment: "%d", Err: ErrInvalidConfigFn("DIRECTORY_TEMPLATE", "{region} is not one of {id}, {alias}, {date} or {metadata.<key>}")},
+		{Directory: "{alias}", Segment: "{metadata.}%d", Err: ErrInvalidConfigFn("SEGMENT_TEMPLATE", "{metadata.} is not one of {id}, {alias}, {date} or {metadata.<key>}")},
+		{Directory: "{date}", Segment: "%d", Err: ErrInvalidConfigFn("DIRECTORY_TEMPLATE", `"{date}" has to contain {id} or {alias}`)},
+		{Directory: "/{alias}", Segment: "%d", Err: ErrInvalidConfigFn("DIRECTORY_TEMPLATE", `"/{alias}" has to be a relative path of letters, digits, dots, dashes or underscores`)},
+		{Directory: "../{alias}", Segment: "%d", Err: ErrInvalidConfigFn("DIRECTORY_TEMPLATE", `"../{alias}" has to be a relative path of letters, digits, dots, dashes or underscores`)},
+		{Directory: "{alias}", Segment: "segment", Err: ErrInvalidConfigFn("SEGMENT_TEMPLATE", `"segment" has to contain the number of the segment like %d once, besides letters, digits, dots, dashes or underscores`)},
+		{Directory: "{alias}", Segment: "%d-%d", Err: ErrInvalidConfigFn("SEGMENT_TEMPLATE", `"%d-%d" has to contain the number of the segment like %d once, besides letters, digits, dots, dashes or underscores`)},
+		{Directory: "{alias}", Segment: "a/%d", Err: ErrInvalidConfigFn("SEGMENT_TEMPLATE", `"a/%d" has to contain the number of the segment like %d once, besides letters, digits, dots, dashes or underscores`)},
+		{Directory: "{alias}", Segment: "init%d", Err: ErrInvalidConfigFn("SEGMENT_TEMPLATE", `"init%d" cannot start with init or chunk-`)},
+	}
+	for i, testCase := range tt {
+		p := Process{DirectoryTemplate: testCase.Directory, SegmentTemplate: testCase.Segment}
+		if !assert.Equal(t, testCase.Err, p.validateLayout()) {
+			t.Error(fmt.Errorf("%d testcase is failing for validateLayout", i))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProfilePresets are the presets of the software encoder a profile can use
+var ProfilePresets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+// profileBitrate describes the accepted bitrates of the profiles, like 600k or 2M
+var profileBitrate = regexp.MustCompile(`^[1-9][0-9]*[kKmM]?$`)
+
+// Profile describes named encoder settings the streams can be started with, the zero values keep the defaults
+type Profile struct {
+	Name    string `json:"name"`
+	Preset  string `json:"preset,omitempty"`
+	CRF     int    `json:"crf,omitempty"`
+	Bitrate string `json:"bitrate,omitempty"`
+	Height  int    `json:"height,omitempty"` // Height the video is scaled to keeping its aspect ratio
+	FPS     int    `json:"fps,omitempty"`
+	Audio   string `json:"audio,omitempty"`  // Can be "drop", "copy" or "aac"
+	Device  string `json:"device,omitempty"` // Device the accelerated video is encoded on, like 1 or /dev/dri/renderD129
+}
+
+// Transcodes indicates if the profile has settings of the video, so the streams using it have to be transcoded
+func (p Profile) Transcodes() bool {
+	return p.Preset != "" || p.CRF != 0 || p.Bitrate != "" || p.Height != 0 || p.FPS != 0
+}
+
+// ParseProfiles returns the configured profiles by their names, the error describes the first entry that cannot be used.
+// The entries are written as name:key=value|key=value, like low:preset=veryfast|crf=28|height=480|fps=15|audio=aac|device=1
+func (p Process) ParseProfiles() (map[string]Profile, error) {
+	profiles := map[string]Profile{}
+	for _, entry := range p.Profiles {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrInvalidConfigFn("PROFILES", "entries have to be written as name:key=value|key=value")
+		}
+		if _, ok := profiles[parts[0]]; ok {
+			return nil, ErrInvalidConfigFn("PROFILES", fmt.Sprintf("%s is configured more than once", parts[0]))
+		}
+		profile, err := parseProfile(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		profiles[profile.Name] = profile
+	}
+	if _, ok := profiles[p.DefaultProfile]; p.DefaultProfile != "" && !ok {
+		return nil, ErrInvalidConfigFn("DEFAULT_PROFILE", fmt.Sprintf("%s is not one of the PROFILES", p.DefaultProfile))
+	}
+	return profiles, nil
+}
+
+// parseProfile reads the settings of the named profile
+func parseProfile(name, settings string) (Profile, error) {
+	profile := Profile{Name: name}
+	invalid := func(reason string) (Profile, error) {
+		return Profile{}, ErrInvalidConfigFn("PROFILES", fmt.Sprintf("%s: %s", name, reason))
+	}
+	for _, setting := range strings.Split(settings, "|") {
+		pair := strings.SplitN(setting, "=", 2)
+		if len(pair) != 2 {
+			return invalid(fmt.Sprintf("%q has to be written as key=value", setting))
+		}
+		key, value := strings.ToLower(strings.TrimSpace(pair[0])), strings.TrimSpace(pair[1])
+		var err error
+		switch key {
+		case "preset":
+			profile.Preset, err = value, oneOf("PROFILES", value, ProfilePresets...)
+		case "crf":
+			if profile.CRF, err = strconv.Atoi(value); err != nil || profile.CRF < 1 || profile.CRF > 51 {
+				return invalid("crf has to be between 1 and 51")
+			}
+		case "bitrate":
+			if !profileBitrate.MatchString(value) {
+				return invalid("bitrate has to be like 600k or 2M")
+			}
+			profile.Bitrate = value
+		case "height":
+			if profile.Height, err = strconv.Atoi(value); err != nil || profile.Height < 1 || profile.Height > 4320 {
+				return invalid("height has to be between 1 and 4320")
+			}
+		case "fps":
+			if profile.FPS, err = strconv.Atoi(value); err != nil || profile.FPS < 1 || profile.FPS > 240 {
+				return invalid("fps has to be between 1 and 240")
+			}
+		case "audio":
+			profile.Audio, err = value, oneOf("PROFILES", value, "drop", "copy", "aac")
+		case "device":
+			if value == "" {
+				return invalid("device cannot be empty")
+			}
+			profile.Device = value
+		default:
+			return invalid(fmt.Sprintf("%q is not a setting", key))
+		}
+		if err != nil {
+			return Profile{}, err
+		}
+	}
+	if profile.CRF != 0 && profile.Bitrate != "" {
+		return invalid("crf and bitrate cannot be used together")
+	}
+	return profile, nil
+}
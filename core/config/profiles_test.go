@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProfiles(t *testing.T) {
+	tt := []struct {
+		Profiles []string
+		Expected map[string]Profile
+		Err      error
+	}{
+		{Profiles: []string{}, Expected: map[string]Profile{}},
+		{
+			Profiles: []string{"low:preset=veryfast|crf=28|height=480|fps=15|audio=aac", " archive:preset=slow|bitrate=4M|audio=copy", ""},
+			Expected: map[string]Profile{
+				"low":     {Name: "low", Preset: "veryfast", CRF: 28, Height: 480, FPS: 15, Audio: "aac"},
+				"archive": {Name: "archive", Preset: "slow", Bitrate: "4M", Audio: "copy"},
+			},
+		},
+		{Profiles: []string{"gpu:preset=fast|device=/dev/dri/renderD129"}, Expected: map[string]Profile{"gpu": {Name: "gpu", Preset: "fast", Device: "/dev/dri/renderD129"}}},
+		{Profiles: []string{"gpu:device="}, Err: ErrInvalidConfigFn("PROFILES", "gpu: device cannot be empty")},
+		{Profiles: []string{"low"}, Err: ErrInvalidConfigFn("PROFILES", "entries have to be written as name:key=value|key=value")},
+		{Profiles: []string{"low:crf=28", "low:crf=30"}, Err: ErrInvalidConfigFn("PROFILES", "low is configured more than once")},
+		{Profiles: []string{"low:crf"}, Err: ErrInvalidConfigFn("PROFILES", `low: "crf" has to be written as key=value`)},
+		{Profiles: []string{"low:preset=turbo"}, Err: ErrInvalidConfigFn("PROFILES", `"turbo" has to be one of ultrafast, superfast, veryfast, faster, fast, medium, slow, slower, veryslow`)},
+		{Profiles: []string{"low:bitrate=fast"}, Err: ErrInvalidConfigFn("PROFILES", "low: bitrate has to be like 600k or 2M")},
+		{Profiles: []string{"low:height=0"}, Err: ErrInvalidConfigFn("PROFILES", "low: height has to be between 1 and 4320")},
+		{Profiles: []string{"low:fps=many"}, Err: ErrInvalidConfigFn("PROFILES", "low: fps has to be between 1 and 240")},
+		{Profiles: []string{"low:audio=opus"}, Err: ErrInvalidConfigFn("PROFILES", `"opus" has to be one of drop, copy, aac`)},
+		{Profiles: []string{"low:scale=480"}, Err: ErrInvalidConfigFn("PROFILES", `low: "scale" is not a setting`)},
+		{Profiles: []string{"low:crf=28|bitrate=1M"}, Err: ErrInvalidConfigFn("PROFILES", "low: crf and bitrate cannot be used together")},
+	}
+	for i, testCase := range tt {
+		profiles, err := Process{Profiles: testCase.Profiles}.ParseProfiles()
+		if !assert.Equal(t, testCase.Err, err) || !assert.Equal(t, testCase.Expected, profiles) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestParseProfiles", i))
+		}
+	}
+	assert.True(t, Profile{Height: 480}.Transcodes())
+	assert.False(t, Profile{Audio: "drop"}.Transcodes())
+	assert.False(t, Profile{Device: "1"}.Transcodes())
+}
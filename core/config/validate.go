@@ -0,0 +1,282 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidConfigFn describes an error for a setting of the configuration that cannot be used
+var ErrInvalidConfigFn = func(key, reason string) error {
+	return fmt.Errorf("Invalid configuration of %s: %s", key, reason)
+}
+
+// oneOf checks if the value is one of the accepted ones
+func oneOf(key, value string, accepted ...string) error {
+	for _, a := range accepted {
+		if value == a {
+			return nil
+		}
+	}
+	return ErrInvalidConfigFn(key, fmt.Sprintf("%q has to be one of %s", value, strings.Join(accepted, ", ")))
+}
+
+// between checks if the value is inside the given range
+func between(key string, value, min, max int) error {
+	if value < min || value > max {
+		return ErrInvalidConfigFn(key, fmt.Sprintf("%d has to be between %d and %d", value, min, max))
+	}
+	return nil
+}
+
+// atLeast checks if the value is not below the given minimum
+func atLeast(key string, value, min float64) error {
+	if value < min {
+		return ErrInvalidConfigFn(key, fmt.Sprintf("%v cannot be less than %v", value, min))
+	}
+	return nil
+}
+
+// fraction checks if the value is between 0 and 1
+func fraction(key string, value float64) error {
+	if value < 0 || value > 1 {
+		return ErrInvalidConfigFn(key, fmt.Sprintf("%v has to be between 0 and 1", value))
+	}
+	return nil
+}
+
+// longer checks if the duration is longer than the given minimum
+func longer(key string, value, min time.Duration) error {
+	if value <= min {
+		return ErrInvalidConfigFn(key, fmt.Sprintf("%s has to be longer than %s", value, min))
+	}
+	return nil
+}
+
+// networks checks if every entry is an IP address or a CIDR range
+func networks(key string, entries []string) error {
+	for _, entry := range entries {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return ErrInvalidConfigFn(key, fmt.Sprintf("%q is not an IP address or a CIDR range", entry))
+		}
+	}
+	return nil
+}
+
+// hostPattern matches the host names and the wildcard domains of the sources
+var hostPattern = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// hosts checks if every entry is an IP address, a CIDR range, a host name or a wildcard domain like *.example.com
+func hosts(key string, entries []string) error {
+	for _, entry := range entries {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil && !hostPattern.MatchString(entry) {
+			return ErrInvalidConfigFn(key, fmt.Sprintf("%q is not a host, a domain or a CIDR range", entry))
+		}
+	}
+	return nil
+}
+
+// cpuList matches the lists of CPUs the processes can be pinned to, like 0-3,6
+var cpuList = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+
+// pathPrefix matches the paths the service can be mounted under, like /video or /media/streams
+var pathPrefix = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// Validate checks if the settings can be used together, the returned error names the offending key
+// the same way as its environment variable and its key in the configuration file
+func (s Specification) Validate() error {
+	// The TCP listener can only be turned off if the service listens on a socket
+	minPort := 1
+	if s.ListenSocket != "" {
+		minPort = 0
+	}
+	checks := []error{
+		between("PORT", s.Port, minPort, 65535),
+		atLeast("EVENTS_BUFFER", float64(s.EventsBuffer), 1),
+		atLeast("EVENT_LOG_SIZE", float64(s.EventLogSize), 0),
+		atLeast("SOURCE_UDP_FIFO_SIZE", float64(s.UDPFifoSize), 0),
+		atLeast("DVR_MAX_WINDOW", s.DVRMaxWindow.Seconds(), 0),
+		atLeast("DVR_BITRATE", float64(s.DVRBitrate), 1),
+		oneOf("AUTH_JWT_METHOD", strings.ToLower(s.JWTMethod), "secret", "rsa"),
+		longer("CLEANUP_TIME", s.CleanupTime, 0),
+		atLeast("CLEANUP_REMOVE_GRACE", s.CleanupRemoveGrace.Seconds(), 0),
+		atLeast("CLEANUP_PARALLELISM", float64(s.CleanupParallelism), 1),
+		atLeast("START_MAX_BODY_SIZE", float64(s.StartMaxBodySize), 1),
+		atLeast("CLEANUP_STREAM_TIMEOUT", s.CleanupStreamTimeout.Seconds(), 0),
+		between("HLS_TIME", s.HLSTime, 1, 60),
+		between("HLS_LIST_SIZE", s.HLSListSize, 1, 100),
+		between("RESOLUTION_MAX_WIDTH", s.ResolutionMaxWidth, 1, 7680),
+		between("RESOLUTION_MAX_HEIGHT", s.ResolutionMaxHeight, 1, 4320),
+		between("MAX_FPS", s.MaxFPS, 0, 240),
+		oneOf("SEGMENT_TYPE", s.SegmentType, "ts", "fmp4"),
+		oneOf("MODE", s.Mode, "auto", "copy", "transcode"),
+		oneOf("FORMAT", s.Format, "hls", "dash", "both"),
+		oneOf("RTSP_TRANSPORT", s.Transport, "tcp", "udp", "udp_multicast", "http", "auto"),
+		oneOf("LIFECYCLE", s.Lifecycle, "activity", "viewers"),
+		oneOf("ACTIVITY", s.Activity, "http", "output", "both"),
+		oneOf("AUDIO", s.Audio, "", "drop", "copy", "aac"),
+		atLeast("CRASH_BACKOFF_MULTIPLIER", s.CrashBackoffMultiplier, 1),
+		atLeast("CRASH_MAX_ATTEMPTS", float64(s.CrashMaxAttempts), 0),
+		atLeast("CRASH_MAX_DELAY", s.CrashMaxDelay.Seconds(), 0),
+		fraction("CRASH_JITTER", s.CrashJitter),
+		atLeast("CRASH_GIVE_UP_AFTER", s.CrashGiveUpAfter.Seconds(), 0),
+		atLeast("CRASH_MAX_RECONNECTS", float64(s.CrashMaxReconnects), 0),
+		atLeast("CRASH_HOST_COOLDOWN", s.CrashHostCooldown.Seconds(), 0),
+		longer("PROBE_TIMEOUT", s.ProbeTimeout, 0),
+		longer("START_TIMEOUT", s.StartTimeout, 0),
+		atLeast("FIRST_SEGMENT_TIMEOUT", s.FirstSegmentTimeout.Seconds(), 0),
+		atLeast("STALL_TIMEOUT", s.StallTimeout.Seconds(), 0),
+		atLeast("STALL_MAX_RESTARTS", float64(s.StallMaxRestarts), 0),
+		longer("STALL_WINDOW", s.StallWindow, 0),
+		atLeast("STREAK_HIT_LIMIT", float64(s.StreakHitLimit), 1),
+		longer("STREAK_HOT_WAIT", s.StreakHotWait, 0),
+		atLeast("MAX_STREAMS", float64(s.MaxStreams), 0),
+		atLeast("QUEUE_SIZE", float64(s.QueueSize), 0),
+		longer("QUEUE_MAX_WAIT", s.QueueMaxWait, 0),
+		atLeast("BATCH_PARALLELISM", float64(s.BatchParallelism), 1),
+		longer("VIEWER_WINDOW", s.ViewerWindow, 0),
+		atLeast("VIEWER_MAX_SESSIONS", float64(s.ViewerMaxSessions), 1),
+		atLeast("PROCESS_LOGGING_BUFFER_LINES", float64(s.BufferLines), 0),
+		oneOf("REQUEST_LOG_FORMAT", s.RequestLogFormat, "text", "json"),
+		atLeast("REQUEST_LOG_SEGMENT_EVERY", float64(s.RequestLogSegmentEvery), 1),
+		oneOf("TRANSCODER", s.Transcoder, "ffmpeg", "fake"),
+		oneOf("ORPHAN_POLICY", s.OrphanPolicy, "terminate", "adopt"),
+		oneOf("HARDWARE_ACCEL", s.Accel, "none", "vaapi", "nvenc", "qsv"),
+		oneOf("HARDWARE_DEVICE_ASSIGNMENT", s.DeviceAssignment, "first", "least-loaded"),
+		atLeast("HARDWARE_DEVICE_MAX_SESSIONS", float64(s.DeviceMaxSessions), 0),
+		oneOf("HARDWARE_DEVICE_FALLBACK", s.DeviceFallback, "next", "software"),
+		between("PROCESS_NICE", s.ProcessNice, -20, 19),
+		atLeast("PROCESS_CPU_QUOTA", s.ProcessCPUQuota, 0),
+		atLeast("PROCESS_CPU_BUDGET", s.ProcessCPUBudget, 0),
+		atLeast("PROCESS_SAMPLE_INTERVAL", s.ProcessSampleInterval.Seconds(), 0),
+		atLeast("PROCESS_KILL_GRACE", s.ProcessKillGrace.Seconds(), 0),
+		oneOf("STORAGE_BACKEND", s.Backend, "disk", "s3"),
+		atLeast("RETENTION_STREAM_SIZE", float64(s.RetentionStreamSize), 0),
+		atLeast("RETENTION_TOTAL_SIZE", float64(s.RetentionTotalSize), 0),
+		atLeast("RETENTION_MAX_AGE", s.RetentionMaxAge.Seconds(), 0),
+		atLeast("RETENTION_STORE_LIMIT", float64(s.RetentionStoreLimit), 0),
+		atLeast("RETENTION_ORPHAN_AGE", s.RetentionOrphanAge.Seconds(), 0),
+		atLeast("WEBHOOK_ATTEMPTS", float64(s.WebhookAttempts), 1),
+		oneOf("TLS_MIN_VERSION", s.TLSMinVersion, "1.2", "1.3"),
+		atLeast("TLS_WATCH_INTERVAL", s.TLSWatchInterval.Seconds(), 0),
+		atLeast("HTTP2_MAX_STREAMS", float64(s.HTTP2MaxStreams), 1),
+		longer("HTTP2_IDLE_TIMEOUT", s.HTTP2IdleTimeout, 0),
+		networks("ACCESS_MANAGEMENT_ALLOW", s.ManagementAllow),
+		networks("ACCESS_MANAGEMENT_DENY", s.ManagementDeny),
+		networks("ACCESS_STREAMS_ALLOW", s.StreamsAllow),
+		networks("ACCESS_STREAMS_DENY", s.StreamsDeny),
+		networks("ACCESS_TRUSTED_PROXIES", s.TrustedProxies),
+		networks("VIEWER_IGNORE_IPS", s.IgnoredIPs),
+		hosts("SOURCE_ALLOW", s.SourceAllow),
+		hosts("SOURCE_DENY", s.SourceDeny),
+		longer("DISCOVERY_WAIT", s.DiscoveryWait, 0),
+		longer("DISCOVERY_TIMEOUT", s.DiscoveryTimeout, 0),
+		atLeast("WHEP_MAX_VIEWERS", float64(s.WHEPMaxViewers), 1),
+	}
+	if s.URLSigningEnabled && s.URLSigningKey == "" {
+		checks = append(checks, ErrInvalidConfigFn("AUTH_URL_SIGNING_KEY", "has to be set if URL signing is enabled"))
+	}
+	if s.TLS.Enabled() != (s.TLSKeyFile != "") {
+		checks = append(checks, ErrInvalidConfigFn("TLS_KEY_FILE", "has to be set together with TLS_CERT_FILE"))
+	}
+	if s.TLSClientCAFile != "" && !s.TLS.Enabled() {
+		checks = append(checks, ErrInvalidConfigFn("TLS_CLIENT_CA_FILE", "can only be set together with TLS_CERT_FILE"))
+	}
+	if mode, err := strconv.ParseUint(s.ListenSocketMode, 8, 32); err != nil || mode > 0777 {
+		checks = append(checks, ErrInvalidConfigFn("LISTEN_SOCKET_MODE", fmt.Sprintf("%q has to be an octal file mode like 0660", s.ListenSocketMode)))
+	}
+	if u, err := url.Parse(s.PublicURL); s.PublicURL != "" && (err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https")) {
+		checks = append(checks, ErrInvalidConfigFn("PUBLIC_URL", fmt.Sprintf("%q is not an http or https URL", s.PublicURL)))
+	}
+	if s.PathPrefix != "" && !pathPrefix.MatchString(s.PathPrefix) {
+		checks = append(checks, ErrInvalidConfigFn("PATH_PREFIX", fmt.Sprintf("%q has to start with a slash and cannot end with one, like /video", s.PathPrefix)))
+	}
+	if s.AdminAddress != "" {
+		if _, _, err := net.SplitHostPort(s.AdminAddress); err != nil {
+			checks = append(checks, ErrInvalidConfigFn("ADMIN_ADDRESS", fmt.Sprintf("%q has to be written as host:port", s.AdminAddress)))
+		}
+	}
+	for _, group := range s.PublicGroups {
+		checks = append(checks, oneOf("PUBLIC_GROUPS", group, "media", "management", "metrics", "debug"))
+	}
+	if s.H2CEnabled && s.TLS.Enabled() {
+		checks = append(checks, ErrInvalidConfigFn("H2C_ENABLED", "cannot be used together with TLS_CERT_FILE, HTTP/2 is negotiated over TLS"))
+	}
+	if s.BasicEnabled && (s.BasicUsername == "" || s.BasicPassword == "") {
+		checks = append(checks, ErrInvalidConfigFn("AUTH_BASIC_PASSWORD", "has to be set together with AUTH_BASIC_USERNAME if basic authentication is enabled"))
+	}
+	if s.BasicEnabled && s.JWTEnabled {
+		checks = append(checks, ErrInvalidConfigFn("AUTH_BASIC_ENABLED", "cannot be used together with AUTH_JWT_ENABLED, both use the Authorization header"))
+	}
+	if s.ProcessCPUAffinity != "" && !cpuList.MatchString(s.ProcessCPUAffinity) {
+		checks = append(checks, ErrInvalidConfigFn("PROCESS_CPU_AFFINITY", fmt.Sprintf("%q has to be a list of CPUs like 0-3,6", s.ProcessCPUAffinity)))
+	}
+	if s.ProcessCPUBudget > 0 && s.ProcessCPUQuota == 0 {
+		checks = append(checks, ErrInvalidConfigFn("PROCESS_CPU_BUDGET", "has to be set together with PROCESS_CPU_QUOTA"))
+	}
+	if s.LocalEnabled && len(s.LocalPaths) == 0 {
+		checks = append(checks, ErrInvalidConfigFn("SOURCE_LOCAL_PATHS", "has to be set if local sources are enabled"))
+	}
+	for _, local := range s.LocalPaths {
+		if !filepath.IsAbs(local) {
+			checks = append(checks, ErrInvalidConfigFn("SOURCE_LOCAL_PATHS", fmt.Sprintf("%q is not an absolute path", local)))
+		}
+	}
+	if s.UDPLocalAddress != "" && net.ParseIP(s.UDPLocalAddress) == nil {
+		checks = append(checks, ErrInvalidConfigFn("SOURCE_UDP_LOCAL_ADDRESS", fmt.Sprintf("%q is not an IP address", s.UDPLocalAddress)))
+	}
+	if s.DiscoveryTimeout < s.DiscoveryWait {
+		checks = append(checks, ErrInvalidConfigFn("DISCOVERY_TIMEOUT", "cannot be shorter than DISCOVERY_WAIT"))
+	}
+	if len(s.SourceSchemes) == 0 {
+		checks = append(checks, ErrInvalidConfigFn("SOURCE_SCHEMES", "at least one scheme has to be allowed"))
+	}
+	if _, err := s.EncryptionKey(); err != nil {
+		checks = append(checks, err)
+	}
+	if _, err := s.ParseFallbackCredentials(); err != nil {
+		checks = append(checks, err)
+	}
+	if _, err := s.ParseAPIKeys(); err != nil {
+		checks = append(checks, err)
+	}
+	if _, err := s.ParseRequestLogLevels(); err != nil {
+		checks = append(checks, err)
+	}
+	if err := s.validateLayout(); err != nil {
+		checks = append(checks, err)
+	}
+	profiles, err := s.ParseProfiles()
+	if err != nil {
+		checks = append(checks, err)
+	}
+	for _, profile := range profiles {
+		if profile.Device != "" && !s.HasDevice(profile.Device) {
+			checks = append(checks, ErrInvalidConfigFn("PROFILES", fmt.Sprintf("%s: device %q is not one of the HARDWARE_DEVICES", profile.Name, profile.Device)))
+		}
+	}
+	if s.DebugEndpoint && s.DebugAddress != "" {
+		if _, _, err := net.SplitHostPort(s.DebugAddress); err != nil {
+			checks = append(checks, ErrInvalidConfigFn("DEBUG_ADDRESS", fmt.Sprintf("%q has to be written as host:port", s.DebugAddress)))
+		}
+	}
+	if s.Backend == "s3" && s.S3Bucket == "" {
+		checks = append(checks, ErrInvalidConfigFn("STORAGE_S3_BUCKET", "has to be set for the s3 backend"))
+	}
+	for _, webhook := range s.WebhookURLs {
+		if u, err := url.Parse(webhook); webhook != "" && (err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https")) {
+			checks = append(checks, ErrInvalidConfigFn("WEBHOOK_URLS", fmt.Sprintf("%q is not an http or https URL", webhook)))
+		}
+	}
+	for _, err := range checks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
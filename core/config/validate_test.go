@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		Change func(s *Specification)
+		Err    error
+	}{
+		{Change: func(s *Specification) {}},
+		{Change: func(s *Specification) { s.JWTMethod = "RSA" }},
+		{Change: func(s *Specification) { s.Port = 0 }, Err: ErrInvalidConfigFn("PORT", "0 has to be between 1 and 65535")},
+		{Change: func(s *Specification) { s.HLSTime = 61 }, Err: ErrInvalidConfigFn("HLS_TIME", "61 has to be between 1 and 60")},
+		{Change: func(s *Specification) { s.ResolutionMaxHeight = 0 }, Err: ErrInvalidConfigFn("RESOLUTION_MAX_HEIGHT", "0 has to be between 1 and 4320")},
+		{Change: func(s *Specification) { s.DeviceAssignment = "random" }, Err: ErrInvalidConfigFn("HARDWARE_DEVICE_ASSIGNMENT", `"random" has to be one of first, least-loaded`)},
+		{Change: func(s *Specification) { s.DeviceFallback = "none" }, Err: ErrInvalidConfigFn("HARDWARE_DEVICE_FALLBACK", `"none" has to be one of next, software`)},
+		{Change: func(s *Specification) { s.DeviceMaxSessions = -1 }, Err: ErrInvalidConfigFn("HARDWARE_DEVICE_MAX_SESSIONS", "-1 cannot be less than 0")},
+		{
+			Change: func(s *Specification) { s.Devices, s.Profiles = []string{"0", "1"}, []string{"gpu:device=2"} },
+			Err:    ErrInvalidConfigFn("PROFILES", `gpu: device "2" is not one of the HARDWARE_DEVICES`),
+		},
+		{Change: func(s *Specification) { s.Devices, s.Profiles = []string{"0", "1"}, []string{"gpu:device=1"} }},
+		{Change: func(s *Specification) { s.ProcessNice = 20 }, Err: ErrInvalidConfigFn("PROCESS_NICE", "20 has to be between -20 and 19")},
+		{Change: func(s *Specification) { s.ProcessCPUAffinity = "0-3;6" }, Err: ErrInvalidConfigFn("PROCESS_CPU_AFFINITY", `"0-3;6" has to be a list of CPUs like 0-3,6`)},
+		{Change: func(s *Specification) { s.ProcessCPUQuota = -1 }, Err: ErrInvalidConfigFn("PROCESS_CPU_QUOTA", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.ProcessCPUBudget = 8 }, Err: ErrInvalidConfigFn("PROCESS_CPU_BUDGET", "has to be set together with PROCESS_CPU_QUOTA")},
+		{Change: func(s *Specification) { s.ProcessCPUAffinity, s.ProcessCPUQuota, s.ProcessCPUBudget = "0-3,6", 1.5, 8 }},
+		{Change: func(s *Specification) { s.ProcessSampleInterval = -time.Second }, Err: ErrInvalidConfigFn("PROCESS_SAMPLE_INTERVAL", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.StallTimeout = -time.Second }, Err: ErrInvalidConfigFn("STALL_TIMEOUT", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.CleanupParallelism = 0 }, Err: ErrInvalidConfigFn("CLEANUP_PARALLELISM", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.StartMaxBodySize = 0 }, Err: ErrInvalidConfigFn("START_MAX_BODY_SIZE", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.CleanupStreamTimeout = -time.Second }, Err: ErrInvalidConfigFn("CLEANUP_STREAM_TIMEOUT", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.StallWindow = 0 }, Err: ErrInvalidConfigFn("STALL_WINDOW", "0s has to be longer than 0s")},
+		{Change: func(s *Specification) { s.MaxFPS = 241 }, Err: ErrInvalidConfigFn("MAX_FPS", "241 has to be between 0 and 240")},
+		{Change: func(s *Specification) { s.Transport = "sctp" }, Err: ErrInvalidConfigFn("RTSP_TRANSPORT", `"sctp" has to be one of tcp, udp, udp_multicast, http, auto`)},
+		{Change: func(s *Specification) { s.CleanupTime = 0 }, Err: ErrInvalidConfigFn("CLEANUP_TIME", "0s has to be longer than 0s")},
+		{Change: func(s *Specification) { s.CrashBackoffMultiplier = 0.5 }, Err: ErrInvalidConfigFn("CRASH_BACKOFF_MULTIPLIER", "0.5 cannot be less than 1")},
+		{Change: func(s *Specification) { s.CrashJitter = 1.5 }, Err: ErrInvalidConfigFn("CRASH_JITTER", "1.5 has to be between 0 and 1")},
+		{Change: func(s *Specification) { s.CrashGiveUpAfter = -time.Second }, Err: ErrInvalidConfigFn("CRASH_GIVE_UP_AFTER", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.CrashMaxReconnects = -1 }, Err: ErrInvalidConfigFn("CRASH_MAX_RECONNECTS", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.RetentionMaxAge = -time.Second }, Err: ErrInvalidConfigFn("RETENTION_MAX_AGE", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.RetentionOrphanAge = -time.Second }, Err: ErrInvalidConfigFn("RETENTION_ORPHAN_AGE", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.URLSigningEnabled = true }, Err: ErrInvalidConfigFn("AUTH_URL_SIGNING_KEY", "has to be set if URL signing is enabled")},
+		{Change: func(s *Specification) { s.PersistenceKey = "c2hvcnQ=" }, Err: ErrInvalidConfigFn("PERSISTENCE_KEY", "has to be a 32 byte key encoded in base64")},
+		{Change: func(s *Specification) { s.PersistenceKey = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=" }, Err: nil},
+		{Change: func(s *Specification) { s.PersistenceKeyFile = "./missing.key" }, Err: ErrInvalidConfigFn("PERSISTENCE_KEY_FILE", "the file cannot be read")},
+		{Change: func(s *Specification) { s.PersistenceKey, s.PersistenceKeyFile = "key", "./key" }, Err: ErrInvalidConfigFn("PERSISTENCE_KEY_FILE", "cannot be set together with PERSISTENCE_KEY")},
+		{Change: func(s *Specification) { s.BasicEnabled, s.BasicUsername, s.BasicPassword = true, "admin", "secret" }},
+		{Change: func(s *Specification) { s.BasicEnabled, s.BasicUsername = true, "admin" }, Err: ErrInvalidConfigFn("AUTH_BASIC_PASSWORD", "has to be set together with AUTH_BASIC_USERNAME if basic authentication is enabled")},
+		{Change: func(s *Specification) {
+			s.BasicEnabled, s.BasicUsername, s.BasicPassword, s.JWTEnabled = true, "admin", "secret", true
+		}, Err: ErrInvalidConfigFn("AUTH_BASIC_ENABLED", "cannot be used together with AUTH_JWT_ENABLED, both use the Authorization header")},
+		{Change: func(s *Specification) { s.APIKeys = []string{"ingest:k3y:start|stop", "dashboard:d4sh:*"} }},
+		{Change: func(s *Specification) { s.APIKeys = []string{"ingest:k3y"} }, Err: ErrInvalidConfigFn("AUTH_API_KEYS", "entries have to be written as name:key:permissions")},
+		{Change: func(s *Specification) { s.APIKeys = []string{"ingest:k3y:start", "ingest:0ther:list"} }, Err: ErrInvalidConfigFn("AUTH_API_KEYS", "ingest is configured more than once")},
+		{Change: func(s *Specification) { s.APIKeys = []string{"ingest:k3y:start|delete"} }, Err: ErrInvalidConfigFn("AUTH_API_KEYS", `"delete" has to be one of *, start, stop, list, read, admin`)},
+		{Change: func(s *Specification) {
+			s.ManagementAllow, s.StreamsDeny, s.TrustedProxies = []string{"10.0.0.0/8", "2001:db8::/32"}, []string{"192.0.2.7"}, []string{"::1"}
+		}},
+		{Change: func(s *Specification) { s.StreamsAllow = []string{"10.0.0.0/33"} }, Err: ErrInvalidConfigFn("ACCESS_STREAMS_ALLOW", `"10.0.0.0/33" is not an IP address or a CIDR range`)},
+		{Change: func(s *Specification) {
+			s.SourceAllow, s.SourceDeny = []string{"cameras.local", "*.example.com", "10.2.0.0/16"}, []string{"fd00::1"}
+		}},
+		{Change: func(s *Specification) { s.SourceAllow = []string{"http://cameras.local"} }, Err: ErrInvalidConfigFn("SOURCE_ALLOW", `"http://cameras.local" is not a host, a domain or a CIDR range`)},
+		{Change: func(s *Specification) { s.SourceSchemes = []string{} }, Err: ErrInvalidConfigFn("SOURCE_SCHEMES", "at least one scheme has to be allowed")},
+		{Change: func(s *Specification) { s.FallbackCredentials = []string{"admin:old:pass", "guest:"} }, Err: nil},
+		{Change: func(s *Specification) { s.FallbackCredentials = []string{"admin"} }, Err: ErrInvalidConfigFn("SOURCE_FALLBACK_CREDENTIALS", "entries have to be written as username:password")},
+		{Change: func(s *Specification) { s.FallbackCredentials = []string{":secret"} }, Err: ErrInvalidConfigFn("SOURCE_FALLBACK_CREDENTIALS", "entries have to be written as username:password")},
+		{Change: func(s *Specification) { s.Backend = "s3" }, Err: ErrInvalidConfigFn("STORAGE_S3_BUCKET", "has to be set for the s3 backend")},
+		{Change: func(s *Specification) { s.WebhookURLs = []string{"hooks.local"} }, Err: ErrInvalidConfigFn("WEBHOOK_URLS", `"hooks.local" is not an http or https URL`)},
+		{Change: func(s *Specification) {
+			s.TLSCertFile, s.TLSKeyFile, s.TLSClientCAFile = "tls.crt", "tls.key", "ca.crt"
+		}},
+		{Change: func(s *Specification) { s.TLSCertFile = "tls.crt" }, Err: ErrInvalidConfigFn("TLS_KEY_FILE", "has to be set together with TLS_CERT_FILE")},
+		{Change: func(s *Specification) { s.TLSClientCAFile = "ca.crt" }, Err: ErrInvalidConfigFn("TLS_CLIENT_CA_FILE", "can only be set together with TLS_CERT_FILE")},
+		{Change: func(s *Specification) { s.H2CEnabled = true }},
+		{Change: func(s *Specification) { s.Port, s.ListenSocket = 0, "/run/rtsp-stream.sock" }},
+		{Change: func(s *Specification) { s.ListenSocket = "/run/rtsp-stream.sock" }},
+		{Change: func(s *Specification) { s.ListenSocketMode = "0666" }},
+		{Change: func(s *Specification) { s.ListenSocketMode = "rw" }, Err: ErrInvalidConfigFn("LISTEN_SOCKET_MODE", `"rw" has to be an octal file mode like 0660`)},
+		{Change: func(s *Specification) { s.ListenSocketMode = "1777" }, Err: ErrInvalidConfigFn("LISTEN_SOCKET_MODE", `"1777" has to be an octal file mode like 0660`)},
+		{Change: func(s *Specification) { s.PublicURL = "https://streams.example.com/live" }},
+		{Change: func(s *Specification) { s.AdminAddress, s.PublicGroups = "127.0.0.1:8081", []string{"metrics"} }},
+		{Change: func(s *Specification) { s.AdminAddress = "8081" }, Err: ErrInvalidConfigFn("ADMIN_ADDRESS", `"8081" has to be written as host:port`)},
+		{Change: func(s *Specification) { s.PublicGroups = []string{"media", "files"} }, Err: ErrInvalidConfigFn("PUBLIC_GROUPS", `"files" has to be one of media, management, metrics, debug`)},
+		{Change: func(s *Specification) { s.PublicURL = "streams.example.com" }, Err: ErrInvalidConfigFn("PUBLIC_URL", `"streams.example.com" is not an http or https URL`)},
+		{Change: func(s *Specification) { s.PathPrefix = "/media/streams" }},
+		{Change: func(s *Specification) { s.PathPrefix = "video" }, Err: ErrInvalidConfigFn("PATH_PREFIX", `"video" has to start with a slash and cannot end with one, like /video`)},
+		{Change: func(s *Specification) { s.PathPrefix = "/video/" }, Err: ErrInvalidConfigFn("PATH_PREFIX", `"/video/" has to start with a slash and cannot end with one, like /video`)},
+		{
+			Change: func(s *Specification) { s.H2CEnabled, s.TLSCertFile, s.TLSKeyFile = true, "tls.crt", "tls.key" },
+			Err:    ErrInvalidConfigFn("H2C_ENABLED", "cannot be used together with TLS_CERT_FILE, HTTP/2 is negotiated over TLS"),
+		},
+		{Change: func(s *Specification) { s.HTTP2MaxStreams = 0 }, Err: ErrInvalidConfigFn("HTTP2_MAX_STREAMS", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.StreakHitLimit = 0 }, Err: ErrInvalidConfigFn("STREAK_HIT_LIMIT", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.StreakHotWait = 0 }, Err: ErrInvalidConfigFn("STREAK_HOT_WAIT", "0s has to be longer than 0s")},
+		{Change: func(s *Specification) { s.QueueSize = -1 }, Err: ErrInvalidConfigFn("QUEUE_SIZE", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.QueueMaxWait = 0 }, Err: ErrInvalidConfigFn("QUEUE_MAX_WAIT", "0s has to be longer than 0s")},
+		{Change: func(s *Specification) { s.DebugEndpoint, s.DebugAddress = true, "" }},
+		{Change: func(s *Specification) { s.DebugEndpoint, s.DebugAddress = true, "6060" }, Err: ErrInvalidConfigFn("DEBUG_ADDRESS", `"6060" has to be written as host:port`)},
+		{Change: func(s *Specification) {
+			s.RequestLogLevels = []string{"*.ts:debug", "/health:OFF", "/stream/*/index.m3u8:info"}
+		}},
+		{Change: func(s *Specification) { s.RequestLogLevels = []string{"*.ts"} }, Err: ErrInvalidConfigFn("REQUEST_LOG_LEVELS", "entries have to be written as pattern:level")},
+		{Change: func(s *Specification) { s.RequestLogLevels = []string{"[.ts:debug"} }, Err: ErrInvalidConfigFn("REQUEST_LOG_LEVELS", `"[.ts" is not a valid pattern`)},
+		{Change: func(s *Specification) { s.RequestLogLevels = []string{"*.ts:trace"} }, Err: ErrInvalidConfigFn("REQUEST_LOG_LEVELS", `"trace" has to be one of debug, info, warn, error, off`)},
+		{Change: func(s *Specification) { s.RequestLogSegmentEvery = 0 }, Err: ErrInvalidConfigFn("REQUEST_LOG_SEGMENT_EVERY", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.ViewerWindow = 0 }, Err: ErrInvalidConfigFn("VIEWER_WINDOW", "0s has to be longer than 0s")},
+		{Change: func(s *Specification) { s.ViewerMaxSessions = 0 }, Err: ErrInvalidConfigFn("VIEWER_MAX_SESSIONS", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.DiscoveryWait = 0 }, Err: ErrInvalidConfigFn("DISCOVERY_WAIT", "0s has to be longer than 0s")},
+		{Change: func(s *Specification) { s.DiscoveryTimeout = time.Second }, Err: ErrInvalidConfigFn("DISCOVERY_TIMEOUT", "cannot be shorter than DISCOVERY_WAIT")},
+		{Change: func(s *Specification) { s.WHEPMaxViewers = 0 }, Err: ErrInvalidConfigFn("WHEP_MAX_VIEWERS", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.LocalEnabled = true }, Err: ErrInvalidConfigFn("SOURCE_LOCAL_PATHS", "has to be set if local sources are enabled")},
+		{Change: func(s *Specification) { s.LocalPaths = []string{"videos"} }, Err: ErrInvalidConfigFn("SOURCE_LOCAL_PATHS", `"videos" is not an absolute path`)},
+		{Change: func(s *Specification) { s.DVRBitrate = 0 }, Err: ErrInvalidConfigFn("DVR_BITRATE", "0 cannot be less than 1")},
+		{Change: func(s *Specification) { s.UDPFifoSize = -1 }, Err: ErrInvalidConfigFn("SOURCE_UDP_FIFO_SIZE", "-1 cannot be less than 0")},
+		{Change: func(s *Specification) { s.UDPLocalAddress = "eth0" }, Err: ErrInvalidConfigFn("SOURCE_UDP_LOCAL_ADDRESS", `"eth0" is not an IP address`)},
+		{Change: func(s *Specification) { s.Lifecycle = "forever" }, Err: ErrInvalidConfigFn("LIFECYCLE", `"forever" has to be one of activity, viewers`)},
+		{Change: func(s *Specification) { s.Activity = "disk" }, Err: ErrInvalidConfigFn("ACTIVITY", `"disk" has to be one of http, output, both`)},
+		{Change: func(s *Specification) { s.IgnoredIPs = []string{"probe"} }, Err: ErrInvalidConfigFn("VIEWER_IGNORE_IPS", `"probe" is not an IP address or a CIDR range`)},
+		{Change: func(s *Specification) { s.TLSMinVersion = "1.0" }, Err: ErrInvalidConfigFn("TLS_MIN_VERSION", `"1.0" has to be one of 1.2, 1.3`)},
+		{Change: func(s *Specification) { s.Profiles = []string{"low:crf=28"}; s.DefaultProfile = "low" }},
+		{Change: func(s *Specification) { s.Profiles = []string{"low:crf=60"} }, Err: ErrInvalidConfigFn("PROFILES", "low: crf has to be between 1 and 51")},
+		{Change: func(s *Specification) { s.DefaultProfile = "low" }, Err: ErrInvalidConfigFn("DEFAULT_PROFILE", "low is not one of the PROFILES")},
+	}
+	for i, testCase := range tt {
+		s := *InitConfig()
+		testCase.Change(&s)
+		if !assert.Equal(t, testCase.Err, s.Validate()) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestValidate", i))
+		}
+	}
+}
+
+func TestHardwareDevices(t *testing.T) {
+	tt := []struct {
+		Hardware Hardware
+		Expected []string
+	}{
+		{Hardware: Hardware{}, Expected: []string{""}},
+		{Hardware: Hardware{Device: "/dev/dri/renderD128"}, Expected: []string{"/dev/dri/renderD128"}},
+		{Hardware: Hardware{Device: "0", Devices: []string{" 0", "1", ""}}, Expected: []string{"0", "1"}},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Expected, testCase.Hardware.HardwareDevices()) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestHardwareDevices", i))
+		}
+	}
+	assert.True(t, Hardware{Devices: []string{"0", "1"}}.HasDevice("1"))
+	assert.False(t, Hardware{Devices: []string{"0", "1"}}.HasDevice("/dev/dri/renderD129"))
+}
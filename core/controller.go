@@ -1,22 +1,33 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
-	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Roverr/rtsp-stream/core/access"
 	"github.com/Roverr/rtsp-stream/core/auth"
 	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/metrics"
+	"github.com/Roverr/rtsp-stream/core/onvif"
+	"github.com/Roverr/rtsp-stream/core/storage"
+	"github.com/Roverr/rtsp-stream/core/store"
 	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/Roverr/rtsp-stream/core/whep"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 )
@@ -30,79 +41,498 @@ var ErrDirectoryNotCreated = errors.New("Could not create directory for URI")
 // ErrTimeout describes an error related to timing out
 var ErrTimeout = errors.New("Timeout error")
 
-// ErrDTO describes a DTO that has a message as an error
+// ErrStartCanceled describes an error for starts aborted because the client went away
+var ErrStartCanceled = errors.New("Start of the stream is canceled")
+
+// statusClientClosedRequest is the status of the requests the client stopped waiting for, only seen by the logs and the metrics
+const statusClientClosedRequest = 499
+
+// ErrNoStreamFn is used to create dynamic errors for unknown stream ids
+var ErrNoStreamFn = func(id string) error {
+	return fmt.Errorf("%s has no stream available", id)
+}
+
+// ErrCapacityFn is used to create dynamic errors for new streams exceeding the maximum number of running streams
+var ErrCapacityFn = func(max int) error {
+	return fmt.Errorf("Maximum number of running streams (%d) is reached, no new stream can be started", max)
+}
+
+// ErrQueueExpiredFn is used to create dynamic errors for the queued starts that did not get a free slot within the maximum wait
+var ErrQueueExpiredFn = func(wait time.Duration) error {
+	return fmt.Errorf("No running stream was stopped within %s, the queued start is dropped", wait)
+}
+
+// ErrCPUBudgetFn is used to create dynamic errors for new streams whose CPU quota does not fit into the CPU budget
+var ErrCPUBudgetFn = func(budget float64) error {
+	return fmt.Errorf("CPU budget (%v CPUs) is used by the running streams, no new stream can be started", budget)
+}
+
+// ErrMethodNotAllowedFn is used to create dynamic errors for requests with a method the route does not accept
+var ErrMethodNotAllowedFn = func(method, allowed string) error {
+	return fmt.Errorf("%s is not allowed, the route accepts %s", method, allowed)
+}
+
+// ErrBodyTooLargeFn is used to create dynamic errors for the bodies larger than the limit
+var ErrBodyTooLargeFn = func(limit int64) error {
+	return fmt.Errorf("Request body cannot be larger than %d bytes", limit)
+}
+
+// ErrUnknownFieldFn is used to create dynamic errors for the fields of the body that are not known, like a typo in their name
+var ErrUnknownFieldFn = func(field string) error {
+	return fmt.Errorf("Request body has an unknown field %s", field)
+}
+
+// ErrNoFirstSegmentFn is used to create dynamic errors for new streams whose process did not write a segment in time,
+// the tail is the end of the output of the process
+var ErrNoFirstSegmentFn = func(timeout time.Duration, tail string) error {
+	if tail == "" {
+		return fmt.Errorf("No segment was written within %s", timeout)
+	}
+	return fmt.Errorf("No segment was written within %s: %s", timeout, tail)
+}
+
+// ErrStalledFn is used to create dynamic errors for streams whose process stopped writing segments too many times
+var ErrStalledFn = func(stalls int, window time.Duration) error {
+	return fmt.Errorf("Process stopped writing segments %d times within %s", stalls, window)
+}
+
+// ErrDTO describes a DTO that has a message as an error, sent if legacy errors are enabled
 type ErrDTO struct {
 	Error string `json:"error"`
 }
 
+// HLSDto describes the HLS settings that can be overridden when starting a stream
+type HLSDto struct {
+	Time           *int   `json:"time,omitempty"`
+	ListSize       *int   `json:"listSize,omitempty"`
+	DeleteSegments *bool  `json:"deleteSegments,omitempty"`
+	SegmentType    string `json:"segmentType,omitempty"`
+	// ProgramDateTime indicates if the playlists carry the wall clock time of the segments
+	ProgramDateTime *bool `json:"programDateTime,omitempty"`
+}
+
+// StreakDto describes the settings of the streak of a stream overriding the ones of the configuration
+type StreakDto struct {
+	HitLimit *int        `json:"hitLimit,omitempty"`
+	HotWait  *SecondsDto `json:"hotWait,omitempty"`
+}
+
 // StreamDto describes an uri where the client can access the stream
 type StreamDto struct {
-	URI string `json:"uri"`
+	URI          string                `json:"uri"`
+	ID           string                `json:"id,omitempty"`
+	Alias        string                `json:"alias,omitempty"`
+	Metadata     map[string]string     `json:"metadata,omitempty"`
+	Group        string                `json:"group,omitempty"`
+	HLS          *HLSDto               `json:"hls,omitempty"`
+	Renditions   []streaming.Rendition `json:"renditions,omitempty"`
+	Mode         string                `json:"mode,omitempty"`
+	Audio        string                `json:"audio,omitempty"`
+	AudioBitrate string                `json:"audioBitrate,omitempty"`
+	Lazy         *bool                 `json:"lazy,omitempty"`
+	IdleTimeout  *SecondsDto           `json:"idleTimeout,omitempty"`
+	TTL          *TTLDto               `json:"ttl,omitempty"`
+	Record       *bool                 `json:"record,omitempty"`
+	RecordAlways *bool                 `json:"recordAlways,omitempty"`
+	Format       string                `json:"format,omitempty"`
+	LowLatency   *bool                 `json:"lowLatency,omitempty"`
+	Transport    string                `json:"transport,omitempty"`
+	Lifecycle    string                `json:"lifecycle,omitempty"`
+	Activity     string                `json:"activity,omitempty"`
+	Loop         *bool                 `json:"loop,omitempty"`
+	Push         string                `json:"push,omitempty"`
+	AudioOnly    *bool                 `json:"audioOnly,omitempty"`
+	Profile      string                `json:"profile,omitempty"`
+	Resolution   *ResolutionDto        `json:"resolution,omitempty"`
+	MaxFPS       *int                  `json:"maxFps,omitempty"`
+	Device       string                `json:"device,omitempty"`
+	InputArgs    []string              `json:"inputArgs,omitempty"`
+	OutputArgs   []string              `json:"outputArgs,omitempty"`
+	Retry        *RetryDto             `json:"retry,omitempty"`
+	Streak       *StreakDto            `json:"streak,omitempty"`
+	// Username and Password are the credentials of the source given apart from the URI, they are never sent back
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// FallbackCredentials are tried in order once the source refuses the credentials, before the configured ones
+	FallbackCredentials []CredentialsDto `json:"fallbackCredentials,omitempty"`
+	// SRT are the options of the srt:// sources given apart from the URI, they are never sent back
+	SRT *SRTDto `json:"srt,omitempty"`
+	// SDP is the content of the SDP file the source is read from, the URI of the stream is read from it then
+	SDP string `json:"sdp,omitempty"`
+	// DVRWindow is the time the segments of the stream are kept for, so it can be rewound
+	DVRWindow *DVRWindowDto `json:"dvrWindow,omitempty"`
+	// Priority decides which streams are evicted once MAX_STREAMS are running, a start evicts the running stream with the lowest priority below its own
+	Priority *int `json:"priority,omitempty"`
+	// DryRun only validates the start and probes the source, nothing is started. The response of the dry run has it set
+	DryRun bool `json:"dryRun,omitempty"`
+	// HLSURI and DASHURI are the paths of the outputs of streams written as MPEG-DASH, so clients can pick one of them
+	HLSURI  string `json:"hlsUri,omitempty"`
+	DASHURI string `json:"dashUri,omitempty"`
+	// Source describes the probed tracks of the source
+	Source *streaming.SourceInfo `json:"source,omitempty"`
+	// KeepaliveInterval is the number of seconds between the keepalives the client is expected to send
+	KeepaliveInterval int `json:"keepaliveInterval,omitempty"`
+	// Token is the playback token the files of the stream are requested with, set if the playback tokens are enabled
+	Token string `json:"token,omitempty"`
+	// Queued indicates if the start waits in the queue for a free slot, Position is its place in the queue starting from 1
+	Queued   bool `json:"queued,omitempty"`
+	Position int  `json:"position,omitempty"`
+}
+
+// SecondsDto describes a number of seconds given either as a number, like 600, or as a duration, like "10m".
+// Durations are rounded up to whole seconds
+type SecondsDto int
+
+// UnmarshalJSON reads the seconds from a number or a duration
+func (s *SecondsDto) UnmarshalJSON(b []byte) error {
+	var seconds int
+	if err := json.Unmarshal(b, &seconds); err == nil {
+		*s = SecondsDto(seconds)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		return streaming.ErrInvalidIdleTimeout
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return streaming.ErrInvalidIdleTimeout
+	}
+	*s = SecondsDto(math.Ceil(d.Seconds()))
+	return nil
+}
+
+// ResolutionDto describes an output resolution given either as a size, like "1280x720", or as a height, like 720 or "720"
+type ResolutionDto streaming.Resolution
+
+// UnmarshalJSON reads the resolution from a number or a text
+func (r *ResolutionDto) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		var height int
+		if err := json.Unmarshal(b, &height); err != nil {
+			return streaming.ErrInvalidResolution
+		}
+		text = strconv.Itoa(height)
+	}
+	resolution, err := streaming.ParseResolution(text)
+	if err != nil {
+		return err
+	}
+	*r = ResolutionDto(resolution)
+	return nil
 }
 
 // SummariseDto describes each stream and their state of running
 type SummariseDto struct {
-	Running bool   `json:"running"`
-	URI     string `json:"uri"`
+	Running    bool                  `json:"running"`
+	URI        string                `json:"uri"`
+	ID         string                `json:"id"`
+	HLS        streaming.HLSOptions  `json:"hls"`
+	Renditions []streaming.Rendition `json:"renditions,omitempty"`
+	Mode       string                `json:"mode"`
+	Format     string                `json:"format"`
+	LowLatency bool                  `json:"lowLatency"`
+	Transport  string                `json:"transport"`
+	Lazy       bool                  `json:"lazy"`
+	AudioOnly  bool                  `json:"audioOnly"`
+	// Profile is the name of the encoder settings the stream was started with, unset if it uses none
+	Profile string `json:"profile,omitempty"`
+	// MaxFPS is the frame rate the transcoded video is capped at, 0 if it keeps the rate of the source
+	MaxFPS int `json:"maxFps"`
+	// StallRestarts is the number of restarts after the process stopped writing segments, they are not counted as restarts
+	StallRestarts int `json:"stallRestarts"`
+	// IdleTimeout is the number of seconds the stream keeps running without any activity, 0 if it is never cleaned up
+	IdleTimeout int                   `json:"idleTimeout"`
+	Restarts    int                   `json:"restarts"`
+	Errored     bool                  `json:"errored"`
+	Source      *streaming.SourceInfo `json:"source,omitempty"`
+	Recording   RecordingDto          `json:"recording"`
+	Metadata    map[string]string     `json:"metadata,omitempty"`
+	Group       string                `json:"group,omitempty"`
+	// SourceURI is the URI of the source with its credentials masked
+	SourceURI string `json:"sourceUri"`
+	// StartedAt is the start of the last transcoding process, LastSegmentAt is the last time it started writing a segment
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	LastSegmentAt *time.Time `json:"lastSegmentAt,omitempty"`
+	// LastError is the error of the last failed process, empty if the stream wrote a segment since
+	LastError string `json:"lastError,omitempty"`
+	// ErrorCode is the code of the error the stream is errored with, like source_auth_failed, unset if it has none
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Viewers is the number of clients that requested a playlist of the stream within VIEWER_WINDOW,
+	// PeakViewers is the most of them seen at the same time
+	Viewers     int `json:"viewers"`
+	PeakViewers int `json:"peakViewers"`
+	// Lifecycle is the policy stopping the stream, StopsIn is the number of seconds left until it is stopped
+	// if nothing keeps it running, unset if it is never stopped automatically
+	Lifecycle string `json:"lifecycle"`
+	StopsIn   *int   `json:"stopsIn,omitempty"`
+	// Activity is what counts as the activity of the stream: http for the requests of its clients, output for the segments
+	// written by its transcoding, or both
+	Activity string `json:"activity"`
+	// Push is the state of the forwarding of the stream to its push target, unset if it is not pushed
+	Push *streaming.PushStatus `json:"push,omitempty"`
+	// Queued indicates if the start of the stream waits in the queue for a free slot, Position is its place in the queue starting from 1.
+	// The queued streams are only described by their id, their source, their metadata and their group
+	Queued   bool `json:"queued,omitempty"`
+	Position int  `json:"position,omitempty"`
+	// ExpiresIn is the number of seconds left until the stream is removed, unset if it has no time to live
+	ExpiresIn *int `json:"expiresIn,omitempty"`
+	// Paused indicates if the transcoding was paused, the stream is only started again by resuming it
+	Paused bool `json:"paused"`
+	// Evicted indicates if the stream was paused to make room for a stream with a higher priority, it is resumed once a slot is free
+	Evicted bool `json:"evicted,omitempty"`
+	// Disabled indicates if the stream was switched off until it is enabled again, it is paused meanwhile
+	Disabled bool `json:"disabled,omitempty"`
+	// Priority decides which streams are evicted once MAX_STREAMS are running
+	Priority int `json:"priority"`
+	// Resources is the resource usage of the running transcoding, only listed in the verbose mode
+	Resources *streaming.Resources `json:"resources,omitempty"`
+	// lastActivity is only used for sorting the list
+	lastActivity time.Time
+}
+
+// RecordingDto describes the MP4 recording of a stream
+type RecordingDto struct {
+	Enabled   bool   `json:"enabled"`
+	Always    bool   `json:"always"`
+	Running   bool   `json:"running"`
+	Directory string `json:"directory,omitempty"`
+}
+
+// StatusDto describes the transcoding details of a given stream
+type StatusDto struct {
+	Path string `json:"path"`
+	// URI is the absolute URI the stream can be played from, only set if the request asked for it with the absolute parameter
+	URI         string            `json:"uri,omitempty"`
+	Running     bool              `json:"running"`
+	StartedAt   time.Time         `json:"startedAt"`
+	LastUpdated *time.Time        `json:"lastUpdated"`
+	Segments    int               `json:"segments"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Group       string            `json:"group,omitempty"`
+	Viewers     int               `json:"viewers"`
+	PeakViewers int               `json:"peakViewers"`
+	// Push is the state of the forwarding of the stream to its push target, unset if it is not pushed
+	Push *streaming.PushStatus `json:"push,omitempty"`
+	// Resolution is the size of the video written by the running transcoding, like 1280x720, unset until ffmpeg reports it
+	Resolution string `json:"resolution,omitempty"`
+	// Device is the device the accelerated video is encoded on, unset if the stream is not accelerated
+	Device string `json:"device,omitempty"`
+	// Limits are the limits the running transcoding applies, unset if it runs without any
+	Limits *streaming.Limits `json:"limits,omitempty"`
+	// Resources is the resource usage of the running transcoding, unset if it is not running or not sampled
+	Resources *streaming.Resources `json:"resources,omitempty"`
+	// RetryAttempt is the number of the restart of the crashed process that is scheduled for NextRetryAt, both unset if none is
+	RetryAttempt int        `json:"retryAttempt,omitempty"`
+	NextRetryAt  *time.Time `json:"nextRetryAt,omitempty"`
+	// Streak is the state of the streak telling if the stream is watched, with its settings
+	Streak streaming.StreakStatus `json:"streak"`
+	// Errored indicates if the stream is only started again explicitly, ErrorCode is the code of its error like source_auth_failed
+	Errored   bool   `json:"errored"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	// DVR is the window of the stream with the time it can be rewound by right now, unset if the stream has no DVR window
+	DVR *streaming.DVRStatus `json:"dvr,omitempty"`
+	// NewestSegmentAt is the wall clock time of the newest segment, unset if the playlists of the stream do not carry it
+	NewestSegmentAt *time.Time `json:"newestSegmentAt,omitempty"`
+}
+
+// CapacityDto describes the number of running streams compared to the maximum
+type CapacityDto struct {
+	Running    int `json:"running"`
+	MaxStreams int `json:"maxStreams"`
+	// Queued is the number of starts waiting for a free slot
+	Queued int `json:"queued"`
 }
 
 // Controller holds all handler functions for the API
 type Controller struct {
-	spec       *config.Specification
-	streams    map[string]*streaming.Stream
-	fileServer http.Handler
-	manager    IManager
-	processor  streaming.IProcessor
-	timeout    time.Duration
-	jwt        auth.JWT
-}
-
-// NewController creates a new instance of Controller
-func NewController(spec *config.Specification, fileServer http.Handler) *Controller {
-	manager := NewManager(time.Second * 20)
+	settings     *atomic.Value // Holds the *settings, swapped when the configuration is reloaded
+	streams      map[string]*streaming.Stream
+	mux          *sync.RWMutex
+	fileServer   http.Handler
+	manager      IManager
+	processor    streaming.IProcessor
+	metrics      *metrics.Collector
+	store        *store.FileStore
+	done         chan struct{}
+	stopOnce     *sync.Once
+	health       *healthCache
+	starts       *flightGroup
+	storage      storage.Storage
+	syncers      map[string]*storage.Syncer
+	snapshots    *snapshotCache
+	events       *events.Bus
+	reloadMux    *sync.Mutex
+	cleanupReset chan struct{} // Wakes up the cleanup when its interval is reloaded
+	webhooks     *events.Subscription
+	restarting   *busyGroup        // Streams being restarted by the restart endpoint
+	aliases      map[string]string // Ids derived from the URIs of the streams started with an alias, keyed by the alias
+	log          logrus.FieldLogger
+	now          func() time.Time
+	startOnce    *sync.Once
+	loopMux      *sync.Mutex
+	stopLoop     chan struct{} // Stops the cleanup loop, nil if it is not running
+	middlewares  middlewares
+	usage        *usageTracker
+	trimming     int32         // Indicates if the store is being trimmed to its limit
+	ffmpeg       *atomic.Value // Holds the version of ffmpeg once it is detected
+	requestLog   logrus.FieldLogger
+	viewers      *viewerTracker
+	discoverer   onvif.IDiscoverer
+	discovering  int32 // Indicates if a discovery of the cameras is running
+	whep         whep.Server
+	// routes holds the router the endpoints were registered on last, the OpenAPI description lists the routes of it
+	routes *atomic.Value
+	// eventLog keeps the last events of the bus for /events/log, nil if it is turned off
+	eventLog *events.Log
+	// spawns keeps the transcoders from being spawned while every stream is stopped by POST /admin/stopAll
+	spawns *spawnGate
+	// queue holds the starts of the new streams waiting for a free slot
+	queue *startQueue
+	// cleaning marks the streams being cleaned, so the ones that did not finish within CLEANUP_STREAM_TIMEOUT are skipped by the next passes
+	cleaning *busyGroup
+	// reconnects limits the restarts of the crashed streams reconnecting to their sources at the same time
+	reconnects *reconnectLimiter
+}
+
+// NewController creates a new instance of Controller. Its handlers can be served right away,
+// the background work of the controller only runs after Start
+func NewController(spec *config.Specification, opts ...Option) *Controller {
+	manager := NewManager(spec.StartTimeout)
 	provider, err := auth.NewJWTProvider(spec.Auth)
 	if err != nil {
 		logrus.Fatal("Could not create new JWT provider: ", err)
 	}
-	return &Controller{
-		spec,
-		map[string]*streaming.Stream{},
-		fileServer,
-		*manager,
-		streaming.NewProcessor(spec.Process.StoreDir, spec.Process.KeepFiles, spec.ProcessLogging),
-		time.Second * 15,
-		provider,
+	if spec.URLSigningEnabled && spec.URLSigningKey == "" {
+		logrus.Fatal("URL signing is enabled without a signing key")
+	}
+	keys, err := auth.NewAPIKeys(spec.Auth)
+	if err != nil {
+		logrus.Fatal("Could not create the API keys: ", err)
+	}
+	policy, err := access.NewPolicy(spec.Access)
+	if err != nil {
+		logrus.Fatal("Could not create the access lists: ", err)
+	}
+	sources, err := access.NewSources(spec.Sources)
+	if err != nil {
+		logrus.Fatal("Could not create the source lists: ", err)
+	}
+	ignored, err := access.ParseNetworks(spec.IgnoredIPs)
+	if err != nil {
+		logrus.Fatal("Could not parse the ignored viewers: ", err)
+	}
+	current := &atomic.Value{}
+	ffmpeg := &atomic.Value{}
+	ffmpeg.Store(streaming.FFmpegUnavailable)
+	current.Store(&settings{spec, provider, auth.NewURLSigner(spec.Auth), newRateLimiter(spec.RateLimit), auth.NewBasicAuth(spec.Auth), keys, policy, sources})
+	fileServer := cacheHandler(spec.Cache, spec.StoreDir, http.FileServer(newStoreFileSystem(spec.StoreDir)))
+	c := &Controller{
+		settings:     current,
+		streams:      map[string]*streaming.Stream{},
+		mux:          &sync.RWMutex{},
+		fileServer:   fileServer,
+		manager:      *manager,
+		processor:    streaming.NewProcessor(spec.Process.StoreDir, spec.Process.KeepFiles, spec.ProcessLogging, spec.Encryption, spec.Hardware, spec.ProbeTimeout, spec.RecordingsDir, spec.Thumbnail, spec.FFmpeg),
+		metrics:      metrics.NewCollector(),
+		store:        newStore(spec.Persistence),
+		done:         make(chan struct{}),
+		stopOnce:     &sync.Once{},
+		health:       newHealthCache(spec.HealthCacheTTL),
+		starts:       newFlightGroup(),
+		storage:      newStorage(spec.Storage),
+		syncers:      map[string]*storage.Syncer{},
+		snapshots:    newSnapshotCache(spec.SnapshotCacheTTL),
+		events:       events.NewBus(spec.EventsBuffer),
+		reloadMux:    &sync.Mutex{},
+		cleanupReset: make(chan struct{}, 1),
+		restarting:   newBusyGroup(),
+		aliases:      map[string]string{},
+		log:          logrus.StandardLogger(),
+		now:          time.Now,
+		startOnce:    &sync.Once{},
+		loopMux:      &sync.Mutex{},
+		usage:        newUsageTracker(),
+		ffmpeg:       ffmpeg,
+		requestLog:   newRequestLogger(spec.RequestLog),
+		viewers:      newViewerTracker(ignored),
+		discoverer:   onvif.NewDiscoverer(onvif.MulticastAddress, spec.DiscoveryWait),
+		whep:         whep.New(whep.Config{MaxViewers: spec.WHEPMaxViewers, ICEServers: spec.WHEPICEServers, AliveInterval: spec.ViewerWindow / 2}),
+		routes:       &atomic.Value{},
+		spawns:       newSpawnGate(),
+		queue:        newStartQueue(),
+		cleaning:     newBusyGroup(),
+		reconnects:   newReconnectLimiter(),
+	}
+	if spec.EventLogSize > 0 {
+		// The log is fed until the bus is closed by the shutdown
+		c.eventLog = events.NewLog(spec.EventLogSize)
+		go c.eventLog.Run(c.events.Subscribe())
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// SendError sends an error to the client
+// SendError sends an error to the client with its code
 func (c *Controller) SendError(w http.ResponseWriter, err error, status int) {
 	w.Header().Add("Content-Type", "application/json")
-	b, _ := json.Marshal(ErrDTO{Error: err.Error()})
+	message := streaming.RedactURI(err.Error())
+	b, _ := json.Marshal(ErrorDto{ErrorBodyDto{errorCode(err, status), message, w.Header().Get(RequestIDHeader)}})
+	if c.spec().LegacyErrors {
+		b, _ = json.Marshal(ErrDTO{Error: message})
+	}
 	w.WriteHeader(status)
 	w.Write(b)
 }
 
 // isAuthenticated is for checking if the user's request is valid or not
-// from a given authentication strategy's perspective
-func (c *Controller) isAuthenticated(r *http.Request) bool {
-	if c.spec.JWTEnabled {
-		return c.jwt.Validate(r.Header.Get("Authorization"))
+// from a given authentication strategy's perspective.
+// Sends the error to the client if the request is not authenticated
+func (c *Controller) isAuthenticated(w http.ResponseWriter, r *http.Request) bool {
+	if !c.spec().JWTEnabled {
+		return true
 	}
-	return true
+	err := c.jwt().Verify(r.Header.Get("Authorization"))
+	if err == nil {
+		return true
+	}
+	c.publishAuthFailure(r, err)
+	if err == auth.ErrMissingToken {
+		c.SendError(w, err, http.StatusUnauthorized)
+		return false
+	}
+	c.SendError(w, err, http.StatusForbidden)
+	return false
 }
 
-// ListStreamHandler is the HTTP handler of the /list call
+// ListStreamHandler is the HTTP handler of the /list call. The streams are listed as an array,
+// unless they are filtered, sorted or paginated, returning a page of them
 func (c *Controller) ListStreamHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	if !c.isAuthenticated(r) {
-		w.WriteHeader(http.StatusForbidden)
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	query, paged, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if r, err = withAbsolute(r); err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
 		return
 	}
 	dto := []*SummariseDto{}
-	for key, stream := range c.streams {
-		dto = append(dto, &SummariseDto{URI: fmt.Sprintf("/stream/%s/index.m3u8", key), Running: stream.Streak.IsActive()})
+	for key, stream := range c.snapshotStreams() {
+		dto = append(dto, c.listItem(r.Context(), key, stream, query.verbose))
 	}
-	b, err := json.Marshal(dto)
+	dto = append(dto, c.queuedItems()...)
+	var body interface{} = dto
+	if paged {
+		body = query.page(dto)
+	}
+	b, err := json.Marshal(body)
 	if err != nil {
 		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
 		return
@@ -111,167 +541,1506 @@ func (c *Controller) ListStreamHandler(w http.ResponseWriter, r *http.Request, _
 	w.Write(b)
 }
 
-// StartStreamHandler is an HTTP handler for the /start endpoint
-func (c *Controller) StartStreamHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	if !c.isAuthenticated(r) {
-		w.WriteHeader(http.StatusForbidden)
+// listItem describes the stream for the list with its viewers, its lifecycle and its expiry.
+// The resource usage of its transcoding is only added in the verbose mode, its URI is absolute if the request asked for it
+func (c *Controller) listItem(ctx context.Context, id string, stream *streaming.Stream, verbose bool) *SummariseDto {
+	summary := summarise(id, stream)
+	summary.URI = c.prefixed(summary.URI)
+	if isAbsolute(ctx) {
+		summary.URI = c.playbackURI(ctx, stream.Path, id)
+	}
+	summary.Viewers, summary.PeakViewers = c.streamViewers(id)
+	lifecycle := c.lifecycleDto(id, stream)
+	summary.Lifecycle, summary.StopsIn = lifecycle.Lifecycle, lifecycle.StopsIn
+	summary.ExpiresIn = c.expiryDto(stream).ExpiresIn
+	if verbose {
+		summary.Resources = resourcesOf(stream)
+	}
+	return summary
+}
+
+// summarise describes the state of the given stream for the list
+func summarise(id string, stream *streaming.Stream) *SummariseDto {
+	recording := stream.IsRecording()
+	push := stream.PushStatus()
+	errorCode := streamErrorCode(stream)
+	lastSegment := time.Time{}
+	if stream.Logs != nil {
+		lastSegment = stream.Logs.LastSegmentAt()
+	}
+	stream.Mux.RLock()
+	defer stream.Mux.RUnlock()
+	lastError := stream.LastError
+	if !stream.LastErrorAt.After(lastSegment) {
+		lastError = ""
+	}
+	return &SummariseDto{
+		URI:         stream.Path,
+		Running:     stream.Streak.IsActive(),
+		ID:          id,
+		HLS:         stream.Options.HLS,
+		Renditions:  stream.Options.Renditions,
+		Mode:        stream.Options.Mode,
+		Format:      stream.Options.OutputFormat(),
+		LowLatency:  stream.Options.LowLatency.Enabled,
+		Transport:   stream.Options.RTSPTransport(),
+		Lazy:        stream.Options.Lazy,
+		AudioOnly:   stream.Options.AudioOnly,
+		Profile:     profileName(stream.Options.Profile),
+		MaxFPS:      stream.Options.MaxFPS,
+		IdleTimeout: stream.Options.IdleTimeout,
+		Restarts:    stream.Restarts,
+		Errored:     stream.Errored,
+		Source:      stream.Options.Source,
+		Recording: RecordingDto{
+			Enabled:   stream.Options.Recording.Enabled,
+			Always:    stream.Options.Recording.Always,
+			Running:   recording,
+			Directory: stream.RecordingDir,
+		},
+		Metadata:      stream.Metadata,
+		Group:         stream.Group,
+		SourceURI:     streaming.RedactURI(stream.OriginalURI),
+		StartedAt:     optionalTime(stream.StartedAt),
+		LastSegmentAt: optionalTime(lastSegment),
+		LastError:     lastError,
+		StallRestarts: stream.StallRestarts,
+		Paused:        stream.Paused,
+		Evicted:       stream.Evicted,
+		Disabled:      stream.Disabled,
+		Priority:      stream.Options.Priority,
+		Push:          push,
+		Activity:      stream.Options.ActivitySource(),
+		ErrorCode:     errorCode,
+		lastActivity:  stream.LastActivity,
+	}
+}
+
+// profileName returns the name of the profile, empty if there is none
+func profileName(profile *config.Profile) string {
+	if profile == nil {
+		return ""
+	}
+	return profile.Name
+}
+
+// streamErrorCode returns the code of the error the stream is errored with, empty if its error has no code of its own
+func streamErrorCode(strm *streaming.Stream) string {
+	if strm.AuthFailed() {
+		return errorCode(streaming.ErrSourceAuthFailed, http.StatusUnauthorized)
+	}
+	return ""
+}
+
+// optionalTime returns nil for the zero time, so it is left out of the responses
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// StatusHandler is the HTTP handler of the /status/:id call
+func (c *Controller) StatusHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
 		return
 	}
-	var dto StreamDto
-	if err := c.marshalValidatedURI(&dto, r.Body); err != nil {
-		logrus.Error(err)
+	r, err := withAbsolute(r)
+	if err != nil {
 		c.SendError(w, err, http.StatusBadRequest)
 		return
 	}
-	// Calculate directory from URI
-	dir, err := streaming.GetURIDirectory(dto.URI)
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	strm.Mux.RLock()
+	dto := StatusDto{
+		Path:      strm.Path,
+		Running:   strm.Streak.IsActive(),
+		StartedAt: strm.StartedAt,
+		Metadata:  strm.Metadata,
+		Group:     strm.Group,
+		Device:    strm.Options.Device,
+	}
+	if limits := strm.Limits; dto.Running && limits != (streaming.Limits{}) {
+		dto.Limits = &limits
+	}
+	strm.Mux.RUnlock()
+	if isAbsolute(r.Context()) {
+		dto.URI = c.playbackURI(r.Context(), dto.Path, id)
+	}
+	if attempt, at, ok := strm.NextRetry(); ok {
+		dto.RetryAttempt, dto.NextRetryAt = attempt, &at
+	}
+	dto.Viewers, dto.PeakViewers = c.streamViewers(id)
+	dto.Push = strm.PushStatus()
+	dto.Streak = strm.StreakStatus(c.now())
+	dto.Errored, dto.ErrorCode = strm.IsErrored(), streamErrorCode(strm)
+	dto.DVR = strm.DVRStatus()
+	dto.NewestSegmentAt = strm.NewestSegmentTime()
+	if dto.Running {
+		dto.Resources = resourcesOf(strm)
+	}
+	if dto.Running && strm.Logs != nil {
+		dto.Resolution = strm.Logs.OutputResolution()
+	}
+	if info, err := os.Stat(strm.PlaylistFile()); err == nil {
+		modified := info.ModTime()
+		dto.LastUpdated = &modified
+	}
+	// Renditions keep their segments in their own directories
+	for _, pattern := range []string{"*.ts", "*/*.ts"} {
+		segments, err := filepath.Glob(filepath.Join(strm.StorePath, pattern))
+		if err != nil {
+			c.logger(r.Context()).Error(err)
+			c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+			return
+		}
+		dto.Segments += len(segments)
+	}
+	b, err := json.Marshal(dto)
 	if err != nil {
-		logrus.Error(err)
 		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
 		return
 	}
-	if stream, ok := c.streams[dir]; ok {
-		c.handleAlreadyKnownStream(w, stream, c.spec, dir)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// StartStreamHandler is an HTTP handler for the /start endpoint
+func (c *Controller) StartStreamHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
 		return
 	}
-	streamResolved := c.startStream(dto.URI, dir, c.spec)
-	defer close(streamResolved)
-	select {
-	case <-time.After(c.timeout):
-		c.SendError(w, ErrTimeout, http.StatusRequestTimeout)
-	case success := <-streamResolved:
-		if !success {
-			c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
-			return
+	c.metrics.StartRequested()
+	var dto StreamDto
+	if status, err := c.marshalValidatedURI(w, r, &dto); err != nil {
+		c.logger(r.Context()).Error(err)
+		c.metrics.StartFailed()
+		c.SendError(w, err, status)
+		return
+	}
+	result := c.start(r, dto)
+	if result.err != nil {
+		if result.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.retryAfter.Seconds()))))
 		}
-		s := c.streams[dir]
-		b, _ := json.Marshal(StreamDto{URI: s.Path})
-		w.Header().Add("Content-Type", "application/json")
-		w.Write(b)
+		c.SendError(w, result.err, result.status)
+		return
 	}
+	b, _ := json.Marshal(result.dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(result.status)
+	w.Write(b)
 }
 
-// ExitHandler is a function that can recognise when the application is being closed
-// and cleans up all background running processes
-func (c *Controller) ExitHandler() chan bool {
-	done := make(chan bool)
-	ch := make(chan os.Signal, 3)
-	signal.Notify(ch, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-	go func() {
-		<-ch
-		c.cleanUp()
-		done <- true
-	}()
-	return done
+// startResult describes the outcome of the start of a stream
+type startResult struct {
+	dto        StreamDto
+	status     int
+	err        error
+	retryAfter time.Duration // Time the client has to wait before starting again, if it is rate limited
 }
 
-// handleAlreadyKnownStream is for dealing with stream starts that are already initiated before
-func (c *Controller) handleAlreadyKnownStream(w http.ResponseWriter, strm *streaming.Stream, spec *config.Specification, dir string) {
-	// If transcoding is not running, spin it back up
-	if !strm.Streak.IsActive() {
-		err := c.processor.Restart(strm, dir)
+// start starts the stream of the validated request, or spins up the known one. The start of a new stream is
+// aborted if it takes longer than the start timeout or the client goes away
+func (c *Controller) start(r *http.Request, dto StreamDto) startResult {
+	fail := func(err error, status int) startResult {
+		c.metrics.StartFailed()
+		return startResult{StreamDto{}, status, err, 0}
+	}
+	opts, err := c.streamOptions(dto)
+	// The resolution or the frame rate cap and the copy mode can be read, but they cannot be carried out together
+	if err == streaming.ErrCopyWithResolution || err == streaming.ErrCopyWithMaxFPS {
+		c.logger(r.Context()).Error(err)
+		return fail(err, http.StatusUnprocessableEntity)
+	}
+	if err != nil {
+		c.logger(r.Context()).Error(err)
+		return fail(err, http.StatusBadRequest)
+	}
+	if err := validateAlias(dto.Alias); err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	if err := validateMetadata(dto.Metadata); err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	if err := validateGroup(dto.Group); err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	wait := false
+	if value := r.URL.Query().Get("wait"); value != "" {
+		if wait, err = strconv.ParseBool(value); err != nil {
+			return fail(ErrInvalidWait, http.StatusBadRequest)
+		}
+	}
+	dryRun, err := isDryRun(r, dto)
+	if err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	if r, err = withAbsolute(r); err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	uri := dto.URI
+	if dto.Username != "" || dto.Password != "" {
+		if dto.Username == "" || streaming.IsLocal(dto.URI) {
+			return fail(ErrInvalidSourceCredentials, http.StatusBadRequest)
+		}
+		// Only the processes get the credentials, the stream is known by the URI without them
+		var embedded bool
+		uri, dto.URI, embedded = joinCredentials(dto.URI, dto.Username, dto.Password)
+		if embedded {
+			c.logger(r.Context()).Warnf("%s has credentials in its URI and in the body, the ones of the body are used", dto.URI)
+		}
+		dto.Username, dto.Password = "", ""
+	}
+	if uri, dto.URI, err = withSRT(uri, dto.URI, dto.SRT); err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	dto.SRT = nil
+	ctx, cancel := context.WithTimeout(r.Context(), c.spec().StartTimeout)
+	defer cancel()
+	// The source is checked before anything is started, the processes connect to the checked address
+	source, err := c.pinSource(ctx, uri)
+	if ctx.Err() != nil {
+		status, err := startError(ctx, http.StatusForbidden, err)
+		return fail(err, status)
+	}
+	if err == access.ErrUnresolvedSource || err == ErrLocalSourceMissing {
+		return fail(err, http.StatusUnprocessableEntity)
+	}
+	if err != nil {
+		return fail(err, http.StatusForbidden)
+	}
+	if opts.Fallbacks, err = c.fallbackSources(source, dto.FallbackCredentials); err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	dto.FallbackCredentials = nil
+	// Calculate directory from URI
+	canonical, err := streaming.GetURIDirectory(dto.URI)
+	if err != nil {
+		c.logger(r.Context()).Error(err)
+		return fail(ErrUnexpected, http.StatusInternalServerError)
+	}
+	dir := c.streamID(canonical, dto.Alias)
+	opts.Directory = dir
+	if dryRun {
+		result := c.dryRun(ctx, dto, canonical, dir, source, opts)
+		if result.err != nil {
+			c.metrics.StartFailed()
+		}
+		return result
+	}
+	// The starts of the streams that are queued already wait for the same slot
+	if entry := c.queue.find(dir); entry != nil {
+		return c.awaitQueued(r, entry, wait)
+	}
+	// Nothing is spawned while every stream is being stopped
+	if !c.spawns.enter() {
+		return fail(ErrStoppingAll, http.StatusServiceUnavailable)
+	}
+	entered := true
+	defer func() {
+		if entered {
+			c.spawns.leave()
+		}
+	}()
+	stream, ok := c.getStream(dir)
+	// The alias could be held by the stream of another source
+	if ok && dto.Alias != "" && !c.hasAlias(dir, canonical) {
+		ok = false
+	}
+	// Running streams are cheap to serve, only the other requests are limited
+	if !ok || !stream.Streak.IsActive() {
+		if wait, limited := c.limitStart(r); limited {
+			result := fail(ErrRateLimited, http.StatusTooManyRequests)
+			result.retryAfter = wait
+			return result
+		}
+		if c.isStoreFull() {
+			c.logger(r.Context()).Warnf("%s could not be started, the store reached its limit", dir)
+			return fail(ErrStorageFull, http.StatusInsufficientStorage)
+		}
+		if !c.fitsDVRWindow(opts) {
+			c.logger(r.Context()).Warnf("%s could not be started, its DVR window needs about %d bytes", dir, c.dvrFootprint(opts))
+			return fail(ErrDVRWindowTooLarge, http.StatusInsufficientStorage)
+		}
+	}
+	if ok {
+		c.setMetadata(stream, dto.Metadata)
+		c.setGroup(stream, dto.Group)
+		if err := c.issueToken(r.Context(), dir, stream, false); err != nil {
+			c.logger(r.Context()).Error(err)
+			return fail(ErrUnexpected, http.StatusInternalServerError)
+		}
+		return c.handleAlreadyKnownStream(r.Context(), stream, dir)
+	}
+	if opts.Layout, err = c.layout(canonical, dir, dto.Metadata); err != nil {
+		c.logger(r.Context()).Debugf("%s could not be laid out || Error: %s", dir, err)
+		return fail(ErrInvalidLayout, http.StatusBadRequest)
+	}
+	if c.queueing(opts) {
+		entry, err := c.enqueueStart(newQueuedStart(r, dir, canonical, source, dto, opts, wait))
 		if err != nil {
-			logrus.Error(err)
-			c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
-			return
+			return fail(err, http.StatusConflict)
+		}
+		// The full queue refuses the start like there was no queue
+		if entry != nil {
+			c.logger(r.Context()).Infof("%s is queued at position %d%s", dir, c.queue.position(dir), requestedBy(entry.key))
+			// Stopping every stream does not wait for the start that only waits for a slot
+			entered = false
+			c.spawns.leave()
+			return c.awaitQueued(r, entry, wait)
 		}
 	}
-	// If the stream is already running return its path
-	b, err := json.Marshal(StreamDto{URI: strm.Path})
+	// Concurrent requests of the same stream wait for the first one to create it, within the time of the first one
+	status, err := c.starts.do(dir, func() (int, error) {
+		if dto.Alias == "" {
+			return c.createStream(ctx, source, dir, opts, apiKeyName(r), wait)
+		}
+		if err := c.claimAlias(dir, canonical); err != nil {
+			return http.StatusConflict, err
+		}
+		status, err := c.createStream(ctx, source, dir, opts, apiKeyName(r), wait)
+		if err != nil {
+			c.releaseAlias(dir, canonical)
+		}
+		return status, err
+	})
 	if err != nil {
-		logrus.Error(err)
-		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+		return fail(err, status)
+	}
+	s, err := c.completeStart(r.Context(), dir, dto)
+	if err != nil {
+		return fail(err, http.StatusInternalServerError)
+	}
+	return startResult{c.streamDto(r.Context(), s, dir), http.StatusOK, nil, 0}
+}
+
+// completeStart applies the metadata, the group and the time to live of the start request to the new stream and issues its token
+func (c *Controller) completeStart(ctx context.Context, dir string, dto StreamDto) (*streaming.Stream, error) {
+	s, _ := c.getStream(dir)
+	c.setMetadata(s, dto.Metadata)
+	c.setGroup(s, dto.Group)
+	// The time to live only applies to the new streams, the known ones keep theirs
+	if dto.TTL != nil && *dto.TTL > 0 && s.GetExpiry().IsZero() {
+		s.SetExpiry(c.now().Add(time.Duration(*dto.TTL) * time.Second))
+		c.persist()
+	}
+	if err := c.issueToken(ctx, dir, s, false); err != nil {
+		c.logger(ctx).Error(err)
+		return nil, ErrUnexpected
+	}
+	return s, nil
+}
+
+// setMetadata replaces the metadata of the stream with the one of the start request, if it has any
+func (c *Controller) setMetadata(strm *streaming.Stream, metadata map[string]string) {
+	if metadata == nil {
 		return
 	}
-	checkCh := c.manager.WaitForStream(fmt.Sprintf("%s/index.m3u8", strm.StorePath))
-	<-checkCh
-	w.Header().Add("Content-Type", "application/json")
-	w.Write(b)
+	copied := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	strm.SetMetadata(copied)
+	c.persist()
+}
+
+// limitStart checks the rate limits of the client, returns the time it has to wait if they are exceeded
+func (c *Controller) limitStart(r *http.Request) (time.Duration, bool) {
+	limiter := c.limiter()
+	if limiter == nil {
+		return 0, false
+	}
+	ip := c.clientAddress(r)
+	allowed, wait := limiter.allow(ip, c.now())
+	if allowed {
+		return 0, false
+	}
+	c.logger(r.Context()).Warnf("Start request of %s is rate limited", ip)
+	return wait, true
 }
 
-// cleanUp stops all running processes
-func (c *Controller) cleanUp() {
-	for uri, strm := range c.streams {
-		logrus.Debugf("Closing processing of %s", uri)
-		if err := strm.CleanProcess(); err != nil {
-			logrus.Debugf("Could not close %s", uri)
-			logrus.Error(err)
+// StopStreamHandler is an HTTP handler for the DELETE /stream/:id endpoint
+func (c *Controller) StopStreamHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	keepRecordings := c.spec().KeepRecordings
+	if value := r.URL.Query().Get("keepRecordings"); value != "" {
+		keep, err := strconv.ParseBool(value)
+		if err != nil {
+			c.SendError(w, ErrInvalidKeepRecordings, http.StatusBadRequest)
 			return
 		}
-		logrus.Debugf("Succesfully closed processing for %s", uri)
+		keepRecordings = keep
+	}
+	if status, err := c.stopStream(r.Context(), id, keepRecordings); err != nil {
+		c.SendError(w, err, status)
+		return
 	}
+	w.WriteHeader(http.StatusOK)
 }
 
-// cleanUnused is for stopping all transcoding for streams that are not watched anymore
-func (c *Controller) cleanUnused() {
-	for name, data := range c.streams {
-		// If the streak is active, there is no need for stopping
-		if data.Streak.IsActive() {
-			logrus.Infof("%s is active, skipping cleaning process", name)
-			continue
-		}
-		logrus.Infof("%s is getting cleaned", name)
-		if err := data.CleanProcess(); err != nil {
-			if strings.Contains(err.Error(), "signal: killed") {
-				logrus.Infof("\n%s is cleaned", name)
-				continue
-			}
-			logrus.Error(err)
+// stopStream stops and removes the stream requested by the request of the context.
+// Returns the status of the response and the error sent with it if the stream could not be stopped
+func (c *Controller) stopStream(ctx context.Context, id string, keepRecordings bool) (int, error) {
+	strm, ok := c.deleteStream(id)
+	if !ok && c.cancelQueued(id) {
+		c.logger(ctx).Infof("Queued start of %s is canceled%s", id, requestedBy(apiKeyFromContext(ctx)))
+		return http.StatusOK, nil
+	}
+	if !ok {
+		return http.StatusNotFound, ErrNoStreamFn(id)
+	}
+	c.logger(ctx).Infof("%s is getting stopped%s", id, requestedBy(apiKeyFromContext(ctx)))
+	if err := c.removeStream(ctx, id, strm, keepRecordings); err != nil {
+		c.logger(ctx).Error(err)
+		return http.StatusInternalServerError, ErrUnexpected
+	}
+	c.logger(ctx).Infof("%s is stopped", id)
+	c.publishBy(ctx, events.Stopped, id, strm, "")
+	return http.StatusOK, nil
+}
+
+// removeStream stops the process and the recording of the stream deleted from the controller and removes its files.
+// The recordings are removed as well, unless they are kept
+func (c *Controller) removeStream(ctx context.Context, id string, strm *streaming.Stream, keepRecordings bool) error {
+	c.metrics.RemoveStream(id)
+	if err := strm.StopRecording(); err != nil {
+		c.logger(ctx).Error(err)
+	}
+	if !keepRecordings && strm.RecordingDir != "" {
+		if err := os.RemoveAll(strm.RecordingDir); err != nil {
+			c.logger(ctx).Error(err)
 		}
-		logrus.Infof("%s is cleaned", name)
 	}
+	if err := strm.CleanProcess(); err != nil {
+		return err
+	}
+	c.refreshUsage(id)
+	return nil
 }
 
-// FileHandler is HTTP handler for direct file requests
-func (c *Controller) FileHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	if !c.isAuthenticated(req) {
-		w.WriteHeader(http.StatusForbidden)
+// KeyHandler is the HTTP handler of the /keys/:id call serving the encryption key of a stream
+func (c *Controller) KeyHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, r) {
 		return
 	}
-	defer c.fileServer.ServeHTTP(w, req)
-	filepath := ps.ByName("filepath")
-	req.URL.Path = filepath
-	hostKey := determineHost(filepath)
-	s, ok := c.streams[hostKey]
-	if !ok {
+	id := ps.ByName("id")
+	if c.spec().URLSigningEnabled {
+		if err := c.signer().Verify(id, r.URL.Query()); err != nil {
+			c.logger(r.Context()).Errorf("Key of %s could not be served, %s", id, err)
+			c.SendError(w, err, http.StatusForbidden)
+			return
+		}
+	}
+	strm, ok := c.getStream(id)
+	if !ok || strm.KeyPath == "" {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
 		return
 	}
-	if s.Streak.IsActive() {
-		s.Streak.Hit()
+	if !c.checkPlaybackToken(w, r, id, strm) {
 		return
 	}
-	logrus.Debugf("%s is getting restarted", hostKey)
-	if err := c.processor.Restart(s, hostKey); err != nil {
-		logrus.Error(err)
+	key, err := ioutil.ReadFile(filepath.Join(strm.KeyPath, streaming.KeyFile))
+	if err != nil {
+		c.logger(r.Context()).Error(err)
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
 		return
 	}
-	checkCh := c.manager.WaitForStream(fmt.Sprintf("%s/index.m3u8", s.StorePath))
-	<-checkCh
-	s.Streak.Activate().Hit()
+	w.Header().Add("Content-Type", "application/octet-stream")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Write(key)
 }
 
-// startStream creates a new stream then starts processing it with a manager
-func (c *Controller) startStream(uri, dir string, spec *config.Specification) chan bool {
-	logrus.Infof("%s started processing", dir)
-	stream, physicalPath := c.processor.NewStream(uri)
-	c.streams[dir] = stream
-	ch := c.manager.Start(stream.CMD, physicalPath)
-	return ch
+// LogsHandler is the HTTP handler of the /stream/:id/logs call.
+// It returns the last lines of the error output of the transcoding process
+func (c *Controller) LogsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	if strm.Logs == nil {
+		return
+	}
+	for _, line := range strm.Logs.Lines() {
+		fmt.Fprintln(w, line)
+	}
 }
 
-// marshalValidateURI is for validiting that the URI is in a valid format
-// and marshaling it into the dto pointer
-func (c *Controller) marshalValidatedURI(dto *StreamDto, body io.Reader) error {
-	uri, err := ioutil.ReadAll(body)
-	if err != nil {
-		return err
+// KeepaliveHandler is the HTTP handler of the POST /stream/:id/keepalive call.
+// It keeps the stream running even if its files are not requested from the service
+func (c *Controller) KeepaliveHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, r) {
+		return
 	}
-	if err = json.Unmarshal(uri, dto); err != nil {
-		return err
+	id := c.resolveID(ps.ByName("id"))
+	if c.spec().URLSigningEnabled {
+		if err := c.signer().Verify(id, r.URL.Query()); err != nil {
+			c.logger(r.Context()).Errorf("Keepalive of %s is rejected, %s", id, err)
+			c.SendError(w, err, http.StatusForbidden)
+			return
+		}
+	}
+	strm, ok := c.getStream(id)
+	if !ok || !strm.IsAlive(c.now()) {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if !c.checkPlaybackToken(w, r, id, strm) {
+		return
 	}
+	strm.Touch()
+	b, _ := json.Marshal(c.streamDto(r.Context(), strm, id))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
 
-	if _, err := url.Parse(dto.URI); err != nil {
-		return errors.New("Invalid URI")
+// MetricsHandler is the HTTP handler of the /metrics call
+func (c *Controller) MetricsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
 	}
-	return nil
+	w.Header().Add("Content-Type", "text/plain; version=0.0.4")
+	// The series of the stopped streams are dropped like their other ones
+	current, peak := map[string]uint64{}, map[string]uint64{}
+	for id, strm := range c.snapshotStreams() {
+		if !strm.Streak.IsActive() {
+			continue
+		}
+		viewers, most := c.streamViewers(id)
+		current[id], peak[id] = uint64(viewers), uint64(most)
+	}
+	c.metrics.Viewers(current, peak)
+	c.metrics.Usage(usageMetrics(c.snapshotStreams()))
+	if err := c.metrics.Write(w, c.activeStreams()); err != nil {
+		c.logger(r.Context()).Error(err)
+	}
+}
+
+// CapacityHandler is the HTTP handler of the /capacity call
+func (c *Controller) CapacityHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	b, _ := json.Marshal(CapacityDto{c.activeStreams(), c.spec().MaxStreams, c.queue.len()})
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Shutdown stops the background cleanup and terminates the transcoding of every stream.
+// Processes that do not exit before the context is done are killed.
+// The files of the streams are kept if persistence is enabled, so they can be recovered
+func (c *Controller) Shutdown(ctx context.Context) error {
+	c.Stop()
+	c.stopOnce.Do(func() { close(c.done) })
+	c.events.Close()
+	c.whep.Shutdown()
+	streams := c.snapshotStreams()
+	errs := make(chan error, len(streams))
+	var wg sync.WaitGroup
+	for id, strm := range streams {
+		wg.Add(1)
+		go func(id string, strm *streaming.Stream) {
+			defer wg.Done()
+			c.log.Debugf("Closing processing of %s", id)
+			if err := strm.StopRecording(); err != nil {
+				c.log.Errorf("Could not close the recording of %s || Error: %s", id, err)
+			}
+			if err := strm.Stop(ctx, c.store != nil); err != nil {
+				c.log.Errorf("Could not close %s || Error: %s", id, err)
+				errs <- err
+				return
+			}
+			c.log.Debugf("Succesfully closed processing for %s", id)
+		}(id, strm)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// handleAlreadyKnownStream is for dealing with stream starts that are already initiated before
+func (c *Controller) handleAlreadyKnownStream(ctx context.Context, strm *streaming.Stream, dir string) startResult {
+	// Lazy streams are only spun up by the requests of their playlist, the paused ones by resuming them
+	if (strm.Options.Lazy || strm.IsPaused()) && !strm.Streak.IsActive() {
+		return startResult{c.streamDto(ctx, strm, dir), http.StatusOK, nil, 0}
+	}
+	// If transcoding is not running, spin it back up
+	if !strm.Streak.IsActive() {
+		strm.ResetErrored()
+		err := c.processor.Restart(strm, dir)
+		if err != nil {
+			c.logger(ctx).Error(err)
+			c.metrics.StartFailed()
+			return startResult{StreamDto{}, http.StatusInternalServerError, ErrRestartFailed, 0}
+		}
+		c.metrics.Restarted(dir)
+		c.publishBy(ctx, events.Restarted, dir, strm, "")
+		c.persist()
+	}
+	// If the stream is already running return its path
+	dto := c.streamDto(ctx, strm, dir)
+	checkCh := c.manager.WaitForStream(strm.PlaylistFile())
+	<-checkCh
+	return startResult{dto, http.StatusOK, nil, 0}
+}
+
+// removeIdle removes the cleaned stream and its files once the grace period is over, so the clients can finish
+// playing the last segments. Streams restarted meanwhile, by the requests of their files or a start, are kept
+func (c *Controller) removeIdle(id string, strm *streaming.Stream) {
+	select {
+	case <-time.After(c.spec().CleanupRemoveGrace):
+	case <-c.done:
+		return
+	}
+	// The stream is locked while its files are removed, so it cannot be restarted meanwhile
+	if current, ok := c.getStream(id); !ok || current != strm || !strm.Remove() {
+		return
+	}
+	c.deleteStream(id)
+	c.refreshUsage(id)
+	c.streamLog(strm).Infof("%s is removed after being idle", id)
+	c.publish(events.Stopped, id, strm, "idle")
+}
+
+// FileHandler is HTTP handler for direct file requests
+func (c *Controller) FileHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, req) {
+		return
+	}
+	filepath := ps.ByName("filepath")
+	// Requests of files that cannot belong to the streams are refused without telling why
+	if !isStreamFile(filepath, c.spec().Encryption.Enabled) {
+		c.logger(req.Context()).Debugf("%s is not a file of the streams", filepath)
+		c.SendError(w, ErrFileNotFound, http.StatusNotFound)
+		return
+	}
+	id := determineStreamID(filepath)
+	if c.spec().URLSigningEnabled {
+		if err := c.signer().Verify(id, req.URL.Query()); err != nil {
+			c.logger(req.Context()).Errorf("%s could not be served, %s", filepath, err)
+			c.SendError(w, err, http.StatusForbidden)
+			return
+		}
+	}
+	s, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if !c.checkPlaybackToken(w, req, id, s) {
+		return
+	}
+	// The disabled streams are switched off for good, their players are not kept on the last files
+	if s.IsDisabled() && isManifest(filepath) {
+		c.SendError(w, ErrStreamDisabled, http.StatusConflict)
+		return
+	}
+	if s.IsPaused() && isManifest(filepath) && !c.spec().PausedServeFiles {
+		c.SendError(w, ErrStreamPaused, http.StatusConflict)
+		return
+	}
+	req.URL.Path = s.FilePath(filepath)
+	// Poster images are fetched by previews, they do not count as watching the stream
+	if isThumbnail(filepath) {
+		if s.IsAudioOnly() {
+			c.SendError(w, ErrAudioOnly, http.StatusConflict)
+			return
+		}
+		c.serveFile(w, req)
+		return
+	}
+	if isSegment(filepath) {
+		c.metrics.SegmentServed(id)
+	}
+	// Players request the playlists again and again while they are watching
+	if isManifest(filepath) {
+		c.watched(id, req)
+	}
+	if !c.activate(w, req, id, s) {
+		return
+	}
+	c.serveStreamFile(w, req, s)
+}
+
+// activate records the activity of the client on the stream and restarts the stream if it is not running.
+// Returns false if the restart failed and the error has been sent to the client
+func (c *Controller) activate(w http.ResponseWriter, req *http.Request, id string, s *streaming.Stream) bool {
+	// Paused streams are only restarted by resuming them, their clients get the files written before the pause
+	if s.IsPaused() {
+		return true
+	}
+	// The ignored clients like health checks cannot restart the streams kept running by their viewers
+	if !s.Streak.IsActive() && s.Lifecycle() == streaming.LifecycleViewers && !c.isViewer(req) {
+		return true
+	}
+	s.Touch()
+	if s.Streak.IsActive() {
+		s.Hit(c.now())
+		return true
+	}
+	// Errored streams are only restarted by starting them again, the ones being restarted are not spawned twice
+	if s.IsErrored() || c.restarting.busy(id) {
+		return true
+	}
+	// The clients get the files written before every stream is stopped
+	if !c.spawns.enter() {
+		return true
+	}
+	defer c.spawns.leave()
+	c.logger(req.Context()).Debugf("%s is getting restarted", id)
+	if err := c.processor.Restart(s, id); err != nil {
+		if err == streaming.ErrStreamRemoved {
+			c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+			return false
+		}
+		c.logger(req.Context()).Error(err)
+		c.SendError(w, ErrRestartFailed, http.StatusInternalServerError)
+		return false
+	}
+	c.metrics.Restarted(id)
+	c.publish(events.Restarted, id, s, "")
+	c.waitForPlaylist(s)
+	s.Streak.Activate()
+	s.Hit(c.now())
+	c.persist()
+	return true
+}
+
+// waitForPlaylist blocks until the playlist of the restarted stream is created.
+// Lazy streams wait at most for the configured timeout
+func (c *Controller) waitForPlaylist(strm *streaming.Stream) {
+	checkCh := c.manager.WaitForStream(strm.PlaylistFile())
+	if !strm.Options.Lazy {
+		<-checkCh
+		return
+	}
+	select {
+	case <-checkCh:
+	case <-time.After(c.spec().LazyTimeout):
+		c.log.Errorf("%s timed out while waiting for the first segments", strm.PlaylistFile())
+	}
+}
+
+// getStream returns the stream registered with the given id
+func (c *Controller) getStream(id string) (*streaming.Stream, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	strm, ok := c.streams[id]
+	return strm, ok
+}
+
+// setStream registers the stream with the given id
+func (c *Controller) setStream(id string, strm *streaming.Stream) {
+	c.mux.Lock()
+	c.streams[id] = strm
+	c.mux.Unlock()
+	c.syncStream(id, strm)
+	c.persist()
+	// The cleanup waits for the shortest idle timeout, it is woken up to wait for the one of the new stream
+	if idle := strm.Options.IdleDuration(); idle > 0 && idle < c.spec().CleanupTime {
+		select {
+		case c.cleanupReset <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deleteStream removes the stream with the given id and returns it if it was registered
+func (c *Controller) deleteStream(id string) (*streaming.Stream, bool) {
+	c.mux.Lock()
+	strm, ok := c.streams[id]
+	if ok {
+		delete(c.streams, id)
+		delete(c.aliases, id)
+	}
+	c.mux.Unlock()
+	if ok {
+		c.unsyncStream(id)
+		c.viewers.remove(id)
+		c.persist()
+		// The slot of the stream can be taken by a queued start
+		c.queue.notify()
+	}
+	return strm, ok
+}
+
+// activeStreams returns the number of streams that are running
+func (c *Controller) activeStreams() int {
+	active := 0
+	for _, strm := range c.snapshotStreams() {
+		if strm.Streak.IsActive() {
+			active++
+		}
+	}
+	return active
+}
+
+// cpuQuotas returns the sum of the CPU quotas of the running streams
+func (c *Controller) cpuQuotas() float64 {
+	quotas := 0.0
+	for _, strm := range c.snapshotStreams() {
+		strm.Mux.RLock()
+		if strm.Streak.IsActive() {
+			quotas += strm.Options.CPUQuota
+		}
+		strm.Mux.RUnlock()
+	}
+	return quotas
+}
+
+// snapshotStreams returns a copy of the registered streams, so callers
+// can iterate over them without holding the lock of the controller
+func (c *Controller) snapshotStreams() map[string]*streaming.Stream {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	snapshot := make(map[string]*streaming.Stream, len(c.streams))
+	for id, strm := range c.streams {
+		snapshot[id] = strm
+	}
+	return snapshot
+}
+
+// streamDto describes the given stream for the client of the request in the context
+func (c *Controller) streamDto(ctx context.Context, strm *streaming.Stream, id string) StreamDto {
+	dto := StreamDto{
+		URI:               c.playbackURI(ctx, strm.Path, id),
+		ID:                id,
+		KeepaliveInterval: strm.Options.KeepaliveInterval(),
+		Source:            strm.Options.Source,
+	}
+	if c.canonicalOf(id) != "" {
+		dto.Alias = id
+	}
+	dto.Metadata = strm.GetMetadata()
+	dto.Group = strm.GetGroup()
+	if c.spec().PlaybackTokens {
+		dto.Token = strm.GetPlaybackToken()
+	}
+	if dash := strm.DASHPath(); dash != "" {
+		dto.DASHURI = c.playbackURI(ctx, dash, id)
+		if hls := strm.HLSPath(); hls != "" {
+			dto.HLSURI = c.playbackURI(ctx, hls, id)
+		}
+	}
+	return dto
+}
+
+// playbackURI returns the URI the client can use to play the file of the given stream on the given path
+func (c *Controller) playbackURI(ctx context.Context, path, id string) string {
+	if remote := c.remoteURI(path, id); remote != "" {
+		return remote
+	}
+	if !c.spec().URLSigningEnabled {
+		return c.publicURI(ctx, path)
+	}
+	return c.publicURI(ctx, appendQuery(path, c.signer().Sign(id).Encode()))
+}
+
+// publicURI prefixes the path with the public URL of the service. Without one it is prefixed with the origin the client
+// sent the request to if a trusted proxy told it, and stays relative otherwise. The path prefix of the service is added in every case
+func (c *Controller) publicURI(ctx context.Context, path string) string {
+	if c.spec().PublicURL != "" {
+		return strings.TrimRight(c.spec().PublicURL, "/") + c.prefixed(path)
+	}
+	return originFromContext(ctx) + c.prefixed(path)
+}
+
+// prefixed prefixes the path with the path the service is mounted under, it is unchanged if there is none
+func (c *Controller) prefixed(path string) string {
+	return c.spec().PathPrefix + path
+}
+
+// bufferedWriter keeps the response of the file server in memory, so the playlist can be rewritten before it is sent
+type bufferedWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// newBufferedWriter creates an empty response, its status is 200 unless another one is written
+func newBufferedWriter() *bufferedWriter {
+	return &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+}
+
+// Header returns the headers of the response
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader keeps the status code of the response, only the first one counts
+func (w *bufferedWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+}
+
+// Write appends to the body of the response
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+// serveFile serves the requested file through the file server.
+// Playlists of signed streams are rewritten, so their segments carry the signature and the playback token given in the query too,
+// and playlists are compressed for the clients accepting it. Segments are never compressed. The absolute references of the
+// playlists, like the URIs of the encryption keys, get the path prefix of the service.
+// HEAD requests get the same headers as the GET ones, the length included
+func (c *Controller) serveFile(w http.ResponseWriter, req *http.Request) {
+	rewritten := c.spec().URLSigningEnabled || c.spec().PlaybackTokens || c.spec().GzipPlaylists || c.spec().PathPrefix != ""
+	if !isPlaylist(req.URL.Path) || !rewritten {
+		c.fileServer.ServeHTTP(w, req)
+		return
+	}
+	compress := c.spec().GzipPlaylists && acceptsGzip(req)
+	if c.spec().GzipPlaylists {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if compress {
+		req.Header.Set("If-None-Match", plainETags(req.Header.Get("If-None-Match")))
+	}
+	// The playlist is read even for HEAD requests, its length depends on the rewriting and the compression
+	read := req
+	if req.Method == http.MethodHead {
+		read = req.WithContext(req.Context())
+		read.Method = http.MethodGet
+	}
+	buffered := newBufferedWriter()
+	c.fileServer.ServeHTTP(buffered, read)
+	for key, values := range buffered.Header() {
+		if key == "Content-Length" {
+			continue
+		}
+		w.Header()[key] = values
+	}
+	if compress && (buffered.status == http.StatusOK || buffered.status == http.StatusNotModified) {
+		if tag := w.Header().Get("ETag"); tag != "" {
+			w.Header().Set("ETag", gzipETag(tag))
+		}
+	}
+	if buffered.status != http.StatusOK {
+		w.WriteHeader(buffered.status)
+		w.Write(buffered.body.Bytes())
+		return
+	}
+	content := buffered.body.Bytes()
+	query := url.Values{}
+	if c.spec().URLSigningEnabled {
+		query.Set("expires", req.URL.Query().Get("expires"))
+		query.Set("sig", req.URL.Query().Get("sig"))
+	}
+	// Tokens sent in the header are left out, the clients send the header with the requests of the segments too
+	if token := req.URL.Query().Get(auth.PlaybackTokenQuery); c.spec().PlaybackTokens && token != "" {
+		query.Set(auth.PlaybackTokenQuery, token)
+	}
+	if len(query) > 0 {
+		content = rewritePlaylist(content, query.Encode())
+	}
+	if prefix := c.spec().PathPrefix; prefix != "" {
+		content = prefixPlaylist(content, prefix)
+	}
+	if compress {
+		compressed, err := gzipBytes(content)
+		if err != nil {
+			c.logger(req.Context()).Error(err)
+			c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+			return
+		}
+		content = compressed
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		w.Write(content)
+	}
+}
+
+// launchStream starts the stream and waits until it is ready to be played.
+// Hardware accelerated streams fall back to software encoding if they cannot be started
+func (c *Controller) launchStream(ctx context.Context, uri, dir string, opts streaming.Options) error {
+	err := c.waitForStart(ctx, c.startStream(ctx, uri, dir, opts))
+	if err == nil {
+		return nil
+	}
+	// Streams that did not write a segment in time are not started again, the source is not sending anything
+	if failed := c.firstSegmentError(dir); failed != nil {
+		return failed
+	}
+	if err != ErrUnexpected || !opts.UsesHardware() {
+		return err
+	}
+	c.logger(ctx).Warnf("%s could not be started with %s acceleration, falling back to software encoding", dir, opts.HardwareAccel)
+	opts.HardwareAccel = streaming.AccelNone
+	opts.Device = ""
+	return c.waitForStart(ctx, c.startStream(ctx, uri, dir, opts))
+}
+
+// abortStart removes the stream whose start timed out or was canceled, killing its process and removing its files
+func (c *Controller) abortStart(dir string) {
+	strm, ok := c.deleteStream(dir)
+	if !ok {
+		return
+	}
+	c.metrics.RemoveStream(dir)
+	if err := strm.CleanProcess(); err != nil {
+		c.log.Error(err)
+	}
+	strm.ClearFiles()
+	c.refreshUsage(dir)
+}
+
+// startError returns the error of the start with the status describing it, the start timeout and
+// the canceled requests are reported instead of the errors of the steps they interrupted
+func startError(ctx context.Context, status int, err error) (int, error) {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return http.StatusGatewayTimeout, ErrTimeout
+	case context.Canceled:
+		return statusClientClosedRequest, ErrStartCanceled
+	}
+	return status, err
+}
+
+// waitForStart waits for the resolution of the stream start, until the context is done
+func (c *Controller) waitForStart(ctx context.Context, streamResolved chan bool) error {
+	select {
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return ErrStartCanceled
+		}
+		return ErrTimeout
+	case success := <-streamResolved:
+		if !success {
+			return ErrUnexpected
+		}
+		return nil
+	}
+}
+
+// waitForSegment waits until the launched stream writes its first segment, or it is failed for not writing it in time
+func (c *Controller) waitForSegment(ctx context.Context, id string) error {
+	strm, ok := c.getStream(id)
+	if !ok {
+		return ErrUnexpected
+	}
+	for !strm.HasSegment() {
+		if err := c.firstSegmentError(id); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				return ErrStartCanceled
+			}
+			return ErrTimeout
+		case <-time.After(25 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// createStream creates the stream of a new URI, starting its processing unless it is lazy. The key is the name of the
+// API key of the request, if any. If wait is set, it also waits for the first segment of the stream.
+// Returns the HTTP status describing the error if the stream could not be created
+func (c *Controller) createStream(ctx context.Context, uri, dir string, opts streaming.Options, key string, wait bool) (int, error) {
+	// The stream could have been created by a call that finished in the meantime
+	if _, ok := c.getStream(dir); ok {
+		return http.StatusOK, nil
+	}
+	source, err := c.resolveSource(ctx, uri, &opts)
+	if err == streaming.ErrSourceAuthFailed {
+		uri, source, err = c.resolveFallbacks(ctx, dir, &opts)
+	}
+	if err == streaming.ErrSourceAuthFailed {
+		c.logger(ctx).Warnf("%s could not be started, the source refused the credentials", dir)
+		return startError(ctx, http.StatusUnauthorized, err)
+	}
+	if err != nil {
+		c.logger(ctx).Error(err)
+		return startError(ctx, http.StatusUnprocessableEntity, err)
+	}
+	opts.Source = source
+	c.assignDevice(ctx, dir, &opts)
+	// Lazy streams are started by the first request of their playlist
+	if opts.Lazy {
+		strm := c.registerStopped(ctx, uri, dir, opts)
+		if strm == nil {
+			return http.StatusInternalServerError, ErrDirectoryNotCreated
+		}
+		c.logger(ctx).Infof("%s is registered for lazy processing%s", dir, requestedBy(key))
+		c.publishBy(ctx, events.Started, dir, strm, "lazy")
+		return http.StatusOK, nil
+	}
+	if max := c.spec().MaxStreams; max > 0 && c.activeStreams() >= max && !c.evictFor(ctx, dir, opts.Priority) {
+		c.logger(ctx).Warnf("%s could not be started, %d streams are running already", dir, max)
+		return http.StatusServiceUnavailable, ErrCapacityFn(max)
+	}
+	if budget := c.spec().ProcessCPUBudget; budget > 0 && c.cpuQuotas()+opts.CPUQuota > budget {
+		c.logger(ctx).Warnf("%s could not be started, the running streams use the CPU budget of %v CPUs", dir, budget)
+		return http.StatusServiceUnavailable, ErrCPUBudgetFn(budget)
+	}
+	err = c.launchStream(ctx, uri, dir, opts)
+	if err == nil && wait {
+		err = c.waitForSegment(ctx, dir)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			c.logger(ctx).Warnf("%s could not be started in time, it is aborted || Error: %s", dir, err)
+			c.abortStart(dir)
+		}
+		if err == streaming.ErrSourceAuthFailed {
+			return startError(ctx, http.StatusUnauthorized, err)
+		}
+		if c.firstSegmentError(dir) != nil {
+			return startError(ctx, http.StatusBadGateway, err)
+		}
+		return startError(ctx, http.StatusInternalServerError, err)
+	}
+	// The recording is only started with the stream that was launched, not with the failed attempts
+	if strm, ok := c.getStream(dir); ok {
+		c.record(dir, strm)
+		c.logger(ctx).Infof("%s is started%s", dir, requestedBy(key))
+		c.publishBy(ctx, events.Started, dir, strm, "")
+	}
+	return http.StatusOK, nil
+}
+
+// registerStopped creates a new stream that is restarted by the requests of its files, the background work
+// of the stream carries the id of the request in the context. Returns nil if the stream could not be created
+func (c *Controller) registerStopped(ctx context.Context, uri, dir string, opts streaming.Options) *streaming.Stream {
+	stream, _ := c.processor.NewStream(uri, opts)
+	if stream == nil {
+		return nil
+	}
+	stream.RequestID = RequestIDFromContext(ctx)
+	stream.Streak.Deactivate()
+	c.supervise(dir, stream)
+	c.setStream(dir, stream)
+	if opts.Recording.Always {
+		c.record(dir, stream)
+	}
+	return stream
+}
+
+// record starts the recording of the stream if it is enabled and not running already
+func (c *Controller) record(id string, strm *streaming.Stream) {
+	if err := c.processor.Record(strm); err != nil {
+		c.streamLog(strm).Errorf("%s could not be recorded || Error: %s", id, err)
+	}
+}
+
+// startStream creates a new stream then starts processing it with a manager,
+// the background work of the stream carries the id of the request in the context
+func (c *Controller) startStream(ctx context.Context, uri, dir string, opts streaming.Options) chan bool {
+	c.logger(ctx).Infof("%s started processing", dir)
+	stream, physicalPath := c.processor.NewStream(uri, opts)
+	stream.RequestID = RequestIDFromContext(ctx)
+	c.supervise(dir, stream)
+	c.setStream(dir, stream)
+	ch := c.manager.Start(stream, physicalPath)
+	go c.watchFirstSegment(dir, stream)
+	return ch
+}
+
+// streamOptions creates the options of the stream from the defaults and the overrides of the request
+func (c *Controller) streamOptions(dto StreamDto) (streaming.Options, error) {
+	opts := streaming.NewOptions(c.spec().Process, c.spec().Hardware)
+	opts.CPUQuota = c.spec().ProcessCPUQuota
+	// The WebRTC sessions take the video of the streams from their MPEG-TS output
+	opts.MPEGTS = opts.MPEGTS || c.spec().WHEPEnabled
+	if err := c.applyProfile(&opts, dto.Profile); err != nil {
+		return opts, err
+	}
+	if dto.Device != "" {
+		if err := c.checkDevice(dto.Device); err != nil {
+			return opts, err
+		}
+		opts.Device = dto.Device
+	}
+	if dto.HLS != nil {
+		if dto.HLS.Time != nil {
+			opts.HLS.Time = *dto.HLS.Time
+		}
+		if dto.HLS.ListSize != nil {
+			opts.HLS.ListSize = *dto.HLS.ListSize
+		}
+		if dto.HLS.DeleteSegments != nil {
+			opts.HLS.DeleteSegments = *dto.HLS.DeleteSegments
+		}
+		if dto.HLS.SegmentType != "" {
+			opts.HLS.SegmentType = dto.HLS.SegmentType
+		}
+		if dto.HLS.ProgramDateTime != nil {
+			opts.HLS.ProgramDateTime = *dto.HLS.ProgramDateTime
+		}
+	}
+	if dto.Renditions != nil {
+		opts.Renditions = dto.Renditions
+	}
+	if dto.Mode != "" {
+		opts.Mode = dto.Mode
+	}
+	// The video is transcoded to be scaled, unless the copy was requested explicitly
+	if dto.Resolution != nil {
+		resolution := streaming.Resolution(*dto.Resolution)
+		if resolution.Width > c.spec().ResolutionMaxWidth || resolution.Height > c.spec().ResolutionMaxHeight {
+			return opts, ErrResolutionTooLarge
+		}
+		opts.Resolution = &resolution
+		if dto.Mode == "" && len(opts.Renditions) == 0 {
+			opts.Mode = streaming.ModeTranscode
+		}
+	}
+	// The configured cap only applies to the transcoded streams, the one of the request gets the video transcoded
+	if dto.MaxFPS != nil {
+		opts.MaxFPS = *dto.MaxFPS
+		if opts.MaxFPS > 0 && dto.Mode == streaming.ModeCopy {
+			return opts, streaming.ErrCopyWithMaxFPS
+		}
+		if opts.MaxFPS > 0 && dto.Mode == "" && len(opts.Renditions) == 0 {
+			opts.Mode = streaming.ModeTranscode
+		}
+	}
+	if dto.Audio != "" {
+		opts.Audio = dto.Audio
+	}
+	if dto.AudioBitrate != "" {
+		opts.AudioBitrate = dto.AudioBitrate
+	}
+	if dto.Lazy != nil {
+		opts.Lazy = *dto.Lazy
+	}
+	if dto.IdleTimeout != nil {
+		opts.IdleTimeout = int(*dto.IdleTimeout)
+	}
+	if dto.Streak != nil {
+		if dto.Streak.HitLimit != nil {
+			opts.Streak.HitLimit = *dto.Streak.HitLimit
+		}
+		if dto.Streak.HotWait != nil {
+			opts.Streak.HotWait = int(*dto.Streak.HotWait)
+		}
+		if opts.Streak.HitLimit < 1 || opts.Streak.HotWait < 1 {
+			return opts, streaming.ErrInvalidStreak
+		}
+	}
+	if dto.Retry != nil {
+		policy := c.backoff()
+		if err := dto.Retry.apply(&policy); err != nil {
+			return opts, err
+		}
+		opts.Retry = &policy
+	}
+	if dto.Record != nil {
+		opts.Recording.Enabled = *dto.Record
+	}
+	// Recording always implies that the stream is recorded
+	if dto.RecordAlways != nil {
+		opts.Recording.Always = *dto.RecordAlways
+		opts.Recording.Enabled = opts.Recording.Enabled || opts.Recording.Always
+	}
+	if !opts.Recording.Enabled {
+		opts.Recording.Always = false
+	}
+	if dto.Format != "" {
+		opts.Format = dto.Format
+	}
+	if dto.Transport != "" {
+		opts.Transport = dto.Transport
+	}
+	if dto.Lifecycle != "" {
+		opts.Lifecycle = dto.Lifecycle
+	}
+	if dto.Activity != "" {
+		opts.Activity = dto.Activity
+	}
+	if dto.Loop != nil {
+		opts.Loop = *dto.Loop
+	}
+	opts.SDP = dto.SDP
+	if dto.DVRWindow != nil {
+		window, err := c.dvrWindow(*dto.DVRWindow)
+		if err != nil {
+			return opts, err
+		}
+		opts.DVRWindow = window
+	}
+	if dto.Priority != nil {
+		opts.Priority = *dto.Priority
+	}
+	if dto.Push != "" {
+		opts.Push = strings.TrimSpace(dto.Push)
+	}
+	// Audio-only streams are transcoded to AAC, the configured renditions of the video do not apply to them
+	if dto.AudioOnly != nil && *dto.AudioOnly {
+		opts.AudioOnly = true
+		if dto.Audio == "" {
+			opts.Audio = streaming.AudioAAC
+		}
+		if dto.Renditions == nil {
+			opts.Renditions = nil
+		}
+	}
+	// Arguments of the requests are passed to ffmpeg as they are
+	if len(dto.InputArgs) > 0 || len(dto.OutputArgs) > 0 {
+		if !c.spec().FFmpegUnsafeArgs {
+			return opts, ErrUnsafeArgsDisabled
+		}
+		opts.InputArgs = dto.InputArgs
+		opts.OutputArgs = dto.OutputArgs
+	}
+	if dto.LowLatency != nil && *dto.LowLatency {
+		if !c.spec().LLHLSEnabled {
+			return opts, ErrLowLatencyDisabled
+		}
+		opts.LowLatency = streaming.LowLatencyOptions{
+			Enabled:      true,
+			PartDuration: int(c.spec().LLHLSPartDuration / time.Millisecond),
+		}
+	}
+	// Keys and signatures are only added to the playlists written by the HLS muxer
+	if opts.UsesDASHMuxer() && (c.spec().Encryption.Enabled || c.spec().URLSigningEnabled) {
+		return opts, ErrDASHNotSupported
+	}
+	return opts, opts.Validate()
+}
+
+// applyProfile sets the requested profile on the options, or the default one if none was requested. Its settings
+// are the defaults of the stream, so the fields of the request override them. Profiles with video settings transcode
+// the stream, the configured renditions do not apply to them
+func (c *Controller) applyProfile(opts *streaming.Options, name string) error {
+	if name == "" {
+		name = c.spec().DefaultProfile
+	}
+	if name == "" {
+		return nil
+	}
+	// The profiles are validated with the configuration, so the entries can be parsed
+	profiles, _ := c.spec().ParseProfiles()
+	profile, ok := profiles[name]
+	if !ok {
+		return ErrUnknownProfile
+	}
+	opts.Profile = &profile
+	if profile.Audio != "" {
+		opts.Audio = profile.Audio
+	}
+	if profile.FPS != 0 {
+		opts.MaxFPS = profile.FPS
+	}
+	if profile.Device != "" {
+		opts.Device = profile.Device
+	}
+	if profile.Transcodes() {
+		opts.Mode = streaming.ModeTranscode
+		opts.Renditions = nil
+	}
+	return nil
+}
+
+// resolveSource probes the source if it is enabled, tracks are copied, it is served over HTTP or only its audio is streamed,
+// and checks if the copied tracks of the source can be carried by HLS. Incompatible tracks are rejected in strict mode or if
+// the copy was requested explicitly, otherwise they get transcoded. Audio-only streams are rejected if the source has no audio.
+// SRT listeners are never probed, the connection of the probe would take the place of the transcoding. Returns nil if the source was not probed
+func (c *Controller) resolveSource(ctx context.Context, uri string, opts *streaming.Options) (*streaming.SourceInfo, error) {
+	copying := opts.Mode == streaming.ModeCopy || opts.AudioMode() == streaming.AudioCopy
+	if !c.spec().Probe && !copying && !opts.AudioOnly && !streaming.IsHTTP(uri) {
+		return nil, nil
+	}
+	if streaming.IsSRTListener(uri) {
+		c.logger(ctx).Infof("%s is an SRT listener, it is not probed", streaming.RedactURI(uri))
+		return nil, nil
+	}
+	info, err := c.probeRetried(ctx, uri, opts)
+	if err != nil && c.spec().Probe {
+		return nil, err
+	}
+	if err != nil {
+		c.logger(ctx).Warnf("Codecs of the source could not be probed, copying them anyway || Error: %s", err)
+		return nil, nil
+	}
+	// The video of the audio-only streams is never used
+	if opts.AudioOnly {
+		if info.Audio == "" {
+			return nil, streaming.ErrNoAudioTrack
+		}
+		return &info, nil
+	}
+	// The JPEG frames cannot be carried by HLS, the automatic mode transcodes them instead of copying.
+	// The requested copies fall back to transcoding below like the other incompatible codecs
+	if info.Video == streaming.CodecMJPEG && opts.Mode != streaming.ModeCopy && opts.Mode != streaming.ModeTranscode && len(opts.Renditions) == 0 {
+		c.logger(ctx).Infof("%s video cannot be copied, it is transcoded", info.Video)
+		opts.Mode = streaming.ModeTranscode
+	}
+	if !copying {
+		return &info, nil
+	}
+	opts.SourceCodec = info.Video
+	if info.Audio != "" && opts.AudioMode() == streaming.AudioCopy && !streaming.IsCopyableAudio(info.Audio) {
+		if c.spec().CopyStrict || opts.Audio == streaming.AudioCopy {
+			return nil, streaming.ErrIncompatibleAudioFn(info.Audio)
+		}
+		c.logger(ctx).Warnf("%s audio cannot be copied, falling back to aac", info.Audio)
+		opts.Audio = streaming.AudioAAC
+	}
+	if opts.Mode != streaming.ModeCopy || streaming.IsCopyable(info.Video) {
+		return &info, nil
+	}
+	if c.spec().CopyStrict {
+		return nil, streaming.ErrIncompatibleCodecFn(info.Video)
+	}
+	c.logger(ctx).Warnf("%s video cannot be copied, falling back to transcoding", info.Video)
+	opts.Audio = opts.AudioMode()
+	opts.Mode = streaming.ModeTranscode
+	return &info, nil
+}
+
+// probe probes the source with the transport of the stream. The automatic transport tries UDP first
+// and falls back to TCP if UDP times out, the transport that answered is kept for the stream.
+// Sources that are not RTSP have no transport to choose
+func (c *Controller) probe(ctx context.Context, uri string, opts *streaming.Options) (streaming.SourceInfo, error) {
+	if opts.Transport != streaming.TransportAuto || !streaming.IsRTSP(uri) {
+		return c.processor.Probe(ctx, uri, *opts)
+	}
+	probed := *opts
+	probed.Transport = streaming.TransportUDP
+	info, err := c.processor.Probe(ctx, uri, probed)
+	if err == streaming.ErrProbeTimeout && ctx.Err() == nil {
+		c.logger(ctx).Infof("Probing %s over UDP timed out, retrying with TCP", streaming.RedactURI(uri))
+		probed.Transport = streaming.TransportTCP
+		info, err = c.processor.Probe(ctx, uri, probed)
+	}
+	if err == nil {
+		opts.Transport = probed.Transport
+	}
+	return info, err
+}
+
+// marshalValidateURI is for validiting that the URI is in a valid format, normalizing it
+// and marshaling it into the dto pointer. The body is limited to START_MAX_BODY_SIZE, returns the status to send the error with
+func (c *Controller) marshalValidatedURI(w http.ResponseWriter, r *http.Request, dto *StreamDto) (int, error) {
+	if status, err := decodeBody(w, r, int64(c.spec().StartMaxBodySize), dto); err != nil {
+		return status, err
+	}
+	normalized, err := c.sourceURI(dto)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	dto.URI = normalized
+	return http.StatusOK, nil
 }
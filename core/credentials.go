@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// CredentialsDto describes a username and a password the source is connected with if it refuses the ones of the stream
+type CredentialsDto struct {
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+}
+
+// fallbackSources returns the URIs of the source with the fallback credentials of the request followed by the configured ones,
+// in the order they are tried. Local sources have no credentials to fall back to
+func (c *Controller) fallbackSources(source string, fallbacks []CredentialsDto) ([]string, error) {
+	if streaming.IsLocal(source) {
+		if len(fallbacks) > 0 {
+			return nil, ErrInvalidSourceCredentials
+		}
+		return nil, nil
+	}
+	configured, err := c.spec().ParseFallbackCredentials()
+	if err != nil {
+		return nil, err
+	}
+	for _, credentials := range configured {
+		fallbacks = append(fallbacks, CredentialsDto{credentials.Username, credentials.Password})
+	}
+	uris := []string{}
+	for _, credentials := range fallbacks {
+		if credentials.Username == "" {
+			return nil, ErrInvalidSourceCredentials
+		}
+		uri, _, _ := joinCredentials(source, credentials.Username, credentials.Password)
+		uris = append(uris, uri)
+	}
+	return uris, nil
+}
+
+// resolveFallbacks probes the source refusing the credentials of the stream with its fallback credentials in order, until one of them
+// is accepted. Returns the URI with the accepted credentials, the fallbacks left are kept in the options for the later failures
+func (c *Controller) resolveFallbacks(ctx context.Context, dir string, opts *streaming.Options) (string, *streaming.SourceInfo, error) {
+	for len(opts.Fallbacks) > 0 && ctx.Err() == nil {
+		uri := opts.Fallbacks[0]
+		opts.Fallbacks = opts.Fallbacks[1:]
+		c.logger(ctx).Warnf("%s refused the credentials, trying the next ones", dir)
+		source, err := c.resolveSource(ctx, uri, opts)
+		if err != streaming.ErrSourceAuthFailed {
+			return uri, source, err
+		}
+	}
+	return "", nil, streaming.ErrSourceAuthFailed
+}
+
+// rotateCredentials switches the stream refused by its source to its next fallback credentials, so it is restarted with them right away.
+// Once none is left, the stream is marked as errored instead of being restarted, as the repeated failures lock the accounts of many cameras
+func (c *Controller) rotateCredentials(id string, strm *streaming.Stream) bool {
+	if strm.NextCredentials() {
+		c.streamLog(strm).Warnf("%s refused the credentials, restarting with the next ones", id)
+		return true
+	}
+	c.streamLog(strm).Errorf("%s is errored, the source refused the credentials", id)
+	strm.FailAuth()
+	c.publish(events.Errored, id, strm, streaming.ErrSourceAuthFailed.Error())
+	c.persist()
+	return false
+}
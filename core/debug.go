@@ -0,0 +1,178 @@
+package core
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// debugLogLines is the number of the last lines of the output of the processes shown by GET /admin/debug,
+// the rest is left to GET /stream/:id/logs
+const debugLogLines = 20
+
+// DebugVarsDto describes the variables of the service published next to the expvar ones under rtspStream
+type DebugVarsDto struct {
+	Streams       int    `json:"streams"`
+	ActiveStreams int    `json:"activeStreams"`
+	Goroutines    int    `json:"goroutines"`
+	StartRequests uint64 `json:"startRequests"`
+	StartFailures uint64 `json:"startFailures"`
+	CleanupRuns   uint64 `json:"cleanupRuns"`
+	Restarts      uint64 `json:"restarts"`
+}
+
+// AdminDebugDto describes the effective configuration and the transcoding processes of the streams, served by GET /admin/debug
+type AdminDebugDto struct {
+	// Config is the effective configuration keyed by the environment variables, the secrets are redacted
+	Config  map[string]interface{}    `json:"config"`
+	Streams map[string]StreamDebugDto `json:"streams"`
+}
+
+// StreamDebugDto describes the transcoding process of a stream for GET /admin/debug
+type StreamDebugDto struct {
+	// Command is the command line the last process was started with, the credentials are redacted. Empty if it was never started
+	Command          []string   `json:"command,omitempty"`
+	Pid              int        `json:"pid,omitempty"` // 0 if the process is not running
+	ProcessStartedAt *time.Time `json:"processStartedAt,omitempty"`
+	Restarts         int        `json:"restarts"`
+	Errored          bool       `json:"errored"`
+	// LastError is the error of the last unexpected exit of the process and LastErrorAt the time of the exit
+	LastError   string                 `json:"lastError,omitempty"`
+	LastErrorAt *time.Time             `json:"lastErrorAt,omitempty"`
+	Directory   string                 `json:"directory"`
+	Watchdog    WatchdogDto            `json:"watchdog"`
+	Streak      streaming.StreakStatus `json:"streak"`
+	// Logs are the last lines of the output of the process, LogsNote tells how many earlier lines were left out
+	Logs     []string `json:"logs"`
+	LogsNote string   `json:"logsNote,omitempty"`
+}
+
+// WatchdogDto describes the watchdog restarting the stalled transcoding process of a stream
+type WatchdogDto struct {
+	StallTimeout  int        `json:"stallTimeout"` // Seconds the process can go without writing a segment, 0 if it is not watched
+	StallRestarts int        `json:"stallRestarts"`
+	LastOutputAt  *time.Time `json:"lastOutputAt,omitempty"`
+}
+
+// DebugHandler returns the debug endpoints of the controller, so they can be served on their own listener.
+// They are protected like the other management routes, with the admin permission
+func (c *Controller) DebugHandler() http.Handler {
+	router := httprouter.New()
+	c.debugRoutes(router)
+	return router
+}
+
+// debugRoutes registers the pprof profiles and the expvar variables on the router
+func (c *Controller) debugRoutes(router *httprouter.Router) {
+	debug := func(handle httprouter.Handle) httprouter.Handle {
+		return withMiddlewares(c.middlewares.all, c.withAccess(false, c.withBasicAuth(false, c.withAPIKey("admin", false, handle))))
+	}
+	router.GET("/debug/vars", debug(c.VarsHandler))
+	router.GET("/debug/pprof/*profile", debug(c.PprofHandler))
+	router.POST("/debug/pprof/*profile", debug(c.PprofHandler))
+}
+
+// PprofHandler is the HTTP handler of the /debug/pprof calls, serving the profiles of the runtime
+func (c *Controller) PprofHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	switch strings.Trim(ps.ByName("profile"), "/") {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		// The index serves the named profiles as well, like /debug/pprof/goroutine
+		pprof.Index(w, r)
+	}
+}
+
+// VarsHandler is the HTTP handler of the /debug/vars call, serving the expvar variables and the ones of the service
+func (c *Controller) VarsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	totals := c.metrics.Totals()
+	b, _ := json.Marshal(DebugVarsDto{
+		len(c.snapshotStreams()),
+		c.activeStreams(),
+		runtime.NumGoroutine(),
+		totals.StartRequests,
+		totals.StartFailures,
+		totals.CleanupRuns,
+		totals.Restarts,
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	// Written like the handler of expvar, the variables of the service are not published globally
+	// since more than one controller can be created in a process
+	fmt.Fprintf(w, "{\n%q: %s", "rtspStream", b)
+	expvar.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, ",\n%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+// AdminDebugHandler is the HTTP handler of the GET /admin/debug call, describing the effective configuration
+// and the transcoding processes of the streams, so the service can be looked into remotely
+func (c *Controller) AdminDebugHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	dto := AdminDebugDto{Config: c.spec().Settings(), Streams: map[string]StreamDebugDto{}}
+	now := c.now()
+	for id, strm := range c.snapshotStreams() {
+		dto.Streams[id] = debugStream(strm, now)
+	}
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// debugStream describes the transcoding process of the stream at the given time
+func debugStream(strm *streaming.Stream, now time.Time) StreamDebugDto {
+	dto := StreamDebugDto{
+		Pid:     strm.Pid(),
+		Errored: strm.IsErrored(),
+		Streak:  strm.StreakStatus(now),
+		Logs:    []string{},
+	}
+	if output := strm.LastOutputAt(); !output.IsZero() {
+		dto.Watchdog.LastOutputAt = &output
+	}
+	if strm.Logs != nil {
+		lines := strm.Logs.Lines()
+		if len(lines) > debugLogLines {
+			dto.LogsNote = fmt.Sprintf("truncated, %d earlier lines are served by /stream/:id/logs", len(lines)-debugLogLines)
+			lines = lines[len(lines)-debugLogLines:]
+		}
+		dto.Logs = lines
+	}
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	dto.Command = strm.Command
+	dto.Restarts, dto.Directory = strm.Restarts, strm.StorePath
+	dto.Watchdog.StallTimeout, dto.Watchdog.StallRestarts = int(strm.StallTimeout/time.Second), strm.StallRestarts
+	if !strm.ProcessStartedAt.IsZero() {
+		started := strm.ProcessStartedAt
+		dto.ProcessStartedAt = &started
+	}
+	if strm.LastError != "" {
+		lastErrorAt := strm.LastErrorAt
+		dto.LastError, dto.LastErrorAt = strm.LastError, &lastErrorAt
+	}
+	return dto
+}
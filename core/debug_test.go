@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	serve := func(handler http.Handler, path, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			r.Header.Set(auth.APIKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	t.Run("Should not serve the debug endpoints by default", func(t *testing.T) {
+		ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		assert.Equal(t, http.StatusNotFound, serve(ctrls.Handler(), "/debug/vars", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(ctrls.Handler(), "/debug/pprof/", "").Code)
+	})
+
+	t.Run("Should only serve the debug endpoints on their own listener if the address is set", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.DebugEndpoint = true
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		assert.Equal(t, http.StatusNotFound, serve(ctrls.Handler(), "/debug/vars", "").Code)
+		assert.Equal(t, http.StatusOK, serve(ctrls.DebugHandler(), "/debug/vars", "").Code)
+	})
+
+	t.Run("Should serve the profiles and the variables of the service", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.DebugEndpoint, conf.DebugAddress = true, ""
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		ctrls.streams[generated.dirPath] = &generated.strm
+		ctrls.metrics.CleanupRan()
+		ctrls.metrics.Restarted(generated.dirPath)
+
+		rr := serve(ctrls.Handler(), "/debug/vars", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var vars map[string]json.RawMessage
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &vars))
+		assert.Contains(t, vars, "memstats")
+		var dto DebugVarsDto
+		assert.Nil(t, json.Unmarshal(vars["rtspStream"], &dto))
+		assert.Equal(t, 1, dto.Streams)
+		assert.Equal(t, uint64(1), dto.CleanupRuns)
+		assert.Equal(t, uint64(1), dto.Restarts)
+		assert.True(t, dto.Goroutines > 0)
+
+		rr = serve(ctrls.Handler(), "/debug/pprof/", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "goroutine")
+		rr = serve(ctrls.Handler(), "/debug/pprof/goroutine?debug=1", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "goroutine profile")
+		assert.Equal(t, http.StatusOK, serve(ctrls.Handler(), "/debug/pprof/cmdline", "").Code)
+	})
+
+	t.Run("Should describe the configuration and the processes of the streams", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.JWTSecret = "secret"
+		conf.APIKeys = []string{"ops:0ps:admin"}
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		startedAt := time.Now().Add(-time.Minute).UTC()
+		generated.strm.Command = []string{"ffmpeg", "-i", "rtsp://***@192.168.0.1/live"}
+		generated.strm.ProcessStartedAt = startedAt
+		generated.strm.Restarts, generated.strm.LastError, generated.strm.LastErrorAt = 2, "exit status 1", startedAt
+		generated.strm.StallTimeout = 30 * time.Second
+		generated.strm.Logs = streaming.NewLogBuffer(100, "", false)
+		for i := 0; i < debugLogLines+5; i++ {
+			generated.strm.Logs.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		}
+		ctrls.setStream(generated.dirPath, &generated.strm)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(ctrls.Handler(), "/admin/debug", "").Code)
+		rr := serve(ctrls.Handler(), "/admin/debug", "0ps")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.False(t, strings.Contains(rr.Body.String(), "0ps:admin"))
+		var dto AdminDebugDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &dto))
+		assert.Equal(t, "***", dto.Config["RTSP_STREAM_AUTH_JWT_SECRET"])
+		assert.Equal(t, "***", dto.Config["RTSP_STREAM_AUTH_API_KEYS"])
+		assert.Equal(t, float64(8080), dto.Config["RTSP_STREAM_PORT"])
+		stream, ok := dto.Streams[generated.dirPath]
+		if assert.True(t, ok) {
+			assert.Equal(t, generated.strm.Command, stream.Command)
+			assert.Equal(t, startedAt.Unix(), stream.ProcessStartedAt.Unix())
+			assert.Equal(t, 2, stream.Restarts)
+			assert.Equal(t, "exit status 1", stream.LastError)
+			assert.Equal(t, generated.strm.StorePath, stream.Directory)
+			assert.Equal(t, 30, stream.Watchdog.StallTimeout)
+			assert.Len(t, stream.Logs, debugLogLines)
+			assert.Equal(t, fmt.Sprintf("line %d", debugLogLines+4), stream.Logs[debugLogLines-1])
+			assert.Equal(t, "truncated, 5 earlier lines are served by /stream/:id/logs", stream.LogsNote)
+		}
+		// It is served with the admin endpoints, not with the debug ones
+		assert.Equal(t, http.StatusNotFound, serve(ctrls.DebugHandler(), "/admin/debug", "0ps").Code)
+	})
+
+	t.Run("Should require the admin permission", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.DebugEndpoint = true
+		conf.APIKeys = []string{"dashboard:d4sh:list", "ops:0ps:admin"}
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		assert.Equal(t, http.StatusUnauthorized, serve(ctrls.DebugHandler(), "/debug/vars", "").Code)
+		assert.Equal(t, http.StatusForbidden, serve(ctrls.DebugHandler(), "/debug/pprof/", "d4sh").Code)
+		assert.Equal(t, http.StatusOK, serve(ctrls.DebugHandler(), "/debug/pprof/", "0ps").Code)
+		assert.Equal(t, http.StatusForbidden, serve(ctrls.Handler(), "/admin/debug", "d4sh").Code)
+		assert.Equal(t, http.StatusOK, serve(ctrls.Handler(), "/admin/debug", "0ps").Code)
+	})
+
+	t.Run("Should run the middlewares of every route", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.DebugEndpoint = true
+		called := false
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()), WithMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				next.ServeHTTP(w, r)
+			})
+		}))
+		defer ctrls.Shutdown(context.Background())
+		assert.Equal(t, http.StatusOK, serve(ctrls.DebugHandler(), "/debug/vars", "").Code)
+		assert.True(t, called)
+	})
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// DeviceLeastLoaded is the assignment putting the new streams on the device encoding the fewest streams
+const DeviceLeastLoaded = "least-loaded"
+
+// DeviceFallbackSoftware is the policy encoding the streams of full devices in software instead of on the next device
+const DeviceFallbackSoftware = "software"
+
+// checkDevice checks if the device requested for the stream is one of the configured devices
+func (c *Controller) checkDevice(device string) error {
+	if c.spec().Accel == streaming.AccelNone {
+		return ErrDeviceWithoutHardware
+	}
+	if !c.spec().HasDevice(device) {
+		return ErrUnknownDevice
+	}
+	return nil
+}
+
+// deviceSessions returns the number of running accelerated streams of every device
+func (c *Controller) deviceSessions() map[string]int {
+	sessions := map[string]int{}
+	for _, strm := range c.snapshotStreams() {
+		strm.Mux.RLock()
+		if strm.Streak.IsActive() && strm.Options.UsesHardware() {
+			sessions[strm.Options.Device]++
+		}
+		strm.Mux.RUnlock()
+	}
+	return sessions
+}
+
+// assignDevice picks the device the accelerated video of the stream is encoded on. The requested device is tried first,
+// then the devices in the configured order, or starting with the least loaded one. A device encoding its maximum number of
+// streams is skipped for the next one, unless the policy falls back to software, which is used once every device is full
+func (c *Controller) assignDevice(ctx context.Context, dir string, opts *streaming.Options) {
+	if !opts.UsesHardware() {
+		opts.Device = ""
+		return
+	}
+	hardware := c.spec().Hardware
+	sessions := c.deviceSessions()
+	devices := hardware.HardwareDevices()
+	if hardware.DeviceAssignment == DeviceLeastLoaded {
+		sort.SliceStable(devices, func(i, j int) bool {
+			return sessions[devices[i]] < sessions[devices[j]]
+		})
+	}
+	if opts.Device != "" {
+		candidates := []string{opts.Device}
+		for _, device := range devices {
+			if device != opts.Device {
+				candidates = append(candidates, device)
+			}
+		}
+		devices = candidates
+	}
+	for i, device := range devices {
+		if hardware.DeviceMaxSessions == 0 || sessions[device] < hardware.DeviceMaxSessions {
+			if i > 0 {
+				c.logger(ctx).Warnf("%s is moved to the %s device, %s is full", dir, device, devices[0])
+			}
+			opts.Device = device
+			return
+		}
+		if hardware.DeviceFallback == DeviceFallbackSoftware {
+			break
+		}
+	}
+	c.logger(ctx).Warnf("%s is encoded in software, the %s devices are full", dir, opts.HardwareAccel)
+	opts.HardwareAccel = streaming.AccelNone
+	opts.Device = ""
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestAssignDevice(t *testing.T) {
+	tt := []struct {
+		Assignment  string
+		MaxSessions int
+		Fallback    string
+		Running     []string
+		Mode        string
+		Requested   string
+		Accel       string
+		Device      string
+	}{
+		{Assignment: "first", Running: []string{"0", "0"}, Accel: streaming.AccelNVENC, Device: "0"},
+		{Assignment: DeviceLeastLoaded, Running: []string{"0", "0", "1"}, Accel: streaming.AccelNVENC, Device: "1"},
+		{Assignment: DeviceLeastLoaded, Running: []string{"1", "0"}, Accel: streaming.AccelNVENC, Device: "0"},
+		{Assignment: "first", Running: []string{"1"}, Requested: "1", Accel: streaming.AccelNVENC, Device: "1"},
+		{Assignment: "first", MaxSessions: 2, Fallback: "next", Running: []string{"0", "0"}, Accel: streaming.AccelNVENC, Device: "1"},
+		{Assignment: "first", MaxSessions: 2, Fallback: DeviceFallbackSoftware, Running: []string{"0", "0"}, Accel: streaming.AccelNone},
+		{Assignment: DeviceLeastLoaded, MaxSessions: 1, Fallback: "next", Running: []string{"0", "1"}, Accel: streaming.AccelNone},
+		{Assignment: "first", MaxSessions: 1, Fallback: "next", Running: []string{"1"}, Requested: "1", Accel: streaming.AccelNVENC, Device: "0"},
+		{Assignment: "first", Running: []string{}, Mode: streaming.ModeCopy, Requested: "1", Accel: streaming.AccelNVENC},
+	}
+	for i, testCase := range tt {
+		conf := config.InitConfig()
+		conf.Accel = streaming.AccelNVENC
+		conf.Devices = []string{"0", "1"}
+		conf.DeviceAssignment = testCase.Assignment
+		conf.DeviceMaxSessions = testCase.MaxSessions
+		conf.DeviceFallback = testCase.Fallback
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		for _, device := range testCase.Running {
+			generated := generateStream(nil, "")
+			generated.strm.Options = streaming.Options{HardwareAccel: streaming.AccelNVENC, Mode: streaming.ModeTranscode, Device: device}
+			generated.strm.Streak.Activate()
+			ctrls.streams[generated.dirPath] = &generated.strm
+		}
+		// The stopped streams do not take a session of their device
+		stopped := generateStream(nil, "")
+		stopped.strm.Options = streaming.Options{HardwareAccel: streaming.AccelNVENC, Mode: streaming.ModeTranscode, Device: "1"}
+		ctrls.streams[stopped.dirPath] = &stopped.strm
+
+		mode := testCase.Mode
+		if mode == "" {
+			mode = streaming.ModeTranscode
+		}
+		opts := streaming.Options{HardwareAccel: streaming.AccelNVENC, Mode: mode, Device: testCase.Requested}
+		ctrls.assignDevice(context.Background(), "id", &opts)
+		if !assert.Equal(t, testCase.Accel, opts.HardwareAccel) || !assert.Equal(t, testCase.Device, opts.Device) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestAssignDevice", i))
+		}
+	}
+}
+
+func TestStartOnDevice(t *testing.T) {
+	setup := func(accel string) (*Controller, *httptest.Server) {
+		spawned := int32(0)
+		conf := config.InitConfig()
+		conf.Accel = accel
+		conf.Mode = streaming.ModeTranscode
+		conf.Devices = []string{"/dev/dri/renderD128", "/dev/dri/renderD129"}
+		conf.DeviceAssignment = DeviceLeastLoaded
+		conf.Profiles = []string{"second:device=/dev/dri/renderD129"}
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{spawned: &spawned}
+		router := httprouter.New()
+		router.POST("/start", ctrls.StartStreamHandler)
+		router.GET("/status/:id", ctrls.StatusHandler)
+		return ctrls, httptest.NewServer(router)
+	}
+	start := func(server *httptest.Server, dto StreamDto) (int, string, string) {
+		b, _ := json.Marshal(dto)
+		res, err := http.Post(fmt.Sprintf("%s/start", server.URL), "application/json", bytes.NewBuffer(b))
+		assert.Nil(t, err)
+		var errDto ErrorDto
+		json.NewDecoder(res.Body).Decode(&errDto)
+		id, _ := streaming.GetURIDirectory(dto.URI)
+		return res.StatusCode, errDto.Error.Code, id
+	}
+	status := func(server *httptest.Server, id string) StatusDto {
+		res, err := http.Get(fmt.Sprintf("%s/status/%s", server.URL, id))
+		assert.Nil(t, err)
+		var dto StatusDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&dto))
+		return dto
+	}
+
+	t.Run("Should spread the streams across the devices", func(t *testing.T) {
+		ctrls, server := setup(streaming.AccelVAAPI)
+		defer server.Close()
+		defer ctrls.Shutdown(context.Background())
+		devices := []string{}
+		for _, dto := range []StreamDto{{URI: generateURI()}, {URI: generateURI()}, {URI: generateURI(), Device: "/dev/dri/renderD128"}} {
+			code, _, id := start(server, dto)
+			assert.Equal(t, http.StatusOK, code)
+			devices = append(devices, status(server, id).Device)
+			strm, _ := ctrls.getStream(id)
+			assert.Equal(t, devices[len(devices)-1], strm.Options.Device)
+		}
+		assert.Equal(t, []string{"/dev/dri/renderD128", "/dev/dri/renderD129", "/dev/dri/renderD128"}, devices)
+
+		code, _, id := start(server, StreamDto{URI: generateURI(), Profile: "second"})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "/dev/dri/renderD129", status(server, id).Device)
+	})
+
+	t.Run("Should refuse the devices that cannot be used", func(t *testing.T) {
+		tt := []struct {
+			Accel  string
+			Device string
+			Code   string
+		}{
+			{Accel: streaming.AccelVAAPI, Device: "/dev/dri/renderD130", Code: "unknown_device"},
+			{Accel: streaming.AccelNone, Device: "/dev/dri/renderD128", Code: "invalid_options"},
+		}
+		for i, testCase := range tt {
+			ctrls, server := setup(testCase.Accel)
+			status, code, _ := start(server, StreamDto{URI: generateURI(), Device: testCase.Device})
+			if !assert.Equal(t, http.StatusBadRequest, status) || !assert.Equal(t, testCase.Code, code) {
+				t.Error(fmt.Errorf("%d testcase is failing for refusing the devices", i))
+			}
+			server.Close()
+			ctrls.Shutdown(context.Background())
+		}
+	})
+}
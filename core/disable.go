@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+)
+
+// DisableHandler is the HTTP handler of the POST /stream/:id/disable call, which switches the stream off until it is enabled,
+// like the seasonal cameras. The transcoding and the recording are stopped, the registration, the alias, the metadata and the files are kept.
+// Disabled streams are not restarted by their clients, by the cleanup, by the watchdog or after crashes, and they cannot be resumed.
+// Disabling a disabled stream does nothing
+func (c *Controller) DisableHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if !strm.IsDisabled() {
+		if !c.restarting.begin(id) {
+			c.SendError(w, ErrStreamAlreadyActive, http.StatusConflict)
+			return
+		}
+		defer c.restarting.end(id)
+		c.logger(r.Context()).Infof("%s is getting disabled%s", id, requestedBy(apiKeyName(r)))
+		// The stream is marked first, so its clients cannot restart it while its process is stopped
+		strm.Disable()
+		if err := strm.StopRecording(); err != nil {
+			c.logger(r.Context()).Error(err)
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), c.spec().ShutdownGrace)
+		defer cancel()
+		if err := strm.Stop(ctx, true); err != nil {
+			c.logger(r.Context()).Error(err)
+		}
+		c.metrics.RemoveStream(id)
+		c.publishBy(r.Context(), events.Disabled, id, strm, "")
+		c.persist()
+	}
+	b, _ := json.Marshal(c.streamDto(r.Context(), strm, id))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// EnableHandler is the HTTP handler of the POST /stream/:id/enable call, which returns the disabled stream to its lifecycle.
+// It is started by the next request of its playlist, or right away with ?start=true. Enabling a stream that is not disabled does nothing
+func (c *Controller) EnableHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	start := false
+	if value := r.URL.Query().Get("start"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.SendError(w, ErrInvalidStart, http.StatusBadRequest)
+			return
+		}
+		start = parsed
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if strm.IsDisabled() {
+		if !c.restarting.begin(id) {
+			c.SendError(w, ErrStreamAlreadyActive, http.StatusConflict)
+			return
+		}
+		defer c.restarting.end(id)
+		c.logger(r.Context()).Infof("%s is getting enabled%s", id, requestedBy(apiKeyName(r)))
+		if !start {
+			strm.ResetErrored()
+			strm.SetPaused(false)
+			c.publishBy(r.Context(), events.Enabled, id, strm, "")
+		} else {
+			if !c.spawns.enter() {
+				c.SendError(w, ErrStoppingAll, http.StatusServiceUnavailable)
+				return
+			}
+			defer c.spawns.leave()
+			if err := c.resume(r.Context(), id, strm, events.Enabled); err != nil {
+				c.logger(r.Context()).Error(err)
+				c.SendError(w, ErrRestartFailed, http.StatusInternalServerError)
+				return
+			}
+			if !strm.Options.Lazy {
+				c.waitForPlaylist(strm)
+			}
+		}
+		c.persist()
+	}
+	b, _ := json.Marshal(c.streamDto(r.Context(), strm, id))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
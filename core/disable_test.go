@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/store"
+)
+
+func TestDisable(t *testing.T) {
+	setup := func(t *testing.T) (*testServer, *int32) {
+		spawned := int32(0)
+		s := newTestServer(t, func(conf *config.Specification) {
+			conf.Persistence = config.Persistence{Enabled: true, Path: filepath.Join(conf.StoreDir, "state", "streams.json"), PersistenceKey: persistenceKey}
+		}, mockProcessor{spawned: &spawned}, func(router *httprouter.Router, ctrls *Controller) {
+			router.POST("/restart/:id", ctrls.RestartHandler)
+			router.GET("/stream/*filepath", ctrls.FileHandler)
+			router.POST("/resume/:id", ctrls.ResumeHandler)
+			router.POST("/disable/:id", ctrls.DisableHandler)
+			router.POST("/enable/:id", ctrls.EnableHandler)
+		})
+		return s, &spawned
+	}
+	start := func(s *testServer) StreamDto {
+		status, dto, _ := s.start(t, "", StreamDto{URI: generateURI(), Alias: "pool", Metadata: map[string]string{"area": "pool"}})
+		assert.Equal(t, http.StatusOK, status)
+		s.writePlaylist(t, dto.ID)
+		return dto
+	}
+	list := func(s *testServer) SummariseDto {
+		dto := s.list(t)
+		if !assert.Len(t, dto, 1) {
+			return SummariseDto{}
+		}
+		return dto[0]
+	}
+
+	t.Run("Should keep the disabled streams switched off until they are enabled", func(t *testing.T) {
+		s, spawned := setup(t)
+		defer s.close()
+		sub := s.ctrls.events.Subscribe()
+		defer s.ctrls.events.Unsubscribe(sub)
+		dto := start(s)
+		strm, _ := s.ctrls.getStream(dto.ID)
+		started := atomic.LoadInt32(spawned)
+
+		status, _ := s.post(t, "/disable/pool")
+		assert.Equal(t, http.StatusOK, status)
+		summary := list(s)
+		assert.True(t, summary.Disabled)
+		assert.False(t, summary.Running)
+		assert.Equal(t, "pool", summary.ID)
+		assert.Equal(t, map[string]string{"area": "pool"}, summary.Metadata)
+		assert.Equal(t, 0, s.ctrls.activeStreams())
+
+		// Neither the clients, the cleanup nor the restarts start the disabled stream again
+		res, err := http.Get(fmt.Sprintf("%s/stream/pool/index.m3u8", s.server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+		s.ctrls.cleanUnused()
+		tt := []struct {
+			Path string
+		}{
+			{Path: "/restart/pool"},
+			{Path: "/resume/pool"},
+		}
+		for i, testCase := range tt {
+			status, code := s.post(t, testCase.Path)
+			if !assert.Equal(t, http.StatusConflict, status) || !assert.Equal(t, "stream_disabled", code) {
+				t.Error(fmt.Errorf("%d testcase is failing for refusing the disabled streams", i))
+			}
+		}
+		assert.Equal(t, started, atomic.LoadInt32(spawned))
+		_, err = os.Stat(filepath.Join(s.dir, dto.ID, "index.m3u8"))
+		assert.Nil(t, err)
+
+		// The enabled stream is started by the next request of its playlist
+		status, _ = s.post(t, "/enable/pool")
+		assert.Equal(t, http.StatusOK, status)
+		assert.False(t, list(s).Disabled)
+		assert.False(t, strm.IsPaused())
+		assert.Equal(t, started, atomic.LoadInt32(spawned))
+		res, err = http.Get(fmt.Sprintf("%s/stream/pool/index.m3u8", s.server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, started+1, atomic.LoadInt32(spawned))
+		assert.True(t, strm.Streak.IsActive())
+
+		received := []events.Type{}
+		for len(received) < 4 {
+			event := <-sub.Events()
+			received = append(received, event.Type)
+		}
+		assert.Equal(t, []events.Type{events.Started, events.Disabled, events.Enabled, events.Restarted}, received)
+	})
+
+	t.Run("Should start the enabled stream right away if it is asked to", func(t *testing.T) {
+		s, spawned := setup(t)
+		defer s.close()
+		dto := start(s)
+		strm, _ := s.ctrls.getStream(dto.ID)
+		started := atomic.LoadInt32(spawned)
+		tt := []struct {
+			Path     string
+			Status   int
+			Disabled bool
+		}{
+			{Path: "/enable/pool", Status: http.StatusOK, Disabled: false},
+			{Path: "/disable/pool", Status: http.StatusOK, Disabled: true},
+			{Path: "/disable/pool", Status: http.StatusOK, Disabled: true},
+			{Path: "/enable/pool?start=maybe", Status: http.StatusBadRequest, Disabled: true},
+			{Path: "/disable/unknown", Status: http.StatusNotFound, Disabled: true},
+			{Path: "/enable/unknown", Status: http.StatusNotFound, Disabled: true},
+			{Path: "/enable/pool?start=true", Status: http.StatusOK, Disabled: false},
+		}
+		for i, testCase := range tt {
+			status, _ := s.post(t, testCase.Path)
+			if !assert.Equal(t, testCase.Status, status) || !assert.Equal(t, testCase.Disabled, list(s).Disabled) {
+				t.Error(fmt.Errorf("%d testcase is failing for disabling and enabling the streams", i))
+			}
+		}
+		assert.Equal(t, started+1, atomic.LoadInt32(spawned))
+		assert.True(t, strm.Streak.IsActive())
+	})
+
+	t.Run("Should keep the streams disabled across restarts of the service", func(t *testing.T) {
+		s, _ := setup(t)
+		defer s.close()
+		dto := start(s)
+		s.post(t, "/disable/pool")
+		records, err := newStore(s.ctrls.spec().Persistence).Load()
+		assert.Nil(t, err)
+		if assert.Len(t, records, 1) {
+			assert.True(t, records[0].Disabled)
+			assert.Equal(t, "pool", records[0].ID)
+		}
+		conf := *s.ctrls.spec()
+		s.ctrls.Shutdown(context.Background())
+
+		// Even the streams stored as running stay disabled
+		records[0].Running, records[0].Directory = true, filepath.Join(s.dir, dto.ID)
+		assert.Nil(t, newStore(conf.Persistence).Save([]store.Record{records[0]}))
+		conf.Resume = true
+		recovered := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		recovered.processor = mockProcessor{}
+		defer recovered.Shutdown(context.Background())
+		recovered.recoverStreams()
+		strm, ok := recovered.getStream(recovered.resolveID("pool"))
+		if assert.True(t, ok) {
+			assert.True(t, strm.IsDisabled())
+			assert.True(t, strm.IsPaused())
+			assert.False(t, strm.Streak.IsActive())
+			assert.Equal(t, map[string]string{"area": "pool"}, strm.Metadata)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/onvif"
+)
+
+// DiscoveredDto describes a camera found by the discovery, with the result of its start if the cameras were started
+type DiscoveredDto struct {
+	onvif.Camera
+	Start *BatchResultDto `json:"start,omitempty"`
+}
+
+// credentials returns the credentials the cameras are queried with, the ones of the body are used over the configured ones
+func (c *Controller) credentials(body []byte) (onvif.Credentials, error) {
+	creds := onvif.Credentials{Username: c.spec().DiscoveryUsername, Password: c.spec().DiscoveryPassword}
+	if len(body) == 0 {
+		return creds, nil
+	}
+	var given onvif.Credentials
+	if err := json.Unmarshal(body, &given); err != nil {
+		return onvif.Credentials{}, err
+	}
+	if given.Username != "" {
+		return given, nil
+	}
+	return creds, nil
+}
+
+// withCredentials adds the credentials to the stream URI of the camera, unless it carries its own already
+func withCredentials(uri string, creds onvif.Credentials) string {
+	u, err := url.Parse(uri)
+	if err != nil || creds.Username == "" || u.User != nil {
+		return uri
+	}
+	u.User = url.UserPassword(creds.Username, creds.Password)
+	return u.String()
+}
+
+// DiscoverHandler is the HTTP handler of the GET and POST /discover calls. It finds the ONVIF cameras of the local
+// network and their stream URIs within DISCOVERY_TIMEOUT, the cameras are queried with the credentials of the body
+// or the configured ones. With start=true the cameras are started like a batch, with the stream URI of their first profile
+func (c *Controller) DiscoverHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	start := false
+	if value := r.URL.Query().Get("start"); value != "" {
+		var err error
+		if start, err = strconv.ParseBool(value); err != nil {
+			c.SendError(w, ErrInvalidStart, http.StatusBadRequest)
+			return
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	creds, err := c.credentials(body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	// The probes of concurrent discoveries would be answered twice by the same cameras, so only one runs at a time
+	if !atomic.CompareAndSwapInt32(&c.discovering, 0, 1) {
+		c.SendError(w, ErrDiscoveryRunning, http.StatusConflict)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), c.spec().DiscoveryTimeout)
+	cameras, err := c.discoverer.Discover(ctx, creds)
+	cancel()
+	atomic.StoreInt32(&c.discovering, 0)
+	if err != nil {
+		c.logger(r.Context()).Errorf("Cameras could not be discovered: %s", err)
+		c.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+	c.logger(r.Context()).Infof("%d cameras are discovered%s", len(cameras), requestedBy(apiKeyName(r)))
+
+	results := make([]DiscoveredDto, len(cameras))
+	entries := []StreamDto{}
+	started := []int{}
+	for i, camera := range cameras {
+		results[i] = DiscoveredDto{camera, nil}
+		if start && camera.RTSPURI != "" {
+			entries = append(entries, StreamDto{URI: withCredentials(camera.RTSPURI, creds)})
+			started = append(started, i)
+		}
+	}
+	status := http.StatusOK
+	if len(entries) > 0 {
+		var batch []BatchResultDto
+		batch, status = c.startBatch(r, entries)
+		for j, i := range started {
+			results[i].Start = &batch[j]
+		}
+	}
+	b, _ := json.Marshal(results)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
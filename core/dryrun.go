@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// isDryRun indicates if the start only validates the stream, requested either by the dryRun query parameter or by the body
+func isDryRun(r *http.Request, dto StreamDto) (bool, error) {
+	value := r.URL.Query().Get("dryRun")
+	if value == "" {
+		return dto.DryRun, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, ErrInvalidDryRun
+	}
+	return dryRun || dto.DryRun, nil
+}
+
+// dryRun checks the start of the stream like a real start does and probes its source, without spawning a process or registering
+// anything, so no directory or state is left behind. The limits of the starts are checked, but the start does not count against them.
+// Returns the stream the start would create, or the error the start would fail with
+func (c *Controller) dryRun(ctx context.Context, dto StreamDto, canonical, dir, source string, opts streaming.Options) startResult {
+	fail := func(status int, err error) startResult {
+		return startResult{StreamDto{}, status, err, 0}
+	}
+	stream, known := c.getStream(dir)
+	// The alias could be held by the stream of another source
+	if known && dto.Alias != "" && !c.hasAlias(dir, canonical) {
+		known = false
+	}
+	running := known && stream.Streak.IsActive()
+	if !running {
+		if c.isStoreFull() {
+			return fail(http.StatusInsufficientStorage, ErrStorageFull)
+		}
+		if !c.fitsDVRWindow(opts) {
+			return fail(http.StatusInsufficientStorage, ErrDVRWindowTooLarge)
+		}
+	}
+	if !known {
+		var err error
+		if opts.Layout, err = c.layout(canonical, dir, dto.Metadata); err != nil {
+			return fail(http.StatusBadRequest, ErrInvalidLayout)
+		}
+		if dto.Alias != "" {
+			if err := c.checkAlias(dir, canonical); err != nil {
+				return fail(http.StatusConflict, err)
+			}
+		}
+	}
+	info, err := c.resolveSource(ctx, source, &opts)
+	if err == streaming.ErrSourceAuthFailed {
+		_, info, err = c.resolveFallbacks(ctx, dir, &opts)
+	}
+	if err == streaming.ErrSourceAuthFailed {
+		return fail(startError(ctx, http.StatusUnauthorized, err))
+	}
+	if err != nil {
+		return fail(startError(ctx, http.StatusUnprocessableEntity, err))
+	}
+	// The tracks are described even if the start would not probe the source, a failure does not fail the dry run then
+	if info == nil && !streaming.IsSRTListener(source) {
+		if probed, err := c.probe(ctx, source, &opts); err == nil {
+			info = &probed
+		} else {
+			c.logger(ctx).Warnf("Tracks of %s could not be probed || Error: %s", streaming.RedactURI(source), err)
+		}
+	}
+	opts.Source = info
+	c.assignDevice(ctx, dir, &opts)
+	result := StreamDto{URI: c.playbackURI(ctx, streaming.PlaylistPath(dir, opts), dir), ID: dir}
+	if known {
+		result = c.streamDto(ctx, stream, dir)
+		opts.Profile = stream.Options.Profile
+	} else if dto.Alias != "" {
+		result.Alias = dir
+	}
+	// The full queue refuses the start like there was no queue
+	if !running && !opts.Lazy && c.queueing(opts) && c.queue.len() < c.spec().QueueSize {
+		result.Queued, result.Position = true, c.queue.len()+1
+	} else if !running && !opts.Lazy {
+		if max := c.spec().MaxStreams; max > 0 && c.activeStreams() >= max {
+			if _, candidate := c.evictionCandidate(opts.Priority); candidate == nil {
+				return fail(http.StatusServiceUnavailable, ErrCapacityFn(max))
+			}
+		}
+		if budget := c.spec().ProcessCPUBudget; budget > 0 && c.cpuQuotas()+opts.CPUQuota > budget {
+			return fail(http.StatusServiceUnavailable, ErrCPUBudgetFn(budget))
+		}
+	}
+	result.Source, result.Mode, result.Device = opts.Source, opts.Mode, opts.Device
+	if opts.Profile != nil {
+		result.Profile = opts.Profile.Name
+	}
+	result.DryRun = true
+	c.logger(ctx).Infof("%s passed the dry run of its start", dir)
+	return startResult{result, http.StatusOK, nil, 0}
+}
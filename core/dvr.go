@@ -0,0 +1,84 @@
+package core
+
+import (
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// DVRWindowDto describes the DVR window of a stream given either as a number of seconds, like 1800, or as a duration, like "30m"
+type DVRWindowDto SecondsDto
+
+// UnmarshalJSON reads the DVR window from a number or a duration
+func (d *DVRWindowDto) UnmarshalJSON(b []byte) error {
+	var seconds SecondsDto
+	if err := seconds.UnmarshalJSON(b); err != nil || seconds < 0 {
+		return streaming.ErrInvalidDVRWindow
+	}
+	*d = DVRWindowDto(seconds)
+	return nil
+}
+
+// dvrWindow checks the DVR window of the request against the longest one that is allowed, returns it in seconds
+func (c *Controller) dvrWindow(window DVRWindowDto) (int, error) {
+	if time.Duration(window)*time.Second > c.spec().DVRMaxWindow {
+		return 0, ErrDVRWindowTooLong
+	}
+	return int(window), nil
+}
+
+// dvrFootprint returns the number of bytes the segments of the DVR window are estimated to use with DVR_BITRATE
+func (c *Controller) dvrFootprint(opts streaming.Options) int64 {
+	return int64(opts.DVRWindow) * int64(c.spec().DVRBitrate) * 1000 / 8
+}
+
+// fitsDVRWindow indicates if the estimated footprint of the DVR window fits into the size limit of a stream,
+// the space left until the total size limit and the space left in the store
+func (c *Controller) fitsDVRWindow(opts streaming.Options) bool {
+	if opts.DVRWindow <= 0 {
+		return true
+	}
+	footprint := c.dvrFootprint(opts)
+	spec := c.spec().Retention
+	used, stored := int64(0), c.usage.storeSize()
+	for _, usage := range c.usages() {
+		used += usage.size()
+	}
+	if limit := int64(spec.RetentionStreamSize) * megabyte; limit > 0 && footprint > limit {
+		return false
+	}
+	if limit := int64(spec.RetentionTotalSize) * megabyte; limit > 0 && footprint > limit-used {
+		return false
+	}
+	if limit := c.storeLimit(); limit > 0 && footprint > limit-stored {
+		return false
+	}
+	return true
+}
+
+// hasWindow indicates if any of the streams has a DVR window
+func hasWindow(usages []streamUsage) bool {
+	for _, usage := range usages {
+		if usage.window > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// withWindow protects the segments of the DVR stream that are still inside its window, so the retention and
+// the trimming of the store only delete the older ones
+func (c *Controller) withWindow(usage streamUsage) streamUsage {
+	strm, ok := c.getStream(usage.id)
+	if !ok || strm.Options.DVRWindow <= 0 {
+		return usage
+	}
+	usage.window = time.Duration(strm.Options.DVRWindow) * time.Second
+	now := c.now()
+	for i, file := range usage.segments {
+		if now.Sub(file.modTime) <= usage.window {
+			usage.segments[i].protected = true
+		}
+	}
+	return usage
+}
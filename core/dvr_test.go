@@ -0,0 +1,141 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDVRWindowDto(t *testing.T) {
+	tt := []struct {
+		JSON   string
+		Window DVRWindowDto
+		Err    error
+	}{
+		{JSON: `1800`, Window: 1800},
+		{JSON: `"30m"`, Window: 1800},
+		{JSON: `0`, Window: 0},
+		{JSON: `-1`, Err: streaming.ErrInvalidDVRWindow},
+		{JSON: `"forever"`, Err: streaming.ErrInvalidDVRWindow},
+	}
+	for i, testCase := range tt {
+		var window DVRWindowDto
+		err := json.Unmarshal([]byte(testCase.JSON), &window)
+		if !assert.Equal(t, testCase.Err, err) || !assert.Equal(t, testCase.Window, window) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestDVRWindowDto", i))
+		}
+	}
+}
+
+func TestStartDVR(t *testing.T) {
+	setup := func(maxWindow time.Duration, streamSize int) *Controller {
+		conf := *config.InitConfig()
+		conf.DVRMaxWindow = maxWindow
+		conf.DVRBitrate = 4000
+		conf.RetentionStreamSize = streamSize
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		return ctrls
+	}
+	start := func(ctrls *Controller, window string) (int, ErrorDto) {
+		rr := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"uri": %q, "dvrWindow": %s}`, generateURI(), window)
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", strings.NewReader(body)), nil)
+		var errDto ErrorDto
+		json.NewDecoder(rr.Body).Decode(&errDto)
+		return rr.Code, errDto
+	}
+
+	t.Run("Should start the streams with a window up to the longest one", func(t *testing.T) {
+		ctrls := setup(time.Minute*30, 0)
+		status, _ := start(ctrls, `"30m"`)
+		assert.Equal(t, http.StatusOK, status)
+		for _, strm := range ctrls.snapshotStreams() {
+			assert.Equal(t, 1800, strm.Options.DVRWindow)
+		}
+	})
+
+	t.Run("Should refuse the windows that are too long", func(t *testing.T) {
+		status, errDto := start(setup(time.Minute*30, 0), `"31m"`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, ErrorBodyDto{"invalid_dvr_window", ErrDVRWindowTooLong.Error(), ""}, errDto.Error)
+
+		// Every window is refused once they are turned off
+		status, errDto = start(setup(0, 0), `60`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_dvr_window", errDto.Error.Code)
+
+		status, errDto = start(setup(time.Minute*30, 0), `-60`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_dvr_window", errDto.Error.Code)
+	})
+
+	t.Run("Should refuse the windows that do not fit into the size limit of a stream", func(t *testing.T) {
+		// 30 minutes at 4000 kbit/s are 900 MB
+		status, errDto := start(setup(time.Minute*30, 500), `"30m"`)
+		assert.Equal(t, http.StatusInsufficientStorage, status)
+		assert.Equal(t, ErrorBodyDto{"dvr_window_too_large", ErrDVRWindowTooLarge.Error(), ""}, errDto.Error)
+
+		status, _ = start(setup(time.Minute*30, 500), `"10m"`)
+		assert.Equal(t, http.StatusOK, status)
+	})
+}
+
+func TestDVRRetention(t *testing.T) {
+	now := time.Now()
+	segment := func(name string, age time.Duration) storedFile {
+		return storedFile{name, megabyte, now.Add(-age), false}
+	}
+
+	t.Run("Should delete the segments older than the window", func(t *testing.T) {
+		usages := []streamUsage{{
+			id:       "id",
+			segments: []storedFile{segment("id/0.ts", time.Hour*2), segment("id/1.ts", time.Minute), {"id/index.m3u8", 1, now.Add(-time.Hour * 2), true}},
+			window:   time.Hour,
+		}}
+		expired := []string{}
+		for _, file := range expiredFiles(config.Retention{}, usages, now) {
+			expired = append(expired, file.path)
+		}
+		assert.Equal(t, []string{"id/0.ts"}, expired)
+	})
+
+	t.Run("Should protect the segments inside the window", func(t *testing.T) {
+		root, err := ioutil.TempDir("", "dvr")
+		assert.Nil(t, err)
+		defer os.RemoveAll(root)
+		conf := *config.InitConfig()
+		conf.StoreDir = root
+		conf.RetentionStreamSize = 1
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		strm := generateStream(nil, "")
+		strm.strm.StorePath = filepath.Join(root, "id")
+		strm.strm.Options.DVRWindow = 3600
+		ctrls.setStream("id", &strm.strm)
+
+		assert.Nil(t, os.MkdirAll(strm.strm.StorePath, os.ModePerm))
+		writeAged(t, filepath.Join(strm.strm.StorePath, "0.ts"), int(megabyte), now.Add(-time.Hour*2))
+		writeAged(t, filepath.Join(strm.strm.StorePath, "1.ts"), int(megabyte), now.Add(-time.Minute*2))
+		writeAged(t, filepath.Join(strm.strm.StorePath, "2.ts"), int(megabyte), now.Add(-time.Minute))
+		ctrls.enforceRetention()
+
+		_, err = os.Stat(filepath.Join(strm.strm.StorePath, "0.ts"))
+		assert.True(t, os.IsNotExist(err))
+		for _, name := range []string{"1.ts", "2.ts"} {
+			_, err := os.Stat(filepath.Join(strm.strm.StorePath, name))
+			assert.Nil(t, err, name)
+		}
+	})
+}
@@ -0,0 +1,388 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Roverr/rtsp-stream/core/access"
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/onvif"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/Roverr/rtsp-stream/core/whep"
+)
+
+// ErrInvalidURI is sent when the URI of the stream cannot be parsed
+var ErrInvalidURI = errors.New("Invalid URI")
+
+// ErrEmptyURI is sent when the URI of the stream is missing
+var ErrEmptyURI = errors.New("Invalid URI: it cannot be empty")
+
+// ErrURIWhitespace is sent when the URI of the stream contains whitespace
+var ErrURIWhitespace = errors.New("Invalid URI: it cannot contain whitespace")
+
+// ErrRelativeURI is sent when the URI of the stream has no scheme
+var ErrRelativeURI = errors.New("Invalid URI: it has to be absolute with a scheme like rtsp://")
+
+// ErrUnsupportedScheme is sent when the scheme of the URI is not one of the allowed ones
+var ErrUnsupportedScheme = errors.New("Invalid URI: its scheme is not allowed")
+
+// ErrMissingHost is sent when the URI of the stream has no host
+var ErrMissingHost = errors.New("Invalid URI: it has to name a host")
+
+// ErrInvalidSourceCredentials is sent when the password of the source is given without a username, or credentials are given for a local source
+var ErrInvalidSourceCredentials = errors.New("Invalid URI: the credentials need a username and local sources cannot have them")
+
+// ErrSRTOptions is sent when the SRT options are given for a source that is not received over SRT
+var ErrSRTOptions = errors.New("Invalid options: the SRT options can only be given for srt:// sources")
+
+// ErrSDPWithURI is sent when a stream is started from an SDP with a URI, the URI is read from the SDP
+var ErrSDPWithURI = errors.New("Invalid URI: the URI of the streams started from an SDP is read from the SDP, it cannot be given")
+
+// ErrInvalidLocalPath is sent when the file:// URI of a local source does not name an absolute path of the host
+var ErrInvalidLocalPath = errors.New("Invalid URI: local sources have to name an absolute path like file:///videos/sample.mp4")
+
+// ErrLocalSourcesDisabled is sent when a stream is started from a local source while they are disabled
+var ErrLocalSourcesDisabled = errors.New("Local sources are disabled")
+
+// ErrLocalSourceDenied is sent when the path of the local source is not one of the allowed ones
+var ErrLocalSourceDenied = errors.New("Local source is not in the allowed paths")
+
+// ErrLocalSourceMissing is sent when the file or the device of the local source does not exist
+var ErrLocalSourceMissing = errors.New("Local source does not exist")
+
+// ErrStreamAlreadyActive is sent when the stream is being restarted already
+var ErrStreamAlreadyActive = errors.New("Stream is being restarted already")
+
+// ErrInvalidWipe is sent when the wipe parameter of the restart is not a boolean
+var ErrInvalidWipe = errors.New("wipe has to be true or false")
+
+// ErrInvalidBody is sent when the body of the request is not a valid JSON
+var ErrInvalidBody = errors.New("Invalid request body")
+
+// ErrInvalidBatchSize is sent when the batch start has no streams or more than it can start at once
+var ErrInvalidBatchSize = errors.New("Batch has to contain at least 1 and at most 100 streams")
+
+// ErrInvalidAlias is sent when the alias of the stream cannot be used as a segment of its path
+var ErrInvalidAlias = errors.New("Alias has to be at most 64 letters, digits, dashes or underscores, starting with a letter or a digit")
+
+// ErrAliasTaken is sent when the alias is used by the active stream of another source
+var ErrAliasTaken = errors.New("Alias is used by another stream")
+
+// ErrAliasRename is sent when the stream of the source is registered with another alias or without one already
+var ErrAliasRename = errors.New("Stream is registered with another id already, its alias cannot be changed")
+
+// ErrInvalidGroup is sent when the name of the group cannot be used as a segment of the path of the group endpoints
+var ErrInvalidGroup = errors.New("Group has to be at most 64 letters, digits, dashes or underscores, starting with a letter or a digit")
+
+// ErrNoGroup is sent when the operation of a group is requested, but no stream belongs to the group
+var ErrNoGroup = errors.New("Group has no streams")
+
+// ErrInvalidMetadata is sent when the metadata of the stream is over its limits
+var ErrInvalidMetadata = errors.New("Metadata can have at most 32 keys of at most 64 characters without colons, with values of at most 256 characters")
+
+// ErrInvalidLayout is sent when the metadata of a new stream cannot fill the variables of the directory and segment templates
+var ErrInvalidLayout = errors.New("Metadata used by the directory and segment templates has to be set to letters, digits, dots, dashes or underscores")
+
+// ErrRestartFailed is sent when the process of a known stream could not be restarted
+var ErrRestartFailed = errors.New("Stream could not be restarted")
+
+// ErrRecordingNotFound is sent when the requested recording does not exist
+var ErrRecordingNotFound = errors.New("Recording not found")
+
+// ErrInvalidTimeWindow is sent when the time window of the recordings cannot be parsed
+var ErrInvalidTimeWindow = errors.New("Time window has to be given with RFC 3339 timestamps, from before to")
+
+// ErrInvalidKeepRecordings is sent when the keepRecordings parameter of the stop is not a boolean
+var ErrInvalidKeepRecordings = errors.New("keepRecordings has to be true or false")
+
+// ErrDiscoveryRunning is sent when the cameras are being discovered by another request already
+var ErrDiscoveryRunning = errors.New("Cameras are being discovered already")
+
+// ErrInvalidStart is sent when the start parameter of the discovery or of the enabling of a stream is not a boolean
+var ErrInvalidStart = errors.New("start has to be true or false")
+
+// ErrInvalidWait is sent when the wait parameter of the start is not a boolean
+var ErrInvalidWait = errors.New("wait has to be true or false")
+
+// ErrInvalidDryRun is sent when the dryRun parameter of the start is not a boolean
+var ErrInvalidDryRun = errors.New("dryRun has to be true or false")
+
+// ErrInvalidRetry is sent when the retry policy of the stream cannot be used
+var ErrInvalidRetry = errors.New("maxAttempts cannot be negative, jitter has to be between 0 and 1, initialDelay, maxDelay and giveUpAfter durations like 5s")
+
+// ErrInvalidAbsolute is sent when the absolute parameter of the request is not a boolean
+var ErrInvalidAbsolute = errors.New("absolute has to be true or false")
+
+// ErrDVRWindowTooLong is sent when a stream is started with a DVR window longer than DVR_MAX_WINDOW
+var ErrDVRWindowTooLong = errors.New("DVR window is longer than the longest one that is allowed")
+
+// ErrDVRWindowTooLarge is sent when the estimated size of the DVR window of a new stream does not fit into the size limits
+var ErrDVRWindowTooLarge = errors.New("DVR window does not fit into the size limits of the store")
+
+// ErrStorageFull is sent when a stream is started while the files in the store reached its limit
+var ErrStorageFull = errors.New("Store reached its size limit, no stream can be started")
+
+// ErrNoSegment is sent when a snapshot is requested from a stream that has not produced a segment yet
+var ErrNoSegment = errors.New("Stream has not produced a segment yet")
+
+// ErrInvalidSnapshotWidth is sent when the requested width of the snapshot is out of the accepted range
+var ErrInvalidSnapshotWidth = errors.New("Width of the snapshot has to be between 16 and 3840")
+
+// ErrSnapshotFailed is sent when the frame of the snapshot could not be decoded
+var ErrSnapshotFailed = errors.New("Snapshot could not be taken")
+
+// ErrDASHNotSupported is sent when an MPEG-DASH output or the low latency mode is requested while the streams are encrypted or signed
+var ErrDASHNotSupported = errors.New("DASH output and low latency mode cannot be used with encryption or URL signing")
+
+// ErrLowLatencyDisabled is sent when the low latency mode is requested while it is turned off
+var ErrLowLatencyDisabled = errors.New("Low latency mode is not enabled")
+
+// ErrUnsafeArgsDisabled is sent when the start request adds arguments to ffmpeg while it is not allowed
+var ErrUnsafeArgsDisabled = errors.New("Arguments of ffmpeg can only be given if unsafe arguments are enabled")
+
+// ErrInvalidBlockingReload is sent when the blocking reload of a playlist requests a segment too far ahead or a part without its segment
+var ErrInvalidBlockingReload = errors.New("_HLS_msn has to be a media sequence number at most two segments ahead, _HLS_part requires _HLS_msn")
+
+// ErrBlockingReloadTimeout is sent when the requested segment of a blocking playlist reload is not written in time
+var ErrBlockingReloadTimeout = errors.New("Requested segment was not written in time")
+
+// ErrInvalidListQuery is sent when the filtering, sorting or pagination of the list cannot be parsed
+var ErrInvalidListQuery = errors.New("running has to be true or false, limit and offset non-negative integers, sort uri, started or lastActive, label key:value")
+
+// ErrInvalidEventQuery is sent when the filters of the event log cannot be parsed
+var ErrInvalidEventQuery = errors.New("since has to be a time like 2019-01-20T12:00:00Z or a duration like 10m, level info, warning or error")
+
+// ErrInvalidStopAllQuery is sent when the parameters of the stop of every stream cannot be parsed
+var ErrInvalidStopAllQuery = errors.New("wipe and dryRun have to be true or false, graceSeconds a non-negative integer")
+
+// ErrQueuedStartStopped is sent to the clients waiting for a queued start that was stopped before it got a free slot
+var ErrQueuedStartStopped = errors.New("Queued start of the stream was stopped before it got a free slot")
+
+// ErrInvalidReconcileQuery is sent when the parameters of the reconciliation of the store cannot be parsed
+var ErrInvalidReconcileQuery = errors.New("dryRun has to be true or false")
+
+// ErrReconcileDisabled is sent when the orphaned directories of the store are reconciled while RETENTION_ORPHAN_AGE is 0
+var ErrReconcileDisabled = errors.New("Orphaned directories are not cleaned up, RETENTION_ORPHAN_AGE has to be set")
+
+// ErrStoppingAll is sent when every stream is being stopped, so no transcoding can be started until it is done
+var ErrStoppingAll = errors.New("Every stream is being stopped, try again later")
+
+// ErrNoMPEGTS is sent when the MPEG-TS output of a stream is requested, but the stream was started without it
+var ErrNoMPEGTS = errors.New("Stream is not served as MPEG-TS, it has to be started again")
+
+// ErrNoWHEP is sent when a stream is played with WHEP, but it was started without the output the sessions are sent from
+var ErrNoWHEP = errors.New("Stream cannot be played with WHEP, it has to be started again")
+
+// ErrWHEPCodec is sent when a stream is played with WHEP, but its video is copied from a source that is not H.264
+var ErrWHEPCodec = errors.New("Video of the stream is not H.264, it has to be started in transcode mode to be played with WHEP")
+
+// ErrAudioOnly is sent when the video of a stream is requested, like its snapshot, but the stream is audio-only
+var ErrAudioOnly = errors.New("Stream is audio-only, it has no video")
+
+// ErrUnknownProfile is sent when a stream is started with a profile that is not configured
+var ErrUnknownProfile = errors.New("Profile is not configured")
+
+// ErrUnknownDevice is sent when a stream is started on a device that is not one of the configured hardware devices
+var ErrUnknownDevice = errors.New("Device is not one of the configured hardware devices")
+
+// ErrDeviceWithoutHardware is sent when a stream is started on a device, but the hardware acceleration is not enabled
+var ErrDeviceWithoutHardware = errors.New("Device can only be picked if hardware acceleration is enabled")
+
+// ErrInvalidTTL is sent when the time to live of a stream is negative or not given as seconds or a duration
+var ErrInvalidTTL = errors.New("TTL has to be a number of seconds or a duration, it cannot be negative")
+
+// ErrTTLWithSource is sent when PATCH /stream/:id changes the time to live and the source of a stream at once
+var ErrTTLWithSource = errors.New("Time to live and source of a stream have to be changed by separate requests")
+
+// ErrStreamPaused is sent when a paused stream is restarted or its playlist is requested, it has to be resumed first
+var ErrStreamPaused = errors.New("Stream is paused")
+
+// ErrStreamDisabled is sent when a disabled stream is restarted, resumed or its playlist is requested, it has to be enabled first
+var ErrStreamDisabled = errors.New("Stream is disabled")
+
+// ErrPlaybackTokensDisabled is sent when the playback token of a stream is revoked, but the playback tokens are not enabled
+var ErrPlaybackTokensDisabled = errors.New("Playback tokens are not enabled")
+
+// ErrResolutionTooLarge is sent when a stream is started with an output resolution above the configured maximum
+var ErrResolutionTooLarge = errors.New("Resolution is larger than the configured maximum")
+
+// ErrInvalidBodyType is sent when the body of the request is not sent as application/json
+var ErrInvalidBodyType = errors.New("Content-Type of the body has to be application/json")
+
+// ErrInvalidSDPType is sent when the offer of a WHEP session is not sent as application/sdp
+var ErrInvalidSDPType = errors.New("Content-Type of the offer has to be application/sdp")
+
+// ErrSourceFromSDP is sent when the source of a stream read from an SDP file is replaced, the stream has to be started again
+var ErrSourceFromSDP = errors.New("Source of a stream read from an SDP file cannot be replaced")
+
+// ErrorDto describes the error response of the API
+type ErrorDto struct {
+	Error ErrorBodyDto `json:"error"`
+}
+
+// ErrorBodyDto describes an error with a stable code clients can handle
+type ErrorBodyDto struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// RequestID is the id of the request the error is sent to, so it can be found in the logs
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// errorCodes are the codes of the errors that are handled differently by clients
+var errorCodes = map[error]string{
+	ErrUnexpected:                         "unexpected_error",
+	ErrDirectoryNotCreated:                "directory_not_created",
+	ErrTimeout:                            "start_timeout",
+	ErrStartCanceled:                      "start_canceled",
+	ErrRateLimited:                        "rate_limited",
+	ErrInvalidURI:                         "invalid_uri",
+	ErrInvalidBody:                        "invalid_body",
+	ErrInvalidBatchSize:                   "invalid_batch_size",
+	ErrInvalidAlias:                       "invalid_alias",
+	ErrInvalidMetadata:                    "invalid_metadata",
+	ErrInvalidLayout:                      "invalid_layout",
+	ErrInvalidGroup:                       "invalid_group",
+	ErrNoGroup:                            "group_not_found",
+	ErrAliasTaken:                         "alias_conflict",
+	ErrAliasRename:                        "alias_conflict",
+	ErrStreamAlreadyActive:                "stream_already_active",
+	ErrEmptyURI:                           "invalid_uri",
+	ErrURIWhitespace:                      "invalid_uri",
+	ErrInvalidSourceCredentials:           "invalid_uri",
+	ErrSRTOptions:                         "invalid_options",
+	ErrSDPWithURI:                         "invalid_uri",
+	ErrRelativeURI:                        "invalid_uri",
+	ErrUnsupportedScheme:                  "invalid_uri",
+	ErrMissingHost:                        "invalid_uri",
+	ErrInvalidLocalPath:                   "invalid_uri",
+	ErrLocalSourcesDisabled:               "local_sources_disabled",
+	ErrLocalSourceDenied:                  "source_denied",
+	ErrLocalSourceMissing:                 "invalid_source",
+	ErrRestartFailed:                      "restart_failed",
+	ErrFileNotFound:                       "file_not_found",
+	ErrRecordingNotFound:                  "recording_not_found",
+	ErrInvalidTimeWindow:                  "invalid_time_window",
+	ErrNoSegment:                          "no_segment",
+	ErrInvalidWait:                        "invalid_wait",
+	ErrInvalidDryRun:                      "invalid_dry_run",
+	ErrInvalidAbsolute:                    "invalid_absolute",
+	ErrInvalidRetry:                       "invalid_retry",
+	ErrDiscoveryRunning:                   "discovery_running",
+	ErrInvalidStart:                       "invalid_start",
+	onvif.ErrDiscoveryFailed:              "discovery_failed",
+	ErrStorageFull:                        "storage_full",
+	ErrDVRWindowTooLong:                   "invalid_dvr_window",
+	ErrDVRWindowTooLarge:                  "dvr_window_too_large",
+	ErrInvalidSnapshotWidth:               "invalid_width",
+	ErrSnapshotFailed:                     "snapshot_failed",
+	ErrDASHNotSupported:                   "invalid_options",
+	ErrLowLatencyDisabled:                 "invalid_options",
+	ErrUnsafeArgsDisabled:                 "invalid_options",
+	ErrInvalidBlockingReload:              "invalid_blocking_reload",
+	ErrBlockingReloadTimeout:              "blocking_reload_timeout",
+	ErrInvalidListQuery:                   "invalid_list_query",
+	ErrInvalidEventQuery:                  "invalid_event_query",
+	ErrInvalidStopAllQuery:                "invalid_stop_all_query",
+	ErrStoppingAll:                        "stopping_all",
+	ErrInvalidReconcileQuery:              "invalid_reconcile_query",
+	ErrReconcileDisabled:                  "reconcile_disabled",
+	ErrQueuedStartStopped:                 "queue_stopped",
+	ErrNoMPEGTS:                           "mpegts_unavailable",
+	ErrNoWHEP:                             "whep_unavailable",
+	ErrWHEPCodec:                          "whep_unsupported_codec",
+	ErrInvalidSDPType:                     "invalid_content_type",
+	ErrInvalidBodyType:                    "invalid_content_type",
+	ErrAudioOnly:                          "audio_only",
+	ErrUnknownProfile:                     "unknown_profile",
+	ErrUnknownDevice:                      "unknown_device",
+	ErrDeviceWithoutHardware:              "invalid_options",
+	ErrResolutionTooLarge:                 "invalid_resolution",
+	ErrPlaybackTokensDisabled:             "playback_tokens_disabled",
+	ErrInvalidTTL:                         "invalid_ttl",
+	ErrTTLWithSource:                      "invalid_body",
+	ErrStreamPaused:                       "stream_paused",
+	ErrStreamDisabled:                     "stream_disabled",
+	ErrSourceFromSDP:                      "source_not_replaceable",
+	whep.ErrNotBuilt:                      "whep_not_built",
+	whep.ErrTooManyViewers:                "whep_viewers_reached",
+	whep.ErrInvalidOffer:                  "invalid_offer",
+	whep.ErrNoSession:                     "session_not_found",
+	access.ErrAccessDenied:                "access_denied",
+	access.ErrSourceDenied:                "source_denied",
+	access.ErrUnresolvedSource:            "unresolved_source",
+	auth.ErrMissingToken:                  "missing_token",
+	auth.ErrMalformedToken:                "malformed_token",
+	auth.ErrExpiredToken:                  "expired_token",
+	auth.ErrInvalidToken:                  "invalid_token",
+	auth.ErrMissingSignature:              "missing_signature",
+	auth.ErrExpiredSignature:              "expired_signature",
+	auth.ErrInvalidSignature:              "invalid_signature",
+	auth.ErrMissingPlaybackToken:          "missing_playback_token",
+	auth.ErrInvalidPlaybackToken:          "invalid_playback_token",
+	auth.ErrMissingCredentials:            "missing_credentials",
+	auth.ErrInvalidCredentials:            "invalid_credentials",
+	auth.ErrMissingAPIKey:                 "missing_api_key",
+	auth.ErrInvalidAPIKey:                 "invalid_api_key",
+	auth.ErrInsufficientPermissions:       "insufficient_permissions",
+	streaming.ErrInvalidHLSTime:           "invalid_options",
+	streaming.ErrInvalidHLSListSize:       "invalid_options",
+	streaming.ErrInvalidIdleTimeout:       "invalid_options",
+	streaming.ErrInvalidStreak:            "invalid_options",
+	streaming.ErrInvalidRendition:         "invalid_options",
+	streaming.ErrTooManyRenditions:        "invalid_options",
+	streaming.ErrDuplicateRendition:       "invalid_options",
+	streaming.ErrInvalidMode:              "invalid_options",
+	streaming.ErrCopyWithRenditions:       "invalid_options",
+	streaming.ErrInvalidAudio:             "invalid_options",
+	streaming.ErrInvalidAudioBitrate:      "invalid_options",
+	streaming.ErrAudioOnlyAudio:           "invalid_options",
+	streaming.ErrAudioOnlyRenditions:      "invalid_options",
+	streaming.ErrNoAudioTrack:             "no_audio_track",
+	streaming.ErrCopyWithProfile:          "invalid_options",
+	streaming.ErrProfileWithRenditions:    "invalid_options",
+	streaming.ErrInvalidResolution:        "invalid_resolution",
+	streaming.ErrResolutionWithRenditions: "invalid_options",
+	streaming.ErrCopyWithResolution:       "resolution_conflict",
+	streaming.ErrInvalidMaxFPS:            "invalid_options",
+	streaming.ErrCopyWithMaxFPS:           "max_fps_conflict",
+	streaming.ErrInvalidRecordSegmentTime: "invalid_options",
+	streaming.ErrInvalidSegmentType:       "invalid_options",
+	streaming.ErrInvalidFormat:            "invalid_options",
+	streaming.ErrInvalidTransport:         "invalid_options",
+	streaming.ErrInvalidLifecycle:         "invalid_options",
+	streaming.ErrInvalidSRT:               "invalid_options",
+	streaming.ErrInvalidSDP:               "invalid_options",
+	streaming.ErrInvalidDVRWindow:         "invalid_dvr_window",
+	streaming.ErrInvalidActivity:          "invalid_options",
+	streaming.ErrSourceAuthFailed:         "source_auth_failed",
+	streaming.ErrInvalidPush:              "invalid_options",
+	streaming.ErrDASHWithRenditions:       "invalid_options",
+	streaming.ErrInvalidPartDuration:      "invalid_options",
+	streaming.ErrLowLatencyWithRenditions: "invalid_options",
+	streaming.ErrProbeTimeout:             "probe_timeout",
+}
+
+// statusCodes are the codes of the errors that are described by their status, like the dynamic ones
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "stream_not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "stream_conflict",
+	http.StatusRequestEntityTooLarge: "body_too_large",
+	http.StatusUnprocessableEntity:   "invalid_source",
+	http.StatusBadGateway:            "no_first_segment",
+	http.StatusServiceUnavailable:    "capacity_reached",
+}
+
+// errorCode returns the code of the error sent with the given status
+func errorCode(err error, status int) string {
+	if code, ok := errorCodes[err]; ok {
+		return code
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return "unexpected_error"
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// eventsPingInterval is the time between the pings keeping the connections of the event feed alive
+const eventsPingInterval = 30 * time.Second
+
+// publish sends the event of the stream to the subscribers of the event feed and the webhooks.
+// The event carries the id of the request that started the stream
+func (c *Controller) publish(t events.Type, id string, strm *streaming.Stream, details string) {
+	c.publishEvent(t, id, strm, details, "", strm.RequestID)
+}
+
+// publishBy sends the event of the stream caused by a request, with the name of its API key and its id from the context
+func (c *Controller) publishBy(ctx context.Context, t events.Type, id string, strm *streaming.Stream, details string) {
+	c.publishEvent(t, id, strm, details, apiKeyFromContext(ctx), RequestIDFromContext(ctx))
+}
+
+// publishEvent sends the event of the stream with the name of the API key and the id of the request causing it
+func (c *Controller) publishEvent(t events.Type, id string, strm *streaming.Stream, details, key, requestID string) {
+	uri := c.prefixed(strm.Path)
+	if remote := c.remoteURI(strm.Path, id); remote != "" {
+		uri = remote
+	}
+	event := events.New(t, id, uri, details)
+	event.APIKey, event.RequestID = key, requestID
+	c.events.Publish(event)
+}
+
+// publishAuthFailure sends the event of a request refused by the authentication. Only the method, the path and the address
+// of the client are described, the credentials are never included
+func (c *Controller) publishAuthFailure(r *http.Request, err error) {
+	details := fmt.Sprintf("%s %s from %s: %s", r.Method, r.URL.Path, c.clientAddress(r), err)
+	event := events.New(events.Unauthorized, "", "", details)
+	event.RequestID = RequestIDFromContext(r.Context())
+	c.events.Publish(event)
+}
+
+// EventLogHandler is the HTTP handler of the /events/log call. It returns the last events kept in memory,
+// from the oldest to the newest, filtered by the stream, the time and the level given in the query
+func (c *Controller) EventLogHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	query, err := parseEventQuery(r.URL.Query(), c.now())
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if query.StreamID != "" {
+		query.StreamID = c.resolveID(query.StreamID)
+	}
+	list := []events.Event{}
+	if c.eventLog != nil {
+		list = c.eventLog.Query(query)
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// parseEventQuery reads the filters of the event log. The start of the events is either a time or a duration counted back from now
+func parseEventQuery(values url.Values, now time.Time) (events.Query, error) {
+	query := events.Query{StreamID: values.Get("stream"), Level: events.Level(values.Get("level"))}
+	if query.Level != "" && !events.ValidLevel(query.Level) {
+		return query, ErrInvalidEventQuery
+	}
+	if since := values.Get("since"); since != "" {
+		if at, err := time.Parse(time.RFC3339, since); err == nil {
+			query.Since = at
+		} else if ago, err := time.ParseDuration(since); err == nil && ago >= 0 {
+			query.Since = now.Add(-ago)
+		} else {
+			return query, ErrInvalidEventQuery
+		}
+	}
+	return query, nil
+}
+
+// EventsHandler is the HTTP handler of the /events call, which streams the lifecycle events of
+// the streams over WebSocket. The subscription ends when the client closes the connection
+func (c *Controller) EventsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	err := events.Serve(w, r, func(conn *events.Conn) {
+		c.streamEvents(r.Context(), conn)
+	})
+	if err == events.ErrNotWebSocket {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.logger(r.Context()).Error(err)
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+	}
+}
+
+// streamEvents sends the events of the bus to the client of the feed until it leaves or the service is shut down
+func (c *Controller) streamEvents(ctx context.Context, conn *events.Conn) {
+	sub := c.events.Subscribe()
+	defer c.events.Unsubscribe(sub)
+
+	// The reader stops when the client closes the feed or the connection is closed on return
+	closed := make(chan struct{})
+	go func() {
+		conn.ReadLoop()
+		close(closed)
+	}()
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			// The feed is closed when the service is shutting down, the connection is closed normally then
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(event)
+			if err != nil {
+				c.logger(ctx).Error(err)
+				continue
+			}
+			if err := conn.WriteText(b); err != nil {
+				c.logger(ctx).Debugf("Event feed is closed || Error: %s", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WritePing(); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
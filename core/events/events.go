@@ -0,0 +1,182 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Type describes what happened to a stream
+type Type string
+
+// Started is published when a new stream is started or registered lazily
+const Started Type = "started"
+
+// Restarted is published when the transcoding of a stream is started again
+const Restarted Type = "restarted"
+
+// Inactive is published when the transcoding of a stream is cleaned up, because it is not watched anymore
+const Inactive Type = "inactive"
+
+// Errored is published when the restarts of a crashed stream are exhausted
+const Errored Type = "errored"
+
+// Stopped is published when a stream is stopped and removed
+const Stopped Type = "stopped"
+
+// Paused is published when the transcoding of a stream is paused by a client
+const Paused Type = "paused"
+
+// Resumed is published when the transcoding of a paused stream is started again
+const Resumed Type = "resumed"
+
+// Disabled is published when a stream is switched off by a client, Enabled when it is switched on again
+const Disabled Type = "disabled"
+
+// Enabled is published when a disabled stream is returned to its lifecycle
+const Enabled Type = "enabled"
+
+// Evicted is published when the transcoding of a stream is paused to make room for a stream with a higher priority
+const Evicted Type = "evicted"
+
+// Stalled is published when the transcoding of a stream stops writing segments, it is restarted or errored afterwards
+const Stalled Type = "stalled"
+
+// Unauthorized is published when a request is refused by the authentication, it does not belong to a stream
+const Unauthorized Type = "unauthorized"
+
+// Level describes the severity of an event
+type Level string
+
+// LevelInfo, LevelWarning and LevelError are the levels of the events, from the least to the most severe
+const (
+	LevelInfo    Level = "info"
+	LevelWarning Level = "warning"
+	LevelError   Level = "error"
+)
+
+// severities orders the levels by their severity
+var severities = map[Level]int{LevelInfo: 0, LevelWarning: 1, LevelError: 2}
+
+// ValidLevel indicates if the level is one of the known levels
+func ValidLevel(level Level) bool {
+	_, ok := severities[level]
+	return ok
+}
+
+// AtLeast indicates if the level is at least as severe as the given one
+func (l Level) AtLeast(min Level) bool {
+	return severities[l] >= severities[min]
+}
+
+// Level returns the severity of the events of the type
+func (t Type) Level() Level {
+	switch t {
+	case Errored:
+		return LevelError
+	case Stalled, Unauthorized:
+		return LevelWarning
+	}
+	return LevelInfo
+}
+
+// Event describes a change in the lifecycle of a stream
+type Event struct {
+	Type      Type      `json:"type"`
+	Level     Level     `json:"level"`
+	StreamID  string    `json:"streamId"`
+	URI       string    `json:"uri"`
+	Timestamp time.Time `json:"timestamp"`
+	Details   string    `json:"details,omitempty"`
+	APIKey    string    `json:"apiKey,omitempty"` // Name of the API key of the request that caused the event
+	// RequestID is the id of the request that caused the event, or of the one that started the stream
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// New creates a new event of the stream happening now, uri is the playback URI of the stream
+func New(t Type, id, uri, details string) Event {
+	return Event{t, t.Level(), id, uri, time.Now(), details, "", ""}
+}
+
+// Subscription receives the events published on the bus until it is unsubscribed
+type Subscription struct {
+	events chan Event
+}
+
+// Events returns the channel of the events, it is closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Bus delivers the published events to every subscriber. Each subscriber has its own buffer,
+// events are dropped for the subscribers with a full buffer, so publishing never blocks
+type Bus struct {
+	mux         *sync.Mutex
+	buffer      int
+	subscribers map[*Subscription]bool
+	closed      bool
+}
+
+// NewBus creates a new instance of Bus with the given buffer size for every subscriber
+func NewBus(buffer int) *Bus {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Bus{&sync.Mutex{}, buffer, map[*Subscription]bool{}, false}
+}
+
+// Subscribe creates a new subscription. Subscriptions of a closed bus are closed immediately
+func (b *Bus) Subscribe() *Subscription {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	sub := &Subscription{make(chan Event, b.buffer)}
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	b.subscribers[sub] = true
+	return sub
+}
+
+// Unsubscribe ends the subscription and closes its channel
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if !b.subscribers[sub] {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Bus) Subscribers() int {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return len(b.subscribers)
+}
+
+// Publish delivers the event to every subscriber that has room for it in its buffer
+func (b *Bus) Publish(event Event) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			logrus.Warnf("%s event of %s is dropped for a slow subscriber", event.Type, event.StreamID)
+		}
+	}
+}
+
+// Close ends every subscription, the events published afterwards are dropped
+func (b *Bus) Close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
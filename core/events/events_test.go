@@ -0,0 +1,64 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("Should deliver the events to every subscriber", func(t *testing.T) {
+		bus := NewBus(4)
+		first, second := bus.Subscribe(), bus.Subscribe()
+		assert.Equal(t, 2, bus.Subscribers())
+		bus.Publish(New(Started, "id", "/stream/id/index.m3u8", ""))
+		for _, sub := range []*Subscription{first, second} {
+			event := <-sub.Events()
+			assert.Equal(t, Started, event.Type)
+			assert.Equal(t, "id", event.StreamID)
+			assert.False(t, event.Timestamp.IsZero())
+		}
+	})
+
+	t.Run("Should drop the events of slow subscribers without blocking", func(t *testing.T) {
+		bus := NewBus(2)
+		slow, fast := bus.Subscribe(), bus.Subscribe()
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 5; i++ {
+				bus.Publish(New(Restarted, "id", "/stream/id/index.m3u8", ""))
+				<-fast.Events()
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Publishing is blocked by the slow subscriber")
+		}
+		assert.Len(t, slow.Events(), 2)
+	})
+
+	t.Run("Should close the subscriptions once they are unsubscribed", func(t *testing.T) {
+		bus := NewBus(1)
+		sub := bus.Subscribe()
+		bus.Unsubscribe(sub)
+		bus.Unsubscribe(sub)
+		_, ok := <-sub.Events()
+		assert.False(t, ok)
+		assert.Equal(t, 0, bus.Subscribers())
+		bus.Publish(New(Stopped, "id", "/stream/id/index.m3u8", ""))
+	})
+
+	t.Run("Should close every subscription when the bus is closed", func(t *testing.T) {
+		bus := NewBus(1)
+		sub := bus.Subscribe()
+		bus.Close()
+		_, ok := <-sub.Events()
+		assert.False(t, ok)
+		_, ok = <-bus.Subscribe().Events()
+		assert.False(t, ok)
+		assert.Equal(t, 0, bus.Subscribers())
+	})
+}
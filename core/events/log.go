@@ -0,0 +1,76 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Query describes the filters of the events read from the log, the zero values do not filter
+type Query struct {
+	StreamID string
+	Since    time.Time // Only the events after it are returned
+	Level    Level     // Only the events at least as severe are returned
+}
+
+// matches indicates if the event passes the filters of the query
+func (q Query) matches(event Event) bool {
+	if q.StreamID != "" && event.StreamID != q.StreamID {
+		return false
+	}
+	if !q.Since.IsZero() && !event.Timestamp.After(q.Since) {
+		return false
+	}
+	return q.Level == "" || event.Level.AtLeast(q.Level)
+}
+
+// Log keeps the last events published on the bus in a ring buffer of a fixed size,
+// the oldest events are overwritten once it is full, so its memory use does not grow with the rate of the events
+type Log struct {
+	mux     *sync.RWMutex
+	entries []Event
+	next    int // Index the next event is written to
+	full    bool
+}
+
+// NewLog creates a new instance of Log keeping the given number of events
+func NewLog(size int) *Log {
+	if size < 1 {
+		size = 1
+	}
+	return &Log{mux: &sync.RWMutex{}, entries: make([]Event, size)}
+}
+
+// Add writes the event into the log, overwriting the oldest one if the log is full
+func (l *Log) Add(event Event) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.entries[l.next] = event
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Run writes the events of the subscription into the log until the subscription ends
+func (l *Log) Run(sub *Subscription) {
+	for event := range sub.Events() {
+		l.Add(event)
+	}
+}
+
+// Query returns the events of the log matching the query, from the oldest to the newest
+func (l *Log) Query(query Query) []Event {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	ordered := l.entries[:l.next]
+	if l.full {
+		ordered = append(append([]Event{}, l.entries[l.next:]...), ordered...)
+	}
+	matching := []Event{}
+	for _, event := range ordered {
+		if query.matches(event) {
+			matching = append(matching, event)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	t.Run("Should keep the last events only", func(t *testing.T) {
+		log := NewLog(3)
+		assert.Empty(t, log.Query(Query{}))
+		for i := 0; i < 5; i++ {
+			log.Add(New(Restarted, fmt.Sprint(i), "", ""))
+		}
+		ids := []string{}
+		for _, event := range log.Query(Query{}) {
+			ids = append(ids, event.StreamID)
+		}
+		assert.Equal(t, []string{"2", "3", "4"}, ids)
+	})
+
+	t.Run("Should be fed by the bus", func(t *testing.T) {
+		bus := NewBus(4)
+		log := NewLog(10)
+		done := make(chan struct{})
+		go func() {
+			log.Run(bus.Subscribe())
+			close(done)
+		}()
+		for bus.Subscribers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		bus.Publish(New(Started, "id", "/stream/id/index.m3u8", ""))
+		bus.Close()
+		<-done
+		events := log.Query(Query{})
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, Started, events[0].Type)
+			assert.Equal(t, LevelInfo, events[0].Level)
+		}
+	})
+}
+
+func TestLogQuery(t *testing.T) {
+	now := time.Now()
+	log := NewLog(10)
+	for i, event := range []Event{
+		New(Started, "first", "", ""),
+		New(Stalled, "first", "", ""),
+		New(Errored, "second", "", ""),
+		New(Unauthorized, "", "", "GET /list"),
+	} {
+		event.Timestamp = now.Add(time.Duration(i) * time.Minute)
+		log.Add(event)
+	}
+	tt := []struct {
+		Query    Query
+		Expected []Type
+	}{
+		{Query: Query{}, Expected: []Type{Started, Stalled, Errored, Unauthorized}},
+		{Query: Query{StreamID: "first"}, Expected: []Type{Started, Stalled}},
+		{Query: Query{Since: now.Add(time.Minute)}, Expected: []Type{Errored, Unauthorized}},
+		{Query: Query{Level: LevelWarning}, Expected: []Type{Stalled, Errored, Unauthorized}},
+		{Query: Query{Level: LevelError}, Expected: []Type{Errored}},
+		{Query: Query{StreamID: "first", Level: LevelError}, Expected: []Type{}},
+	}
+	for i, test := range tt {
+		types := []Type{}
+		for _, event := range log.Query(test.Query) {
+			types = append(types, event.Type)
+		}
+		if !assert.Equal(t, test.Expected, types) {
+			t.Error(fmt.Errorf("%d testcase is failing for the query of the log", i))
+		}
+	}
+}
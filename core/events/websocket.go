@@ -0,0 +1,100 @@
+package events
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// writeTimeout is the longest time a frame can take to be written to the client
+const writeTimeout = 10 * time.Second
+
+// maxFrameSize is the largest payload accepted from the clients, they are not expected to send messages
+const maxFrameSize = 4096
+
+// ErrNotWebSocket describes an error for requests that are not WebSocket handshakes
+var ErrNotWebSocket = errors.New("Request has to be a WebSocket handshake")
+
+// ErrHijackUnsupported describes an error for connections that cannot be taken over from the HTTP server
+var ErrHijackUnsupported = errors.New("Connection cannot be upgraded to WebSocket")
+
+// pingCodec sends the pings of the server, which are not covered by the codecs of the websocket package
+var pingCodec = websocket.Codec{Marshal: func(interface{}) ([]byte, byte, error) {
+	return nil, websocket.PingFrame, nil
+}}
+
+// Conn is a server side WebSocket connection that sends text messages to the client
+type Conn struct {
+	ws *websocket.Conn
+}
+
+// headerContains indicates if the comma separated header contains the token, ignoring the case
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Serve answers the WebSocket handshake of the request and passes the connection to the handler, it is closed once the handler returns.
+// Nothing is written to the response if the request is not a handshake, so the error can be sent the way of the API
+func Serve(w http.ResponseWriter, r *http.Request, handler func(conn *Conn)) error {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		return ErrNotWebSocket
+	}
+	if _, ok := w.(http.Hijacker); !ok {
+		return ErrHijackUnsupported
+	}
+	// The origin is not checked, the feed is protected like the other management endpoints and is used by non-browser clients too
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		ws.MaxPayloadBytes = maxFrameSize
+		conn := &Conn{ws}
+		defer conn.Close()
+		handler(conn)
+	}}.ServeHTTP(w, r)
+	return nil
+}
+
+// WriteText sends a text message to the client
+func (c *Conn) WriteText(message []byte) error {
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return websocket.Message.Send(c.ws, string(message))
+}
+
+// WritePing sends a ping to the client, so broken connections are detected
+func (c *Conn) WritePing() error {
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return pingCodec.Send(c.ws, nil)
+}
+
+// ReadLoop reads the frames of the client until it closes the connection or the connection breaks.
+// Pings are answered and the messages of the client are ignored
+func (c *Conn) ReadLoop() error {
+	for {
+		var message []byte
+		err := websocket.Message.Receive(c.ws, &message)
+		switch {
+		case err == io.EOF:
+			return nil
+		// The rest of the large messages is skipped by the next read
+		case err != nil && err != websocket.ErrFrameTooLarge:
+			return err
+		}
+	}
+}
+
+// Close sends a normal closure to the client and closes the underlying connection
+func (c *Conn) Close() error {
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.ws.Close()
+}
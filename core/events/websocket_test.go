@@ -0,0 +1,108 @@
+package events
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// dial opens a WebSocket connection to the server
+func dial(t *testing.T, server *httptest.Server) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	assert.Nil(t, err)
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", res.Header.Get("Sec-WebSocket-Accept"))
+	return conn, reader
+}
+
+// writeClientFrame writes a masked frame like the clients do
+func writeClientFrame(conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	if len(payload) >= 126 {
+		frame = []byte{0x80 | opcode, 0x80 | 126, 0, 0}
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+// readServerFrame reads an unmasked frame of the server
+func readServerFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(reader, header)
+	assert.Nil(t, err)
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(reader, extended)
+		assert.Nil(t, err)
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	assert.Nil(t, err)
+	return header[0] & 0x0f, payload
+}
+
+func TestServe(t *testing.T) {
+	readDone := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := Serve(w, r, func(conn *Conn) {
+			conn.WriteText([]byte(strings.Repeat("a", 200)))
+			conn.WritePing()
+			readDone <- conn.ReadLoop()
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Should refuse requests that are not handshakes", func(t *testing.T) {
+		res, err := http.Get(server.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Should send messages and answer pings until the client closes", func(t *testing.T) {
+		conn, reader := dial(t, server)
+		defer conn.Close()
+		opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, byte(websocket.TextFrame), opcode)
+		assert.Equal(t, strings.Repeat("a", 200), string(payload))
+		opcode, _ = readServerFrame(t, reader)
+		assert.Equal(t, byte(websocket.PingFrame), opcode)
+
+		writeClientFrame(conn, websocket.PingFrame, []byte("hello"))
+		opcode, payload = readServerFrame(t, reader)
+		assert.Equal(t, byte(websocket.PongFrame), opcode)
+		assert.Equal(t, "hello", string(payload))
+
+		// The messages of the client are skipped, even the ones that are too large
+		writeClientFrame(conn, websocket.TextFrame, []byte(strings.Repeat("b", 100)))
+		writeClientFrame(conn, websocket.TextFrame, []byte(strings.Repeat("c", maxFrameSize+1)))
+		writeClientFrame(conn, websocket.CloseFrame, nil)
+		assert.Nil(t, <-readDone)
+		opcode, payload = readServerFrame(t, reader)
+		assert.Equal(t, byte(websocket.CloseFrame), opcode)
+		assert.Equal(t, []byte{0x03, 0xe8}, payload)
+	})
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/webhooks"
+)
+
+// readEvent reads the next text frame of the event feed
+func readEvent(t *testing.T, reader *bufio.Reader) events.Event {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(reader, header)
+	assert.Nil(t, err)
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(reader, extended)
+		assert.Nil(t, err)
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	assert.Nil(t, err)
+	var event events.Event
+	assert.Nil(t, json.Unmarshal(payload, &event))
+	return event
+}
+
+func TestEventsHandler(t *testing.T) {
+	spec := config.InitConfig()
+	// The event log is a subscriber of its own, only the clients of the feed are counted
+	spec.EventLogSize = 0
+	ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	router := httprouter.New()
+	router.POST("/start", ctrls.StartStreamHandler)
+	router.GET("/events", ctrls.EventsHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Run("Should refuse requests that are not WebSocket handshakes", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/events")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Should push the events of the streams until the client leaves", func(t *testing.T) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		assert.Nil(t, err)
+		fmt.Fprintf(conn, "GET /events HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+			"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+		reader := bufio.NewReader(conn)
+		res, err := http.ReadResponse(reader, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+		for i := 0; i < 100 && ctrls.events.Subscribers() == 0; i++ {
+			<-time.After(time.Millisecond * 10)
+		}
+		assert.Equal(t, 1, ctrls.events.Subscribers())
+
+		b, err := json.Marshal(StreamDto{URI: generateURI()})
+		assert.Nil(t, err)
+		res, err = http.Post(server.URL+"/start", "application/json", bytes.NewBuffer(b))
+		assert.Nil(t, err)
+		var dto StreamDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&dto))
+		event := readEvent(t, reader)
+		assert.Equal(t, events.Started, event.Type)
+		assert.Equal(t, dto.ID, event.StreamID)
+
+		// Closing the connection ends the subscription
+		assert.Nil(t, conn.Close())
+		for i := 0; i < 100 && ctrls.events.Subscribers() > 0; i++ {
+			<-time.After(time.Millisecond * 10)
+		}
+		assert.Equal(t, 0, ctrls.events.Subscribers())
+	})
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	payloads := make(chan webhooks.Payload, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhooks.Payload
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	defer webhook.Close()
+	conf := *config.InitConfig()
+	conf.WebhookURLs = []string{webhook.URL}
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	ctrls.notifyWebhooks()
+	defer ctrls.Shutdown(context.Background())
+
+	b, err := json.Marshal(StreamDto{URI: generateURI()})
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	req := newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b))
+	ctrls.StartStreamHandler(rr, req, nil)
+	var dto StreamDto
+	assert.Nil(t, json.NewDecoder(rr.Body).Decode(&dto))
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, events.Started, payload.Event)
+		assert.Equal(t, dto.ID, payload.StreamID)
+		assert.Equal(t, dto.URI, payload.URI)
+	case <-time.After(time.Second):
+		t.Error("Webhook is not notified about the started stream")
+	}
+}
+
+func TestEventLogHandler(t *testing.T) {
+	// waitEvents waits until the log has taken the given number of events from the bus
+	waitEvents := func(ctrls *Controller, count int) {
+		for i := 0; i < 100 && len(ctrls.eventLog.Query(events.Query{})) < count; i++ {
+			<-time.After(time.Millisecond * 10)
+		}
+	}
+
+	t.Run("Should list the events of the bus with the filters of the query", func(t *testing.T) {
+		ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		router := httprouter.New()
+		router.POST("/start", ctrls.StartStreamHandler)
+		router.GET("/events/log", ctrls.EventLogHandler)
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		b, err := json.Marshal(StreamDto{URI: generateURI()})
+		assert.Nil(t, err)
+		res, err := http.Post(server.URL+"/start", "application/json", bytes.NewBuffer(b))
+		assert.Nil(t, err)
+		var dto StreamDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&dto))
+		strm, _ := ctrls.getStream(dto.ID)
+		ctrls.publish(events.Errored, dto.ID, strm, "exit status 1")
+		ctrls.events.Publish(events.New(events.Restarted, "other", "/stream/other/index.m3u8", ""))
+		waitEvents(ctrls, 3)
+
+		tt := []struct {
+			Query    string
+			Expected []events.Type
+		}{
+			{Query: "", Expected: []events.Type{events.Started, events.Errored, events.Restarted}},
+			{Query: "?stream=" + dto.ID, Expected: []events.Type{events.Started, events.Errored}},
+			{Query: "?level=error", Expected: []events.Type{events.Errored}},
+			{Query: "?since=1m", Expected: []events.Type{events.Started, events.Errored, events.Restarted}},
+			{Query: "?since=" + time.Now().Add(time.Minute).Format(time.RFC3339), Expected: []events.Type{}},
+		}
+		for i, test := range tt {
+			res, err := http.Get(server.URL + "/events/log" + test.Query)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			var list []events.Event
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&list))
+			types := []events.Type{}
+			for _, event := range list {
+				types = append(types, event.Type)
+			}
+			if !assert.Equal(t, test.Expected, types) {
+				t.Error(fmt.Errorf("%d testcase is failing for the event log", i))
+			}
+		}
+
+		for _, query := range []string{"?level=debug", "?since=yesterday", "?since=-5m"} {
+			res, err := http.Get(server.URL + "/events/log" + query)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		}
+	})
+
+	t.Run("Should log the requests refused by the authentication", func(t *testing.T) {
+		spec := config.InitConfig()
+		spec.JWTEnabled = true
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/list", nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		ctrls.ListStreamHandler(rr, r, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		waitEvents(ctrls, 1)
+
+		list := ctrls.eventLog.Query(events.Query{Level: events.LevelWarning})
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, events.Unauthorized, list[0].Type)
+			assert.Contains(t, list[0].Details, "GET /list from ")
+			assert.NotContains(t, list[0].Details, "secret")
+		}
+	})
+}
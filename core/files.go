@@ -0,0 +1,115 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// ErrFileNotFound is sent when the requested file is not one of the files of the streams
+var ErrFileNotFound = errors.New("File not found")
+
+// streamFileExtensions are the extensions of the files created for the streams with their content types
+var streamFileExtensions = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+	".vtt":  "text/vtt",
+	".jpg":  "image/jpeg",
+}
+
+// streamContentType returns the content type of the file of a stream, empty if it is not a file of the streams
+func streamContentType(path string) string {
+	return streamFileExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// isStreamFile is for deciding if the requested path can be one of the files of a stream.
+// Paths with parent references or without a stream directory are refused, key files
+// are only allowed if the streams are encrypted
+func isStreamFile(path string, keys bool) bool {
+	if strings.ContainsAny(path, "\\\x00") {
+		return false
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	return streamFileExtensions[ext] != "" || (keys && ext == ".key")
+}
+
+// isThumbnail is for deciding if the requested file is the poster image of a stream
+func isThumbnail(path string) bool {
+	return filepath.Base(path) == streaming.ThumbnailFile
+}
+
+// storeFileSystem serves the files of the store directory. Directories are not listed
+// and files resolving outside the directory through symlinks are not found
+type storeFileSystem struct {
+	root string
+}
+
+// Type check
+var _ http.FileSystem = (*storeFileSystem)(nil)
+
+// newStoreFileSystem creates a new instance of storeFileSystem
+func newStoreFileSystem(root string) *storeFileSystem {
+	return &storeFileSystem{root}
+}
+
+// Open opens the file of the store directory with the given name
+func (fs storeFileSystem) Open(name string) (http.File, error) {
+	if !isInsideDir(fs.root, name) {
+		return nil, os.ErrNotExist
+	}
+	file, err := http.Dir(fs.root).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
+
+// isInsideDir checks if the file with the given slash separated name
+// is inside the directory after resolving its symlinks
+func isInsideDir(dir, name string) bool {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return false
+	}
+	path := filepath.Join(dir, filepath.FromSlash(filepath.Clean("/"+name)))
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	if resolved, err = filepath.Abs(resolved); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsStreamFile(t *testing.T) {
+	tt := []struct {
+		Input   string
+		Keys    bool
+		Allowed bool
+	}{
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/index.m3u8", Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/720p/0.ts", Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/0.m4s", Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/subtitles.vtt", Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/thumb.jpg", Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/init.mp4", Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/INDEX.M3U8", Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/enc.key", Keys: true, Allowed: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/enc.key", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/enc.keyinfo", Keys: true, Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015", Allowed: false},
+		{Input: "/index.m3u8", Allowed: false},
+		{Input: "/", Allowed: false},
+		{Input: "/../../etc/passwd", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/../../index.m3u8", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/..", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/./index.m3u8", Allowed: false},
+		{Input: "//etc/index.m3u8", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/..\\..\\index.m3u8", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/index.m3u8\x00.txt", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/streams.json", Allowed: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/index.m3u8.bak", Allowed: false},
+	}
+
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Allowed, isStreamFile(testCase.Input, testCase.Keys)) {
+			t.Error(fmt.Errorf("%d testcase is failing for %q", i, testCase.Input))
+		}
+	}
+}
+
+func TestStoreFileSystem(t *testing.T) {
+	root, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", "outside")
+	assert.Nil(t, err)
+	defer os.RemoveAll(outside)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "id"), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "id", "index.m3u8"), []byte("#EXTM3U"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(outside, "secret.m3u8"), []byte("secret"), 0644))
+	assert.Nil(t, os.Symlink(filepath.Join(outside, "secret.m3u8"), filepath.Join(root, "id", "link.m3u8")))
+	assert.Nil(t, os.Symlink(outside, filepath.Join(root, "linked")))
+	assert.Nil(t, os.Symlink(filepath.Join(root, "id", "index.m3u8"), filepath.Join(root, "id", "inner.m3u8")))
+
+	server := httptest.NewServer(http.FileServer(newStoreFileSystem(root)))
+	defer server.Close()
+
+	tt := []struct {
+		Path   string
+		Status int
+	}{
+		{Path: "/id/index.m3u8", Status: http.StatusOK},
+		{Path: "/id/inner.m3u8", Status: http.StatusOK},
+		{Path: "/id/link.m3u8", Status: http.StatusNotFound},
+		{Path: "/linked/secret.m3u8", Status: http.StatusNotFound},
+		{Path: "/id/", Status: http.StatusNotFound},
+		{Path: "/", Status: http.StatusNotFound},
+		{Path: "/id/missing.m3u8", Status: http.StatusNotFound},
+	}
+
+	for i, testCase := range tt {
+		res, err := http.Get(server.URL + testCase.Path)
+		assert.Nil(t, err)
+		if !assert.Equal(t, testCase.Status, res.StatusCode) {
+			t.Error(fmt.Errorf("%d testcase is failing for %s", i, testCase.Path))
+		}
+	}
+}
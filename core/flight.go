@@ -0,0 +1,129 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// flightCall describes a call in progress that concurrent callers of the same key wait for
+type flightCall struct {
+	wg     *sync.WaitGroup
+	status int
+	err    error
+}
+
+// flightGroup deduplicates concurrent calls with the same key, so only the first one
+// is executed and the rest receive its result
+type flightGroup struct {
+	mux   *sync.Mutex
+	calls map[string]*flightCall
+}
+
+// newFlightGroup creates a new instance of flightGroup
+func newFlightGroup() *flightGroup {
+	return &flightGroup{&sync.Mutex{}, map[string]*flightCall{}}
+}
+
+// do executes the function if there is no call in progress for the key,
+// otherwise waits for that call and returns its result
+func (g *flightGroup) do(key string, fn func() (int, error)) (int, error) {
+	g.mux.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mux.Unlock()
+		call.wg.Wait()
+		return call.status, call.err
+	}
+	call := &flightCall{wg: &sync.WaitGroup{}}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mux.Unlock()
+
+	call.status, call.err = fn()
+	g.mux.Lock()
+	delete(g.calls, key)
+	g.mux.Unlock()
+	call.wg.Done()
+	return call.status, call.err
+}
+
+// busyGroup marks the keys with a call in progress, so concurrent calls of the same key are refused instead of waiting
+type busyGroup struct {
+	mux  *sync.Mutex
+	keys map[string]bool
+}
+
+// newBusyGroup creates a new instance of busyGroup
+func newBusyGroup() *busyGroup {
+	return &busyGroup{&sync.Mutex{}, map[string]bool{}}
+}
+
+// begin marks the key as busy, returns false if it is busy already
+func (g *busyGroup) begin(key string) bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.keys[key] {
+		return false
+	}
+	g.keys[key] = true
+	return true
+}
+
+// end marks the key as free again
+func (g *busyGroup) end(key string) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	delete(g.keys, key)
+}
+
+// busy indicates if there is a call in progress for the key
+func (g *busyGroup) busy(key string) bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return g.keys[key]
+}
+
+// spawnGate keeps the transcoders from being spawned while every stream is stopped. The spawns hold it while they run,
+// closing it waits for the spawns in progress and refuses the new ones until it is opened again
+type spawnGate struct {
+	mux    *sync.RWMutex
+	closed int32
+}
+
+// newSpawnGate creates a new instance of spawnGate
+func newSpawnGate() *spawnGate {
+	return &spawnGate{mux: &sync.RWMutex{}}
+}
+
+// enter returns false if the gate is closed, otherwise leave has to be called once the spawn is done
+func (g *spawnGate) enter() bool {
+	if atomic.LoadInt32(&g.closed) == 1 {
+		return false
+	}
+	g.mux.RLock()
+	// The gate could have been closed while the spawn was waiting for it
+	if atomic.LoadInt32(&g.closed) == 1 {
+		g.mux.RUnlock()
+		return false
+	}
+	return true
+}
+
+// leave ends the spawn that entered the gate
+func (g *spawnGate) leave() {
+	g.mux.RUnlock()
+}
+
+// close refuses the new spawns and waits for the ones in progress, returns false if the gate is closed already
+func (g *spawnGate) close() bool {
+	if !atomic.CompareAndSwapInt32(&g.closed, 0, 1) {
+		return false
+	}
+	g.mux.Lock()
+	return true
+}
+
+// open lets the spawns in again
+func (g *spawnGate) open() {
+	g.mux.Unlock()
+	atomic.StoreInt32(&g.closed, 0)
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlightGroup(t *testing.T) {
+	t.Run("Should execute concurrent calls of the same key once", func(t *testing.T) {
+		group := newFlightGroup()
+		var calls int32
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		errs := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status, err := group.do("id", func() (int, error) {
+					atomic.AddInt32(&calls, 1)
+					<-release
+					return http.StatusInternalServerError, ErrUnexpected
+				})
+				assert.Equal(t, http.StatusInternalServerError, status)
+				errs <- err
+			}()
+		}
+		<-time.After(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(errs)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		for err := range errs {
+			assert.Equal(t, ErrUnexpected, err)
+		}
+	})
+
+	t.Run("Should execute calls again after the previous one finished", func(t *testing.T) {
+		group := newFlightGroup()
+		_, err := group.do("id", func() (int, error) { return http.StatusRequestTimeout, ErrTimeout })
+		assert.Equal(t, ErrTimeout, err)
+		status, err := group.do("id", func() (int, error) { return http.StatusOK, nil })
+		assert.Equal(t, http.StatusOK, status)
+		assert.Nil(t, err)
+		_, err = group.do("other", func() (int, error) { return http.StatusBadRequest, errors.New("other") })
+		assert.EqualError(t, err, "other")
+		assert.Len(t, group.calls, 0)
+	})
+}
+
+func TestBusyGroup(t *testing.T) {
+	group := newBusyGroup()
+	assert.False(t, group.busy("id"))
+	assert.True(t, group.begin("id"))
+	assert.True(t, group.busy("id"))
+	assert.False(t, group.begin("id"))
+	assert.True(t, group.begin("other"))
+	group.end("id")
+	assert.False(t, group.busy("id"))
+	assert.True(t, group.begin("id"))
+}
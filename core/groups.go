@@ -0,0 +1,243 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// GroupDto describes a group of streams with the number of its members
+type GroupDto struct {
+	Name    string `json:"name"`
+	Streams int    `json:"streams"`
+	Running int    `json:"running"` // Number of the members being transcoded
+}
+
+// StreamGroupDto describes the group of a stream, given as null or empty to remove the stream from its group
+type StreamGroupDto struct {
+	Group *string `json:"group"`
+}
+
+// GroupResultDto describes the outcome of the operation of a group for one of its streams, either the stream or the error
+type GroupResultDto struct {
+	ID     string        `json:"id"`
+	Status int           `json:"status"`
+	Stream *StreamDto    `json:"stream,omitempty"`
+	Error  *ErrorBodyDto `json:"error,omitempty"`
+}
+
+// validateGroup checks if the name of the group can be used in the paths of the group endpoints like an alias, empty groups are accepted
+func validateGroup(group string) error {
+	if group != "" && !aliasPattern.MatchString(group) {
+		return ErrInvalidGroup
+	}
+	return nil
+}
+
+// setGroup moves the stream into the group of the start request, if it has any
+func (c *Controller) setGroup(strm *streaming.Stream, group string) {
+	if group == "" {
+		return
+	}
+	strm.SetGroup(group)
+	c.persist()
+}
+
+// groupMembers returns the ids of the streams of the group in order, with the streams keyed by their id
+func (c *Controller) groupMembers(group string) ([]string, map[string]*streaming.Stream) {
+	ids := []string{}
+	members := map[string]*streaming.Stream{}
+	for id, strm := range c.snapshotStreams() {
+		if strm.GetGroup() == group {
+			ids = append(ids, id)
+			members[id] = strm
+		}
+	}
+	sort.Strings(ids)
+	return ids, members
+}
+
+// groupResult creates the result of a member of the group from the outcome of its operation
+func groupResult(id string, dto *StreamDto, status int, err error) GroupResultDto {
+	result := GroupResultDto{ID: id, Status: status}
+	if err != nil {
+		result.Error = &ErrorBodyDto{errorCode(err, status), streaming.RedactURI(err.Error()), ""}
+		return result
+	}
+	result.Stream = dto
+	return result
+}
+
+// groupOperation runs the operation for every member of the group of the request, BATCH_PARALLELISM at a time.
+// A failed member does not stop the others, the results are sent in the order of the ids with 207 Multi-Status if any of them failed
+func (c *Controller) groupOperation(w http.ResponseWriter, r *http.Request, group string, operation func(ctx context.Context, id string) GroupResultDto) {
+	ids, _ := c.groupMembers(group)
+	if len(ids) == 0 {
+		c.SendError(w, ErrNoGroup, http.StatusNotFound)
+		return
+	}
+	results := make([]GroupResultDto, len(ids))
+	c.inParallel(len(ids), func(i int) {
+		results[i] = operation(r.Context(), ids[i])
+	})
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Error != nil {
+			status = http.StatusMultiStatus
+		}
+	}
+	b, _ := json.Marshal(results)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// GroupsHandler is the HTTP handler of the GET /groups call, which lists the groups of the streams by their name
+func (c *Controller) GroupsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	counts := map[string]*GroupDto{}
+	for _, strm := range c.snapshotStreams() {
+		group := strm.GetGroup()
+		if group == "" {
+			continue
+		}
+		if counts[group] == nil {
+			counts[group] = &GroupDto{Name: group}
+		}
+		counts[group].Streams++
+		if strm.Streak.IsActive() {
+			counts[group].Running++
+		}
+	}
+	dto := []GroupDto{}
+	for _, group := range counts {
+		dto = append(dto, *group)
+	}
+	sort.Slice(dto, func(i, j int) bool { return dto[i].Name < dto[j].Name })
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// GroupListHandler is the HTTP handler of the GET /groups/:name/list call, which lists the streams of the group like /list.
+// Unknown groups have no streams
+func (c *Controller) GroupListHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	verbose := false
+	if value := r.URL.Query().Get("verbose"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.SendError(w, ErrInvalidListQuery, http.StatusBadRequest)
+			return
+		}
+		verbose = parsed
+	}
+	r, err := withAbsolute(r)
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	ids, members := c.groupMembers(ps.ByName("name"))
+	dto := []*SummariseDto{}
+	for _, id := range ids {
+		dto = append(dto, c.listItem(r.Context(), id, members[id], verbose))
+	}
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// GroupStopHandler is the HTTP handler of the POST /groups/:name/stop call, which stops and removes every stream of the group
+// like DELETE /stream/:id
+func (c *Controller) GroupStopHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	keepRecordings := c.spec().KeepRecordings
+	if value := r.URL.Query().Get("keepRecordings"); value != "" {
+		keep, err := strconv.ParseBool(value)
+		if err != nil {
+			c.SendError(w, ErrInvalidKeepRecordings, http.StatusBadRequest)
+			return
+		}
+		keepRecordings = keep
+	}
+	group := ps.ByName("name")
+	c.logger(r.Context()).Infof("Group %s is getting stopped%s", group, requestedBy(apiKeyName(r)))
+	c.groupOperation(w, r, group, func(ctx context.Context, id string) GroupResultDto {
+		status, err := c.stopStream(ctx, id, keepRecordings)
+		return groupResult(id, nil, status, err)
+	})
+}
+
+// GroupRestartHandler is the HTTP handler of the POST /groups/:name/restart call, which restarts the transcoding of every
+// stream of the group like POST /restart/:id
+func (c *Controller) GroupRestartHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	wipe := false
+	if value := r.URL.Query().Get("wipe"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.SendError(w, ErrInvalidWipe, http.StatusBadRequest)
+			return
+		}
+		wipe = parsed
+	}
+	group := ps.ByName("name")
+	c.logger(r.Context()).Infof("Group %s is getting restarted%s", group, requestedBy(apiKeyName(r)))
+	c.groupOperation(w, r, group, func(ctx context.Context, id string) GroupResultDto {
+		dto, status, err := c.restartStream(ctx, id, wipe)
+		return groupResult(id, &dto, status, err)
+	})
+}
+
+// GroupHandler is the HTTP handler of the PATCH /stream/:id/group call. It moves the stream into the group of the body,
+// or removes it from its group if the group is null or empty. The transcoding is not affected
+func (c *Controller) GroupHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	var dto StreamGroupDto
+	if err := json.Unmarshal(body, &dto); err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	group := ""
+	if dto.Group != nil {
+		group = *dto.Group
+	}
+	if err := validateGroup(group); err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	strm.SetGroup(group)
+	c.persist()
+	c.logger(r.Context()).Infof("Group of %s is set to %q%s", id, group, requestedBy(apiKeyName(r)))
+	b, _ := json.Marshal(StreamGroupDto{&group})
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestValidateGroup(t *testing.T) {
+	tt := []struct {
+		Group string
+		Err   error
+	}{
+		{Group: "", Err: nil},
+		{Group: "lobby", Err: nil},
+		{Group: "north_building-1", Err: nil},
+		{Group: "-lobby", Err: ErrInvalidGroup},
+		{Group: "lobby/north", Err: ErrInvalidGroup},
+		{Group: strings.Repeat("g", 65), Err: ErrInvalidGroup},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Err, validateGroup(testCase.Group)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestValidateGroup", i))
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	setup := func(conf *config.Specification) (*Controller, []*generatedStream) {
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		generated := []*generatedStream{}
+		for i, group := range []string{"lobby", "lobby", "garage", ""} {
+			strm := generateStream(nil, fmt.Sprintf("rtsp://192.168.0.%d/live", 10+i))
+			strm.strm.Group = group
+			ctrls.streams[strm.dirPath] = &strm.strm
+			generated = append(generated, &strm)
+		}
+		generated[0].strm.Streak.Activate()
+		return ctrls, generated
+	}
+	groupCall := func(handle httprouter.Handle, method, group, query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handle(rr, httptest.NewRequest(method, "/groups/"+group+query, nil), httprouter.Params{{Key: "name", Value: group}})
+		return rr
+	}
+
+	t.Run("Should store the group of the start request", func(t *testing.T) {
+		ctrls, _ := setup(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		for _, test := range []struct {
+			Group  string
+			Status int
+		}{{"lobby/north", http.StatusBadRequest}, {"lobby", http.StatusOK}} {
+			b, _ := json.Marshal(StreamDto{URI: "rtsp://192.168.0.20/live", Group: test.Group})
+			rr := httptest.NewRecorder()
+			ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+			assert.Equal(t, test.Status, rr.Code)
+		}
+		id, _ := streaming.GetURIDirectory("rtsp://192.168.0.20/live")
+		strm, ok := ctrls.getStream(id)
+		if assert.True(t, ok) {
+			assert.Equal(t, "lobby", strm.GetGroup())
+		}
+	})
+
+	t.Run("Should list the groups with their members", func(t *testing.T) {
+		ctrls, generated := setup(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		rr := httptest.NewRecorder()
+		ctrls.GroupsHandler(rr, httptest.NewRequest(http.MethodGet, "/groups", nil), nil)
+		var groups []GroupDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &groups))
+		assert.Equal(t, []GroupDto{{Name: "garage", Streams: 1}, {Name: "lobby", Streams: 2, Running: 1}}, groups)
+
+		rr = groupCall(ctrls.GroupListHandler, http.MethodGet, "lobby", "/list")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list []SummariseDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		if assert.Len(t, list, 2) {
+			for _, item := range list {
+				assert.Equal(t, "lobby", item.Group)
+			}
+		}
+		assert.Contains(t, []string{list[0].ID, list[1].ID}, generated[1].dirPath)
+
+		rr = groupCall(ctrls.GroupListHandler, http.MethodGet, "unknown", "/list")
+		assert.Equal(t, "[]", rr.Body.String())
+		assert.Equal(t, http.StatusBadRequest, groupCall(ctrls.GroupListHandler, http.MethodGet, "lobby", "/list?verbose=maybe").Code)
+	})
+
+	t.Run("Should move the stream between the groups", func(t *testing.T) {
+		ctrls, generated := setup(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		patch := func(id, body string) int {
+			rr := httptest.NewRecorder()
+			ctrls.GroupHandler(rr, httptest.NewRequest(http.MethodPatch, "/stream/"+id+"/group", bytes.NewBufferString(body)), httprouter.Params{{Key: "id", Value: id}})
+			return rr.Code
+		}
+		id := generated[3].dirPath
+		assert.Equal(t, http.StatusOK, patch(id, `{"group": "garage"}`))
+		assert.Equal(t, "garage", generated[3].strm.GetGroup())
+		assert.Equal(t, http.StatusOK, patch(id, `{"group": null}`))
+		assert.Equal(t, "", generated[3].strm.GetGroup())
+		assert.Equal(t, http.StatusBadRequest, patch(id, `{"group": "garage/north"}`))
+		assert.Equal(t, http.StatusBadRequest, patch(id, `not json`))
+		assert.Equal(t, http.StatusNotFound, patch("unknown", `{"group": "garage"}`))
+	})
+
+	t.Run("Should restart the members and report the failing ones", func(t *testing.T) {
+		ctrls, generated := setup(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		assert.True(t, ctrls.restarting.begin(generated[1].dirPath))
+		rr := groupCall(ctrls.GroupRestartHandler, http.MethodPost, "lobby", "/restart")
+		assert.Equal(t, http.StatusMultiStatus, rr.Code)
+		var results []GroupResultDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &results))
+		if assert.Len(t, results, 2) {
+			for _, result := range results {
+				if result.ID == generated[1].dirPath {
+					assert.Equal(t, http.StatusConflict, result.Status)
+					assert.Nil(t, result.Stream)
+					if assert.NotNil(t, result.Error) {
+						assert.Equal(t, "stream_already_active", result.Error.Code)
+					}
+					continue
+				}
+				assert.Equal(t, http.StatusOK, result.Status)
+				assert.NotNil(t, result.Stream)
+			}
+		}
+		ctrls.restarting.end(generated[1].dirPath)
+		assert.Equal(t, http.StatusOK, groupCall(ctrls.GroupRestartHandler, http.MethodPost, "lobby", "/restart").Code)
+		assert.Equal(t, http.StatusBadRequest, groupCall(ctrls.GroupRestartHandler, http.MethodPost, "lobby", "/restart?wipe=maybe").Code)
+		assert.Equal(t, http.StatusNotFound, groupCall(ctrls.GroupRestartHandler, http.MethodPost, "unknown", "/restart").Code)
+	})
+
+	t.Run("Should stop every member of the group", func(t *testing.T) {
+		conf := config.InitConfig()
+		conf.BatchParallelism = 1
+		ctrls, generated := setup(conf)
+		defer ctrls.Shutdown(context.Background())
+		assert.Equal(t, http.StatusBadRequest, groupCall(ctrls.GroupStopHandler, http.MethodPost, "lobby", "/stop?keepRecordings=maybe").Code)
+		rr := groupCall(ctrls.GroupStopHandler, http.MethodPost, "lobby", "/stop")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var results []GroupResultDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &results))
+		assert.Len(t, results, 2)
+		for _, strm := range generated[:2] {
+			_, ok := ctrls.getStream(strm.dirPath)
+			assert.False(t, ok)
+		}
+		assert.Len(t, ctrls.snapshotStreams(), 2)
+		assert.Equal(t, http.StatusNotFound, groupCall(ctrls.GroupStopHandler, http.MethodPost, "lobby", "/stop").Code)
+	})
+
+	t.Run("Should persist the group of the streams", func(t *testing.T) {
+		storeDir := "./test"
+		defer os.RemoveAll(storeDir)
+		conf := config.InitConfig()
+		conf.Persistence = config.Persistence{Enabled: true, Path: filepath.Join(storeDir, "state", "streams.json"), PersistenceKey: persistenceKey}
+		ctrls, generated := setup(conf)
+		defer ctrls.Shutdown(context.Background())
+		generated[2].strm.StorePath = filepath.Join(storeDir, generated[2].dirPath)
+		assert.Nil(t, os.MkdirAll(generated[2].strm.StorePath, os.ModePerm))
+		ctrls.persist()
+		records, err := newStore(conf.Persistence).Load()
+		assert.Nil(t, err)
+		groups := map[string]string{}
+		for _, record := range records {
+			groups[record.ID] = record.Group
+		}
+		assert.Equal(t, "garage", groups[generated[2].dirPath])
+
+		ctrls = NewController(conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.processor = mockProcessor{}
+		ctrls.recoverStreams()
+		strm, ok := ctrls.getStream(generated[2].dirPath)
+		if assert.True(t, ok) {
+			assert.Equal(t, "garage", strm.GetGroup())
+		}
+	})
+}
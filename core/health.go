@@ -0,0 +1,155 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// HealthHealthy describes streams that are running and still writing segments
+const HealthHealthy = "healthy"
+
+// HealthStopped describes streams that are not running, because nobody watches them
+const HealthStopped = "stopped"
+
+// HealthStalled describes streams whose process is gone or stopped writing segments while it should run
+const HealthStalled = "stalled"
+
+// HealthErrored describes streams whose restarts after crashes were exhausted
+const HealthErrored = "errored"
+
+// HealthDto describes the health of the service
+type HealthDto struct {
+	Streams        int  `json:"streams"`
+	ActiveStreams  int  `json:"activeStreams"`
+	StalledStreams int  `json:"stalledStreams"`
+	StoreWritable  bool `json:"storeWritable"`
+}
+
+// StreamHealthDto describes the health of a given stream
+type StreamHealthDto struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	ProcessAlive bool       `json:"processAlive"`
+	LastUpdated  *time.Time `json:"lastUpdated"`
+}
+
+// healthCache keeps the results of the health checks of the streams for a short time,
+// so frequent probes do not have to check the files of every stream
+type healthCache struct {
+	mux     *sync.Mutex
+	ttl     time.Duration
+	entries map[string]healthEntry
+}
+
+// healthEntry describes a cached health check
+type healthEntry struct {
+	health    StreamHealthDto
+	checkedAt time.Time
+}
+
+// newHealthCache creates a new instance of healthCache
+func newHealthCache(ttl time.Duration) *healthCache {
+	return &healthCache{&sync.Mutex{}, ttl, map[string]healthEntry{}}
+}
+
+// get returns the health of the stream, checking it again if the cached result is expired
+func (h *healthCache) get(id string, strm *streaming.Stream, maxAge time.Duration) StreamHealthDto {
+	h.mux.Lock()
+	entry, ok := h.entries[id]
+	h.mux.Unlock()
+	if ok && time.Since(entry.checkedAt) < h.ttl {
+		return entry.health
+	}
+	health := checkHealth(id, strm, maxAge)
+	h.mux.Lock()
+	h.entries[id] = healthEntry{health, time.Now()}
+	h.mux.Unlock()
+	return health
+}
+
+// prune removes the cached results of streams that are not registered anymore
+func (h *healthCache) prune(streams map[string]*streaming.Stream) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for id := range h.entries {
+		if _, ok := streams[id]; !ok {
+			delete(h.entries, id)
+		}
+	}
+}
+
+// checkHealth checks if the process of the stream is alive and its playlist is fresh
+func checkHealth(id string, strm *streaming.Stream, maxAge time.Duration) StreamHealthDto {
+	health := StreamHealthDto{ID: id, ProcessAlive: strm.IsProcessAlive()}
+	if info, err := os.Stat(strm.MediaPlaylistFile()); err == nil {
+		modified := info.ModTime()
+		health.LastUpdated = &modified
+	}
+	switch {
+	case strm.IsErrored():
+		health.Status = HealthErrored
+	case !strm.Streak.IsActive() && !health.ProcessAlive:
+		health.Status = HealthStopped
+	case !health.ProcessAlive || health.LastUpdated == nil || time.Since(*health.LastUpdated) > maxAge:
+		health.Status = HealthStalled
+	default:
+		health.Status = HealthHealthy
+	}
+	return health
+}
+
+// isWritable checks if files can be created in the given directory
+func isWritable(dir string) bool {
+	file, err := ioutil.TempFile(dir, ".health")
+	if err != nil {
+		logrus.Errorf("%s is not writable || Error: %s", dir, err)
+		return false
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return true
+}
+
+// HealthHandler is the HTTP handler of the /health call
+func (c *Controller) HealthHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	streams := c.snapshotStreams()
+	c.health.prune(streams)
+	dto := HealthDto{Streams: len(streams), StoreWritable: isWritable(c.spec().StoreDir)}
+	for id, strm := range streams {
+		if strm.Streak.IsActive() {
+			dto.ActiveStreams++
+		}
+		if status := c.health.get(id, strm, c.spec().HealthMaxAge).Status; status == HealthStalled || status == HealthErrored {
+			dto.StalledStreams++
+		}
+	}
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// StreamHealthHandler is the HTTP handler of the /health/:id call.
+// It responds with 503 if the stream is stalled or errored
+func (c *Controller) StreamHealthHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	health := c.health.get(id, strm, c.spec().HealthMaxAge)
+	b, _ := json.Marshal(health)
+	w.Header().Add("Content-Type", "application/json")
+	if health.Status == HealthStalled || health.Status == HealthErrored {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(b)
+}
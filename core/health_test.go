@@ -0,0 +1,98 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	storeDir := "./test"
+	assert.Nil(t, os.MkdirAll(storeDir, os.ModePerm))
+	defer os.RemoveAll(storeDir)
+	conf := config.InitConfig()
+	conf.StoreDir = storeDir
+	conf.HealthMaxAge = time.Second * 30
+	conf.HealthCacheTTL = time.Minute
+	ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+	router := httprouter.New()
+	router.GET("/health", ctrls.HealthHandler)
+	router.GET("/health/:id", ctrls.StreamHealthHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	newStream := func(running bool, age time.Duration) string {
+		generated := generateStream(nil, "")
+		generated.strm.StorePath = filepath.Join(storeDir, generated.dirPath)
+		assert.Nil(t, os.MkdirAll(generated.strm.StorePath, os.ModePerm))
+		playlist := generated.strm.PlaylistFile()
+		assert.Nil(t, ioutil.WriteFile(playlist, []byte("#EXTM3U"), os.ModePerm))
+		modified := time.Now().Add(-age)
+		assert.Nil(t, os.Chtimes(playlist, modified, modified))
+		if running {
+			generated.strm.Streak.Activate()
+			startFake(&generated.strm)
+		}
+		ctrls.setStream(generated.dirPath, &generated.strm)
+		return generated.dirPath
+	}
+	getHealth := func(path string, dto interface{}) int {
+		res, err := http.Get(fmt.Sprintf("%s%s", server.URL, path))
+		assert.Nil(t, err)
+		b, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(b, dto))
+		return res.StatusCode
+	}
+
+	healthy := newStream(true, 0)
+	stalled := newStream(true, time.Minute)
+	stopped := newStream(false, time.Hour)
+	defer func() {
+		for _, strm := range ctrls.snapshotStreams() {
+			strm.CleanProcess()
+		}
+	}()
+
+	tt := []struct {
+		ID     string
+		Code   int
+		Status string
+	}{
+		{ID: healthy, Code: http.StatusOK, Status: HealthHealthy},
+		{ID: stalled, Code: http.StatusServiceUnavailable, Status: HealthStalled},
+		{ID: stopped, Code: http.StatusOK, Status: HealthStopped},
+	}
+	for i, testCase := range tt {
+		var dto StreamHealthDto
+		code := getHealth(fmt.Sprintf("/health/%s", testCase.ID), &dto)
+		if !assert.Equal(t, testCase.Code, code) || !assert.Equal(t, testCase.Status, dto.Status) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestHealth", i))
+		}
+	}
+
+	var summary HealthDto
+	assert.Equal(t, http.StatusOK, getHealth("/health", &summary))
+	assert.Equal(t, HealthDto{Streams: 3, ActiveStreams: 2, StalledStreams: 1, StoreWritable: true}, summary)
+
+	// Results are reused until they expire
+	strm, _ := ctrls.getStream(healthy)
+	assert.Nil(t, strm.CleanProcess())
+	var dto StreamHealthDto
+	assert.Equal(t, http.StatusOK, getHealth(fmt.Sprintf("/health/%s", healthy), &dto))
+	assert.Equal(t, HealthHealthy, dto.Status)
+
+	var missing ErrorDto
+	assert.Equal(t, http.StatusNotFound, getHealth("/health/unknown", &missing))
+	assert.Equal(t, "stream_not_found", missing.Error.Code)
+}
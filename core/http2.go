@@ -0,0 +1,29 @@
+package core
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// ConfigureHTTP2 sets up the HTTP/2 connections of the server. With TLS the clients negotiate HTTP/2 during the handshake,
+// so the TLSConfig of the server has to be set before. Without TLS HTTP/2 is only served in prior knowledge or upgraded
+// from HTTP/1.1 if h2c is enabled, other requests keep using HTTP/1.1 like the WebSocket of the events.
+// The data of the responses is sent by the default round robin scheduler, so the segments stuck on the flow control
+// windows of slow clients do not hold up the other requests of the connection, like the next playlist
+func ConfigureHTTP2(server *http.Server, spec *config.Specification) error {
+	h2 := &http2.Server{
+		MaxConcurrentStreams: spec.HTTP2MaxStreams,
+		IdleTimeout:          spec.HTTP2IdleTimeout,
+	}
+	if spec.TLS.Enabled() {
+		return http2.ConfigureServer(server, h2)
+	}
+	if spec.H2CEnabled {
+		server.Handler = h2c.NewHandler(server.Handler, h2)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestHTTP2(t *testing.T) {
+	playlist := []byte("#EXTM3U\n#EXT-X-TARGETDURATION:1\n0.ts\n")
+	// The segment is larger than the flow control window of a single stream of the client
+	segment := bytes.Repeat([]byte("segment!"), 1<<20)
+	setup := func(conf *config.Specification) (*httptest.Server, string, func()) {
+		storeDir, _ := ioutil.TempDir("", "http2")
+		ctrls := NewController(conf, WithFileServer(cacheHandler(conf.Cache, storeDir, http.FileServer(newStoreFileSystem(storeDir)))))
+		generated := generateStream(nil, "")
+		generated.strm.Streak.Activate()
+		ctrls.setStream(generated.dirPath, &generated.strm)
+		assert.Nil(t, os.MkdirAll(filepath.Join(storeDir, generated.dirPath), os.ModePerm))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(storeDir, generated.dirPath, "index.m3u8"), playlist, 0644))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(storeDir, generated.dirPath, "0.ts"), segment, 0644))
+		server := httptest.NewUnstartedServer(ctrls.Handler())
+		assert.Nil(t, ConfigureHTTP2(server.Config, conf))
+		return server, generated.dirPath, func() {
+			server.Close()
+			ctrls.Shutdown(context.Background())
+			os.RemoveAll(storeDir)
+		}
+	}
+	get := func(client *http.Client, url, tag string) (*http.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if tag != "" {
+			req.Header.Set("If-None-Match", tag)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		cancel()
+		return res, nil
+	}
+	deliver := func(t *testing.T, client *http.Client, base string) {
+		// A client not reading the segment does not hold up the playlists requested on the same connection
+		req, _ := http.NewRequest(http.MethodGet, base+"/0.ts", nil)
+		slow, err := client.Do(req)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer slow.Body.Close()
+		assert.Equal(t, 2, slow.ProtoMajor)
+
+		res, err := get(client, base+"/index.m3u8", "")
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, 2, res.ProtoMajor)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+		reader, err := gzip.NewReader(res.Body)
+		assert.Nil(t, err)
+		decompressed, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, playlist, decompressed)
+		res, err = get(client, base+"/index.m3u8", res.Header.Get("ETag"))
+		if assert.Nil(t, err) {
+			assert.Equal(t, http.StatusNotModified, res.StatusCode)
+		}
+
+		b, err := ioutil.ReadAll(slow.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, slow.StatusCode)
+		assert.Equal(t, len(segment), len(b))
+		assert.True(t, bytes.Equal(segment, b))
+	}
+
+	t.Run("Should serve the files over HTTP/2 if TLS is configured", func(t *testing.T) {
+		conf := config.InitConfig()
+		conf.TLSCertFile, conf.TLSKeyFile = "tls.crt", "tls.key"
+		server, id, teardown := setup(conf)
+		defer teardown()
+		server.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+		server.StartTLS()
+		rootCAs := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		client := &http.Client{Transport: &http2.Transport{
+			TLSClientConfig:    &tls.Config{RootCAs: rootCAs},
+			DisableCompression: true,
+		}}
+		deliver(t, client, fmt.Sprintf("%s/stream/%s", server.URL, id))
+	})
+
+	t.Run("Should serve the files over h2c if it is enabled", func(t *testing.T) {
+		conf := config.InitConfig()
+		conf.H2CEnabled = true
+		server, id, teardown := setup(conf)
+		defer teardown()
+		server.Start()
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+			DisableCompression: true,
+		}}
+		deliver(t, client, fmt.Sprintf("%s/stream/%s", server.URL, id))
+
+		// The clients not knowing about h2c keep using HTTP/1.1
+		res, err := get(http.DefaultClient, fmt.Sprintf("%s/stream/%s/index.m3u8", server.URL, id), "")
+		if assert.Nil(t, err) {
+			assert.Equal(t, 1, res.ProtoMajor)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+
+	t.Run("Should only serve HTTP/1.1 without TLS if h2c is disabled", func(t *testing.T) {
+		server, id, teardown := setup(config.InitConfig())
+		defer teardown()
+		server.Start()
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+		_, err := get(client, fmt.Sprintf("%s/stream/%s/index.m3u8", server.URL, id), "")
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,17 @@
+package core
+
+import (
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// layout resolves where the files of the new stream are written from the templates of the configuration.
+// It is nil if the stream is written into the directory named after its id, like without the templates
+func (c *Controller) layout(canonical, id string, metadata map[string]string) (*streaming.Layout, error) {
+	values := config.LayoutValues{ID: canonical, Alias: id, Date: c.now(), Metadata: metadata}
+	dir, segment, err := c.spec().ExpandLayout(values)
+	if err != nil {
+		return nil, err
+	}
+	return streaming.NewLayout(id, dir, segment), nil
+}
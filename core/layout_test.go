@@ -0,0 +1,105 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayout(t *testing.T) {
+	t.Run("Should lay out the new streams with the templates", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.DirectoryTemplate = "{metadata.site}/{alias}"
+		conf.SegmentTemplate = "{alias}-%05d"
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		router := httprouter.New()
+		router.POST("/start", ctrls.StartStreamHandler)
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		start := func(dto StreamDto) *http.Response {
+			b, err := json.Marshal(dto)
+			assert.Nil(t, err)
+			res, err := http.Post(fmt.Sprintf("%s/start", server.URL), "application/json", bytes.NewBuffer(b))
+			assert.Nil(t, err)
+			return res
+		}
+		res := start(StreamDto{URI: generateURI(), Alias: "front"})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		var errDto ErrorDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&errDto))
+		assert.Equal(t, "invalid_layout", errDto.Error.Code)
+		assert.Empty(t, ctrls.streams)
+
+		res = start(StreamDto{URI: generateURI(), Alias: "front", Metadata: map[string]string{"site": "north"}})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		strm, ok := ctrls.getStream("front")
+		if assert.True(t, ok) {
+			assert.Equal(t, &streaming.Layout{Directory: "north/front", Segment: "front-%05d"}, strm.Options.Layout)
+		}
+
+		// The default templates write the streams like before
+		ctrls.setSpec(config.InitConfig())
+		uri := generateURI()
+		res = start(StreamDto{URI: uri})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		dir, _ := streaming.GetURIDirectory(uri)
+		strm, ok = ctrls.getStream(dir)
+		if assert.True(t, ok) {
+			assert.Nil(t, strm.Options.Layout)
+		}
+	})
+
+	t.Run("Should serve and count the files from the directory of the layout", func(t *testing.T) {
+		storeDir, err := ioutil.TempDir("", "store")
+		assert.Nil(t, err)
+		defer os.RemoveAll(storeDir)
+		conf := *config.InitConfig()
+		conf.StoreDir = storeDir
+		ctrls := NewController(&conf, WithFileServer(http.FileServer(newStoreFileSystem(storeDir))))
+		router := httprouter.New()
+		router.GET("/stream/*filepath", ctrls.FileHandler)
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		generated := generateStream(nil, "")
+		generated.strm.Streak.Activate()
+		generated.strm.Options.Directory = "front"
+		generated.strm.Options.Layout = &streaming.Layout{Directory: "north/front", Segment: "%d"}
+		generated.strm.StorePath = filepath.Join(storeDir, "north", "front")
+		ctrls.setStream("front", &generated.strm)
+		assert.Nil(t, os.MkdirAll(generated.strm.StorePath, os.ModePerm))
+		writeAged(t, filepath.Join(generated.strm.StorePath, "0.ts"), 100, time.Now())
+		// Files left by a stream that is not registered anymore
+		assert.Nil(t, os.MkdirAll(filepath.Join(storeDir, "north", "old"), os.ModePerm))
+		writeAged(t, filepath.Join(storeDir, "north", "old", "0.ts"), 10, time.Now())
+
+		res, err := http.Get(fmt.Sprintf("%s/stream/front/0.ts", server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		b, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Len(t, b, 100)
+
+		usages := map[string]int64{}
+		for _, usage := range ctrls.storageUsage() {
+			usages[usage.id] = sumSize(usage.segments)
+		}
+		assert.Equal(t, map[string]int64{"front": 100, "north": 10}, usages)
+		assert.Equal(t, int64(100), sumSize(ctrls.scanStream("front").segments))
+	})
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// LifecycleDto describes the lifecycle policy of a stream
+type LifecycleDto struct {
+	Lifecycle string `json:"lifecycle"`
+	// StopsIn is the number of seconds left until the stream is stopped, unset if it is never stopped automatically
+	StopsIn *int `json:"stopsIn,omitempty"`
+}
+
+// stopDeadline returns the time the stream is stopped by the cleanup if nothing keeps it running until then.
+// Streams with the viewers policy are stopped once they had no viewers for their idle timeout, the other ones
+// once their files were not requested for it. Streams without an idle timeout are never stopped
+func (c *Controller) stopDeadline(id string, strm *streaming.Stream) (time.Time, bool) {
+	strm.Mux.RLock()
+	idle := strm.Options.IdleDuration()
+	policy := strm.Options.LifecyclePolicy()
+	lastActivity, startedAt := strm.LastActivity, strm.StartedAt
+	strm.Mux.RUnlock()
+	if idle == 0 {
+		return time.Time{}, false
+	}
+	if policy != streaming.LifecycleViewers {
+		return lastActivity.Add(idle), true
+	}
+	// The viewers are counted until their window is over, the freshly started streams get the same time to be watched
+	last := c.viewers.lastSeen(id)
+	if startedAt.After(last) {
+		last = startedAt
+	}
+	return last.Add(c.spec().ViewerWindow + idle), true
+}
+
+// isAlive indicates if the stream has to keep running. Streams with the viewers policy are kept by their viewers
+// only, the requests of the ignored clients like health checks do not keep them running
+func (c *Controller) isAlive(id string, strm *streaming.Stream) bool {
+	if strm.Lifecycle() != streaming.LifecycleViewers {
+		return strm.IsAlive(c.now())
+	}
+	deadline, ok := c.stopDeadline(id, strm)
+	return !ok || c.now().Before(deadline)
+}
+
+// lifecycleDto describes the lifecycle policy of the stream and the time left until it is stopped
+func (c *Controller) lifecycleDto(id string, strm *streaming.Stream) LifecycleDto {
+	dto := LifecycleDto{strm.Lifecycle(), nil}
+	if deadline, ok := c.stopDeadline(id, strm); ok {
+		seconds := int(deadline.Sub(c.now()).Seconds())
+		if seconds < 0 {
+			seconds = 0
+		}
+		dto.StopsIn = &seconds
+	}
+	return dto
+}
+
+// LifecycleHandler is the HTTP handler of the PATCH /stream/:id/lifecycle call.
+// It switches the lifecycle policy of the stream without restarting it
+func (c *Controller) LifecycleHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	var dto LifecycleDto
+	if err := json.Unmarshal(body, &dto); err != nil || dto.Lifecycle == "" {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	if err := strm.SetLifecycle(dto.Lifecycle); err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	c.persist()
+	c.logger(r.Context()).Infof("Lifecycle of %s is set to %s%s", id, dto.Lifecycle, requestedBy(apiKeyName(r)))
+	b, _ := json.Marshal(c.lifecycleDto(id, strm))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestLifecycle(t *testing.T) {
+	t.Run("Should stop the streams without viewers even if they are requested", func(t *testing.T) {
+		now := time.Now()
+		spec := config.InitConfig()
+		spec.ListEndpoint = true
+		spec.IgnoredAgents = []string{"kube-probe"}
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()), WithClock(func() time.Time { return now }))
+		defer ctrls.Shutdown(context.Background())
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		watched := generateStream(nil, "")
+		watched.strm.Options = streaming.Options{IdleTimeout: 60, Lifecycle: streaming.LifecycleViewers}
+		watched.strm.StartedAt = now
+		watched.strm.Streak.Activate()
+		startFake(&watched.strm)
+		requested := generateStream(nil, "")
+		requested.strm.Options = streaming.Options{IdleTimeout: 60}
+		requested.strm.Streak.Activate()
+		startFake(&requested.strm)
+		ctrls.streams[watched.dirPath] = &watched.strm
+		ctrls.streams[requested.dirPath] = &requested.strm
+		fetch := func(id, agent string) {
+			r := httptest.NewRequest(http.MethodGet, "/stream/"+id+"/index.m3u8", nil)
+			r.Header.Set("User-Agent", agent)
+			ctrls.FileHandler(httptest.NewRecorder(), r, httprouter.Params{{Key: "filepath", Value: "/" + id + "/index.m3u8"}})
+		}
+		list := func() map[string]SummariseDto {
+			rr := httptest.NewRecorder()
+			ctrls.ListStreamHandler(rr, httptest.NewRequest(http.MethodGet, "/list", nil), nil)
+			var dto []SummariseDto
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &dto))
+			summaries := map[string]SummariseDto{}
+			for _, summary := range dto {
+				summaries[summary.ID] = summary
+			}
+			return summaries
+		}
+		fetch(watched.dirPath, "kube-probe/1.18")
+		summary := list()[watched.dirPath]
+		assert.Equal(t, streaming.LifecycleViewers, summary.Lifecycle)
+		assert.Equal(t, 0, summary.Viewers)
+		if assert.NotNil(t, summary.StopsIn) {
+			assert.Equal(t, 90, *summary.StopsIn)
+		}
+		assert.Equal(t, streaming.LifecycleActivity, list()[requested.dirPath].Lifecycle)
+
+		now = now.Add(time.Second * 91)
+		fetch(watched.dirPath, "kube-probe/1.18")
+		fetch(requested.dirPath, "kube-probe/1.18")
+		assert.Equal(t, 0, *list()[watched.dirPath].StopsIn)
+		ctrls.cleanUnused()
+		assert.True(t, waitUntil(func() bool { return !watched.strm.IsProcessAlive() }, time.Second))
+		assert.True(t, requested.strm.IsProcessAlive())
+
+		// Health checks cannot restart it, the viewers can
+		fetch(watched.dirPath, "kube-probe/1.18")
+		assert.False(t, watched.strm.Streak.IsActive())
+		fetch(watched.dirPath, "VLC/3.0")
+		assert.True(t, watched.strm.Streak.IsActive())
+		if summary := list()[watched.dirPath]; assert.NotNil(t, summary.StopsIn) {
+			assert.Equal(t, 1, summary.Viewers)
+			assert.Equal(t, 90, *summary.StopsIn)
+		}
+	})
+
+	t.Run("Should not count the clients of the ignored addresses", func(t *testing.T) {
+		spec := config.InitConfig()
+		spec.IgnoredIPs = []string{"192.0.2.0/24"}
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/stream/id/index.m3u8", nil)
+		assert.False(t, ctrls.isViewer(r))
+		ctrls.watched("id", r)
+		r.RemoteAddr = "198.51.100.7:4000"
+		assert.True(t, ctrls.isViewer(r))
+		current, _ := ctrls.streamViewers("id")
+		assert.Equal(t, 0, current)
+	})
+
+	t.Run("Should switch the lifecycle policy of the stream", func(t *testing.T) {
+		ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		ctrls.streams[generated.dirPath] = &generated.strm
+		patch := func(id, body string) *httptest.ResponseRecorder {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/stream/"+id+"/lifecycle", bytes.NewBufferString(body))
+			ctrls.LifecycleHandler(rr, req, httprouter.Params{{Key: "id", Value: id}})
+			return rr
+		}
+		rr := patch(generated.dirPath, `{"lifecycle": "viewers"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var dto LifecycleDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &dto))
+		assert.Equal(t, streaming.LifecycleViewers, dto.Lifecycle)
+		assert.NotNil(t, dto.StopsIn)
+		assert.Equal(t, streaming.LifecycleViewers, generated.strm.Lifecycle())
+
+		assert.Equal(t, http.StatusBadRequest, patch(generated.dirPath, `{"lifecycle": "forever"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, patch(generated.dirPath, `{}`).Code)
+		assert.Equal(t, http.StatusNotFound, patch("unknown", `{"lifecycle": "activity"}`).Code)
+		assert.Equal(t, streaming.LifecycleViewers, generated.strm.Lifecycle())
+	})
+}
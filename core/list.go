@@ -0,0 +1,127 @@
+package core
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sortByURI, sortByStarted and sortByLastActive are the orders the list can be sorted in
+const (
+	sortByURI        = "uri"
+	sortByStarted    = "started"
+	sortByLastActive = "lastActive"
+)
+
+// ListDto describes a page of the streams in the list
+type ListDto struct {
+	Items []*SummariseDto `json:"items"`
+	Total int             `json:"total"` // Number of the streams matching the filter
+	// NextOffset is the offset of the next page, nil if this is the last one
+	NextOffset *int `json:"nextOffset"`
+}
+
+// listQuery describes the filtering, sorting and pagination of the list
+type listQuery struct {
+	running *bool
+	labels  map[string]string // Metadata the streams have to contain
+	sort    string
+	limit   int // 0 means no limit
+	offset  int
+	verbose bool // Indicates if the resource usage of the streams is listed
+}
+
+// parseListQuery reads the list options of the query. Returns false if none of them are given,
+// so the list can be sent in its original shape
+func parseListQuery(values url.Values) (listQuery, bool, error) {
+	query := listQuery{sort: sortByURI}
+	paged := false
+	if value := values.Get("running"); value != "" {
+		running, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, false, ErrInvalidListQuery
+		}
+		query.running = &running
+		paged = true
+	}
+	if labels := values["label"]; len(labels) > 0 {
+		parsed, err := parseLabels(labels)
+		if err != nil {
+			return query, false, err
+		}
+		query.labels = parsed
+		paged = true
+	}
+	if value := values.Get("sort"); value != "" {
+		if value != sortByURI && value != sortByStarted && value != sortByLastActive {
+			return query, false, ErrInvalidListQuery
+		}
+		query.sort = value
+		paged = true
+	}
+	// The verbose mode adds to the items of the list, it does not change its shape
+	if value := values.Get("verbose"); value != "" {
+		verbose, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, false, ErrInvalidListQuery
+		}
+		query.verbose = verbose
+	}
+	for name, target := range map[string]*int{"limit": &query.limit, "offset": &query.offset} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return query, false, ErrInvalidListQuery
+		}
+		*target = number
+		paged = true
+	}
+	return query, paged, nil
+}
+
+// started returns the start of the transcoding of the stream, zero if it was never started
+func started(stream *SummariseDto) time.Time {
+	if stream.StartedAt == nil {
+		return time.Time{}
+	}
+	return *stream.StartedAt
+}
+
+// page returns the requested page of the streams. The streams are ordered by their id
+// within the same sort value, so the pages are stable between the requests
+func (q listQuery) page(streams []*SummariseDto) ListDto {
+	items := []*SummariseDto{}
+	for _, stream := range streams {
+		if (q.running == nil || stream.Running == *q.running) && hasLabels(stream.Metadata, q.labels) {
+			items = append(items, stream)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch {
+		case q.sort == sortByStarted && !started(a).Equal(started(b)):
+			return started(a).Before(started(b))
+		case q.sort == sortByLastActive && !a.lastActivity.Equal(b.lastActivity):
+			return a.lastActivity.Before(b.lastActivity)
+		case q.sort == sortByURI && a.URI != b.URI:
+			return a.URI < b.URI
+		}
+		return a.ID < b.ID
+	})
+	dto := ListDto{Items: items, Total: len(items)}
+	if q.offset >= len(items) {
+		dto.Items = []*SummariseDto{}
+		return dto
+	}
+	dto.Items = items[q.offset:]
+	if q.limit > 0 && q.limit < len(dto.Items) {
+		dto.Items = dto.Items[:q.limit]
+		next := q.offset + q.limit
+		dto.NextOffset = &next
+	}
+	return dto
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// checkLocalSource checks if the local sources are enabled and the path of the source is one of the allowed ones.
+// The links are followed, so a link inside an allowed directory cannot disclose the other files of the host
+func (c *Controller) checkLocalSource(uri string) error {
+	spec := c.spec()
+	if !spec.LocalEnabled {
+		return ErrLocalSourcesDisabled
+	}
+	path := streaming.LocalPath(uri)
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ErrLocalSourceMissing
+	}
+	allowed := []string{}
+	for _, entry := range spec.LocalPaths {
+		if real, err := filepath.EvalSymlinks(entry); err == nil {
+			allowed = append(allowed, real)
+		}
+	}
+	if !allowedPath(spec.LocalPaths, path) || !allowedPath(allowed, resolved) {
+		return ErrLocalSourceDenied
+	}
+	return nil
+}
+
+// allowedPath indicates if the path is one of the allowed ones or inside one of the allowed directories
+func allowedPath(allowed []string, path string) bool {
+	for _, entry := range allowed {
+		entry = filepath.Clean(entry)
+		if path == entry || strings.HasPrefix(path, strings.TrimSuffix(entry, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestAllowedPath(t *testing.T) {
+	allowed := []string{"/videos/", "/dev/video0"}
+	tt := []struct {
+		Path    string
+		Allowed bool
+	}{
+		{Path: "/videos/sample.mp4", Allowed: true},
+		{Path: "/videos/nested/sample.mp4", Allowed: true},
+		{Path: "/videos", Allowed: true},
+		{Path: "/videos-private/sample.mp4", Allowed: false},
+		{Path: "/dev/video0", Allowed: true},
+		{Path: "/dev/video1", Allowed: false},
+		{Path: "/etc/passwd", Allowed: false},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Allowed, allowedPath(allowed, testCase.Path)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestAllowedPath", i))
+		}
+	}
+}
+
+func TestLocalSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	videos := filepath.Join(dir, "videos")
+	assert.Nil(t, os.MkdirAll(videos, os.ModePerm))
+	sample := filepath.Join(videos, "sample.mp4")
+	assert.Nil(t, ioutil.WriteFile(sample, []byte("mp4"), 0644))
+	secret := filepath.Join(dir, "secret.txt")
+	assert.Nil(t, ioutil.WriteFile(secret, []byte("secret"), 0644))
+	assert.Nil(t, os.Symlink(secret, filepath.Join(videos, "link.mp4")))
+
+	start := func(spec *config.Specification, uri string) *httptest.ResponseRecorder {
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		loop := true
+		b, _ := json.Marshal(StreamDto{URI: uri, Loop: &loop})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		var dto StreamDto
+		if rr.Code == http.StatusOK && assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &dto)) {
+			// The id is derived from the cleaned path
+			id, _ := streaming.GetURIDirectory("file://" + filepath.Clean(streaming.LocalPath(uri)))
+			assert.Equal(t, id, dto.ID)
+			if strm, ok := ctrls.getStream(dto.ID); assert.True(t, ok) {
+				assert.True(t, strm.Options.Loop)
+			}
+		}
+		return rr
+	}
+
+	t.Run("Should refuse the local sources if they are disabled", func(t *testing.T) {
+		rr := start(config.InitConfig(), "file://"+sample)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "local_sources_disabled")
+	})
+
+	t.Run("Should only start the local sources of the allowed paths", func(t *testing.T) {
+		spec := config.InitConfig()
+		spec.LocalEnabled = true
+		spec.LocalPaths = []string{videos}
+		tt := []struct {
+			URI    string
+			Status int
+		}{
+			{URI: "file://" + sample, Status: http.StatusOK},
+			{URI: "file://" + videos + "/../videos/sample.mp4", Status: http.StatusOK},
+			{URI: "file://" + secret, Status: http.StatusForbidden},
+			{URI: "file://" + videos + "/../secret.txt", Status: http.StatusForbidden},
+			{URI: "file://" + filepath.Join(videos, "link.mp4"), Status: http.StatusForbidden},
+			{URI: "file://" + filepath.Join(videos, "missing.mp4"), Status: http.StatusUnprocessableEntity},
+			{URI: "file:videos/sample.mp4", Status: http.StatusBadRequest},
+		}
+		for i, testCase := range tt {
+			if rr := start(spec, testCase.URI); !assert.Equal(t, testCase.Status, rr.Code, rr.Body.String()) {
+				t.Error(fmt.Errorf("%d testcase is failing for TestLocalSources", i))
+			}
+		}
+	})
+}
@@ -4,12 +4,41 @@ import (
 	"os"
 
 	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
 	"github.com/sirupsen/logrus"
 )
 
+// redactingHook masks the credentials of the URIs in the log entries before they are written
+type redactingHook struct{}
+
+// Levels returns every level, so none of the entries can leak credentials
+func (redactingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks the credentials in the message and the text fields of the entry
+func (redactingHook) Fire(entry *logrus.Entry) error {
+	entry.Message = streaming.RedactURI(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = streaming.RedactURI(v)
+		case error:
+			entry.Data[key] = streaming.RedactURI(v.Error())
+		}
+	}
+	return nil
+}
+
 // SetupLogger sets the logger for the proper settings based on the environment
 func SetupLogger(spec *config.Specification) {
 	logrus.SetOutput(os.Stdout)
+	logrus.AddHook(redactingHook{})
+	setLogLevel(spec)
+}
+
+// setLogLevel sets the level of the logger based on the configuration, it can change when the configuration is reloaded
+func setLogLevel(spec *config.Specification) {
 	if spec.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 		return
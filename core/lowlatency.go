@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// blockingPollInterval is the time between the checks of the playlist a blocking reload waits for
+const blockingPollInterval = 50 * time.Millisecond
+
+// playlistState describes how far the transcoding of a stream got according to its playlist
+type playlistState struct {
+	next  int // Media sequence number of the segment in progress
+	parts int // Number of the announced parts of the segment in progress
+}
+
+// parsePlaylistState reads the position of the playlist. The parts after the last complete
+// segment belong to the segment in progress, including the one announced for prefetching
+func parsePlaylistState(content []byte) playlistState {
+	state := playlistState{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			if sequence, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:")); err == nil {
+				state.next = sequence
+			}
+		case strings.HasPrefix(line, "#EXT-X-PART:"), strings.HasPrefix(line, "#EXT-X-PREFETCH:"):
+			state.parts++
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			state.next++
+			state.parts = 0
+		}
+	}
+	return state
+}
+
+// reached indicates if the playlist contains the given segment, or the given part of it if part is not negative
+func (ps playlistState) reached(msn, part int) bool {
+	return msn < ps.next || (part >= 0 && msn == ps.next && part < ps.parts)
+}
+
+// blockingReload returns the media sequence number and the part requested by a blocking playlist reload,
+// the part is -1 if it is not requested. Returns false if the reload is not blocking
+func blockingReload(query url.Values) (int, int, bool, error) {
+	msnValue, partValue := query.Get("_HLS_msn"), query.Get("_HLS_part")
+	if msnValue == "" {
+		if partValue != "" {
+			return 0, 0, false, ErrInvalidBlockingReload
+		}
+		return 0, 0, false, nil
+	}
+	msn, err := strconv.Atoi(msnValue)
+	if err != nil || msn < 0 {
+		return 0, 0, false, ErrInvalidBlockingReload
+	}
+	if partValue == "" {
+		return msn, -1, true, nil
+	}
+	part, err := strconv.Atoi(partValue)
+	if err != nil || part < 0 {
+		return 0, 0, false, ErrInvalidBlockingReload
+	}
+	return msn, part, true, nil
+}
+
+// blockTimeout returns the time a blocking reload of the playlist of the stream waits
+func (c *Controller) blockTimeout(strm *streaming.Stream) time.Duration {
+	if c.spec().LLHLSBlockTimeout > 0 {
+		return c.spec().LLHLSBlockTimeout
+	}
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return 3 * time.Duration(strm.Options.HLS.Time) * time.Second
+}
+
+// serveStreamFile serves the requested file of the stream. If low latency is enabled, blocking reloads
+// of the playlists are held until the requested segment or part is written, or the timeout passes
+func (c *Controller) serveStreamFile(w http.ResponseWriter, req *http.Request, strm *streaming.Stream) {
+	if !c.spec().LLHLSEnabled || !isPlaylist(req.URL.Path) {
+		c.serveFile(w, req)
+		return
+	}
+	msn, part, blocking, err := blockingReload(req.URL.Query())
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if !blocking {
+		c.serveFile(w, req)
+		return
+	}
+	name := path.Clean("/" + req.URL.Path)
+	if !isInsideDir(c.spec().StoreDir, name) {
+		c.serveFile(w, req)
+		return
+	}
+	file := filepath.Join(c.spec().StoreDir, filepath.FromSlash(name))
+	deadline := time.After(c.blockTimeout(strm))
+	for {
+		content, err := ioutil.ReadFile(file)
+		// Missing playlists are answered by the file server
+		if err != nil {
+			c.serveFile(w, req)
+			return
+		}
+		state := parsePlaylistState(content)
+		if state.reached(msn, part) {
+			c.serveFile(w, req)
+			return
+		}
+		if msn > state.next+1 {
+			c.SendError(w, ErrInvalidBlockingReload, http.StatusBadRequest)
+			return
+		}
+		select {
+		case <-req.Context().Done():
+			return
+		case <-deadline:
+			c.SendError(w, ErrBlockingReloadTimeout, http.StatusServiceUnavailable)
+			return
+		case <-time.After(blockingPollInterval):
+		}
+	}
+}
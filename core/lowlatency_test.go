@@ -0,0 +1,148 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestParsePlaylistState(t *testing.T) {
+	tt := []struct {
+		Playlist string
+		State    playlistState
+	}{
+		{Playlist: "#EXTM3U\n", State: playlistState{0, 0}},
+		{Playlist: "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:4\n#EXTINF:1.0,\n4.ts\n#EXTINF:1.0,\n5.ts\n", State: playlistState{6, 0}},
+		{
+			Playlist: "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:2\n#EXTINF:2.0,\nchunk-0-00003.m4s\n#EXT-X-PREFETCH:chunk-0-00004.m4s\n",
+			State:    playlistState{3, 1},
+		},
+		{
+			Playlist: "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n#EXT-X-PART:DURATION=0.5,URI=\"7.0.m4s\"\n#EXTINF:1.0,\n7.m4s\n#EXT-X-PART:DURATION=0.5,URI=\"8.0.m4s\"\n#EXT-X-PART:DURATION=0.5,URI=\"8.1.m4s\"\n",
+			State:    playlistState{8, 2},
+		},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.State, parsePlaylistState([]byte(testCase.Playlist))) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestParsePlaylistState", i))
+		}
+	}
+
+	state := playlistState{next: 8, parts: 2}
+	assert.True(t, state.reached(7, -1))
+	assert.True(t, state.reached(8, 1))
+	assert.False(t, state.reached(8, 2))
+	assert.False(t, state.reached(8, -1))
+}
+
+func TestBlockingReload(t *testing.T) {
+	tt := []struct {
+		Query    string
+		MSN      int
+		Part     int
+		Blocking bool
+		Err      error
+	}{
+		{Query: "", Blocking: false},
+		{Query: "_HLS_msn=12", MSN: 12, Part: -1, Blocking: true},
+		{Query: "_HLS_msn=12&_HLS_part=3", MSN: 12, Part: 3, Blocking: true},
+		{Query: "_HLS_part=3", Err: ErrInvalidBlockingReload},
+		{Query: "_HLS_msn=next", Err: ErrInvalidBlockingReload},
+		{Query: "_HLS_msn=-1", Err: ErrInvalidBlockingReload},
+		{Query: "_HLS_msn=12&_HLS_part=last", Err: ErrInvalidBlockingReload},
+	}
+	for i, testCase := range tt {
+		query, err := url.ParseQuery(testCase.Query)
+		assert.Nil(t, err)
+		msn, part, blocking, err := blockingReload(query)
+		if !assert.Equal(t, testCase.Err, err) ||
+			!assert.Equal(t, testCase.Blocking, blocking) ||
+			(blocking && (!assert.Equal(t, testCase.MSN, msn) || !assert.Equal(t, testCase.Part, part))) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestBlockingReload", i))
+		}
+	}
+}
+
+func TestBlockingPlaylistReload(t *testing.T) {
+	storeDir, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(storeDir)
+	conf := *config.InitConfig()
+	conf.StoreDir = storeDir
+	conf.LLHLSEnabled = true
+	conf.LLHLSBlockTimeout = time.Millisecond * 300
+	ctrls := NewController(&conf, WithFileServer(http.FileServer(http.Dir(storeDir))))
+	router := httprouter.New()
+	router.GET("/stream/*filepath", ctrls.FileHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	generated := generateStream(nil, "")
+	generated.strm.Streak.Activate().Hit()
+	generated.strm.Options = streaming.Options{HLS: streaming.HLSOptions{Time: 1}}
+	ctrls.streams[generated.dirPath] = &generated.strm
+	dir := filepath.Join(storeDir, generated.dirPath)
+	assert.Nil(t, os.MkdirAll(dir, os.ModePerm))
+	playlist := filepath.Join(dir, "index.m3u8")
+	assert.Nil(t, ioutil.WriteFile(playlist, []byte("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:4\n#EXTINF:1.0,\n4.ts\n"), 0644))
+	get := func(query string) (*http.Response, []byte) {
+		res, err := http.Get(fmt.Sprintf("%s/stream/%s/index.m3u8?%s", server.URL, generated.dirPath, query))
+		assert.Nil(t, err)
+		b, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		return res, b
+	}
+
+	t.Run("Should serve the playlists containing the requested segment instantly", func(t *testing.T) {
+		res, b := get("_HLS_msn=4")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, string(b), "4.ts")
+	})
+
+	t.Run("Should hold the reload until the requested segment is written", func(t *testing.T) {
+		go func() {
+			<-time.After(time.Millisecond * 100)
+			ioutil.WriteFile(playlist, []byte("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:4\n#EXTINF:1.0,\n4.ts\n#EXTINF:1.0,\n5.ts\n"), 0644)
+		}()
+		started := time.Now()
+		res, b := get("_HLS_msn=5")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, string(b), "5.ts")
+		assert.True(t, time.Since(started) >= time.Millisecond*100)
+	})
+
+	t.Run("Should time out if the requested segment is not written", func(t *testing.T) {
+		res, b := get("_HLS_msn=6&_HLS_part=0")
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		var dto ErrorDto
+		assert.Nil(t, json.Unmarshal(b, &dto))
+		assert.Equal(t, "blocking_reload_timeout", dto.Error.Code)
+	})
+
+	t.Run("Should refuse segments too far ahead of the playlist", func(t *testing.T) {
+		res, _ := get("_HLS_msn=9")
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		res, _ = get("_HLS_part=1")
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Should ignore the blocking parameters if low latency is disabled", func(t *testing.T) {
+		ctrls.spec().LLHLSEnabled = false
+		defer func() { ctrls.spec().LLHLSEnabled = true }()
+		res, _ := get("_HLS_msn=9")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
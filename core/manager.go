@@ -3,17 +3,21 @@ package core
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Runner describes a process that runs until it exits
+type Runner interface {
+	Run() error
+}
+
 // IManager is the interface for the manager object that handles the start
 // of the transcoding process
 type IManager interface {
-	Start(cmd *exec.Cmd, physicalPath string) chan bool
+	Start(process Runner, physicalPath string) chan bool
 	WaitForStream(path string) chan bool
 }
 
@@ -62,7 +66,7 @@ func (m Manager) WaitForStream(path string) chan bool {
 }
 
 // Start is to manage the start of the transcoding
-func (m Manager) Start(cmd *exec.Cmd, physicalPath string) chan bool {
+func (m Manager) Start(process Runner, physicalPath string) chan bool {
 	// Init synchronization components
 	var once sync.Once
 	streamResolved := make(chan bool, 1)
@@ -82,7 +86,7 @@ func (m Manager) Start(cmd *exec.Cmd, physicalPath string) chan bool {
 
 	// Run the transcoding, resolve stream if it errors out
 	go func() {
-		if err := cmd.Run(); err != nil {
+		if err := process.Run(); err != nil {
 			once.Do(func() {
 				logrus.Errorf("Error happened during starting of %s || Error: %s", physicalPath, err)
 				streamResolved <- false
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxMetadataKeys, maxMetadataKeyLength and maxMetadataValueLength are the limits of the metadata of a stream
+const (
+	maxMetadataKeys        = 32
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 256
+)
+
+// validateMetadata checks if the metadata is within the limits. The keys cannot contain colons,
+// since the labels of the list filter are separated from their value by one
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return ErrInvalidMetadata
+	}
+	for key, value := range metadata {
+		if key == "" || len(key) > maxMetadataKeyLength || strings.Contains(key, ":") || len(value) > maxMetadataValueLength {
+			return ErrInvalidMetadata
+		}
+	}
+	return nil
+}
+
+// parseLabels reads the key:value pairs of the label filters of the list
+func parseLabels(values []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, ErrInvalidListQuery
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
+
+// hasLabels indicates if the metadata contains every label
+func hasLabels(metadata, labels map[string]string) bool {
+	for key, value := range labels {
+		if current, ok := metadata[key]; !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// MetadataHandler is the HTTP handler of the PATCH /stream/:id/metadata call. The keys of the body are set
+// on the metadata of the stream, the ones set to null are removed. The transcoding is not affected
+func (c *Controller) MetadataHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	var changes map[string]*string
+	if err := json.Unmarshal(body, &changes); err != nil || changes == nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	metadata := strm.GetMetadata()
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(metadata, key)
+			continue
+		}
+		metadata[key] = *value
+	}
+	if err := validateMetadata(metadata); err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	strm.SetMetadata(metadata)
+	c.persist()
+	c.logger(r.Context()).Infof("Metadata of %s is updated%s", id, requestedBy(apiKeyName(r)))
+	b, _ := json.Marshal(metadata)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := 0; i <= maxMetadataKeys; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "value"
+	}
+	tt := []struct {
+		Metadata map[string]string
+		Err      error
+	}{
+		{Metadata: nil, Err: nil},
+		{Metadata: map[string]string{"building": "north", "floor": "1"}, Err: nil},
+		{Metadata: map[string]string{"": "north"}, Err: ErrInvalidMetadata},
+		{Metadata: map[string]string{"building:floor": "north"}, Err: ErrInvalidMetadata},
+		{Metadata: map[string]string{strings.Repeat("k", maxMetadataKeyLength+1): "north"}, Err: ErrInvalidMetadata},
+		{Metadata: map[string]string{"building": strings.Repeat("v", maxMetadataValueLength+1)}, Err: ErrInvalidMetadata},
+		{Metadata: tooMany, Err: ErrInvalidMetadata},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Err, validateMetadata(testCase.Metadata)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestValidateMetadata", i))
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	defer ctrls.Shutdown(context.Background())
+	uri := "rtsp://192.168.0.10/live"
+	id, _ := streaming.GetURIDirectory(uri)
+
+	t.Run("Should store the metadata of the start request", func(t *testing.T) {
+		b, _ := json.Marshal(StreamDto{URI: uri, Metadata: map[string]string{"building": "north", "area": "lobby"}})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var dto StreamDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &dto))
+		assert.Equal(t, "lobby", dto.Metadata["area"])
+
+		rr = httptest.NewRecorder()
+		ctrls.ListStreamHandler(rr, httptest.NewRequest(http.MethodGet, "/list?label=area:lobby", nil), nil)
+		var list ListDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		if assert.Len(t, list.Items, 1) {
+			assert.Equal(t, "north", list.Items[0].Metadata["building"])
+		}
+		rr = httptest.NewRecorder()
+		ctrls.ListStreamHandler(rr, httptest.NewRequest(http.MethodGet, "/list?label=area:garage", nil), nil)
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		assert.Empty(t, list.Items)
+
+		b, _ = json.Marshal(StreamDto{URI: "rtsp://192.168.0.11/live", Metadata: map[string]string{"area:floor": "lobby"}})
+		rr = httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "invalid_metadata")
+	})
+
+	t.Run("Should update the metadata of the stream", func(t *testing.T) {
+		patch := func(id, body string) *httptest.ResponseRecorder {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/stream/"+id+"/metadata", bytes.NewBufferString(body))
+			ctrls.MetadataHandler(rr, req, httprouter.Params{{Key: "id", Value: id}})
+			return rr
+		}
+		rr := patch(id, `{"area": null, "floor": "2"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var metadata map[string]string
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &metadata))
+		assert.Equal(t, map[string]string{"building": "north", "floor": "2"}, metadata)
+
+		rr = httptest.NewRecorder()
+		ctrls.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status/"+id, nil), httprouter.Params{{Key: "id", Value: id}})
+		var status StatusDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		assert.Equal(t, metadata, status.Metadata)
+
+		assert.Equal(t, http.StatusBadRequest, patch(id, `["floor"]`).Code)
+		assert.Equal(t, http.StatusBadRequest, patch(id, fmt.Sprintf(`{"floor": %q}`, strings.Repeat("v", maxMetadataValueLength+1))).Code)
+		assert.Equal(t, http.StatusNotFound, patch("unknown", `{"floor": "3"}`).Code)
+	})
+}
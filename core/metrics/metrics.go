@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Collector gathers the metrics of the application in its own registry and exposes them
+// in the Prometheus text exposition format
+type Collector struct {
+	mux             *sync.Mutex
+	registry        *prometheus.Registry
+	activeStreams   prometheus.Gauge
+	startRequests   prometheus.Counter
+	startFailures   prometheus.Counter
+	cleanupRuns     prometheus.Counter
+	cleanupDuration prometheus.Gauge
+	cleanupLast     prometheus.Gauge
+	cleanupReaped   prometheus.Counter
+	cleanupTimeout  prometheus.Counter
+	restarts        *prometheus.CounterVec
+	stallRestarts   *prometheus.CounterVec
+	segmentsServed  *prometheus.CounterVec
+	deniedRequests  *prometheus.CounterVec
+	reconnects      *prometheus.CounterVec
+	viewers         *prometheus.GaugeVec
+	peakViewers     *prometheus.GaugeVec
+	cpuPercent      *prometheus.GaugeVec
+	rssBytes        *prometheus.GaugeVec
+	encodeFPS       *prometheus.GaugeVec
+	encodeSpeed     *prometheus.GaugeVec
+}
+
+// Usage describes the resource usage of the transcoding process of a stream
+type Usage struct {
+	CPUPercent  float64
+	RSSBytes    float64
+	EncodeFPS   float64
+	EncodeSpeed float64
+}
+
+// NewCollector creates a new instance of Collector
+func NewCollector() *Collector {
+	c := &Collector{
+		mux:             &sync.Mutex{},
+		registry:        prometheus.NewRegistry(),
+		activeStreams:   gauge("rtsp_stream_active_streams", "Number of streams being transcoded"),
+		startRequests:   counter("rtsp_stream_start_requests_total", "Number of received start requests"),
+		startFailures:   counter("rtsp_stream_start_failures_total", "Number of failed start requests"),
+		cleanupRuns:     counter("rtsp_stream_cleanup_runs_total", "Number of cleanup runs"),
+		cleanupDuration: gauge("rtsp_stream_cleanup_duration_seconds", "Duration of the last cleanup run"),
+		cleanupLast:     gauge("rtsp_stream_cleanup_reaped", "Number of streams stopped by the last cleanup run"),
+		cleanupReaped:   counter("rtsp_stream_cleanup_reaped_total", "Number of streams stopped by the cleanup runs"),
+		cleanupTimeout:  counter("rtsp_stream_cleanup_timeouts_total", "Number of streams the cleanup runs gave up on after CLEANUP_STREAM_TIMEOUT"),
+		restarts:        counterVec("rtsp_stream_restarts_total", "Number of transcoding restarts per stream", "stream"),
+		stallRestarts:   counterVec("rtsp_stream_stall_restarts_total", "Number of restarts per stream after the process stopped writing segments", "stream"),
+		segmentsServed:  counterVec("rtsp_stream_segments_served_total", "Number of segment files served per stream", "stream"),
+		deniedRequests:  counterVec("rtsp_stream_denied_requests_total", "Number of requests denied by the access lists per routes", "routes"),
+		reconnects:      counterVec("rtsp_stream_reconnect_attempts_total", "Number of restarts of crashed streams reconnecting to their source per host", "host"),
+		viewers:         gaugeVec("rtsp_stream_viewers", "Number of clients watching the stream"),
+		peakViewers:     gaugeVec("rtsp_stream_peak_viewers", "Most clients watching the stream at the same time"),
+		cpuPercent:      gaugeVec("rtsp_stream_cpu_percent", "CPU used by the transcoding of the stream, 100 is a whole CPU"),
+		rssBytes:        gaugeVec("rtsp_stream_rss_bytes", "Resident memory of the transcoding of the stream"),
+		encodeFPS:       gaugeVec("rtsp_stream_encode_fps", "Number of frames the transcoding of the stream encodes per second"),
+		encodeSpeed:     gaugeVec("rtsp_stream_encode_speed", "Speed of the transcoding of the stream compared to the playback"),
+	}
+	c.registry.MustRegister(
+		c.activeStreams, c.startRequests, c.startFailures, c.cleanupRuns, c.cleanupDuration, c.cleanupLast,
+		c.cleanupReaped, c.cleanupTimeout, c.restarts, c.stallRestarts, c.segmentsServed, c.deniedRequests,
+		c.reconnects, c.viewers, c.peakViewers, c.cpuPercent, c.rssBytes, c.encodeFPS, c.encodeSpeed,
+	)
+	return c
+}
+
+// counter creates a counter without labels
+func counter(name, help string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: name, Help: help})
+}
+
+// gauge creates a gauge without labels
+func gauge(name, help string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+}
+
+// counterVec creates a counter with a single label
+func counterVec(name, help, label string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, []string{label})
+}
+
+// gaugeVec creates a gauge labeled by the id of the streams
+func gaugeVec(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, []string{"stream"})
+}
+
+// StartRequested increments the number of received start requests
+func (c *Collector) StartRequested() {
+	c.startRequests.Inc()
+}
+
+// StartFailed increments the number of failed start requests
+func (c *Collector) StartFailed() {
+	c.startFailures.Inc()
+}
+
+// CleanupRan increments the number of cleanup runs
+func (c *Collector) CleanupRan() {
+	c.cleanupRuns.Inc()
+}
+
+// CleanupFinished records the duration of the cleanup pass, the number of streams it stopped and the number of them it gave up on
+func (c *Collector) CleanupFinished(duration time.Duration, reaped, timedOut int) {
+	c.cleanupDuration.Set(duration.Seconds())
+	c.cleanupLast.Set(float64(reaped))
+	c.cleanupReaped.Add(float64(reaped))
+	c.cleanupTimeout.Add(float64(timedOut))
+}
+
+// Restarted increments the number of transcoding restarts for the given stream
+func (c *Collector) Restarted(id string) {
+	c.restarts.WithLabelValues(id).Inc()
+}
+
+// Stalled increments the number of restarts of the given stream after its process stopped writing segments
+func (c *Collector) Stalled(id string) {
+	c.stallRestarts.WithLabelValues(id).Inc()
+}
+
+// SegmentServed increments the number of segment files served for the given stream
+func (c *Collector) SegmentServed(id string) {
+	c.segmentsServed.WithLabelValues(id).Inc()
+}
+
+// Denied increments the number of requests denied by the access lists of the given routes
+func (c *Collector) Denied(routes string) {
+	c.deniedRequests.WithLabelValues(routes).Inc()
+}
+
+// Reconnecting increments the number of restarts of crashed streams reconnecting to the sources of the given host
+func (c *Collector) Reconnecting(host string) {
+	c.reconnects.WithLabelValues(host).Inc()
+}
+
+// Viewers replaces the current and the peak number of viewers of the streams
+func (c *Collector) Viewers(current, peak map[string]uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.viewers.Reset()
+	for id, value := range current {
+		c.viewers.WithLabelValues(id).Set(float64(value))
+	}
+	c.peakViewers.Reset()
+	for id, value := range peak {
+		c.peakViewers.WithLabelValues(id).Set(float64(value))
+	}
+}
+
+// Usage replaces the resource usage of the transcoding processes of the streams
+func (c *Collector) Usage(usage map[string]Usage) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, vec := range []*prometheus.GaugeVec{c.cpuPercent, c.rssBytes, c.encodeFPS, c.encodeSpeed} {
+		vec.Reset()
+	}
+	for id, value := range usage {
+		c.cpuPercent.WithLabelValues(id).Set(value.CPUPercent)
+		c.rssBytes.WithLabelValues(id).Set(value.RSSBytes)
+		c.encodeFPS.WithLabelValues(id).Set(value.EncodeFPS)
+		c.encodeSpeed.WithLabelValues(id).Set(value.EncodeSpeed)
+	}
+}
+
+// RemoveStream drops every series of the given stream
+func (c *Collector) RemoveStream(id string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, vec := range []*prometheus.CounterVec{c.restarts, c.stallRestarts, c.segmentsServed} {
+		vec.DeleteLabelValues(id)
+	}
+	for _, vec := range []*prometheus.GaugeVec{c.viewers, c.peakViewers, c.cpuPercent, c.rssBytes, c.encodeFPS, c.encodeSpeed} {
+		vec.DeleteLabelValues(id)
+	}
+}
+
+// Totals describes the counters of the collector, the ones of the streams are summed
+type Totals struct {
+	StartRequests uint64
+	StartFailures uint64
+	CleanupRuns   uint64
+	Restarts      uint64
+}
+
+// Totals returns the current value of the counters, the restarts only include the registered streams
+func (c *Collector) Totals() Totals {
+	return Totals{total(c.startRequests), total(c.startFailures), total(c.cleanupRuns), total(c.restarts)}
+}
+
+// total sums the series of the given counter
+func total(collector prometheus.Collector) uint64 {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(metrics)
+		close(metrics)
+	}()
+	sum := float64(0)
+	for metric := range metrics {
+		value := &dto.Metric{}
+		if err := metric.Write(value); err == nil {
+			sum += value.GetCounter().GetValue()
+		}
+	}
+	return uint64(sum)
+}
+
+// Write writes all metrics into the given writer
+func (c *Collector) Write(w io.Writer, activeStreams int) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.activeStreams.Set(float64(activeStreams))
+	families, err := c.registry.Gather()
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	t.Run("Should write every metric in text format", func(t *testing.T) {
+		collector := NewCollector()
+		collector.StartRequested()
+		collector.StartRequested()
+		collector.StartFailed()
+		collector.CleanupRan()
+		collector.CleanupFinished(time.Millisecond*1500, 2, 1)
+		collector.Restarted("first")
+		collector.Stalled("first")
+		collector.SegmentServed("first")
+		collector.SegmentServed("second")
+		collector.Denied("management")
+		collector.Reconnecting("192.168.0.1")
+		collector.Viewers(map[string]uint64{"first": 2}, map[string]uint64{"first": 3})
+		collector.Usage(map[string]Usage{"first": {CPUPercent: 87.5, RSSBytes: 52428800, EncodeFPS: 25, EncodeSpeed: 1.01}})
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, collector.Write(buf, 2))
+		output := buf.String()
+		assert.Contains(t, output, "# TYPE rtsp_stream_active_streams gauge\nrtsp_stream_active_streams 2\n")
+		assert.Contains(t, output, "rtsp_stream_start_requests_total 2\n")
+		assert.Contains(t, output, "rtsp_stream_start_failures_total 1\n")
+		assert.Contains(t, output, "rtsp_stream_cleanup_runs_total 1\n")
+		assert.Contains(t, output, "# TYPE rtsp_stream_cleanup_duration_seconds gauge\nrtsp_stream_cleanup_duration_seconds 1.5\n")
+		assert.Contains(t, output, "# TYPE rtsp_stream_cleanup_reaped gauge\nrtsp_stream_cleanup_reaped 2\n")
+		assert.Contains(t, output, "rtsp_stream_cleanup_reaped_total 2\n")
+		assert.Contains(t, output, "rtsp_stream_cleanup_timeouts_total 1\n")
+		assert.Contains(t, output, "rtsp_stream_restarts_total{stream=\"first\"} 1\n")
+		assert.Contains(t, output, "rtsp_stream_stall_restarts_total{stream=\"first\"} 1\n")
+		assert.Contains(t, output, "rtsp_stream_segments_served_total{stream=\"first\"} 1\n")
+		assert.Contains(t, output, "rtsp_stream_segments_served_total{stream=\"second\"} 1\n")
+		assert.Contains(t, output, "rtsp_stream_denied_requests_total{routes=\"management\"} 1\n")
+		assert.Contains(t, output, "rtsp_stream_reconnect_attempts_total{host=\"192.168.0.1\"} 1\n")
+		assert.Contains(t, output, "# TYPE rtsp_stream_viewers gauge\nrtsp_stream_viewers{stream=\"first\"} 2\n")
+		assert.Contains(t, output, "# TYPE rtsp_stream_peak_viewers gauge\nrtsp_stream_peak_viewers{stream=\"first\"} 3\n")
+		assert.Contains(t, output, "# TYPE rtsp_stream_cpu_percent gauge\nrtsp_stream_cpu_percent{stream=\"first\"} 87.5\n")
+		assert.Contains(t, output, "rtsp_stream_rss_bytes{stream=\"first\"} 5.24288e+07\n")
+		assert.Contains(t, output, "rtsp_stream_encode_fps{stream=\"first\"} 25\n")
+		assert.Contains(t, output, "rtsp_stream_encode_speed{stream=\"first\"} 1.01\n")
+	})
+
+	t.Run("Should not keep series of removed streams", func(t *testing.T) {
+		collector := NewCollector()
+		collector.Restarted("first")
+		collector.Stalled("first")
+		collector.SegmentServed("first")
+		collector.Viewers(map[string]uint64{"first": 1}, map[string]uint64{"first": 1})
+		collector.Usage(map[string]Usage{"first": {RSSBytes: 1}})
+		collector.RemoveStream("first")
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, collector.Write(buf, 0))
+		assert.NotContains(t, buf.String(), "first")
+	})
+
+	t.Run("Should sum the counters of the streams", func(t *testing.T) {
+		collector := NewCollector()
+		collector.StartRequested()
+		collector.CleanupRan()
+		collector.Restarted("first")
+		collector.Restarted("first")
+		collector.Restarted("second")
+		assert.Equal(t, Totals{StartRequests: 1, CleanupRuns: 1, Restarts: 3}, collector.Totals())
+	})
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Middleware wraps the handler of a route, like for tracing, authentication or logging of the requests
+type Middleware func(http.Handler) http.Handler
+
+// middlewares describes the middlewares of the routes. The ones of the start and the stream routes are used
+// instead of the ones of every route, if they are set
+type middlewares struct {
+	all    []Middleware
+	start  []Middleware
+	stream []Middleware
+}
+
+// WithMiddleware sets the middlewares of every route, the first one is the outermost
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Controller) {
+		c.middlewares.all = mw
+	}
+}
+
+// WithStartMiddleware sets the middlewares of the routes under /start, instead of the ones of every route
+func WithStartMiddleware(mw ...Middleware) Option {
+	return func(c *Controller) {
+		c.middlewares.start = mw
+	}
+}
+
+// WithStreamMiddleware sets the middlewares of the routes under /stream, instead of the ones of every route
+func WithStreamMiddleware(mw ...Middleware) Option {
+	return func(c *Controller) {
+		c.middlewares.stream = mw
+	}
+}
+
+// ResponseWriter is the writer the middlewares receive, so they can read the status code and the size
+// of the response once the handler returns
+type ResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+// Status returns the status code of the response, 0 if nothing was written yet
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// Written returns the number of bytes of the body written so far
+func (w *ResponseWriter) Written() int64 {
+	return w.written
+}
+
+// WriteHeader records the status code and writes it to the underlying writer
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the body and writes it to the underlying writer
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush sends the buffered data to the client if the underlying writer supports it
+func (w *ResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack takes over the connection for the WebSocket feed of the events
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, events.ErrHijackUnsupported
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+// paramsKey is the key of the params of the route in the context of the request
+type paramsKey struct{}
+
+// withMiddlewares applies the given middlewares to the handle. The params of the route are passed through
+// the context of the request, so the middlewares can replace the request
+func withMiddlewares(mw []Middleware, handle httprouter.Handle) httprouter.Handle {
+	if len(mw) == 0 {
+		return handle
+	}
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ps, _ := r.Context().Value(paramsKey{}).(httprouter.Params)
+		handle(w, r, ps)
+	})
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handler.ServeHTTP(&ResponseWriter{w, 0, 0}, r.WithContext(context.WithValue(r.Context(), paramsKey{}, ps)))
+	}
+}
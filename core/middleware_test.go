@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestLogger is a middleware logging the status code and the size of the responses
+func requestLogger(log func(line string)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			if rw, ok := w.(*ResponseWriter); ok {
+				log(fmt.Sprintf("%s %s %d %d", r.Method, r.URL.Path, rw.Status(), rw.Written()))
+			}
+		})
+	}
+}
+
+// tagger is a middleware adding a header naming the group of the route
+func tagger(group string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Route-Group", group)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ExampleWithMiddleware() {
+	ctrls := NewController(config.InitConfig(), WithMiddleware(requestLogger(func(line string) { fmt.Println(line) })))
+	defer ctrls.Shutdown(context.Background())
+	handler := ctrls.Handler()
+	for _, path := range []string{"/", "/status/unknown"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	// Output:
+	// GET / 200 0
+	// GET /status/unknown 404 112
+}
+
+func TestWithMiddleware(t *testing.T) {
+	t.Run("Should run the middlewares in their order and keep the params of the routes", func(t *testing.T) {
+		order := []string{}
+		mark := func(name string) Middleware {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					order = append(order, name)
+					next.ServeHTTP(w, r)
+				})
+			}
+		}
+		ctrls := NewController(config.InitConfig(), WithMiddleware(mark("first"), mark("second")), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		ctrls.setStream(generated.dirPath, &generated.strm)
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/status/"+generated.dirPath, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []string{"first", "second"}, order)
+	})
+
+	t.Run("Should use the middlewares of the start and the stream routes instead", func(t *testing.T) {
+		ctrls := NewController(
+			config.InitConfig(),
+			WithMiddleware(tagger("all")),
+			WithStartMiddleware(tagger("start")),
+			WithStreamMiddleware(tagger("stream")),
+			WithFileServer(http.NotFoundHandler()),
+		)
+		defer ctrls.Shutdown(context.Background())
+		handler := ctrls.Handler()
+		tt := []struct {
+			Method string
+			Path   string
+			Group  string
+		}{
+			{Method: http.MethodGet, Path: "/capacity", Group: "all"},
+			{Method: http.MethodPost, Path: "/start", Group: "start"},
+			{Method: http.MethodPost, Path: "/start/batch", Group: "start"},
+			{Method: http.MethodGet, Path: "/stream/unknown/index.m3u8", Group: "stream"},
+			{Method: http.MethodDelete, Path: "/stream/unknown", Group: "stream"},
+			{Method: http.MethodPost, Path: "/restart/unknown", Group: "all"},
+		}
+		for i, testCase := range tt {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(testCase.Method, testCase.Path, strings.NewReader("{}")))
+			if !assert.Equal(t, []string{testCase.Group}, rr.Header()["X-Route-Group"]) {
+				t.Error(fmt.Errorf("%d testcase is failing for TestWithMiddleware", i))
+			}
+		}
+	})
+
+	t.Run("Should see the responses refused by the authentication", func(t *testing.T) {
+		spec := config.InitConfig()
+		spec.APIKeys = []string{"reader:secret:list"}
+		lines := []string{}
+		ctrls := NewController(spec, WithMiddleware(requestLogger(func(line string) { lines = append(lines, line) })))
+		defer ctrls.Shutdown(context.Background())
+		ctrls.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/capacity", nil))
+		assert.Len(t, lines, 1)
+		assert.True(t, strings.HasPrefix(lines[0], "GET /capacity 401 "), lines[0])
+	})
+}
+
+func TestResponseWriter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	w := &ResponseWriter{rr, 0, 0}
+	assert.Equal(t, 0, w.Status())
+	w.Write([]byte("hello"))
+	w.WriteHeader(http.StatusTeapot)
+	w.Write([]byte(" world"))
+	w.Flush()
+	assert.Equal(t, http.StatusOK, w.Status())
+	assert.Equal(t, int64(11), w.Written())
+	assert.True(t, rr.Flushed)
+	_, _, err := w.Hijack()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// relayedStream returns the stream played from its MPEG-TS output, with the authorization rules of the files of the streams.
+// The error is sent if the stream was started without the output. Returns false if the response has been sent
+func (c *Controller) relayedStream(w http.ResponseWriter, req *http.Request, id string, noRelay error) (string, *streaming.Stream, bool) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, req) {
+		return "", nil, false
+	}
+	id = c.resolveID(id)
+	if c.spec().URLSigningEnabled {
+		if err := c.signer().Verify(id, req.URL.Query()); err != nil {
+			c.logger(req.Context()).Errorf("%s could not be played, %s", id, err)
+			c.SendError(w, err, http.StatusForbidden)
+			return "", nil, false
+		}
+	}
+	s, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return "", nil, false
+	}
+	if !c.checkPlaybackToken(w, req, id, s) {
+		return "", nil, false
+	}
+	if s.Relay == nil {
+		c.SendError(w, noRelay, http.StatusConflict)
+		return "", nil, false
+	}
+	return id, s, true
+}
+
+// MPEGTSHandler is the HTTP handler of the GET /mpegts/:id calls. It streams the MPEG-TS output of the transcoding
+// to the client until it disconnects, the inactive streams are restarted like by the requests of their files.
+// Clients that cannot keep up with the stream are disconnected instead of buffering the stream for them
+func (c *Controller) MPEGTSHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id, s, ok := c.relayedStream(w, req, ps.ByName("id"), ErrNoMPEGTS)
+	if !ok {
+		return
+	}
+	client := s.Relay.Subscribe()
+	defer s.Relay.Unsubscribe(client)
+	c.watched(id, req)
+	if !c.activate(w, req, id, s) {
+		return
+	}
+	c.logger(req.Context()).Debugf("MPEG-TS client of %s is connected", id)
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	// The connected clients are viewers and keep the stream running, like the players requesting its playlist
+	interval := c.spec().ViewerWindow / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	alive := time.NewTicker(interval)
+	defer alive.Stop()
+	defer func() {
+		c.watched(id, req)
+		s.Touch()
+	}()
+	for {
+		select {
+		case chunk, ok := <-client.Chunks():
+			// The client is dropped by the relay if it fell behind, or every client is dropped when the stream is stopped
+			if !ok {
+				c.logger(req.Context()).Debugf("MPEG-TS client of %s is disconnected by the stream", id)
+				return
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-alive.C:
+			c.watched(id, req)
+			s.Touch()
+			if s.Streak.IsActive() {
+				s.Hit(c.now())
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestMPEGTSHandler(t *testing.T) {
+	setup := func(enabled bool) (*Controller, *httptest.Server, *int32) {
+		spawned := int32(0)
+		conf := config.InitConfig()
+		conf.MPEGTSEnabled = enabled
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{spawned: &spawned}
+		return ctrls, httptest.NewServer(ctrls.Handler()), &spawned
+	}
+	start := func(ctrls *Controller, uri string) (*streaming.Stream, string) {
+		b, _ := json.Marshal(StreamDto{URI: uri})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		id, _ := streaming.GetURIDirectory(uri)
+		strm, _ := ctrls.getStream(id)
+		return strm, id
+	}
+	connected := func(strm *streaming.Stream) bool {
+		return waitUntil(func() bool { return strm.Relay.Clients() == 1 }, time.Second*5)
+	}
+
+	t.Run("Should relay the stream to the clients and count them as viewers", func(t *testing.T) {
+		ctrls, server, spawned := setup(true)
+		defer ctrls.Shutdown(context.Background())
+		defer server.Close()
+		strm, id := start(ctrls, "rtsp://192.168.0.1/mpegts")
+		if !assert.NotNil(t, strm) || !assert.NotNil(t, strm.Relay) {
+			return
+		}
+		// Inactive streams are restarted by their clients
+		strm.Streak.Deactivate()
+		res, err := http.Get(server.URL + "/mpegts/" + id)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "video/mp2t", res.Header.Get("Content-Type"))
+		assert.True(t, connected(strm))
+		assert.Equal(t, int32(2), atomic.LoadInt32(spawned))
+		assert.True(t, strm.Streak.IsActive())
+		viewers, _ := ctrls.streamViewers(id)
+		assert.Equal(t, 1, viewers)
+
+		packets := bytes.Repeat([]byte{0x47}, 2*188)
+		strm.Relay.Write(packets)
+		received := make([]byte, len(packets))
+		_, err = io.ReadFull(res.Body, received)
+		assert.Nil(t, err)
+		assert.Equal(t, packets, received)
+
+		// The clients are disconnected once the stream is stopped
+		strm.Relay.Disconnect()
+		rest, _ := ioutil.ReadAll(res.Body)
+		assert.Empty(t, rest)
+	})
+
+	t.Run("Should refuse the unknown streams and the ones without the output", func(t *testing.T) {
+		ctrls, server, _ := setup(true)
+		defer ctrls.Shutdown(context.Background())
+		defer server.Close()
+		res, err := http.Get(server.URL + "/mpegts/unknown")
+		if assert.Nil(t, err) {
+			res.Body.Close()
+			assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		}
+		strm, id := start(ctrls, "rtsp://192.168.0.2/mpegts")
+		strm.Relay = nil
+		res, err = http.Get(server.URL + "/mpegts/" + id)
+		if assert.Nil(t, err) {
+			b, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.Equal(t, http.StatusConflict, res.StatusCode)
+			assert.Contains(t, string(b), "mpegts_unavailable")
+		}
+	})
+
+	t.Run("Should only be routed if it is enabled", func(t *testing.T) {
+		ctrls, server, _ := setup(false)
+		defer ctrls.Shutdown(context.Background())
+		defer server.Close()
+		strm, id := start(ctrls, "rtsp://192.168.0.3/mpegts")
+		assert.Nil(t, strm.Relay)
+		res, err := http.Get(server.URL + "/mpegts/" + id)
+		if assert.Nil(t, err) {
+			res.Body.Close()
+			assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package onvif
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MulticastAddress is the address the WS-Discovery probes are sent to
+const MulticastAddress = "239.255.255.250:3702"
+
+// ErrDiscoveryFailed describes an error for discoveries that could not send their probe
+var ErrDiscoveryFailed = errors.New("Cameras could not be discovered")
+
+// Credentials are the username and password the ONVIF services of the cameras are queried with
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Camera describes a camera that answered the discovery
+type Camera struct {
+	Address  string    `json:"address"`
+	Model    string    `json:"model,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	RTSPURI  string    `json:"rtspUri,omitempty"` // Stream URI of the first profile of the camera
+	Profiles []Profile `json:"profiles"`
+	// Error describes why the stream URIs of the camera could not be queried, like missing credentials
+	Error string `json:"error,omitempty"`
+	// services are the addresses of the device service of the camera
+	services []string
+}
+
+// Profile describes a media profile of a camera and the URI it is streamed from
+type Profile struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	RTSPURI  string `json:"rtspUri,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// IDiscoverer finds the cameras of the local network
+type IDiscoverer interface {
+	Discover(ctx context.Context, creds Credentials) ([]Camera, error)
+}
+
+// Discoverer finds the ONVIF cameras of the local network with WS-Discovery, then queries their media service for the
+// stream URIs of their profiles. The answers of the probe are collected for the wait, the whole discovery is bounded
+// by the context
+type Discoverer struct {
+	address string
+	wait    time.Duration
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewDiscoverer creates a new instance of Discoverer sending its probes to the given address
+func NewDiscoverer(address string, wait time.Duration) *Discoverer {
+	return &Discoverer{address, wait, &http.Client{}, time.Now}
+}
+
+// probeMatches describes the part of the answers to the WS-Discovery probe that is used
+type probeMatches struct {
+	Matches []struct {
+		Endpoint string `xml:"EndpointReference>Address"`
+		Scopes   string `xml:"Scopes"`
+		XAddrs   string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// probeMessage is the WS-Discovery probe of the network video transmitters
+const probeMessage = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<s:Header><a:MessageID>%s</a:MessageID><a:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To><a:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action></s:Header>
+<s:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></s:Body>
+</s:Envelope>`
+
+// messageID generates a random urn:uuid for the messages
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6], b[8] = b[6]&0x0f|0x40, b[8]&0x3f|0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Discover probes the network for cameras and queries their stream URIs with the given credentials.
+// The cameras whose URIs could not be queried are returned with the error they failed with
+func (d *Discoverer) Discover(ctx context.Context, creds Credentials) ([]Camera, error) {
+	cameras, err := d.probe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	for i := range cameras {
+		wg.Add(1)
+		go func(camera *Camera) {
+			defer wg.Done()
+			if err := d.describe(ctx, camera, creds); err != nil {
+				camera.Error = err.Error()
+			}
+		}(&cameras[i])
+	}
+	wg.Wait()
+	return cameras, nil
+}
+
+// probe sends the WS-Discovery probe and collects the cameras answering it until the wait is over
+func (d *Discoverer) probe(ctx context.Context) ([]Camera, error) {
+	target, err := net.ResolveUDPAddr("udp4", d.address)
+	if err != nil {
+		return nil, ErrDiscoveryFailed
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, ErrDiscoveryFailed
+	}
+	defer conn.Close()
+	if _, err := conn.WriteToUDP([]byte(fmt.Sprintf(probeMessage, messageID())), target); err != nil {
+		return nil, ErrDiscoveryFailed
+	}
+	deadline := time.Now().Add(d.wait)
+	if limit, ok := ctx.Deadline(); ok && limit.Before(deadline) {
+		deadline = limit
+	}
+	conn.SetReadDeadline(deadline)
+	// The reading is stopped if the discovery is canceled before the wait is over
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	cameras := []Camera{}
+	seen := map[string]bool{}
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return cameras, nil
+		}
+		var matches probeMatches
+		if err := xml.Unmarshal(buf[:n], &matches); err != nil {
+			continue
+		}
+		for _, match := range matches.Matches {
+			services := strings.Fields(match.XAddrs)
+			key := match.Endpoint
+			if key == "" {
+				key = match.XAddrs
+			}
+			if len(services) == 0 || seen[key] {
+				continue
+			}
+			seen[key] = true
+			cameras = append(cameras, newCamera(services, strings.Fields(match.Scopes)))
+		}
+	}
+}
+
+// newCamera creates the camera of the given device services, its model and name are read from the scopes
+func newCamera(services, scopes []string) Camera {
+	camera := Camera{Profiles: []Profile{}, services: services}
+	if u, err := url.Parse(services[0]); err == nil {
+		camera.Address = u.Hostname()
+	}
+	for _, scope := range scopes {
+		value := func(prefix string) string {
+			if !strings.HasPrefix(scope, prefix) {
+				return ""
+			}
+			unescaped, err := url.PathUnescape(strings.TrimPrefix(scope, prefix))
+			if err != nil {
+				return ""
+			}
+			return unescaped
+		}
+		if model := value("onvif://www.onvif.org/hardware/"); model != "" {
+			camera.Model = model
+		}
+		if name := value("onvif://www.onvif.org/name/"); name != "" {
+			camera.Name = name
+		}
+	}
+	return camera
+}
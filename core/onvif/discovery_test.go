@@ -0,0 +1,172 @@
+package onvif
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const probeMatch = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<SOAP-ENV:Body><d:ProbeMatches><d:ProbeMatch>
+<wsa:EndpointReference><wsa:Address>urn:uuid:%s</wsa:Address></wsa:EndpointReference>
+<d:Types>dn:NetworkVideoTransmitter</d:Types>
+<d:Scopes>onvif://www.onvif.org/type/video_encoder onvif://www.onvif.org/hardware/DS-2CD2042 onvif://www.onvif.org/name/Front%%20door</d:Scopes>
+<d:XAddrs>%s</d:XAddrs>
+</d:ProbeMatch></d:ProbeMatches></SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+const soapResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body>%s</env:Body>
+</env:Envelope>`
+
+const notAuthorized = `<env:Fault><env:Code><env:Value>env:Sender</env:Value><env:Subcode><env:Value>ter:NotAuthorized</env:Value></env:Subcode></env:Code><env:Reason><env:Text>Sender not Authorized</env:Text></env:Reason></env:Fault>`
+
+// fakeCamera serves the device and the media service of a camera accepting the password only
+func fakeCamera(t *testing.T, password string) *httptest.Server {
+	var server *httptest.Server
+	field := func(body, name string) string {
+		match := regexp.MustCompile(`<` + name + `[^>]*>([^<]*)</` + name + `>`).FindStringSubmatch(body)
+		if match == nil {
+			return ""
+		}
+		return match[1]
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body := string(b)
+		nonce, _ := base64.StdEncoding.DecodeString(field(body, "Nonce"))
+		if field(body, "Password") != PasswordDigest(nonce, field(body, "Created"), password) || field(body, "Username") != "admin" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, soapResponse, notAuthorized)
+			return
+		}
+		switch {
+		case strings.Contains(body, "GetCapabilities") && r.URL.Path == "/onvif/device_service":
+			fmt.Fprintf(w, soapResponse, `<tds:GetCapabilitiesResponse><tds:Capabilities><tt:Media><tt:XAddr>`+server.URL+`/onvif/media</tt:XAddr></tt:Media></tds:Capabilities></tds:GetCapabilitiesResponse>`)
+		case strings.Contains(body, "GetProfiles") && r.URL.Path == "/onvif/media":
+			fmt.Fprintf(w, soapResponse, `<trt:GetProfilesResponse>
+<trt:Profiles token="main"><tt:Name>Main</tt:Name><tt:VideoEncoderConfiguration token="v1"><tt:Encoding>H264</tt:Encoding><tt:Resolution><tt:Width>1920</tt:Width><tt:Height>1080</tt:Height></tt:Resolution></tt:VideoEncoderConfiguration></trt:Profiles>
+<trt:Profiles token="sub"><tt:Name>Sub</tt:Name></trt:Profiles>
+</trt:GetProfilesResponse>`)
+		case strings.Contains(body, "GetStreamUri") && r.URL.Path == "/onvif/media":
+			token := field(body, "trt:ProfileToken")
+			fmt.Fprintf(w, soapResponse, `<trt:GetStreamUriResponse><trt:MediaUri><tt:Uri>rtsp://192.0.2.10:554/`+token+`</tt:Uri></trt:MediaUri></trt:GetStreamUriResponse>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+// fakeResponder answers the probes with the matches of the given services, every match is sent twice like on lossy networks
+func fakeResponder(t *testing.T, services ...string) *net.UDPConn {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if !strings.Contains(string(buf[:n]), "NetworkVideoTransmitter") {
+				continue
+			}
+			for i, service := range services {
+				match := fmt.Sprintf(probeMatch, fmt.Sprintf("camera-%d", i), service)
+				conn.WriteToUDP([]byte(match), addr)
+				conn.WriteToUDP([]byte(match), addr)
+			}
+			conn.WriteToUDP([]byte("not xml"), addr)
+		}
+	}()
+	return conn
+}
+
+func TestDiscover(t *testing.T) {
+	camera := fakeCamera(t, "secret")
+	defer camera.Close()
+	responder := fakeResponder(t, camera.URL+"/onvif/device_service")
+	defer responder.Close()
+
+	t.Run("Should find the cameras and the stream URIs of their profiles", func(t *testing.T) {
+		d := NewDiscoverer(responder.LocalAddr().String(), 200*time.Millisecond)
+		cameras, err := d.Discover(context.Background(), Credentials{"admin", "secret"})
+		assert.Nil(t, err)
+		if !assert.Len(t, cameras, 1) {
+			return
+		}
+		assert.Equal(t, "127.0.0.1", cameras[0].Address)
+		assert.Equal(t, "DS-2CD2042", cameras[0].Model)
+		assert.Equal(t, "Front door", cameras[0].Name)
+		assert.Equal(t, "rtsp://192.0.2.10:554/main", cameras[0].RTSPURI)
+		assert.Equal(t, []Profile{
+			{Token: "main", Name: "Main", RTSPURI: "rtsp://192.0.2.10:554/main", Encoding: "H264", Width: 1920, Height: 1080},
+			{Token: "sub", Name: "Sub", RTSPURI: "rtsp://192.0.2.10:554/sub"},
+		}, cameras[0].Profiles)
+		assert.Empty(t, cameras[0].Error)
+	})
+
+	t.Run("Should report the cameras refusing the credentials", func(t *testing.T) {
+		d := NewDiscoverer(responder.LocalAddr().String(), 200*time.Millisecond)
+		cameras, err := d.Discover(context.Background(), Credentials{"admin", "wrong"})
+		assert.Nil(t, err)
+		if !assert.Len(t, cameras, 1) {
+			return
+		}
+		assert.Equal(t, ErrUnauthorized.Error(), cameras[0].Error)
+		assert.Empty(t, cameras[0].RTSPURI)
+		assert.Equal(t, []Profile{}, cameras[0].Profiles)
+	})
+
+	t.Run("Should stop the discovery once the context is done", func(t *testing.T) {
+		d := NewDiscoverer(responder.LocalAddr().String(), time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		began := time.Now()
+		cameras, err := d.Discover(ctx, Credentials{"admin", "secret"})
+		assert.Nil(t, err)
+		assert.True(t, time.Since(began) < 5*time.Second)
+		if !assert.Len(t, cameras, 1) {
+			return
+		}
+		// The wait took the whole context, so the stream URIs could not be queried anymore
+		assert.Equal(t, ErrServiceFailed.Error(), cameras[0].Error)
+	})
+
+	t.Run("Should fail for addresses the probe cannot be sent to", func(t *testing.T) {
+		d := NewDiscoverer("not an address", time.Millisecond)
+		_, err := d.Discover(context.Background(), Credentials{})
+		assert.Equal(t, ErrDiscoveryFailed, err)
+	})
+}
+
+func TestPasswordDigest(t *testing.T) {
+	tt := []struct {
+		Nonce    string
+		Created  string
+		Password string
+		Digest   string
+	}{
+		// The example of the ONVIF application programmer's guide
+		{Nonce: "LKqI6G/AikKCQrN0zqZFlg==", Created: "2010-09-16T07:50:45Z", Password: "userpassword", Digest: "tuOSpGlFlIXsozq4HFNeeGeFLEI="},
+	}
+	for i, testCase := range tt {
+		nonce, _ := base64.StdEncoding.DecodeString(testCase.Nonce)
+		if !assert.Equal(t, testCase.Digest, PasswordDigest(nonce, testCase.Created, testCase.Password)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestPasswordDigest", i))
+		}
+	}
+}
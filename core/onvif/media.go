@@ -0,0 +1,174 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized describes an error for cameras refusing the credentials of the discovery
+var ErrUnauthorized = errors.New("Camera refused the credentials")
+
+// ErrServiceFailed describes an error for ONVIF services answering with a fault or with an unexpected response
+var ErrServiceFailed = errors.New("Camera could not be queried")
+
+// envelope is the SOAP envelope of the requests sent to the ONVIF services
+const envelope = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<s:Header>%s</s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+// securityHeader is the WS-Security header carrying the digest of the password
+const securityHeader = `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><UsernameToken><Username>%s</Username><Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password><Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">%s</Nonce><Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created></UsernameToken></Security>`
+
+// PasswordDigest returns the WS-Security digest of the password, the base64 encoded SHA-1 of the nonce,
+// the creation time and the password
+func PasswordDigest(nonce []byte, created, password string) string {
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// escape escapes the value for the XML documents
+func escape(value string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// header returns the security header of the requests, empty if there is no username to authenticate with
+func (d *Discoverer) header(creds Credentials) string {
+	if creds.Username == "" {
+		return ""
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := d.now().UTC().Format(time.RFC3339)
+	return fmt.Sprintf(securityHeader,
+		escape(creds.Username),
+		PasswordDigest(nonce, created, creds.Password),
+		base64.StdEncoding.EncodeToString(nonce),
+		created,
+	)
+}
+
+// fault describes the SOAP faults of the services
+type fault struct {
+	Fault *struct {
+		Reason string `xml:"Reason>Text"`
+		Code   string `xml:"Code>Subcode>Value"`
+	} `xml:"Body>Fault"`
+}
+
+// call sends the body to the ONVIF service and decodes its answer into the response
+func (d *Discoverer) call(ctx context.Context, service string, creds Credentials, body string, response interface{}) error {
+	payload := fmt.Sprintf(envelope, d.header(creds), body)
+	req, err := http.NewRequest(http.MethodPost, service, strings.NewReader(payload))
+	if err != nil {
+		return ErrServiceFailed
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+	res, err := d.client.Do(req)
+	if err != nil {
+		return ErrServiceFailed
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return ErrServiceFailed
+	}
+	var f fault
+	if xml.Unmarshal(b, &f) == nil && f.Fault != nil {
+		if res.StatusCode == http.StatusUnauthorized || strings.HasSuffix(f.Fault.Code, "NotAuthorized") ||
+			strings.HasSuffix(f.Fault.Code, "FailedAuthentication") {
+			return ErrUnauthorized
+		}
+		return ErrServiceFailed
+	}
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return ErrUnauthorized
+	}
+	if res.StatusCode != http.StatusOK || xml.Unmarshal(b, response) != nil {
+		return ErrServiceFailed
+	}
+	return nil
+}
+
+// capabilitiesResponse describes the answer of GetCapabilities
+type capabilitiesResponse struct {
+	Media string `xml:"Body>GetCapabilitiesResponse>Capabilities>Media>XAddr"`
+}
+
+// profilesResponse describes the answer of GetProfiles
+type profilesResponse struct {
+	Profiles []struct {
+		Token   string `xml:"token,attr"`
+		Name    string `xml:"Name"`
+		Encoder struct {
+			Encoding string `xml:"Encoding"`
+			Width    int    `xml:"Resolution>Width"`
+			Height   int    `xml:"Resolution>Height"`
+		} `xml:"VideoEncoderConfiguration"`
+	} `xml:"Body>GetProfilesResponse>Profiles"`
+}
+
+// streamURIResponse describes the answer of GetStreamUri
+type streamURIResponse struct {
+	URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+}
+
+// mediaService returns the address of the media service of the camera. Cameras reporting no media service
+// are expected to serve it on their device service
+func (d *Discoverer) mediaService(ctx context.Context, service string, creds Credentials) (string, error) {
+	var capabilities capabilitiesResponse
+	body := `<tds:GetCapabilities><tds:Category>Media</tds:Category></tds:GetCapabilities>`
+	if err := d.call(ctx, service, creds, body, &capabilities); err != nil {
+		return "", err
+	}
+	if capabilities.Media == "" {
+		return service, nil
+	}
+	return capabilities.Media, nil
+}
+
+// describe queries the profiles of the camera and their stream URIs, the first device service answering is used
+func (d *Discoverer) describe(ctx context.Context, camera *Camera, creds Credentials) error {
+	err := ErrServiceFailed
+	for _, service := range camera.services {
+		var media string
+		if media, err = d.mediaService(ctx, service, creds); err != nil {
+			continue
+		}
+		var profiles profilesResponse
+		if err = d.call(ctx, media, creds, `<trt:GetProfiles/>`, &profiles); err != nil {
+			continue
+		}
+		for _, p := range profiles.Profiles {
+			profile := Profile{p.Token, p.Name, "", p.Encoder.Encoding, p.Encoder.Width, p.Encoder.Height}
+			var stream streamURIResponse
+			body := fmt.Sprintf(`<trt:GetStreamUri><trt:StreamSetup><tt:Stream>RTP-Unicast</tt:Stream><tt:Transport><tt:Protocol>RTSP</tt:Protocol></tt:Transport></trt:StreamSetup><trt:ProfileToken>%s</trt:ProfileToken></trt:GetStreamUri>`, escape(p.Token))
+			if err := d.call(ctx, media, creds, body, &stream); err == nil {
+				profile.RTSPURI = strings.TrimSpace(stream.URI)
+			}
+			if camera.RTSPURI == "" {
+				camera.RTSPURI = profile.RTSPURI
+			}
+			camera.Profiles = append(camera.Profiles, profile)
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,530 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/onvif"
+)
+
+// openAPIVersion is the version of the OpenAPI specification the description of the API follows
+const openAPIVersion = "3.0.3"
+
+// absoluteDescription describes the absolute parameter of the endpoints returning the URIs of the streams
+const absoluteDescription = "Returns the URIs prefixed with the public URL of the service, or with the origin the request was sent to if there is none"
+
+// apiParam describes a query parameter of an endpoint
+type apiParam struct {
+	Name        string
+	Type        string // Can be "string", "integer" or "boolean"
+	Description string
+}
+
+// apiOneOf describes a response that is sent in one of the shapes, depending on the request
+type apiOneOf []interface{}
+
+// apiOperation describes an endpoint for the OpenAPI description. The endpoint is only described if its route
+// is registered, so the endpoints turned off in the configuration are left out
+type apiOperation struct {
+	Method string
+	Route  string // Path of the route as it is registered on the router
+	// Path is the described path if it differs from the route, like the logs served by the route of the files
+	Path       string
+	Summary    string
+	Tag        string
+	Permission string // Permission of the API keys the endpoint requires, empty if the endpoint is not protected
+	// Media indicates if the endpoint is requested by the players, those are only protected if the files of the streams are.
+	// Playback indicates if the endpoint requires the playback token of the stream if the tokens are enabled
+	Media    bool
+	Playback bool
+	Signed   bool // Indicates if the URLs of the endpoint are signed if URL signing is enabled
+	Query    []apiParam
+	// Request is the JSON body of the endpoint, RequestType is the type of the body if it is not JSON
+	Request     interface{}
+	RequestType string
+	// Response is the JSON body of the successful responses, ResponseType is the type of the body if it is not JSON
+	Response     interface{}
+	ResponseType string
+	Status       int   // Status of the successful responses, 200 if it is not set
+	Errors       []int // Statuses of the errors the endpoint responds with, besides the ones of the authentication
+}
+
+// apiOperations are the endpoints of the controller, in the order they are described
+var apiOperations = []apiOperation{
+	{Method: http.MethodGet, Route: "/", Summary: "Answers with 200 if the service is up", Tag: "service"},
+	{Method: http.MethodHead, Route: "/", Summary: "Answers with 200 if the service is up", Tag: "service"},
+	{Method: http.MethodGet, Route: "/openapi.json", Summary: "Describes the endpoints of the running service", Tag: "service", Permission: "list"},
+	{Method: http.MethodGet, Route: "/docs", Summary: "Serves the Swagger UI of the API", Tag: "service", Permission: "list", ResponseType: "text/html"},
+	{Method: http.MethodGet, Route: "/version", Summary: "Describes the build of the service and the version of ffmpeg", Tag: "service", Permission: "list", Response: VersionDto{}},
+	{Method: http.MethodGet, Route: "/capacity", Summary: "Returns the number of running streams and the limit of them", Tag: "service", Permission: "list", Response: CapacityDto{}},
+	{Method: http.MethodGet, Route: "/storage", Summary: "Describes the disk usage of the streams", Tag: "service", Permission: "list", Response: StorageDto{}},
+	{Method: http.MethodGet, Route: "/health", Summary: "Describes the health of the service", Tag: "service", Permission: "list", Response: HealthDto{}},
+	{Method: http.MethodGet, Route: "/metrics", Summary: "Serves the Prometheus metrics", Tag: "service", Permission: "list", ResponseType: "text/plain"},
+	{Method: http.MethodGet, Route: "/events", Summary: "Streams the lifecycle events of the streams over WebSocket", Tag: "service", Permission: "list",
+		Response: events.Event{}, Status: http.StatusSwitchingProtocols, Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodGet, Route: "/events/log", Summary: "Lists the last events kept in memory, from the oldest to the newest", Tag: "service", Permission: "list",
+		Query: []apiParam{
+			{"stream", "string", "Lists the events of the given stream only"},
+			{"since", "string", "Lists the events after the given time, like 2019-01-20T12:00:00Z, or within the given duration, like 10m"},
+			{"level", "string", "Lists the events at least as severe as info, warning or error"},
+		},
+		Response: []events.Event{}, Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodPost, Route: "/admin/reload", Summary: "Reloads the configuration", Tag: "admin", Permission: "admin", Response: ReloadDto{}, Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodPost, Route: "/admin/stopAll", Summary: "Stops the transcoding of every running stream, 207 if any of them failed", Tag: "admin", Permission: "admin",
+		Query: []apiParam{
+			{"wipe", "boolean", "Removes the files of the stopped streams"},
+			{"graceSeconds", "integer", "Seconds the processes have to exit before they are killed, SHUTDOWN_GRACE if it is not given"},
+			{"dryRun", "boolean", "Lists the streams that would be stopped without stopping them"},
+		},
+		Response: StopAllDto{}, Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/admin/reconcile", Summary: "Removes the orphaned directories of the store, 207 if any of them could not be removed", Tag: "admin", Permission: "admin",
+		Query:    []apiParam{{"dryRun", "boolean", "Lists the orphaned directories without removing them"}},
+		Response: ReconcileDto{}, Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/admin/debug", Summary: "Describes the effective configuration and the transcoding processes of the streams", Tag: "admin", Permission: "admin", Response: AdminDebugDto{}},
+	{Method: http.MethodGet, Route: "/debug/vars", Summary: "Serves the expvar variables and the ones of the service", Tag: "admin", Permission: "admin", Response: DebugVarsDto{}},
+	{Method: http.MethodGet, Route: "/debug/pprof/*profile", Summary: "Serves the pprof profiles of the runtime", Tag: "admin", Permission: "admin", ResponseType: "application/octet-stream"},
+	{Method: http.MethodPost, Route: "/debug/pprof/*profile", Summary: "Serves the pprof profiles of the runtime", Tag: "admin", Permission: "admin", ResponseType: "application/octet-stream"},
+	{Method: http.MethodGet, Route: "/discover", Summary: "Discovers the ONVIF cameras of the local network", Tag: "streams", Permission: "start",
+		Query:    []apiParam{{"start", "boolean", "Starts the discovered cameras like a batch"}},
+		Response: []DiscoveredDto{}, Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: http.MethodPost, Route: "/discover", Summary: "Discovers the ONVIF cameras of the local network with the given credentials", Tag: "streams", Permission: "start",
+		Query:   []apiParam{{"start", "boolean", "Starts the discovered cameras like a batch"}},
+		Request: onvif.Credentials{}, Response: []DiscoveredDto{}, Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: http.MethodGet, Route: "/list", Summary: "Lists the streams, a page of them if they are filtered, sorted or paginated", Tag: "streams", Permission: "list",
+		Query: []apiParam{
+			{"running", "boolean", "Lists the running or the stopped streams only"},
+			{"label", "string", "Metadata the streams have to contain as key:value, can be repeated"},
+			{"sort", "string", "Can be uri, started or lastActive"},
+			{"limit", "integer", "Number of the streams of the page"},
+			{"offset", "integer", "Number of the streams skipped before the page"},
+			{"verbose", "boolean", "Adds the resource usage of the running transcoding to the streams"},
+			{"absolute", "boolean", absoluteDescription},
+		},
+		Response: apiOneOf{[]SummariseDto{}, ListDto{}}, Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodPost, Route: "/start", Summary: "Starts the transcoding of a stream", Tag: "streams", Permission: "start",
+		Query: []apiParam{
+			{"wait", "boolean", "Responds once the first segment of the stream is written, and once the queued start got a free slot"},
+			{"dryRun", "boolean", "Only validates the start and probes the source, nothing is started"},
+			{"absolute", "boolean", absoluteDescription},
+		},
+		Request: StreamDto{}, Response: StreamDto{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusConflict, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusInsufficientStorage,
+			http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType}},
+	{Method: http.MethodPost, Route: "/start/batch", Summary: "Starts multiple streams, 207 if any of them failed", Tag: "streams", Permission: "start",
+		Query:   []apiParam{{"absolute", "boolean", absoluteDescription}},
+		Request: BatchStartDto{}, Response: []BatchResultDto{}, Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodGet, Route: "/status/:id", Summary: "Describes the transcoding of the stream", Tag: "streams", Permission: "list",
+		Query:    []apiParam{{"absolute", "boolean", absoluteDescription}},
+		Response: StatusDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/health/:id", Summary: "Describes the health of the stream, 503 if it is stalled or errored", Tag: "streams", Permission: "list",
+		Response: StreamHealthDto{}, Errors: []int{http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/restart/:id", Summary: "Restarts the transcoding of the stream", Tag: "streams", Permission: "start",
+		Query:    []apiParam{{"wipe", "boolean", "Removes the files of the stream before the restart"}},
+		Response: StreamDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: http.MethodDelete, Route: "/stream/:id", Summary: "Stops and removes the stream", Tag: "streams", Permission: "stop",
+		Query:  []apiParam{{"keepRecordings", "boolean", "Keeps the recordings of the stream, the configuration decides if it is not given"}},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError}},
+	{Method: http.MethodPatch, Route: "/stream/:id", Summary: "Replaces the time to live of the stream, 0 removes it, or its source, which restarts it", Tag: "streams", Permission: "start",
+		Request: PatchDto{}, Response: apiOneOf{ExpiryDto{}, StreamDto{}},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, http.StatusInternalServerError}},
+	{Method: http.MethodPatch, Route: "/stream/:id/metadata", Summary: "Changes the metadata of the stream, the keys set to null are removed", Tag: "streams", Permission: "start",
+		Request: map[string]*string{}, Response: map[string]string{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPatch, Route: "/stream/:id/lifecycle", Summary: "Switches the lifecycle policy of the stream", Tag: "streams", Permission: "start",
+		Request: LifecycleDto{}, Response: LifecycleDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPatch, Route: "/stream/:id/retry", Summary: "Changes the retry policy of the stream, the fields left out are kept", Tag: "streams", Permission: "start",
+		Request: RetryDto{}, Response: RetryDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPatch, Route: "/stream/:id/group", Summary: "Moves the stream into a group, null or empty removes it from its group", Tag: "streams", Permission: "start",
+		Request: StreamGroupDto{}, Response: StreamGroupDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPatch, Route: "/stream/:id/priority", Summary: "Changes the priority of the stream deciding the evictions", Tag: "streams", Permission: "start",
+		Request: PriorityDto{}, Response: PriorityDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/groups", Summary: "Lists the groups of the streams with the number of their members", Tag: "groups", Permission: "list",
+		Response: []GroupDto{}},
+	{Method: http.MethodGet, Route: "/groups/:name/list", Summary: "Lists the streams of the group", Tag: "groups", Permission: "list",
+		Query:    []apiParam{{"verbose", "boolean", "Adds the resource usage of the running transcoding to the streams"}, {"absolute", "boolean", absoluteDescription}},
+		Response: []SummariseDto{}, Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodPost, Route: "/groups/:name/stop", Summary: "Stops and removes the streams of the group, 207 if any of them failed", Tag: "groups", Permission: "stop",
+		Query:    []apiParam{{"keepRecordings", "boolean", "Keeps the recordings of the streams, the configuration decides if it is not given"}},
+		Response: []GroupResultDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/groups/:name/restart", Summary: "Restarts the transcoding of the streams of the group, 207 if any of them failed", Tag: "groups", Permission: "start",
+		Query:    []apiParam{{"wipe", "boolean", "Removes the files of the streams before the restart"}},
+		Response: []GroupResultDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodDelete, Route: "/stream/:id/token", Summary: "Revokes the playback token of the stream", Tag: "streams", Permission: "stop",
+		Errors: []int{http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/stream/:id/pause", Summary: "Pauses the transcoding of the stream, keeping it registered", Tag: "streams", Permission: "start",
+		Response: StreamDto{}, Errors: []int{http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/stream/:id/resume", Summary: "Resumes the transcoding of the paused stream", Tag: "streams", Permission: "start",
+		Response: StreamDto{}, Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: http.MethodPost, Route: "/stream/:id/disable", Summary: "Switches the stream off until it is enabled, keeping its registration and its files", Tag: "streams", Permission: "start",
+		Response: StreamDto{}, Errors: []int{http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/stream/:id/enable", Summary: "Returns the disabled stream to its lifecycle", Tag: "streams", Permission: "start",
+		Query:    []apiParam{{"start", "boolean", "Starts the transcoding right away instead of on the next request of the playlist"}},
+		Response: StreamDto{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: http.MethodGet, Route: "/stream/*filepath", Path: "/stream/{id}/logs", Summary: "Returns the last lines of the output of the transcoding", Tag: "streams", Permission: "read",
+		ResponseType: "text/plain", Errors: []int{http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/stream/*filepath", Path: "/stream/{id}/{file}", Summary: "Serves the playlists, the segments and the poster image of the stream", Tag: "files",
+		Permission: "read", Media: true, Playback: true, Signed: true, ResponseType: "application/octet-stream",
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: http.MethodHead, Route: "/stream/*filepath", Path: "/stream/{id}/{file}", Summary: "Checks the files of the stream without their body", Tag: "files",
+		Permission: "read", Media: true, Playback: true, Signed: true, Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/stream/:id/keepalive", Summary: "Keeps the stream running without requesting its files", Tag: "files",
+		Permission: "read", Media: true, Playback: true, Response: StreamDto{}, Errors: []int{http.StatusForbidden, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/keys/:id", Summary: "Serves the encryption key of the stream", Tag: "files",
+		Permission: "read", Media: true, Playback: true, ResponseType: "application/octet-stream", Errors: []int{http.StatusForbidden, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/mpegts/:id", Summary: "Streams the MPEG-TS output of the stream", Tag: "files",
+		Permission: "read", Media: true, Playback: true, ResponseType: "video/mp2t", Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/whep/:id", Summary: "Plays the stream over WebRTC, answering the SDP offer", Tag: "files",
+		Permission: "read", Media: true, Playback: true, RequestType: "application/sdp", ResponseType: "application/sdp", Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnsupportedMediaType,
+			http.StatusInternalServerError, http.StatusNotImplemented, http.StatusServiceUnavailable}},
+	{Method: http.MethodDelete, Route: "/whep/:id/:session", Summary: "Ends the WebRTC session", Tag: "files",
+		Permission: "read", Media: true, Errors: []int{http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/snapshot/:id", Summary: "Returns the last frame of the stream as a JPEG image", Tag: "files", Permission: "read",
+		Query:        []apiParam{{"width", "integer", "Width of the image in pixels"}},
+		ResponseType: "image/jpeg", Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: http.MethodGet, Route: "/recordings/:id", Summary: "Lists the recorded files of the stream", Tag: "recordings", Permission: "list",
+		Response: []RecordedFileDto{}, Errors: []int{http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/recordings/:id/:file", Summary: "Serves a recorded file, playlist.m3u8 is the VOD playlist of the time window", Tag: "recordings",
+		Permission: "read", Media: true,
+		Query: []apiParam{
+			{"from", "string", "Start of the time window of the playlist as RFC 3339"},
+			{"to", "string", "End of the time window of the playlist as RFC 3339"},
+		},
+		ResponseType: "video/mp4", Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+}
+
+// docsPage is the Swagger UI of the API, the assets are loaded from a CDN
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>rtsp-stream API</title>
+  <meta charset="utf-8">
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });</script>
+</body>
+</html>
+`
+
+// OpenAPIHandler is the HTTP handler of the /openapi.json call. It describes the endpoints registered on the router the way
+// they are protected by the running configuration, so the description changes with the reloads of the authentication
+func (c *Controller) OpenAPIHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	b, err := json.Marshal(c.openAPI())
+	if err != nil {
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// DocsHandler is the HTTP handler of the /docs call serving the Swagger UI of /openapi.json
+func (c *Controller) DocsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
+
+// openAPI returns the description of the endpoints registered on the router of the controller
+func (c *Controller) openAPI() map[string]interface{} {
+	router, _ := c.routes.Load().(*httprouter.Router)
+	components := schemas{}
+	errorDto := map[string]interface{}{"content": map[string]interface{}{"application/json": map[string]interface{}{"schema": components.of(reflect.TypeOf(ErrorDto{}))}}}
+	paths := map[string]map[string]interface{}{}
+	for _, op := range apiOperations {
+		if router == nil {
+			break
+		}
+		if handle, _, _ := router.Lookup(op.Method, sampleRoute(op.Route)); handle == nil {
+			continue
+		}
+		path := op.Path
+		if path == "" {
+			path = openAPIPath(op.Route)
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(op.Method)] = c.operation(op, path, components, errorDto)
+	}
+	description := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info":    map[string]interface{}{"title": "rtsp-stream", "version": Version},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas":         components,
+			"securitySchemes": c.securitySchemes(),
+		},
+	}
+	// The paths are described without the prefix the service is mounted under
+	if c.spec().PathPrefix != "" {
+		description["servers"] = []interface{}{map[string]interface{}{"url": c.publicURI(context.Background(), "")}}
+	}
+	return description
+}
+
+// operation describes the endpoint on the given path
+func (c *Controller) operation(op apiOperation, path string, components schemas, errorDto map[string]interface{}) map[string]interface{} {
+	spec := c.spec()
+	params := []interface{}{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := strings.Trim(segment, "{}")
+			params = append(params, map[string]interface{}{"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}})
+		}
+	}
+	query := op.Query
+	if op.Signed && spec.URLSigningEnabled {
+		query = append(query, apiParam{"expires", "integer", "Expiry of the signed URL as a Unix timestamp"}, apiParam{"sig", "string", "Signature of the URL"})
+	}
+	for _, param := range query {
+		params = append(params, map[string]interface{}{"name": param.Name, "in": "query", "description": param.Description, "schema": map[string]interface{}{"type": param.Type}})
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if content := components.content(op.Response, op.ResponseType); content != nil {
+		success["content"] = content
+	}
+	responses := map[string]interface{}{strconv.Itoa(status): success}
+	security := c.security(op)
+	errors := op.Errors
+	if len(security) > 0 {
+		errors = append(errors, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	for _, code := range errors {
+		response := map[string]interface{}{"description": http.StatusText(code)}
+		for key, value := range errorDto {
+			response[key] = value
+		}
+		responses[strconv.Itoa(code)] = response
+	}
+	operation := map[string]interface{}{
+		"summary":    op.Summary,
+		"tags":       []string{op.Tag},
+		"parameters": params,
+		"responses":  responses,
+		"security":   security,
+	}
+	if op.Permission != "" {
+		operation["x-permission"] = op.Permission
+	}
+	if content := components.content(op.Request, op.RequestType); content != nil {
+		operation["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+	return operation
+}
+
+// securitySchemes describes the authentication enabled by the running configuration
+func (c *Controller) securitySchemes() map[string]interface{} {
+	current := c.current()
+	schemes := map[string]interface{}{}
+	if current.spec.BasicEnabled {
+		schemes["basicAuth"] = map[string]interface{}{"type": "http", "scheme": "basic"}
+	}
+	if current.keys.Enabled() {
+		schemes["apiKey"] = map[string]interface{}{"type": "apiKey", "in": "header", "name": auth.APIKeyHeader,
+			"description": "The key has to be allowed to do the x-permission of the endpoint"}
+	}
+	if current.spec.JWTEnabled {
+		schemes["jwt"] = map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+	}
+	if current.spec.PlaybackTokens {
+		schemes["playbackToken"] = map[string]interface{}{"type": "apiKey", "in": "query", "name": auth.PlaybackTokenQuery}
+		schemes["playbackTokenHeader"] = map[string]interface{}{"type": "apiKey", "in": "header", "name": auth.PlaybackTokenHeader}
+	}
+	return schemes
+}
+
+// security returns the authentication the endpoint requires with the running configuration, empty if it is not protected.
+// The playback token can be given either in the query or in the header
+func (c *Controller) security(op apiOperation) []map[string][]string {
+	if op.Permission == "" {
+		return []map[string][]string{}
+	}
+	current := c.current()
+	required := map[string][]string{}
+	if current.spec.BasicEnabled && (!op.Media || current.spec.BasicStreams) {
+		required["basicAuth"] = []string{}
+	}
+	if current.keys.Enabled() && (!op.Media || current.spec.APIKeyStreams) {
+		required["apiKey"] = []string{}
+	}
+	if current.spec.JWTEnabled && (!op.Media || current.spec.JWTStreams) {
+		required["jwt"] = []string{}
+	}
+	if !op.Playback || !current.spec.PlaybackTokens {
+		if len(required) == 0 {
+			return []map[string][]string{}
+		}
+		return []map[string][]string{required}
+	}
+	alternatives := []map[string][]string{}
+	for _, scheme := range []string{"playbackToken", "playbackTokenHeader"} {
+		alternative := map[string][]string{scheme: {}}
+		for name, scopes := range required {
+			alternative[name] = scopes
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	return alternatives
+}
+
+// sampleRoute returns a path the route matches, so the router can tell if the route is registered
+func sampleRoute(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "sample"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// openAPIPath returns the path of the route with its parameters written as OpenAPI templates, like /status/{id}
+func openAPIPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// schemas builds the JSON schemas of the Go types from the way they are encoded, the named structs are collected
+// by their name and referenced from the components of the description
+type schemas map[string]interface{}
+
+// content describes a body of the given value, nil if there is none. Bodies that are not JSON are described as binary
+func (s schemas) content(value interface{}, contentType string) map[string]interface{} {
+	if contentType != "" {
+		return map[string]interface{}{contentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}}
+	}
+	if value == nil {
+		return nil
+	}
+	var schema map[string]interface{}
+	if shapes, ok := value.(apiOneOf); ok {
+		oneOf := []interface{}{}
+		for _, shape := range shapes {
+			oneOf = append(oneOf, s.of(reflect.TypeOf(shape)))
+		}
+		schema = map[string]interface{}{"oneOf": oneOf}
+	} else {
+		schema = s.of(reflect.TypeOf(value))
+	}
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// of returns the schema of the type
+func (s schemas) of(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	// The types reading their own JSON accept a number or a text, like the durations given as seconds or as "10m"
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(unmarshalerType) {
+		return map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"type": "integer"}, map[string]interface{}{"type": "string"}}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			// The name is taken before the fields are described, so the types referencing themselves end
+			s[t.Name()] = map[string]interface{}{}
+			s[t.Name()] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the schema of the struct, the fields without omitempty are required
+func (s schemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	s.fields(t, properties, &required)
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// fields describes the encoded fields of the struct, the fields of the embedded structs are described like their own
+func (s schemas) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		embedded := field.Type
+		if embedded.Kind() == reflect.Ptr {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && tag == "" && embedded.Kind() == reflect.Struct {
+			s.fields(embedded, properties, required)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		options := strings.Split(tag, ",")
+		if options[0] != "" {
+			name = options[0]
+		}
+		properties[name] = s.of(field.Type)
+		omitted := false
+		for _, option := range options[1:] {
+			omitted = omitted || option == "omitempty"
+		}
+		if !omitted && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// openAPIDescription is the part of the OpenAPI description the tests read
+type openAPIDescription struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas         map[string]json.RawMessage `json:"schemas"`
+		SecuritySchemes map[string]json.RawMessage `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	describe := func(conf *config.Specification) (int, openAPIDescription) {
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		var description openAPIDescription
+		json.Unmarshal(rr.Body.Bytes(), &description)
+		return rr.Code, description
+	}
+	everything := func() *config.Specification {
+		conf := config.InitConfig()
+		conf.ListEndpoint, conf.MetricsEndpoint, conf.EventsEndpoint, conf.ReloadEndpoint, conf.DocsEndpoint = true, true, true, true, true
+		conf.DiscoveryEnabled, conf.MPEGTSEnabled, conf.WHEPEnabled = true, true, true
+		conf.DebugEndpoint, conf.DebugAddress = true, ""
+		return conf
+	}
+
+	t.Run("Should only describe the enabled endpoints", func(t *testing.T) {
+		tt := []struct {
+			Enable func(*config.Specification)
+			Path   string
+		}{
+			{Enable: func(s *config.Specification) { s.ListEndpoint = true }, Path: "/list"},
+			{Enable: func(s *config.Specification) { s.MetricsEndpoint = true }, Path: "/metrics"},
+			{Enable: func(s *config.Specification) { s.DocsEndpoint = true }, Path: "/docs"},
+			{Enable: func(s *config.Specification) { s.MPEGTSEnabled = true }, Path: "/mpegts/{id}"},
+			{Enable: func(s *config.Specification) { s.WHEPEnabled = true }, Path: "/whep/{id}/{session}"},
+		}
+		for i, testCase := range tt {
+			_, disabled := describe(config.InitConfig())
+			conf := config.InitConfig()
+			testCase.Enable(conf)
+			status, enabled := describe(conf)
+			_, before := disabled.Paths[testCase.Path]
+			_, after := enabled.Paths[testCase.Path]
+			if !assert.Equal(t, http.StatusOK, status) || !assert.False(t, before) || !assert.True(t, after) {
+				t.Error(fmt.Errorf("%d testcase is failing for describing the enabled endpoints", i))
+			}
+		}
+	})
+
+	t.Run("Should describe every operation with the routes they document", func(t *testing.T) {
+		ctrls := NewController(everything(), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		router := httprouter.New()
+		ctrls.Routes(router)
+		for _, op := range apiOperations {
+			handle, _, _ := router.Lookup(op.Method, sampleRoute(op.Route))
+			assert.NotNil(t, handle, fmt.Sprintf("%s %s is not registered", op.Method, op.Route))
+		}
+		description := ctrls.openAPI()
+		paths := description["paths"].(map[string]map[string]interface{})
+		assert.Contains(t, paths["/stream/{id}"], "delete")
+		assert.Contains(t, paths["/stream/{id}"], "patch")
+		assert.Contains(t, paths["/stream/{id}/logs"], "get")
+		assert.Contains(t, paths["/stream/{id}/{file}"], "head")
+	})
+
+	t.Run("Should describe the bodies with the schemas of their types", func(t *testing.T) {
+		_, description := describe(everything())
+		assert.Equal(t, openAPIVersion, description.OpenAPI)
+		var stream struct {
+			Properties map[string]map[string]interface{} `json:"properties"`
+			Required   []string                          `json:"required"`
+		}
+		assert.Nil(t, json.Unmarshal(description.Components.Schemas["StreamDto"], &stream))
+		assert.Equal(t, map[string]interface{}{"type": "string"}, stream.Properties["uri"])
+		assert.Contains(t, stream.Properties, "idleTimeout")
+		assert.Contains(t, stream.Properties["idleTimeout"], "oneOf")
+		assert.Equal(t, []string{"uri"}, stream.Required)
+		var summary struct {
+			Properties map[string]map[string]interface{} `json:"properties"`
+		}
+		assert.Nil(t, json.Unmarshal(description.Components.Schemas["SummariseDto"], &summary))
+		assert.Equal(t, map[string]interface{}{"type": "boolean"}, summary.Properties["paused"])
+		assert.Equal(t, "date-time", summary.Properties["startedAt"]["format"])
+		assert.NotContains(t, summary.Properties, "lastActivity")
+		assert.Contains(t, description.Components.Schemas, "ErrorDto")
+		start := string(description.Paths["/start"]["post"])
+		assert.True(t, strings.Contains(start, `"$ref":"#/components/schemas/StreamDto"`))
+		assert.True(t, strings.Contains(start, `"$ref":"#/components/schemas/ErrorDto"`))
+	})
+
+	t.Run("Should describe the authentication of the running configuration", func(t *testing.T) {
+		status, open := describe(everything())
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, open.Components.SecuritySchemes)
+
+		conf := everything()
+		conf.BasicEnabled, conf.BasicUsername, conf.BasicPassword = true, "admin", "s3cret"
+		conf.APIKeys = []string{"dashboard:d4sh:list"}
+		conf.APIKeyStreams = false
+		conf.PlaybackTokens = true
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+		r.SetBasicAuth("admin", "s3cret")
+		r.Header.Set(auth.APIKeyHeader, "d4sh")
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, r)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var protected openAPIDescription
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &protected))
+		for _, scheme := range []string{"basicAuth", "apiKey", "playbackToken", "playbackTokenHeader"} {
+			assert.Contains(t, protected.Components.SecuritySchemes, scheme)
+		}
+		assert.NotContains(t, protected.Components.SecuritySchemes, "jwt")
+
+		var list, files struct {
+			Security []map[string][]string `json:"security"`
+		}
+		assert.Nil(t, json.Unmarshal(protected.Paths["/list"]["get"], &list))
+		assert.Equal(t, []map[string][]string{{"basicAuth": {}, "apiKey": {}}}, list.Security)
+		// The files of the streams are not protected by the API keys, only by their playback tokens
+		assert.Nil(t, json.Unmarshal(protected.Paths["/stream/{id}/{file}"]["get"], &files))
+		assert.Equal(t, []map[string][]string{{"playbackToken": {}}, {"playbackTokenHeader": {}}}, files.Security)
+	})
+
+	t.Run("Should serve the Swagger UI if it is enabled", func(t *testing.T) {
+		conf := config.InitConfig()
+		conf.DocsEndpoint = true
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `url: "openapi.json"`)
+
+		ctrls = NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		rr = httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option changes the defaults of the controller created by NewController
+type Option func(*Controller)
+
+// WithLogger sets the logger of the controller, the standard logger of logrus is used by default.
+// The transcoding processes keep logging with the standard logger
+func WithLogger(logger logrus.FieldLogger) Option {
+	return func(c *Controller) {
+		c.log = logger
+	}
+}
+
+// WithClock sets the function the controller reads the current time with, time.Now by default
+func WithClock(now func() time.Time) Option {
+	return func(c *Controller) {
+		c.now = now
+	}
+}
+
+// WithFileServer sets the handler serving the files of the streams. It receives the requests with the path relative
+// to the store directory, like /<id>/index.m3u8. By default the files are served from the store directory
+func WithFileServer(fileServer http.Handler) Option {
+	return func(c *Controller) {
+		c.fileServer = fileServer
+	}
+}
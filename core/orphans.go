@@ -0,0 +1,101 @@
+package core
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/Roverr/rtsp-stream/core/store"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// processStates returns the states of the running processes, nil if they are not stored
+func (c *Controller) processStates() *streaming.ProcessStates {
+	if c.spec().ProcessStateDir == "" {
+		return nil
+	}
+	return streaming.NewProcessStates(c.spec().ProcessStateDir)
+}
+
+// collectOrphans finds the processes left running by an unclean exit of the previous run of the service, keyed by the id of their stream.
+// The states of the processes that exited or whose pid is reused by an unrelated process are removed, those processes are left alone
+func (c *Controller) collectOrphans() map[string]streaming.ProcessState {
+	orphans := map[string]streaming.ProcessState{}
+	states := c.processStates()
+	if states == nil {
+		return orphans
+	}
+	stored, err := states.Load()
+	if err != nil {
+		c.log.Errorf("States of the processes could not be read || Error: %s", err)
+		return orphans
+	}
+	for id, state := range stored {
+		if !state.Verify() {
+			c.log.Debugf("Process %d of %s is not running anymore, its state is removed", state.Pid, id)
+			if err := states.Remove(id, state.Pid); err != nil {
+				c.log.Error(err)
+			}
+			continue
+		}
+		c.log.Warnf("Process %d of %s is still running from the previous run", state.Pid, id)
+		orphans[id] = state
+	}
+	return orphans
+}
+
+// terminateOrphans stops the orphaned processes, BATCH_PARALLELISM at a time, before their streams are started again.
+// The processes that do not exit within SHUTDOWN_GRACE are killed
+func (c *Controller) terminateOrphans(orphans map[string]streaming.ProcessState) {
+	ids := make([]string, 0, len(orphans))
+	for id := range orphans {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	states := c.processStates()
+	c.inParallel(len(ids), func(i int) {
+		id, state := ids[i], orphans[ids[i]]
+		terminated, err := streaming.TerminateOrphan(state, c.spec().ShutdownGrace)
+		if err != nil {
+			c.log.Errorf("Process %d of %s could not be terminated || Error: %s", state.Pid, id, err)
+			return
+		}
+		if terminated {
+			c.log.Infof("Process %d of %s is terminated", state.Pid, id)
+		}
+		if err := states.Remove(id, state.Pid); err != nil {
+			c.log.Error(err)
+		}
+	})
+}
+
+// adoptStream registers the recovered stream with its process left running by the previous run of the service, instead of starting
+// a new one. Returns false if the process does not transcode the source of the stream into its directory, it has to be terminated then
+func (c *Controller) adoptStream(record store.Record, orphan streaming.ProcessState) bool {
+	if orphan.URI != record.URI {
+		return false
+	}
+	strm, _ := c.processor.NewStream(record.URI, record.Options)
+	if strm == nil || filepath.Clean(strm.StorePath) != filepath.Clean(orphan.Directory) {
+		return false
+	}
+	process, err := streaming.AdoptProcess(orphan)
+	if err != nil {
+		return false
+	}
+	// The later restarts of the stream start new processes
+	strm.Transcoder = streaming.AdoptingTranscoder(process, strm.Transcoder)
+	strm.StartedAt = orphan.StartedAt
+	strm.CreatedAt = record.CreatedAt
+	strm.Metadata = record.Metadata
+	strm.Group = record.Group
+	strm.PlaybackToken = record.Token
+	strm.ExpiresAt = expiryOf(record)
+	c.supervise(record.ID, strm)
+	c.setStream(record.ID, strm)
+	go func() {
+		if err := strm.Run(); err != nil {
+			c.streamLog(strm).Debugf("Adopted process of %s exited || Error: %s", record.ID, err)
+		}
+	}()
+	return true
+}
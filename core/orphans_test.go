@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/store"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// directoryProcessor creates the streams in the directory, like the real processor
+type directoryProcessor struct {
+	mockProcessor
+	dir string
+}
+
+func (p directoryProcessor) NewStream(URI string, opts streaming.Options) (*streaming.Stream, string) {
+	strm, path := p.mockProcessor.NewStream(URI, opts)
+	strm.StorePath = filepath.Join(p.dir, opts.Directory)
+	return strm, path
+}
+
+func TestRecoverOrphans(t *testing.T) {
+	uri := "rtsp://192.168.0.30/live"
+	id, _ := streaming.GetURIDirectory(uri)
+	setup := func(t *testing.T, policy string, running bool) (*Controller, *streaming.ProcessStates, string, func()) {
+		dir, err := ioutil.TempDir("", "orphans")
+		assert.Nil(t, err)
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, id), os.ModePerm))
+		conf := config.InitConfig()
+		conf.Persistence = config.Persistence{Enabled: true, Resume: true, Path: filepath.Join(dir, "streams.json"), PersistenceKey: persistenceKey}
+		conf.ProcessStateDir = filepath.Join(dir, "processes")
+		conf.OrphanPolicy = policy
+		conf.ShutdownGrace = time.Second
+		assert.Nil(t, newStore(conf.Persistence).Save([]store.Record{{
+			ID:        id,
+			URI:       uri,
+			Directory: filepath.Join(dir, id),
+			Running:   running,
+			Options:   streaming.Options{Directory: id},
+			Metadata:  map[string]string{"site": "north"},
+		}}))
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = directoryProcessor{dir: dir}
+		return ctrls, streaming.NewProcessStates(conf.ProcessStateDir), dir, func() {
+			ctrls.Shutdown(context.Background())
+			os.RemoveAll(dir)
+		}
+	}
+	// orphan starts a process with the source and the directory of the stream in its command line, like ffmpeg
+	orphan := func(t *testing.T, args ...string) (int, <-chan error) {
+		cmd := exec.Command("sh", append([]string{"-c", "sleep 10; true"}, args...)...)
+		assert.Nil(t, cmd.Start())
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+		return cmd.Process.Pid, exited
+	}
+	save := func(t *testing.T, states *streaming.ProcessStates, dir string, pid int) {
+		assert.Nil(t, states.Save(id, streaming.ProcessState{Pid: pid, URI: uri, Directory: filepath.Join(dir, id), StartedAt: time.Now()}))
+	}
+	isExited := func(exited <-chan error) bool {
+		select {
+		case <-exited:
+			return true
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+
+	t.Run("Should terminate the orphan before the stream is resumed", func(t *testing.T) {
+		ctrls, states, dir, teardown := setup(t, streaming.OrphanTerminate, true)
+		defer teardown()
+		pid, exited := orphan(t, uri, filepath.Join(dir, id, "index.m3u8"))
+		defer killProcess(pid)
+		save(t, states, dir, pid)
+		ctrls.recoverStreams()
+		assert.True(t, isExited(exited))
+		loaded, _ := states.Load()
+		assert.Empty(t, loaded)
+		assert.True(t, waitUntil(func() bool {
+			_, ok := ctrls.getStream(id)
+			return ok
+		}, time.Second))
+	})
+
+	t.Run("Should terminate the orphan of a stream that is not resumed", func(t *testing.T) {
+		ctrls, states, dir, teardown := setup(t, streaming.OrphanAdopt, false)
+		defer teardown()
+		pid, exited := orphan(t, uri, filepath.Join(dir, id, "index.m3u8"))
+		defer killProcess(pid)
+		save(t, states, dir, pid)
+		ctrls.recoverStreams()
+		assert.True(t, isExited(exited))
+	})
+
+	t.Run("Should adopt the orphan of the resumed stream", func(t *testing.T) {
+		ctrls, states, dir, teardown := setup(t, streaming.OrphanAdopt, true)
+		defer teardown()
+		pid, exited := orphan(t, uri, filepath.Join(dir, id, "index.m3u8"))
+		defer killProcess(pid)
+		save(t, states, dir, pid)
+		ctrls.recoverStreams()
+		strm, ok := ctrls.getStream(id)
+		if !assert.True(t, ok) {
+			return
+		}
+		assert.True(t, waitUntil(func() bool { return strm.Pid() == pid }, time.Second))
+		assert.Equal(t, "north", strm.Metadata["site"])
+		select {
+		case <-exited:
+			t.Error("Adopted process is terminated")
+		case <-time.After(100 * time.Millisecond):
+		}
+		// The adopted process is stopped with its stream
+		ctrls.Shutdown(context.Background())
+		assert.True(t, isExited(exited))
+	})
+
+	t.Run("Should leave alone the processes reusing the pid of the orphan", func(t *testing.T) {
+		ctrls, states, dir, teardown := setup(t, streaming.OrphanTerminate, true)
+		defer teardown()
+		pid, exited := orphan(t, "rtsp://192.168.0.31/live", filepath.Join(dir, "other", "index.m3u8"))
+		defer killProcess(pid)
+		save(t, states, dir, pid)
+		ctrls.recoverStreams()
+		select {
+		case <-exited:
+			t.Error("Unrelated process is terminated")
+		case <-time.After(100 * time.Millisecond):
+		}
+		loaded, _ := states.Load()
+		assert.Empty(t, loaded)
+	})
+}
+
+// killProcess kills the process, the processes that exited are ignored
+func killProcess(pid int) {
+	if process, err := os.FindProcess(pid); err == nil {
+		process.Kill()
+	}
+}
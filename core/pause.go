@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// PauseHandler is the HTTP handler of the POST /stream/:id/pause call, which stops the transcoding and the recording
+// of the stream but keeps it registered. Paused streams are not restarted by their clients or cleaned up, they are
+// only started again by resuming them. Pausing a paused stream does nothing
+func (c *Controller) PauseHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if !strm.IsPaused() {
+		if !c.restarting.begin(id) {
+			c.SendError(w, ErrStreamAlreadyActive, http.StatusConflict)
+			return
+		}
+		defer c.restarting.end(id)
+		c.logger(r.Context()).Infof("%s is getting paused%s", id, requestedBy(apiKeyName(r)))
+		// The stream is marked first, so its clients cannot restart it while its process is stopped
+		strm.SetPaused(true)
+		if err := strm.StopRecording(); err != nil {
+			c.logger(r.Context()).Error(err)
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), c.spec().ShutdownGrace)
+		defer cancel()
+		if err := strm.Stop(ctx, true); err != nil {
+			c.logger(r.Context()).Error(err)
+		}
+		c.metrics.RemoveStream(id)
+		c.publishBy(r.Context(), events.Paused, id, strm, "")
+		c.persist()
+	}
+	b, _ := json.Marshal(c.streamDto(r.Context(), strm, id))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// ResumeHandler is the HTTP handler of the POST /stream/:id/resume call, which starts the transcoding of the paused
+// stream again with the same options. Lazy streams are only unpaused, they are started by the requests of their playlist.
+// Resuming a stream that is not paused does nothing
+func (c *Controller) ResumeHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if strm.IsDisabled() {
+		c.SendError(w, ErrStreamDisabled, http.StatusConflict)
+		return
+	}
+	if strm.IsPaused() {
+		if !c.restarting.begin(id) {
+			c.SendError(w, ErrStreamAlreadyActive, http.StatusConflict)
+			return
+		}
+		defer c.restarting.end(id)
+		if !c.spawns.enter() {
+			c.SendError(w, ErrStoppingAll, http.StatusServiceUnavailable)
+			return
+		}
+		defer c.spawns.leave()
+		c.logger(r.Context()).Infof("%s is getting resumed%s", id, requestedBy(apiKeyName(r)))
+		if err := c.resume(r.Context(), id, strm, events.Resumed); err != nil {
+			c.logger(r.Context()).Error(err)
+			c.SendError(w, ErrRestartFailed, http.StatusInternalServerError)
+			return
+		}
+		if !strm.Options.Lazy {
+			c.waitForPlaylist(strm)
+		}
+		c.persist()
+	}
+	b, _ := json.Marshal(c.streamDto(r.Context(), strm, id))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// resume starts the transcoding of the paused stream again and publishes the event, lazy streams are only unpaused
+func (c *Controller) resume(ctx context.Context, id string, strm *streaming.Stream, event events.Type) error {
+	strm.ResetErrored()
+	if !strm.Options.Lazy {
+		if err := c.processor.Restart(strm, id); err != nil {
+			return err
+		}
+		c.metrics.Restarted(id)
+	}
+	strm.SetPaused(false)
+	c.record(id, strm)
+	c.publishBy(ctx, event, id, strm, "")
+	return nil
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+)
+
+func TestPause(t *testing.T) {
+	setup := func(t *testing.T, serveFiles bool) (*testServer, *int32) {
+		spawned := int32(0)
+		s := newTestServer(t, func(conf *config.Specification) {
+			conf.PausedServeFiles = serveFiles
+		}, mockProcessor{spawned: &spawned}, func(router *httprouter.Router, ctrls *Controller) {
+			router.POST("/restart/:id", ctrls.RestartHandler)
+			router.GET("/stream/*filepath", ctrls.FileHandler)
+			router.POST("/pause/:id", ctrls.PauseHandler)
+			router.POST("/resume/:id", ctrls.ResumeHandler)
+		})
+		return s, &spawned
+	}
+	start := func(s *testServer) StreamDto {
+		status, dto, _ := s.start(t, "", StreamDto{URI: generateURI()})
+		assert.Equal(t, http.StatusOK, status)
+		s.writePlaylist(t, dto.ID)
+		return dto
+	}
+	paused := func(s *testServer) bool {
+		dto := s.list(t)
+		return assert.Len(t, dto, 1) && dto[0].Paused
+	}
+
+	t.Run("Should keep the paused streams registered until they are resumed", func(t *testing.T) {
+		s, spawned := setup(t, true)
+		defer s.close()
+		sub := s.ctrls.events.Subscribe()
+		defer s.ctrls.events.Unsubscribe(sub)
+		dto := start(s)
+		strm, _ := s.ctrls.getStream(dto.ID)
+		started := atomic.LoadInt32(spawned)
+
+		status, _ := s.post(t, fmt.Sprintf("/pause/%s", dto.ID))
+		assert.Equal(t, http.StatusOK, status)
+		assert.True(t, paused(s))
+		assert.False(t, strm.Streak.IsActive())
+		assert.Equal(t, 0, s.ctrls.activeStreams())
+
+		// Neither the clients nor the cleanup start the paused stream again
+		for _, file := range []string{"index.m3u8", "0.ts"} {
+			res, err := http.Get(fmt.Sprintf("%s/stream/%s/%s", s.server.URL, dto.ID, file))
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+		s.ctrls.cleanUnused()
+		status, code := s.post(t, fmt.Sprintf("/restart/%s", dto.ID))
+		assert.Equal(t, http.StatusConflict, status)
+		assert.Equal(t, "stream_paused", code)
+		assert.Equal(t, started, atomic.LoadInt32(spawned))
+		_, ok := s.ctrls.getStream(dto.ID)
+		assert.True(t, ok)
+		assert.False(t, strm.Streak.IsActive())
+
+		status, _ = s.post(t, fmt.Sprintf("/resume/%s", dto.ID))
+		assert.Equal(t, http.StatusOK, status)
+		assert.False(t, paused(s))
+		assert.True(t, strm.Streak.IsActive())
+		assert.Equal(t, started+1, atomic.LoadInt32(spawned))
+
+		received := []events.Type{}
+		for len(received) < 3 {
+			event := <-sub.Events()
+			received = append(received, event.Type)
+		}
+		assert.Equal(t, []events.Type{events.Started, events.Paused, events.Resumed}, received)
+	})
+
+	t.Run("Should refuse the playlists of the paused streams if their files are not served", func(t *testing.T) {
+		s, _ := setup(t, false)
+		defer s.close()
+		dto := start(s)
+		s.post(t, fmt.Sprintf("/pause/%s", dto.ID))
+		tt := []struct {
+			File   string
+			Status int
+		}{
+			{File: "index.m3u8", Status: http.StatusConflict},
+			{File: "0.ts", Status: http.StatusOK},
+		}
+		for i, testCase := range tt {
+			res, err := http.Get(fmt.Sprintf("%s/stream/%s/%s", s.server.URL, dto.ID, testCase.File))
+			if assert.Nil(t, err) && !assert.Equal(t, testCase.Status, res.StatusCode) {
+				t.Error(fmt.Errorf("%d testcase is failing for serving the files of the paused streams", i))
+			}
+		}
+	})
+
+	t.Run("Should do nothing if the stream is paused or resumed already", func(t *testing.T) {
+		s, spawned := setup(t, true)
+		defer s.close()
+		dto := start(s)
+		started := atomic.LoadInt32(spawned)
+		tt := []struct {
+			Path   string
+			Status int
+			Paused bool
+		}{
+			{Path: fmt.Sprintf("/resume/%s", dto.ID), Status: http.StatusOK, Paused: false},
+			{Path: fmt.Sprintf("/pause/%s", dto.ID), Status: http.StatusOK, Paused: true},
+			{Path: fmt.Sprintf("/pause/%s", dto.ID), Status: http.StatusOK, Paused: true},
+			{Path: "/pause/unknown", Status: http.StatusNotFound, Paused: true},
+			{Path: "/resume/unknown", Status: http.StatusNotFound, Paused: true},
+		}
+		for i, testCase := range tt {
+			status, _ := s.post(t, testCase.Path)
+			if !assert.Equal(t, testCase.Status, status) || !assert.Equal(t, testCase.Paused, paused(s)) {
+				t.Error(fmt.Errorf("%d testcase is failing for pausing and resuming the streams", i))
+			}
+		}
+		assert.Equal(t, started, atomic.LoadInt32(spawned))
+	})
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/store"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/sirupsen/logrus"
+)
+
+// newStore creates the store of the stream registrations, nil if persistence is disabled.
+// Persistence is turned off if the configured key cannot be used, rather than storing the credentials without it
+func newStore(spec config.Persistence) *store.FileStore {
+	if !spec.Enabled {
+		return nil
+	}
+	key, err := spec.EncryptionKey()
+	if err != nil {
+		logrus.Errorf("Persistence is disabled || Error: %s", err)
+		return nil
+	}
+	if key == nil {
+		return store.NewFileStore(spec.Path, nil)
+	}
+	cipher, err := store.NewCipher(key)
+	if err != nil {
+		logrus.Errorf("Persistence is disabled || Error: %s", err)
+		return nil
+	}
+	return store.NewFileStore(spec.Path, cipher)
+}
+
+// persist stores the current stream registrations if persistence is enabled
+func (c *Controller) persist() {
+	if c.store == nil {
+		return
+	}
+	records := []store.Record{}
+	for id, strm := range c.snapshotStreams() {
+		strm.Mux.RLock()
+		records = append(records, store.Record{
+			ID:        id,
+			URI:       strm.OriginalURI,
+			Directory: strm.StorePath,
+			CreatedAt: strm.CreatedAt,
+			Running:   strm.Streak.IsActive(),
+			Canonical: c.canonicalOf(id),
+			Options:   strm.Options,
+			Metadata:  strm.Metadata,
+			Token:     strm.PlaybackToken,
+			ExpiresAt: optionalTime(strm.ExpiresAt),
+			Paused:    strm.Paused,
+			Evicted:   strm.Evicted,
+			Disabled:  strm.Disabled,
+			Group:     strm.Group,
+		})
+		strm.Mux.RUnlock()
+	}
+	if err := c.store.Save(records); err != nil {
+		c.log.Errorf("Streams could not be persisted || Error: %s", err)
+	}
+}
+
+// recoverStreams registers the streams stored before the last shutdown.
+// Streams whose directory is gone are dropped, the running ones are restarted if resuming is enabled.
+// Returns the directories of the recovered streams, the resumed ones may not be registered yet
+func (c *Controller) recoverStreams() []string {
+	// The processes left running by the previous run of the service are terminated unless they are adopted by their stream
+	orphans := c.collectOrphans()
+	if c.store == nil {
+		c.terminateOrphans(orphans)
+		return nil
+	}
+	records, err := c.store.Load()
+	if err != nil {
+		c.log.Errorf("Streams could not be recovered || Error: %s", err)
+		c.terminateOrphans(orphans)
+		return nil
+	}
+	resumes := []store.Record{}
+	recovered := []string{}
+	for _, record := range records {
+		if _, err := os.Stat(record.Directory); err != nil {
+			c.log.Infof("%s is pruned, its directory does not exist anymore", record.ID)
+			continue
+		}
+		// The streams whose time to live ended while the service was down are removed like they would have been
+		if c.isExpired(record.ExpiresAt) {
+			c.log.Infof("%s is pruned, its time to live is over", record.ID)
+			if !c.spec().KeepFiles {
+				if err := os.RemoveAll(record.Directory); err != nil {
+					c.log.Error(err)
+				}
+			}
+			continue
+		}
+		// The lists of the sources could have changed since the stream was started
+		source, err := c.pinSource(context.Background(), record.URI)
+		if err != nil {
+			c.log.Warnf("%s is pruned, its source is not allowed anymore || Error: %s", record.ID, err)
+			continue
+		}
+		record.URI = source
+		recovered = append(recovered, record.Directory)
+		// Streams stored before their directory was kept in the options are stored under the id derived from the URI
+		if record.Options.Directory == "" {
+			record.Options.Directory = record.ID
+		}
+		if record.Canonical != "" {
+			c.mux.Lock()
+			c.aliases[record.ID] = record.Canonical
+			c.mux.Unlock()
+		}
+		if record.Running && !record.Paused && c.spec().Resume {
+			if orphan, ok := orphans[record.ID]; ok && c.spec().OrphanPolicy == streaming.OrphanAdopt && c.adoptStream(record, orphan) {
+				c.log.Infof("%s is resumed with its process %d still running", record.ID, orphan.Pid)
+				delete(orphans, record.ID)
+				continue
+			}
+			c.log.Infof("%s is getting resumed", record.ID)
+			resumes = append(resumes, record)
+			continue
+		}
+		strm := c.registerStopped(context.Background(), record.URI, record.ID, record.Options)
+		if strm == nil {
+			c.log.Errorf("%s could not be recovered", record.ID)
+			continue
+		}
+		strm.CreatedAt = record.CreatedAt
+		strm.Metadata = record.Metadata
+		strm.Group = record.Group
+		strm.PlaybackToken = record.Token
+		strm.ExpiresAt = expiryOf(record)
+		if record.Disabled {
+			strm.Disable()
+		} else if record.Evicted {
+			strm.Evict()
+		} else if record.Paused {
+			strm.SetPaused(true)
+		}
+		if record.Paused || record.Evicted || record.Disabled {
+			if err := strm.StopRecording(); err != nil {
+				c.log.Error(err)
+			}
+		}
+		c.log.Infof("%s is recovered as stopped", record.ID)
+	}
+	// The orphans are gone before the resumed streams write into their directories
+	c.terminateOrphans(orphans)
+	for _, record := range resumes {
+		go c.resumeStream(record)
+	}
+	c.persist()
+	return recovered
+}
+
+// expiryOf returns the end of the time to live of the stored stream, zero if it has none
+func expiryOf(record store.Record) time.Time {
+	if record.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return *record.ExpiresAt
+}
+
+// resumeStream restarts the processing of a recovered stream
+func (c *Controller) resumeStream(record store.Record) {
+	ch := c.startStream(context.Background(), record.URI, record.ID, record.Options)
+	if strm, ok := c.getStream(record.ID); ok {
+		strm.Mux.Lock()
+		strm.CreatedAt = record.CreatedAt
+		strm.Metadata = record.Metadata
+		strm.Group = record.Group
+		strm.PlaybackToken = record.Token
+		strm.ExpiresAt = expiryOf(record)
+		strm.Mux.Unlock()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.spec().StartTimeout)
+	defer cancel()
+	if err := c.waitForStart(ctx, ch); err != nil {
+		c.log.Errorf("%s could not be resumed || Error: %s", record.ID, err)
+	}
+}
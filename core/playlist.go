@@ -0,0 +1,76 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// uriAttribute matches the URI attribute of playlist tags like EXT-X-KEY
+var uriAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+
+// isPlaylist is for deciding if the requested file is an HLS playlist
+func isPlaylist(path string) bool {
+	return filepath.Ext(path) == ".m3u8"
+}
+
+// isManifest is for deciding if the requested file is an HLS playlist or an MPEG-DASH manifest,
+// which are rewritten while the stream is running
+func isManifest(path string) bool {
+	return isPlaylist(path) || filepath.Ext(path) == ".mpd"
+}
+
+// appendQuery extends the given reference with the query
+func appendQuery(ref, query string) string {
+	if strings.Contains(ref, "?") {
+		return ref + "&" + query
+	}
+	return ref + "?" + query
+}
+
+// rewritePlaylist appends the given query to every media reference in the playlist,
+// so the segments can be fetched with the same authorization as the playlist itself
+func rewritePlaylist(content []byte, query string) []byte {
+	buf := &bytes.Buffer{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			line = uriAttribute.ReplaceAllStringFunc(line, func(attribute string) string {
+				ref := uriAttribute.FindStringSubmatch(attribute)[1]
+				return `URI="` + appendQuery(ref, query) + `"`
+			})
+		case trimmed != "":
+			line = appendQuery(trimmed, query)
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// prefixPlaylist prefixes the absolute references of the tags in the playlist with the path prefix of the service,
+// the references relative to the playlist are resolved by the players already
+func prefixPlaylist(content []byte, prefix string) []byte {
+	buf := &bytes.Buffer{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			line = uriAttribute.ReplaceAllStringFunc(line, func(attribute string) string {
+				ref := uriAttribute.FindStringSubmatch(attribute)[1]
+				if !strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "//") {
+					return attribute
+				}
+				return `URI="` + prefix + ref + `"`
+			})
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
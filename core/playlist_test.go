@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewritePlaylist(t *testing.T) {
+	tt := []struct {
+		Input  string
+		Output string
+	}{
+		{
+			Input:  "#EXTM3U\n#EXT-X-VERSION:3\n#EXTINF:1.000000,\n0.ts\n#EXTINF:1.000000,\n1.ts\n",
+			Output: "#EXTM3U\n#EXT-X-VERSION:3\n#EXTINF:1.000000,\n0.ts?sig=abc\n#EXTINF:1.000000,\n1.ts?sig=abc\n",
+		},
+		{
+			Input:  "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/id\"\n#EXTINF:1.000000,\n0.ts\n",
+			Output: "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/id?sig=abc\"\n#EXTINF:1.000000,\n0.ts?sig=abc\n",
+		},
+		{
+			Input:  "#EXTM3U\n\n720p/index.m3u8?quality=high\n",
+			Output: "#EXTM3U\n\n720p/index.m3u8?quality=high&sig=abc\n",
+		},
+	}
+
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Output, string(rewritePlaylist([]byte(testCase.Input), "sig=abc"))) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestRewritePlaylist", i))
+		}
+	}
+}
+
+func TestPrefixPlaylist(t *testing.T) {
+	tt := []struct {
+		Input  string
+		Output string
+	}{
+		{
+			Input:  "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/id?sig=abc\"\n#EXTINF:1.000000,\n0.ts?sig=abc\n",
+			Output: "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/video/keys/id?sig=abc\"\n#EXTINF:1.000000,\n0.ts?sig=abc\n",
+		},
+		{
+			Input:  "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXT-X-KEY:METHOD=AES-128,URI=\"https://keys.example.com/id\"\n#EXTINF:1.000000,\n0.m4s\n",
+			Output: "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXT-X-KEY:METHOD=AES-128,URI=\"https://keys.example.com/id\"\n#EXTINF:1.000000,\n0.m4s\n",
+		},
+	}
+
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Output, string(prefixPlaylist([]byte(testCase.Input), "/video"))) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestPrefixPlaylist", i))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// PriorityDto describes the priority of a stream
+type PriorityDto struct {
+	Priority *int `json:"priority"`
+}
+
+// evictionCandidate returns the running stream a new stream with the given priority can evict: the one with the lowest priority
+// below it, the least recently active one of them. Paused streams are not running, streams never evict the ones with the same priority.
+// Returns an empty id if there is none
+func (c *Controller) evictionCandidate(priority int) (string, *streaming.Stream) {
+	id, candidate := "", (*streaming.Stream)(nil)
+	for key, strm := range c.snapshotStreams() {
+		strm.Mux.RLock()
+		eligible := strm.Streak.IsActive() && !strm.Paused && strm.Options.Priority < priority
+		strm.Mux.RUnlock()
+		if !eligible || c.restarting.busy(key) {
+			continue
+		}
+		if candidate == nil || lessEvictable(strm, candidate) {
+			id, candidate = key, strm
+		}
+	}
+	return id, candidate
+}
+
+// lessEvictable indicates if the stream is evicted before the other one, the lower priority first then the longer idle one
+func lessEvictable(strm, other *streaming.Stream) bool {
+	strm.Mux.RLock()
+	priority, lastActivity := strm.Options.Priority, strm.LastActivity
+	strm.Mux.RUnlock()
+	other.Mux.RLock()
+	defer other.Mux.RUnlock()
+	if priority != other.Options.Priority {
+		return priority < other.Options.Priority
+	}
+	return lastActivity.Before(other.LastActivity)
+}
+
+// evictFor pauses the stream a new stream with the given priority can evict to make room for it, the evicted stream stays registered
+// and it is resumed once a slot is free. Returns false if no stream could be evicted
+func (c *Controller) evictFor(ctx context.Context, dir string, priority int) bool {
+	id, strm := c.evictionCandidate(priority)
+	if strm == nil || !c.restarting.begin(id) {
+		return false
+	}
+	defer c.restarting.end(id)
+	c.logger(ctx).Infof("%s is getting evicted to make room for %s", id, dir)
+	// The stream is marked first, so its clients cannot restart it while its process is stopped
+	strm.Evict()
+	if err := strm.StopRecording(); err != nil {
+		c.logger(ctx).Error(err)
+	}
+	stopCtx, cancel := context.WithTimeout(ctx, c.spec().ShutdownGrace)
+	defer cancel()
+	if err := strm.Stop(stopCtx, true); err != nil {
+		c.logger(ctx).Error(err)
+	}
+	c.metrics.RemoveStream(id)
+	c.publishBy(ctx, events.Evicted, id, strm, dir)
+	c.persist()
+	return true
+}
+
+// resumeEvicted resumes the evicted streams while there are free slots, the ones with the highest priority first
+func (c *Controller) resumeEvicted() {
+	ids := []string{}
+	streams := c.snapshotStreams()
+	for id, strm := range streams {
+		if strm.IsEvicted() {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	sort.Slice(ids, func(i, j int) bool { return lessEvictable(streams[ids[j]], streams[ids[i]]) })
+	if !c.spawns.enter() {
+		return
+	}
+	defer c.spawns.leave()
+	for _, id := range ids {
+		if max := c.spec().MaxStreams; max > 0 && c.activeStreams() >= max {
+			return
+		}
+		strm := streams[id]
+		if !c.restarting.begin(id) {
+			continue
+		}
+		// The stream could have been resumed or stopped by a client in the meantime
+		if strm.IsEvicted() {
+			c.log.Infof("%s is getting resumed, a slot is free again", id)
+			if err := c.resume(context.Background(), id, strm, events.Resumed); err != nil {
+				c.log.Errorf("%s could not be resumed || Error: %s", id, err)
+			}
+			c.persist()
+		}
+		c.restarting.end(id)
+	}
+}
+
+// PriorityHandler is the HTTP handler of the PATCH /stream/:id/priority call. It changes the priority of the stream
+// without restarting it, the new priority decides the evictions from then on
+func (c *Controller) PriorityHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	var dto PriorityDto
+	if err := json.Unmarshal(body, &dto); err != nil || dto.Priority == nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	strm.SetPriority(*dto.Priority)
+	c.persist()
+	c.logger(r.Context()).Infof("Priority of %s is set to %d%s", id, *dto.Priority, requestedBy(apiKeyName(r)))
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
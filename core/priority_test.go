@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+)
+
+func TestEviction(t *testing.T) {
+	setup := func(t *testing.T, queueSize int) *testServer {
+		spawned := int32(0)
+		return newTestServer(t, func(conf *config.Specification) {
+			conf.MaxStreams = 1
+			conf.QueueSize = queueSize
+		}, mockProcessor{spawned: &spawned}, nil)
+	}
+	start := func(s *testServer, priority int) (int, StreamDto) {
+		status, dto, _ := s.start(t, "", fmt.Sprintf(`{"uri": %q, "priority": %d}`, generateURI(), priority))
+		return status, dto
+	}
+
+	t.Run("Should evict the running stream with the lowest priority", func(t *testing.T) {
+		s := setup(t, 0)
+		defer s.close()
+		sub := s.ctrls.events.Subscribe()
+		defer s.ctrls.events.Unsubscribe(sub)
+		status, low := start(s, 1)
+		assert.Equal(t, http.StatusOK, status)
+		status, high := start(s, 5)
+		assert.Equal(t, http.StatusOK, status)
+
+		evicted, _ := s.ctrls.getStream(low.ID)
+		assert.True(t, evicted.IsEvicted())
+		assert.True(t, evicted.IsPaused())
+		assert.False(t, evicted.Streak.IsActive())
+		assert.Equal(t, 1, s.ctrls.activeStreams())
+
+		received := []events.Event{}
+		for len(received) < 3 {
+			received = append(received, <-sub.Events())
+		}
+		assert.Equal(t, events.Evicted, received[1].Type)
+		assert.Equal(t, low.ID, received[1].StreamID)
+		assert.Equal(t, high.ID, received[1].Details)
+
+		// The evicted stream gets the slot back once it is free
+		strm, _ := s.ctrls.getStream(high.ID)
+		strm.Streak.Deactivate()
+		s.ctrls.drainQueue()
+		assert.False(t, evicted.IsEvicted())
+		assert.False(t, evicted.IsPaused())
+		assert.True(t, evicted.Streak.IsActive())
+	})
+
+	t.Run("Should not evict the streams with the same or a higher priority", func(t *testing.T) {
+		s := setup(t, 0)
+		defer s.close()
+		status, running := start(s, 3)
+		assert.Equal(t, http.StatusOK, status)
+		for _, priority := range []int{3, 2} {
+			status, _ = start(s, priority)
+			assert.Equal(t, http.StatusServiceUnavailable, status)
+		}
+		strm, _ := s.ctrls.getStream(running.ID)
+		assert.False(t, strm.IsEvicted())
+
+		// The starts that cannot evict are queued
+		queued := setup(t, 5)
+		defer queued.close()
+		start(queued, 3)
+		status, _ = start(queued, 3)
+		assert.Equal(t, http.StatusAccepted, status)
+		assert.Equal(t, 1, queued.ctrls.queue.len())
+	})
+
+	t.Run("Should evict the least recently active stream of the lowest priority", func(t *testing.T) {
+		s := setup(t, 0)
+		defer s.close()
+		s.ctrls.spec().MaxStreams = 2
+		_, first := start(s, 0)
+		_, second := start(s, 0)
+		firstStream, _ := s.ctrls.getStream(first.ID)
+		secondStream, _ := s.ctrls.getStream(second.ID)
+		firstStream.LastActivity = time.Now()
+		secondStream.LastActivity = time.Now().Add(-time.Minute)
+
+		status, _ := start(s, 1)
+		assert.Equal(t, http.StatusOK, status)
+		assert.False(t, firstStream.IsEvicted())
+		assert.True(t, secondStream.IsEvicted())
+	})
+}
+
+func TestPriorityHandler(t *testing.T) {
+	conf := config.InitConfig()
+	ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+	router := httprouter.New()
+	router.PATCH("/stream/:id/priority", ctrls.PriorityHandler)
+	strm := generateStream(nil, "")
+	ctrls.setStream("id", &strm.strm)
+	patch := func(id, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/stream/"+id+"/priority", strings.NewReader(body)))
+		return rr
+	}
+
+	t.Run("Should change the priority of the stream", func(t *testing.T) {
+		rr := patch("id", `{"priority": 7}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"priority": 7}`, rr.Body.String())
+		assert.Equal(t, 7, strm.strm.Options.Priority)
+	})
+
+	t.Run("Should refuse the bodies without a priority", func(t *testing.T) {
+		for _, body := range []string{`{}`, `{"priority": "high"}`, `7`} {
+			assert.Equal(t, http.StatusBadRequest, patch("id", body).Code, body)
+		}
+		assert.Equal(t, http.StatusNotFound, patch("other", `{"priority": 1}`).Code)
+	})
+}
@@ -0,0 +1,353 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// queueCheck is the period the queued starts are checked with for a free slot and for the end of their wait
+const queueCheck = time.Second
+
+// queuedStart is the start of a new stream waiting for a free slot. The clients of the start wait for done,
+// status and err describe the outcome of the start once it is closed
+type queuedStart struct {
+	id        string
+	canonical string
+	source    string
+	dto       StreamDto
+	opts      streaming.Options
+	key       string
+	requestID string
+	wait      bool
+	queuedAt  time.Time
+	expiresAt time.Time
+	done      chan struct{}
+	status    int
+	err       error
+}
+
+// newQueuedStart creates the queued start of the new stream requested by the start request
+func newQueuedStart(r *http.Request, id, canonical, source string, dto StreamDto, opts streaming.Options, wait bool) *queuedStart {
+	return &queuedStart{
+		id:        id,
+		canonical: canonical,
+		source:    source,
+		dto:       dto,
+		opts:      opts,
+		key:       apiKeyName(r),
+		requestID: RequestIDFromContext(r.Context()),
+		wait:      wait,
+		done:      make(chan struct{}),
+	}
+}
+
+// finish records the outcome of the start and lets its clients know about it, it has to be called once
+func (q *queuedStart) finish(status int, err error) {
+	q.status, q.err = status, err
+	close(q.done)
+}
+
+// context returns the context the queued start is carried out with, carrying the id and the API key of its request
+func (q *queuedStart) context() context.Context {
+	return context.WithValue(WithRequestID(context.Background(), q.requestID), apiKeyContext, q.key)
+}
+
+// startQueue holds the queued starts in the order they were requested
+type startQueue struct {
+	mux     *sync.Mutex
+	entries []*queuedStart
+	wake    chan struct{}
+}
+
+// newStartQueue creates a new instance of startQueue
+func newStartQueue() *startQueue {
+	return &startQueue{mux: &sync.Mutex{}, wake: make(chan struct{}, 1)}
+}
+
+// push adds the start to the end of the queue if it has less than size entries. The start already queued for the
+// same stream is returned instead of the given one, nil is returned if the queue is full
+func (q *startQueue) push(entry *queuedStart, size int) *queuedStart {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	for _, queued := range q.entries {
+		if queued.id == entry.id {
+			return queued
+		}
+	}
+	if len(q.entries) >= size {
+		return nil
+	}
+	q.entries = append(q.entries, entry)
+	return entry
+}
+
+// pushFront puts back the start that could not get a slot at the head of the queue
+func (q *startQueue) pushFront(entry *queuedStart) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.entries = append([]*queuedStart{entry}, q.entries...)
+}
+
+// pop removes the start at the head of the queue, nil if the queue is empty
+func (q *startQueue) pop() *queuedStart {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if len(q.entries) == 0 {
+		return nil
+	}
+	entry := q.entries[0]
+	q.entries = q.entries[1:]
+	return entry
+}
+
+// find returns the queued start of the stream, nil if it is not queued
+func (q *startQueue) find(id string) *queuedStart {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	for _, entry := range q.entries {
+		if entry.id == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// position returns the place of the stream in the queue starting from 1, 0 if it is not queued
+func (q *startQueue) position(id string) int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	for i, entry := range q.entries {
+		if entry.id == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// remove takes the queued start of the stream out of the queue, nil if it is not queued
+func (q *startQueue) remove(id string) *queuedStart {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	for i, entry := range q.entries {
+		if entry.id == id {
+			q.entries = append(q.entries[:i:i], q.entries[i+1:]...)
+			return entry
+		}
+	}
+	return nil
+}
+
+// expire takes the starts that waited until their end out of the queue
+func (q *startQueue) expire(now time.Time) []*queuedStart {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	kept, expired := q.entries[:0:0], []*queuedStart{}
+	for _, entry := range q.entries {
+		if now.Before(entry.expiresAt) {
+			kept = append(kept, entry)
+			continue
+		}
+		expired = append(expired, entry)
+	}
+	q.entries = kept
+	return expired
+}
+
+// snapshot returns the queued starts in order
+func (q *startQueue) snapshot() []*queuedStart {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return append([]*queuedStart{}, q.entries...)
+}
+
+// len returns the number of queued starts
+func (q *startQueue) len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.entries)
+}
+
+// notify wakes the queue up to check for a free slot without waiting for the next check
+func (q *startQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queueing indicates if the start of the new stream has to wait in the queue. Only the streams limited by MAX_STREAMS are
+// queued, and the new starts wait behind the queued ones even if a slot is free, so the queue keeps its order.
+// The starts that can evict a running stream with a lower priority do not wait
+func (c *Controller) queueing(opts streaming.Options) bool {
+	spec := c.spec()
+	if spec.QueueSize == 0 || spec.MaxStreams == 0 || opts.Lazy {
+		return false
+	}
+	full := c.activeStreams() >= spec.MaxStreams
+	if _, candidate := c.evictionCandidate(opts.Priority); full && candidate != nil {
+		return false
+	}
+	return c.queue.len() > 0 || full
+}
+
+// enqueueStart puts the start at the end of the queue, claiming its alias for it. It returns the start waiting for the stream,
+// which is a start queued by an earlier request of the same stream if there is one, or nil if the queue is full
+func (c *Controller) enqueueStart(entry *queuedStart) (*queuedStart, error) {
+	if entry.dto.Alias != "" {
+		if err := c.claimAlias(entry.id, entry.canonical); err != nil {
+			return nil, err
+		}
+	}
+	now := c.now()
+	entry.queuedAt, entry.expiresAt = now, now.Add(c.spec().QueueMaxWait)
+	queued := c.queue.push(entry, c.spec().QueueSize)
+	if queued == nil {
+		if entry.dto.Alias != "" {
+			c.releaseAlias(entry.id, entry.canonical)
+		}
+		return nil, nil
+	}
+	// A slot could have been freed since it was checked
+	c.queue.notify()
+	return queued, nil
+}
+
+// awaitQueued answers the start request of a queued stream. The request is accepted right away unless it waits for the stream,
+// then it is answered once the queued start is carried out or accepted if the client or the service gives up first
+func (c *Controller) awaitQueued(r *http.Request, entry *queuedStart, wait bool) startResult {
+	if wait {
+		select {
+		case <-entry.done:
+		case <-r.Context().Done():
+		case <-c.done:
+		}
+	}
+	select {
+	case <-entry.done:
+		if entry.err != nil {
+			return startResult{StreamDto{}, entry.status, entry.err, 0}
+		}
+		strm, ok := c.getStream(entry.id)
+		if !ok {
+			return startResult{StreamDto{}, http.StatusNotFound, ErrNoStreamFn(entry.id), 0}
+		}
+		return startResult{c.streamDto(r.Context(), strm, entry.id), http.StatusOK, nil, 0}
+	default:
+	}
+	dto := StreamDto{ID: entry.id, Metadata: entry.dto.Metadata, Group: entry.dto.Group, Queued: true, Position: c.queue.position(entry.id)}
+	if entry.dto.Alias != "" {
+		dto.Alias = entry.id
+	}
+	return startResult{dto, http.StatusAccepted, nil, 0}
+}
+
+// queuedItems describes the queued starts for the list
+func (c *Controller) queuedItems() []*SummariseDto {
+	items := []*SummariseDto{}
+	for i, entry := range c.queue.snapshot() {
+		items = append(items, &SummariseDto{
+			ID:        entry.id,
+			Metadata:  entry.dto.Metadata,
+			Group:     entry.dto.Group,
+			SourceURI: streaming.RedactURI(entry.dto.URI),
+			Queued:    true,
+			Position:  i + 1,
+		})
+	}
+	return items
+}
+
+// cancelQueued takes the queued start of the stream out of the queue, returns false if it is not queued
+func (c *Controller) cancelQueued(id string) bool {
+	entry := c.queue.remove(id)
+	if entry == nil {
+		return false
+	}
+	c.dropQueued(entry, http.StatusConflict, ErrQueuedStartStopped)
+	return true
+}
+
+// dropQueued gives up the queued start, releasing its alias and answering its clients with the error
+func (c *Controller) dropQueued(entry *queuedStart, status int, err error) {
+	if entry.dto.Alias != "" {
+		c.releaseAlias(entry.id, entry.canonical)
+	}
+	entry.finish(status, err)
+}
+
+// queueLoop starts the queued streams as the slots get free until the service is shut down
+func (c *Controller) queueLoop() {
+	ticker := time.NewTicker(queueCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.queue.wake:
+		case <-c.done:
+			return
+		}
+		c.drainQueue()
+	}
+}
+
+// drainQueue drops the queued starts that waited too long and starts the ones at the head of the queue while there are free slots.
+// The evicted streams get the slots left once the queue is empty
+func (c *Controller) drainQueue() {
+	for _, entry := range c.queue.expire(c.now()) {
+		wait := c.spec().QueueMaxWait
+		c.logger(entry.context()).Warnf("%s is dropped from the queue, no slot was freed within %s", entry.id, wait)
+		c.metrics.StartFailed()
+		c.dropQueued(entry, http.StatusServiceUnavailable, ErrQueueExpiredFn(wait))
+	}
+	for {
+		if max := c.spec().MaxStreams; max > 0 && c.activeStreams() >= max {
+			return
+		}
+		entry := c.queue.pop()
+		if entry == nil {
+			c.resumeEvicted()
+			return
+		}
+		if !c.startQueued(entry) {
+			return
+		}
+	}
+}
+
+// startQueued starts the stream of the queued start like its request would have. It returns false if the start
+// has to wait for another slot, the start is put back at the head of the queue then
+func (c *Controller) startQueued(entry *queuedStart) bool {
+	// Nothing is spawned while every stream is being stopped
+	if !c.spawns.enter() {
+		c.queue.pushFront(entry)
+		return false
+	}
+	defer c.spawns.leave()
+	ctx, cancel := context.WithTimeout(entry.context(), c.spec().StartTimeout)
+	defer cancel()
+	status, err := c.starts.do(entry.id, func() (int, error) {
+		return c.createStream(ctx, entry.source, entry.id, entry.opts, entry.key, entry.wait)
+	})
+	// The slot could have been taken by a stream started by another call, like a restart
+	if status == http.StatusServiceUnavailable {
+		c.queue.pushFront(entry)
+		return false
+	}
+	if err != nil {
+		c.metrics.StartFailed()
+		c.dropQueued(entry, status, err)
+		return true
+	}
+	if _, err := c.completeStart(ctx, entry.id, entry.dto); err != nil {
+		c.metrics.StartFailed()
+		entry.finish(http.StatusInternalServerError, err)
+		return true
+	}
+	c.logger(ctx).Infof("%s is started from the queue after %s", entry.id, c.now().Sub(entry.queuedAt).Round(time.Second))
+	entry.finish(http.StatusOK, nil)
+	return true
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartQueue(t *testing.T) {
+	now := time.Now()
+	queue := newStartQueue()
+	first := &queuedStart{id: "first", expiresAt: now.Add(time.Minute)}
+	second := &queuedStart{id: "second", expiresAt: now.Add(time.Second)}
+	assert.Equal(t, first, queue.push(first, 2))
+	assert.Equal(t, second, queue.push(second, 2))
+	// The start of a queued stream waits for the queued one, the full queue refuses the others
+	assert.Equal(t, first, queue.push(&queuedStart{id: "first"}, 2))
+	assert.Nil(t, queue.push(&queuedStart{id: "third"}, 2))
+	assert.Equal(t, 2, queue.position("second"))
+	assert.Equal(t, 0, queue.position("third"))
+
+	assert.Equal(t, []*queuedStart{second}, queue.expire(now.Add(time.Second)))
+	assert.Equal(t, []*queuedStart{first}, queue.snapshot())
+	assert.Equal(t, first, queue.pop())
+	queue.pushFront(first)
+	assert.Equal(t, first, queue.remove("first"))
+	assert.Nil(t, queue.remove("first"))
+	assert.Nil(t, queue.pop())
+	assert.Equal(t, 0, queue.len())
+}
+
+func TestQueuedStarts(t *testing.T) {
+	setup := func(maxWait time.Duration) (*Controller, *httptest.Server) {
+		conf := *config.InitConfig()
+		conf.MaxStreams, conf.QueueSize, conf.QueueMaxWait = 1, 2, maxWait
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		// The started streams are active, they take the free slots
+		ctrls.processor = mockProcessor{spawned: new(int32)}
+		router := httprouter.New()
+		router.POST("/start", ctrls.StartStreamHandler)
+		router.GET("/list", ctrls.ListStreamHandler)
+		router.GET("/capacity", ctrls.CapacityHandler)
+		return ctrls, httptest.NewServer(router)
+	}
+	start := func(server *httptest.Server, query string, dto StreamDto) (*http.Response, StreamDto) {
+		b, err := json.Marshal(dto)
+		assert.Nil(t, err)
+		res, err := http.Post(fmt.Sprintf("%s/start%s", server.URL, query), "application/json", bytes.NewBuffer(b))
+		assert.Nil(t, err)
+		var started StreamDto
+		json.NewDecoder(res.Body).Decode(&started)
+		return res, started
+	}
+
+	t.Run("Should queue the starts at capacity and start them as the slots get free", func(t *testing.T) {
+		ctrls, server := setup(time.Minute)
+		defer server.Close()
+		running := generateStream(nil, "")
+		running.strm.Streak.Activate()
+		ctrls.setStream(running.dirPath, &running.strm)
+
+		res, queued := start(server, "", StreamDto{URI: generateURI(), Alias: "front", Group: "north"})
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+		assert.Equal(t, StreamDto{ID: "front", Alias: "front", Group: "north", Queued: true, Position: 1}, queued)
+		res, queued = start(server, "", StreamDto{URI: generateURI()})
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+		assert.Equal(t, 2, queued.Position)
+		// The queue is full, the starts are refused like before
+		res, _ = start(server, "", StreamDto{URI: generateURI()})
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+		res, err := http.Get(fmt.Sprintf("%s/list", server.URL))
+		assert.Nil(t, err)
+		var list []SummariseDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&list))
+		assert.Len(t, list, 3)
+		for _, item := range list {
+			if item.ID == "front" {
+				assert.True(t, item.Queued)
+				assert.Equal(t, 1, item.Position)
+				assert.Equal(t, "north", item.Group)
+			}
+		}
+		res, err = http.Get(fmt.Sprintf("%s/capacity", server.URL))
+		assert.Nil(t, err)
+		var capacity CapacityDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&capacity))
+		assert.Equal(t, CapacityDto{Running: 1, MaxStreams: 1, Queued: 2}, capacity)
+
+		// Nothing is started until a slot is free
+		ctrls.drainQueue()
+		assert.Equal(t, 2, ctrls.queue.len())
+		entry := ctrls.queue.find("front")
+		status, err := ctrls.stopStream(context.Background(), running.dirPath, false)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		ctrls.drainQueue()
+		<-entry.done
+		assert.Equal(t, http.StatusOK, entry.status)
+		strm, ok := ctrls.getStream("front")
+		if assert.True(t, ok) {
+			assert.Equal(t, "north", strm.GetGroup())
+		}
+		assert.Equal(t, 1, ctrls.queue.len())
+		assert.Equal(t, 1, ctrls.queue.position(queued.ID))
+
+		// The started stream is answered to its next start
+		res, started := start(server, "", StreamDto{URI: strm.OriginalURI, Alias: "front"})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.False(t, started.Queued)
+	})
+
+	t.Run("Should answer the start waiting with ?wait=true once the queued start is done", func(t *testing.T) {
+		ctrls, server := setup(time.Minute)
+		defer server.Close()
+		running := generateStream(nil, "")
+		running.strm.Streak.Activate()
+		ctrls.setStream(running.dirPath, &running.strm)
+
+		uri := generateURI()
+		dir, _ := streaming.GetURIDirectory(uri)
+		results := make(chan *http.Response, 1)
+		go func() {
+			b, _ := json.Marshal(StreamDto{URI: uri})
+			res, err := http.Post(fmt.Sprintf("%s/start?wait=true", server.URL), "application/json", bytes.NewBuffer(b))
+			assert.Nil(t, err)
+			results <- res
+		}()
+		assert.True(t, waitUntil(func() bool { return ctrls.queue.find(dir) != nil }, time.Second))
+		status, err := ctrls.stopStream(context.Background(), dir, false)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		select {
+		case res := <-results:
+			assert.Equal(t, http.StatusConflict, res.StatusCode)
+			var errDto ErrorDto
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&errDto))
+			assert.Equal(t, "queue_stopped", errDto.Error.Code)
+		case <-time.After(time.Second):
+			t.Error("the waiting start was not answered")
+		}
+		_, ok := ctrls.getStream(dir)
+		assert.False(t, ok)
+	})
+
+	t.Run("Should cancel and expire the queued starts", func(t *testing.T) {
+		ctrls, server := setup(time.Minute)
+		defer server.Close()
+		running := generateStream(nil, "")
+		running.strm.Streak.Activate()
+		ctrls.setStream(running.dirPath, &running.strm)
+
+		res, queued := start(server, "", StreamDto{URI: generateURI(), Alias: "front"})
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+		entry := ctrls.queue.find(queued.ID)
+		status, err := ctrls.stopStream(context.Background(), queued.ID, false)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		<-entry.done
+		assert.Equal(t, ErrQueuedStartStopped, entry.err)
+		assert.Equal(t, 0, ctrls.queue.len())
+		// The alias is released for other sources
+		assert.Nil(t, ctrls.claimAlias("front", "other"))
+
+		res, queued = start(server, "", StreamDto{URI: generateURI()})
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+		entry = ctrls.queue.find(queued.ID)
+		ctrls.now = func() time.Time { return time.Now().Add(time.Minute) }
+		ctrls.drainQueue()
+		<-entry.done
+		assert.Equal(t, http.StatusServiceUnavailable, entry.status)
+		assert.Equal(t, ErrQueueExpiredFn(time.Minute), entry.err)
+		assert.Equal(t, 0, ctrls.queue.len())
+	})
+
+	t.Run("Should refuse the starts at capacity without a queue", func(t *testing.T) {
+		ctrls, server := setup(time.Minute)
+		defer server.Close()
+		ctrls.setSpec(func() *config.Specification {
+			conf := *config.InitConfig()
+			conf.MaxStreams = 1
+			return &conf
+		}())
+		running := generateStream(nil, "")
+		running.strm.Streak.Activate()
+		ctrls.setStream(running.dirPath, &running.strm)
+		res, _ := start(server, "", StreamDto{URI: generateURI()})
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, 0, ctrls.queue.len())
+	})
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// ErrRateLimited is sent when the client made too many requests
+var ErrRateLimited = errors.New("Too many requests, try again later")
+
+// bucket describes a token bucket refilling continuously
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// available returns the tokens of the bucket including the ones gathered since the last update
+func (b *bucket) available(now time.Time, rate, burst float64) float64 {
+	return math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+}
+
+// refill adds the tokens gathered since the last update to the bucket
+func (b *bucket) refill(now time.Time, rate, burst float64) {
+	b.tokens = b.available(now, rate, burst)
+	b.last = now
+}
+
+// wait returns how long it takes for the bucket to have a token
+func (b *bucket) wait(rate float64) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// rateLimiter limits the requests with a global and a per client token bucket
+type rateLimiter struct {
+	mux     *sync.Mutex
+	spec    config.RateLimit
+	global  *bucket
+	clients map[string]*bucket
+}
+
+// newRateLimiter creates a new instance of rateLimiter, returns nil if limiting is disabled
+func newRateLimiter(spec config.RateLimit) *rateLimiter {
+	if !spec.Enabled {
+		return nil
+	}
+	return &rateLimiter{
+		&sync.Mutex{},
+		spec,
+		&bucket{spec.GlobalBurst, time.Now()},
+		map[string]*bucket{},
+	}
+}
+
+// allow takes a token for the client if both the global and its own bucket have one,
+// otherwise returns how long the client should wait before retrying
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	b, ok := l.clients[client]
+	if !ok {
+		l.evict(now)
+		b = &bucket{l.spec.ClientBurst, now}
+		l.clients[client] = b
+	}
+	l.global.refill(now, l.spec.GlobalRate, l.spec.GlobalBurst)
+	b.refill(now, l.spec.ClientRate, l.spec.ClientBurst)
+	wait := l.global.wait(l.spec.GlobalRate)
+	if clientWait := b.wait(l.spec.ClientRate); clientWait > wait {
+		wait = clientWait
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	l.global.tokens--
+	b.tokens--
+	return true, 0
+}
+
+// evict makes room for a new client if the limit of tracked clients is reached.
+// Clients with a full bucket are dropped first, as they are the same as new ones,
+// then the one that has not been seen for the longest time
+func (l *rateLimiter) evict(now time.Time) {
+	if len(l.clients) < l.spec.MaxClients {
+		return
+	}
+	var oldest string
+	for client, b := range l.clients {
+		if b.available(now, l.spec.ClientRate, l.spec.ClientBurst) >= l.spec.ClientBurst {
+			delete(l.clients, client)
+			continue
+		}
+		if oldest == "" || b.last.Before(l.clients[oldest].last) {
+			oldest = client
+		}
+	}
+	if len(l.clients) >= l.spec.MaxClients && oldest != "" {
+		delete(l.clients, oldest)
+	}
+}
+
+// clientIP returns the IP address the request was sent from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
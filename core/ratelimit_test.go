@@ -0,0 +1,93 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	spec := config.RateLimit{
+		Enabled:     true,
+		GlobalRate:  10,
+		GlobalBurst: 3,
+		ClientRate:  1,
+		ClientBurst: 2,
+		MaxClients:  2,
+	}
+
+	t.Run("Should not create limiter if it is disabled", func(t *testing.T) {
+		assert.Nil(t, newRateLimiter(config.RateLimit{}))
+	})
+
+	t.Run("Should limit clients by their own bucket", func(t *testing.T) {
+		limiter := newRateLimiter(spec)
+		now := time.Now()
+		for i := 0; i < 2; i++ {
+			allowed, _ := limiter.allow("10.0.0.1", now)
+			assert.True(t, allowed)
+		}
+		allowed, wait := limiter.allow("10.0.0.1", now)
+		assert.False(t, allowed)
+		assert.Equal(t, time.Second, wait)
+
+		allowed, _ = limiter.allow("10.0.0.1", now.Add(time.Second))
+		assert.True(t, allowed)
+	})
+
+	t.Run("Should limit every client by the global bucket", func(t *testing.T) {
+		limiter := newRateLimiter(spec)
+		now := time.Now()
+		for i, client := range []string{"10.0.0.1", "10.0.0.1", "10.0.0.2"} {
+			if allowed, _ := limiter.allow(client, now); !assert.True(t, allowed) {
+				t.Error(fmt.Errorf("%d testcase is failing for allowed starts", i))
+			}
+		}
+		allowed, wait := limiter.allow("10.0.0.2", now)
+		assert.False(t, allowed)
+		assert.Equal(t, 100*time.Millisecond, wait)
+		// Denied requests do not take tokens
+		allowed, _ = limiter.allow("10.0.0.2", now.Add(100*time.Millisecond))
+		assert.True(t, allowed)
+	})
+
+	t.Run("Should not track more clients than the maximum", func(t *testing.T) {
+		limiter := newRateLimiter(spec)
+		now := time.Now()
+		limiter.allow("10.0.0.1", now)
+		limiter.allow("10.0.0.2", now.Add(time.Millisecond))
+		limiter.allow("10.0.0.3", now.Add(2*time.Millisecond))
+		assert.Len(t, limiter.clients, 2)
+		_, ok := limiter.clients["10.0.0.1"]
+		assert.False(t, ok)
+
+		// Clients with full buckets are dropped first
+		later := now.Add(time.Minute)
+		limiter.allow("10.0.0.3", later)
+		limiter.allow("10.0.0.4", later)
+		assert.Len(t, limiter.clients, 2)
+		_, ok = limiter.clients["10.0.0.3"]
+		assert.True(t, ok)
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	tt := []struct {
+		RemoteAddr string
+		IP         string
+	}{
+		{RemoteAddr: "192.168.0.1:51234", IP: "192.168.0.1"},
+		{RemoteAddr: "[::1]:51234", IP: "::1"},
+		{RemoteAddr: "192.168.0.1", IP: "192.168.0.1"},
+	}
+
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.IP, clientIP(&http.Request{RemoteAddr: testCase.RemoteAddr})) {
+			t.Error(fmt.Errorf("%d testcase is failing", i))
+		}
+	}
+}
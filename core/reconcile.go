@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ReconcileDto describes the orphaned directories of the store, the ones no stream is written into.
+// They are removed unless it is a dry run
+type ReconcileDto struct {
+	DryRun      bool           `json:"dryRun"`
+	Removed     int            `json:"removed"`
+	Failed      int            `json:"failed"`
+	Size        int64          `json:"size"` // Bytes used by the orphaned directories
+	Directories []OrphanDirDto `json:"directories"`
+}
+
+// OrphanDirDto describes an orphaned directory of the store
+type OrphanDirDto struct {
+	Path       string        `json:"path"` // Path of the directory inside the store
+	Size       int64         `json:"size"`
+	ModifiedAt time.Time     `json:"modifiedAt"` // Time the newest file of the directory was written
+	Removed    bool          `json:"removed"`
+	Error      *ErrorBodyDto `json:"error,omitempty"`
+}
+
+// orphanDir describes a directory of the store that does not belong to any stream
+type orphanDir struct {
+	path       string
+	size       int64
+	modifiedAt time.Time
+}
+
+// absolutePaths returns the absolute forms of the paths, the empty ones are left out
+func absolutePaths(paths ...string) []string {
+	result := []string{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			result = append(result, abs)
+		}
+	}
+	return result
+}
+
+// containsOneOf indicates if one of the paths is inside the directory
+func containsOneOf(dir string, paths []string) bool {
+	for _, path := range paths {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// orphanedDirectories returns the directories inside the given one which neither are nor contain any of the kept ones.
+// The directories containing kept ones are descended into, since the laid out streams share their parents
+func orphanedDirectories(dir string, kept []string) []string {
+	orphans := []string{}
+	for _, name := range subdirectories(dir) {
+		path := filepath.Join(dir, name)
+		switch {
+		case isOneOf(path, kept):
+		case containsOneOf(path, kept):
+			orphans = append(orphans, orphanedDirectories(path, kept)...)
+		default:
+			orphans = append(orphans, path)
+		}
+	}
+	return orphans
+}
+
+// scanOrphan returns the size of the files of the directory and the time the newest of them, or the directory itself, was modified
+func scanOrphan(dir string) orphanDir {
+	orphan := orphanDir{path: dir}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		// Files can be deleted while walking the directory
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(orphan.modifiedAt) {
+			orphan.modifiedAt = info.ModTime()
+		}
+		if !info.IsDir() {
+			orphan.size += info.Size()
+		}
+		return nil
+	})
+	return orphan
+}
+
+// keptDirectories returns the directories of the store that cannot be removed: the ones of the registered streams,
+// the given ones, like the directories of the recovered streams that are not registered yet, and the other directories
+// of the service in case they were configured inside the store
+func (c *Controller) keptDirectories(extra ...string) []string {
+	spec := c.spec()
+	dirs := append([]string{}, extra...)
+	for id, strm := range c.snapshotStreams() {
+		dirs = append(dirs, strm.StorePath, filepath.Join(spec.StoreDir, id))
+	}
+	dirs = append(dirs, spec.RecordingsDir, spec.KeysDir, spec.ProcessStateDir)
+	if spec.Persistence.Path != "" {
+		dirs = append(dirs, filepath.Dir(spec.Persistence.Path))
+	}
+	return absolutePaths(dirs...)
+}
+
+// findOrphans returns the orphaned directories of the store older than RETENTION_ORPHAN_AGE, sorted by their path
+func (c *Controller) findOrphans(extra ...string) []orphanDir {
+	store := absolutePaths(c.spec().StoreDir)
+	if len(store) == 0 {
+		return []orphanDir{}
+	}
+	orphans := []orphanDir{}
+	now := c.now()
+	for _, dir := range orphanedDirectories(store[0], c.keptDirectories(extra...)) {
+		orphan := scanOrphan(dir)
+		if now.Sub(orphan.modifiedAt) > c.spec().RetentionOrphanAge {
+			orphans = append(orphans, orphan)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].path < orphans[j].path })
+	return orphans
+}
+
+// reconcileStore removes the orphaned directories of the store, or only reports them on a dry run or with RETENTION_ORPHAN_REPORT_ONLY.
+// The streams registered meanwhile are checked again right before their directories would be removed, and the recent
+// directories are never orphaned, so it is safe to run while streams are being started
+func (c *Controller) reconcileStore(ctx context.Context, dryRun bool, extra ...string) ReconcileDto {
+	store := c.spec().StoreDir
+	dto := ReconcileDto{DryRun: dryRun || c.spec().RetentionOrphanReportOnly, Directories: []OrphanDirDto{}}
+	for _, orphan := range c.findOrphans(extra...) {
+		rel, err := filepath.Rel(absolutePaths(store)[0], orphan.path)
+		if err != nil {
+			rel = orphan.path
+		}
+		dir := OrphanDirDto{Path: filepath.ToSlash(rel), Size: orphan.size, ModifiedAt: orphan.modifiedAt}
+		dto.Size += orphan.size
+		if dto.DryRun {
+			c.logger(ctx).Infof("%s is orphaned in the store, it is kept", rel)
+			dto.Directories = append(dto.Directories, dir)
+			continue
+		}
+		kept := c.keptDirectories(extra...)
+		if isOneOf(orphan.path, kept) || containsOneOf(orphan.path, kept) {
+			continue
+		}
+		if err := os.RemoveAll(orphan.path); err != nil {
+			c.logger(ctx).Errorf("Orphaned %s could not be removed from the store || Error: %s", rel, err)
+			dir.Error = &ErrorBodyDto{errorCode(ErrUnexpected, http.StatusInternalServerError), err.Error(), ""}
+			dto.Failed++
+		} else {
+			c.logger(ctx).Infof("%s is removed from the store, it was orphaned", rel)
+			dir.Removed = true
+			dto.Removed++
+		}
+		dto.Directories = append(dto.Directories, dir)
+	}
+	if dto.Removed > 0 {
+		c.usage.reset(c.storageUsage())
+	}
+	return dto
+}
+
+// parseReconcileQuery reads the parameters of the reconciliation of the store
+func parseReconcileQuery(values url.Values) (bool, error) {
+	value := values.Get("dryRun")
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, ErrInvalidReconcileQuery
+	}
+	return dryRun, nil
+}
+
+// ReconcileHandler is the HTTP handler of the POST /admin/reconcile call, which removes the orphaned directories of the store
+func (c *Controller) ReconcileHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	dryRun, err := parseReconcileQuery(r.URL.Query())
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if c.spec().RetentionOrphanAge == 0 {
+		c.SendError(w, ErrReconcileDisabled, http.StatusConflict)
+		return
+	}
+	dto := c.reconcileStore(r.Context(), dryRun)
+	if !dto.DryRun {
+		c.logger(r.Context()).Infof("%d orphaned directories are removed from the store, %d failed%s", dto.Removed, dto.Failed, requestedBy(apiKeyName(r)))
+	}
+	status := http.StatusOK
+	if dto.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// reconcileAtStartup removes the orphaned directories of the store left by the previous runs of the service,
+// keeping the directories of the recovered streams
+func (c *Controller) reconcileAtStartup(recovered []string) {
+	if c.spec().RetentionOrphanAge == 0 {
+		return
+	}
+	dto := c.reconcileStore(context.Background(), false, recovered...)
+	if len(dto.Directories) > 0 {
+		c.log.Infof("%d orphaned directories are found in the store using %d bytes, %d are removed", len(dto.Directories), dto.Size, dto.Removed)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReconcileQuery(t *testing.T) {
+	tt := []struct {
+		Query    string
+		Expected bool
+		Err      error
+	}{
+		{Query: "", Expected: false},
+		{Query: "dryRun=true", Expected: true},
+		{Query: "dryRun=false", Expected: false},
+		{Query: "dryRun=maybe", Err: ErrInvalidReconcileQuery},
+	}
+	for i, test := range tt {
+		values, _ := url.ParseQuery(test.Query)
+		dryRun, err := parseReconcileQuery(values)
+		if !assert.Equal(t, test.Err, err) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestParseReconcileQuery", i))
+		}
+		if !assert.Equal(t, test.Expected, dryRun) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestParseReconcileQuery", i))
+		}
+	}
+}
+
+func TestReconcileStore(t *testing.T) {
+	old := time.Now().Add(-time.Hour * 48)
+	setup := func(t *testing.T, change func(*config.Specification)) (*Controller, string) {
+		storeDir, err := ioutil.TempDir("", "store")
+		assert.Nil(t, err)
+		conf := *config.InitConfig()
+		conf.StoreDir = storeDir
+		conf.RecordingsDir = filepath.Join(storeDir, "recordings")
+		conf.RetentionOrphanAge = time.Hour * 24
+		if change != nil {
+			change(&conf)
+		}
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+
+		// A registered stream, a laid out one next to an orphan of the same layout, and the recordings
+		registered := generateStream(nil, "")
+		registered.strm.StorePath = filepath.Join(storeDir, "registered")
+		ctrls.setStream("registered", &registered.strm)
+		laidOut := generateStream(nil, "")
+		laidOut.strm.Options.Layout = &streaming.Layout{Directory: "north/front", Segment: "%d"}
+		laidOut.strm.StorePath = filepath.Join(storeDir, "north", "front")
+		ctrls.setStream("front", &laidOut.strm)
+		for _, dir := range []string{"registered", "north/front", "north/old", "orphan", "recent", "recordings/gone"} {
+			assert.Nil(t, os.MkdirAll(filepath.Join(storeDir, dir), os.ModePerm))
+			modTime := old
+			if dir == "recent" {
+				modTime = time.Now()
+			}
+			writeAged(t, filepath.Join(storeDir, dir, "0.ts"), 10, modTime)
+			assert.Nil(t, os.Chtimes(filepath.Join(storeDir, dir), modTime, modTime))
+		}
+		return ctrls, storeDir
+	}
+	reconcile := func(ctrls *Controller, query string) (int, ReconcileDto) {
+		rr := httptest.NewRecorder()
+		ctrls.ReconcileHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reconcile"+query, nil), nil)
+		var dto ReconcileDto
+		json.NewDecoder(rr.Body).Decode(&dto)
+		return rr.Code, dto
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	t.Run("Should remove the old orphaned directories only", func(t *testing.T) {
+		ctrls, storeDir := setup(t, nil)
+		defer os.RemoveAll(storeDir)
+		status, dto := reconcile(ctrls, "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.False(t, dto.DryRun)
+		assert.Equal(t, 2, dto.Removed)
+		assert.Equal(t, int64(20), dto.Size)
+		if assert.Len(t, dto.Directories, 2) {
+			assert.Equal(t, "north/old", dto.Directories[0].Path)
+			assert.Equal(t, "orphan", dto.Directories[1].Path)
+			assert.True(t, dto.Directories[1].Removed)
+		}
+		assert.False(t, exists(filepath.Join(storeDir, "north", "old")))
+		assert.False(t, exists(filepath.Join(storeDir, "orphan")))
+		for _, dir := range []string{"registered", "north/front", "recent", "recordings/gone"} {
+			assert.True(t, exists(filepath.Join(storeDir, dir)), dir)
+		}
+	})
+
+	t.Run("Should only report the orphaned directories on a dry run or with report only", func(t *testing.T) {
+		ctrls, storeDir := setup(t, nil)
+		defer os.RemoveAll(storeDir)
+		status, dto := reconcile(ctrls, "?dryRun=true")
+		assert.Equal(t, http.StatusOK, status)
+		assert.True(t, dto.DryRun)
+		assert.Equal(t, 0, dto.Removed)
+		assert.Len(t, dto.Directories, 2)
+		assert.True(t, exists(filepath.Join(storeDir, "orphan")))
+
+		ctrls, reportDir := setup(t, func(s *config.Specification) { s.RetentionOrphanReportOnly = true })
+		defer os.RemoveAll(reportDir)
+		_, dto = reconcile(ctrls, "?dryRun=false")
+		assert.True(t, dto.DryRun)
+		assert.Len(t, dto.Directories, 2)
+		assert.True(t, exists(filepath.Join(reportDir, "orphan")))
+	})
+
+	t.Run("Should keep the directories of the recovered streams at startup", func(t *testing.T) {
+		ctrls, storeDir := setup(t, nil)
+		defer os.RemoveAll(storeDir)
+		ctrls.reconcileAtStartup([]string{filepath.Join(storeDir, "orphan")})
+		assert.True(t, exists(filepath.Join(storeDir, "orphan")))
+		assert.False(t, exists(filepath.Join(storeDir, "north", "old")))
+	})
+
+	t.Run("Should refuse the reconciliation while it is turned off", func(t *testing.T) {
+		ctrls, storeDir := setup(t, func(s *config.Specification) { s.RetentionOrphanAge = 0 })
+		defer os.RemoveAll(storeDir)
+		status, _ := reconcile(ctrls, "")
+		assert.Equal(t, http.StatusConflict, status)
+		status, _ = reconcile(ctrls, "?dryRun=maybe")
+		assert.Equal(t, http.StatusBadRequest, status)
+		ctrls.reconcileAtStartup(nil)
+		assert.True(t, exists(filepath.Join(storeDir, "orphan")))
+	})
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// reconnectPoll is the period the restarts waiting for a reconnect slot and the reconnects holding one are checked with
+const reconnectPoll = 100 * time.Millisecond
+
+// reconnectLimiter spreads the restarts of the crashed streams, so the sources dropped at once are not reconnected at once.
+// At most CRASH_MAX_RECONNECTS streams reconnect at the same time, and the reconnects of the sources of the same host
+// are at least CRASH_HOST_COOLDOWN apart
+type reconnectLimiter struct {
+	mux     *sync.Mutex
+	running int
+	hosts   map[string]time.Time // Time of the last reconnect of the sources of the hosts
+}
+
+// newReconnectLimiter creates a new instance of reconnectLimiter
+func newReconnectLimiter() *reconnectLimiter {
+	return &reconnectLimiter{mux: &sync.Mutex{}, hosts: map[string]time.Time{}}
+}
+
+// acquire takes a reconnect slot for a source of the host, unless max streams are reconnecting already or the host
+// reconnected within the cooldown. It returns the time left of the cooldown of the host if it did not get a slot because of it
+func (l *reconnectLimiter) acquire(host string, max int, cooldown time.Duration, now time.Time) (bool, time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for known, last := range l.hosts {
+		if now.Sub(last) >= cooldown {
+			delete(l.hosts, known)
+		}
+	}
+	if last, ok := l.hosts[host]; ok && host != "" {
+		return false, cooldown - now.Sub(last)
+	}
+	if max > 0 && l.running >= max {
+		return false, 0
+	}
+	l.running++
+	if host != "" && cooldown > 0 {
+		l.hosts[host] = now
+	}
+	return true, 0
+}
+
+// release gives back the reconnect slot
+func (l *reconnectLimiter) release() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.running--
+}
+
+// sourceHost returns the host of the source without its port, empty if the source has none like the local files
+func sourceHost(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// awaitReconnect waits for a reconnect slot for the crashed stream, its scheduled restart is moved to the end of the cooldown
+// of its host meanwhile. Returns false if the stream is stopped or replaced, or the service is shutting down, without a slot then
+func (c *Controller) awaitReconnect(id string, strm *streaming.Stream) bool {
+	defer strm.CancelRetry()
+	host := sourceHost(strm.OriginalURI)
+	for {
+		spec := c.spec()
+		ok, wait := c.reconnects.acquire(host, spec.CrashMaxReconnects, spec.CrashHostCooldown, time.Now())
+		if ok {
+			return true
+		}
+		if wait < reconnectPoll {
+			wait = reconnectPoll
+		}
+		strm.ScheduleRetry(time.Now().Add(wait))
+		c.streamLog(strm).Debugf("%s waits %s for a reconnect slot", id, wait)
+		select {
+		case <-time.After(wait):
+		case <-c.done:
+			return false
+		}
+		if current, ok := c.getStream(id); !ok || current != strm || strm.IsStopping() {
+			return false
+		}
+	}
+}
+
+// releaseReconnect gives back the reconnect slot of the restarted stream once its process wrote a segment, so it is connected
+// to its source, or once it exited or it did not connect within START_TIMEOUT
+func (c *Controller) releaseReconnect(strm *streaming.Stream, restartedAt time.Time) {
+	defer c.reconnects.release()
+	deadline := time.After(c.spec().StartTimeout)
+	ticker := time.NewTicker(reconnectPoll)
+	defer ticker.Stop()
+	for {
+		connected := strm.Logs != nil && strm.Logs.LastSegmentAt().After(restartedAt)
+		if connected || !strm.IsProcessAlive() || strm.IsStopping() {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// recordingLayout is the time format of the names of the recorded files, written by ffmpeg in local time
+const recordingLayout = "2006-01-02_15-04-05"
+
+// vodPlaylist is the name of the playlist stitching the recordings of a time window together
+const vodPlaylist = "playlist.m3u8"
+
+// ErrNoInitSection describes an error for recorded files that are not fragmented MP4 files
+var ErrNoInitSection = errors.New("Recording has no initialization section")
+
+// RecordedFileDto describes a recorded file of a stream
+type RecordedFileDto struct {
+	File  string    `json:"file"`
+	URI   string    `json:"uri"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"` // Last write of the file, it moves forward while the file is recorded
+	Size  int64     `json:"size"`
+}
+
+// isRecordingName indicates if the given id or file name can be used for reaching the recordings
+func isRecordingName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// timeWindow parses the from and to parameters of the query, missing ones are returned as zero times
+func timeWindow(query url.Values) (from, to time.Time, err error) {
+	if value := query.Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, ErrInvalidTimeWindow
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, ErrInvalidTimeWindow
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, ErrInvalidTimeWindow
+	}
+	return from, to, nil
+}
+
+// overlaps indicates if the recording has footage within the time window, zero times are not limiting it
+func (r RecordedFileDto) overlaps(from, to time.Time) bool {
+	return (from.IsZero() || r.End.After(from)) && (to.IsZero() || r.Start.Before(to))
+}
+
+// mp4InitSize returns the size of the initialization section of a fragmented MP4 file, which ends with its moov box
+func mp4InitSize(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	header := make([]byte, 8)
+	offset := int64(0)
+	for {
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return 0, ErrNoInitSection
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		kind := string(header[4:])
+		// Boxes larger than 4GB carry their size after the header
+		if size == 1 {
+			if _, err := file.ReadAt(header, offset+8); err != nil {
+				return 0, ErrNoInitSection
+			}
+			size = int64(binary.BigEndian.Uint64(header))
+		}
+		if size < 8 {
+			return 0, ErrNoInitSection
+		}
+		offset += size
+		if kind == "moov" {
+			return offset, nil
+		}
+	}
+}
+
+// buildVODPlaylist creates a VOD playlist of the recorded files in the given directory. Every file is a
+// fragmented MP4 file with its own initialization section, so they are separated by discontinuities
+func buildVODPlaylist(dir string, recordings []RecordedFileDto) []byte {
+	segments := &bytes.Buffer{}
+	target := 1
+	written := 0
+	for _, recording := range recordings {
+		duration := recording.End.Sub(recording.Start).Seconds()
+		initSize, err := mp4InitSize(filepath.Join(dir, recording.File))
+		if err != nil || duration <= 0 || recording.Size <= initSize {
+			logrus.Debugf("%s is left out of the playlist || Error: %v", recording.File, err)
+			continue
+		}
+		if written > 0 {
+			segments.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(segments, "#EXT-X-PROGRAM-DATE-TIME:%s\n", recording.Start.Format(time.RFC3339Nano))
+		fmt.Fprintf(segments, "#EXT-X-MAP:URI=\"%s\",BYTERANGE=\"%d@0\"\n", recording.File, initSize)
+		fmt.Fprintf(segments, "#EXTINF:%.3f,\n", duration)
+		fmt.Fprintf(segments, "#EXT-X-BYTERANGE:%d@%d\n", recording.Size-initSize, initSize)
+		fmt.Fprintf(segments, "%s\n", recording.File)
+		if rounded := int(math.Ceil(duration)); rounded > target {
+			target = rounded
+		}
+		written++
+	}
+	playlist := &bytes.Buffer{}
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(playlist, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", target)
+	playlist.Write(segments.Bytes())
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+	return playlist.Bytes()
+}
+
+// recordingDir returns the directory of the recordings of the given stream
+func (c *Controller) recordingDir(id string) string {
+	return filepath.Join(c.spec().RecordingsDir, id)
+}
+
+// recordings returns the recorded files of the given stream for the client of the request in the context, the oldest first.
+// Returns false if the stream has no recordings directory
+func (c *Controller) recordings(ctx context.Context, id string) ([]RecordedFileDto, bool) {
+	if !isRecordingName(id) {
+		return nil, false
+	}
+	dir := c.recordingDir(id)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, false
+	}
+	recordings := []RecordedFileDto{}
+	for _, file := range scanRecordings(dir, false) {
+		name := filepath.Base(file.path)
+		start, err := time.ParseInLocation(recordingLayout, strings.TrimSuffix(name, ".mp4"), time.Local)
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, RecordedFileDto{
+			File:  name,
+			URI:   c.publicURI(ctx, fmt.Sprintf("/recordings/%s/%s", id, name)),
+			Start: start,
+			End:   file.modTime,
+			Size:  file.size,
+		})
+	}
+	return recordings, true
+}
+
+// RecordingsHandler is the HTTP handler of the /recordings/:id call listing the recorded files of a stream.
+// The recordings of stopped streams are listed as well while their files are kept
+func (c *Controller) RecordingsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, r) {
+		return
+	}
+	recordings, ok := c.recordings(r.Context(), c.resolveID(ps.ByName("id")))
+	if !ok {
+		c.SendError(w, ErrRecordingNotFound, http.StatusNotFound)
+		return
+	}
+	b, err := json.Marshal(recordings)
+	if err != nil {
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// RecordingHandler is the HTTP handler of the /recordings/:id/:file call serving a recorded file with range
+// requests, so players can seek in it. The playlist.m3u8 file is the VOD playlist of the requested time window
+func (c *Controller) RecordingHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, r) {
+		return
+	}
+	id, name := c.resolveID(ps.ByName("id")), ps.ByName("file")
+	if name == vodPlaylist {
+		c.servePlayback(w, r, id)
+		return
+	}
+	if !isRecordingName(id) || !isRecordingName(name) || filepath.Ext(name) != ".mp4" {
+		c.SendError(w, ErrRecordingNotFound, http.StatusNotFound)
+		return
+	}
+	file, err := os.Open(filepath.Join(c.recordingDir(id), name))
+	if err != nil {
+		c.SendError(w, ErrRecordingNotFound, http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.SendError(w, ErrRecordingNotFound, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// servePlayback serves the VOD playlist of the recordings of the stream within the requested time window
+func (c *Controller) servePlayback(w http.ResponseWriter, r *http.Request, id string) {
+	from, to, err := timeWindow(r.URL.Query())
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	recordings, ok := c.recordings(r.Context(), id)
+	if !ok {
+		c.SendError(w, ErrRecordingNotFound, http.StatusNotFound)
+		return
+	}
+	window := []RecordedFileDto{}
+	for _, recording := range recordings {
+		if recording.overlaps(from, to) {
+			window = append(window, recording)
+		}
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Write(buildVODPlaylist(c.recordingDir(id), window))
+}
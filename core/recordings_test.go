@@ -0,0 +1,189 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+// box creates an MP4 box of the given kind with a payload of the given size
+func box(kind string, payload int) []byte {
+	b := make([]byte, 8+payload)
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	copy(b[4:], kind)
+	return b
+}
+
+// writeRecording writes a fragmented MP4 file with a 40 bytes long initialization section
+func writeRecording(t *testing.T, dir string, start time.Time, end time.Time) string {
+	name := start.Format(recordingLayout) + ".mp4"
+	content := append(append(box("ftyp", 8), box("moov", 16)...), box("moof", 32)...)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), content, 0644))
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, name), end, end))
+	return name
+}
+
+func TestTimeWindow(t *testing.T) {
+	tt := []struct {
+		Query string
+		From  string
+		To    string
+		Err   error
+	}{
+		{Query: "", From: "", To: "", Err: nil},
+		{Query: "from=2019-05-01T10:00:00Z", From: "2019-05-01T10:00:00Z", To: "", Err: nil},
+		{Query: "from=2019-05-01T10:00:00Z&to=2019-05-01T11:00:00Z", From: "2019-05-01T10:00:00Z", To: "2019-05-01T11:00:00Z", Err: nil},
+		{Query: "from=2019-05-01T11:00:00Z&to=2019-05-01T10:00:00Z", Err: ErrInvalidTimeWindow},
+		{Query: "from=yesterday", Err: ErrInvalidTimeWindow},
+		{Query: "to=1556704800", Err: ErrInvalidTimeWindow},
+	}
+	format := func(value time.Time) string {
+		if value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	}
+	for i, testCase := range tt {
+		query, _ := url.ParseQuery(testCase.Query)
+		from, to, err := timeWindow(query)
+		if !assert.Equal(t, testCase.Err, err) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestTimeWindow", i))
+		}
+		if err == nil && (!assert.Equal(t, testCase.From, format(from)) || !assert.Equal(t, testCase.To, format(to))) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestTimeWindow", i))
+		}
+	}
+}
+
+func TestMP4InitSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	name := writeRecording(t, dir, time.Now().Add(-time.Hour), time.Now())
+	size, err := mp4InitSize(filepath.Join(dir, name))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(40), size)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "plain.mp4"), append(box("ftyp", 8), box("mdat", 8)...), 0644))
+	_, err = mp4InitSize(filepath.Join(dir, "plain.mp4"))
+	assert.Equal(t, ErrNoInitSection, err)
+}
+
+func TestRecordings(t *testing.T) {
+	root, err := ioutil.TempDir("", "recordings")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	conf := *config.InitConfig()
+	conf.RecordingsDir = root
+	conf.KeepRecordings = true
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	router := httprouter.New()
+	router.GET("/recordings/:id", ctrls.RecordingsHandler)
+	router.GET("/recordings/:id/:file", ctrls.RecordingHandler)
+	router.DELETE("/stream/:id", ctrls.StopStreamHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	dir := filepath.Join(root, "id")
+	assert.Nil(t, os.MkdirAll(dir, os.ModePerm))
+	start := time.Now().Add(-time.Hour * 3).Truncate(time.Hour)
+	first := writeRecording(t, dir, start, start.Add(time.Hour))
+	second := writeRecording(t, dir, start.Add(time.Hour), start.Add(time.Hour*2))
+
+	t.Run("Should list the recorded files", func(t *testing.T) {
+		res, err := http.Get(fmt.Sprintf("%s/recordings/id", server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		var dto []RecordedFileDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&dto))
+		assert.Len(t, dto, 2)
+		assert.Equal(t, first, dto[0].File)
+		assert.Equal(t, "/recordings/id/"+first, dto[0].URI)
+		assert.True(t, dto[0].Start.Equal(start))
+		assert.True(t, dto[0].End.Equal(start.Add(time.Hour)))
+		assert.Equal(t, int64(80), dto[0].Size)
+
+		for _, path := range []string{"/recordings/unknown", "/recordings/..", "/recordings/id/..", "/recordings/id/missing.mp4"} {
+			res, err := http.Get(server.URL + path)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusNotFound, res.StatusCode, path)
+		}
+	})
+
+	t.Run("Should serve the recorded files with ranges", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/recordings/id/%s", server.URL, second), nil)
+		assert.Nil(t, err)
+		req.Header.Set("Range", "bytes=40-")
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+		assert.Equal(t, "video/mp4", res.Header.Get("Content-Type"))
+		b, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, box("moof", 32), b)
+	})
+
+	t.Run("Should stitch the recordings of the time window into a playlist", func(t *testing.T) {
+		res, err := http.Get(fmt.Sprintf("%s/recordings/id/playlist.m3u8", server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		b, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		playlist := string(b)
+		assert.Contains(t, playlist, "#EXT-X-TARGETDURATION:3600\n")
+		assert.Contains(t, playlist, fmt.Sprintf("#EXT-X-MAP:URI=\"%s\",BYTERANGE=\"40@0\"\n#EXTINF:3600.000,\n#EXT-X-BYTERANGE:40@40\n%s\n", first, first))
+		assert.Contains(t, playlist, "#EXT-X-DISCONTINUITY\n")
+		assert.Contains(t, playlist, "#EXT-X-ENDLIST\n")
+
+		query := url.Values{"from": {start.Add(time.Hour * 90 / 60).Format(time.RFC3339)}}
+		res, err = http.Get(fmt.Sprintf("%s/recordings/id/playlist.m3u8?%s", server.URL, query.Encode()))
+		assert.Nil(t, err)
+		b, err = ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.NotContains(t, string(b), first)
+		assert.Contains(t, string(b), second)
+		assert.NotContains(t, string(b), "#EXT-X-DISCONTINUITY")
+
+		res, err = http.Get(fmt.Sprintf("%s/recordings/id/playlist.m3u8?from=yesterday", server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Should delete the recordings of stopped streams if it is requested", func(t *testing.T) {
+		stop := func(id, query string) int {
+			req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/stream/%s%s", server.URL, id, query), nil)
+			assert.Nil(t, err)
+			res, err := http.DefaultClient.Do(req)
+			assert.Nil(t, err)
+			return res.StatusCode
+		}
+		register := func(id string) {
+			generated := generateStream(nil, "")
+			generated.strm.KeepFiles = true
+			generated.strm.RecordingDir = dir
+			ctrls.setStream(id, &generated.strm)
+		}
+		register("id")
+		assert.Equal(t, http.StatusOK, stop("id", ""))
+		_, err := os.Stat(dir)
+		assert.Nil(t, err)
+
+		register("id")
+		assert.Equal(t, http.StatusBadRequest, stop("id", "?keepRecordings=maybe"))
+		assert.Equal(t, http.StatusOK, stop("id", "?keepRecordings=false"))
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
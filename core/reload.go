@@ -0,0 +1,208 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/Roverr/rtsp-stream/core/access"
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/webhooks"
+	"github.com/julienschmidt/httprouter"
+)
+
+// hotKeys are the settings, or the prefixes of the groups of settings, that can be changed without a restart
+var hotKeys = []string{"DEBUG", "CLEANUP_TIME", "STREAK_", "RATE_LIMIT_", "AUTH_", "WEBHOOK_", "ACCESS_", "SOURCE_"}
+
+// settings describes the configuration of the controller and the helpers created from it.
+// They are replaced together when the configuration is reloaded, so the handlers never see a mix of the two
+type settings struct {
+	spec    *config.Specification
+	jwt     auth.JWT
+	signer  *auth.URLSigner
+	limiter *rateLimiter
+	basic   *auth.BasicAuth
+	keys    *auth.APIKeys
+	access  *access.Policy
+	sources *access.Sources
+}
+
+// ReloadDto describes the outcome of a reload of the configuration
+type ReloadDto struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requiresRestart"`
+}
+
+// current returns the settings in use
+func (c *Controller) current() *settings {
+	return c.settings.Load().(*settings)
+}
+
+// spec returns the configuration in use
+func (c *Controller) spec() *config.Specification {
+	return c.current().spec
+}
+
+// jwt returns the JWT provider of the configuration in use
+func (c *Controller) jwt() auth.JWT {
+	return c.current().jwt
+}
+
+// signer returns the URL signer of the configuration in use
+func (c *Controller) signer() *auth.URLSigner {
+	return c.current().signer
+}
+
+// limiter returns the rate limiter of the configuration in use, nil if limiting is disabled
+func (c *Controller) limiter() *rateLimiter {
+	return c.current().limiter
+}
+
+// setSpec replaces the configuration in use, keeping the helpers created from the previous one
+func (c *Controller) setSpec(spec *config.Specification) {
+	next := *c.current()
+	next.spec = spec
+	c.settings.Store(&next)
+}
+
+// isHotKey indicates if the setting can be changed without a restart
+func isHotKey(key string) bool {
+	for _, hot := range hotKeys {
+		if key == hot || (strings.HasSuffix(hot, "_") && strings.HasPrefix(key, hot)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload applies the settings of the given configuration that can change at runtime: the log level, the interval of
+// the cleanup, the rate limits, the authentication, the webhooks, the access lists and the source lists. The rest is kept until the next restart,
+// running streams keep their own options either way. Returns the keys that were applied and the ones that were not
+func (c *Controller) Reload(next *config.Specification) (ReloadDto, error) {
+	c.reloadMux.Lock()
+	defer c.reloadMux.Unlock()
+	current := c.current()
+	result := ReloadDto{[]string{}, []string{}}
+	for _, key := range config.Diff(current.spec, next) {
+		if isHotKey(key) {
+			result.Applied = append(result.Applied, key)
+			continue
+		}
+		result.RequiresRestart = append(result.RequiresRestart, key)
+		c.log.Warnf("%s has changed, it requires restart to be applied", key)
+	}
+
+	spec := *current.spec
+	spec.Debug = next.Debug
+	spec.CleanupTime = next.CleanupTime
+	spec.RateLimit = next.RateLimit
+	spec.Auth = next.Auth
+	spec.Webhooks = next.Webhooks
+	spec.Access = next.Access
+	spec.Sources = next.Sources
+	updated := &settings{&spec, current.jwt, current.signer, current.limiter, current.basic, current.keys, current.access, current.sources}
+	if !reflect.DeepEqual(spec.Auth, current.spec.Auth) {
+		provider, err := auth.NewJWTProvider(spec.Auth)
+		if err != nil {
+			return ReloadDto{}, err
+		}
+		keys, err := auth.NewAPIKeys(spec.Auth)
+		if err != nil {
+			return ReloadDto{}, err
+		}
+		updated.jwt = provider
+		updated.signer = auth.NewURLSigner(spec.Auth)
+		updated.basic = auth.NewBasicAuth(spec.Auth)
+		updated.keys = keys
+	}
+	if !reflect.DeepEqual(spec.Access, current.spec.Access) {
+		policy, err := access.NewPolicy(spec.Access)
+		if err != nil {
+			return ReloadDto{}, err
+		}
+		updated.access = policy
+	}
+	if !reflect.DeepEqual(spec.Sources, current.spec.Sources) {
+		sources, err := access.NewSources(spec.Sources)
+		if err != nil {
+			return ReloadDto{}, err
+		}
+		updated.sources = sources
+	}
+	// The buckets are only reset if the limits change
+	if spec.RateLimit != current.spec.RateLimit {
+		updated.limiter = newRateLimiter(spec.RateLimit)
+	}
+	c.settings.Store(updated)
+
+	setLogLevel(&spec)
+	if spec.CleanupTime != current.spec.CleanupTime {
+		select {
+		case c.cleanupReset <- struct{}{}:
+		default:
+		}
+	}
+	if !webhooksEqual(spec.Webhooks, current.spec.Webhooks) {
+		c.notifyWebhooks()
+	}
+	if len(result.Applied) > 0 {
+		c.log.Infof("Configuration is reloaded, applied %s", strings.Join(result.Applied, ", "))
+	}
+	return result, nil
+}
+
+// webhooksEqual indicates if the two configurations of the webhooks are the same
+func webhooksEqual(a, b config.Webhooks) bool {
+	return strings.Join(a.WebhookURLs, ",") == strings.Join(b.WebhookURLs, ",") &&
+		a.WebhookSecret == b.WebhookSecret &&
+		a.WebhookTimeout == b.WebhookTimeout &&
+		a.WebhookAttempts == b.WebhookAttempts &&
+		a.WebhookBackoff == b.WebhookBackoff
+}
+
+// ReloadFromSource reads the configuration again from the environment and the file it was loaded from, then reloads it.
+// The command-line flags cannot change, so their values are applied again
+func (c *Controller) ReloadFromSource() (ReloadDto, error) {
+	next, err := config.Load(c.spec().ConfigFile, c.spec().Flags)
+	if err != nil {
+		return ReloadDto{}, err
+	}
+	return c.Reload(next)
+}
+
+// ReloadHandler is the HTTP handler of the /admin/reload call, which reloads the configuration at runtime
+func (c *Controller) ReloadHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	result, err := c.ReloadFromSource()
+	if err != nil {
+		c.logger(r.Context()).Errorf("Configuration could not be reloaded || Error: %s", err)
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// notifyWebhooks starts delivering the events to the webhooks on a worker goroutine, if there is any configured.
+// The deliveries of the previous configuration stop once their queued events are sent
+func (c *Controller) notifyWebhooks() {
+	if c.webhooks != nil {
+		c.events.Unsubscribe(c.webhooks)
+		c.webhooks = nil
+	}
+	notifier := webhooks.NewNotifier(c.spec().Webhooks)
+	if !notifier.Enabled() {
+		return
+	}
+	c.webhooks = c.events.Subscribe()
+	go notifier.Run(c.webhooks, c.done)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestIsHotKey(t *testing.T) {
+	tt := []struct {
+		Key      string
+		Expected bool
+	}{
+		{"DEBUG", true},
+		{"CLEANUP_TIME", true},
+		{"STREAK_HOT_WAIT", true},
+		{"RATE_LIMIT_CLIENT_RATE", true},
+		{"AUTH_JWT_SECRET", true},
+		{"WEBHOOK_URLS", true},
+		{"ACCESS_MANAGEMENT_ALLOW", true},
+		{"SOURCE_ALLOW", true},
+		{"DEBUGGER", false},
+		{"STORE_DIR", false},
+		{"HLS_TIME", false},
+	}
+	for i, testCase := range tt {
+		if isHotKey(testCase.Key) != testCase.Expected {
+			t.Error(fmt.Errorf("%d testcase is failing for TestIsHotKey", i))
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	t.Run("Should apply the settings that can change at runtime", func(t *testing.T) {
+		conf := *config.InitConfig()
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		jwt := ctrls.jwt()
+
+		next := conf
+		next.Debug = true
+		next.CleanupTime = time.Second
+		next.RateLimit.Enabled = true
+		next.JWTSecret = "changed"
+		next.HLSTime = 4
+		next.StoreDir = "./elsewhere"
+		result, err := ctrls.Reload(&next)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"AUTH_JWT_SECRET", "CLEANUP_TIME", "DEBUG", "RATE_LIMIT_ENABLED"}, result.Applied)
+		assert.Equal(t, []string{"HLS_TIME", "STORE_DIR"}, result.RequiresRestart)
+
+		spec := ctrls.spec()
+		assert.Equal(t, time.Second, spec.CleanupTime)
+		assert.Equal(t, "changed", spec.JWTSecret)
+		assert.Equal(t, 1, spec.HLSTime)
+		assert.Equal(t, conf.StoreDir, spec.StoreDir)
+		assert.NotNil(t, ctrls.limiter())
+		assert.NotEqual(t, jwt, ctrls.jwt())
+		assert.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+		assert.Len(t, ctrls.cleanupReset, 1)
+
+		// Unchanged limits keep their buckets
+		limiter := ctrls.limiter()
+		result, err = ctrls.Reload(&next)
+		assert.Nil(t, err)
+		assert.Empty(t, result.Applied)
+		assert.True(t, limiter == ctrls.limiter())
+	})
+
+	t.Run("Should restart the webhooks with their new configuration", func(t *testing.T) {
+		conf := *config.InitConfig()
+		// The event log is a subscriber of its own, only the webhooks are counted
+		conf.EventLogSize = 0
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		ctrls.notifyWebhooks()
+		assert.Equal(t, 0, ctrls.events.Subscribers())
+
+		next := conf
+		next.WebhookURLs = []string{"http://hooks.local/rtsp"}
+		_, err := ctrls.Reload(&next)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, ctrls.events.Subscribers())
+		subscription := ctrls.webhooks
+
+		next.WebhookAttempts = 1
+		_, err = ctrls.Reload(&next)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, ctrls.events.Subscribers())
+		assert.False(t, subscription == ctrls.webhooks)
+
+		next.WebhookURLs = nil
+		_, err = ctrls.Reload(&next)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, ctrls.events.Subscribers())
+	})
+
+	t.Run("Should keep the configuration if the authentication cannot be created", func(t *testing.T) {
+		conf := *config.InitConfig()
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+
+		next := conf
+		next.JWTMethod = "rsa"
+		next.JWTPubKeyPath = "./missing.pub"
+		next.CleanupTime = time.Second
+		_, err := ctrls.Reload(&next)
+		assert.NotNil(t, err)
+		assert.Equal(t, "secret", ctrls.spec().JWTMethod)
+		assert.Equal(t, conf.CleanupTime, ctrls.spec().CleanupTime)
+	})
+}
+
+func TestReloadHandler(t *testing.T) {
+	conf := *config.InitConfig()
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	defer ctrls.Shutdown(context.Background())
+
+	assert.Nil(t, os.Setenv("RTSP_STREAM_CLEANUP_TIME", "30s"))
+	defer os.Unsetenv("RTSP_STREAM_CLEANUP_TIME")
+	rr := httptest.NewRecorder()
+	ctrls.ReloadHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reload", nil), nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result ReloadDto
+	assert.Nil(t, json.NewDecoder(rr.Body).Decode(&result))
+	assert.Equal(t, ReloadDto{[]string{"CLEANUP_TIME"}, []string{}}, result)
+	assert.Equal(t, 30*time.Second, ctrls.spec().CleanupTime)
+
+	// Invalid configurations are refused as a whole
+	assert.Nil(t, os.Setenv("RTSP_STREAM_CLEANUP_TIME", "1m"))
+	assert.Nil(t, os.Setenv("RTSP_STREAM_HLS_TIME", "0"))
+	defer os.Unsetenv("RTSP_STREAM_HLS_TIME")
+	rr = httptest.NewRecorder()
+	ctrls.ReloadHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reload", nil), nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var errDto ErrorDto
+	assert.Nil(t, json.NewDecoder(rr.Body).Decode(&errDto))
+	assert.Equal(t, ErrorBodyDto{"invalid_request", "Invalid configuration of HLS_TIME: 0 has to be between 1 and 60", ""}, errDto.Error)
+	assert.Equal(t, 30*time.Second, ctrls.spec().CleanupTime)
+}
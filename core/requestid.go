@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// RequestIDHeader is the header carrying the id of the request, the incoming one is kept if it is valid
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the key of the id of the request in its context
+type requestIDKey struct{}
+
+// requestIDPattern matches the incoming ids that are kept, they have to be short and URL safe
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{1,128}$`)
+
+// newRequestID generates a new id of 16 URL safe characters from 96 random bits
+func newRequestID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		logrus.Error(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of the context carrying the id of the request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the id of the request carried by the context, empty if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID is the middleware giving every request an id. The id of the X-Request-ID header is kept if it is valid,
+// a new one is generated otherwise. The id is carried by the context of the request and echoed in the response header,
+// so the logs, the error bodies and the events of the request can be correlated. It is applied by Handler
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// logger returns the logger of the request, its entries carry the id of the request if it has one
+func (c *Controller) logger(ctx context.Context) logrus.FieldLogger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return c.log.WithField("requestId", id)
+	}
+	return c.log
+}
+
+// streamLog returns the logger of the background work of the stream, its entries carry the id
+// of the request that started the stream if it has one
+func (c *Controller) streamLog(strm *streaming.Stream) logrus.FieldLogger {
+	if strm.RequestID != "" {
+		return c.log.WithField("requestId", strm.RequestID)
+	}
+	return c.log
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+)
+
+func TestRequestID(t *testing.T) {
+	tt := []struct {
+		Incoming string
+		Kept     bool
+	}{
+		{Incoming: "8f2c1d9e-4b7a-4e21-9c3f-2d6b8a1e5f70", Kept: true},
+		{Incoming: "frontend.1234_abc~x", Kept: true},
+		{Incoming: "", Kept: false},
+		{Incoming: "has space", Kept: false},
+		{Incoming: "line\nbreak", Kept: false},
+		{Incoming: "<script>", Kept: false},
+		{Incoming: strings.Repeat("a", 129), Kept: false},
+	}
+	for i, testCase := range tt {
+		var id string
+		handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id = RequestIDFromContext(r.Context())
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/list", nil)
+		req.Header.Set(RequestIDHeader, testCase.Incoming)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		expected := testCase.Incoming
+		if !testCase.Kept {
+			expected = id
+			assert.Regexp(t, "^[A-Za-z0-9_-]{16}$", id)
+		}
+		if !assert.Equal(t, expected, id) || !assert.Equal(t, id, rr.Header().Get(RequestIDHeader)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestRequestID", i))
+		}
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	t.Run("Should generate different URL safe ids", func(t *testing.T) {
+		seen := map[string]bool{}
+		for i := 0; i < 1000; i++ {
+			id := newRequestID()
+			assert.Regexp(t, "^[A-Za-z0-9_-]{16}$", id)
+			assert.False(t, seen[id])
+			seen[id] = true
+		}
+	})
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	t.Run("Should embed the id of the request in the error body", func(t *testing.T) {
+		ctrls := NewController(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/status/unknown", nil)
+		req.Header.Set(RequestIDHeader, "status-check-1")
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, req)
+		var errDto ErrorDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &errDto))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "status-check-1", errDto.Error.RequestID)
+		assert.Equal(t, "status-check-1", rr.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Should carry the id of the start in its logs and events", func(t *testing.T) {
+		var output bytes.Buffer
+		logger := logrus.New()
+		logger.SetOutput(&output)
+		logger.Formatter = &logrus.JSONFormatter{}
+		ctrls := NewController(config.InitConfig(), WithLogger(logger), WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		sub := ctrls.events.Subscribe()
+		defer ctrls.events.Unsubscribe(sub)
+
+		b, _ := json.Marshal(StreamDto{URI: generateURI()})
+		req := newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b))
+		req.Header.Set(RequestIDHeader, "start-42")
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "start-42", rr.Header().Get(RequestIDHeader))
+		select {
+		case event := <-sub.Events():
+			assert.Equal(t, events.Started, event.Type)
+			assert.Equal(t, "start-42", event.RequestID)
+		case <-time.After(time.Second):
+			t.Error("Started event is not published")
+		}
+		for _, strm := range ctrls.snapshotStreams() {
+			assert.Equal(t, "start-42", strm.RequestID)
+		}
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		assert.NotEmpty(t, lines)
+		for _, line := range lines {
+			var entry map[string]interface{}
+			assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+			assert.Equal(t, "start-42", entry["requestId"], line)
+		}
+	})
+}
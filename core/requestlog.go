@@ -0,0 +1,123 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/sirupsen/logrus"
+)
+
+// streamPaths are the first elements of the paths that name a stream with their second element
+var streamPaths = map[string]bool{"stream": true, "status": true, "health": true, "restart": true, "snapshot": true, "recordings": true, "keys": true}
+
+// newRequestLogger creates the logger of the requests, writing entries in the configured format to the standard output.
+// Its level is debug, the middleware drops the debug entries itself unless the debug logging is turned on
+func newRequestLogger(spec config.RequestLog) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = os.Stdout
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(redactingHook{})
+	if spec.RequestLogFormat == "json" {
+		logger.Formatter = &logrus.JSONFormatter{}
+	}
+	return logger
+}
+
+// WithRequestLogger sets the logger of the requests, by default they are written to the standard output in the configured format
+func WithRequestLogger(logger logrus.FieldLogger) Option {
+	return func(c *Controller) {
+		c.requestLog = logger
+	}
+}
+
+// requestStreamID returns the id of the stream the path is about, empty if it is not about a single stream
+func requestStreamID(p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) < 2 || !streamPaths[parts[0]] {
+		return ""
+	}
+	return parts[1]
+}
+
+// requestLevel returns the level of the first pattern matching the path, info if there is none.
+// Patterns without a slash are matched against the last element of the path, like *.ts
+func requestLevel(levels []config.PathLevel, p string) string {
+	for _, level := range levels {
+		target := p
+		if !strings.Contains(level.Pattern, "/") {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(level.Pattern, target); ok {
+			return level.Level
+		}
+	}
+	return "info"
+}
+
+// RequestLogger returns the middleware logging every request with its method, path, status, size, latency,
+// client address and the stream it is about. The responses are not buffered, only their status and size are recorded.
+// It is applied by Handler if the request log is enabled, services mounting the routes themselves can use it directly
+func (c *Controller) RequestLogger() Middleware {
+	segments := uint64(0)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started := c.now()
+			// The handlers of the files rewrite the path of the request
+			method, requestPath := r.Method, r.URL.Path
+			recorder := &ResponseWriter{w, 0, 0}
+			next.ServeHTTP(recorder, r)
+			c.logRequest(r, method, requestPath, recorder, c.now().Sub(started), &segments)
+		})
+	}
+}
+
+// logRequest writes the entry of the request on the level of its path. Only every n-th segment request is logged
+// if sampling is configured, the counter of the segments is shared by the requests of the middleware
+func (c *Controller) logRequest(r *http.Request, method, requestPath string, w *ResponseWriter, latency time.Duration, segments *uint64) {
+	spec := c.spec()
+	levels, _ := spec.ParseRequestLogLevels()
+	level := requestLevel(levels, requestPath)
+	if level == "off" || (level == "debug" && !spec.Debug) {
+		return
+	}
+	if every := uint64(spec.RequestLogSegmentEvery); every > 1 && isSegment(requestPath) && (atomic.AddUint64(segments, 1)-1)%every != 0 {
+		return
+	}
+	status := w.Status()
+	if status == 0 {
+		// Nothing was written, the server answers with 200
+		status = http.StatusOK
+	}
+	fields := logrus.Fields{
+		"method":    method,
+		"path":      requestPath,
+		"status":    status,
+		"bytes":     w.Written(),
+		"latencyMs": float64(latency) / float64(time.Millisecond),
+		"ip":        c.clientAddress(r),
+	}
+	if id := requestStreamID(requestPath); id != "" {
+		fields["stream"] = id
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		fields["requestId"] = id
+	}
+	entry := c.requestLog.WithFields(fields)
+	message := fmt.Sprintf("%s %s %d", method, requestPath, status)
+	switch level {
+	case "debug":
+		entry.Debug(message)
+	case "warn":
+		entry.Warn(message)
+	case "error":
+		entry.Error(message)
+	default:
+		entry.Info(message)
+	}
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestRequestStreamID(t *testing.T) {
+	tt := []struct {
+		Path string
+		ID   string
+	}{
+		{Path: "/stream/front-door/index.m3u8", ID: "front-door"},
+		{Path: "/stream/front-door/720p/3.ts", ID: "front-door"},
+		{Path: "/status/front-door", ID: "front-door"},
+		{Path: "/recordings/front-door/1.mp4", ID: "front-door"},
+		{Path: "/start", ID: ""},
+		{Path: "/list", ID: ""},
+		{Path: "/stream", ID: ""},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.ID, requestStreamID(testCase.Path)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestRequestStreamID", i))
+		}
+	}
+}
+
+func TestRequestLevel(t *testing.T) {
+	levels := []config.PathLevel{{Pattern: "*.ts", Level: "debug"}, {Pattern: "/health", Level: "off"}, {Pattern: "/stream/*/index.m3u8", Level: "warn"}}
+	tt := []struct {
+		Path  string
+		Level string
+	}{
+		{Path: "/stream/front-door/3.ts", Level: "debug"},
+		{Path: "/stream/front-door/720p/3.ts", Level: "debug"},
+		{Path: "/health", Level: "off"},
+		{Path: "/health/front-door", Level: "info"},
+		{Path: "/stream/front-door/index.m3u8", Level: "warn"},
+		{Path: "/stream/front-door/720p/index.m3u8", Level: "info"},
+		{Path: "/start", Level: "info"},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Level, requestLevel(levels, testCase.Path)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestRequestLevel", i))
+		}
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	setup := func(change func(spec *config.Specification)) (*Controller, *bytes.Buffer) {
+		spec := *config.InitConfig()
+		spec.RequestLogEnabled = true
+		change(&spec)
+		var output bytes.Buffer
+		logger := logrus.New()
+		logger.Out = &output
+		logger.Formatter = &logrus.JSONFormatter{}
+		logger.SetLevel(logrus.DebugLevel)
+		ctrls := NewController(&spec, WithFileServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("segment"))
+		})), WithRequestLogger(logger))
+		return ctrls, &output
+	}
+	entries := func(output *bytes.Buffer) []map[string]interface{} {
+		result := []map[string]interface{}{}
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			entry := map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal(scanner.Bytes(), &entry))
+			result = append(result, entry)
+		}
+		return result
+	}
+	serve := func(ctrls *Controller, path string, header http.Header) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "10.0.0.1:5000"
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		ctrls.Handler().ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	t.Run("Should log every request with its fields", func(t *testing.T) {
+		ctrls, output := setup(func(spec *config.Specification) { spec.TrustedProxies = []string{"10.0.0.0/8"} })
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		ctrls.streams[generated.dirPath] = &generated.strm
+		serve(ctrls, "/capacity", http.Header{"X-Forwarded-For": {"203.0.113.9"}})
+		serve(ctrls, "/stream/"+generated.dirPath+"/0.ts", nil)
+		serve(ctrls, "/status/unknown", nil)
+		logged := entries(output)
+		if assert.Len(t, logged, 3) {
+			assert.Equal(t, "GET /capacity 200", logged[0]["msg"])
+			assert.Equal(t, "info", logged[0]["level"])
+			assert.Equal(t, "GET", logged[0]["method"])
+			assert.Equal(t, float64(200), logged[0]["status"])
+			assert.Equal(t, float64(len(`{"running":0,"maxStreams":0,"queued":0}`)), logged[0]["bytes"])
+			assert.Equal(t, "203.0.113.9", logged[0]["ip"])
+			assert.NotContains(t, logged[0], "stream")
+			assert.Contains(t, logged[0], "latencyMs")
+			assert.Equal(t, "/stream/"+generated.dirPath+"/0.ts", logged[1]["path"])
+			assert.Equal(t, generated.dirPath, logged[1]["stream"])
+			assert.Equal(t, "10.0.0.1", logged[1]["ip"])
+			assert.Equal(t, float64(http.StatusNotFound), logged[2]["status"])
+			assert.Equal(t, "unknown", logged[2]["stream"])
+		}
+	})
+
+	t.Run("Should only log every n-th segment request", func(t *testing.T) {
+		ctrls, output := setup(func(spec *config.Specification) { spec.RequestLogSegmentEvery = 3 })
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		ctrls.streams[generated.dirPath] = &generated.strm
+		handler := ctrls.Handler()
+		for i := 0; i < 7; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/stream/%s/%d.ts", generated.dirPath, i), nil))
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/capacity", nil))
+		paths := []string{}
+		for _, entry := range entries(output) {
+			paths = append(paths, entry["path"].(string))
+		}
+		assert.Equal(t, []string{
+			"/stream/" + generated.dirPath + "/0.ts",
+			"/stream/" + generated.dirPath + "/3.ts",
+			"/stream/" + generated.dirPath + "/6.ts",
+			"/capacity",
+		}, paths)
+	})
+
+	t.Run("Should log on the level of the path", func(t *testing.T) {
+		ctrls, output := setup(func(spec *config.Specification) {
+			spec.RequestLogLevels = []string{"*.ts:debug", "/capacity:off", "/status/*:warn"}
+		})
+		defer ctrls.Shutdown(context.Background())
+		serve(ctrls, "/stream/id/0.ts", nil)
+		serve(ctrls, "/capacity", nil)
+		serve(ctrls, "/status/id", nil)
+		logged := entries(output)
+		if assert.Len(t, logged, 1) {
+			assert.Equal(t, "warning", logged[0]["level"])
+		}
+
+		// The debug entries are only written with the debug logging
+		ctrls, output = setup(func(spec *config.Specification) {
+			spec.Debug, spec.RequestLogLevels = true, []string{"*.ts:debug"}
+		})
+		defer ctrls.Shutdown(context.Background())
+		serve(ctrls, "/stream/id/0.ts", nil)
+		logged = entries(output)
+		if assert.Len(t, logged, 1) {
+			assert.Equal(t, "debug", logged[0]["level"])
+		}
+	})
+
+	t.Run("Should not log without the request log", func(t *testing.T) {
+		ctrls, output := setup(func(spec *config.Specification) { spec.RequestLogEnabled = false })
+		defer ctrls.Shutdown(context.Background())
+		serve(ctrls, "/capacity", nil)
+		assert.Empty(t, strings.TrimSpace(output.String()))
+	})
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/metrics"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// resourceLoop samples the resource usage of the transcoding processes until the service is shut down.
+// Every process is sampled by this single loop, it does not run if the sampling is turned off
+func (c *Controller) resourceLoop() {
+	interval := c.spec().ProcessSampleInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sampleResources()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// sampleResources samples the resource usage of the running transcoding processes. The processes can exit
+// between being looked up and being sampled, so the failed samples are only logged for debugging
+func (c *Controller) sampleResources() {
+	now := time.Now()
+	for id, strm := range c.snapshotStreams() {
+		if strm.Usage == nil {
+			continue
+		}
+		pid := strm.Pid()
+		if pid == 0 {
+			strm.Usage.Reset()
+			continue
+		}
+		if err := strm.Usage.Sample(pid, now); err != nil {
+			c.streamLog(strm).Debugf("Resource usage of %s could not be sampled || Error: %v", id, err)
+		}
+	}
+}
+
+// resourcesOf returns the resource usage of the running transcoding of the stream, nil if it is not running or not sampled
+func resourcesOf(strm *streaming.Stream) *streaming.Resources {
+	if strm.Usage == nil || strm.Pid() == 0 {
+		return nil
+	}
+	resources := strm.Usage.Get()
+	return &resources
+}
+
+// usageMetrics returns the resource usage of the running transcoding of the streams for the metrics
+func usageMetrics(streams map[string]*streaming.Stream) map[string]metrics.Usage {
+	usage := map[string]metrics.Usage{}
+	for id, strm := range streams {
+		if resources := resourcesOf(strm); resources != nil {
+			usage[id] = metrics.Usage{
+				CPUPercent:  resources.CPUPercent,
+				RSSBytes:    float64(resources.RSSBytes),
+				EncodeFPS:   resources.EncodeFPS,
+				EncodeSpeed: resources.EncodeSpeed,
+			}
+		}
+	}
+	return usage
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestResources(t *testing.T) {
+	t.Run("Should show the resource usage of the running transcoding", func(t *testing.T) {
+		spec := config.InitConfig()
+		spec.ListEndpoint = true
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		cmd := exec.Command("sleep", "10")
+		process, err := streaming.StartCommand(cmd)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer process.Kill()
+		generated := generateStream(nil, "")
+		generated.strm.Streak.Activate()
+		generated.strm.Process = process
+		generated.strm.Usage = streaming.NewResourceUsage()
+		generated.strm.Usage.Progress().Write([]byte("fps=25.00\nspeed=1.01x\n"))
+		ctrls.streams[generated.dirPath] = &generated.strm
+		ctrls.sampleResources()
+
+		rr := httptest.NewRecorder()
+		ctrls.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status/"+generated.dirPath, nil), httprouter.Params{{Key: "id", Value: generated.dirPath}})
+		var status StatusDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		if assert.NotNil(t, status.Resources) {
+			assert.Equal(t, 25.0, status.Resources.EncodeFPS)
+			assert.Equal(t, 1.01, status.Resources.EncodeSpeed)
+		}
+
+		// The usage is only listed in the verbose mode
+		for _, verbose := range []bool{false, true} {
+			rr = httptest.NewRecorder()
+			ctrls.ListStreamHandler(rr, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/list?verbose=%t", verbose), nil), nil)
+			var list []SummariseDto
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &list))
+			if assert.Len(t, list, 1) {
+				assert.Equal(t, verbose, list[0].Resources != nil)
+			}
+		}
+
+		rr = httptest.NewRecorder()
+		ctrls.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil), nil)
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf("rtsp_stream_encode_fps{stream=%q} 25\n", generated.dirPath))
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf("rtsp_stream_rss_bytes{stream=%q} ", generated.dirPath))
+
+		// The usage of the exited process is forgotten
+		process.Kill()
+		process.Wait()
+		ctrls.sampleResources()
+		assert.Equal(t, streaming.Resources{}, generated.strm.Usage.Get())
+		rr = httptest.NewRecorder()
+		ctrls.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status/"+generated.dirPath, nil), httprouter.Params{{Key: "id", Value: generated.dirPath}})
+		status = StatusDto{}
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		assert.Nil(t, status.Resources)
+	})
+
+	t.Run("Should refuse an invalid verbose mode", func(t *testing.T) {
+		_, _, err := parseListQuery(map[string][]string{"verbose": {"maybe"}})
+		assert.Equal(t, ErrInvalidListQuery, err)
+		query, paged, err := parseListQuery(map[string][]string{"verbose": {"true"}})
+		assert.Nil(t, err)
+		assert.True(t, query.verbose)
+		assert.False(t, paged)
+	})
+}
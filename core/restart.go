@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// RestartHandler is the HTTP handler of the POST /restart/:id call, which stops the transcoding of the stream
+// and starts it again. The files of the stream are kept unless they are wiped with ?wipe=true.
+// Only one restart of a stream can be in progress, the concurrent ones are refused
+func (c *Controller) RestartHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	wipe := false
+	if value := r.URL.Query().Get("wipe"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.SendError(w, ErrInvalidWipe, http.StatusBadRequest)
+			return
+		}
+		wipe = parsed
+	}
+	dto, status, err := c.restartStream(r.Context(), id, wipe)
+	if err != nil {
+		c.SendError(w, err, status)
+		return
+	}
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// restartStream restarts the transcoding of the stream requested by the request of the context, wiping its files first if asked to.
+// Returns the stream, or the status of the response and the error sent with it if the stream could not be restarted
+func (c *Controller) restartStream(ctx context.Context, id string, wipe bool) (StreamDto, int, error) {
+	return c.restartWith(ctx, id, wipe, "manual", nil)
+}
+
+// restartWith restarts the transcoding of the stream like restartStream, the change is applied to the stream once its process stopped.
+// The change returns the function that reverts it, the stream keeps what it had if it cannot be restarted with the change,
+// its transcoding is restarted without the change then and it is errored if that fails too.
+// The restarted event is published with the reason as its details
+func (c *Controller) restartWith(ctx context.Context, id string, wipe bool, reason string, change func(strm *streaming.Stream) func()) (StreamDto, int, error) {
+	strm, ok := c.getStream(id)
+	if !ok {
+		return StreamDto{}, http.StatusNotFound, ErrNoStreamFn(id)
+	}
+	if strm.IsDisabled() {
+		return StreamDto{}, http.StatusConflict, ErrStreamDisabled
+	}
+	if strm.IsPaused() {
+		return StreamDto{}, http.StatusConflict, ErrStreamPaused
+	}
+	if !c.restarting.begin(id) {
+		return StreamDto{}, http.StatusConflict, ErrStreamAlreadyActive
+	}
+	defer c.restarting.end(id)
+	if !c.spawns.enter() {
+		return StreamDto{}, http.StatusServiceUnavailable, ErrStoppingAll
+	}
+	defer c.spawns.leave()
+
+	c.logger(ctx).Infof("%s is getting restarted%s", id, requestedBy(apiKeyFromContext(ctx)))
+	stopCtx, cancel := context.WithTimeout(ctx, c.spec().ShutdownGrace)
+	defer cancel()
+	if err := strm.Stop(stopCtx, true); err != nil {
+		c.logger(ctx).Error(err)
+	}
+	if wipe {
+		strm.ClearFiles()
+	}
+	var revert func()
+	if change != nil {
+		revert = change(strm)
+	}
+	strm.ResetErrored()
+	if err := c.processor.Restart(strm, id); err != nil {
+		c.logger(ctx).Error(err)
+		if revert != nil {
+			revert()
+			c.relaunch(ctx, id, strm)
+			c.persist()
+		}
+		return StreamDto{}, http.StatusInternalServerError, ErrRestartFailed
+	}
+	if err := c.issueToken(ctx, id, strm, c.spec().PlaybackRotate); err != nil {
+		c.logger(ctx).Error(err)
+	}
+	c.metrics.Restarted(id)
+	c.publishBy(ctx, events.Restarted, id, strm, reason)
+	c.waitForPlaylist(strm)
+	c.persist()
+	return c.streamDto(ctx, strm, id), http.StatusOK, nil
+}
+
+// relaunch restarts the transcoding of the stream after its change was reverted, so it runs like it did before the change.
+// The stream is errored if it cannot be restarted either
+func (c *Controller) relaunch(ctx context.Context, id string, strm *streaming.Stream) {
+	if err := c.processor.Restart(strm, id); err != nil {
+		reason := err.Error()
+		c.logger(ctx).Errorf("%s is errored, it could not be restarted without the change either || Error: %s", id, reason)
+		strm.Fail(reason)
+		c.publishBy(ctx, events.Errored, id, strm, reason)
+		return
+	}
+	c.logger(ctx).Infof("%s is restarted without the change", id)
+}
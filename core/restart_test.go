@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestRestartHandler(t *testing.T) {
+	setup := func(t *testing.T) (*Controller, generatedStream, *int32, func()) {
+		spawned := int32(0)
+		ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{spawned: &spawned}
+		dir, err := ioutil.TempDir("", "restart")
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U"), 0644))
+		generated := generateStream(nil, "")
+		generated.strm.StorePath = dir
+		ctrls.streams = map[string]*streaming.Stream{generated.dirPath: &generated.strm}
+		return ctrls, generated, &spawned, func() {
+			os.RemoveAll(dir)
+			ctrls.Shutdown(context.Background())
+		}
+	}
+	restart := func(ctrls *Controller, id, query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/restart/"+id+query, nil)
+		ctrls.RestartHandler(rr, req, httprouter.Params{{Key: "id", Value: id}})
+		return rr
+	}
+
+	t.Run("Should restart the stream and keep its files", func(t *testing.T) {
+		ctrls, generated, spawned, teardown := setup(t)
+		defer teardown()
+		rr := restart(ctrls, generated.dirPath, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var dto StreamDto
+		assert.Nil(t, json.NewDecoder(rr.Body).Decode(&dto))
+		assert.Equal(t, generated.dirPath, dto.ID)
+		assert.Equal(t, int32(1), atomic.LoadInt32(spawned))
+		assert.True(t, generated.strm.Streak.IsActive())
+		_, err := os.Stat(filepath.Join(generated.strm.StorePath, "index.m3u8"))
+		assert.Nil(t, err)
+	})
+
+	t.Run("Should wipe the files of the stream if it is asked to", func(t *testing.T) {
+		ctrls, generated, _, teardown := setup(t)
+		defer teardown()
+		assert.Equal(t, http.StatusOK, restart(ctrls, generated.dirPath, "?wipe=true").Code)
+		_, err := os.Stat(filepath.Join(generated.strm.StorePath, "index.m3u8"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should refuse the restarts that cannot be done", func(t *testing.T) {
+		ctrls, generated, spawned, teardown := setup(t)
+		defer teardown()
+		assert.Equal(t, http.StatusNotFound, restart(ctrls, "unknown", "").Code)
+		assert.Equal(t, http.StatusBadRequest, restart(ctrls, generated.dirPath, "?wipe=maybe").Code)
+
+		// A restart in progress refuses the concurrent ones
+		assert.True(t, ctrls.restarting.begin(generated.dirPath))
+		rr := restart(ctrls, generated.dirPath, "")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "stream_already_active")
+		ctrls.restarting.end(generated.dirPath)
+		assert.Equal(t, int32(0), atomic.LoadInt32(spawned))
+		assert.Equal(t, http.StatusOK, restart(ctrls, generated.dirPath, "").Code)
+	})
+}
@@ -0,0 +1,324 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+)
+
+// megabyte is the unit of the size limits of the retention
+const megabyte = int64(1024 * 1024)
+
+// StorageDto describes the disk usage of the streams compared to the limits of the retention
+type StorageDto struct {
+	Usage    int64              `json:"usage"`              // Bytes used by the files of every stream
+	Store    int64              `json:"store"`              // Bytes used by the files in the store, compared to its limit
+	Headroom *int64             `json:"headroom,omitempty"` // Bytes left until the total size limit, nil if there is no limit
+	Limits   RetentionDto       `json:"limits"`
+	Streams  []StreamStorageDto `json:"streams"`
+}
+
+// RetentionDto describes the limits of the retention, 0 means no limit
+type RetentionDto struct {
+	StreamSize int64 `json:"streamSize"` // Bytes the files of a stream can use
+	TotalSize  int64 `json:"totalSize"`  // Bytes the files of every stream can use
+	MaxAge     int   `json:"maxAge"`     // Seconds the segments and recordings are kept for
+	StoreSize  int64 `json:"storeSize"`  // Bytes the files in the store can use before new streams are refused
+}
+
+// StreamStorageDto describes the disk usage of a given stream
+type StreamStorageDto struct {
+	ID         string `json:"id"`
+	Segments   int64  `json:"segments"`
+	Recordings int64  `json:"recordings"`
+}
+
+// storedFile describes a segment or a recording stored for a stream
+type storedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	// protected files are never deleted, like playlists and the files referenced by them
+	protected bool
+}
+
+// streamUsage describes the files stored for a given stream
+type streamUsage struct {
+	id         string
+	segments   []storedFile
+	recordings []storedFile
+	window     time.Duration // DVR window of the stream, its segments older than it are deleted by the retention. 0 if it has none
+}
+
+// size returns the number of bytes used by the files of the stream
+func (u streamUsage) size() int64 {
+	return sumSize(u.segments) + sumSize(u.recordings)
+}
+
+// deletable returns the files of the stream that can be deleted, the oldest first
+func (u streamUsage) deletable() []storedFile {
+	files := []storedFile{}
+	for _, file := range append(append([]storedFile{}, u.segments...), u.recordings...) {
+		if !file.protected {
+			files = append(files, file)
+		}
+	}
+	sortByAge(files)
+	return files
+}
+
+// sumSize returns the number of bytes used by the given files
+func sumSize(files []storedFile) int64 {
+	size := int64(0)
+	for _, file := range files {
+		size += file.size
+	}
+	return size
+}
+
+// sortByAge sorts the files, the oldest first
+func sortByAge(files []storedFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+}
+
+// scanSegments returns the files in the directory of a stream. Only segments can be deleted, except the ones
+// referenced by the playlists and the ones written after the last playlist update, which are not listed yet.
+// The init segments of fragmented MP4 streams are needed by every other segment, so they are kept as well.
+// The skipped directories belong to other streams
+func scanSegments(dir string, skipped ...string) []storedFile {
+	files := []storedFile{}
+	referenced := map[string]bool{}
+	lastUpdate := time.Time{}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		// Files can be deleted by the transcoding while walking the directory
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && isOneOf(path, skipped) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if isPlaylist(path) {
+			for _, ref := range streaming.PlaylistReferences(path) {
+				referenced[ref] = true
+			}
+		}
+		if isManifest(path) && info.ModTime().After(lastUpdate) {
+			lastUpdate = info.ModTime()
+		}
+		files = append(files, storedFile{path, info.Size(), info.ModTime(), !isSegment(path) || isInitSegment(path)})
+		return nil
+	})
+	for i, file := range files {
+		if referenced[filepath.Clean(file.path)] || (!lastUpdate.IsZero() && !file.modTime.Before(lastUpdate)) {
+			files[i].protected = true
+		}
+	}
+	return files
+}
+
+// isOneOf indicates if the path is one of the directories
+func isOneOf(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if filepath.Clean(path) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInitSegment is for deciding if the file is the init segment of a fragmented MP4 stream
+func isInitSegment(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), "init-") && filepath.Ext(path) == ".m4s"
+}
+
+// scanRecordings returns the recorded files of a stream. The newest one is
+// protected if the stream is still recording, because it is being written
+func scanRecordings(dir string, recording bool) []storedFile {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return []storedFile{}
+	}
+	files := []storedFile{}
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".mp4" {
+			continue
+		}
+		files = append(files, storedFile{filepath.Join(dir, info.Name()), info.Size(), info.ModTime(), false})
+	}
+	sortByAge(files)
+	if recording && len(files) > 0 {
+		files[len(files)-1].protected = true
+	}
+	return files
+}
+
+// expiredFiles returns the files violating the retention. Files older than the maximum age and the segments older than
+// the DVR window of their stream are deleted first, then the oldest files of the streams above their size limit, then the oldest
+// files of every stream above the total limit
+func expiredFiles(spec config.Retention, usages []streamUsage, now time.Time) []storedFile {
+	expired := []storedFile{}
+	remaining := []storedFile{}
+	total := int64(0)
+	streamLimit := int64(spec.RetentionStreamSize) * megabyte
+	for _, usage := range usages {
+		size := usage.size()
+		for _, file := range usage.deletable() {
+			tooOld := spec.RetentionMaxAge > 0 && now.Sub(file.modTime) > spec.RetentionMaxAge
+			tooOld = tooOld || (usage.window > 0 && isSegment(file.path) && now.Sub(file.modTime) > usage.window)
+			tooLarge := streamLimit > 0 && size > streamLimit
+			if tooOld || tooLarge {
+				expired = append(expired, file)
+				size -= file.size
+				continue
+			}
+			remaining = append(remaining, file)
+		}
+		total += size
+	}
+	totalLimit := int64(spec.RetentionTotalSize) * megabyte
+	if totalLimit <= 0 {
+		return expired
+	}
+	sortByAge(remaining)
+	for _, file := range remaining {
+		if total <= totalLimit {
+			break
+		}
+		expired = append(expired, file)
+		total -= file.size
+	}
+	return expired
+}
+
+// subdirectories returns the names of the directories inside the given one
+func subdirectories(dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return []string{}
+	}
+	names := []string{}
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names
+}
+
+// storePathOf returns the directory the files of the stream are written into, the one named after the id if it is not registered
+func (c *Controller) storePathOf(id string) string {
+	if strm, ok := c.getStream(id); ok && strm.StorePath != "" {
+		return strm.StorePath
+	}
+	return filepath.Join(c.spec().StoreDir, id)
+}
+
+// storageUsage scans the files of the streams in the store and in the recordings directory,
+// including the ones of streams that are not registered anymore
+func (c *Controller) storageUsage() []streamUsage {
+	usages := map[string]*streamUsage{}
+	usageOf := func(id string) *streamUsage {
+		if _, ok := usages[id]; !ok {
+			usages[id] = &streamUsage{id: id}
+		}
+		return usages[id]
+	}
+	// The streams with a layout are written somewhere else than the directory named after them, the other
+	// directories of the store are counted for the streams named after them
+	laidOut := []string{}
+	for id, strm := range c.snapshotStreams() {
+		if strm.LayoutDirectory() != "" && strm.StorePath != "" {
+			usageOf(id).segments = append(usageOf(id).segments, scanSegments(strm.StorePath)...)
+			laidOut = append(laidOut, strm.StorePath)
+		}
+	}
+	for _, id := range subdirectories(c.spec().StoreDir) {
+		if dir := filepath.Join(c.spec().StoreDir, id); !isOneOf(dir, laidOut) {
+			usageOf(id).segments = append(usageOf(id).segments, scanSegments(dir, laidOut...)...)
+		}
+	}
+	for _, id := range subdirectories(c.spec().RecordingsDir) {
+		strm, ok := c.getStream(id)
+		usageOf(id).recordings = scanRecordings(filepath.Join(c.spec().RecordingsDir, id), ok && strm.IsRecording())
+	}
+	result := []streamUsage{}
+	for _, usage := range usages {
+		result = append(result, c.withWindow(*usage))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result
+}
+
+// enforceRetention deletes the oldest segments and recordings of the streams exceeding the limits of the retention.
+// The tracked usage is replaced with the scanned one, then the store is trimmed if it is above its limit
+func (c *Controller) enforceRetention() {
+	usages := c.storageUsage()
+	spec := c.spec().Retention
+	if spec.RetentionStreamSize > 0 || spec.RetentionTotalSize > 0 || spec.RetentionMaxAge > 0 || hasWindow(usages) {
+		expired := expiredFiles(spec, usages, c.now())
+		for _, file := range expired {
+			c.log.Debugf("%s is deleted by the retention", file.path)
+			if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+				c.log.Error(err)
+			}
+		}
+		if len(expired) > 0 {
+			usages = c.storageUsage()
+		}
+	}
+	c.usage.reset(usages)
+	if c.isStoreFull() {
+		c.trimStore()
+	}
+}
+
+// StorageHandler is the HTTP handler of the /storage call describing the disk usage of the streams
+func (c *Controller) StorageHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	spec := c.spec().Retention
+	dto := StorageDto{
+		Limits: RetentionDto{
+			StreamSize: int64(spec.RetentionStreamSize) * megabyte,
+			TotalSize:  int64(spec.RetentionTotalSize) * megabyte,
+			MaxAge:     int(spec.RetentionMaxAge / time.Second),
+			StoreSize:  c.storeLimit(),
+		},
+		Streams: []StreamStorageDto{},
+	}
+	for _, usage := range c.usages() {
+		stream := StreamStorageDto{usage.id, sumSize(usage.segments), sumSize(usage.recordings)}
+		dto.Usage += stream.Segments + stream.Recordings
+		dto.Store += stream.Segments
+		dto.Streams = append(dto.Streams, stream)
+	}
+	if dto.Limits.TotalSize > 0 {
+		headroom := dto.Limits.TotalSize - dto.Usage
+		if headroom < 0 {
+			headroom = 0
+		}
+		dto.Headroom = &headroom
+	}
+	b, err := json.Marshal(dto)
+	if err != nil {
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
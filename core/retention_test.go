@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeAged writes the file with the given size and modification time
+func writeAged(t *testing.T, path string, size int, modTime time.Time) {
+	assert.Nil(t, ioutil.WriteFile(path, make([]byte, size), 0644))
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestScanSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retention")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	writeAged(t, filepath.Join(dir, "init.mp4"), 10, now.Add(-time.Minute*3))
+	writeAged(t, filepath.Join(dir, "0.ts"), 10, now.Add(-time.Minute*3))
+	writeAged(t, filepath.Join(dir, "1.ts"), 10, now.Add(-time.Minute*2))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U\n#EXTINF:1.0,\n1.ts?token=abc\n"), 0644))
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "index.m3u8"), now.Add(-time.Minute), now.Add(-time.Minute)))
+	writeAged(t, filepath.Join(dir, "2.ts"), 10, now)
+
+	protected := map[string]bool{}
+	for _, file := range scanSegments(dir) {
+		protected[filepath.Base(file.path)] = file.protected
+	}
+	assert.Equal(t, map[string]bool{"init.mp4": true, "0.ts": false, "1.ts": true, "2.ts": true, "index.m3u8": true}, protected)
+}
+
+func TestScanDASHSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retention")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	writeAged(t, filepath.Join(dir, "init-0.m4s"), 10, now.Add(-time.Minute*3))
+	writeAged(t, filepath.Join(dir, "chunk-0-00001.m4s"), 10, now.Add(-time.Minute*2))
+	writeAged(t, filepath.Join(dir, "manifest.mpd"), 10, now.Add(-time.Minute))
+	writeAged(t, filepath.Join(dir, "chunk-0-00002.m4s"), 10, now)
+
+	protected := map[string]bool{}
+	for _, file := range scanSegments(dir) {
+		protected[filepath.Base(file.path)] = file.protected
+	}
+	assert.Equal(t, map[string]bool{"init-0.m4s": true, "chunk-0-00001.m4s": false, "chunk-0-00002.m4s": true, "manifest.mpd": true}, protected)
+}
+
+func TestScanRecordings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retention")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	writeAged(t, filepath.Join(dir, "old.mp4"), 10, now.Add(-time.Hour))
+	writeAged(t, filepath.Join(dir, "new.mp4"), 10, now)
+	writeAged(t, filepath.Join(dir, "notes.txt"), 10, now)
+
+	files := scanRecordings(dir, true)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "old.mp4", filepath.Base(files[0].path))
+	assert.False(t, files[0].protected)
+	assert.True(t, files[1].protected)
+	assert.False(t, scanRecordings(dir, false)[1].protected)
+	assert.Len(t, scanRecordings(filepath.Join(dir, "missing"), true), 0)
+}
+
+func TestExpiredFiles(t *testing.T) {
+	now := time.Now()
+	file := func(name string, size int64, age time.Duration, protected bool) storedFile {
+		return storedFile{name, size * megabyte, now.Add(-age), protected}
+	}
+	usages := []streamUsage{
+		{
+			id: "first",
+			segments: []storedFile{
+				file("first/0.ts", 2, time.Hour*3, false),
+				file("first/1.ts", 2, time.Hour, false),
+				file("first/index.m3u8", 1, 0, true),
+			},
+			recordings: []storedFile{file("first/a.mp4", 4, time.Hour*2, false), file("first/b.mp4", 4, 0, true)},
+		},
+		{
+			id:       "second",
+			segments: []storedFile{file("second/0.ts", 3, time.Hour*4, false), file("second/1.ts", 1, 0, true)},
+		},
+	}
+	tt := []struct {
+		Spec     config.Retention
+		Expected []string
+	}{
+		{Spec: config.Retention{}, Expected: []string{}},
+		{Spec: config.Retention{RetentionMaxAge: time.Hour * 2}, Expected: []string{"first/0.ts", "second/0.ts"}},
+		{Spec: config.Retention{RetentionStreamSize: 9}, Expected: []string{"first/0.ts", "first/a.mp4"}},
+		{Spec: config.Retention{RetentionStreamSize: 1}, Expected: []string{"first/0.ts", "first/a.mp4", "first/1.ts", "second/0.ts"}},
+		{Spec: config.Retention{RetentionTotalSize: 14}, Expected: []string{"second/0.ts"}},
+		{Spec: config.Retention{RetentionTotalSize: 9}, Expected: []string{"second/0.ts", "first/0.ts", "first/a.mp4"}},
+		{Spec: config.Retention{RetentionMaxAge: time.Hour * 3, RetentionTotalSize: 12}, Expected: []string{"second/0.ts", "first/0.ts"}},
+	}
+	for i, testCase := range tt {
+		expired := []string{}
+		for _, file := range expiredFiles(testCase.Spec, usages, now) {
+			expired = append(expired, file.path)
+		}
+		if !assert.Equal(t, testCase.Expected, expired) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestExpiredFiles", i))
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	root, err := ioutil.TempDir("", "retention")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	conf := *config.InitConfig()
+	conf.StoreDir = filepath.Join(root, "videos")
+	conf.RecordingsDir = filepath.Join(root, "recordings")
+	conf.RetentionMaxAge = time.Hour
+	conf.RetentionTotalSize = 1
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	router := httprouter.New()
+	router.GET("/storage", ctrls.StorageHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	now := time.Now()
+	assert.Nil(t, os.MkdirAll(filepath.Join(conf.StoreDir, "id"), os.ModePerm))
+	assert.Nil(t, os.MkdirAll(filepath.Join(conf.RecordingsDir, "id"), os.ModePerm))
+	writeAged(t, filepath.Join(conf.StoreDir, "id", "0.ts"), 100, now.Add(-time.Hour*2))
+	writeAged(t, filepath.Join(conf.StoreDir, "id", "1.ts"), 100, now)
+	writeAged(t, filepath.Join(conf.RecordingsDir, "id", "old.mp4"), 300, now.Add(-time.Hour*2))
+	writeAged(t, filepath.Join(conf.RecordingsDir, "id", "new.mp4"), 300, now)
+
+	ctrls.enforceRetention()
+	for _, path := range []string{filepath.Join(conf.StoreDir, "id", "0.ts"), filepath.Join(conf.RecordingsDir, "id", "old.mp4")} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	res, err := http.Get(fmt.Sprintf("%s/storage", server.URL))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var dto StorageDto
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&dto))
+	assert.Equal(t, int64(400), dto.Usage)
+	assert.Equal(t, megabyte-400, *dto.Headroom)
+	assert.Equal(t, RetentionDto{StreamSize: 0, TotalSize: megabyte, MaxAge: 3600}, dto.Limits)
+	assert.Equal(t, []StreamStorageDto{{ID: "id", Segments: 100, Recordings: 300}}, dto.Streams)
+}
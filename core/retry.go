@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// RetryDto describes the retry policy of a stream. The durations are given like 5s or 1m30s,
+// the fields left out keep the ones of the configuration or the current policy of the stream
+type RetryDto struct {
+	MaxAttempts  *int     `json:"maxAttempts,omitempty"`
+	InitialDelay string   `json:"initialDelay,omitempty"`
+	MaxDelay     string   `json:"maxDelay,omitempty"`
+	Jitter       *float64 `json:"jitter,omitempty"`
+	GiveUpAfter  string   `json:"giveUpAfter,omitempty"`
+}
+
+// apply overrides the policy with the fields that are set
+func (dto RetryDto) apply(policy *streaming.Backoff) error {
+	if dto.MaxAttempts != nil {
+		if *dto.MaxAttempts < 0 {
+			return ErrInvalidRetry
+		}
+		policy.MaxAttempts = *dto.MaxAttempts
+	}
+	if dto.Jitter != nil {
+		if *dto.Jitter < 0 || *dto.Jitter > 1 {
+			return ErrInvalidRetry
+		}
+		policy.Jitter = *dto.Jitter
+	}
+	durations := []struct {
+		value  string
+		target *time.Duration
+	}{{dto.InitialDelay, &policy.Base}, {dto.MaxDelay, &policy.MaxDelay}, {dto.GiveUpAfter, &policy.GiveUpAfter}}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil || parsed < 0 {
+			return ErrInvalidRetry
+		}
+		*duration.target = parsed
+	}
+	return nil
+}
+
+// retryDto describes the whole retry policy
+func retryDto(policy streaming.Backoff) RetryDto {
+	return RetryDto{
+		MaxAttempts:  &policy.MaxAttempts,
+		InitialDelay: policy.Base.String(),
+		MaxDelay:     policy.MaxDelay.String(),
+		Jitter:       &policy.Jitter,
+		GiveUpAfter:  policy.GiveUpAfter.String(),
+	}
+}
+
+// probeRetried probes the source of the new stream. If the starts are retried, the sources that cannot be probed are probed
+// again with the retry policy of the stream until it is exhausted or the start runs out of time
+func (c *Controller) probeRetried(ctx context.Context, uri string, opts *streaming.Options) (streaming.SourceInfo, error) {
+	info, err := c.probe(ctx, uri, opts)
+	if err == nil || err == streaming.ErrSourceAuthFailed || (!c.spec().StartRetry && opts.Retry == nil) {
+		return info, err
+	}
+	backoff := c.backoff()
+	if opts.Retry != nil {
+		backoff = *opts.Retry
+	}
+	failed := time.Now()
+	for attempt := 1; err != nil && ctx.Err() == nil; attempt++ {
+		delay := backoff.Delay(attempt)
+		if !backoff.Allows(attempt, time.Since(failed)+delay) {
+			break
+		}
+		c.logger(ctx).Infof("%s is probed again in %s, attempt %d || Error: %s", streaming.RedactURI(uri), delay, attempt, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return info, err
+		}
+		info, err = c.probe(ctx, uri, opts)
+	}
+	return info, err
+}
+
+// RetryHandler is the HTTP handler of the PATCH /stream/:id/retry call. It changes the retry policy of the stream,
+// a restart that is scheduled already is timed again with it
+func (c *Controller) RetryHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	var dto RetryDto
+	if err := json.Unmarshal(body, &dto); err != nil {
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	policy := c.retryPolicy(strm)
+	if err := dto.apply(&policy); err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	strm.SetRetryPolicy(policy)
+	c.persist()
+	c.logger(r.Context()).Infof("Retry policy of %s is changed%s", id, requestedBy(apiKeyName(r)))
+	b, _ := json.Marshal(retryDto(policy))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
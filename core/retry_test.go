@@ -0,0 +1,179 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// unreachableProcessor fails the given number of probes before the source can be reached
+type unreachableProcessor struct {
+	mockProcessor
+	failures int32
+	probes   *int32
+}
+
+func (p unreachableProcessor) Probe(ctx context.Context, URI string, opts streaming.Options) (streaming.SourceInfo, error) {
+	if atomic.AddInt32(p.probes, 1) <= p.failures {
+		return streaming.SourceInfo{}, streaming.ErrProbeFn("Connection refused")
+	}
+	return p.mockProcessor.Probe(ctx, URI, opts)
+}
+
+func TestRetry(t *testing.T) {
+	setup := func(spec *config.Specification, failures int32) (*Controller, *httptest.Server, *int32) {
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()))
+		probes := int32(0)
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = unreachableProcessor{failures: failures, probes: &probes}
+		router := httprouter.New()
+		router.POST("/start", ctrls.StartStreamHandler)
+		router.GET("/status/:id", ctrls.StatusHandler)
+		router.PATCH("/stream/:id/retry", ctrls.RetryHandler)
+		return ctrls, httptest.NewServer(router), &probes
+	}
+	start := func(server *httptest.Server, dto StreamDto) (int, string) {
+		b, err := json.Marshal(dto)
+		assert.Nil(t, err)
+		res, err := http.Post(fmt.Sprintf("%s/start", server.URL), "application/json", bytes.NewBuffer(b))
+		assert.Nil(t, err)
+		var errDto ErrorDto
+		json.NewDecoder(res.Body).Decode(&errDto)
+		return res.StatusCode, errDto.Error.Code
+	}
+	patch := func(server *httptest.Server, id, body string) (*http.Response, RetryDto) {
+		req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("%s/stream/%s/retry", server.URL, id), bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		var dto RetryDto
+		json.NewDecoder(res.Body).Decode(&dto)
+		return res, dto
+	}
+
+	t.Run("Should retry the probe of the start with the retry policy", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.CrashBackoffBase = 10 * time.Millisecond
+		conf.StartRetry = true
+		_, server, probes := setup(&conf, 2)
+		defer server.Close()
+
+		status, _ := start(server, StreamDto{URI: generateURI()})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, int32(3), atomic.LoadInt32(probes))
+
+		// The start fails once the policy is exhausted
+		atomic.StoreInt32(probes, -10)
+		attempts := 1
+		status, _ = start(server, StreamDto{URI: generateURI(), Retry: &RetryDto{MaxAttempts: &attempts}})
+		assert.Equal(t, http.StatusUnprocessableEntity, status)
+		assert.Equal(t, int32(-8), atomic.LoadInt32(probes))
+	})
+
+	t.Run("Should only retry the probe of the start if it is turned on or the stream has a policy", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.CrashBackoffBase = 10 * time.Millisecond
+		_, server, probes := setup(&conf, 2)
+		defer server.Close()
+
+		status, _ := start(server, StreamDto{URI: generateURI()})
+		assert.Equal(t, http.StatusUnprocessableEntity, status)
+		assert.Equal(t, int32(1), atomic.LoadInt32(probes))
+		status, _ = start(server, StreamDto{URI: generateURI(), Retry: &RetryDto{InitialDelay: "5ms"}})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, int32(3), atomic.LoadInt32(probes))
+	})
+
+	t.Run("Should refuse the retry policies that cannot be used", func(t *testing.T) {
+		ctrls, server, _ := setup(config.InitConfig(), 0)
+		defer server.Close()
+
+		negative := -1
+		jitter := 2.0
+		for i, retry := range []RetryDto{{MaxAttempts: &negative}, {Jitter: &jitter}, {InitialDelay: "soon"}, {GiveUpAfter: "-1m"}} {
+			status, code := start(server, StreamDto{URI: generateURI(), Retry: &retry})
+			if !assert.Equal(t, http.StatusBadRequest, status) || !assert.Equal(t, "invalid_retry", code) {
+				t.Error(fmt.Errorf("%d testcase is failing for refused retry policies", i))
+			}
+		}
+		assert.Empty(t, ctrls.streams)
+	})
+
+	t.Run("Should expose the scheduled restart and time it again with the new policy", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.CrashBackoffBase = time.Hour
+		ctrls, server, _ := setup(&conf, 0)
+		defer server.Close()
+		defer ctrls.Shutdown(context.Background())
+
+		generated := generateStream(nil, "")
+		strm := &generated.strm
+		strm.StartedAt = time.Now()
+		ctrls.supervise(generated.dirPath, strm)
+		ctrls.setStream(generated.dirPath, strm)
+		done := make(chan struct{})
+		go func() {
+			ctrls.restartCrashed(generated.dirPath, strm, errors.New("exit status 1"))
+			close(done)
+		}()
+		var status StatusDto
+		assert.True(t, waitUntil(func() bool {
+			status = StatusDto{}
+			res, err := http.Get(fmt.Sprintf("%s/status/%s", server.URL, generated.dirPath))
+			return err == nil && json.NewDecoder(res.Body).Decode(&status) == nil && status.NextRetryAt != nil
+		}, time.Second))
+		assert.Equal(t, 1, status.RetryAttempt)
+		assert.True(t, status.NextRetryAt.After(time.Now().Add(50*time.Minute)))
+
+		res, dto := patch(server, generated.dirPath, `{"initialDelay":"10ms","maxAttempts":3}`)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		attempts, jitter := 3, 0.0
+		assert.Equal(t, RetryDto{MaxAttempts: &attempts, InitialDelay: "10ms", MaxDelay: "0s", Jitter: &jitter, GiveUpAfter: "0s"}, dto)
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Error("the restart was not timed again")
+		}
+		assert.Equal(t, 1, strm.Restarts)
+		_, _, scheduled := strm.NextRetry()
+		assert.False(t, scheduled)
+		assert.Equal(t, &streaming.Backoff{Base: 10 * time.Millisecond, Multiplier: 2, MaxAttempts: 3}, strm.RetryPolicy())
+
+		res, _ = patch(server, generated.dirPath, `{"jitter":1.5}`)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		res, _ = patch(server, "unknown", `{}`)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("Should mark the stream as errored once the restarts take too long", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.CrashBackoffBase = 10 * time.Millisecond
+		conf.CrashGiveUpAfter = 5 * time.Millisecond
+		ctrls, server, _ := setup(&conf, 0)
+		defer server.Close()
+
+		generated := generateStream(nil, "")
+		strm := &generated.strm
+		strm.StartedAt = time.Now()
+		ctrls.supervise(generated.dirPath, strm)
+		ctrls.setStream(generated.dirPath, strm)
+		ctrls.restartCrashed(generated.dirPath, strm, errors.New("exit status 1"))
+		assert.True(t, strm.IsErrored())
+		assert.Equal(t, 0, strm.Restarts)
+		_, _, scheduled := strm.NextRetry()
+		assert.False(t, scheduled)
+	})
+}
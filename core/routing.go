@@ -2,15 +2,18 @@ package core
 
 import (
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/Roverr/rtsp-stream/core/config"
 	"github.com/julienschmidt/httprouter"
+	"github.com/rs/cors"
 )
 
-// determinesHost is for parsing out the host from the storage path
-func determineHost(path string) string {
+// determineStreamID is for parsing out the id of the stream from the storage path
+func determineStreamID(path string) string {
 	parts := strings.Split(path, "/")
 	if len(parts) >= 1 {
 		return parts[1]
@@ -18,27 +21,385 @@ func determineHost(path string) string {
 	return ""
 }
 
-// GetRouter returns the return for the application
-func GetRouter(config *config.Specification) (*httprouter.Router, *Controller) {
-	fileServer := http.FileServer(http.Dir(config.StoreDir))
+// isSegment is for deciding if the requested file is a media segment
+func isSegment(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".ts" || ext == ".m4s"
+}
+
+// GetRouter returns the handler of the public listener of the application with the cross origin handling applied, with the
+// background work of the controller started. The admin listener is served by the AdminHandler of the controller if it is configured.
+// Services embedding the controller can use NewController, Start and Routes instead
+func GetRouter(config *config.Specification, opts ...Option) (http.Handler, *Controller) {
+	controllers := NewController(config, opts...)
+	controllers.Start()
+	return controllers.PublicHandler(), controllers
+}
+
+// Start recovers the persisted streams, removes the orphaned directories of the store and starts the background work of the controller: the delivery
+// of the webhooks, the removal of the expired streams and the cleanup of the unused streams. The streams are only
+// recovered by the first call, the later ones restart the cleanup if it was stopped
+func (c *Controller) Start() {
+	c.startOnce.Do(func() {
+		c.notifyWebhooks()
+		go c.detectFFmpeg()
+		// The usage is only scanned once, it is tracked afterwards
+		c.usage.reset(c.storageUsage())
+		c.reconcileAtStartup(c.recoverStreams())
+		go c.expiryLoop()
+		go c.queueLoop()
+		go c.activityLoop()
+		go c.resourceLoop()
+	})
+	c.loopMux.Lock()
+	defer c.loopMux.Unlock()
+	if c.stopLoop != nil {
+		return
+	}
+	c.stopLoop = make(chan struct{})
+	go c.cleanupLoop(c.stopLoop)
+}
+
+// Stop stops the cleanup of the unused streams. The streams keep running until Shutdown
+func (c *Controller) Stop() {
+	c.loopMux.Lock()
+	defer c.loopMux.Unlock()
+	if c.stopLoop == nil {
+		return
+	}
+	close(c.stopLoop)
+	c.stopLoop = nil
+}
+
+// cleanupInterval returns the time until the next cleanup. It is the configured interval,
+// or the shortest idle timeout of the streams if that is shorter, so those are not kept running for longer
+func (c *Controller) cleanupInterval() time.Duration {
+	interval := c.spec().CleanupTime
+	for _, strm := range c.snapshotStreams() {
+		strm.Mux.RLock()
+		idle := strm.Options.IdleDuration()
+		strm.Mux.RUnlock()
+		if idle > 0 && idle < interval {
+			interval = idle
+		}
+	}
+	return interval
+}
+
+// cleanupLoop cleans the unused streams until it is stopped, the interval is read again after every run or reload
+func (c *Controller) cleanupLoop(stop <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(c.cleanupInterval()):
+			c.cleanUnused()
+			c.enforceRetention()
+		case <-c.cleanupReset:
+		case <-stop:
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// The groups of the endpoints, the public listener only serves the configured groups if there is an admin listener
+const (
+	groupMedia      = "media"
+	groupManagement = "management"
+	groupMetrics    = "metrics"
+	groupDebug      = "debug"
+)
+
+// routeGroups are all the groups of the endpoints
+var routeGroups = []string{groupMedia, groupManagement, groupMetrics, groupDebug}
+
+// Handler returns the routes of the controller with the cross origin handling applied, and the request log if it is enabled
+func (c *Controller) Handler() http.Handler {
+	return c.handler(groupSet(routeGroups, true))
+}
+
+// PublicHandler returns the routes of the groups served on the public listener, configured by PUBLIC_GROUPS.
+// It serves every route if there is no admin listener configured
+func (c *Controller) PublicHandler() http.Handler {
+	if c.spec().AdminAddress == "" {
+		return c.Handler()
+	}
+	return c.handler(groupSet(c.spec().PublicGroups, true))
+}
+
+// AdminHandler returns the routes of the groups that are not served on the public listener, so they can be served
+// on the admin listener, like the management and the metrics endpoints on an internal interface only
+func (c *Controller) AdminHandler() http.Handler {
+	return c.handler(groupSet(c.spec().PublicGroups, false))
+}
+
+// groupSet returns the groups of the endpoints that are listed, or the ones not listed if included is false
+func groupSet(listed []string, included bool) map[string]bool {
+	groups := map[string]bool{}
+	for _, group := range routeGroups {
+		groups[group] = !included
+	}
+	for _, group := range listed {
+		groups[group] = included
+	}
+	return groups
+}
+
+// complete checks if every group of the endpoints is in the set
+func complete(groups map[string]bool) bool {
+	for _, group := range routeGroups {
+		if !groups[group] {
+			return false
+		}
+	}
+	return true
+}
+
+// handler returns the routes of the given groups with the cross origin handling applied, and the request log if it is enabled
+func (c *Controller) handler(groups map[string]bool) http.Handler {
 	router := httprouter.New()
-	controllers := NewController(config, fileServer)
-	if config.ListEndpoint {
-		router.GET("/list", controllers.ListStreamHandler)
+	// The router answers OPTIONS with the Allow header of the route, and the methods the route does not accept
+	// with the JSON error listing the allowed ones
+	router.MethodNotAllowed = http.HandlerFunc(c.methodNotAllowed)
+	if complete(groups) {
+		c.Routes(router)
+	} else {
+		c.register(router, groups)
+		// The description of the API lists every route, even if they are split between the listeners
+		if groups[groupManagement] {
+			c.Routes(httprouter.New())
+		}
+	}
+	handler := c.withPathPrefix(corsHandler(c.spec().CORS, router))
+	if c.spec().RequestLogEnabled {
+		handler = c.RequestLogger()(handler)
+	}
+	return RequestID(handler)
+}
+
+// Routes registers the endpoints of the controller on the router. The endpoints that are turned off in the configuration are left out
+func (c *Controller) Routes(router *httprouter.Router) {
+	c.register(router, groupSet(routeGroups, true))
+	c.routes.Store(router)
+}
+
+// register registers the endpoints of the given groups on the router. The root answers on every router, so each
+// listener can be probed. The logs of the streams are management endpoints, they are only served next to the files
+// of the streams if the management group is registered too
+func (c *Controller) register(router *httprouter.Router, groups map[string]bool) {
+	spec := c.spec()
+	// The management routes require basic authentication and an API key with the permission of the operation if they are
+	// enabled, the media routes only if the files of the streams are protected too. Both are checked against their own access
+	// lists first, so the denied addresses are refused before any authentication. The middlewares of the routes run before all of them
+	all, start, stream := c.middlewares.all, c.middlewares.all, c.middlewares.all
+	if c.middlewares.start != nil {
+		start = c.middlewares.start
+	}
+	if c.middlewares.stream != nil {
+		stream = c.middlewares.stream
 	}
-	router.GET("/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	management := func(permission string, handle httprouter.Handle) httprouter.Handle {
+		return c.withAccess(false, c.withBasicAuth(false, c.withAPIKey(permission, false, handle)))
+	}
+	media := func(handle httprouter.Handle) httprouter.Handle {
+		return c.withAccess(true, c.withBasicAuth(true, c.withAPIKey("read", true, handle)))
+	}
+	root := withMiddlewares(all, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		w.WriteHeader(http.StatusOK)
 	})
-	router.POST("/start", controllers.StartStreamHandler)
-	router.GET("/stream/*filepath", controllers.FileHandler)
+	router.GET("/", root)
+	router.HEAD("/", root)
+	if groups[groupMetrics] && spec.MetricsEndpoint {
+		router.GET("/metrics", withMiddlewares(all, management("list", c.MetricsHandler)))
+	}
+	if groups[groupDebug] && spec.DebugEndpoint && spec.DebugAddress == "" {
+		c.debugRoutes(router)
+	}
+	logs, files := notFound, notFound
+	if groups[groupManagement] {
+		logs = management("read", c.LogsHandler)
+	}
+	if groups[groupMedia] {
+		files = media(c.FileHandler)
+	}
+	if groups[groupMedia] || groups[groupManagement] {
+		router.GET("/stream/*filepath", withMiddlewares(stream, streamRoutes(c, logs, files)))
+		router.HEAD("/stream/*filepath", withMiddlewares(stream, withoutBody(streamRoutes(c, logs, files))))
+	}
+	if groups[groupMedia] {
+		router.POST("/stream/:id/keepalive", withMiddlewares(stream, media(c.KeepaliveHandler)))
+		router.GET("/keys/:id", withMiddlewares(all, media(c.KeyHandler)))
+		if spec.MPEGTSEnabled {
+			router.GET("/mpegts/:id", withMiddlewares(stream, media(c.MPEGTSHandler)))
+		}
+		if spec.WHEPEnabled {
+			router.POST("/whep/:id", withMiddlewares(stream, media(c.WHEPHandler)))
+			router.DELETE("/whep/:id/:session", withMiddlewares(stream, media(c.WHEPSessionHandler)))
+		}
+		router.GET("/recordings/:id/:file", withMiddlewares(all, media(c.RecordingHandler)))
+	}
+	if !groups[groupManagement] {
+		return
+	}
+	if spec.ListEndpoint {
+		router.GET("/list", withMiddlewares(all, management("list", c.ListStreamHandler)))
+	}
+	if spec.EventsEndpoint {
+		router.GET("/events", withMiddlewares(all, management("list", c.EventsHandler)))
+	}
+	if c.eventLog != nil {
+		router.GET("/events/log", withMiddlewares(all, management("list", c.EventLogHandler)))
+	}
+	if spec.DiscoveryEnabled {
+		router.GET("/discover", withMiddlewares(start, management("start", c.DiscoverHandler)))
+		router.POST("/discover", withMiddlewares(start, management("start", c.DiscoverHandler)))
+	}
+	if spec.ReloadEndpoint {
+		router.POST("/admin/reload", withMiddlewares(all, management("admin", c.ReloadHandler)))
+	}
+	router.POST("/admin/stopAll", withMiddlewares(all, management("admin", c.StopAllHandler)))
+	router.POST("/admin/reconcile", withMiddlewares(all, management("admin", c.ReconcileHandler)))
+	router.GET("/admin/debug", withMiddlewares(all, management("admin", c.AdminDebugHandler)))
+	router.GET("/status/:id", withMiddlewares(all, management("list", c.StatusHandler)))
+	router.GET("/capacity", withMiddlewares(all, management("list", c.CapacityHandler)))
+	router.GET("/version", withMiddlewares(all, management("list", c.VersionHandler)))
+	router.GET("/openapi.json", withMiddlewares(all, management("list", c.OpenAPIHandler)))
+	if spec.DocsEndpoint {
+		router.GET("/docs", withMiddlewares(all, management("list", c.DocsHandler)))
+	}
+	router.GET("/storage", withMiddlewares(all, management("list", c.StorageHandler)))
+	router.GET("/health", withMiddlewares(all, management("list", c.HealthHandler)))
+	router.GET("/health/:id", withMiddlewares(all, management("list", c.StreamHealthHandler)))
+	router.POST("/start", withMiddlewares(start, management("start", c.StartStreamHandler)))
+	router.POST("/start/batch", withMiddlewares(start, management("start", c.BatchStartHandler)))
+	router.DELETE("/stream/:id", withMiddlewares(stream, management("stop", c.StopStreamHandler)))
+	router.POST("/restart/:id", withMiddlewares(all, management("start", c.RestartHandler)))
+	router.PATCH("/stream/:id/metadata", withMiddlewares(stream, management("start", c.MetadataHandler)))
+	router.PATCH("/stream/:id/lifecycle", withMiddlewares(stream, management("start", c.LifecycleHandler)))
+	router.PATCH("/stream/:id/retry", withMiddlewares(stream, management("start", c.RetryHandler)))
+	router.PATCH("/stream/:id/group", withMiddlewares(stream, management("start", c.GroupHandler)))
+	router.PATCH("/stream/:id/priority", withMiddlewares(stream, management("start", c.PriorityHandler)))
+	router.PATCH("/stream/:id", withMiddlewares(stream, management("start", c.PatchStreamHandler)))
+	router.DELETE("/stream/:id/token", withMiddlewares(stream, management("stop", c.RevokeTokenHandler)))
+	router.POST("/stream/:id/pause", withMiddlewares(stream, management("start", c.PauseHandler)))
+	router.POST("/stream/:id/resume", withMiddlewares(stream, management("start", c.ResumeHandler)))
+	router.POST("/stream/:id/disable", withMiddlewares(stream, management("start", c.DisableHandler)))
+	router.POST("/stream/:id/enable", withMiddlewares(stream, management("start", c.EnableHandler)))
+	router.GET("/snapshot/:id", withMiddlewares(all, management("read", c.SnapshotHandler)))
+	router.GET("/recordings/:id", withMiddlewares(all, management("list", c.RecordingsHandler)))
+	router.GET("/groups", withMiddlewares(all, management("list", c.GroupsHandler)))
+	router.GET("/groups/:name/list", withMiddlewares(all, management("list", c.GroupListHandler)))
+	router.POST("/groups/:name/stop", withMiddlewares(all, management("stop", c.GroupStopHandler)))
+	router.POST("/groups/:name/restart", withMiddlewares(all, management("start", c.GroupRestartHandler)))
+}
 
-	// Start cleaning process in the background
-	go func() {
-		for {
-			<-time.After(config.CleanupTime)
-			controllers.cleanUnused()
+// HandlerFunc adapts the handler to the standard library, so it can be registered on any mux. The params are read
+// from the path after the prefix, one segment for each name in their order, the last one takes the rest of the path.
+// Like HandlerFunc(c.StatusHandler, "/video/status/", "id") or HandlerFunc(c.FileHandler, "/video/stream", "filepath")
+func HandlerFunc(handle httprouter.Handle, prefix string, names ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.Params{}
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+		if len(names) > 0 {
+			values := strings.SplitN(rest, "/", len(names))
+			for i, name := range names {
+				value := ""
+				if i < len(values) {
+					value = values[i]
+				}
+				params = append(params, httprouter.Param{Key: name, Value: value})
+			}
 		}
-	}()
+		handle(w, r, params)
+	}
+}
 
-	return router, controllers
+// corsHandler wraps the handler with the cross origin handling. Every origin is allowed if
+// the handling is not configured, otherwise only the listed ones ("*" allows every origin)
+func corsHandler(spec config.CORS, handler http.Handler) http.Handler {
+	if !spec.Enabled {
+		return cors.AllowAll().Handler(handler)
+	}
+	options := cors.Options{
+		AllowedOrigins:   spec.AllowedOrigins,
+		AllowedMethods:   spec.AllowedMethods,
+		AllowedHeaders:   spec.AllowedHeaders,
+		AllowCredentials: spec.AllowCredentials,
+		MaxAge:           spec.MaxAge,
+		// The clients can read the id of the request to report it
+		ExposedHeaders: []string{RequestIDHeader},
+	}
+	// The cors package allows every origin for an empty list
+	if len(spec.AllowedOrigins) == 0 {
+		options.AllowOriginFunc = func(origin string) bool { return false }
+	}
+	return cors.New(options).Handler(handler)
+}
+
+// isLogsPath returns the id of the stream if the path requests the logs of a stream
+func isLogsPath(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[1] != "logs" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// streamRoutes dispatches the GET requests under /stream to the given handlers, since the logs of
+// the streams cannot be registered next to the catch-all route of the files
+func streamRoutes(c *Controller, logs, files httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if id, ok := isLogsPath(ps.ByName("filepath")); ok {
+			logs(w, r, httprouter.Params{{Key: "id", Value: id}})
+			return
+		}
+		files(w, r, ps)
+	}
+}
+
+// notFound answers the routes that are not served on the listener
+func notFound(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	http.NotFound(w, r)
+}
+
+// bodylessWriter drops the body written to the response, only the status and the headers are sent
+type bodylessWriter struct {
+	http.ResponseWriter
+}
+
+// Write drops the body, reporting it as written
+func (w bodylessWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// withoutBody serves the HEAD requests with the handle of the GET ones, without the body of the responses
+func withoutBody(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handle(bodylessWriter{w}, r, ps)
+	}
+}
+
+// methodNotAllowed sends the error of the requests with a method the route does not accept,
+// the router sets the Allow header listing the accepted ones
+func (c *Controller) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	c.SendError(w, ErrMethodNotAllowedFn(r.Method, w.Header().Get("Allow")), http.StatusMethodNotAllowed)
+}
+
+// withPathPrefix serves the requests sent under the path prefix of the service as if they were sent without it, so the service
+// can run behind a reverse proxy without rewrite rules. The requests without the prefix are still served, for the proxies removing it
+func (c *Controller) withPathPrefix(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := c.spec().PathPrefix
+		if prefix == "" || (r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		stripped := new(http.Request)
+		*stripped = *r
+		stripped.URL = new(url.URL)
+		*stripped.URL = *r.URL
+		stripped.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		stripped.URL.RawPath = ""
+		next.ServeHTTP(w, stripped)
+	})
 }
@@ -1,13 +1,26 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Roverr/rtsp-stream/core/config"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestDetermineHost(t *testing.T) {
+func TestDetermineStreamID(t *testing.T) {
 	tt := []struct {
 		Input  string
 		Output string
@@ -20,11 +33,340 @@ func TestDetermineHost(t *testing.T) {
 			Input:  "/192-168-0-1-channels-wwww-001/asd.jpeg",
 			Output: "192-168-0-1-channels-wwww-001",
 		},
+		{
+			Input:  "/9f86d081884c7d659a2feaa0c55ad015/0.ts",
+			Output: "9f86d081884c7d659a2feaa0c55ad015",
+		},
+	}
+
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Output, determineStreamID(testCase.Input)) {
+			t.Error(fmt.Errorf("%d testcase is failing", i))
+		}
+	}
+}
+
+func TestIsLogsPath(t *testing.T) {
+	tt := []struct {
+		Input string
+		ID    string
+		Logs  bool
+	}{
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/logs", ID: "9f86d081884c7d659a2feaa0c55ad015", Logs: true},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/index.m3u8", ID: "", Logs: false},
+		{Input: "/9f86d081884c7d659a2feaa0c55ad015/720p/logs", ID: "", Logs: false},
+		{Input: "/logs", ID: "", Logs: false},
 	}
 
 	for i, testCase := range tt {
-		if !assert.Equal(t, testCase.Output, determineHost(testCase.Input)) {
+		id, logs := isLogsPath(testCase.Input)
+		if !assert.Equal(t, testCase.ID, id) || !assert.Equal(t, testCase.Logs, logs) {
 			t.Error(fmt.Errorf("%d testcase is failing", i))
 		}
 	}
 }
+
+func TestCorsHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	tt := []struct {
+		Spec    config.CORS
+		Origin  string
+		Allowed string
+	}{
+		{Spec: config.CORS{Enabled: false}, Origin: "http://example.com", Allowed: "*"},
+		{Spec: config.CORS{Enabled: true}, Origin: "http://example.com", Allowed: ""},
+		{Spec: config.CORS{Enabled: true, AllowedOrigins: []string{"http://example.com"}}, Origin: "http://example.com", Allowed: "http://example.com"},
+		{Spec: config.CORS{Enabled: true, AllowedOrigins: []string{"http://example.com"}}, Origin: "http://other.com", Allowed: ""},
+		{Spec: config.CORS{Enabled: true, AllowedOrigins: []string{"*"}}, Origin: "http://other.com", Allowed: "*"},
+	}
+
+	for i, testCase := range tt {
+		testCase.Spec.AllowedMethods = []string{"GET", "POST", "DELETE"}
+		testCase.Spec.AllowedHeaders = []string{"Authorization", "Content-Type"}
+		handler := corsHandler(testCase.Spec, ok)
+		for _, path := range []string{"/start", "/list", "/stream/id/index.m3u8"} {
+			r := httptest.NewRequest(http.MethodOptions, path, nil)
+			r.Header.Set("Origin", testCase.Origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if !assert.Equal(t, testCase.Allowed, w.Header().Get("Access-Control-Allow-Origin")) {
+				t.Error(fmt.Errorf("%d testcase is failing for %s", i, path))
+			}
+		}
+	}
+}
+
+func TestHandlerFunc(t *testing.T) {
+	tt := []struct {
+		Prefix string
+		Path   string
+		Names  []string
+		Params httprouter.Params
+	}{
+		{Prefix: "/video/status/", Path: "/video/status/front-door", Names: []string{"id"}, Params: httprouter.Params{{Key: "id", Value: "front-door"}}},
+		{Prefix: "/video/stream", Path: "/video/stream/front-door/index.m3u8", Names: []string{"filepath"}, Params: httprouter.Params{{Key: "filepath", Value: "/front-door/index.m3u8"}}},
+		{Prefix: "/video/recordings/", Path: "/video/recordings/front-door/1.mp4", Names: []string{"id", "file"}, Params: httprouter.Params{{Key: "id", Value: "front-door"}, {Key: "file", Value: "1.mp4"}}},
+		{Prefix: "/video/recordings/", Path: "/video/recordings/front-door", Names: []string{"id", "file"}, Params: httprouter.Params{{Key: "id", Value: "front-door"}, {Key: "file", Value: ""}}},
+		{Prefix: "/video/start", Path: "/video/start", Names: nil, Params: httprouter.Params{}},
+	}
+	for i, testCase := range tt {
+		var params httprouter.Params
+		handler := HandlerFunc(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			params = ps
+		}, testCase.Prefix, testCase.Names...)
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, testCase.Path, nil))
+		if !assert.Equal(t, testCase.Params, params) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestHandlerFunc", i))
+		}
+	}
+}
+
+func TestEmbeddedController(t *testing.T) {
+	t.Run("Should log with the given logger and read the given clock", func(t *testing.T) {
+		var output bytes.Buffer
+		logger := logrus.New()
+		logger.SetOutput(&output)
+		now := time.Now().Add(time.Hour)
+		ctrls := NewController(config.InitConfig(), WithLogger(logger), WithClock(func() time.Time { return now }))
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		generated.strm.Options.IdleTimeout = 60
+		generated.strm.LastActivity = time.Now()
+		ctrls.streams[generated.dirPath] = &generated.strm
+
+		// The stream is idle on the clock of the controller
+		rr := httptest.NewRecorder()
+		ctrls.KeepaliveHandler(rr, httptest.NewRequest(http.MethodPost, "/stream/"+generated.dirPath+"/keepalive", nil), httprouter.Params{{Key: "id", Value: generated.dirPath}})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = httptest.NewRecorder()
+		ctrls.StopStreamHandler(rr, httptest.NewRequest(http.MethodDelete, "/stream/"+generated.dirPath, nil), httprouter.Params{{Key: "id", Value: generated.dirPath}})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, output.String(), generated.dirPath+" is stopped")
+	})
+
+	t.Run("Should mount the routes on another mux", func(t *testing.T) {
+		ctrls := NewController(config.InitConfig())
+		defer ctrls.Shutdown(context.Background())
+		mux := http.NewServeMux()
+		mux.Handle("/video/", http.StripPrefix("/video", ctrls.Handler()))
+		mux.HandleFunc("/camera/", HandlerFunc(ctrls.StatusHandler, "/camera/", "id"))
+		for path, status := range map[string]int{"/video/capacity": http.StatusOK, "/video/status/unknown": http.StatusNotFound, "/camera/unknown": http.StatusNotFound, "/capacity": http.StatusNotFound} {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, status, rr.Code, path)
+		}
+	})
+
+	t.Run("Should start and stop the cleanup loop once", func(t *testing.T) {
+		ctrls := NewController(config.InitConfig())
+		ctrls.Start()
+		loop := ctrls.stopLoop
+		ctrls.Start()
+		assert.Equal(t, loop, ctrls.stopLoop)
+		ctrls.Stop()
+		ctrls.Stop()
+		assert.Nil(t, ctrls.stopLoop)
+		ctrls.Start()
+		assert.NotNil(t, ctrls.stopLoop)
+		assert.Nil(t, ctrls.Shutdown(context.Background()))
+	})
+}
+
+func TestMethods(t *testing.T) {
+	store, err := ioutil.TempDir("", "methods")
+	assert.Nil(t, err)
+	defer os.RemoveAll(store)
+	spec := config.InitConfig()
+	spec.StoreDir = store
+	ctrls := NewController(spec)
+	defer ctrls.Shutdown(context.Background())
+	generated := generateStream(nil, "")
+	generated.strm.Streak.Activate()
+	ctrls.streams[generated.dirPath] = &generated.strm
+	dir := filepath.Join(store, generated.dirPath)
+	assert.Nil(t, os.MkdirAll(dir, os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:2,\n0.ts\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "0.ts"), make([]byte, 188), 0644))
+
+	serve := func(method, path, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, req)
+		return rr
+	}
+	playlist := "/stream/" + generated.dirPath + "/index.m3u8"
+	segment := "/stream/" + generated.dirPath + "/0.ts"
+
+	tt := []struct {
+		Method   string
+		Path     string
+		Encoding string
+		Status   int
+		Allow    string
+		Code     string
+	}{
+		{Method: http.MethodHead, Path: playlist, Status: http.StatusOK},
+		{Method: http.MethodHead, Path: playlist, Encoding: "gzip", Status: http.StatusOK},
+		{Method: http.MethodHead, Path: segment, Status: http.StatusOK},
+		{Method: http.MethodHead, Path: "/stream/unknown/index.m3u8", Status: http.StatusNotFound},
+		{Method: http.MethodHead, Path: "/stream/" + generated.dirPath + "/1.ts", Status: http.StatusNotFound},
+		{Method: http.MethodHead, Path: "/", Status: http.StatusOK},
+		{Method: http.MethodOptions, Path: "/start", Status: http.StatusOK, Allow: http.MethodPost},
+		{Method: http.MethodOptions, Path: "/stream/" + generated.dirPath, Status: http.StatusOK, Allow: http.MethodDelete},
+		{Method: http.MethodGet, Path: "/start", Status: http.StatusMethodNotAllowed, Allow: http.MethodPost, Code: "method_not_allowed"},
+		{Method: http.MethodPut, Path: "/capacity", Status: http.StatusMethodNotAllowed, Allow: http.MethodGet, Code: "method_not_allowed"},
+		{Method: http.MethodPut, Path: playlist, Status: http.StatusMethodNotAllowed, Allow: http.MethodHead, Code: "method_not_allowed"},
+	}
+	for i, testCase := range tt {
+		rr := serve(testCase.Method, testCase.Path, testCase.Encoding)
+		failed := !assert.Equal(t, testCase.Status, rr.Code) || !assert.Contains(t, rr.Header().Get("Allow"), testCase.Allow)
+		switch {
+		case testCase.Code != "":
+			var errDto ErrorDto
+			failed = failed || !assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &errDto)) || !assert.Equal(t, testCase.Code, errDto.Error.Code) ||
+				!assert.Contains(t, errDto.Error.Message, testCase.Allow)
+		case testCase.Method == http.MethodHead:
+			failed = failed || !assert.Empty(t, rr.Body.String())
+			// The headers are the same as the ones of the GET requests
+			if testCase.Status == http.StatusOK {
+				get := serve(http.MethodGet, testCase.Path, testCase.Encoding)
+				failed = failed || !assert.Equal(t, get.Header().Get("Content-Length"), rr.Header().Get("Content-Length")) ||
+					!assert.Equal(t, get.Header().Get("Content-Encoding"), rr.Header().Get("Content-Encoding")) ||
+					!assert.Equal(t, get.Header().Get("ETag"), rr.Header().Get("ETag"))
+			}
+		}
+		if failed {
+			t.Error(fmt.Errorf("%d testcase is failing for TestMethods", i))
+		}
+	}
+}
+
+func TestListeners(t *testing.T) {
+	store, err := ioutil.TempDir("", "listeners")
+	assert.Nil(t, err)
+	defer os.RemoveAll(store)
+	spec := config.InitConfig()
+	spec.StoreDir = store
+	spec.ListEndpoint, spec.MetricsEndpoint = true, true
+	spec.AdminAddress = "127.0.0.1:8081"
+	ctrls := NewController(spec)
+	defer ctrls.Shutdown(context.Background())
+	generated := generateStream(nil, "")
+	generated.strm.Streak.Activate()
+	ctrls.streams[generated.dirPath] = &generated.strm
+	dir := filepath.Join(store, generated.dirPath)
+	assert.Nil(t, os.MkdirAll(dir, os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:2,\n0.ts\n"), 0644))
+
+	public, admin := ctrls.PublicHandler(), ctrls.AdminHandler()
+	playlist := "/stream/" + generated.dirPath + "/index.m3u8"
+	logs := "/stream/" + generated.dirPath + "/logs"
+	tt := []struct {
+		Method string
+		Path   string
+		Public int
+		Admin  int
+	}{
+		{Method: http.MethodGet, Path: "/", Public: http.StatusOK, Admin: http.StatusOK},
+		{Method: http.MethodGet, Path: playlist, Public: http.StatusOK, Admin: http.StatusNotFound},
+		{Method: http.MethodHead, Path: playlist, Public: http.StatusOK, Admin: http.StatusNotFound},
+		{Method: http.MethodGet, Path: logs, Public: http.StatusNotFound, Admin: http.StatusOK},
+		{Method: http.MethodGet, Path: "/list", Public: http.StatusNotFound, Admin: http.StatusOK},
+		{Method: http.MethodGet, Path: "/metrics", Public: http.StatusNotFound, Admin: http.StatusOK},
+		{Method: http.MethodGet, Path: "/openapi.json", Public: http.StatusNotFound, Admin: http.StatusOK},
+		{Method: http.MethodPost, Path: "/start", Public: http.StatusNotFound, Admin: http.StatusUnsupportedMediaType},
+	}
+	for i, testCase := range tt {
+		publicRR, adminRR := httptest.NewRecorder(), httptest.NewRecorder()
+		public.ServeHTTP(publicRR, httptest.NewRequest(testCase.Method, testCase.Path, nil))
+		admin.ServeHTTP(adminRR, httptest.NewRequest(testCase.Method, testCase.Path, nil))
+		if !assert.Equal(t, testCase.Public, publicRR.Code, "public") || !assert.Equal(t, testCase.Admin, adminRR.Code, "admin") {
+			t.Error(fmt.Errorf("%d testcase is failing for %s %s", i, testCase.Method, testCase.Path))
+		}
+	}
+
+	t.Run("Should describe the routes of both listeners", func(t *testing.T) {
+		paths := ctrls.openAPI()["paths"].(map[string]map[string]interface{})
+		assert.Contains(t, paths, "/stream/{id}/{file}")
+		assert.Contains(t, paths, "/list")
+	})
+
+	t.Run("Should share the streams of the controller between the listeners", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		admin.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/stream/"+generated.dirPath, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = httptest.NewRecorder()
+		public.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, playlist, nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Should serve every route on the public listener without an admin listener", func(t *testing.T) {
+		conf := *spec
+		conf.AdminAddress = ""
+		ctrls := NewController(&conf)
+		defer ctrls.Shutdown(context.Background())
+		for _, path := range []string{"/list", "/metrics"} {
+			rr := httptest.NewRecorder()
+			ctrls.PublicHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, http.StatusOK, rr.Code, path)
+		}
+	})
+}
+
+func TestPathPrefix(t *testing.T) {
+	store, err := ioutil.TempDir("", "prefix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(store)
+	spec := config.InitConfig()
+	spec.StoreDir = store
+	spec.ListEndpoint = true
+	spec.PathPrefix = "/video"
+	ctrls := NewController(spec)
+	defer ctrls.Shutdown(context.Background())
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	generated := generateStream(nil, "")
+	generated.strm.Streak.Activate()
+	ctrls.streams[generated.dirPath] = &generated.strm
+	dir := filepath.Join(store, generated.dirPath)
+	assert.Nil(t, os.MkdirAll(dir, os.ModePerm))
+	playlist := "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/" + generated.dirPath + "\"\n#EXTINF:2,\n0.ts\n"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte(playlist), 0644))
+	handler := ctrls.Handler()
+	serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newJSONRequest(method, path, bytes.NewBuffer(body)))
+		return rr
+	}
+
+	t.Run("Should serve the routes under the prefix and without it", func(t *testing.T) {
+		for _, path := range []string{"/video", "/video/", "/", "/video/list", "/list"} {
+			assert.Equal(t, http.StatusOK, serve(http.MethodGet, path, nil).Code, path)
+		}
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/videos/list", nil).Code)
+		assert.Equal(t, []interface{}{map[string]interface{}{"url": "/video"}}, ctrls.openAPI()["servers"])
+	})
+
+	t.Run("Should prefix the URIs of the responses", func(t *testing.T) {
+		b, err := json.Marshal(StreamDto{URI: generateURI()})
+		assert.Nil(t, err)
+		rr := serve(http.MethodPost, "/video/start", b)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result StreamDto
+		assert.Nil(t, json.NewDecoder(rr.Body).Decode(&result))
+		assert.Equal(t, fmt.Sprintf("/video/stream/%s/index.m3u8", result.ID), result.URI)
+
+		rr = serve(http.MethodGet, "/video/list", nil)
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf(`"uri":"/video/stream/%s/index.m3u8"`, generated.dirPath))
+	})
+
+	t.Run("Should prefix the absolute references of the playlists", func(t *testing.T) {
+		rr := serve(http.MethodGet, fmt.Sprintf("/video/stream/%s/index.m3u8", generated.dirPath), nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf(`URI="/video/keys/%s"`, generated.dirPath))
+		assert.Contains(t, rr.Body.String(), "\n0.ts\n")
+	})
+}
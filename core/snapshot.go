@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// minSnapshotWidth is the narrowest snapshot that can be requested
+const minSnapshotWidth = 16
+
+// maxSnapshotWidth is the widest snapshot that can be requested
+const maxSnapshotWidth = 3840
+
+// snapshotCache keeps the snapshots of the streams for a short time, so refreshing a grid
+// of streams does not start a process for every stream on every request
+type snapshotCache struct {
+	mux     *sync.Mutex
+	ttl     time.Duration
+	entries map[string]snapshotEntry
+	flights *flightGroup
+}
+
+// snapshotEntry describes a cached snapshot
+type snapshotEntry struct {
+	image   []byte
+	takenAt time.Time
+}
+
+// newSnapshotCache creates a new instance of snapshotCache
+func newSnapshotCache(ttl time.Duration) *snapshotCache {
+	return &snapshotCache{&sync.Mutex{}, ttl, map[string]snapshotEntry{}, newFlightGroup()}
+}
+
+// get returns the cached snapshot of the key, taking it again if it is expired.
+// Concurrent requests of the same key wait for the snapshot taken by the first one
+func (s *snapshotCache) get(key string, take func() ([]byte, error)) ([]byte, error) {
+	if s.ttl <= 0 {
+		return take()
+	}
+	if image, ok := s.lookup(key); ok {
+		return image, nil
+	}
+	_, err := s.flights.do(key, func() (int, error) {
+		taken, err := take()
+		if err != nil {
+			return 0, err
+		}
+		s.store(key, taken)
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	image, _ := s.lookup(key)
+	return image, nil
+}
+
+// lookup returns the snapshot of the key if it is not expired
+func (s *snapshotCache) lookup(key string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Since(entry.takenAt) >= s.ttl {
+		return nil, false
+	}
+	return entry.image, true
+}
+
+// store caches the snapshot of the key and removes the expired ones
+func (s *snapshotCache) store(key string, image []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for k, entry := range s.entries {
+		if time.Since(entry.takenAt) >= s.ttl {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = snapshotEntry{image, time.Now()}
+}
+
+// snapshotWidth returns the requested width of the snapshot, or the default one if it is not requested
+func (c *Controller) snapshotWidth(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("width")
+	if value == "" {
+		return c.spec().SnapshotWidth, nil
+	}
+	width, err := strconv.Atoi(value)
+	if err != nil || width < minSnapshotWidth || width > maxSnapshotWidth {
+		return 0, ErrInvalidSnapshotWidth
+	}
+	return width, nil
+}
+
+// SnapshotHandler is the HTTP handler of the /snapshot/:id call returning the last frame of the stream as a JPEG image
+func (c *Controller) SnapshotHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if strm.IsAudioOnly() {
+		c.SendError(w, ErrAudioOnly, http.StatusConflict)
+		return
+	}
+	width, err := c.snapshotWidth(r)
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	image, err := c.snapshots.get(fmt.Sprintf("%s:%d", id, width), func() ([]byte, error) {
+		input := strm.SnapshotInput()
+		if input == "" {
+			return nil, ErrNoSegment
+		}
+		strm.Mux.RLock()
+		opts := strm.Options
+		strm.Mux.RUnlock()
+		return c.processor.Snapshot(input, opts, width)
+	})
+	if err == ErrNoSegment {
+		c.SendError(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.logger(r.Context()).Errorf("%s could not be snapshotted || Error: %s", id, err)
+		c.SendError(w, ErrSnapshotFailed, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", cacheControl(c.spec().SnapshotCacheTTL, false))
+	w.Write(image)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotCache(t *testing.T) {
+	cache := newSnapshotCache(time.Minute)
+	taken := int32(0)
+	take := func() ([]byte, error) {
+		atomic.AddInt32(&taken, 1)
+		<-time.After(time.Millisecond * 50)
+		return []byte("image"), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			image, err := cache.get("id:0", take)
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("image"), image)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&taken))
+
+	_, err := cache.get("id:320", func() ([]byte, error) { return nil, ErrNoSegment })
+	assert.Equal(t, ErrNoSegment, err)
+
+	uncached := newSnapshotCache(0)
+	for i := 0; i < 2; i++ {
+		image, err := uncached.get("id:0", take)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("image"), image)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&taken))
+}
+
+func TestSnapshot(t *testing.T) {
+	storeDir, err := ioutil.TempDir("", "snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(storeDir)
+	conf := *config.InitConfig()
+	conf.SnapshotWidth = 320
+	conf.SnapshotCacheTTL = time.Minute
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	spawned := int32(0)
+	ctrls.processor = mockProcessor{spawned: &spawned}
+	router := httprouter.New()
+	router.GET("/snapshot/:id", ctrls.SnapshotHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	newStream := func(id string, encrypted bool) *streaming.Stream {
+		generated := generateStream(nil, "")
+		generated.strm.StorePath = filepath.Join(storeDir, id)
+		if encrypted {
+			generated.strm.KeyPath = filepath.Join(storeDir, "keys", id)
+		}
+		assert.Nil(t, os.MkdirAll(generated.strm.StorePath, os.ModePerm))
+		ctrls.streams[id] = &generated.strm
+		return &generated.strm
+	}
+	get := func(path string) (*http.Response, []byte) {
+		res, err := http.Get(server.URL + path)
+		assert.Nil(t, err)
+		b, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		return res, b
+	}
+
+	t.Run("Should refuse unknown streams and the ones without segments", func(t *testing.T) {
+		res, _ := get("/snapshot/unknown")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+		newStream("starting", false)
+		res, b := get("/snapshot/starting")
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+		var dto ErrorDto
+		assert.Nil(t, json.Unmarshal(b, &dto))
+		assert.Equal(t, "no_segment", dto.Error.Code)
+	})
+
+	t.Run("Should refuse audio-only streams", func(t *testing.T) {
+		strm := newStream("audio", false)
+		strm.Options.AudioOnly = true
+		assert.Nil(t, ioutil.WriteFile(strm.PlaylistFile(), []byte("#EXTM3U\n#EXTINF:1.0,\n0.ts\n"), 0644))
+		res, b := get("/snapshot/audio")
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+		var dto ErrorDto
+		assert.Nil(t, json.Unmarshal(b, &dto))
+		assert.Equal(t, "audio_only", dto.Error.Code)
+	})
+
+	t.Run("Should snapshot the last segment of the stream", func(t *testing.T) {
+		strm := newStream("running", false)
+		playlist := "#EXTM3U\n#EXTINF:1.0,\n4.ts\n#EXTINF:1.0,\n5.ts\n"
+		assert.Nil(t, ioutil.WriteFile(strm.PlaylistFile(), []byte(playlist), 0644))
+		for i := 0; i < 2; i++ {
+			res, b := get("/snapshot/running")
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "image/jpeg", res.Header.Get("Content-Type"))
+			assert.Equal(t, "public, max-age=60", res.Header.Get("Cache-Control"))
+			assert.Equal(t, fmt.Sprintf("%s@320", filepath.Join(strm.StorePath, "5.ts")), string(b))
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&spawned))
+
+		res, b := get("/snapshot/running?width=640")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, fmt.Sprintf("%s@640", filepath.Join(strm.StorePath, "5.ts")), string(b))
+		for _, width := range []string{"0", "8", "4000", "wide"} {
+			res, _ := get("/snapshot/running?width=" + width)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, width)
+		}
+	})
+
+	t.Run("Should snapshot the source of encrypted streams", func(t *testing.T) {
+		strm := newStream("encrypted", true)
+		assert.Nil(t, ioutil.WriteFile(strm.PlaylistFile(), []byte("#EXTM3U\n#EXTINF:1.0,\n0.ts\n"), 0644))
+		res, b := get("/snapshot/encrypted")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, fmt.Sprintf("%s@320", strm.OriginalURI), string(b))
+	})
+}
@@ -0,0 +1,78 @@
+package sockets
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// ErrSocketInUse describes an error for a socket file another process is still listening on
+var ErrSocketInUse = errors.New("Socket is used by another process")
+
+// ErrNotSocket describes an error for a path of the socket taken by a file that is not a socket
+var ErrNotSocket = errors.New("Path of the socket is taken by a file that is not a socket")
+
+// loopback is the address the peers of the socket are seen with, they can only connect from the same host
+var loopback = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+// Listener is a Unix domain socket listener. The socket file is removed when it is closed
+type Listener struct {
+	net.Listener
+}
+
+// Accept waits for the next connection of the socket. The connections report the loopback address as their remote
+// address, so the access lists and the trusted proxies can name the peers of the socket as 127.0.0.1
+func (l Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return localConn{conn}, nil
+}
+
+// localConn is a connection of the socket seen from the loopback address
+type localConn struct {
+	net.Conn
+}
+
+// RemoteAddr returns the loopback address
+func (c localConn) RemoteAddr() net.Addr {
+	return loopback
+}
+
+// Listen creates the Unix domain socket on the given path with the given permissions. A socket file left behind by
+// a previous run is removed, but not if another process is still listening on it or if the file is not a socket
+func Listen(path string, mode os.FileMode) (*Listener, error) {
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &Listener{l}, nil
+}
+
+// removeStale removes the socket file on the path if nobody listens on it anymore
+func removeStale(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return ErrNotSocket
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return ErrSocketInUse
+	}
+	return os.Remove(path)
+}
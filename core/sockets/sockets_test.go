@@ -0,0 +1,79 @@
+package sockets
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// client returns an HTTP client sending every request to the socket on the given path
+func client(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestListen(t *testing.T) {
+	t.Run("Should serve the requests on the socket with the given permissions", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "sockets")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "rtsp-stream.sock")
+		listener, err := Listen(path, 0600)
+		if !assert.Nil(t, err) {
+			return
+		}
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.RemoteAddr))
+		})}
+		go server.Serve(listener)
+		res, err := client(path).Get("http://localhost/")
+		if assert.Nil(t, err) {
+			b, _ := ioutil.ReadAll(res.Body)
+			host, _, err := net.SplitHostPort(string(b))
+			assert.Nil(t, err)
+			assert.Equal(t, "127.0.0.1", host)
+		}
+
+		// The socket file is removed by the shutdown
+		assert.Nil(t, server.Shutdown(context.Background()))
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should remove the stale socket files only", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "sockets")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "rtsp-stream.sock")
+
+		// A socket that is not closed is left behind like after a crash
+		stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		assert.Nil(t, err)
+		stale.SetUnlinkOnClose(false)
+		_, err = Listen(path, 0660)
+		assert.Equal(t, ErrSocketInUse, err)
+		stale.Close()
+		listener, err := Listen(path, 0660)
+		if assert.Nil(t, err) {
+			listener.Close()
+		}
+
+		regular := filepath.Join(dir, "regular")
+		assert.Nil(t, ioutil.WriteFile(regular, []byte("data"), 0644))
+		_, err = Listen(regular, 0660)
+		assert.Equal(t, ErrNotSocket, err)
+		_, err = os.Stat(regular)
+		assert.Nil(t, err)
+	})
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/access"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// SourceDto describes the new source of a stream sent to PATCH /stream/:id. The URI left out keeps the current one,
+// so the credentials can be changed on their own
+type SourceDto struct {
+	URI string `json:"uri,omitempty"`
+	// Username and Password replace the credentials of the source, they are never sent back
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Probe indicates if the new source is probed before it replaces the current one, PROBE decides it if it is not given
+	Probe *bool `json:"probe,omitempty"`
+}
+
+// isSet indicates if the body changes the source
+func (dto SourceDto) isSet() bool {
+	return dto.URI != "" || dto.Username != "" || dto.Password != ""
+}
+
+// PatchDto describes the body of PATCH /stream/:id, which changes either the time to live or the source of the stream
+type PatchDto struct {
+	// TTL is the new time to live of the stream counted from the request, 0 removes it
+	TTL *TTLDto `json:"ttl,omitempty"`
+	SourceDto
+}
+
+// PatchStreamHandler is the HTTP handler of the PATCH /stream/:id call. It replaces the time to live of the stream,
+// which does not affect the transcoding, or its source or credentials, which restarts the transcoding. Both cannot be changed by the same request.
+// The body is read like the one of /start, limited to START_MAX_BODY_SIZE
+func (c *Controller) PatchStreamHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	var dto PatchDto
+	if status, err := decodeBody(w, r, int64(c.spec().StartMaxBodySize), &dto); err != nil {
+		c.SendError(w, err, status)
+		return
+	}
+	var response interface{}
+	switch {
+	case dto.TTL != nil && (dto.isSet() || dto.Probe != nil):
+		c.SendError(w, ErrTTLWithSource, http.StatusBadRequest)
+		return
+	case dto.TTL != nil:
+		response = c.replaceTTL(r.Context(), id, strm, *dto.TTL)
+	case dto.isSet():
+		updated, status, err := c.replaceSource(r.Context(), id, strm, dto.SourceDto)
+		if err != nil {
+			c.SendError(w, err, status)
+			return
+		}
+		response = updated
+	default:
+		c.SendError(w, ErrInvalidBody, http.StatusBadRequest)
+		return
+	}
+	b, _ := json.Marshal(response)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// replaceSource checks and probes the new source of the stream, then swaps it in. The running transcoding is restarted
+// with it, the stopped and paused streams use it once they are started again. The id, the directory and the playlist of the stream
+// stay the same. Returns the stream, or the status of the response and the error sent with it, the stream keeps its source then,
+// also if its transcoding cannot be restarted with the new one
+func (c *Controller) replaceSource(ctx context.Context, id string, strm *streaming.Stream, dto SourceDto) (StreamDto, int, error) {
+	source, fallbacks, info, status, err := c.checkSource(ctx, strm, dto)
+	if err != nil {
+		return StreamDto{}, status, err
+	}
+	swap := func(strm *streaming.Stream) func() {
+		strm.Mux.RLock()
+		previous, previousFallbacks, previousInfo := strm.OriginalURI, strm.Options.Fallbacks, strm.Options.Source
+		strm.Mux.RUnlock()
+		strm.SetSource(source, fallbacks, info)
+		c.logger(ctx).Infof("%s has a new source %s%s", id, streaming.RedactURI(source), requestedBy(apiKeyFromContext(ctx)))
+		return func() {
+			strm.SetSource(previous, previousFallbacks, previousInfo)
+			c.logger(ctx).Warnf("%s could not be restarted with the new source, it keeps %s", id, streaming.RedactURI(previous))
+		}
+	}
+	if strm.Streak.IsActive() && !strm.IsPaused() {
+		return c.restartWith(ctx, id, false, "source", swap)
+	}
+	if !c.restarting.begin(id) {
+		return StreamDto{}, http.StatusConflict, ErrStreamAlreadyActive
+	}
+	swap(strm)
+	strm.ResetErrored()
+	c.restarting.end(id)
+	c.persist()
+	return c.streamDto(ctx, strm, id), http.StatusOK, nil
+}
+
+// checkSource validates the new source of the stream like the ones of the starts and probes it if it has to.
+// Returns the URI the processes connect to, the URIs with the configured fallback credentials and the probed tracks,
+// which are nil if the source was not probed
+func (c *Controller) checkSource(ctx context.Context, strm *streaming.Stream, dto SourceDto) (string, []string, *streaming.SourceInfo, int, error) {
+	strm.Mux.RLock()
+	current, sdp, opts := strm.OriginalURI, strm.SDPPath, strm.Options
+	strm.Mux.RUnlock()
+	if sdp != "" {
+		return "", nil, nil, http.StatusConflict, ErrSourceFromSDP
+	}
+	uri := current
+	if dto.URI != "" {
+		normalized, err := c.sourceURI(&StreamDto{URI: dto.URI})
+		if err != nil {
+			return "", nil, nil, http.StatusBadRequest, err
+		}
+		uri = normalized
+	}
+	if dto.Username != "" || dto.Password != "" {
+		if dto.Username == "" || streaming.IsLocal(uri) {
+			return "", nil, nil, http.StatusBadRequest, ErrInvalidSourceCredentials
+		}
+		uri, _, _ = joinCredentials(uri, dto.Username, dto.Password)
+	}
+	if err := streaming.ValidateSRT(uri); err != nil {
+		return "", nil, nil, http.StatusBadRequest, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.spec().StartTimeout)
+	defer cancel()
+	source, err := c.pinSource(ctx, uri)
+	if err == access.ErrUnresolvedSource || err == ErrLocalSourceMissing {
+		return "", nil, nil, http.StatusUnprocessableEntity, err
+	}
+	if err != nil {
+		return "", nil, nil, http.StatusForbidden, err
+	}
+	// The fallback credentials of the start belong to the previous source, only the configured ones are kept
+	fallbacks, err := c.fallbackSources(source, nil)
+	if err != nil {
+		return "", nil, nil, http.StatusBadRequest, err
+	}
+	probe := c.spec().Probe
+	if dto.Probe != nil {
+		probe = *dto.Probe
+	}
+	if !probe || streaming.IsSRTListener(source) {
+		return source, fallbacks, nil, http.StatusOK, nil
+	}
+	info, err := c.probe(ctx, source, &opts)
+	if err != nil {
+		c.logger(ctx).Warnf("%s could not be probed, the source is kept || Error: %s", streaming.RedactURI(source), err)
+		return "", nil, nil, http.StatusUnprocessableEntity, err
+	}
+	return source, fallbacks, &info, http.StatusOK, nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// SRTDto describes the options of the SRT sources given apart from the URI. The passphrase is never sent back
+type SRTDto struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	Latency    int    `json:"latency,omitempty"` // Latency of the connection in milliseconds
+}
+
+// withSRT puts the SRT options of the request into the query of the URI of the source. Only the processes get the passphrase,
+// the stream is known by the URI without it. Returns the URI of the source and the URI of the stream
+func withSRT(source, bare string, options *SRTDto) (string, string, error) {
+	if !streaming.IsSRT(bare) {
+		if options != nil {
+			return "", "", ErrSRTOptions
+		}
+		return source, bare, nil
+	}
+	bare, _ = streaming.SplitPassphrase(bare)
+	if options != nil {
+		if options.Latency < 0 {
+			return "", "", streaming.ErrInvalidSRT
+		}
+		// The options of the body replace the ones of the URI
+		if options.Passphrase != "" {
+			source = streaming.SetQueryParam(source, "passphrase", url.QueryEscape(options.Passphrase))
+		}
+		// ffmpeg takes the latency in microseconds
+		if options.Latency > 0 {
+			latency := strconv.Itoa(options.Latency * 1000)
+			source, bare = streaming.SetQueryParam(source, "latency", latency), streaming.SetQueryParam(bare, "latency", latency)
+		}
+	}
+	return source, bare, streaming.ValidateSRT(source)
+}
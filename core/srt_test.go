@@ -0,0 +1,108 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSRT(t *testing.T) {
+	tt := []struct {
+		URI     string
+		Options *SRTDto
+		Source  string
+		Bare    string
+		Err     error
+	}{
+		{
+			URI:    "srt://192.168.0.1:9000?mode=caller",
+			Source: "srt://192.168.0.1:9000?mode=caller",
+			Bare:   "srt://192.168.0.1:9000?mode=caller",
+		},
+		{
+			URI:    "srt://192.168.0.1:9000?passphrase=0123456789&mode=caller",
+			Source: "srt://192.168.0.1:9000?passphrase=0123456789&mode=caller",
+			Bare:   "srt://192.168.0.1:9000?mode=caller",
+		},
+		{
+			URI:     "srt://192.168.0.1:9000?passphrase=0123456789",
+			Options: &SRTDto{Passphrase: "s3cr3t pass&phrase", Latency: 200},
+			Source:  "srt://192.168.0.1:9000?passphrase=s3cr3t+pass%26phrase&latency=200000",
+			Bare:    "srt://192.168.0.1:9000?latency=200000",
+		},
+		{URI: "srt://192.168.0.1:9000", Options: &SRTDto{Passphrase: "short"}, Err: streaming.ErrInvalidSRT},
+		{URI: "srt://192.168.0.1:9000", Options: &SRTDto{Latency: -1}, Err: streaming.ErrInvalidSRT},
+		{URI: "rtsp://192.168.0.1/live", Options: &SRTDto{Latency: 200}, Err: ErrSRTOptions},
+	}
+	for _, testCase := range tt {
+		source, bare, err := withSRT(testCase.URI, testCase.URI, testCase.Options)
+		assert.Equal(t, testCase.Err, err, testCase.URI)
+		if err == nil {
+			assert.Equal(t, testCase.Source, source, testCase.URI)
+			assert.Equal(t, testCase.Bare, bare, testCase.URI)
+		}
+	}
+}
+
+func TestStartSRT(t *testing.T) {
+	setup := func() *Controller {
+		conf := *config.InitConfig()
+		conf.Probe = true
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		// Only the listeners can be started, every probe fails
+		ctrls.processor = mockProcessor{probeErr: errors.New("Connection setup failure: connection timed out")}
+		return ctrls
+	}
+	start := func(ctrls *Controller, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", strings.NewReader(body)), nil)
+		return rr
+	}
+
+	t.Run("Should start the listeners without probing them and keep the passphrase to the processes", func(t *testing.T) {
+		ctrls := setup()
+		rr := start(ctrls, `{"uri": "srt://192.168.0.1:9000?mode=listener", "srt": {"passphrase": "s3cr3tphrase", "latency": 120}}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "s3cr3tphrase")
+		dir, err := streaming.GetURIDirectory("srt://192.168.0.1:9000?mode=listener&latency=120000")
+		assert.Nil(t, err)
+		strm, ok := ctrls.getStream(dir)
+		if assert.True(t, ok) {
+			assert.Equal(t, "srt://192.168.0.1:9000?mode=listener&passphrase=s3cr3tphrase&latency=120000", strm.OriginalURI)
+		}
+
+		list := httptest.NewRecorder()
+		ctrls.ListStreamHandler(list, httptest.NewRequest(http.MethodGet, "/list", nil), nil)
+		assert.Equal(t, http.StatusOK, list.Code)
+		assert.NotContains(t, list.Body.String(), "s3cr3tphrase")
+		assert.Contains(t, list.Body.String(), "passphrase=***")
+	})
+
+	t.Run("Should probe the callers", func(t *testing.T) {
+		rr := start(setup(), `{"uri": "srt://192.168.0.1:9000?mode=caller&passphrase=s3cr3tphrase"}`)
+		assert.NotEqual(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "s3cr3tphrase")
+	})
+
+	t.Run("Should refuse the invalid options", func(t *testing.T) {
+		for _, body := range []string{
+			`{"uri": "srt://192.168.0.1:9000", "srt": {"passphrase": "short"}}`,
+			`{"uri": "srt://192.168.0.1:9000?latency=soon"}`,
+			`{"uri": "rtsp://192.168.0.1/live", "srt": {"latency": 120}}`,
+		} {
+			rr := start(setup(), body)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+			var errDto ErrorDto
+			assert.Nil(t, json.NewDecoder(rr.Body).Decode(&errDto))
+			assert.Equal(t, "invalid_options", errDto.Error.Code, body)
+		}
+	})
+}
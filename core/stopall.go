@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// Results of the streams of POST /admin/stopAll
+const (
+	stopAllStopped  = "stopped"
+	stopAllInactive = "inactive"
+	stopAllFailed   = "failed"
+)
+
+// StopAllDto describes the outcome of the stop of every stream, or the streams that would be stopped in the dry run
+type StopAllDto struct {
+	DryRun   bool               `json:"dryRun"`
+	Stopped  int                `json:"stopped"`
+	Inactive int                `json:"inactive"`
+	Failed   int                `json:"failed"`
+	Streams  []StopAllResultDto `json:"streams"`
+}
+
+// StopAllResultDto describes the outcome of the stop of a stream: stopped, inactive if it was not running or failed
+type StopAllResultDto struct {
+	ID     string        `json:"id"`
+	Result string        `json:"result"`
+	Error  *ErrorBodyDto `json:"error,omitempty"`
+}
+
+// stopAllQuery describes the parameters of the stop of every stream
+type stopAllQuery struct {
+	wipe   bool
+	grace  time.Duration
+	dryRun bool
+}
+
+// parseStopAllQuery reads the parameters of the stop of every stream, the grace period defaults to SHUTDOWN_GRACE
+func parseStopAllQuery(values url.Values, grace time.Duration) (stopAllQuery, error) {
+	query := stopAllQuery{grace: grace}
+	var err error
+	if value := values.Get("wipe"); value != "" {
+		if query.wipe, err = strconv.ParseBool(value); err != nil {
+			return query, ErrInvalidStopAllQuery
+		}
+	}
+	if value := values.Get("dryRun"); value != "" {
+		if query.dryRun, err = strconv.ParseBool(value); err != nil {
+			return query, ErrInvalidStopAllQuery
+		}
+	}
+	if value := values.Get("graceSeconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return query, ErrInvalidStopAllQuery
+		}
+		query.grace = time.Duration(seconds) * time.Second
+	}
+	return query, nil
+}
+
+// StopAllHandler is the HTTP handler of the POST /admin/stopAll call, which stops the transcoding of every running stream.
+// The streams stay registered, so they can be spun up again once the maintenance is over
+func (c *Controller) StopAllHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	query, err := parseStopAllQuery(r.URL.Query(), c.spec().ShutdownGrace)
+	if err != nil {
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	var dto StopAllDto
+	if query.dryRun {
+		dto = c.previewStopAll()
+	} else {
+		// Nothing is spawned until every stream is stopped, by the starts, the cleanup or the supervision
+		if !c.spawns.close() {
+			c.SendError(w, ErrStoppingAll, http.StatusConflict)
+			return
+		}
+		c.logger(r.Context()).Infof("Every stream is getting stopped%s", requestedBy(apiKeyName(r)))
+		dto = c.stopAll(r.Context(), query)
+		c.spawns.open()
+		c.logger(r.Context()).Infof("%d streams are stopped, %d were inactive, %d failed", dto.Stopped, dto.Inactive, dto.Failed)
+	}
+	status := http.StatusOK
+	if dto.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	b, _ := json.Marshal(dto)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// sortedStreams returns the ids of the streams in order, with the streams keyed by their id
+func (c *Controller) sortedStreams() ([]string, map[string]*streaming.Stream) {
+	streams := c.snapshotStreams()
+	ids := make([]string, 0, len(streams))
+	for id := range streams {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, streams
+}
+
+// previewStopAll lists the streams that would be stopped, without stopping them
+func (c *Controller) previewStopAll() StopAllDto {
+	ids, streams := c.sortedStreams()
+	dto := StopAllDto{DryRun: true, Streams: make([]StopAllResultDto, len(ids))}
+	for i, id := range ids {
+		dto.Streams[i] = StopAllResultDto{ID: id, Result: stopAllInactive}
+		if streams[id].Streak.IsActive() {
+			dto.Streams[i].Result = stopAllStopped
+		}
+	}
+	dto.count()
+	return dto
+}
+
+// stopAll stops the transcoding and the recording of every running stream, BATCH_PARALLELISM at a time.
+// The processes are killed if they do not exit within the grace period
+func (c *Controller) stopAll(ctx context.Context, query stopAllQuery) StopAllDto {
+	ids, streams := c.sortedStreams()
+	dto := StopAllDto{Streams: make([]StopAllResultDto, len(ids))}
+	c.inParallel(len(ids), func(i int) {
+		id, strm := ids[i], streams[ids[i]]
+		dto.Streams[i] = StopAllResultDto{ID: id, Result: stopAllInactive}
+		if !strm.Streak.IsActive() {
+			return
+		}
+		if err := strm.StopRecording(); err != nil {
+			c.logger(ctx).Error(err)
+		}
+		stopCtx, cancel := context.WithTimeout(context.Background(), query.grace)
+		err := strm.Stop(stopCtx, true)
+		cancel()
+		if err != nil {
+			c.logger(ctx).Errorf("Could not stop %s || Error: %s", id, err)
+			dto.Streams[i].Result = stopAllFailed
+			dto.Streams[i].Error = &ErrorBodyDto{errorCode(ErrUnexpected, http.StatusInternalServerError), streaming.RedactURI(err.Error()), ""}
+			return
+		}
+		if query.wipe {
+			strm.ClearFiles()
+		}
+		c.metrics.RemoveStream(id)
+		c.refreshUsage(id)
+		dto.Streams[i].Result = stopAllStopped
+		c.publishBy(ctx, events.Inactive, id, strm, "stopAll")
+	})
+	dto.count()
+	c.persist()
+	return dto
+}
+
+// count sums the results of the streams
+func (dto *StopAllDto) count() {
+	for _, result := range dto.Streams {
+		switch result.Result {
+		case stopAllStopped:
+			dto.Stopped++
+		case stopAllInactive:
+			dto.Inactive++
+		default:
+			dto.Failed++
+		}
+	}
+}
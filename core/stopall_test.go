@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestParseStopAllQuery(t *testing.T) {
+	tt := []struct {
+		Query    string
+		Expected stopAllQuery
+		Err      error
+	}{
+		{Query: "", Expected: stopAllQuery{grace: time.Second * 5}},
+		{Query: "wipe=true&graceSeconds=0", Expected: stopAllQuery{wipe: true}},
+		{Query: "dryRun=true&graceSeconds=30", Expected: stopAllQuery{dryRun: true, grace: time.Second * 30}},
+		{Query: "wipe=maybe", Err: ErrInvalidStopAllQuery},
+		{Query: "dryRun=maybe", Err: ErrInvalidStopAllQuery},
+		{Query: "graceSeconds=-1", Err: ErrInvalidStopAllQuery},
+		{Query: "graceSeconds=1s", Err: ErrInvalidStopAllQuery},
+	}
+	for i, test := range tt {
+		values, _ := url.ParseQuery(test.Query)
+		query, err := parseStopAllQuery(values, time.Second*5)
+		if !assert.Equal(t, test.Err, err) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestParseStopAllQuery", i))
+		}
+		if test.Err == nil && !assert.Equal(t, test.Expected, query) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestParseStopAllQuery", i))
+		}
+	}
+}
+
+func TestStopAllHandler(t *testing.T) {
+	setup := func(t *testing.T) (*Controller, []*streaming.Stream, func()) {
+		ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		streams := []*streaming.Stream{}
+		dirs := []string{}
+		for i := 0; i < 3; i++ {
+			generated := generateStream(nil, fmt.Sprintf("rtsp://192.168.0.%d/live", 10+i))
+			dir, err := ioutil.TempDir("", "stopall")
+			assert.Nil(t, err)
+			assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U"), 0644))
+			generated.strm.StorePath = dir
+			generated.strm.KeepFiles = true
+			// The last stream is not running
+			if i < 2 {
+				startFake(&generated.strm)
+				generated.strm.Streak.Activate().Hit()
+			}
+			ctrls.streams[generated.dirPath] = &generated.strm
+			streams = append(streams, &generated.strm)
+			dirs = append(dirs, dir)
+		}
+		return ctrls, streams, func() {
+			for _, dir := range dirs {
+				os.RemoveAll(dir)
+			}
+			ctrls.Shutdown(context.Background())
+		}
+	}
+	stopAll := func(ctrls *Controller, query string) (*httptest.ResponseRecorder, StopAllDto) {
+		rr := httptest.NewRecorder()
+		ctrls.StopAllHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/stopAll"+query, nil), nil)
+		var dto StopAllDto
+		json.Unmarshal(rr.Body.Bytes(), &dto)
+		return rr, dto
+	}
+
+	t.Run("Should only list the running streams in the dry run", func(t *testing.T) {
+		ctrls, streams, teardown := setup(t)
+		defer teardown()
+		rr, dto := stopAll(ctrls, "?dryRun=true")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.True(t, dto.DryRun)
+		assert.Equal(t, 2, dto.Stopped)
+		assert.Equal(t, 1, dto.Inactive)
+		assert.Len(t, dto.Streams, 3)
+		for _, strm := range streams[:2] {
+			assert.True(t, strm.IsProcessAlive())
+		}
+	})
+
+	t.Run("Should stop every running stream and keep them registered", func(t *testing.T) {
+		ctrls, streams, teardown := setup(t)
+		defer teardown()
+		rr, dto := stopAll(ctrls, "?graceSeconds=1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.False(t, dto.DryRun)
+		assert.Equal(t, 2, dto.Stopped)
+		assert.Equal(t, 1, dto.Inactive)
+		assert.Equal(t, 0, dto.Failed)
+		for _, strm := range streams {
+			assert.False(t, strm.IsProcessAlive())
+			assert.False(t, strm.Streak.IsActive())
+			_, err := os.Stat(strm.PlaylistFile())
+			assert.Nil(t, err)
+		}
+		assert.Len(t, ctrls.snapshotStreams(), 3)
+
+		// The streams can be started once the stop is done
+		b, _ := json.Marshal(StreamDto{URI: "rtsp://192.168.0.20/live"})
+		rr = httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Should wipe the files of the stopped streams if it is asked to", func(t *testing.T) {
+		ctrls, streams, teardown := setup(t)
+		defer teardown()
+		rr, _ := stopAll(ctrls, "?wipe=true&graceSeconds=0")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		for i, strm := range streams {
+			_, err := os.Stat(strm.PlaylistFile())
+			assert.Equal(t, i < 2, os.IsNotExist(err))
+		}
+	})
+
+	t.Run("Should refuse the spawns while every stream is being stopped", func(t *testing.T) {
+		ctrls, streams, teardown := setup(t)
+		defer teardown()
+		assert.True(t, ctrls.spawns.close())
+
+		rr, _ := stopAll(ctrls, "")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "stopping_all")
+		b, _ := json.Marshal(StreamDto{URI: "rtsp://192.168.0.20/live"})
+		rr = httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		id, _ := streaming.GetURIDirectory("rtsp://192.168.0.12/live")
+		_, status, err := ctrls.restartStream(context.Background(), id, false)
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, ErrStoppingAll, err)
+
+		// The cleanup does not stop the idle streams meanwhile
+		streams[0].Streak.Deactivate()
+		ctrls.cleanUnused()
+		assert.True(t, streams[0].IsProcessAlive())
+		ctrls.spawns.open()
+		ctrls.cleanUnused()
+		assert.False(t, streams[0].IsProcessAlive())
+	})
+}
+
+func TestSpawnGate(t *testing.T) {
+	gate := newSpawnGate()
+	assert.True(t, gate.enter())
+	closed := make(chan struct{})
+	go func() {
+		gate.close()
+		close(closed)
+	}()
+	// Closing waits for the spawns in progress
+	select {
+	case <-closed:
+		t.Error("Gate is closed before the spawn left")
+	case <-time.After(50 * time.Millisecond):
+	}
+	gate.leave()
+	<-closed
+	assert.False(t, gate.enter())
+	assert.False(t, gate.close())
+	gate.open()
+	assert.True(t, gate.enter())
+	gate.leave()
+}
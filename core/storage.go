@@ -0,0 +1,66 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/storage"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/sirupsen/logrus"
+)
+
+// newStorage creates the storage the files of the streams are uploaded to, nil if they are only kept on the disk
+func newStorage(spec config.Storage) storage.Storage {
+	switch spec.Backend {
+	case storage.BackendDisk, "":
+		return nil
+	case storage.BackendS3:
+		s3, err := storage.NewS3(spec)
+		if err != nil {
+			logrus.Fatal("Could not create S3 storage: ", err)
+		}
+		return s3
+	}
+	logrus.Fatal(storage.ErrInvalidBackend)
+	return nil
+}
+
+// syncStream starts uploading the files of the stream to the storage if there is one
+func (c *Controller) syncStream(id string, strm *streaming.Stream) {
+	if c.storage == nil {
+		return
+	}
+	syncer := storage.NewSyncer(c.storage, strm.StorePath, id, c.spec().SyncInterval)
+	c.mux.Lock()
+	previous, ok := c.syncers[id]
+	c.syncers[id] = syncer
+	c.mux.Unlock()
+	if ok {
+		previous.Stop()
+	}
+	go syncer.Run(c.done)
+}
+
+// unsyncStream stops uploading the files of the stream, removing the uploaded ones unless the files are kept
+func (c *Controller) unsyncStream(id string) {
+	c.mux.Lock()
+	syncer, ok := c.syncers[id]
+	delete(c.syncers, id)
+	c.mux.Unlock()
+	if !ok {
+		return
+	}
+	syncer.Stop()
+	if !c.spec().KeepFiles {
+		go syncer.Purge()
+	}
+}
+
+// remoteURI returns the URI of the playlist on the given path in the storage, empty if the files are served by the service
+func (c *Controller) remoteURI(path, id string) string {
+	if c.storage == nil || c.spec().S3PublicURL == "" {
+		return ""
+	}
+	playlist := strings.TrimPrefix(path, "/stream/"+id)
+	return strings.TrimRight(c.spec().S3PublicURL, "/") + "/" + id + playlist
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// ErrRequestFailedFn is used to create dynamic errors for failed requests to the bucket
+var ErrRequestFailedFn = func(method, key string, status int, code string) error {
+	return fmt.Errorf("%s of %s failed with %d: %s", method, key, status, code)
+}
+
+// S3 uploads the files to an S3 compatible bucket with the client of the AWS SDK, which signs the requests
+type S3 struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+// Type check
+var _ Storage = (*S3)(nil)
+
+// NewS3 creates a new instance of S3. Without an access key the credentials are looked up by the SDK,
+// like the environment variables of AWS or the role of the instance
+func NewS3(spec config.Storage) (*S3, error) {
+	conf := &aws.Config{
+		Endpoint:         aws.String(spec.S3Endpoint),
+		Region:           aws.String(spec.S3Region),
+		S3ForcePathStyle: aws.Bool(spec.S3PathStyle),
+		HTTPClient:       &http.Client{Timeout: time.Second * 30},
+	}
+	if spec.S3AccessKey != "" {
+		conf.Credentials = credentials.NewStaticCredentials(spec.S3AccessKey, spec.S3SecretKey, "")
+	}
+	sess, err := session.NewSession(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{
+		s3.New(sess),
+		spec.S3Bucket,
+		strings.Trim(spec.S3Prefix, "/"),
+	}, nil
+}
+
+// Put uploads the content to the given key
+func (s *S3) Put(key string, content []byte, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.object(key)),
+		Body:   bytes.NewReader(content),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	_, err := s.client.PutObject(input)
+	return requestError(http.MethodPut, key, err)
+}
+
+// Delete removes the object with the given key
+func (s *S3) Delete(key string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.object(key)),
+	})
+	return requestError(http.MethodDelete, key, err)
+}
+
+// object returns the key of the object in the bucket, under the prefix if there is one
+func (s *S3) object(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+// requestError returns the error of the request to the bucket, the ones refused by the bucket are described with their status and code
+func requestError(method, key string, err error) error {
+	if failure, ok := err.(awserr.RequestFailure); ok {
+		return ErrRequestFailedFn(method, key, failure.StatusCode(), failure.Code())
+	}
+	return err
+}
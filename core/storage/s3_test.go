@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3(t *testing.T) {
+	type request struct {
+		method      string
+		path        string
+		body        string
+		contentType string
+		auth        string
+	}
+	requests := make(chan request, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.Method, r.URL.EscapedPath(), string(body), r.Header.Get("Content-Type"), r.Header.Get("Authorization")}
+		if strings.HasSuffix(r.URL.Path, "denied.ts") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s3, err := NewS3(config.Storage{
+		S3Endpoint:  server.URL,
+		S3Region:    "eu-central-1",
+		S3Bucket:    "videos",
+		S3Prefix:    "/live/",
+		S3AccessKey: "access",
+		S3SecretKey: "secret",
+		S3PathStyle: true,
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, s3.Put("id/index.m3u8", []byte("#EXTM3U"), "application/vnd.apple.mpegurl"))
+	put := <-requests
+	assert.Equal(t, http.MethodPut, put.method)
+	assert.Equal(t, "/videos/live/id/index.m3u8", put.path)
+	assert.Equal(t, "#EXTM3U", put.body)
+	assert.Equal(t, "application/vnd.apple.mpegurl", put.contentType)
+	assert.Contains(t, put.auth, "Credential=access/")
+	assert.Contains(t, put.auth, "/eu-central-1/s3/aws4_request")
+	assert.Contains(t, put.auth, "content-type;host;")
+
+	assert.Nil(t, s3.Delete("id/0.ts"))
+	del := <-requests
+	assert.Equal(t, http.MethodDelete, del.method)
+	assert.Equal(t, "/videos/live/id/0.ts", del.path)
+
+	err = s3.Put("id/denied.ts", []byte("segment"), "video/mp2t")
+	<-requests
+	assert.EqualError(t, err, "PUT of id/denied.ts failed with 403: AccessDenied")
+}
+
+func TestS3Credentials(t *testing.T) {
+	auth := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+	os.Setenv("AWS_ACCESS_KEY_ID", "environment")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	// Without an access key the credentials of the environment are used
+	s3, err := NewS3(config.Storage{S3Endpoint: server.URL, S3Region: "us-east-1", S3Bucket: "videos", S3PathStyle: true})
+	assert.Nil(t, err)
+	assert.Nil(t, s3.Delete("id/0.ts"))
+	assert.Contains(t, <-auth, "Credential=environment/")
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// BackendDisk keeps the files of the streams only in the store directory
+const BackendDisk = "disk"
+
+// BackendS3 uploads the files of the streams to an S3 compatible bucket
+const BackendS3 = "s3"
+
+// ErrInvalidBackend describes an error for unknown storage backends
+var ErrInvalidBackend = errors.New("Storage backend has to be disk or s3")
+
+// Storage describes a remote backend the files of the streams are uploaded to
+type Storage interface {
+	Put(key string, content []byte, contentType string) error
+	Delete(key string) error
+}
+
+// contentTypes are the content types of the files of the streams
+var contentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+	".vtt":  "text/vtt",
+	".jpg":  "image/jpeg",
+}
+
+// contentType returns the content type of the file, empty if it is not a file of the streams
+func contentType(path string) string {
+	return contentTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+// isPlaylist is for deciding if the file is an HLS playlist or an MPEG-DASH manifest
+func isPlaylist(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".m3u8" || ext == ".mpd"
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fileState describes the version of a file that has been uploaded
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Syncer mirrors the output directory of a stream to the storage. New and changed files
+// are uploaded, segments before playlists so the playlists never refer to missing segments,
+// and the files removed locally are deleted from the storage as well
+type Syncer struct {
+	storage  Storage
+	dir      string
+	prefix   string
+	interval time.Duration
+	mux      *sync.Mutex
+	uploaded map[string]fileState
+	stop     chan struct{}
+	once     *sync.Once
+}
+
+// NewSyncer creates a new instance of Syncer, mirroring the directory under the given prefix
+func NewSyncer(storage Storage, dir, prefix string, interval time.Duration) *Syncer {
+	return &Syncer{
+		storage,
+		dir,
+		prefix,
+		interval,
+		&sync.Mutex{},
+		map[string]fileState{},
+		make(chan struct{}),
+		&sync.Once{},
+	}
+}
+
+// Run mirrors the directory periodically until the syncer or the given channel is stopped
+func (s *Syncer) Run(done <-chan struct{}) {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-done:
+			return
+		case <-time.After(s.interval):
+			s.Sync()
+		}
+	}
+}
+
+// Stop stops the periodic mirroring of the directory
+func (s *Syncer) Stop() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// Sync mirrors the current state of the directory to the storage
+func (s *Syncer) Sync() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	files := s.list()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	// Segments are uploaded first, so the uploaded playlists can be played right away
+	sort.Slice(names, func(i, j int) bool {
+		if isPlaylist(names[i]) != isPlaylist(names[j]) {
+			return !isPlaylist(names[i])
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		state := files[name]
+		if uploaded, ok := s.uploaded[name]; ok && uploaded == state {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		if err := s.storage.Put(s.key(name), content, contentType(name)); err != nil {
+			logrus.Errorf("%s could not be uploaded || Error: %s", s.key(name), err)
+			continue
+		}
+		s.uploaded[name] = state
+	}
+	for name := range s.uploaded {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		s.delete(name)
+	}
+}
+
+// Purge deletes every uploaded file from the storage
+func (s *Syncer) Purge() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for name := range s.uploaded {
+		s.delete(name)
+	}
+}
+
+// delete removes the uploaded file from the storage
+func (s *Syncer) delete(name string) {
+	if err := s.storage.Delete(s.key(name)); err != nil {
+		logrus.Errorf("%s could not be deleted || Error: %s", s.key(name), err)
+		return
+	}
+	delete(s.uploaded, name)
+}
+
+// key returns the key of the file in the storage
+func (s *Syncer) key(name string) string {
+	return s.prefix + "/" + name
+}
+
+// list returns the files of the streams in the directory with their slash separated relative paths.
+// A missing directory has no files
+func (s *Syncer) list() map[string]fileState {
+	files := map[string]fileState{}
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || contentType(path) == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return nil
+		}
+		files[filepath.ToSlash(rel)] = fileState{info.Size(), info.ModTime()}
+		return nil
+	})
+	return files
+}
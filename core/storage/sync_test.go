@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStorage keeps the uploaded objects in memory
+type memoryStorage struct {
+	mux     *sync.Mutex
+	objects map[string]string
+	puts    []string
+}
+
+func (m *memoryStorage) Put(key string, content []byte, contentType string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.objects[key] = string(content)
+	m.puts = append(m.puts, key)
+	return nil
+}
+
+func (m *memoryStorage) Delete(key string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func TestSyncer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "720p"), os.ModePerm))
+	write := func(name, content string) {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644))
+	}
+	write("index.m3u8", "#EXTM3U\n0.ts\n")
+	write("0.ts", "first")
+	write("720p/index.m3u8", "#EXTM3U\n0.ts\n")
+	write("720p/0.ts", "first")
+	write("index.m3u8.tmp", "partial")
+
+	storage := &memoryStorage{&sync.Mutex{}, map[string]string{}, []string{}}
+	syncer := NewSyncer(storage, dir, "id", time.Millisecond*10)
+
+	t.Run("Should upload the segments before the playlists", func(t *testing.T) {
+		syncer.Sync()
+		assert.Equal(t, []string{"id/0.ts", "id/720p/0.ts", "id/720p/index.m3u8", "id/index.m3u8"}, storage.puts)
+		assert.Equal(t, "first", storage.objects["id/0.ts"])
+	})
+
+	t.Run("Should only upload changed files and delete the removed ones", func(t *testing.T) {
+		storage.puts = []string{}
+		write("1.ts", "second")
+		write("index.m3u8", "#EXTM3U\n1.ts\n")
+		assert.Nil(t, os.Remove(filepath.Join(dir, "0.ts")))
+		syncer.Sync()
+		assert.Equal(t, []string{"id/1.ts", "id/index.m3u8"}, storage.puts)
+		_, ok := storage.objects["id/0.ts"]
+		assert.False(t, ok)
+		assert.Equal(t, "#EXTM3U\n1.ts\n", storage.objects["id/index.m3u8"])
+	})
+
+	t.Run("Should upload periodically until it is stopped", func(t *testing.T) {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			syncer.Run(done)
+			close(stopped)
+		}()
+		write("2.ts", "third")
+		<-time.After(100 * time.Millisecond)
+		storage.mux.Lock()
+		assert.Equal(t, "third", storage.objects["id/2.ts"])
+		storage.mux.Unlock()
+		syncer.Stop()
+		syncer.Stop()
+		<-stopped
+	})
+
+	t.Run("Should delete every uploaded file when purged", func(t *testing.T) {
+		syncer.Purge()
+		assert.Len(t, storage.objects, 0)
+	})
+
+	t.Run("Should delete the uploaded files if the directory is removed", func(t *testing.T) {
+		syncer.Sync()
+		assert.NotEmpty(t, storage.objects)
+		assert.Nil(t, os.RemoveAll(dir))
+		syncer.Sync()
+		assert.Len(t, storage.objects, 0)
+	})
+}
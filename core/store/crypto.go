@@ -0,0 +1,59 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// ErrMissingKey is returned when the credentials of the streams would be stored or loaded without a key to encrypt them with
+var ErrMissingKey = errors.New("Streams with credentials cannot be stored without PERSISTENCE_KEY or PERSISTENCE_KEY_FILE")
+
+// ErrUndecryptable is returned when the stored credentials cannot be decrypted, like with another key or after they were changed
+var ErrUndecryptable = errors.New("Credentials of the stream cannot be decrypted")
+
+// Cipher encrypts the credentials of the stored streams with AES-GCM, so they cannot be read or changed without the key.
+// The id of the stream is authenticated with them, so they cannot be moved to another stream either
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a new instance of Cipher with the 32 byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead}, nil
+}
+
+// Seal encrypts the text of the stream with the given id, the nonce is put before the encrypted text
+func (c *Cipher) Seal(text, id string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(text), []byte(id))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts the text sealed for the stream with the given id
+func (c *Cipher) Open(sealed, id string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < c.aead.NonceSize() {
+		return "", ErrUndecryptable
+	}
+	size := c.aead.NonceSize()
+	text, err := c.aead.Open(nil, b[:size], b[size:], []byte(id))
+	if err != nil {
+		return "", ErrUndecryptable
+	}
+	return string(text), nil
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/sirupsen/logrus"
+)
+
+// Record describes a stream registration that has to survive a restart of the service
+type Record struct {
+	ID        string            `json:"id"`
+	URI       string            `json:"uri"`
+	Directory string            `json:"directory"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Running   bool              `json:"running"`             // Indicates if the stream should be resumed after a restart
+	Canonical string            `json:"canonical,omitempty"` // Id derived from the URI of the stream, set if the stream has an alias
+	Options   streaming.Options `json:"options"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Token     string            `json:"token,omitempty"`     // Playback token of the stream, so the clients watching it keep their access
+	ExpiresAt *time.Time        `json:"expiresAt,omitempty"` // End of the time to live of the stream, it is not recovered afterwards
+	// Paused indicates if the transcoding of the stream was paused, it is not resumed after a restart then
+	Paused bool `json:"paused,omitempty"`
+	// Evicted indicates if the stream was paused to make room for a stream with a higher priority, it is resumed once a slot is free
+	Evicted bool `json:"evicted,omitempty"`
+	// Disabled indicates if the stream was switched off until it is enabled, it stays paused after a restart
+	Disabled bool   `json:"disabled,omitempty"`
+	Group    string `json:"group,omitempty"` // Group the stream belongs to
+	// Credentials are the encrypted credentials of the URI, the URI is stored without them. Empty if the URI has none
+	Credentials string `json:"credentials,omitempty"`
+	// Passphrase is the encrypted passphrase of the SRT URI, the URI is stored without it. Empty if the URI has none
+	Passphrase string `json:"passphrase,omitempty"`
+	// PushTarget is the encrypted push target of the options, the whole URL is secret since its path can be the stream key.
+	// The options are stored without it. Empty if the stream is not pushed
+	PushTarget string `json:"pushTarget,omitempty"`
+}
+
+// FileStore keeps the stream registrations in a JSON file
+type FileStore struct {
+	path   string
+	mux    *sync.Mutex
+	cipher *Cipher // Encrypts the credentials of the URIs, nil if no key is configured
+}
+
+// NewFileStore creates a new instance of FileStore, the credentials of the URIs are encrypted with the cipher.
+// Without a cipher the streams with credentials cannot be stored
+func NewFileStore(path string, cipher *Cipher) *FileStore {
+	return &FileStore{path, &sync.Mutex{}, cipher}
+}
+
+// Load returns the stored registrations. It returns an empty list if nothing has been stored yet.
+// The registrations whose credentials cannot be decrypted are moved to the quarantine file instead of failing the whole load.
+// The ones stored with their credentials in plain text are loaded as they are, they are encrypted by the next save
+func (s *FileStore) Load() ([]Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	records := []Record{}
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raws := []json.RawMessage{}
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return nil, err
+	}
+	quarantined := []json.RawMessage{}
+	for _, raw := range raws {
+		var record Record
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, err
+		}
+		if err := s.open(&record); err != nil {
+			logrus.Errorf("%s is quarantined in %s || Error: %s", record.ID, s.quarantinePath(), err)
+			quarantined = append(quarantined, raw)
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := s.quarantine(quarantined); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Save replaces the stored registrations with the given ones, encrypting their credentials.
+// The file is replaced atomically, so a crash cannot leave a partial file behind
+func (s *FileStore) Save(records []Record) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	sealed := make([]Record, len(records))
+	for i, record := range records {
+		if err := s.seal(&record); err != nil {
+			return err
+		}
+		sealed[i] = record
+	}
+	b, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+	return s.write(s.path, b)
+}
+
+// seal encrypts the credentials and the SRT passphrase of the URI of the record and its push target,
+// the stored file is left alone if they cannot be encrypted
+func (s *FileStore) seal(record *Record) error {
+	bare, userinfo := streaming.SplitCredentials(record.URI)
+	bare, passphrase := streaming.SplitPassphrase(bare)
+	if userinfo == "" && passphrase == "" && record.Options.Push == "" {
+		return nil
+	}
+	if s.cipher == nil {
+		return ErrMissingKey
+	}
+	var err error
+	if record.Options.Push != "" {
+		if record.PushTarget, err = s.cipher.Seal(record.Options.Push, record.ID); err != nil {
+			return err
+		}
+		record.Options.Push = ""
+	}
+	if userinfo != "" {
+		if record.Credentials, err = s.cipher.Seal(userinfo, record.ID); err != nil {
+			return err
+		}
+	}
+	if passphrase != "" {
+		if record.Passphrase, err = s.cipher.Seal(passphrase, record.ID); err != nil {
+			return err
+		}
+	}
+	record.URI = bare
+	return nil
+}
+
+// open decrypts the credentials and the SRT passphrase of the record and puts them back into its URI, and the push target into its options
+func (s *FileStore) open(record *Record) error {
+	if record.Credentials == "" && record.Passphrase == "" && record.PushTarget == "" {
+		return nil
+	}
+	if s.cipher == nil {
+		return ErrMissingKey
+	}
+	if record.PushTarget != "" {
+		push, err := s.cipher.Open(record.PushTarget, record.ID)
+		if err != nil {
+			return err
+		}
+		record.Options.Push, record.PushTarget = push, ""
+	}
+	if record.Credentials != "" {
+		userinfo, err := s.cipher.Open(record.Credentials, record.ID)
+		if err != nil {
+			return err
+		}
+		i := strings.Index(record.URI, "://") + len("://")
+		record.URI, record.Credentials = record.URI[:i]+userinfo+"@"+record.URI[i:], ""
+	}
+	if record.Passphrase != "" {
+		passphrase, err := s.cipher.Open(record.Passphrase, record.ID)
+		if err != nil {
+			return err
+		}
+		record.URI, record.Passphrase = streaming.SetQueryParam(record.URI, "passphrase", passphrase), ""
+	}
+	return nil
+}
+
+// quarantinePath returns the path of the file keeping the registrations that could not be loaded
+func (s *FileStore) quarantinePath() string {
+	return s.path + ".quarantine"
+}
+
+// quarantine adds the registrations to the quarantine file, so they can be recovered by hand, like with the right key
+func (s *FileStore) quarantine(raws []json.RawMessage) error {
+	if len(raws) == 0 {
+		return nil
+	}
+	kept := []json.RawMessage{}
+	if b, err := ioutil.ReadFile(s.quarantinePath()); err == nil {
+		json.Unmarshal(b, &kept)
+	}
+	b, err := json.Marshal(append(kept, raws...))
+	if err != nil {
+		return err
+	}
+	return s.write(s.quarantinePath(), b)
+}
+
+// write replaces the file with the content atomically. The URIs can contain credentials, so the file is only readable by the owner
+func (s *FileStore) write(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
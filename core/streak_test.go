@@ -0,0 +1,80 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreak(t *testing.T) {
+	ctrls := NewController(config.InitConfig(), WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+	router := httprouter.New()
+	router.POST("/start", ctrls.StartStreamHandler)
+	router.GET("/status/:id", ctrls.StatusHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	start := func(body string) (*http.Response, StreamDto) {
+		res, err := http.Post(fmt.Sprintf("%s/start", server.URL), "application/json", bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		var dto StreamDto
+		json.NewDecoder(res.Body).Decode(&dto)
+		return res, dto
+	}
+	options := func(id string) streaming.StreakOptions {
+		strm, ok := ctrls.getStream(id)
+		if !assert.True(t, ok) {
+			return streaming.StreakOptions{}
+		}
+		return strm.Options.Streak
+	}
+
+	t.Run("Should take the streak settings of the start request over the configured ones", func(t *testing.T) {
+		res, dto := start(fmt.Sprintf(`{"uri": %q, "streak": {"hitLimit": 20, "hotWait": "5m"}}`, generateURI()))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, streaming.StreakOptions{HitLimit: 20, HotWait: 300}, options(dto.ID))
+		res, dto = start(fmt.Sprintf(`{"uri": %q}`, generateURI()))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, streaming.StreakOptions{HitLimit: 10, HotWait: 120}, options(dto.ID))
+
+		res, _ = start(fmt.Sprintf(`{"uri": %q, "streak": {"hitLimit": 0}}`, generateURI()))
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Should only apply the reloaded settings to the streams started afterwards", func(t *testing.T) {
+		_, before := start(fmt.Sprintf(`{"uri": %q}`, generateURI()))
+		conf := *config.InitConfig()
+		conf.StreakHitLimit, conf.StreakHotWait = 30, time.Minute
+		ctrls.setSpec(&conf)
+		defer ctrls.setSpec(config.InitConfig())
+		_, after := start(fmt.Sprintf(`{"uri": %q}`, generateURI()))
+		assert.Equal(t, streaming.StreakOptions{HitLimit: 10, HotWait: 120}, options(before.ID))
+		assert.Equal(t, streaming.StreakOptions{HitLimit: 30, HotWait: 60}, options(after.ID))
+	})
+
+	t.Run("Should report the state of the streak in the status", func(t *testing.T) {
+		_, dto := start(fmt.Sprintf(`{"uri": %q, "idleTimeout": 60, "streak": {"hitLimit": 5}}`, generateURI()))
+		strm, _ := ctrls.getStream(dto.ID)
+		strm.Hit(ctrls.now())
+		res, err := http.Get(fmt.Sprintf("%s/status/%s", server.URL, dto.ID))
+		assert.Nil(t, err)
+		var status StatusDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&status))
+		assert.Equal(t, 1, status.Streak.Hits)
+		assert.NotNil(t, status.Streak.LastHitAt)
+		assert.Equal(t, 5, status.Streak.HitLimit)
+		assert.Equal(t, 120, status.Streak.HotWait)
+		assert.Equal(t, 60, status.Streak.ActiveWait)
+	})
+}
@@ -0,0 +1,67 @@
+package streaming
+
+import (
+	"errors"
+	"time"
+)
+
+// ActivityHTTP counts the requests of the files and the keepalives of the clients as the activity of the stream
+const ActivityHTTP = "http"
+
+// ActivityOutput counts the segments written by the transcoding as the activity of the stream, for the streams
+// consumed without requesting their files from the service, like through a shared mount
+const ActivityOutput = "output"
+
+// ActivityBoth counts both the requests of the clients and the segments written by the transcoding
+const ActivityBoth = "both"
+
+// ErrInvalidActivity describes an error for unknown activity sources
+var ErrInvalidActivity = errors.New("Activity has to be http, output or both")
+
+// validateActivity checks if the activity source of the options is known
+func validateActivity(opts Options) error {
+	switch opts.Activity {
+	case "", ActivityHTTP, ActivityOutput, ActivityBoth:
+		return nil
+	default:
+		return ErrInvalidActivity
+	}
+}
+
+// ActivitySource returns what counts as the activity of the stream, streams created without a source use the requests of the clients
+func (o Options) ActivitySource() string {
+	if o.Activity == "" {
+		return ActivityHTTP
+	}
+	return o.Activity
+}
+
+// countsRequests indicates if the requests of the clients keep the stream running
+func (o Options) countsRequests() bool {
+	return o.ActivitySource() != ActivityOutput
+}
+
+// CountsOutput indicates if the segments written by the transcoding keep the stream running
+func (strm *Stream) CountsOutput() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Options.ActivitySource() != ActivityHTTP
+}
+
+// RecordOutput records the output written by the transcoding at the given time as the activity of the stream,
+// like a request of its files. Only the output written since the last recorded one and since the start counts
+func (strm *Stream) RecordOutput(at time.Time) {
+	strm.Mux.Lock()
+	if !at.After(strm.lastOutput) || !at.After(strm.StartedAt) {
+		strm.Mux.Unlock()
+		return
+	}
+	strm.lastOutput = at
+	if at.After(strm.LastActivity) {
+		strm.LastActivity = at
+	}
+	strm.hits++
+	strm.lastHit = at
+	strm.Mux.Unlock()
+	strm.Streak.Hit()
+}
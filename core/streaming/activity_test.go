@@ -0,0 +1,59 @@
+package streaming
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roverr/hotstreak"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivity(t *testing.T) {
+	started := time.Now().Add(-time.Minute)
+	newStream := func(activity string) *Stream {
+		opts := Options{IdleTimeout: 60, Activity: activity}
+		return &Stream{
+			Mux:          &sync.RWMutex{},
+			Streak:       hotstreak.New(opts.streakConfig()).Activate(),
+			Options:      opts,
+			StartedAt:    started,
+			LastActivity: started,
+		}
+	}
+
+	t.Run("Should only count the output of the streams that use it", func(t *testing.T) {
+		strm := newStream(ActivityOutput)
+		assert.True(t, strm.CountsOutput())
+		strm.Touch()
+		strm.Hit(time.Now())
+		assert.Equal(t, started, strm.LastActivity)
+		assert.Equal(t, 0, strm.StreakStatus(time.Now()).Hits)
+
+		written := started.Add(time.Second * 30)
+		strm.RecordOutput(written)
+		assert.Equal(t, written, strm.LastActivity)
+		// The same output and the one written before the start are not counted again
+		strm.RecordOutput(written)
+		strm.RecordOutput(started.Add(-time.Second))
+		assert.Equal(t, 1, strm.StreakStatus(time.Now()).Hits)
+	})
+
+	t.Run("Should count both the requests and the output", func(t *testing.T) {
+		strm := newStream(ActivityBoth)
+		assert.True(t, strm.CountsOutput())
+		strm.RecordOutput(started.Add(time.Second))
+		strm.Hit(time.Now())
+		strm.Touch()
+		assert.True(t, strm.LastActivity.After(started.Add(time.Second)))
+		assert.Equal(t, 2, strm.StreakStatus(time.Now()).Hits)
+	})
+
+	t.Run("Should only count the requests by default", func(t *testing.T) {
+		strm := newStream("")
+		assert.False(t, strm.CountsOutput())
+		assert.Equal(t, ActivityHTTP, strm.Options.ActivitySource())
+		strm.Touch()
+		assert.True(t, strm.LastActivity.After(started))
+	})
+}
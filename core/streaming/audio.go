@@ -0,0 +1,95 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AudioDrop removes the audio from the stream
+const AudioDrop = "drop"
+
+// AudioCopy copies the audio without re-encoding
+const AudioCopy = "copy"
+
+// AudioAAC transcodes the audio to AAC
+const AudioAAC = "aac"
+
+// ErrInvalidAudio describes an error for unknown audio modes
+var ErrInvalidAudio = errors.New("Audio has to be drop, copy or aac")
+
+// ErrInvalidAudioBitrate describes an error for unusable audio bitrates
+var ErrInvalidAudioBitrate = errors.New("Audio bitrate has to be like 64k or 128k")
+
+// ErrAudioOnlyAudio describes an error for audio-only streams whose audio would not be transcoded to AAC
+var ErrAudioOnlyAudio = errors.New("Audio-only streams are transcoded to aac, their audio cannot be dropped or copied")
+
+// ErrAudioOnlyRenditions describes an error for audio-only streams with renditions of the video
+var ErrAudioOnlyRenditions = errors.New("Audio-only streams cannot have renditions")
+
+// ErrNoAudioTrack describes an error for audio-only streams of sources without any audio
+var ErrNoAudioTrack = errors.New("Source has no audio track, it cannot be streamed audio-only")
+
+// ErrIncompatibleAudioFn is used to create errors for audio that cannot be copied into HLS
+var ErrIncompatibleAudioFn = func(codec string) error {
+	return fmt.Errorf("%s audio cannot be copied into HLS, it has to be transcoded to aac or dropped", codec)
+}
+
+// copyableAudioCodecs are the audio codecs HLS can carry without re-encoding
+var copyableAudioCodecs = map[string]bool{
+	"aac":  true,
+	"mp3":  true,
+	"ac3":  true,
+	"eac3": true,
+}
+
+// IsCopyableAudio indicates if the given audio codec can be carried by HLS without re-encoding
+func IsCopyableAudio(codec string) bool {
+	return copyableAudioCodecs[codec]
+}
+
+// validateAudio checks if the audio settings of the options can be used
+func validateAudio(opts Options) error {
+	switch opts.Audio {
+	case "", AudioDrop, AudioCopy, AudioAAC:
+	default:
+		return ErrInvalidAudio
+	}
+	if opts.AudioBitrate != "" && !bitrateFormat.MatchString(opts.AudioBitrate) {
+		return ErrInvalidAudioBitrate
+	}
+	if !opts.AudioOnly {
+		return nil
+	}
+	if opts.Audio == AudioDrop || opts.Audio == AudioCopy {
+		return ErrAudioOnlyAudio
+	}
+	if len(opts.Renditions) > 0 {
+		return ErrAudioOnlyRenditions
+	}
+	return nil
+}
+
+// getAudioOnlyArgs returns the arguments of the audio-only outputs, only the audio of the source is mapped and transcoded to AAC
+func getAudioOnlyArgs(opts Options) []string {
+	args := []string{"-map", "0:a", "-vn", "-c:a", "aac"}
+	if opts.AudioBitrate != "" {
+		args = append(args, "-b:a", opts.AudioBitrate)
+	}
+	return args
+}
+
+// getAudioArgs returns the audio arguments of the stream. Sources without
+// audio are not affected by these, as ffmpeg only maps the existing tracks
+func getAudioArgs(opts Options) []string {
+	switch opts.AudioMode() {
+	case AudioDrop:
+		return []string{"-an"}
+	case AudioCopy:
+		return []string{"-c:a", "copy"}
+	default:
+		if opts.AudioBitrate == "" {
+			return []string{"-c:a", "aac"}
+		}
+		return []string{"-c:a", "aac", "-b:a", opts.AudioBitrate}
+	}
+}
@@ -0,0 +1,70 @@
+package streaming
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// ErrSourceAuthFailed describes an error for sources that refused the credentials of the stream
+var ErrSourceAuthFailed = errors.New("Source refused the credentials")
+
+// authFailurePattern matches the lines ffmpeg and ffprobe log when the source refuses the credentials,
+// like the 401 and 403 answers of the RTSP and HTTP servers
+var authFailurePattern = regexp.MustCompile(`(?i)unauthori[sz]ed|authori[sz]ation failed|forbidden|access denied|(failed|returned):? 40[13]\b`)
+
+// IsAuthFailure indicates if the output of ffmpeg or ffprobe tells that the source refused the credentials
+func IsAuthFailure(output string) bool {
+	return authFailurePattern.MatchString(output)
+}
+
+// RefusedCredentials indicates if the source refused the credentials of the last process of the stream
+func (strm *Stream) RefusedCredentials() bool {
+	if strm.Logs == nil {
+		return false
+	}
+	strm.Mux.RLock()
+	startedAt := strm.StartedAt
+	strm.Mux.RUnlock()
+	at := strm.Logs.AuthFailureAt()
+	return !at.IsZero() && !at.Before(startedAt)
+}
+
+// NextCredentials switches the source of the stream to the URI with its next fallback credentials, returns false if none is left
+func (strm *Stream) NextCredentials() bool {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	if len(strm.Options.Fallbacks) == 0 {
+		return false
+	}
+	strm.OriginalURI, strm.Options.Fallbacks = strm.Options.Fallbacks[0], strm.Options.Fallbacks[1:]
+	return true
+}
+
+// SetSource replaces the source of the stream with the URI and the fallback URIs tried once it refuses the credentials.
+// The info describes the probed tracks of the new source, nil if it was not probed. A running process keeps its source until it is restarted
+func (strm *Stream) SetSource(uri string, fallbacks []string, info *SourceInfo) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.OriginalURI = uri
+	strm.Options.Fallbacks = fallbacks
+	strm.Options.Source = info
+}
+
+// FailAuth marks the stream as errored for the refused credentials, so it is not restarted against the source anymore
+func (strm *Stream) FailAuth() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Streak.Deactivate()
+	strm.Errored = true
+	strm.authFailed = true
+	strm.LastError = ErrSourceAuthFailed.Error()
+	strm.LastErrorAt = time.Now()
+}
+
+// AuthFailed indicates if the stream is errored because the source refused its credentials
+func (strm *Stream) AuthFailed() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.authFailed
+}
@@ -0,0 +1,45 @@
+package streaming
+
+import "errors"
+
+// ErrInvalidDVRWindow describes an error for DVR windows that are negative or cannot be written by the muxer of the stream
+var ErrInvalidDVRWindow = errors.New("DVR window has to be a positive number of seconds, it cannot be used with MPEG-DASH or low latency HLS")
+
+// DVRStatus describes the rolling history of the stream that can be rewound
+type DVRStatus struct {
+	Window int `json:"window"` // Seconds of segments the stream keeps
+	Depth  int `json:"depth"`  // Seconds the stream can be rewound by right now, shorter than the window until it is filled
+}
+
+// validateDVR checks if the DVR window can be kept, only the HLS muxer writes it
+func validateDVR(opts Options) error {
+	if opts.DVRWindow < 0 || (opts.DVRWindow > 0 && opts.UsesDASHMuxer()) {
+		return ErrInvalidDVRWindow
+	}
+	return nil
+}
+
+// playlistSize returns the number of segments kept in the playlists. The DVR streams keep every segment of their window,
+// regardless of the list size
+func (o Options) playlistSize() int {
+	if o.DVRWindow <= 0 {
+		return o.HLS.ListSize
+	}
+	return (o.DVRWindow + o.HLS.Time - 1) / o.HLS.Time
+}
+
+// DVRStatus returns the window of the stream with the part of it that is filled already, nil if the stream has no DVR window.
+// The depth is the duration of the segments listed by the media playlist of the stream
+func (strm *Stream) DVRStatus() *DVRStatus {
+	strm.Mux.RLock()
+	window, playlist := strm.Options.DVRWindow, strm.MediaPlaylistFile()
+	strm.Mux.RUnlock()
+	if window <= 0 {
+		return nil
+	}
+	depth := int(PlaylistDuration(playlist))
+	if depth > window {
+		depth = window
+	}
+	return &DVRStatus{window, depth}
+}
@@ -0,0 +1,48 @@
+package streaming
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// KeyFile is the name of the file holding the encryption key of a stream
+const KeyFile = "enc.key"
+
+// keyInfoFile is the name of the file describing the key for ffmpeg
+const keyInfoFile = "enc.keyinfo"
+
+// GetKeyURI returns the URI the players can fetch the key of the given stream from
+func GetKeyURI(dirPath string) string {
+	return fmt.Sprintf("/keys/%s", dirPath)
+}
+
+// createKeyInfo makes sure that the encryption key and the key info file
+// of the given stream exist, returning the path of the key info file
+func createKeyInfo(keysDir, dirPath string) (string, error) {
+	keyDir, err := filepath.Abs(filepath.Join(keysDir, dirPath))
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(keyDir, 0700); err != nil {
+		return "", err
+	}
+	keyPath := filepath.Join(keyDir, KeyFile)
+	if _, err = os.Stat(keyPath); os.IsNotExist(err) {
+		key := make([]byte, 16)
+		if _, err = rand.Read(key); err != nil {
+			return "", err
+		}
+		if err = ioutil.WriteFile(keyPath, key, 0600); err != nil {
+			return "", err
+		}
+	}
+	keyInfoPath := filepath.Join(keyDir, keyInfoFile)
+	keyInfo := fmt.Sprintf("%s\n%s\n", GetKeyURI(dirPath), keyPath)
+	if err = ioutil.WriteFile(keyInfoPath, []byte(keyInfo), 0600); err != nil {
+		return "", err
+	}
+	return keyInfoPath, nil
+}
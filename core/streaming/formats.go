@@ -0,0 +1,81 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// FormatHLS writes an HLS playlist with MPEG-TS segments
+const FormatHLS = "hls"
+
+// FormatDASH writes an MPEG-DASH manifest with fragmented MP4 segments
+const FormatDASH = "dash"
+
+// FormatBoth writes an MPEG-DASH manifest and HLS playlists sharing the same fragmented MP4 segments
+const FormatBoth = "both"
+
+// dashManifest is the name of the MPEG-DASH manifest of a stream
+const dashManifest = "manifest.mpd"
+
+// dashMediaPlaylist is the name of the HLS playlist of the video written next to the manifest
+const dashMediaPlaylist = "media_0.m3u8"
+
+// ErrInvalidFormat describes an error for unknown output formats
+var ErrInvalidFormat = errors.New("Format has to be hls, dash or both")
+
+// ErrDASHWithRenditions describes an error for renditions requested together with a DASH output
+var ErrDASHWithRenditions = errors.New("Renditions can only be created with the hls format")
+
+// validateFormat checks if the given output format is known and can be used with the rest of the options
+func validateFormat(opts Options) error {
+	switch opts.Format {
+	case "", FormatHLS:
+		return nil
+	case FormatDASH, FormatBoth:
+		if len(opts.Renditions) > 0 {
+			return ErrDASHWithRenditions
+		}
+		return nil
+	default:
+		return ErrInvalidFormat
+	}
+}
+
+// getDASHArgs returns the muxer arguments writing the manifest and the HLS playlists into the given directory.
+// Segments falling out of the window are deleted by the muxer itself, so the manifest
+// lists every segment of the stream if the segments have to be kept
+func getDASHArgs(opts Options, dir string) []string {
+	windowSize := opts.HLS.ListSize
+	if !opts.HLS.DeleteSegments {
+		windowSize = 0
+	}
+	timeline := "1"
+	// Low latency manifests describe the segments with their template only
+	if opts.LowLatency.Enabled {
+		timeline = "0"
+	}
+	args := []string{
+		"-f",
+		"dash",
+		"-seg_duration",
+		strconv.Itoa(opts.HLS.Time),
+		"-window_size",
+		strconv.Itoa(windowSize),
+		"-use_template",
+		"1",
+		"-use_timeline",
+		timeline,
+		"-init_seg_name",
+		"init-$RepresentationID$.m4s",
+		"-media_seg_name",
+		"chunk-$RepresentationID$-$Number%05d$.m4s",
+	}
+	if opts.OutputFormat() != FormatDASH {
+		args = append(args, "-hls_playlist", "1")
+	}
+	if opts.LowLatency.Enabled {
+		args = append(args, getLowLatencyArgs(opts.LowLatency)...)
+	}
+	return append(args, fmt.Sprintf("%s/%s", dir, dashManifest))
+}
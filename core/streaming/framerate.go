@@ -0,0 +1,73 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxFrameRate is the highest frame rate the streams can be capped at
+const MaxFrameRate = 240
+
+// ErrInvalidMaxFPS describes an error for frame rate caps out of the accepted range
+var ErrInvalidMaxFPS = errors.New("Max fps has to be between 0 and 240")
+
+// ErrCopyWithMaxFPS describes an error for copy mode requested together with a frame rate cap
+var ErrCopyWithMaxFPS = errors.New("Frame rate cannot be capped in copy mode, the video has to be transcoded")
+
+// validateMaxFPS checks if the frame rate cap of the stream is in the accepted range
+func validateMaxFPS(maxFPS int) error {
+	if maxFPS < 0 || maxFPS > MaxFrameRate {
+		return ErrInvalidMaxFPS
+	}
+	return nil
+}
+
+// getFrameRateFilter returns the filter dropping the frames above the frame rate cap of the stream.
+// Empty if the stream is not capped or the probed source is not faster than the cap
+func getFrameRateFilter(opts Options) string {
+	if opts.MaxFPS == 0 {
+		return ""
+	}
+	if opts.Source != nil && opts.Source.FPS > 0 && opts.Source.FPS <= float64(opts.MaxFPS) {
+		return ""
+	}
+	return fmt.Sprintf("fps=%d", opts.MaxFPS)
+}
+
+// getFilterArgs returns the filters of the transcoded video. The frame rate is capped before the video is scaled,
+// so the dropped frames are not scaled at all. The resolution of the request overrides the height of the profile
+func getFilterArgs(opts Options) []string {
+	filters := []string{}
+	if filter := getFrameRateFilter(opts); filter != "" {
+		filters = append(filters, filter)
+	}
+	switch {
+	case opts.Resolution != nil:
+		filters = append(filters, getResolutionFilter(opts))
+	case opts.Profile != nil && opts.Profile.Height != 0:
+		filters = append(filters, getScaleFilter(opts.HardwareAccel, opts.Profile.Height))
+	}
+	if len(filters) == 0 {
+		return []string{}
+	}
+	return []string{"-vf", strings.Join(filters, ",")}
+}
+
+// parseFrameRate reads the frame rate of ffprobe, like 30000/1001. Returns 0 if it is unknown
+func parseFrameRate(rate string) float64 {
+	parts := strings.Split(rate, "/")
+	frames, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0
+	}
+	if len(parts) == 1 {
+		return frames
+	}
+	duration, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || duration == 0 {
+		return 0
+	}
+	return frames / duration
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+// +build !windows
+
+package streaming
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup makes the command start in its own process group, so the processes it spawns are signalled with it
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalGroup sends the signal to every process of the group, the groups that are gone are ignored
+func signalGroup(pgid int, signal syscall.Signal) error {
+	if err := syscall.Kill(-pgid, signal); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// signalLeader sends the signal to the process group the process leads, or only to the process if it does not lead one.
+// Processes that exited already are ignored
+func signalLeader(pid int, signal syscall.Signal) error {
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+		return signalGroup(pid, signal)
+	}
+	if err := syscall.Kill(pid, signal); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// groupAlive indicates if a process of the group is still running
+func groupAlive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) == nil
+}
+
+// reapChildren reaps the exited processes of the group handed over to the service, which happens when it is the init process of a container
+func reapChildren(pgid int) {
+	var status syscall.WaitStatus
+	for {
+		pid, err := syscall.Wait4(-pgid, &status, syscall.WNOHANG, nil)
+		if err != nil || pid <= 0 {
+			return
+		}
+	}
+}
+
+// reapGroup waits for the processes left in the group of the exited command, like the children of a wrapper holding the source.
+// They are terminated and killed if they do not exit within the grace period. The killed processes are waited for at most killWait,
+// the ones not reaped by their parent stay in the group as zombies
+func reapGroup(pgid int, grace time.Duration) {
+	reapChildren(pgid)
+	if !groupAlive(pgid) {
+		return
+	}
+	signalGroup(pgid, syscall.SIGTERM)
+	deadline := time.Now().Add(grace)
+	killed := false
+	for ; groupAlive(pgid); reapChildren(pgid) {
+		if !killed && !time.Now().Before(deadline) {
+			signalGroup(pgid, syscall.SIGKILL)
+			killed = true
+			deadline = time.Now().Add(killWait)
+		} else if killed && !time.Now().Before(deadline) {
+			return
+		}
+		time.Sleep(exitPollInterval)
+	}
+}
@@ -0,0 +1,118 @@
+//go:build !windows
+// +build !windows
+
+package streaming
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// childOf starts the shell script writing the pid of its child into a file and returns the command with the pid of the child
+func childOf(t *testing.T, script string, grace time.Duration) (Process, int) {
+	dir, err := ioutil.TempDir("", "group")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "pid")
+	process, err := startCommand(exec.Command("sh", "-c", strings.Replace(script, "PIDFILE", file, 1)), grace)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	var pid int
+	for i := 0; i < 100 && pid == 0; i++ {
+		<-time.After(time.Millisecond * 20)
+		b, _ := ioutil.ReadFile(file)
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+	}
+	if !assert.NotZero(t, pid) {
+		t.FailNow()
+	}
+	return process, pid
+}
+
+// isRunning indicates if the process exists and is not a zombie
+func isRunning(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	b, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(b[strings.LastIndex(string(b), ")")+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestTerminate(t *testing.T) {
+	t.Run("Should escalate to SIGKILL for the children ignoring SIGTERM", func(t *testing.T) {
+		process, child := childOf(t, "trap '' TERM; sleep 20 & echo $! > PIDFILE; wait", 0)
+		started := time.Now()
+		killed, err := Terminate(context.Background(), process, time.Millisecond*300)
+		assert.Nil(t, err)
+		assert.True(t, killed)
+		assert.True(t, time.Since(started) >= time.Millisecond*300)
+		assert.False(t, process.Healthy())
+		assert.True(t, waitFor(func() bool { return !isRunning(child) }, time.Second*5))
+	})
+
+	t.Run("Should stop the whole process group gracefully", func(t *testing.T) {
+		process, child := childOf(t, "sleep 20 & echo $! > PIDFILE; wait", 0)
+		killed, err := Terminate(context.Background(), process, time.Second*5)
+		assert.Nil(t, err)
+		assert.False(t, killed)
+		assert.False(t, process.Healthy())
+		assert.False(t, isRunning(child))
+	})
+
+	t.Run("Should kill the process once the context is done", func(t *testing.T) {
+		process, _ := childOf(t, "trap '' TERM; echo $$ > PIDFILE; sleep 20", 0)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		started := time.Now()
+		killed, err := Terminate(ctx, process, time.Minute)
+		assert.Nil(t, err)
+		assert.True(t, killed)
+		assert.True(t, time.Since(started) < time.Second*5)
+	})
+
+	t.Run("Should reap the processes left by the exited command", func(t *testing.T) {
+		process, child := childOf(t, "trap '' TERM; sleep 20 & echo $! > PIDFILE", time.Millisecond*200)
+		exited := make(chan struct{})
+		go func() {
+			process.Wait()
+			close(exited)
+		}()
+		select {
+		case <-exited:
+		case <-time.After(time.Second * 5):
+			t.Error("Command is not waited for")
+		}
+		assert.False(t, process.Healthy())
+		assert.True(t, waitFor(func() bool { return !isRunning(child) }, time.Second*5))
+		// The exited commands are not signalled anymore
+		assert.Nil(t, process.Stop())
+		assert.Nil(t, process.Kill())
+	})
+}
+
+// waitFor checks the condition periodically until it holds or the timeout passes
+func waitFor(condition func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package streaming
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup does nothing, the process groups are not available
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup kills the process leading the group, the signals and the process groups are not available
+func signalGroup(pgid int, signal syscall.Signal) error {
+	return signalLeader(pgid, signal)
+}
+
+// signalLeader kills the process, the signals are not available
+func signalLeader(pid int, signal syscall.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	return killProcess(process)
+}
+
+// reapGroup does nothing, only the command itself is waited for
+func reapGroup(pgid int, grace time.Duration) {}
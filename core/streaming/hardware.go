@@ -0,0 +1,99 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AccelNone describes software encoding
+const AccelNone = "none"
+
+// AccelVAAPI describes encoding with the Video Acceleration API
+const AccelVAAPI = "vaapi"
+
+// AccelNVENC describes encoding with NVIDIA's encoder
+const AccelNVENC = "nvenc"
+
+// AccelQSV describes encoding with Intel Quick Sync Video
+const AccelQSV = "qsv"
+
+// ErrInvalidHardwareAccel describes an error for unknown hardware accelerations
+var ErrInvalidHardwareAccel = errors.New("Hardware acceleration has to be vaapi, nvenc, qsv or none")
+
+// validateHardwareAccel checks if the given acceleration is known
+func validateHardwareAccel(accel string) error {
+	switch accel {
+	case AccelNone, AccelVAAPI, AccelNVENC, AccelQSV:
+		return nil
+	default:
+		return ErrInvalidHardwareAccel
+	}
+}
+
+// getHardwareInputArgs returns the flags decoding the input with the given acceleration
+func getHardwareInputArgs(accel, device string) []string {
+	switch accel {
+	case AccelVAAPI:
+		args := []string{"-hwaccel", "vaapi", "-hwaccel_output_format", "vaapi"}
+		if device != "" {
+			args = append(args, "-hwaccel_device", device)
+		}
+		return args
+	case AccelNVENC:
+		args := []string{"-hwaccel", "cuda", "-hwaccel_output_format", "cuda"}
+		if device != "" {
+			args = append(args, "-hwaccel_device", device)
+		}
+		return args
+	case AccelQSV:
+		args := []string{"-hwaccel", "qsv", "-hwaccel_output_format", "qsv"}
+		if device != "" {
+			args = append(args, "-qsv_device", device)
+		}
+		return args
+	default:
+		return []string{}
+	}
+}
+
+// getScaleFilterName returns the name of the filter scaling the video with the given acceleration
+func getScaleFilterName(accel string) string {
+	switch accel {
+	case AccelVAAPI:
+		return "scale_vaapi"
+	case AccelNVENC:
+		return "scale_cuda"
+	case AccelQSV:
+		return "scale_qsv"
+	default:
+		return "scale"
+	}
+}
+
+// getScaleFilter returns the filter scaling the video to the given height with the given acceleration
+func getScaleFilter(accel string, height int) string {
+	switch accel {
+	case AccelVAAPI:
+		return fmt.Sprintf("scale_vaapi=w=-2:h=%d", height)
+	case AccelNVENC:
+		return fmt.Sprintf("scale_cuda=-2:%d", height)
+	case AccelQSV:
+		return fmt.Sprintf("scale_qsv=w=-2:h=%d", height)
+	default:
+		return fmt.Sprintf("scale=-2:%d", height)
+	}
+}
+
+// getVideoEncoder returns the H.264 encoder of the given acceleration
+func getVideoEncoder(accel string) string {
+	switch accel {
+	case AccelVAAPI:
+		return "h264_vaapi"
+	case AccelNVENC:
+		return "h264_nvenc"
+	case AccelQSV:
+		return "h264_qsv"
+	default:
+		return "libx264"
+	}
+}
@@ -0,0 +1,87 @@
+package streaming
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSegmentName is the name of the HLS segments of the streams without a layout, their number
+const defaultSegmentName = "%d"
+
+// Layout describes where the files of the stream are written, it is resolved from the templates of the configuration when the
+// stream is created and kept with it. The streams created before the templates changed are still served from where they were written
+type Layout struct {
+	Directory string `json:"directory"` // Directory of the stream relative to the store directory
+	Segment   string `json:"segment"`   // Name of the HLS segments without their extension, with their number written like %05d
+}
+
+// NewLayout returns the layout of the stream with the id, nil if its files are written like the ones of the streams without a layout
+func NewLayout(id, directory, segment string) *Layout {
+	if directory == id && segment == defaultSegmentName {
+		return nil
+	}
+	return &Layout{Directory: directory, Segment: segment}
+}
+
+// storeDirectory returns the directory of the stream relative to the store directory, the id of the stream without a layout
+func (o Options) storeDirectory(id string) string {
+	if o.Layout == nil {
+		return id
+	}
+	return o.Layout.Directory
+}
+
+// segmentName returns the name of the HLS segments of the stream without their extension
+func (o Options) segmentName() string {
+	if o.Layout == nil || o.Layout.Segment == "" {
+		return defaultSegmentName
+	}
+	return o.Layout.Segment
+}
+
+// streamID returns the id of the stream writing into the output directory, the directories of the layouts are not named after it
+func streamID(opts Options, outDir string) string {
+	if opts.Directory != "" {
+		return opts.Directory
+	}
+	return filepath.Base(outDir)
+}
+
+// FilePath returns the path of the requested file of the stream relative to the store directory.
+// The requests name the files after the id of the stream, while the layout could write them somewhere else
+func (strm *Stream) FilePath(requested string) string {
+	strm.Mux.RLock()
+	layout, id := strm.Options.Layout, strm.Options.Directory
+	strm.Mux.RUnlock()
+	if layout == nil || id == "" {
+		return requested
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(requested, "/"), id)
+	return "/" + layout.Directory + rest
+}
+
+// removeLayoutParents removes the directories of the layout above the directory of the stream that are left empty.
+// Removing stops at the first directory that is still used by another stream, the store directory itself is kept
+func removeLayoutParents(storePath string, layout *Layout) {
+	if layout == nil {
+		return
+	}
+	dir := storePath
+	for i := strings.Count(strings.Trim(layout.Directory, "/"), "/"); i > 0; i-- {
+		dir = filepath.Dir(dir)
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// LayoutDirectory returns the directory of the stream relative to the store directory, empty if it is the one named after its id
+func (strm *Stream) LayoutDirectory() string {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	if strm.Options.Layout == nil {
+		return ""
+	}
+	return strm.Options.Layout.Directory
+}
@@ -0,0 +1,52 @@
+package streaming
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilePath(t *testing.T) {
+	tt := []struct {
+		Options   Options
+		Requested string
+		Expected  string
+	}{
+		{Options: Options{Directory: "front"}, Requested: "/front/index.m3u8", Expected: "/front/index.m3u8"},
+		{Options: Options{Directory: "front", Layout: &Layout{Directory: "north/front", Segment: "%d"}}, Requested: "/front/index.m3u8", Expected: "/north/front/index.m3u8"},
+		{Options: Options{Directory: "front", Layout: &Layout{Directory: "north/front", Segment: "%d"}}, Requested: "/front/720p/1.ts", Expected: "/north/front/720p/1.ts"},
+	}
+	for i, testCase := range tt {
+		strm := Stream{Mux: &sync.RWMutex{}, Options: testCase.Options}
+		if !assert.Equal(t, testCase.Expected, strm.FilePath(testCase.Requested)) {
+			t.Error(fmt.Errorf("%d testcase is failing for FilePath", i))
+		}
+	}
+	assert.Nil(t, NewLayout("front", "front", "%d"))
+	assert.Equal(t, &Layout{Directory: "front", Segment: "%05d"}, NewLayout("front", "front", "%05d"))
+}
+
+func TestRemoveLayoutParents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	layout := &Layout{Directory: "north/2026-10-14/front", Segment: "%d"}
+	storePath := filepath.Join(dir, "north", "2026-10-14", "front")
+	assert.Nil(t, os.MkdirAll(storePath, os.ModePerm))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "north", "other"), os.ModePerm))
+
+	strm := Stream{Mux: &sync.RWMutex{}, StorePath: storePath, Options: Options{Directory: "front", Layout: layout}}
+	strm.cleanDir()
+	_, err = os.Stat(filepath.Join(dir, "north", "2026-10-14"))
+	assert.True(t, os.IsNotExist(err))
+	// The directories still used by other streams are kept, like the store directory
+	_, err = os.Stat(filepath.Join(dir, "north", "other"))
+	assert.Nil(t, err)
+	_, err = os.Stat(dir)
+	assert.Nil(t, err)
+}
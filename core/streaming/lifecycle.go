@@ -0,0 +1,49 @@
+package streaming
+
+import "errors"
+
+// LifecycleActivity keeps the stream running while its files are requested or it is kept alive by the clients
+const LifecycleActivity = "activity"
+
+// LifecycleViewers keeps the stream running while it has viewers, the requests of the ignored clients
+// like health checks and the ones of the segments do not keep it running
+const LifecycleViewers = "viewers"
+
+// ErrInvalidLifecycle describes an error for unknown lifecycle policies
+var ErrInvalidLifecycle = errors.New("Lifecycle has to be activity or viewers")
+
+// validateLifecycle checks if the lifecycle policy of the options is known
+func validateLifecycle(opts Options) error {
+	switch opts.Lifecycle {
+	case "", LifecycleActivity, LifecycleViewers:
+		return nil
+	default:
+		return ErrInvalidLifecycle
+	}
+}
+
+// LifecyclePolicy returns the lifecycle policy of the stream, streams created without a policy use the activity of the clients
+func (o Options) LifecyclePolicy() string {
+	if o.Lifecycle == "" {
+		return LifecycleActivity
+	}
+	return o.Lifecycle
+}
+
+// Lifecycle returns the lifecycle policy of the stream, it can be changed while the stream is running
+func (strm *Stream) Lifecycle() string {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Options.LifecyclePolicy()
+}
+
+// SetLifecycle changes the lifecycle policy of the stream
+func (strm *Stream) SetLifecycle(policy string) error {
+	if err := validateLifecycle(Options{Lifecycle: policy}); err != nil {
+		return err
+	}
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Options.Lifecycle = policy
+	return nil
+}
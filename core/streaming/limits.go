@@ -0,0 +1,133 @@
+package streaming
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrLimitUnsupported describes an error for process limits that cannot be applied on the platform
+var ErrLimitUnsupported = errors.New("Limit is not supported on this platform")
+
+// Limits describes the limits the processes of a stream run with, the zero values were not applied
+type Limits struct {
+	Nice     int     `json:"nice,omitempty"`     // Niceness of the processes
+	CPUs     string  `json:"cpus,omitempty"`     // CPUs the processes are pinned to, like 0-3,6
+	CPUQuota float64 `json:"cpuQuota,omitempty"` // Number of CPUs the processes can use at most
+}
+
+// limitedProcess is a Process that reports the limits it runs with
+type limitedProcess interface {
+	Limits() Limits
+}
+
+// limitsOf returns the limits the process runs with, none if it does not report them
+func limitsOf(process Process) Limits {
+	if limited, ok := process.(limitedProcess); ok {
+		return limited.Limits()
+	}
+	return Limits{}
+}
+
+// unsupportedLimits are the mechanisms that were reported to be unavailable, so they are only logged once
+var unsupportedLimits sync.Map
+
+// warnUnsupported logs that the mechanism cannot be used, once for every mechanism
+func warnUnsupported(mechanism string, err error) {
+	if _, reported := unsupportedLimits.LoadOrStore(mechanism, true); !reported {
+		logrus.Warnf("Processes are started without %s || Error: %s", mechanism, err)
+	}
+}
+
+// limitPrefix returns the commands the processes are started with to run them with the configured niceness and CPU affinity,
+// together with the limits they apply. The mechanisms which are not available on the platform are left out
+func (p Processor) limitPrefix() ([]string, Limits) {
+	prefix, limits := []string{}, Limits{}
+	if p.ffmpeg.ProcessNice != 0 {
+		if path, err := exec.LookPath("nice"); err != nil {
+			warnUnsupported("niceness", err)
+		} else {
+			prefix = append(prefix, path, "-n", strconv.Itoa(p.ffmpeg.ProcessNice))
+			limits.Nice = p.ffmpeg.ProcessNice
+		}
+	}
+	if p.ffmpeg.ProcessCPUAffinity != "" {
+		if args, err := affinityPrefix(p.ffmpeg.ProcessCPUAffinity); err != nil {
+			warnUnsupported("CPU affinity", err)
+		} else {
+			prefix = append(prefix, args...)
+			limits.CPUs = p.ffmpeg.ProcessCPUAffinity
+		}
+	}
+	return prefix, limits
+}
+
+// limitArgs returns the name and the arguments of the command running the given one with the configured niceness and CPU affinity
+func (p Processor) limitArgs(name string, args []string) (string, []string) {
+	prefix, _ := p.limitPrefix()
+	if len(prefix) == 0 {
+		return name, args
+	}
+	return prefix[0], append(append(prefix[1:], name), args...)
+}
+
+// limitStream moves the started process into the cgroup of the stream, so the processes of the stream share its CPU quota.
+// The returned cleanup removes the cgroup once it is not used anymore, false if the quota could not be applied
+func (p Processor) limitStream(id string, opts Options, pid int) (func(), bool) {
+	if opts.CPUQuota <= 0 {
+		return func() {}, false
+	}
+	cleanup, err := joinCgroup(filepath.Join(p.ffmpeg.ProcessCgroupRoot, id), opts.CPUQuota, pid)
+	if err == ErrLimitUnsupported {
+		warnUnsupported("CPU quota", err)
+		return func() {}, false
+	}
+	if err != nil {
+		logrus.Warnf("%s is started without its CPU quota || Error: %s", id, err)
+		return func() {}, false
+	}
+	return cleanup, true
+}
+
+// startLimited starts the transcoding command of the stream with the limits of the configuration
+func (p Processor) startLimited(cmd *exec.Cmd, id string, opts Options) (Process, error) {
+	process, err := startCommand(cmd, p.ffmpeg.ProcessKillGrace)
+	if err != nil {
+		return nil, err
+	}
+	_, limits := p.limitPrefix()
+	cleanup, quota := p.limitStream(id, opts, cmd.Process.Pid)
+	if quota {
+		limits.CPUQuota = opts.CPUQuota
+	}
+	go func() {
+		process.Wait()
+		cleanup()
+	}()
+	return &limitedCommand{process, limits}, nil
+}
+
+// limitedCommand is the Process of a command started with limits
+type limitedCommand struct {
+	Process
+	limits Limits
+}
+
+// Limits returns the limits the command runs with
+func (c *limitedCommand) Limits() Limits {
+	return c.limits
+}
+
+// Pid returns the id of the operating system process of the command
+func (c *limitedCommand) Pid() int {
+	return pidOf(c.Process)
+}
+
+// Command returns the command line the command was started with, with the credentials redacted
+func (c *limitedCommand) Command() []string {
+	return commandOf(c.Process)
+}
@@ -0,0 +1,43 @@
+package streaming
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// cgroupPeriod is the period of the CPU quota of the cgroups in microseconds
+const cgroupPeriod = 100000
+
+// affinityPrefix returns the command pinning the processes to the given CPUs
+func affinityPrefix(cpus string) ([]string, error) {
+	path, err := exec.LookPath("taskset")
+	if err != nil {
+		return nil, err
+	}
+	return []string{path, "-c", cpus}, nil
+}
+
+// joinCgroup moves the process into the cgroup v2 directory limiting it to the quota, the directory is created if it does not exist.
+// The returned cleanup removes the directory, which only succeeds once every process in it has exited
+func joinCgroup(dir string, quota float64, pid int) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.Remove(dir) }
+	// The controller is enabled for the children of the root, it only fails if it is enabled already or cannot be delegated
+	ioutil.WriteFile(filepath.Join(filepath.Dir(dir), "cgroup.subtree_control"), []byte("+cpu"), 0644)
+	max := fmt.Sprintf("%d %d", int(quota*cgroupPeriod), cgroupPeriod)
+	if err := ioutil.WriteFile(filepath.Join(dir, "cpu.max"), []byte(max), 0644); err != nil {
+		cleanup()
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		cleanup()
+		return nil, err
+	}
+	return cleanup, nil
+}
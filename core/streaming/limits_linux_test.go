@@ -0,0 +1,81 @@
+package streaming
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestLimitCommandAffinity(t *testing.T) {
+	binDir, err := ioutil.TempDir("", "limits")
+	assert.Nil(t, err)
+	defer os.RemoveAll(binDir)
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	assert.Nil(t, os.Setenv("PATH", binDir))
+	for _, name := range []string{"nice", "taskset"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\nexit 0\n"), 0755))
+	}
+	processor := NewProcessor("", false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, config.FFmpeg{ProcessNice: 5, ProcessCPUAffinity: "0-3,6"})
+	cmd := processor.command([]string{"-y"})
+	assert.Equal(t, filepath.Join(binDir, "nice"), cmd.Path)
+	assert.Equal(t, []string{filepath.Join(binDir, "nice"), "-n", "5", filepath.Join(binDir, "taskset"), "-c", "0-3,6", "ffmpeg", "-y"}, cmd.Args)
+	_, limits := processor.limitPrefix()
+	assert.Equal(t, Limits{Nice: 5, CPUs: "0-3,6"}, limits)
+}
+
+func TestStartLimited(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	processor := NewProcessor("", false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, config.FFmpeg{ProcessCgroupRoot: root})
+
+	t.Run("Should move the process into the cgroup of the stream", func(t *testing.T) {
+		cmd := exec.Command("sleep", "5")
+		process, err := processor.startLimited(cmd, "id", Options{CPUQuota: 1.5})
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer process.Kill()
+		assert.Equal(t, Limits{CPUQuota: 1.5}, limitsOf(process))
+		quota, err := ioutil.ReadFile(filepath.Join(root, "id", "cpu.max"))
+		assert.Nil(t, err)
+		assert.Equal(t, "150000 100000", string(quota))
+		procs, err := ioutil.ReadFile(filepath.Join(root, "id", "cgroup.procs"))
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(cmd.Process.Pid), string(procs))
+		subtree, err := ioutil.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+		assert.Nil(t, err)
+		assert.Equal(t, "+cpu", string(subtree))
+	})
+
+	t.Run("Should start the process without the quotas that cannot be applied", func(t *testing.T) {
+		processor := NewProcessor("", false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, config.FFmpeg{ProcessCgroupRoot: "/dev/null/cgroup"})
+		process, err := processor.startLimited(exec.Command("sleep", "5"), "id", Options{CPUQuota: 1})
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer process.Kill()
+		assert.Equal(t, Limits{}, limitsOf(process))
+		assert.True(t, process.Healthy())
+	})
+
+	t.Run("Should not limit the streams without a quota", func(t *testing.T) {
+		process, err := processor.startLimited(exec.Command("sleep", "5"), "unlimited", Options{})
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer process.Kill()
+		assert.Equal(t, Limits{}, limitsOf(process))
+		_, err = os.Stat(filepath.Join(root, "unlimited"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package streaming
+
+// affinityPrefix returns the command pinning the processes to the given CPUs, which is only supported on Linux
+func affinityPrefix(cpus string) ([]string, error) {
+	return nil, ErrLimitUnsupported
+}
+
+// joinCgroup moves the process into the cgroup limiting it to the quota, which is only supported on Linux
+func joinCgroup(dir string, quota float64, pid int) (func(), error) {
+	return nil, ErrLimitUnsupported
+}
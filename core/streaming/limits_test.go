@@ -0,0 +1,47 @@
+package streaming
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestLimitCommand(t *testing.T) {
+	binDir, err := ioutil.TempDir("", "limits")
+	assert.Nil(t, err)
+	defer os.RemoveAll(binDir)
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	assert.Nil(t, os.Setenv("PATH", binDir))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(binDir, "nice"), []byte("#!/bin/sh\nexit 0\n"), 0755))
+
+	tt := []struct {
+		FFmpeg   config.FFmpeg
+		Prefix   string
+		Expected Limits
+	}{
+		{FFmpeg: config.FFmpeg{}, Prefix: "ffmpeg -y", Expected: Limits{}},
+		{FFmpeg: config.FFmpeg{ProcessNice: 10}, Prefix: fmt.Sprintf("%s -n 10 ffmpeg -y", filepath.Join(binDir, "nice")), Expected: Limits{Nice: 10}},
+	}
+	for i, testCase := range tt {
+		processor := NewProcessor("", false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, testCase.FFmpeg)
+		cmd := processor.command([]string{"-y"})
+		_, limits := processor.limitPrefix()
+		if !assert.Equal(t, testCase.Prefix, strings.Join(cmd.Args, " ")) || !assert.Equal(t, testCase.Expected, limits) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestLimitCommand", i))
+		}
+	}
+
+	// The mechanisms that are not available are left out
+	assert.Nil(t, os.Remove(filepath.Join(binDir, "nice")))
+	processor := NewProcessor("", false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, config.FFmpeg{ProcessNice: 10})
+	assert.Equal(t, []string{"ffmpeg", "-y"}, processor.command([]string{"-y"}).Args)
+}
@@ -0,0 +1,53 @@
+package streaming
+
+import (
+	"net/url"
+	"strings"
+)
+
+// IsLocal indicates if the source is a local file or a capture device given as a file:// URI
+func IsLocal(input string) bool {
+	return strings.HasPrefix(input, "file://")
+}
+
+// LocalPath returns the path of the local source, empty if the source is not a local one
+func LocalPath(input string) string {
+	if !IsLocal(input) {
+		return ""
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// IsDevice indicates if the local source is a capture device, they are read with the v4l2 demuxer
+func IsDevice(input string) bool {
+	return strings.HasPrefix(LocalPath(input), "/dev/")
+}
+
+// getLocalArgs returns the input arguments of the local sources. Capture devices are read with the v4l2 demuxer,
+// paced files are read at their native frame rate, so they are streamed like live sources, and looped if requested
+func getLocalArgs(input string, opts Options, paced bool) []string {
+	switch {
+	case !IsLocal(input):
+		return nil
+	case IsDevice(input):
+		return []string{"-f", "v4l2"}
+	case !paced:
+		return nil
+	case opts.Loop:
+		return []string{"-re", "-stream_loop", "-1"}
+	default:
+		return []string{"-re"}
+	}
+}
+
+// sourceInput returns the input of the processes for the source, the local sources are opened by their path
+func sourceInput(input string) string {
+	if path := LocalPath(input); path != "" {
+		return path
+	}
+	return input
+}
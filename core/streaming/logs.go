@@ -0,0 +1,136 @@
+package streaming
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// openingPattern matches the lines ffmpeg logs when it starts writing a file
+var openingPattern = regexp.MustCompile(`Opening '([^']+)' for writing`)
+
+// outputVideoPattern matches the size of the video streams ffmpeg lists for its outputs
+var outputVideoPattern = regexp.MustCompile(`Stream #\d+:\d+.*: Video: .*[ ,](\d{2,5}x\d{2,5})[ ,]`)
+
+// LogBuffer keeps the last lines written by a transcoding process
+type LogBuffer struct {
+	mux         *sync.Mutex
+	lines       []string
+	size        int
+	partial     []byte
+	prefix      string
+	debug       bool
+	lastSegment time.Time // Last time the process started writing a segment
+	onSegment   func()    // Called whenever the process starts writing a segment, nil if it is not set
+	output      bool      // Indicates if the streams of an output are being listed, until its first video is found
+	resolution  string    // Size of the first video of the last output, like 1280x720
+	authFailure time.Time // Last time the process logged that the source refused the credentials
+}
+
+// NewLogBuffer creates a new buffer keeping the given number of lines.
+// Complete lines are written to the debug log with the prefix as well if debug is set
+func NewLogBuffer(size int, prefix string, debug bool) *LogBuffer {
+	return &LogBuffer{
+		mux:    &sync.Mutex{},
+		lines:  []string{},
+		size:   size,
+		prefix: prefix,
+		debug:  debug,
+	}
+}
+
+// Write stores the complete lines of the given output, the rest is kept until the line is finished
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.partial = append(b.partial, p...)
+	for {
+		// ffmpeg finishes its progress lines with carriage returns
+		i := bytes.IndexAny(b.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(b.partial[:i])
+		b.partial = b.partial[i+1:]
+		if line == "" {
+			continue
+		}
+		b.add(line)
+	}
+	return len(p), nil
+}
+
+// add appends the line with its credentials masked, dropping the oldest one if the buffer is full
+func (b *LogBuffer) add(line string) {
+	line = RedactURI(line)
+	if b.debug {
+		logrus.Debugf("%s: %s", b.prefix, line)
+	}
+	if strings.HasPrefix(line, "Output #") {
+		b.output = true
+	} else if match := outputVideoPattern.FindStringSubmatch(line); b.output && match != nil {
+		b.output = false
+		b.resolution = match[1]
+	}
+	if IsAuthFailure(line) {
+		b.authFailure = time.Now()
+	}
+	if match := openingPattern.FindStringSubmatch(line); match != nil {
+		if ext := filepath.Ext(match[1]); ext == ".ts" || ext == ".m4s" {
+			b.lastSegment = time.Now()
+			if b.onSegment != nil {
+				go b.onSegment()
+			}
+		}
+	}
+	if b.size <= 0 {
+		return
+	}
+	if len(b.lines) >= b.size {
+		b.lines = b.lines[1:]
+	}
+	b.lines = append(b.lines, line)
+}
+
+// OnSegment sets the function called whenever the process starts writing a segment, which is when the previous one
+// is complete. It is called on its own goroutine, so it does not hold up the process
+func (b *LogBuffer) OnSegment(fn func()) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.onSegment = fn
+}
+
+// Lines returns the stored lines from the oldest to the newest one
+func (b *LogBuffer) Lines() []string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	lines := make([]string, len(b.lines))
+	copy(lines, b.lines)
+	return lines
+}
+
+// OutputResolution returns the size of the video written by the process, like 1280x720, empty until ffmpeg lists its output
+func (b *LogBuffer) OutputResolution() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.resolution
+}
+
+// LastSegmentAt returns the last time the process started writing a segment, zero if it has not written one yet
+func (b *LogBuffer) LastSegmentAt() time.Time {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.lastSegment
+}
+
+// AuthFailureAt returns the last time the process logged that the source refused the credentials, zero if it never did
+func (b *LogBuffer) AuthFailureAt() time.Time {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.authFailure
+}
@@ -0,0 +1,52 @@
+package streaming
+
+import (
+	"errors"
+	"strconv"
+)
+
+// MinPartDuration is the shortest duration of the parts of low latency streams in milliseconds that is accepted
+const MinPartDuration = 100
+
+// ErrInvalidPartDuration describes an error for parts that are too short or not shorter than the segments
+var ErrInvalidPartDuration = errors.New("Part duration has to be at least 100 milliseconds and shorter than the segments")
+
+// ErrLowLatencyWithRenditions describes an error for renditions requested together with the low latency mode
+var ErrLowLatencyWithRenditions = errors.New("Renditions cannot be created in low latency mode")
+
+// LowLatencyOptions describes the settings of the low latency mode of a stream
+type LowLatencyOptions struct {
+	Enabled      bool `json:"enabled"`
+	PartDuration int  `json:"partDuration"` // Duration of the parts of the segments in milliseconds
+}
+
+// validateLowLatency checks if the low latency mode can be used with the rest of the options
+func validateLowLatency(opts Options) error {
+	if !opts.LowLatency.Enabled {
+		return nil
+	}
+	if len(opts.Renditions) > 0 {
+		return ErrLowLatencyWithRenditions
+	}
+	if opts.LowLatency.PartDuration < MinPartDuration || opts.LowLatency.PartDuration >= opts.HLS.Time*1000 {
+		return ErrInvalidPartDuration
+	}
+	return nil
+}
+
+// getLowLatencyArgs returns the muxer arguments writing the segments in parts. The segment in progress
+// is announced in the playlists while its parts are being written, so players can fetch it early
+func getLowLatencyArgs(opts LowLatencyOptions) []string {
+	return []string{
+		"-streaming",
+		"1",
+		"-ldash",
+		"1",
+		"-lhls",
+		"1",
+		"-frag_type",
+		"duration",
+		"-frag_duration",
+		strconv.FormatFloat(float64(opts.PartDuration)/1000, 'f', -1, 64),
+	}
+}
@@ -0,0 +1,26 @@
+package streaming
+
+import "strings"
+
+// CodecMJPEG is the video codec of the motion JPEG sources, like the HTTP streams of cheap cameras.
+// It cannot be copied into HLS, the streams of such sources are always transcoded
+const CodecMJPEG = "mjpeg"
+
+// IsHTTP indicates if the source is served over HTTP or HTTPS
+func IsHTTP(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// getMJPEGArgs returns the input arguments of the probed MJPEG sources. The demuxer the source was probed with is
+// named, as the multipart streams are not always detected, and the frames are timestamped on arrival as they carry none
+func getMJPEGArgs(input string, opts Options) []string {
+	if opts.Source == nil || opts.Source.Video != CodecMJPEG || !strings.Contains(input, "://") {
+		return nil
+	}
+	args := []string{}
+	switch opts.Source.Format {
+	case "mpjpeg", "mjpeg":
+		args = append(args, "-f", opts.Source.Format)
+	}
+	return append(args, "-use_wallclock_as_timestamps", "1")
+}
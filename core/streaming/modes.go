@@ -0,0 +1,85 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ModeAuto copies the video if no renditions are requested
+const ModeAuto = "auto"
+
+// ModeCopy copies every track without re-encoding
+const ModeCopy = "copy"
+
+// ModeTranscode encodes the video with the configured encoder
+const ModeTranscode = "transcode"
+
+// ErrInvalidMode describes an error for unknown transcoding modes
+var ErrInvalidMode = errors.New("Mode has to be auto, copy or transcode")
+
+// ErrCopyWithRenditions describes an error for copy mode requested together with renditions
+var ErrCopyWithRenditions = errors.New("Renditions cannot be created in copy mode")
+
+// ErrIncompatibleCodecFn is used to create errors for sources that cannot be copied into HLS
+var ErrIncompatibleCodecFn = func(codec string) error {
+	return fmt.Errorf("%s video cannot be copied into HLS, it has to be transcoded", codec)
+}
+
+// copyableCodecs are the video codecs HLS can carry without re-encoding
+var copyableCodecs = map[string]string{
+	"h264": "h264_mp4toannexb",
+	"hevc": "hevc_mp4toannexb",
+}
+
+// IsCopyable indicates if the given video codec can be carried by HLS without re-encoding
+func IsCopyable(codec string) bool {
+	_, ok := copyableCodecs[codec]
+	return ok
+}
+
+// validateMode checks if the given mode is known and can be used with the rest of the options
+func validateMode(opts Options) error {
+	switch opts.Mode {
+	case "", ModeAuto, ModeTranscode:
+		return nil
+	case ModeCopy:
+		if len(opts.Renditions) > 0 {
+			return ErrCopyWithRenditions
+		}
+		return nil
+	default:
+		return ErrInvalidMode
+	}
+}
+
+// getVideoArgs returns the encoding arguments based on the mode of the stream
+func getVideoArgs(opts Options) []string {
+	switch {
+	case opts.AudioOnly:
+		return getAudioOnlyArgs(opts)
+	case len(opts.Renditions) > 0:
+		return getRenditionArgs(opts)
+	case opts.Mode == ModeCopy:
+		args := []string{"-c:v", "copy"}
+		// Fragmented MP4 segments carry the video in its original format
+		if filter, ok := copyableCodecs[opts.SourceCodec]; ok && !opts.FragmentedMP4() {
+			args = append(args, "-bsf:v", filter)
+		}
+		// Apple players only play HEVC in MP4 if it is tagged with the parameter sets in the samples
+		if opts.SourceCodec == "hevc" && opts.FragmentedMP4() {
+			args = append(args, "-tag:v", "hvc1")
+		}
+		return append(args, getAudioArgs(opts)...)
+	case opts.Mode == ModeTranscode:
+		args := []string{"-c:v", getVideoEncoder(opts.HardwareAccel)}
+		if opts.HardwareAccel == AccelNone {
+			args = append(args, "-preset", getPreset(opts))
+		}
+		args = append(args, getProfileArgs(opts)...)
+		args = append(args, getFilterArgs(opts)...)
+		args = append(args, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", opts.HLS.Time))
+		return append(args, getAudioArgs(opts)...)
+	default:
+		return append([]string{"-vcodec", "copy"}, getAudioArgs(opts)...)
+	}
+}
@@ -0,0 +1,257 @@
+package streaming
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+// MaxHLSTime is the longest segment duration in seconds that is accepted
+const MaxHLSTime = 60
+
+// MaxHLSListSize is the largest number of segments kept in the playlist that is accepted
+const MaxHLSListSize = 100
+
+// ErrInvalidHLSTime describes an error for segment durations out of the accepted range
+var ErrInvalidHLSTime = errors.New("HLS time has to be between 1 and 60 seconds")
+
+// ErrInvalidIdleTimeout describes an error for idle timeouts that are negative or not given as seconds or a duration
+var ErrInvalidIdleTimeout = errors.New("Idle timeout has to be a number of seconds or a duration, it cannot be negative")
+
+// ErrInvalidHLSListSize describes an error for playlist windows out of the accepted range
+var ErrInvalidHLSListSize = errors.New("HLS list size has to be between 1 and 100")
+
+// ErrInvalidRecordSegmentTime describes an error for recorded files that would be too short
+var ErrInvalidRecordSegmentTime = errors.New("Recording segment time has to be at least 1 second")
+
+// HLSOptions describes the settings of the HLS output of a stream
+type HLSOptions struct {
+	Time           int    `json:"time"`                  // Duration of the segments in seconds
+	ListSize       int    `json:"listSize"`              // Number of segments kept in the playlist
+	DeleteSegments bool   `json:"deleteSegments"`        // Indicates if segments falling out of the playlist are deleted
+	SegmentType    string `json:"segmentType,omitempty"` // Container of the segments, ts if empty
+	// ProgramDateTime indicates if the playlists carry the wall clock time of the segments, only the HLS muxer writes it
+	ProgramDateTime bool `json:"programDateTime,omitempty"`
+}
+
+// RecordingOptions describes the settings of the MP4 recording of a stream
+type RecordingOptions struct {
+	Enabled     bool `json:"enabled"`
+	Always      bool `json:"always"`      // Indicates if the recording keeps running while the stream is not watched
+	SegmentTime int  `json:"segmentTime"` // Duration of the recorded files in seconds
+}
+
+// Options describes the settings a given stream is transcoded with
+type Options struct {
+	HLS           HLSOptions        `json:"hls"`
+	Renditions    []Rendition       `json:"renditions,omitempty"`
+	HardwareAccel string            `json:"hardwareAccel"`
+	Device        string            `json:"device,omitempty"` // Device the accelerated video is encoded on, the configured one if empty
+	Mode          string            `json:"mode"`
+	SourceCodec   string            `json:"sourceCodec,omitempty"`
+	Source        *SourceInfo       `json:"source,omitempty"` // Probed tracks of the source, nil if it was not probed
+	Audio         string            `json:"audio,omitempty"`
+	AudioBitrate  string            `json:"audioBitrate,omitempty"`
+	Lazy          bool              `json:"lazy"`
+	IdleTimeout   int               `json:"idleTimeout"` // Seconds the stream keeps running without any activity, 0 if it is never cleaned up
+	Recording     RecordingOptions  `json:"recording"`
+	Format        string            `json:"format,omitempty"` // Output format of the stream, hls if empty
+	LowLatency    LowLatencyOptions `json:"lowLatency"`
+	Transport     string            `json:"transport,omitempty"`  // RTSP transport of the source, tcp if empty
+	Lifecycle     string            `json:"lifecycle,omitempty"`  // Policy deciding when the stream is stopped, activity if empty
+	Activity      string            `json:"activity,omitempty"`   // What counts as the activity of the stream, http, output or both, http if empty
+	Loop          bool              `json:"loop,omitempty"`       // Indicates if the local file of the source is played in a loop
+	SDP           string            `json:"sdp,omitempty"`        // Content of the SDP file the source is read from instead of its URI, empty if it has none
+	DVRWindow     int               `json:"dvrWindow,omitempty"`  // Seconds of segments kept in the playlist so the stream can be rewound, 0 if it keeps the list size
+	Priority      int               `json:"priority,omitempty"`   // Streams with a higher priority evict the ones with a lower priority once MAX_STREAMS are running
+	Push          string            `json:"push,omitempty"`       // rtmp:// or srt:// URL the stream is forwarded to besides its own output, not pushed if empty
+	MPEGTS        bool              `json:"mpegts,omitempty"`     // Indicates if the transcoding is also written as MPEG-TS for the clients of the relay
+	AudioOnly     bool              `json:"audioOnly,omitempty"`  // Indicates if only the audio of the source is streamed
+	Profile       *config.Profile   `json:"profile,omitempty"`    // Named encoder settings the stream was started with, nil if it uses none
+	Resolution    *Resolution       `json:"resolution,omitempty"` // Largest size the video is scaled down to, nil if it keeps the size of the source
+	MaxFPS        int               `json:"maxFps,omitempty"`     // Frame rate the transcoded video is capped at, 0 if it keeps the rate of the source
+	CPUQuota      float64           `json:"cpuQuota,omitempty"`   // Number of CPUs the processes of the stream can use at most, 0 if they are not limited
+	// InputArgs and OutputArgs are added to the arguments of the configuration before the input and the output of the process
+	InputArgs  []string `json:"inputArgs,omitempty"`
+	OutputArgs []string `json:"outputArgs,omitempty"`
+	// Directory is the id of the stream and its directory under the store directory, it is derived from the URI if empty
+	Directory string `json:"directory,omitempty"`
+	// Layout is where the files of the stream are written, nil if they are written into the directory named after its id
+	Layout *Layout `json:"layout,omitempty"`
+	// Retry is the retry policy of the stream, the one of the configuration applies if it is nil
+	Retry *Backoff `json:"retry,omitempty"`
+	// Streak is the settings of the streak telling if the stream is watched
+	Streak StreakOptions `json:"streak"`
+	// Fallbacks are the URIs of the source with the fallback credentials, tried in order once the source refuses the current ones.
+	// They carry the credentials, so they are never written out
+	Fallbacks []string `json:"-"`
+}
+
+// NewOptions creates the default options based on the configuration
+func NewOptions(process config.Process, hardware config.Hardware) Options {
+	return Options{
+		HLS: HLSOptions{
+			Time:            process.HLSTime,
+			ListSize:        process.HLSListSize,
+			DeleteSegments:  !process.KeepFiles,
+			SegmentType:     process.SegmentType,
+			ProgramDateTime: process.HLSProgramDateTime,
+		},
+		Renditions:    ParseRenditions(process.Renditions),
+		HardwareAccel: hardware.Accel,
+		Mode:          process.Mode,
+		Audio:         process.Audio,
+		AudioBitrate:  process.AudioBitrate,
+		Lazy:          process.Lazy,
+		IdleTimeout:   int(process.CleanupTime / time.Second),
+		Recording: RecordingOptions{
+			Enabled:     process.Record || process.RecordAlways,
+			Always:      process.RecordAlways,
+			SegmentTime: int(process.RecordSegmentTime / time.Second),
+		},
+		Format:    process.Format,
+		Transport: process.Transport,
+		Lifecycle: process.Lifecycle,
+		Activity:  process.Activity,
+		MPEGTS:    process.MPEGTSEnabled,
+		MaxFPS:    process.MaxFPS,
+		Streak: StreakOptions{
+			HitLimit: process.StreakHitLimit,
+			HotWait:  int(process.StreakHotWait / time.Second),
+		},
+	}
+}
+
+// Validate checks if the options are in the accepted ranges
+func (o Options) Validate() error {
+	if o.HLS.Time < 1 || o.HLS.Time > MaxHLSTime {
+		return ErrInvalidHLSTime
+	}
+	if o.HLS.ListSize < 1 || o.HLS.ListSize > MaxHLSListSize {
+		return ErrInvalidHLSListSize
+	}
+	if o.IdleTimeout < 0 {
+		return ErrInvalidIdleTimeout
+	}
+	if err := validateDVR(o); err != nil {
+		return err
+	}
+	if o.Streak.HitLimit < 0 || o.Streak.HotWait < 0 {
+		return ErrInvalidStreak
+	}
+	if o.Recording.Enabled && o.Recording.SegmentTime < 1 {
+		return ErrInvalidRecordSegmentTime
+	}
+	if err := validateHardwareAccel(o.HardwareAccel); err != nil {
+		return err
+	}
+	if err := validateMode(o); err != nil {
+		return err
+	}
+	if err := validatePush(o.Push); err != nil {
+		return err
+	}
+	if err := validateSegmentType(o.HLS); err != nil {
+		return err
+	}
+	if err := validateFormat(o); err != nil {
+		return err
+	}
+	if err := validateLowLatency(o); err != nil {
+		return err
+	}
+	if err := validateTransport(o); err != nil {
+		return err
+	}
+	if err := validateLifecycle(o); err != nil {
+		return err
+	}
+	if err := validateActivity(o); err != nil {
+		return err
+	}
+	if err := validateAudio(o); err != nil {
+		return err
+	}
+	if err := validateProfile(o); err != nil {
+		return err
+	}
+	if err := validateResolution(o); err != nil {
+		return err
+	}
+	if err := validateMaxFPS(o.MaxFPS); err != nil {
+		return err
+	}
+	return validateRenditions(o.Renditions)
+}
+
+// AudioMode returns the audio mode of the stream. Without an explicit setting
+// the audio is copied in copy mode and transcoded to AAC otherwise
+func (o Options) AudioMode() string {
+	switch {
+	case o.Audio != "":
+		return o.Audio
+	case o.Mode == ModeCopy:
+		return AudioCopy
+	default:
+		return AudioAAC
+	}
+}
+
+// OutputFormat returns the output format of the stream, streams created without a format are written as HLS
+func (o Options) OutputFormat() string {
+	if o.Format == "" {
+		return FormatHLS
+	}
+	return o.Format
+}
+
+// UsesDASHMuxer indicates if the stream is written by the DASH muxer, which
+// writes the HLS playlists of the streams in both formats and in low latency mode too
+func (o Options) UsesDASHMuxer() bool {
+	return o.OutputFormat() != FormatHLS || o.LowLatency.Enabled
+}
+
+// FragmentedMP4 indicates if the segments of the stream are written as fragmented MP4
+func (o Options) FragmentedMP4() bool {
+	return o.UsesDASHMuxer() || o.HLS.SegmentType == SegmentFMP4
+}
+
+// RTSPTransport returns the RTSP transport of the source, streams created without a transport are received over TCP
+func (o Options) RTSPTransport() string {
+	if o.Transport == "" {
+		return TransportTCP
+	}
+	return o.Transport
+}
+
+// IdleDuration returns the time the stream keeps running without any activity, 0 if it is never cleaned up automatically
+func (o Options) IdleDuration() time.Duration {
+	return time.Duration(o.IdleTimeout) * time.Second
+}
+
+// streakWait returns the time the streak of the stream stays active without requests,
+// the streaks of the streams that are never cleaned up do not expire
+func (o Options) streakWait() time.Duration {
+	if o.IdleTimeout <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return o.IdleDuration()
+}
+
+// KeepaliveInterval returns the seconds between the keepalives that keep the stream running
+func (o Options) KeepaliveInterval() int {
+	if o.IdleTimeout <= 0 {
+		return 0
+	}
+	if o.IdleTimeout < 2 {
+		return 1
+	}
+	return o.IdleTimeout / 2
+}
+
+// UsesHardware indicates if the stream is encoded with hardware acceleration
+func (o Options) UsesHardware() bool {
+	return o.HardwareAccel != AccelNone && (len(o.Renditions) > 0 || o.Mode == ModeTranscode)
+}
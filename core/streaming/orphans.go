@@ -0,0 +1,271 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// OrphanTerminate is the policy stopping the processes left running by the previous run of the service before the streams are started again
+const OrphanTerminate = "terminate"
+
+// OrphanAdopt is the policy taking over the processes left running by the previous run of the service instead of starting the streams again
+const OrphanAdopt = "adopt"
+
+// adoptedPollInterval is the time between the checks of the adopted processes, they are not children of the service to wait for
+const adoptedPollInterval = 250 * time.Millisecond
+
+// ErrProcessGone describes an error for processes that do not run the transcoding of their state anymore
+var ErrProcessGone = errors.New("Process does not run the transcoding anymore")
+
+// ProcessState describes a running transcoding process. It is stored when the process starts and removed when it exits,
+// so the processes left running by an unclean exit of the service can be found again
+type ProcessState struct {
+	Pid       int       `json:"pid"`
+	URI       string    `json:"uri"`
+	Directory string    `json:"directory"`
+	StartedAt time.Time `json:"startedAt"`
+	// Start is the start time of the process as the operating system reports it, so a reused pid is not mistaken for the process.
+	// It is 0 where it is not known
+	Start uint64 `json:"start,omitempty"`
+}
+
+// processIdentity describes what the operating system reports about a running process
+type processIdentity struct {
+	start uint64
+	args  []string
+}
+
+// Verify checks if the process of the state still runs the transcoding of the state: it has to be running since the same time,
+// with the source and the output directory of the state in its command line. Processes that are not verified must be left alone
+func (state ProcessState) Verify() bool {
+	if state.Pid <= 1 || state.Pid == os.Getpid() || state.URI == "" || state.Directory == "" {
+		return false
+	}
+	identity, err := identify(state.Pid)
+	if err != nil {
+		return false
+	}
+	if state.Start != 0 && identity.start != state.Start {
+		return false
+	}
+	return matchesCommand(identity.args, state.URI, state.Directory)
+}
+
+// matchesCommand indicates if the arguments carry the source as one of them and a path inside the directory
+func matchesCommand(args []string, uri, dir string) bool {
+	dir = filepath.Clean(dir)
+	hasURI, hasDir := false, false
+	for _, arg := range args {
+		if arg == uri {
+			hasURI = true
+		}
+		if filepath.Clean(arg) == dir || strings.HasPrefix(arg, dir+string(filepath.Separator)) {
+			hasDir = true
+		}
+	}
+	return hasURI && hasDir
+}
+
+// ProcessStates stores the states of the running processes in a directory, in a file for each stream
+type ProcessStates struct {
+	dir string
+	mux *sync.Mutex
+}
+
+// NewProcessStates creates a new instance of ProcessStates storing the states in the given directory
+func NewProcessStates(dir string) *ProcessStates {
+	return &ProcessStates{dir, &sync.Mutex{}}
+}
+
+// file returns the path of the state file of the stream
+func (s *ProcessStates) file(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Save stores the state of the process of the stream, replacing the previous one.
+// The file is only readable by the service, since the source can carry credentials
+func (s *ProcessStates) Save(id string, state ProcessState) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// The state is written next to its file, then moved over it, so it is never read half written
+	tmp := s.file(id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file(id))
+}
+
+// Remove removes the state of the stream if it describes the process with the given pid, the state of a newer process is kept
+func (s *ProcessStates) Remove(id string, pid int) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	b, err := ioutil.ReadFile(s.file(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var state ProcessState
+	if err := json.Unmarshal(b, &state); err == nil && state.Pid != pid {
+		return nil
+	}
+	return os.Remove(s.file(id))
+}
+
+// Load returns the stored states keyed by the id of their stream, the files that cannot be read are skipped
+func (s *ProcessStates) Load() (map[string]ProcessState, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	states := map[string]ProcessState{}
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return states, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		var state ProcessState
+		if err := json.Unmarshal(b, &state); err != nil {
+			continue
+		}
+		states[strings.TrimSuffix(file.Name(), ".json")] = state
+	}
+	return states, nil
+}
+
+// stateOf returns the state of the process started for the stream
+func (strm *Stream) stateOf(process Process) ProcessState {
+	state := ProcessState{Pid: pidOf(process), URI: strm.OriginalURI, Directory: strm.StorePath, StartedAt: strm.StartedAt}
+	if identity, err := identify(state.Pid); err == nil {
+		state.Start = identity.start
+	}
+	return state
+}
+
+// stateID returns the id the state of the stream is stored with, the id of the stream
+func (strm *Stream) stateID() string {
+	return streamID(strm.Options, strm.StorePath)
+}
+
+// adoptedProcess is the Process of a transcoding left running by the previous run of the service.
+// It is not a child of the service, so its exit is noticed by checking it periodically
+type adoptedProcess struct {
+	state ProcessState
+	done  chan struct{}
+}
+
+// AdoptProcess takes over the verified process of the state. Its output is not captured anymore,
+// so the logs and the progress of the encoding are only available after the stream is restarted
+func AdoptProcess(state ProcessState) (Process, error) {
+	process, err := adopt(state)
+	if err != nil {
+		return nil, err
+	}
+	return process, nil
+}
+
+// adopt takes over the verified process of the state, checking it until it exits
+func adopt(state ProcessState) (*adoptedProcess, error) {
+	if !state.Verify() {
+		return nil, ErrProcessGone
+	}
+	process := &adoptedProcess{state, make(chan struct{})}
+	go func() {
+		for state.Verify() {
+			time.Sleep(adoptedPollInterval)
+		}
+		close(process.done)
+	}()
+	return process, nil
+}
+
+// Wait blocks until the process exits
+func (p *adoptedProcess) Wait() error {
+	<-p.done
+	return ErrProcessGone
+}
+
+// Stop sends SIGTERM to the process, if it still runs the transcoding
+func (p *adoptedProcess) Stop() error {
+	return p.signal(syscall.SIGTERM)
+}
+
+// Kill kills the process, if it still runs the transcoding
+func (p *adoptedProcess) Kill() error {
+	return p.signal(syscall.SIGKILL)
+}
+
+// signal sends the signal to the process and the group it leads, the process is verified again so the signal never reaches a process reusing its pid
+func (p *adoptedProcess) signal(signal syscall.Signal) error {
+	if !p.state.Verify() {
+		return nil
+	}
+	return signalLeader(p.state.Pid, signal)
+}
+
+// Pid returns the id of the operating system process
+func (p *adoptedProcess) Pid() int {
+	return p.state.Pid
+}
+
+// Healthy indicates if the process still runs the transcoding
+func (p *adoptedProcess) Healthy() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// AdoptingTranscoder returns a Transcoder handing out the adopted process on the first start of the stream,
+// the later starts are made by the given transcoder
+func AdoptingTranscoder(adopted Process, next Transcoder) Transcoder {
+	once := &sync.Once{}
+	return TranscoderFunc(func(ctx context.Context, source, outDir string, opts Options) (Process, error) {
+		process := Process(nil)
+		once.Do(func() { process = adopted })
+		if process != nil {
+			return process, nil
+		}
+		if next == nil {
+			return nil, ErrProcessNotCreated
+		}
+		return next.Start(ctx, source, outDir, opts)
+	})
+}
+
+// TerminateOrphan stops the verified process of the state, it is killed if it does not exit within the grace period.
+// Returns false if the process does not run the transcoding of the state anymore, it is left alone then
+func TerminateOrphan(state ProcessState, grace time.Duration) (bool, error) {
+	process, err := adopt(state)
+	if err != nil {
+		return false, nil
+	}
+	_, err = Terminate(context.Background(), process, grace)
+	return true, err
+}
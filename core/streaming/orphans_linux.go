@@ -0,0 +1,30 @@
+package streaming
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// identify returns the start time and the command line of the running process, read from /proc.
+// The start time is the 22nd field of the stat file, counted in clock ticks since the boot
+func identify(pid int) (processIdentity, error) {
+	fields, err := readStat(pid)
+	if err != nil {
+		return processIdentity{}, ErrProcessGone
+	}
+	// Exited processes that are not reaped yet are not running anymore
+	if fields[0] == "Z" || fields[0] == "X" {
+		return processIdentity{}, ErrProcessGone
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return processIdentity{}, ErrProcessGone
+	}
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || len(cmdline) == 0 {
+		return processIdentity{}, ErrProcessGone
+	}
+	return processIdentity{start, strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")}, nil
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package streaming
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// identify returns the command line of the running process, read with ps where /proc is not available.
+// The start time is not known, the arguments are split at the spaces
+func identify(pid int) (processIdentity, error) {
+	out, err := exec.Command("ps", "-o", "stat=,args=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return processIdentity{}, ErrProcessGone
+	}
+	fields := strings.Fields(string(out))
+	// Exited processes that are not reaped yet are not running anymore
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "Z") {
+		return processIdentity{}, ErrProcessGone
+	}
+	return processIdentity{0, fields[1:]}, nil
+}
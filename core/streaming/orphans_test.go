@@ -0,0 +1,197 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startOrphan starts a process carrying the source and the output directory in its command line, like ffmpeg does
+func startOrphan(t *testing.T, uri, dir string) (ProcessState, <-chan error) {
+	cmd := exec.Command("sh", "-c", "sleep 10; true", uri, filepath.Join(dir, "index.m3u8"))
+	if !assert.Nil(t, cmd.Start()) {
+		t.FailNow()
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	state := ProcessState{Pid: cmd.Process.Pid, URI: uri, Directory: dir, StartedAt: time.Now()}
+	if identity, err := identify(state.Pid); err == nil {
+		state.Start = identity.start
+	}
+	return state, exited
+}
+
+func TestMatchesCommand(t *testing.T) {
+	tt := []struct {
+		Args     []string
+		Expected bool
+	}{
+		{Args: []string{"ffmpeg", "-i", "rtsp://camera/live", "/data/abc/index.m3u8"}, Expected: true},
+		{Args: []string{"ffmpeg", "-i", "rtsp://camera/live", "/data/abc"}, Expected: true},
+		{Args: []string{"ffmpeg", "-i", "rtsp://camera/live", "/data/abcd/index.m3u8"}, Expected: false},
+		{Args: []string{"ffmpeg", "-i", "rtsp://camera/live2", "/data/abc/index.m3u8"}, Expected: false},
+		{Args: []string{"ffmpeg", "-i", "rtsp://camera/live"}, Expected: false},
+		{Args: []string{}, Expected: false},
+	}
+	for i, test := range tt {
+		if !assert.Equal(t, test.Expected, matchesCommand(test.Args, "rtsp://camera/live", "/data/abc/")) {
+			t.Error(fmt.Errorf("%d testcase is failing for matchesCommand", i))
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orphans")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	state, _ := startOrphan(t, "rtsp://camera/live", dir)
+	defer killOrphan(state.Pid)
+
+	t.Run("Should verify the process of the state", func(t *testing.T) {
+		assert.True(t, state.Verify())
+	})
+
+	t.Run("Should refuse the processes transcoding something else", func(t *testing.T) {
+		other := state
+		other.URI = "rtsp://camera/other"
+		assert.False(t, other.Verify())
+		other = state
+		other.Directory = filepath.Join(dir, "other")
+		assert.False(t, other.Verify())
+	})
+
+	t.Run("Should refuse the reused pids", func(t *testing.T) {
+		if state.Start == 0 {
+			t.Skip("Start time of the processes is not known on this platform")
+		}
+		other := state
+		other.Start++
+		assert.False(t, other.Verify())
+	})
+
+	t.Run("Should refuse the service itself and the missing processes", func(t *testing.T) {
+		for _, pid := range []int{0, 1, os.Getpid()} {
+			other := state
+			other.Pid = pid
+			assert.False(t, other.Verify())
+		}
+		cmd := exec.Command("true")
+		assert.Nil(t, cmd.Run())
+		other := state
+		other.Pid = cmd.Process.Pid
+		assert.False(t, other.Verify())
+	})
+}
+
+func TestProcessStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "states")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	states := NewProcessStates(filepath.Join(dir, "processes"))
+
+	loaded, err := states.Load()
+	assert.Nil(t, err)
+	assert.Empty(t, loaded)
+
+	state := ProcessState{Pid: 4242, URI: "rtsp://camera/live", Directory: "/data/abc", StartedAt: time.Now().UTC().Round(time.Second), Start: 12}
+	assert.Nil(t, states.Save("abc", state))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "processes", "broken.json"), []byte("{"), 0600))
+	info, err := os.Stat(filepath.Join(dir, "processes", "abc.json"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	loaded, err = states.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]ProcessState{"abc": state}, loaded)
+
+	// The state of a newer process is kept
+	assert.Nil(t, states.Remove("abc", 4343))
+	loaded, _ = states.Load()
+	assert.Len(t, loaded, 1)
+	assert.Nil(t, states.Remove("abc", 4242))
+	assert.Nil(t, states.Remove("unknown", 4242))
+	loaded, _ = states.Load()
+	assert.Empty(t, loaded)
+}
+
+func TestAdoptProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orphans")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Should notice the exit of the adopted process", func(t *testing.T) {
+		state, exited := startOrphan(t, "rtsp://camera/live", dir)
+		process, err := AdoptProcess(state)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, state.Pid, process.(interface{ Pid() int }).Pid())
+		assert.True(t, process.(interface{ Healthy() bool }).Healthy())
+		waited := make(chan error, 1)
+		go func() { waited <- process.Wait() }()
+		assert.Nil(t, process.Stop())
+		<-exited
+		select {
+		case err := <-waited:
+			assert.Equal(t, ErrProcessGone, err)
+		case <-time.After(5 * time.Second):
+			t.Error("Exit of the adopted process is not noticed")
+		}
+		// The pid could be reused by now, nothing is signalled anymore
+		assert.Nil(t, process.Kill())
+	})
+
+	t.Run("Should not adopt the processes that are not verified", func(t *testing.T) {
+		state, _ := startOrphan(t, "rtsp://camera/live", dir)
+		defer killOrphan(state.Pid)
+		state.URI = "rtsp://camera/other"
+		_, err := AdoptProcess(state)
+		assert.Equal(t, ErrProcessGone, err)
+		terminated, err := TerminateOrphan(state, time.Second)
+		assert.Nil(t, err)
+		assert.False(t, terminated)
+	})
+
+	t.Run("Should terminate the orphan", func(t *testing.T) {
+		state, exited := startOrphan(t, "rtsp://camera/live", dir)
+		terminated, err := TerminateOrphan(state, time.Second)
+		assert.Nil(t, err)
+		assert.True(t, terminated)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			t.Error("Orphan is not terminated")
+		}
+	})
+
+	t.Run("Should hand out the adopted process on the first start only", func(t *testing.T) {
+		adopted := &fakeProcess{}
+		transcoder := AdoptingTranscoder(adopted, FakeTranscoder{})
+		process, err := transcoder.Start(context.Background(), "rtsp://camera/live", dir, Options{})
+		assert.Nil(t, err)
+		assert.True(t, process == Process(adopted))
+		process, err = transcoder.Start(context.Background(), "rtsp://camera/live", dir, Options{})
+		assert.Nil(t, err)
+		assert.False(t, process == Process(adopted))
+		process.Kill()
+		transcoder = AdoptingTranscoder(adopted, nil)
+		_, err = transcoder.Start(context.Background(), "rtsp://camera/live", dir, Options{})
+		assert.Nil(t, err)
+		_, err = transcoder.Start(context.Background(), "rtsp://camera/live", dir, Options{})
+		assert.Equal(t, ErrProcessNotCreated, err)
+	})
+}
+
+// killOrphan kills the process, ignoring the processes that exited
+func killOrphan(pid int) {
+	if process, err := os.FindProcess(pid); err == nil {
+		process.Kill()
+	}
+}
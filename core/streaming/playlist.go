@@ -0,0 +1,96 @@
+package streaming
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// programDateTimeLayouts are the layouts of the EXT-X-PROGRAM-DATE-TIME tags, ffmpeg writes the offset without a colon
+var programDateTimeLayouts = []string{"2006-01-02T15:04:05.999999999Z0700", time.RFC3339Nano}
+
+// NewestSegmentTime returns the wall clock time of the newest segment listed by the playlist on the given path,
+// it is the time of the last EXT-X-PROGRAM-DATE-TIME tag plus the duration of the segments after it.
+// Returns nil if the playlist cannot be read or it carries no time
+func NewestSegmentTime(path string) *time.Time {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var newest, tagged *time.Time
+	previous := 0.0
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			tagged = parseProgramDateTime(strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			if tagged != nil {
+				newest, tagged = tagged, nil
+			} else if newest != nil {
+				next := newest.Add(time.Duration(previous * float64(time.Second)))
+				newest = &next
+			}
+			value := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)[0]
+			previous, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	return newest
+}
+
+// parseProgramDateTime parses the time of an EXT-X-PROGRAM-DATE-TIME tag, nil if it is not valid
+func parseProgramDateTime(value string) *time.Time {
+	for _, layout := range programDateTimeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// PlaylistDuration returns the number of seconds of the segments listed by the playlist on the given path, 0 if it cannot be read
+func PlaylistDuration(path string) float64 {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	duration := 0.0
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#EXTINF:") {
+			continue
+		}
+		value := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)[0]
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			duration += seconds
+		}
+	}
+	return duration
+}
+
+// PlaylistReferences returns the paths of the media files referenced by the playlist on the given path
+func PlaylistReferences(path string) []string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	refs := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, "?"); i >= 0 {
+			line = line[:i]
+		}
+		refs = append(refs, filepath.Join(filepath.Dir(path), line))
+	}
+	return refs
+}
@@ -0,0 +1,44 @@
+package streaming
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewestSegmentTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playlist")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(content string) string {
+		path := filepath.Join(dir, indexPlaylist)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	t.Run("Should read the time of the last tagged segment", func(t *testing.T) {
+		path := write("#EXTM3U\n#EXT-X-PROGRAM-DATE-TIME:2019-01-20T12:00:00.000+0000\n#EXTINF:4.000000,\n0.ts\n" +
+			"#EXT-X-PROGRAM-DATE-TIME:2019-01-20T12:00:04.000+0000\n#EXTINF:4.000000,\n1.ts\n")
+		newest := NewestSegmentTime(path)
+		if assert.NotNil(t, newest) {
+			assert.True(t, time.Date(2019, 1, 20, 12, 0, 4, 0, time.UTC).Equal(*newest))
+		}
+	})
+
+	t.Run("Should add the durations of the segments after the last tag", func(t *testing.T) {
+		path := write("#EXTM3U\n#EXT-X-PROGRAM-DATE-TIME:2019-01-20T12:00:00.000Z\n#EXTINF:4.000000,\n0.ts\n#EXTINF:2.500000,\n1.ts\n#EXTINF:4.000000,\n2.ts\n")
+		newest := NewestSegmentTime(path)
+		if assert.NotNil(t, newest) {
+			assert.True(t, time.Date(2019, 1, 20, 12, 0, 6, int(time.Millisecond*500), time.UTC).Equal(*newest))
+		}
+	})
+
+	t.Run("Should not read a time from the playlists without it", func(t *testing.T) {
+		assert.Nil(t, NewestSegmentTime(write("#EXTM3U\n#EXTINF:4.000000,\n0.ts\n")))
+		assert.Nil(t, NewestSegmentTime(filepath.Join(dir, "missing.m3u8")))
+	})
+}
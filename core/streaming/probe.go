@@ -0,0 +1,110 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrProbeTimeout is sent when the source did not answer the probe in time
+var ErrProbeTimeout = errors.New("Probing the source timed out")
+
+// ErrProbeFn is used to create dynamic errors for sources that could not be probed, the credentials in the output are masked
+var ErrProbeFn = func(output string) error {
+	return fmt.Errorf("Source could not be probed: %s", RedactURI(output))
+}
+
+// SourceInfo describes the codecs of the tracks of a source and the resolution and the frame rate of its video.
+// Codecs of missing tracks are empty
+type SourceInfo struct {
+	Video  string  `json:"video"`
+	Audio  string  `json:"audio"`
+	Width  int     `json:"width,omitempty"`
+	Height int     `json:"height,omitempty"`
+	FPS    float64 `json:"fps,omitempty"`    // Frame rate of the video, 0 if it is unknown
+	Format string  `json:"format,omitempty"` // Name of the demuxer the source was opened with, like mpjpeg
+}
+
+// probeResult describes the part of the ffprobe output that is used
+type probeResult struct {
+	Streams []struct {
+		CodecName string `json:"codec_name"`
+		CodecType string `json:"codec_type"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		FrameRate string `json:"r_frame_rate"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+	} `json:"format"`
+}
+
+// Probe returns the codecs of the first video and audio tracks of the source opened with the input arguments of the options.
+// The probing process is killed if it does not finish within the probe timeout
+func (p Processor) Probe(ctx context.Context, URI string, opts Options) (SourceInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.probeTimeout)
+	defer cancel()
+	// The processes of the stream write the SDP file again, the one of the probe is not kept
+	if opts.SDP != "" {
+		defer os.Remove(p.sdpPath(URI, opts))
+	}
+	var stderr bytes.Buffer
+	args := append([]string{"-v", "error"}, getTransportArgs(URI, opts.Transport)...)
+	args = append(args, getLocalArgs(URI, opts, false)...)
+	args = append(args, p.getExtraInputArgs(URI, opts)...)
+	args = append(
+		args,
+		"-show_entries",
+		"stream=codec_name,codec_type,width,height,r_frame_rate:format=format_name",
+		"-of",
+		"json",
+		p.input(URI, opts),
+	)
+	cmd := exec.CommandContext(ctx, "ffprobe", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return SourceInfo{}, ErrProbeTimeout
+	}
+	if ctx.Err() != nil {
+		return SourceInfo{}, ctx.Err()
+	}
+	if err != nil {
+		output := strings.TrimSpace(stderr.String())
+		// The refused credentials are told apart, so they are not tried again
+		if IsAuthFailure(output) {
+			return SourceInfo{}, ErrSourceAuthFailed
+		}
+		if output != "" {
+			return SourceInfo{}, ErrProbeFn(output)
+		}
+		return SourceInfo{}, ErrProbeFn(err.Error())
+	}
+	return parseProbe(out)
+}
+
+// parseProbe creates the source information from the json output of ffprobe
+func parseProbe(out []byte) (SourceInfo, error) {
+	var result probeResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		return SourceInfo{}, err
+	}
+	info := SourceInfo{Format: result.Format.FormatName}
+	for _, stream := range result.Streams {
+		switch {
+		case stream.CodecType == "video" && info.Video == "":
+			info.Video = stream.CodecName
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.FPS = parseFrameRate(stream.FrameRate)
+		case stream.CodecType == "audio" && info.Audio == "":
+			info.Audio = stream.CodecName
+		}
+	}
+	return info, nil
+}
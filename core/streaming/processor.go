@@ -1,18 +1,23 @@
 package streaming
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Roverr/hotstreak"
 	"github.com/Roverr/rtsp-stream/core/config"
-	"github.com/kennygrant/sanitize"
 	"github.com/natefinch/lumberjack"
 	"github.com/sirupsen/logrus"
 )
@@ -23,18 +28,30 @@ var ErrInvalidHost = errors.New("Invalid hostname")
 // ErrUnparsedURL describes an error that occours when the parsing process cannot be deemed as successful
 var ErrUnparsedURL = errors.New("URL is not parsed correctly")
 
+// ErrRecordingNotCreated describes an error for recordings that could not get their directory
+var ErrRecordingNotCreated = errors.New("Directory of the recording could not be created")
+
 // IProcessor is an interface describing a processor service
 type IProcessor interface {
-	NewProcess(URI string) *exec.Cmd
-	NewStream(URI string) (*Stream, string)
+	NewProcess(URI string, opts Options) *exec.Cmd
+	NewStream(URI string, opts Options) (*Stream, string)
+	Probe(ctx context.Context, URI string, opts Options) (SourceInfo, error)
 	Restart(stream *Stream, path string) error
+	Record(stream *Stream) error
+	Snapshot(input string, opts Options, width int) ([]byte, error)
 }
 
 // Processor is the main type for creating new processes
 type Processor struct {
-	storeDir    string
-	keepFiles   bool
-	loggingOpts config.ProcessLogging
+	storeDir      string
+	keepFiles     bool
+	loggingOpts   config.ProcessLogging
+	encryption    config.Encryption
+	hardware      config.Hardware
+	probeTimeout  time.Duration
+	recordingsDir string
+	thumbnail     config.Thumbnail
+	ffmpeg        config.FFmpeg
 }
 
 // Type check
@@ -45,68 +62,166 @@ func NewProcessor(
 	storeDir string,
 	keepFiles bool,
 	loggingOpts config.ProcessLogging,
+	encryption config.Encryption,
+	hardware config.Hardware,
+	probeTimeout time.Duration,
+	recordingsDir string,
+	thumbnail config.Thumbnail,
+	ffmpeg config.FFmpeg,
 ) *Processor {
-	return &Processor{storeDir, keepFiles, loggingOpts}
+	return &Processor{storeDir, keepFiles, loggingOpts, encryption, hardware, probeTimeout, recordingsDir, thumbnail, ffmpeg}
+}
+
+// ffmpegPath returns the path of the ffmpeg binary
+func (p Processor) ffmpegPath() string {
+	if p.ffmpeg.FFmpegPath == "" {
+		return "ffmpeg"
+	}
+	return p.ffmpeg.FFmpegPath
+}
+
+// command creates an ffmpeg process with the given arguments and the configured niceness and CPU affinity,
+// the rendered command is logged with its credentials masked
+func (p Processor) command(args []string) *exec.Cmd {
+	name, args := p.limitArgs(p.ffmpegPath(), args)
+	cmd := exec.Command(name, args...)
+	logrus.Debugf("Rendered command: %s", RedactURI(strings.Join(cmd.Args, " ")))
+	return cmd
+}
+
+// withOutputArgs inserts the output arguments of the configuration and the stream before the output path, the last one of the arguments
+func (p Processor) withOutputArgs(args []string, opts Options) []string {
+	output := args[len(args)-1]
+	args = append(args[:len(args)-1:len(args)-1], p.ffmpeg.FFmpegOutputArgs...)
+	args = append(args, opts.OutputArgs...)
+	return append(args, output)
+}
+
+// getHLSFlags are for getting the flags based on the options of the stream. The segments of the DVR streams
+// falling out of their window are always deleted, their segments carry the time they were recorded at
+func (p Processor) getHLSFlags(opts Options) string {
+	flags := []string{}
+	if opts.HLS.DeleteSegments || opts.DVRWindow > 0 {
+		flags = append(flags, "delete_segments")
+	}
+	flags = append(flags, "append_list")
+	if opts.HLS.ProgramDateTime || opts.DVRWindow > 0 {
+		flags = append(flags, "program_date_time")
+	}
+	return strings.Join(flags, "+")
 }
 
-// getHLSFlags are for getting the flags based on the config context
-func (p Processor) getHLSFlags() string {
-	if p.keepFiles {
-		return "append_list"
+// transcoder returns the transcoder of the streams selected by the configuration
+func (p Processor) transcoder() Transcoder {
+	if p.ffmpeg.Transcoder == TranscoderFake {
+		return FakeTranscoder{}
 	}
-	return "delete_segments+append_list"
+	return ffmpegTranscoder{p}
 }
 
 // NewProcess creates only the process for the stream
-func (p Processor) NewProcess(URI string) *exec.Cmd {
-	dirPath, newPath, err := createDirectoryForURI(URI, p.storeDir)
+func (p Processor) NewProcess(URI string, opts Options) *exec.Cmd {
+	dirPath, newPath, err := createDirectoryForURI(URI, opts, p.storeDir)
 	if err != nil {
 		logrus.Error("Error happened while getting directory name in creating process", dirPath)
 		return nil
 	}
+	return p.newProcess(URI, opts, dirPath, newPath)
+}
 
-	cmd := exec.Command(
-		"ffmpeg",
+// newProcess creates the ffmpeg process writing the stream into the given directory, dirPath is the id of the stream
+func (p Processor) newProcess(URI string, opts Options, dirPath, newPath string) *exec.Cmd {
+	args := []string{
 		"-y",
 		"-fflags",
 		"nobuffer",
-		"-rtsp_transport",
-		"tcp",
+	}
+	args = append(args, p.getProgressArgs()...)
+	args = append(args, getTransportArgs(URI, opts.Transport)...)
+	args = append(args, getLocalArgs(URI, opts, true)...)
+	args = append(args, getMJPEGArgs(URI, opts)...)
+	if opts.UsesHardware() {
+		// The streams that were not assigned to a device use the configured one
+		device := opts.Device
+		if device == "" {
+			device = p.hardware.Device
+		}
+		args = append(args, getHardwareInputArgs(opts.HardwareAccel, device)...)
+	}
+	args = append(args, p.getExtraInputArgs(URI, opts)...)
+	args = append(
+		args,
 		"-i",
-		URI,
+		p.input(URI, opts),
 		"-vsync",
 		"0",
 		"-copyts",
-		"-vcodec",
-		"copy",
+	)
+	args = append(args, getVideoArgs(opts)...)
+	if opts.UsesDASHMuxer() {
+		args = append(args, getDASHArgs(opts, newPath)...)
+		return p.command(p.withOutputArgs(args, opts))
+	}
+	args = append(
+		args,
 		"-movflags",
 		"frag_keyframe+empty_moov",
 		//"-an",
 		"-hls_flags",
-		p.getHLSFlags(),
+		p.getHLSFlags(opts),
 		"-f",
 		"hls",
 		"-segment_list_flags",
 		"live",
 		"-hls_time",
-		"1",
+		strconv.Itoa(opts.HLS.Time),
 		"-hls_list_size",
-		"3",
+		strconv.Itoa(opts.playlistSize()),
+	)
+	args = append(args, getSegmentTypeArgs(opts)...)
+	if p.encryption.Enabled {
+		keyInfoPath, err := createKeyInfo(p.encryption.KeysDir, dirPath)
+		if err != nil {
+			logrus.Error("Error happened while creating encryption key for ", dirPath, err)
+			return nil
+		}
+		args = append(args, "-hls_key_info_file", keyInfoPath)
+	}
+	if len(opts.Renditions) == 0 {
+		args = append(
+			args,
+			"-hls_segment_filename",
+			fmt.Sprintf("%s/%s%s", newPath, opts.segmentName(), getSegmentExtension(opts.HLS)),
+			fmt.Sprintf("%s/%s", newPath, indexPlaylist),
+		)
+		return p.command(p.withOutputArgs(args, opts))
+	}
+	for _, rendition := range opts.Renditions {
+		if err := os.MkdirAll(filepath.Join(newPath, rendition.Name()), os.ModePerm); err != nil {
+			logrus.Error("Error happened while creating directory of rendition for ", dirPath, err)
+			return nil
+		}
+	}
+	args = append(
+		args,
+		"-master_pl_name",
+		masterPlaylist,
+		"-var_stream_map",
+		getVarStreamMap(opts),
 		"-hls_segment_filename",
-		fmt.Sprintf("%s/%%d.ts", newPath),
-		fmt.Sprintf("%s/index.m3u8", newPath),
+		fmt.Sprintf("%s/%%v/%s%s", newPath, opts.segmentName(), getSegmentExtension(opts.HLS)),
+		fmt.Sprintf("%s/%%v/%s", newPath, indexPlaylist),
 	)
-	return cmd
+	return p.command(p.withOutputArgs(args, opts))
 }
 
-// NewStream creates a new transcoding process for ffmpeg
-func (p Processor) NewStream(URI string) (*Stream, string) {
-	dirPath, newPath, err := createDirectoryForURI(URI, p.storeDir)
+// NewStream creates a new stream, its transcoding process is started when the stream is run
+func (p Processor) NewStream(URI string, opts Options) (*Stream, string) {
+	dirPath, newPath, err := createDirectoryForURI(URI, opts, p.storeDir)
 	if err != nil {
 		logrus.Error("Error happened while getting directory name", dirPath)
 		return nil, ""
 	}
-	cmd := p.NewProcess(URI)
 
 	// Create nil pointer in case logging is not enabled
 	cmdLogger := (*lumberjack.Logger)(nil)
@@ -119,40 +234,103 @@ func (p Processor) NewStream(URI string) (*Stream, string) {
 			MaxAge:     p.loggingOpts.MaxAge,
 			Compress:   p.loggingOpts.Compress,
 		}
-		cmd.Stderr = cmdLogger
-		cmd.Stdout = cmdLogger
 	}
+	logs := NewLogBuffer(p.loggingOpts.BufferLines, dirPath, p.loggingOpts.Debug)
 	stream := Stream{
-		CMD:       cmd,
-		Mux:       &sync.RWMutex{},
-		Path:      fmt.Sprintf("/%s/index.m3u8", filepath.Join("stream", dirPath)),
-		StorePath: newPath,
-		Streak: hotstreak.New(hotstreak.Config{
-			Limit:      10,
-			HotWait:    time.Minute * 2,
-			ActiveWait: time.Minute * 4,
-		}).Activate(),
-		OriginalURI: URI,
-		KeepFiles:   p.keepFiles,
-		Logger:      cmdLogger,
+		Transcoder:   p.transcoder(),
+		Mux:          &sync.RWMutex{},
+		Path:         PlaylistPath(dirPath, opts),
+		StorePath:    newPath,
+		Streak:       hotstreak.New(opts.streakConfig()).Activate(),
+		OriginalURI:  URI,
+		KeepFiles:    p.keepFiles,
+		Logger:       cmdLogger,
+		StartedAt:    time.Now(),
+		Options:      opts,
+		LastActivity: time.Now(),
+		CreatedAt:    time.Now(),
+		Logs:         logs,
+	}
+	if p.ffmpeg.ProcessSampleInterval > 0 {
+		stream.Usage = NewResourceUsage()
+	}
+	stream.KillGrace = p.ffmpeg.ProcessKillGrace
+	if p.ffmpeg.ProcessStateDir != "" {
+		stream.States = NewProcessStates(p.ffmpeg.ProcessStateDir)
+	}
+	if p.encryption.Enabled {
+		stream.KeyPath = filepath.Join(p.encryption.KeysDir, dirPath)
+	}
+	if opts.SDP != "" {
+		stream.SDPPath = p.sdpPath(URI, opts)
+	}
+	if opts.Recording.Enabled {
+		stream.RecordingDir = filepath.Join(p.recordingsDir, dirPath)
+	}
+	// Audio-only streams have no frames for the poster image
+	if p.thumbnail.ThumbnailInterval > 0 && !opts.AudioOnly {
+		stream.thumbnails = func(stop <-chan struct{}) { p.refreshThumbnails(&stream, stop) }
+	}
+	if opts.MPEGTS {
+		stream.Relay = NewRelay()
+	}
+	if opts.Push != "" {
+		state := &pushState{status: PushStatus{Target: pushTarget(opts.Push)}}
+		stream.pushing = state
+		stream.push = func(stop <-chan struct{}) { p.runPush(&stream, state, stop) }
 	}
 	logrus.Debugf("Created stream with storepath %s", stream.StorePath)
-	return &stream, fmt.Sprintf("%s/index.m3u8", newPath)
+	return &stream, fmt.Sprintf("%s/%s", newPath, getPlaylistName(opts))
+}
+
+// outputWriters returns the writers directing the output of a process into the log file and the log buffer of the stream,
+// the log file is nil if logging is disabled. The log buffer is kept between restarts, so it shows why the previous process exited.
+// ffmpeg echoes the URI of its input, so the credentials are masked in both of them
+func outputWriters(logger *lumberjack.Logger, logs *LogBuffer) (stdout, stderr io.Writer) {
+	var writers []io.Writer
+	if logger != nil {
+		file := newRedactingWriter(logger)
+		stdout = file
+		writers = append(writers, file)
+	}
+	if logs != nil {
+		writers = append(writers, logs)
+	}
+	if len(writers) > 0 {
+		stderr = io.MultiWriter(writers...)
+	}
+	return stdout, stderr
+}
+
+// setOutput directs the output of the process into the log file and the log buffer of the stream
+func (p Processor) setOutput(cmd *exec.Cmd, logger *lumberjack.Logger, logs *LogBuffer) {
+	cmd.Stdout, cmd.Stderr = outputWriters(logger, logs)
 }
 
 // Restart uses the processor to restart a given stream
 func (p Processor) Restart(strm *Stream, path string) error {
 	strm.Mux.Lock()
 	defer strm.Mux.Unlock()
-	strm.CMD = p.NewProcess(strm.OriginalURI)
-	if p.loggingOpts.Enabled {
-		strm.CMD.Stderr = strm.Logger
-		strm.CMD.Stdout = strm.Logger
+	if strm.removed {
+		return ErrStreamRemoved
+	}
+	// The directory is removed by the cleanup of streams that were never started
+	if err := os.MkdirAll(strm.StorePath, os.ModePerm); err != nil {
+		return err
 	}
+	// The new process is started by Run, the exit of the previous one is not reported anymore
+	strm.Process = nil
 	strm.Streak.Activate()
+	strm.StartedAt = time.Now()
+	strm.LastActivity = strm.StartedAt
+	strm.hits = 0
+	strm.stopping = false
+	if err := p.record(strm); err != nil {
+		logrus.Errorf("%s could not be recorded || Error: %s", path, err)
+	}
 	go func() {
 		logrus.Infof("%s has been restarted", path)
-		err := strm.CMD.Run()
+		err := strm.Run()
 		if err != nil {
 			logrus.Error(err)
 		}
@@ -160,18 +338,110 @@ func (p Processor) Restart(strm *Stream, path string) error {
 	return nil
 }
 
-// ValidateURL checks if everything is present for the given URL
+// NewRecorder creates the process writing the MP4 recording of the stream into the given directory.
+// The files are fragmented, so the last one stays playable even if the process is killed
+func (p Processor) NewRecorder(URI string, opts Options, dir string) *exec.Cmd {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		logrus.Error("Error happened while creating directory of recordings for ", dir, err)
+		return nil
+	}
+	args := append([]string{"-y"}, getTransportArgs(URI, opts.Transport)...)
+	args = append(args, getLocalArgs(URI, opts, true)...)
+	args = append(args, getMJPEGArgs(URI, opts)...)
+	args = append(args, p.getExtraInputArgs(URI, opts)...)
+	args = append(
+		args,
+		"-i",
+		p.input(URI, opts),
+	)
+	if opts.AudioOnly {
+		args = append(args, getAudioOnlyArgs(opts)...)
+	} else {
+		args = append(args, "-map", "0:v", "-c:v", "copy")
+		if opts.AudioMode() == AudioDrop {
+			args = append(args, "-an")
+		} else {
+			args = append(args, "-map", "0:a?", "-c:a", "aac")
+		}
+	}
+	args = append(
+		args,
+		"-f",
+		"segment",
+		"-segment_time",
+		strconv.Itoa(opts.Recording.SegmentTime),
+		"-segment_format",
+		"mp4",
+		"-segment_format_options",
+		"movflags=frag_keyframe+empty_moov",
+		"-reset_timestamps",
+		"1",
+		"-strftime",
+		"1",
+		filepath.Join(dir, "%Y-%m-%d_%H-%M-%S.mp4"),
+	)
+	return p.command(args)
+}
+
+// Record starts the recording of the stream if it is enabled and not running already
+func (p Processor) Record(strm *Stream) error {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	return p.record(strm)
+}
+
+// record starts the recording process of the stream, the lock of the stream has to be held
+func (p Processor) record(strm *Stream) error {
+	if !strm.Options.Recording.Enabled || strm.recording() {
+		return nil
+	}
+	cmd := p.NewRecorder(strm.OriginalURI, strm.Options, strm.RecordingDir)
+	if cmd == nil {
+		return ErrRecordingNotCreated
+	}
+	p.setOutput(cmd, strm.Logger, strm.Logs)
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	strm.Recorder = cmd
+	cleanup, _ := p.limitStream(streamID(strm.Options, strm.StorePath), strm.Options, cmd.Process.Pid)
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			logrus.Debugf("Recording into %s exited || Error: %s", strm.RecordingDir, err)
+		}
+		cleanup()
+	}()
+	return nil
+}
+
+// ValidateURL checks if everything is present for the given URL, the local sources have a path instead of a host
 func ValidateURL(URL *url.URL) error {
 	if URL == nil {
 		return ErrUnparsedURL
 	}
-	if URL.Hostname() == "" {
+	if URL.Hostname() == "" && (URL.Scheme != "file" || URL.Path == "") {
 		return ErrInvalidHost
 	}
 	return nil
 }
 
-// GetURIDirectory is a function to create a directory string from an URI
+// normalizeURL creates the canonical form of the URL which identifies a stream.
+// Credentials and SRT passphrases are left out, so the identity of a source does not change with them
+func normalizeURL(URL *url.URL) string {
+	query := URL.Query()
+	query.Del(srtPassphraseKey)
+	normalized := url.URL{
+		Scheme:   strings.ToLower(URL.Scheme),
+		Host:     strings.ToLower(URL.Host),
+		Path:     URL.Path,
+		RawQuery: query.Encode(),
+	}
+	return normalized.String()
+}
+
+// GetURIDirectory is a function to create a directory string from an URI.
+// The directory is the hash of the normalized URI, therefore it is also used as the id of the stream
 func GetURIDirectory(URI string) (string, error) {
 	URL, err := url.Parse(URI)
 	if err != nil {
@@ -180,17 +450,27 @@ func GetURIDirectory(URI string) (string, error) {
 	if err = ValidateURL(URL); err != nil {
 		return "", err
 	}
-	return sanitize.BaseName(fmt.Sprintf("%s-%s-%s", URL.Hostname(), URL.Port(), sanitize.Path(URL.Path))), nil
+	hash := sha256.Sum256([]byte(normalizeURL(URL)))
+	return hex.EncodeToString(hash[:16]), nil
 }
 
-// createDirectoryForURI is to create a safe path based on the received URI
-func createDirectoryForURI(URI, storeDir string) (dirPath, newPath string, err error) {
-	dirPath, err = GetURIDirectory(URI)
-	if err != nil {
-		return
+// createDirectoryForURI is to create a safe path based on the received URI, unless the directory is given already.
+// PlaylistPath returns the path the playlist of the stream with the given directory is served on
+func PlaylistPath(dir string, opts Options) string {
+	return fmt.Sprintf("/%s/%s", filepath.Join("stream", dir), getPlaylistName(opts))
+}
+
+// The directory is created where the layout of the stream puts it
+func createDirectoryForURI(URI string, opts Options, storeDir string) (dirPath, newPath string, err error) {
+	dirPath = opts.Directory
+	if dirPath == "" {
+		dirPath, err = GetURIDirectory(URI)
+		if err != nil {
+			return
+		}
 	}
 
-	newPath = fmt.Sprintf("%s/%s", storeDir, dirPath)
+	newPath = fmt.Sprintf("%s/%s", storeDir, opts.storeDirectory(dirPath))
 	err = os.MkdirAll(newPath, os.ModePerm)
 	return
 }
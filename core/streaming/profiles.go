@@ -0,0 +1,51 @@
+package streaming
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrCopyWithProfile describes an error for copy mode requested together with a profile encoding the video
+var ErrCopyWithProfile = errors.New("Profiles with video settings cannot be used in copy mode")
+
+// ErrProfileWithRenditions describes an error for renditions requested together with a profile encoding the video
+var ErrProfileWithRenditions = errors.New("Profiles with video settings cannot be used together with renditions")
+
+// validateProfile checks if the profile of the stream can be used with the rest of the options
+func validateProfile(opts Options) error {
+	if opts.Profile == nil || !opts.Profile.Transcodes() {
+		return nil
+	}
+	if opts.Mode == ModeCopy {
+		return ErrCopyWithProfile
+	}
+	if len(opts.Renditions) > 0 {
+		return ErrProfileWithRenditions
+	}
+	return nil
+}
+
+// getPreset returns the preset of the software encoder, the one of the profile if it has any
+func getPreset(opts Options) string {
+	if opts.Profile != nil && opts.Profile.Preset != "" {
+		return opts.Profile.Preset
+	}
+	return "veryfast"
+}
+
+// getProfileArgs returns the encoding arguments of the video settings of the profile. The quality of the hardware
+// encoders cannot be set with a CRF, so only their bitrate is applied. The height and the frame rate are filters of the video
+func getProfileArgs(opts Options) []string {
+	profile := opts.Profile
+	if profile == nil {
+		return []string{}
+	}
+	args := []string{}
+	if profile.CRF != 0 && opts.HardwareAccel == AccelNone {
+		args = append(args, "-crf", strconv.Itoa(profile.CRF))
+	}
+	if profile.Bitrate != "" {
+		args = append(args, "-b:v", profile.Bitrate)
+	}
+	return args
+}
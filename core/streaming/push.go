@@ -0,0 +1,208 @@
+package streaming
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidPush describes an error for push targets that are not rtmp://, rtmps:// or srt:// URLs
+var ErrInvalidPush = errors.New("Push target has to be an rtmp, rtmps or srt URL with a host")
+
+// pushBackoff describes the delays between the reconnects of the push, maxPushDelay is the longest of them
+var pushBackoff = Backoff{Base: time.Second, Multiplier: 2}
+
+const maxPushDelay = time.Minute
+
+// PushStatus describes the state of the push of a stream to its target
+type PushStatus struct {
+	// Target is the scheme and the host of the destination, its path is left out since it usually carries the stream key
+	Target    string `json:"target"`
+	Connected bool   `json:"connected"`
+	// Attempts is the number of consecutive failed connections, LastError is the error of the last one
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// pushState is the state of the push shared between the stream and the process pushing it
+type pushState struct {
+	mux    sync.RWMutex
+	status PushStatus
+}
+
+// validatePush checks if the push target can be used, no target means the stream is not pushed
+func validatePush(target string) error {
+	if target == "" {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return ErrInvalidPush
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "rtmp", "rtmps", "srt":
+		return nil
+	default:
+		return ErrInvalidPush
+	}
+}
+
+// pushTarget returns the scheme and the host of the push target
+func pushTarget(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+}
+
+// isSRT indicates if the target is an SRT destination, those are sent as MPEG-TS instead of FLV
+func isSRT(target string) bool {
+	return strings.HasPrefix(strings.ToLower(target), "srt://")
+}
+
+// PushStatus returns the state of the push of the stream, nil if the stream is not pushed
+func (strm *Stream) PushStatus() *PushStatus {
+	strm.Mux.RLock()
+	state := strm.pushing
+	strm.Mux.RUnlock()
+	if state == nil {
+		return nil
+	}
+	state.mux.RLock()
+	defer state.mux.RUnlock()
+	status := state.status
+	return &status
+}
+
+// progressWriter marks the push as connected once ffmpeg reports the progress of its output
+type progressWriter struct {
+	state *pushState
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	if bytes.Contains(b, []byte("progress=")) {
+		w.state.mux.Lock()
+		if !w.state.status.Connected {
+			w.state.status.Connected = true
+			w.state.status.Attempts = 0
+		}
+		w.state.mux.Unlock()
+	}
+	return len(b), nil
+}
+
+// fail records the failed connection of the push and returns the number of consecutive failures
+func (s *pushState) fail(err error) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	now := time.Now()
+	s.status.Connected = false
+	s.status.Attempts++
+	s.status.LastError = "Push exited"
+	if err != nil {
+		s.status.LastError = RedactURI(err.Error())
+	}
+	s.status.LastErrorAt = &now
+	return s.status.Attempts
+}
+
+// disconnect marks the push as not connected, like when the stream is stopped
+func (s *pushState) disconnect() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.status.Connected = false
+}
+
+// pushDelay returns the time to wait before reconnecting after the given number of failures
+func pushDelay(attempts int) time.Duration {
+	delay := pushBackoff.Delay(attempts)
+	if delay > maxPushDelay || delay <= 0 {
+		return maxPushDelay
+	}
+	return delay
+}
+
+// NewPusher creates the process forwarding the source of the stream to its push target. The source is read by its own
+// process, so a failing destination never affects the HLS output. The video is copied unless the stream is transcoded,
+// or its codec cannot be carried by FLV
+func (p Processor) NewPusher(URI string, opts Options) *exec.Cmd {
+	args := getTransportArgs(URI, opts.Transport)
+	args = append(args, getLocalArgs(URI, opts, true)...)
+	args = append(args, getMJPEGArgs(URI, opts)...)
+	args = append(args, p.getExtraInputArgs(URI, opts)...)
+	args = append(args, "-i", p.input(URI, opts))
+	if opts.AudioOnly {
+		args = append(args, getAudioOnlyArgs(opts)...)
+	} else {
+		args = append(args, "-map", "0:v")
+		args = append(args, getForwardVideoArgs(opts, isSRT(opts.Push))...)
+		if opts.AudioMode() == AudioDrop {
+			args = append(args, "-an")
+		} else {
+			args = append(args, "-map", "0:a?", "-c:a", "aac")
+		}
+	}
+	format := "flv"
+	if isSRT(opts.Push) {
+		format = "mpegts"
+	}
+	args = append(args, "-progress", "pipe:1", "-nostats", "-f", format, opts.Push)
+	return p.command(args)
+}
+
+// getForwardVideoArgs returns the video arguments of the outputs forwarding the source besides the HLS one, like the push
+// and the MPEG-TS relay. The video is copied unless the stream is transcoded, or its codec cannot be carried by FLV
+func getForwardVideoArgs(opts Options, mpegts bool) []string {
+	flvIncompatible := !mpegts && opts.Source != nil && opts.Source.Video != "" && opts.Source.Video != "h264"
+	if opts.Mode == ModeTranscode || len(opts.Renditions) > 0 || flvIncompatible {
+		return []string{"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency"}
+	}
+	return []string{"-c:v", "copy"}
+}
+
+// runPush pushes the stream to its target until the channel is closed. The push is reconnected with its own backoff
+// if it fails, the attempts start again once it is connected
+func (p Processor) runPush(strm *Stream, state *pushState, stop <-chan struct{}) {
+	for {
+		strm.Mux.RLock()
+		uri, opts, id := strm.OriginalURI, strm.Options, streamID(strm.Options, strm.StorePath)
+		logger, logs := strm.Logger, strm.Logs
+		strm.Mux.RUnlock()
+		cmd := p.NewPusher(uri, opts)
+		_, cmd.Stderr = outputWriters(logger, logs)
+		cmd.Stdout = progressWriter{state}
+		err := cmd.Start()
+		if err == nil {
+			cleanup, _ := p.limitStream(id, opts, cmd.Process.Pid)
+			exited := make(chan error, 1)
+			go func() {
+				exited <- cmd.Wait()
+				cleanup()
+			}()
+			select {
+			case err = <-exited:
+			case <-stop:
+				killProcess(cmd.Process)
+				<-exited
+				state.disconnect()
+				return
+			}
+		}
+		attempts := state.fail(err)
+		delay := pushDelay(attempts)
+		logrus.Debugf("Push of %s exited, it is reconnected in %s || Error: %v", strm.Path, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return
+		}
+	}
+}
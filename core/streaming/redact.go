@@ -0,0 +1,71 @@
+package streaming
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// credentialsPattern matches the userinfo of the URIs, up to the last @ before a whitespace,
+// so passwords with special characters are matched even if they are not escaped.
+// Paths containing an @ are masked as well, it is safer to mask too much than to leak a password
+var credentialsPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.\-]*://)\S*@`)
+
+// passphrasePattern matches the passphrases of the SRT URIs, which are carried by their query
+var passphrasePattern = regexp.MustCompile(`([?&]passphrase=)[^&#\s"']*`)
+
+// RedactURI masks the credentials and the SRT passphrases of the URIs in the given text, so it can be logged or shown to the clients
+func RedactURI(text string) string {
+	text = credentialsPattern.ReplaceAllString(text, "${1}***@")
+	return passphrasePattern.ReplaceAllString(text, "${1}***")
+}
+
+// SplitCredentials splits the userinfo off the URI, returns the URI without it and the userinfo, which is empty if the URI has none
+func SplitCredentials(uri string) (bare, userinfo string) {
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return uri, ""
+	}
+	rest := uri[i+len("://"):]
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	at := strings.LastIndex(rest[:end], "@")
+	if at < 0 {
+		return uri, ""
+	}
+	return uri[:i+len("://")] + rest[at+1:], rest[:at]
+}
+
+// redactingWriter masks the credentials in the output of a process before writing it to the underlying writer.
+// Only complete lines are written, so URIs split between writes are masked as well
+type redactingWriter struct {
+	mux     *sync.Mutex
+	writer  io.Writer
+	partial []byte
+}
+
+// newRedactingWriter creates a new instance of redactingWriter
+func newRedactingWriter(writer io.Writer) *redactingWriter {
+	return &redactingWriter{&sync.Mutex{}, writer, nil}
+}
+
+// Write masks and writes the complete lines of the given output, the rest is kept until the line is finished
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.partial = append(w.partial, p...)
+	i := bytes.LastIndexAny(w.partial, "\r\n")
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := RedactURI(string(w.partial[:i+1]))
+	w.partial = append([]byte{}, w.partial[i+1:]...)
+	if _, err := io.WriteString(w.writer, lines); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,126 @@
+package streaming
+
+import (
+	"context"
+	"sync"
+)
+
+// tsPacketSize is the size of the MPEG-TS packets, the relayed chunks are cut at their boundaries
+const tsPacketSize = 188
+
+// relayBuffer is the number of chunks buffered for every client of the relay, slower clients are dropped
+const relayBuffer = 128
+
+// RelayClient receives the chunks of the MPEG-TS output of a stream until it is unsubscribed or dropped
+type RelayClient struct {
+	chunks chan []byte
+}
+
+// Chunks returns the channel of the chunks, it is closed when the client is unsubscribed or dropped for being slow
+func (c *RelayClient) Chunks() <-chan []byte {
+	return c.chunks
+}
+
+// Relay delivers the MPEG-TS output of the transcoding to every connected client. Each client has its own buffer,
+// clients with a full buffer are dropped, so the transcoding is never blocked and the memory used by a client is bounded
+type Relay struct {
+	mux     *sync.Mutex
+	clients map[*RelayClient]bool
+	pending []byte // Start of the packet the last write ended in the middle of
+}
+
+// NewRelay creates a new instance of Relay
+func NewRelay() *Relay {
+	return &Relay{&sync.Mutex{}, map[*RelayClient]bool{}, nil}
+}
+
+// Subscribe connects a new client to the relay
+func (r *Relay) Subscribe() *RelayClient {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	client := &RelayClient{make(chan []byte, relayBuffer)}
+	r.clients[client] = true
+	return client
+}
+
+// Unsubscribe disconnects the client and closes its channel
+func (r *Relay) Unsubscribe(client *RelayClient) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.drop(client)
+}
+
+// drop disconnects the client, the lock of the relay has to be held
+func (r *Relay) drop(client *RelayClient) {
+	if !r.clients[client] {
+		return
+	}
+	delete(r.clients, client)
+	close(client.chunks)
+}
+
+// Clients returns the number of connected clients
+func (r *Relay) Clients() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.clients)
+}
+
+// Disconnect drops every client, like when the stream is stopped. New clients can connect afterwards
+func (r *Relay) Disconnect() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for client := range r.clients {
+		r.drop(client)
+	}
+	r.pending = nil
+}
+
+// Write delivers the whole packets of the output to the clients that have room for them in their buffer,
+// the rest is kept until the next write. It never fails, so the output of the process is always read
+func (r *Relay) Write(b []byte) (int, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	data := append(r.pending, b...)
+	whole := len(data) - len(data)%tsPacketSize
+	r.pending = append([]byte(nil), data[whole:]...)
+	if whole == 0 {
+		return len(b), nil
+	}
+	chunk := data[:whole:whole]
+	for client := range r.clients {
+		select {
+		case client.chunks <- chunk:
+		default:
+			r.drop(client)
+		}
+	}
+	return len(b), nil
+}
+
+// relayKey is the key of the relay of the process output in the context
+type relayKey struct{}
+
+// WithRelay returns a copy of the context carrying the relay the transcoder should write the MPEG-TS output into
+func WithRelay(ctx context.Context, relay *Relay) context.Context {
+	return context.WithValue(ctx, relayKey{}, relay)
+}
+
+// OutputRelay returns the relay carried by the context, nil if the stream has no MPEG-TS output
+func OutputRelay(ctx context.Context) *Relay {
+	relay, _ := ctx.Value(relayKey{}).(*Relay)
+	return relay
+}
+
+// getRelayArgs returns the arguments of the MPEG-TS output written into the third file descriptor of the process
+func getRelayArgs(opts Options) []string {
+	if opts.AudioOnly {
+		return append(getAudioOnlyArgs(opts), "-f", "mpegts", "pipe:3")
+	}
+	args := append([]string{"-map", "0:v"}, getForwardVideoArgs(opts, true)...)
+	if opts.AudioMode() != AudioDrop {
+		args = append(args, "-map", "0:a?")
+	}
+	args = append(args, getAudioArgs(opts)...)
+	return append(args, "-f", "mpegts", "pipe:3")
+}
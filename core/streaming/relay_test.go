@@ -0,0 +1,129 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestRelay(t *testing.T) {
+	packet := func(b byte) []byte { return bytes.Repeat([]byte{b}, tsPacketSize) }
+
+	t.Run("Should deliver the whole packets to every client", func(t *testing.T) {
+		relay := NewRelay()
+		first, second := relay.Subscribe(), relay.Subscribe()
+		assert.Equal(t, 2, relay.Clients())
+		data := append(packet(1), packet(2)...)
+		n, err := relay.Write(data[:100])
+		assert.Equal(t, 100, n)
+		assert.Nil(t, err)
+		relay.Write(data[100:300])
+		relay.Write(data[300:])
+		for _, client := range []*RelayClient{first, second} {
+			assert.Equal(t, data[:tsPacketSize], <-client.Chunks())
+			assert.Equal(t, data[tsPacketSize:], <-client.Chunks())
+		}
+	})
+
+	t.Run("Should drop the clients that fell behind", func(t *testing.T) {
+		relay := NewRelay()
+		slow, fast := relay.Subscribe(), relay.Subscribe()
+		received := 0
+		for i := 0; i <= relayBuffer; i++ {
+			relay.Write(packet(byte(i)))
+			<-fast.Chunks()
+			received++
+		}
+		assert.Equal(t, relayBuffer+1, received)
+		assert.Equal(t, 1, relay.Clients())
+		chunks := 0
+		for range slow.Chunks() {
+			chunks++
+		}
+		assert.Equal(t, relayBuffer, chunks)
+	})
+
+	t.Run("Should disconnect the clients", func(t *testing.T) {
+		relay := NewRelay()
+		client := relay.Subscribe()
+		relay.Unsubscribe(client)
+		relay.Unsubscribe(client)
+		_, ok := <-client.Chunks()
+		assert.False(t, ok)
+		client = relay.Subscribe()
+		relay.Disconnect()
+		_, ok = <-client.Chunks()
+		assert.False(t, ok)
+		assert.Equal(t, 0, relay.Clients())
+	})
+}
+
+func TestRelayOutput(t *testing.T) {
+	binDir, err := ioutil.TempDir("", "ffmpeg")
+	assert.Nil(t, err)
+	defer os.RemoveAll(binDir)
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	assert.Nil(t, os.Setenv("PATH", binDir+string(os.PathListSeparator)+path))
+	argsFile := filepath.Join(binDir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\nhead -c 376 /dev/zero >&3\nexec sleep 20\n"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(binDir, "ffmpeg"), []byte(script), 0755))
+	storeDir := "./test"
+	defer os.RemoveAll(storeDir)
+	processor := NewProcessor(storeDir, false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, config.FFmpeg{})
+
+	t.Run("Should not relay the streams without the MPEG-TS output", func(t *testing.T) {
+		strm, _ := processor.NewStream("rtsp://192.168.0.1/norelay", Options{HLS: HLSOptions{Time: 1, ListSize: 3}})
+		assert.Nil(t, strm.Relay)
+	})
+
+	t.Run("Should relay the MPEG-TS output of the process until the stream is stopped", func(t *testing.T) {
+		strm, _ := processor.NewStream("rtsp://192.168.0.1/relay", Options{HLS: HLSOptions{Time: 1, ListSize: 3}, MPEGTS: true})
+		if !assert.NotNil(t, strm.Relay) {
+			return
+		}
+		client := strm.Relay.Subscribe()
+		ran := make(chan error, 1)
+		go func() { ran <- strm.Run() }()
+		select {
+		case chunk := <-client.Chunks():
+			assert.Len(t, chunk, 2*tsPacketSize)
+		case <-time.After(5 * time.Second):
+			t.Error("MPEG-TS output is not relayed")
+		}
+		args, err := ioutil.ReadFile(argsFile)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasSuffix(strings.TrimSpace(string(args)), "-map 0:v -c:v copy -map 0:a? -c:a aac -f mpegts pipe:3"))
+		assert.Nil(t, strm.Stop(context.Background(), false))
+		<-ran
+		_, ok := <-client.Chunks()
+		assert.False(t, ok)
+	})
+}
+
+func TestGetRelayArgs(t *testing.T) {
+	tt := []struct {
+		Options  Options
+		Expected []string
+	}{
+		{Options: Options{}, Expected: []string{"-map", "0:v", "-c:v", "copy", "-map", "0:a?", "-c:a", "aac", "-f", "mpegts", "pipe:3"}},
+		{Options: Options{Mode: ModeTranscode, Audio: AudioDrop}, Expected: []string{"-map", "0:v", "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-an", "-f", "mpegts", "pipe:3"}},
+		{Options: Options{Source: &SourceInfo{Video: "hevc"}}, Expected: []string{"-map", "0:v", "-c:v", "copy", "-map", "0:a?", "-c:a", "aac", "-f", "mpegts", "pipe:3"}},
+		{Options: Options{AudioOnly: true, Audio: AudioAAC, AudioBitrate: "64k"}, Expected: []string{"-map", "0:a", "-vn", "-c:a", "aac", "-b:a", "64k", "-f", "mpegts", "pipe:3"}},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Expected, getRelayArgs(testCase.Options)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestGetRelayArgs", i))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxRenditions is the largest number of renditions a stream can be transcoded into
+const MaxRenditions = 5
+
+// MaxRenditionHeight is the largest height in pixels a rendition can have
+const MaxRenditionHeight = 4320
+
+// masterPlaylist is the name of the playlist listing the variants of a stream
+const masterPlaylist = "master.m3u8"
+
+// indexPlaylist is the name of the playlist of a single variant
+const indexPlaylist = "index.m3u8"
+
+// ErrInvalidRendition describes an error for renditions with unusable height or bitrate
+var ErrInvalidRendition = errors.New("Renditions need a height between 1 and 4320 and a bitrate like 600k or 2M")
+
+// ErrTooManyRenditions describes an error for rendition ladders that are too long
+var ErrTooManyRenditions = errors.New("At most 5 renditions can be requested")
+
+// ErrDuplicateRendition describes an error for rendition ladders with the same height multiple times
+var ErrDuplicateRendition = errors.New("Renditions need different heights")
+
+// bitrateFormat describes the accepted bitrates, like 600k or 2M
+var bitrateFormat = regexp.MustCompile(`^[1-9][0-9]*[kKmM]?$`)
+
+// Rendition describes a single variant of an adaptive bitrate stream
+type Rendition struct {
+	Height  int    `json:"height"`
+	Bitrate string `json:"bitrate"`
+}
+
+// Name returns the name of the directory of the rendition
+func (r Rendition) Name() string {
+	return fmt.Sprintf("%dp", r.Height)
+}
+
+// ParseRenditions creates the rendition ladder from entries like "720:2M"
+func ParseRenditions(entries []string) []Rendition {
+	renditions := []Rendition{}
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 2 {
+			renditions = append(renditions, Rendition{})
+			continue
+		}
+		height, err := strconv.Atoi(parts[0])
+		if err != nil {
+			renditions = append(renditions, Rendition{})
+			continue
+		}
+		renditions = append(renditions, Rendition{Height: height, Bitrate: parts[1]})
+	}
+	return renditions
+}
+
+// validateRenditions checks if the rendition ladder can be transcoded
+func validateRenditions(renditions []Rendition) error {
+	if len(renditions) > MaxRenditions {
+		return ErrTooManyRenditions
+	}
+	heights := map[int]bool{}
+	for _, rendition := range renditions {
+		if rendition.Height < 1 || rendition.Height > MaxRenditionHeight || !bitrateFormat.MatchString(rendition.Bitrate) {
+			return ErrInvalidRendition
+		}
+		if heights[rendition.Height] {
+			return ErrDuplicateRendition
+		}
+		heights[rendition.Height] = true
+	}
+	return nil
+}
+
+// getPlaylistName returns the name of the playlist the clients should start playing with
+func getPlaylistName(opts Options) string {
+	if opts.OutputFormat() == FormatDASH {
+		return dashManifest
+	}
+	if len(opts.Renditions) > 0 || opts.UsesDASHMuxer() {
+		return masterPlaylist
+	}
+	return indexPlaylist
+}
+
+// getRenditionArgs creates the encoding arguments producing every rendition of the ladder
+func getRenditionArgs(opts Options) []string {
+	splits := make([]string, len(opts.Renditions))
+	scales := make([]string, len(opts.Renditions))
+	for i, rendition := range opts.Renditions {
+		splits[i] = fmt.Sprintf("[v%d]", i)
+		scales[i] = fmt.Sprintf("[v%d]%s[v%dout]", i, getScaleFilter(opts.HardwareAccel, rendition.Height), i)
+	}
+	input := "[0:v]"
+	if fps := getFrameRateFilter(opts); fps != "" {
+		input += fps + ","
+	}
+	filter := fmt.Sprintf("%ssplit=%d%s;%s", input, len(opts.Renditions), strings.Join(splits, ""), strings.Join(scales, ";"))
+	args := []string{"-filter_complex", filter}
+	for i, rendition := range opts.Renditions {
+		args = append(
+			args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), getVideoEncoder(opts.HardwareAccel),
+			fmt.Sprintf("-b:v:%d", i), rendition.Bitrate,
+		)
+	}
+	if opts.HardwareAccel == AccelNone {
+		args = append(args, "-preset", "veryfast")
+	}
+	return append(args, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", opts.HLS.Time))
+}
+
+// getVarStreamMap describes which output stream belongs to which variant playlist
+func getVarStreamMap(opts Options) string {
+	variants := make([]string, len(opts.Renditions))
+	for i, rendition := range opts.Renditions {
+		variants[i] = fmt.Sprintf("v:%d,name:%s", i, rendition.Name())
+	}
+	return strings.Join(variants, " ")
+}
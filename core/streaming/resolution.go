@@ -0,0 +1,88 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxResolutionWidth is the widest output resolution in pixels that can be requested
+const MaxResolutionWidth = 7680
+
+// ErrInvalidResolution describes an error for output resolutions that are not like 1280x720 or a height like 720
+var ErrInvalidResolution = errors.New("Resolution has to be like 1280x720 or a height like 720")
+
+// ErrCopyWithResolution describes an error for copy mode requested together with an output resolution
+var ErrCopyWithResolution = errors.New("Resolution cannot be changed in copy mode, the video has to be transcoded")
+
+// ErrResolutionWithRenditions describes an error for output resolutions requested together with renditions
+var ErrResolutionWithRenditions = errors.New("Resolution cannot be requested together with renditions, they have their own heights")
+
+// Resolution describes the largest size the video of a stream is scaled down to, its width is only bounded by the height if it is 0
+type Resolution struct {
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height"`
+}
+
+// ParseResolution reads the resolution from a size like 1280x720 or a height like 720
+func ParseResolution(text string) (Resolution, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(text)), "x")
+	if len(parts) > 2 {
+		return Resolution{}, ErrInvalidResolution
+	}
+	height, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return Resolution{}, ErrInvalidResolution
+	}
+	resolution := Resolution{Height: height}
+	if len(parts) == 2 {
+		if resolution.Width, err = strconv.Atoi(parts[0]); err != nil || resolution.Width < 1 {
+			return Resolution{}, ErrInvalidResolution
+		}
+	}
+	return resolution, resolution.validate()
+}
+
+// validate checks if the resolution is in the accepted ranges
+func (r Resolution) validate() error {
+	if r.Height < 1 || r.Height > MaxRenditionHeight || r.Width < 0 || r.Width > MaxResolutionWidth {
+		return ErrInvalidResolution
+	}
+	return nil
+}
+
+// String returns the resolution like 1280x720, or only the height if the width is not bounded
+func (r Resolution) String() string {
+	if r.Width == 0 {
+		return strconv.Itoa(r.Height)
+	}
+	return fmt.Sprintf("%dx%d", r.Width, r.Height)
+}
+
+// validateResolution checks if the output resolution of the stream can be used with the rest of the options
+func validateResolution(opts Options) error {
+	if opts.Resolution == nil {
+		return nil
+	}
+	if err := opts.Resolution.validate(); err != nil {
+		return err
+	}
+	if opts.Mode == ModeCopy {
+		return ErrCopyWithResolution
+	}
+	if len(opts.Renditions) > 0 {
+		return ErrResolutionWithRenditions
+	}
+	return nil
+}
+
+// getResolutionFilter returns the filter scaling the video into the output resolution of the stream. The aspect ratio
+// is kept and the video is never scaled up, the dimensions are rounded down to even numbers for the encoders
+func getResolutionFilter(opts Options) string {
+	factor := fmt.Sprintf("min(1,%d/ih)", opts.Resolution.Height)
+	if opts.Resolution.Width > 0 {
+		factor = fmt.Sprintf("min(1,min(%d/iw,%d/ih))", opts.Resolution.Width, opts.Resolution.Height)
+	}
+	return fmt.Sprintf("%s=w='trunc(iw*%s/2)*2':h='trunc(ih*%s/2)*2'", getScaleFilterName(opts.HardwareAccel), factor, factor)
+}
@@ -0,0 +1,156 @@
+package streaming
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUsageUnavailable describes an error for processes whose resource usage cannot be read, like the ones that exited already
+var ErrUsageUnavailable = errors.New("Resource usage of the process is not available")
+
+// maxProgressLine is the longest line of the progress output that is kept, longer ones are dropped
+const maxProgressLine = 4096
+
+// Resources describes the resource usage of the running transcoding process of a stream. The CPU and the memory
+// are sampled from the operating system, the rate of the encoding is reported by ffmpeg
+type Resources struct {
+	CPUPercent  float64 `json:"cpuPercent"`  // CPU time used between the last two samples, 100 is a whole CPU
+	RSSBytes    uint64  `json:"rssBytes"`    // Resident memory of the process
+	EncodeFPS   float64 `json:"encodeFps"`   // Number of frames encoded per second
+	EncodeSpeed float64 `json:"encodeSpeed"` // Speed of the encoding compared to the playback, 1 is real time
+}
+
+// ResourceUsage tracks the resource usage of the processes of a stream, the usage of a new process starts from zero
+type ResourceUsage struct {
+	mux       *sync.Mutex
+	current   Resources
+	pid       int
+	cpuTime   time.Duration
+	sampledAt time.Time
+}
+
+// NewResourceUsage creates a new instance of ResourceUsage
+func NewResourceUsage() *ResourceUsage {
+	return &ResourceUsage{mux: &sync.Mutex{}}
+}
+
+// Get returns the last known usage
+func (u *ResourceUsage) Get() Resources {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	return u.current
+}
+
+// Reset forgets the usage of the previous process
+func (u *ResourceUsage) Reset() {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	u.current, u.pid, u.cpuTime, u.sampledAt = Resources{}, 0, 0, time.Time{}
+}
+
+// Sample reads the CPU time and the memory of the process. The CPU usage is measured between two samples
+// of the same process, so it is 0 after the first sample of a process
+func (u *ResourceUsage) Sample(pid int, now time.Time) error {
+	cpuTime, rss, err := processUsage(pid)
+	if err != nil {
+		return err
+	}
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	u.current.CPUPercent = 0
+	if u.pid == pid && now.After(u.sampledAt) && cpuTime >= u.cpuTime {
+		u.current.CPUPercent = float64(cpuTime-u.cpuTime) / float64(now.Sub(u.sampledAt)) * 100
+	}
+	u.current.RSSBytes = rss
+	u.pid, u.cpuTime, u.sampledAt = pid, cpuTime, now
+	return nil
+}
+
+// Progress returns the writer parsing the -progress output of an ffmpeg process into the rate of its encoding
+func (u *ResourceUsage) Progress() io.Writer {
+	return &progressParser{usage: u}
+}
+
+// progress reads a key=value line of the progress output
+func (u *ResourceUsage) progress(line string) {
+	parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+	if len(parts) != 2 {
+		return
+	}
+	// The values are N/A until the first frames are encoded
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(parts[1]), "x"), 64)
+	if err != nil {
+		return
+	}
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	switch parts[0] {
+	case "fps":
+		u.current.EncodeFPS = value
+	case "speed":
+		u.current.EncodeSpeed = value
+	}
+}
+
+// progressParser splits the progress output of a process into lines
+type progressParser struct {
+	usage   *ResourceUsage
+	partial []byte
+}
+
+// Write parses the complete lines of the output, the rest is kept until its line is complete
+func (p *progressParser) Write(b []byte) (int, error) {
+	p.partial = append(p.partial, b...)
+	for {
+		end := bytes.IndexByte(p.partial, '\n')
+		if end < 0 {
+			break
+		}
+		p.usage.progress(string(p.partial[:end]))
+		p.partial = p.partial[end+1:]
+	}
+	if len(p.partial) > maxProgressLine {
+		p.partial = nil
+	}
+	return len(b), nil
+}
+
+// pidProcess is a Process running as an operating system process
+type pidProcess interface {
+	Pid() int
+}
+
+// pidOf returns the id of the operating system process of the process, 0 if it is not one
+func pidOf(process Process) int {
+	if p, ok := process.(pidProcess); ok {
+		return p.Pid()
+	}
+	return 0
+}
+
+// commandLineProcess is a Process running an operating system command that reports its command line
+type commandLineProcess interface {
+	Command() []string
+}
+
+// commandOf returns the command line the process was started with, nil if it is not a command
+func commandOf(process Process) []string {
+	if p, ok := process.(commandLineProcess); ok {
+		return p.Command()
+	}
+	return nil
+}
+
+// getProgressArgs returns the arguments making ffmpeg report the progress of the encoding on its standard output,
+// none if the usage of the processes is not sampled
+func (p Processor) getProgressArgs() []string {
+	if p.ffmpeg.ProcessSampleInterval <= 0 {
+		return nil
+	}
+	return []string{"-progress", "pipe:1"}
+}
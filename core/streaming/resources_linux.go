@@ -0,0 +1,54 @@
+package streaming
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the unit of the CPU times in /proc, USER_HZ is 100 on every architecture Linux supports
+const clockTicks = 100
+
+// readStat returns the fields of /proc/pid/stat after the name of the command, starting with the state, the third field of the file
+func readStat(pid int) ([]string, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// The name of the command is in parentheses and can contain spaces, so the fields are counted after it
+	end := bytes.LastIndexByte(b, ')')
+	if end < 0 {
+		return nil, ErrUsageUnavailable
+	}
+	fields := strings.Fields(string(b[end+1:]))
+	if len(fields) < 22 {
+		return nil, ErrUsageUnavailable
+	}
+	return fields, nil
+}
+
+// processUsage returns the CPU time used by the process and its resident memory, read from /proc
+func processUsage(pid int) (time.Duration, uint64, error) {
+	// utime is the 14th field, stime the 15th and rss the 24th
+	fields, err := readStat(pid)
+	if err != nil {
+		return 0, 0, ErrUsageUnavailable
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, ErrUsageUnavailable
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, ErrUsageUnavailable
+	}
+	pages, err := strconv.ParseUint(fields[21], 10, 64)
+	if err != nil {
+		return 0, 0, ErrUsageUnavailable
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, pages * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,56 @@
+//go:build !linux
+// +build !linux
+
+package streaming
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processUsage returns the CPU time used by the process and its resident memory, read with ps where /proc is not available
+func processUsage(pid int) (time.Duration, uint64, error) {
+	out, err := exec.Command("ps", "-o", "time=,rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, 0, ErrUsageUnavailable
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, ErrUsageUnavailable
+	}
+	cpuTime, err := parseCPUTime(fields[0])
+	if err != nil {
+		return 0, 0, ErrUsageUnavailable
+	}
+	kilobytes, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, ErrUsageUnavailable
+	}
+	return cpuTime, kilobytes * 1024, nil
+}
+
+// parseCPUTime reads the CPU time printed by ps, like 1-02:03:04 or 3:04.56
+func parseCPUTime(value string) (time.Duration, error) {
+	days := 0.0
+	if parts := strings.SplitN(value, "-", 2); len(parts) == 2 {
+		parsed, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return 0, err
+		}
+		days, value = parsed, parts[1]
+	}
+	seconds := days * 24 * 60 * 60
+	multiplier := 1.0
+	parts := strings.Split(value, ":")
+	for i := len(parts) - 1; i >= 0; i-- {
+		parsed, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds += parsed * multiplier
+		multiplier *= 60
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
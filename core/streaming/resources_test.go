@@ -0,0 +1,97 @@
+package streaming
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestProgress(t *testing.T) {
+	tt := []struct {
+		Writes   []string
+		Expected Resources
+	}{
+		{Writes: []string{"frame=250\nfps=25.00\nspeed=1.01x\nprogress=continue\n"}, Expected: Resources{EncodeFPS: 25, EncodeSpeed: 1.01}},
+		{Writes: []string{"fps=2", "4.5\nspe", "ed=0.98x\n"}, Expected: Resources{EncodeFPS: 24.5, EncodeSpeed: 0.98}},
+		{Writes: []string{"fps=0.00\nspeed=N/A\n"}, Expected: Resources{}},
+		{Writes: []string{"fps=25.00\nspeed=1x"}, Expected: Resources{EncodeFPS: 25}},
+		{Writes: []string{"fps=25.00\r\nspeed= 1.5x\r\n"}, Expected: Resources{EncodeFPS: 25, EncodeSpeed: 1.5}},
+		{Writes: []string{strings.Repeat("a", maxProgressLine+1), "fps=30\n"}, Expected: Resources{EncodeFPS: 30}},
+	}
+	for i, test := range tt {
+		usage := NewResourceUsage()
+		progress := usage.Progress()
+		for _, write := range test.Writes {
+			n, err := progress.Write([]byte(write))
+			assert.Nil(t, err)
+			assert.Equal(t, len(write), n)
+		}
+		if !assert.Equal(t, test.Expected, usage.Get()) {
+			t.Error(fmt.Errorf("%d testcase is failing for progress", i))
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	t.Run("Should sample the CPU and the memory of the process", func(t *testing.T) {
+		usage := NewResourceUsage()
+		start := time.Now()
+		assert.Nil(t, usage.Sample(os.Getpid(), start))
+		first := usage.Get()
+		assert.True(t, first.RSSBytes > 0)
+		assert.Equal(t, float64(0), first.CPUPercent)
+
+		// The CPU is measured between the samples of the same process
+		assert.Nil(t, usage.Sample(os.Getpid(), start.Add(time.Second)))
+		assert.True(t, usage.Get().CPUPercent >= 0)
+
+		usage.Reset()
+		assert.Equal(t, Resources{}, usage.Get())
+	})
+
+	t.Run("Should fail for the processes that exited", func(t *testing.T) {
+		cmd := exec.Command("true")
+		assert.Nil(t, cmd.Run())
+		usage := NewResourceUsage()
+		assert.Equal(t, ErrUsageUnavailable, usage.Sample(cmd.Process.Pid, time.Now()))
+		assert.Equal(t, Resources{}, usage.Get())
+	})
+}
+
+func TestPid(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	process, err := StartCommand(cmd)
+	if !assert.Nil(t, err) {
+		return
+	}
+	strm := Stream{Mux: new(sync.RWMutex), Process: &limitedCommand{process, Limits{}}}
+	assert.Equal(t, cmd.Process.Pid, strm.Pid())
+	assert.Nil(t, process.Kill())
+	process.Wait()
+	assert.Equal(t, 0, strm.Pid())
+	assert.Equal(t, 0, pidOf(&fakeProcess{}))
+}
+
+func TestProgressArgs(t *testing.T) {
+	storeDir := "./test"
+	defer os.RemoveAll(storeDir)
+	for _, sampled := range []bool{false, true} {
+		ffmpeg := config.FFmpeg{}
+		if sampled {
+			ffmpeg.ProcessSampleInterval = time.Second
+		}
+		processor := NewProcessor(storeDir, false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, ffmpeg)
+		cmd := processor.NewProcess("rtsp://192.168.0.1/Streaming/Channels/101", Options{HLS: HLSOptions{Time: 4, ListSize: 10}})
+		assert.Equal(t, sampled, strings.Contains(strings.Join(cmd.Args, " "), "-y -fflags nobuffer -progress pipe:1 "))
+		strm, _ := processor.NewStream("rtsp://192.168.0.1/Streaming/Channels/101", Options{HLS: HLSOptions{Time: 4, ListSize: 10}})
+		assert.Equal(t, sampled, strm.Usage != nil)
+	}
+}
@@ -0,0 +1,50 @@
+package streaming
+
+import "time"
+
+// RetryPolicy returns the retry policy of the stream, nil if the one of the configuration applies
+func (strm *Stream) RetryPolicy() *Backoff {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Options.Retry
+}
+
+// SetRetryPolicy replaces the retry policy of the stream. The scheduled restart is timed again with it
+func (strm *Stream) SetRetryPolicy(policy Backoff) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Options.Retry = &policy
+	if strm.retryChanged != nil {
+		close(strm.retryChanged)
+		strm.retryChanged = nil
+	}
+}
+
+// ScheduleRetry records the time the next restart of the crashed process is made at.
+// The returned channel is closed if the retry policy is replaced meanwhile
+func (strm *Stream) ScheduleRetry(at time.Time) <-chan struct{} {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.retryAt = at
+	if strm.retryChanged == nil {
+		strm.retryChanged = make(chan struct{})
+	}
+	return strm.retryChanged
+}
+
+// NextRetry returns the number of the scheduled restart of the crashed process and its time, false if none is scheduled
+func (strm *Stream) NextRetry() (int, time.Time, bool) {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	if strm.retryAt.IsZero() {
+		return 0, time.Time{}, false
+	}
+	return strm.attempts, strm.retryAt, true
+}
+
+// CancelRetry forgets the scheduled restart of the crashed process
+func (strm *Stream) CancelRetry() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.retryAt = time.Time{}
+}
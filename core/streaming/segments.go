@@ -0,0 +1,46 @@
+package streaming
+
+import "errors"
+
+// SegmentTS writes the HLS segments as MPEG-TS
+const SegmentTS = "ts"
+
+// SegmentFMP4 writes the HLS segments as fragmented MP4 with a shared init section
+const SegmentFMP4 = "fmp4"
+
+// fmp4InitFile is the name of the init section of the fragmented MP4 segments
+const fmp4InitFile = "init.mp4"
+
+// ErrInvalidSegmentType describes an error for unknown segment containers
+var ErrInvalidSegmentType = errors.New("Segment type has to be ts or fmp4")
+
+// validateSegmentType checks if the segment container of the options is known
+func validateSegmentType(opts HLSOptions) error {
+	switch opts.SegmentType {
+	case "", SegmentTS, SegmentFMP4:
+		return nil
+	default:
+		return ErrInvalidSegmentType
+	}
+}
+
+// getSegmentExtension returns the extension of the segments written by the HLS muxer
+func getSegmentExtension(opts HLSOptions) string {
+	if opts.SegmentType == SegmentFMP4 {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// getSegmentTypeArgs returns the arguments of the segment container. Every rendition
+// gets its own init section, so their names contain the name of the rendition
+func getSegmentTypeArgs(opts Options) []string {
+	if opts.HLS.SegmentType != SegmentFMP4 {
+		return nil
+	}
+	init := fmp4InitFile
+	if len(opts.Renditions) > 0 {
+		init = "init_%v.mp4"
+	}
+	return []string{"-hls_segment_type", "fmp4", "-hls_fmp4_init_filename", init}
+}
@@ -0,0 +1,73 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrSnapshotTimeout is sent when the frame of the snapshot could not be decoded in time
+var ErrSnapshotTimeout = errors.New("Taking the snapshot timed out")
+
+// ErrSnapshotFn is used to create dynamic errors for snapshots that could not be taken, the credentials in the output are masked
+var ErrSnapshotFn = func(output string) error {
+	return fmt.Errorf("Snapshot could not be taken: %s", RedactURI(output))
+}
+
+// Snapshot decodes the first frame of the input, a segment or the source itself opened with the input arguments of the options,
+// into a JPEG image scaled to the given width, the original width is kept if it is 0. The process is killed if it
+// does not finish within the probe timeout
+func (p Processor) Snapshot(input string, opts Options, width int) ([]byte, error) {
+	return p.decodeFrame(input, opts, width, 0, false)
+}
+
+// decodeFrame decodes the first frame of the input into a JPEG image scaled to the given size. A missing
+// dimension keeps the aspect ratio, the original size is kept if both of them are missing. Low priority
+// processes are started with nice, so they do not take the CPU from the transcoding
+func (p Processor) decodeFrame(input string, opts Options, width, height int, lowPriority bool) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.probeTimeout)
+	defer cancel()
+	args := append([]string{"-v", "error"}, getTransportArgs(input, opts.Transport)...)
+	args = append(args, getLocalArgs(input, opts, false)...)
+	args = append(args, getMJPEGArgs(input, opts)...)
+	args = append(args, p.getExtraInputArgs(input, opts)...)
+	args = append(args, "-i", p.input(input, opts), "-frames:v", "1")
+	if width > 0 || height > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", scaledDimension(width), scaledDimension(height)))
+	}
+	args = append(args, "-f", "image2pipe", "-c:v", "mjpeg", "pipe:1")
+	name := p.ffmpegPath()
+	if nice, err := exec.LookPath("nice"); lowPriority && err == nil {
+		args = append([]string{"-n", "19", name}, args...)
+		name = nice
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, ErrSnapshotTimeout
+	}
+	if err != nil {
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			return nil, ErrSnapshotFn(output)
+		}
+		return nil, ErrSnapshotFn(err.Error())
+	}
+	if len(out) == 0 {
+		return nil, ErrSnapshotFn("no frame was decoded")
+	}
+	return out, nil
+}
+
+// scaledDimension returns the value of a dimension for the scale filter. Missing ones keep the
+// aspect ratio, rounded to an even number as the encoder requires
+func scaledDimension(value int) int {
+	if value <= 0 {
+		return -2
+	}
+	return value
+}
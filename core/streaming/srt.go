@@ -0,0 +1,113 @@
+package streaming
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// srtPassphraseKey is the query parameter of the SRT URIs carrying the passphrase of the encryption
+const srtPassphraseKey = "passphrase"
+
+// ErrInvalidSRT describes an error for SRT parameters ffmpeg would refuse
+var ErrInvalidSRT = errors.New("SRT passphrase has to be 10 to 79 characters long, latency a non-negative number")
+
+// IsSRT indicates if the source is received over SRT
+func IsSRT(input string) bool {
+	return strings.HasPrefix(input, "srt://")
+}
+
+// IsSRTListener indicates if the SRT source waits for the encoder to connect instead of calling it.
+// A listener usually accepts a single connection, so it is not probed before the transcoding connects
+func IsSRTListener(input string) bool {
+	return IsSRT(input) && queryParam(input, "mode") == "listener"
+}
+
+// ValidateSRT checks the passphrase and the latency carried by the query of the SRT URI
+func ValidateSRT(uri string) error {
+	if !IsSRT(uri) {
+		return nil
+	}
+	if passphrase := queryParam(uri, srtPassphraseKey); passphrase != "" && (len(passphrase) < 10 || len(passphrase) > 79) {
+		return ErrInvalidSRT
+	}
+	if latency := queryParam(uri, "latency"); latency != "" {
+		if value, err := strconv.Atoi(latency); err != nil || value < 0 {
+			return ErrInvalidSRT
+		}
+	}
+	return nil
+}
+
+// SplitPassphrase splits the passphrase off the query of the URI, returns the URI without it and the escaped passphrase,
+// which is empty if the URI has none
+func SplitPassphrase(uri string) (bare, passphrase string) {
+	if !IsSRT(uri) {
+		return uri, ""
+	}
+	base, params := splitQuery(uri)
+	kept := []string{}
+	for _, param := range params {
+		if value := strings.TrimPrefix(param, srtPassphraseKey+"="); value != param {
+			passphrase = value
+			continue
+		}
+		kept = append(kept, param)
+	}
+	return joinQuery(base, kept), passphrase
+}
+
+// SetQueryParam replaces the parameter of the query of the URI with the escaped value, the other parameters are kept as they are
+func SetQueryParam(uri, key, value string) string {
+	base, params := splitQuery(uri)
+	kept := []string{}
+	for _, param := range params {
+		if param != key && !strings.HasPrefix(param, key+"=") {
+			kept = append(kept, param)
+		}
+	}
+	return joinQuery(base, append(kept, key+"="+value))
+}
+
+// queryParam returns the unescaped value of the parameter of the query of the URI, empty if it has none
+func queryParam(uri, key string) string {
+	_, params := splitQuery(uri)
+	for _, param := range params {
+		if value := strings.TrimPrefix(param, key+"="); value != param {
+			unescaped, err := url.QueryUnescape(value)
+			if err != nil {
+				return value
+			}
+			return unescaped
+		}
+	}
+	return ""
+}
+
+// splitQuery splits the URI into the part before its query and the parameters of the query. The fragment is dropped,
+// the sources do not have one
+func splitQuery(uri string) (string, []string) {
+	if i := strings.Index(uri, "#"); i >= 0 {
+		uri = uri[:i]
+	}
+	i := strings.Index(uri, "?")
+	if i < 0 {
+		return uri, nil
+	}
+	params := []string{}
+	for _, param := range strings.Split(uri[i+1:], "&") {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+	return uri[:i], params
+}
+
+// joinQuery puts the parameters back onto the URI
+func joinQuery(base string, params []string) string {
+	if len(params) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(params, "&")
+}
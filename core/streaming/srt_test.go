@@ -0,0 +1,72 @@
+package streaming
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSRTListener(t *testing.T) {
+	tt := []struct {
+		URI      string
+		Expected bool
+	}{
+		{URI: "srt://0.0.0.0:9000?mode=listener", Expected: true},
+		{URI: "srt://encoder.local:9000?latency=200000&mode=listener", Expected: true},
+		{URI: "srt://encoder.local:9000?mode=caller", Expected: false},
+		{URI: "srt://encoder.local:9000", Expected: false},
+		{URI: "rtsp://encoder.local/live?mode=listener", Expected: false},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Expected, IsSRTListener(testCase.URI)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestIsSRTListener", i))
+		}
+	}
+}
+
+func TestValidateSRT(t *testing.T) {
+	tt := []struct {
+		URI string
+		Err error
+	}{
+		{URI: "srt://encoder.local:9000", Err: nil},
+		{URI: "srt://encoder.local:9000?passphrase=0123456789&latency=200000", Err: nil},
+		{URI: "srt://encoder.local:9000?passphrase=p%40ss%26w0rd!", Err: nil},
+		{URI: "srt://encoder.local:9000?passphrase=short", Err: ErrInvalidSRT},
+		{URI: "srt://encoder.local:9000?latency=-1", Err: ErrInvalidSRT},
+		{URI: "srt://encoder.local:9000?latency=fast", Err: ErrInvalidSRT},
+		{URI: "rtsp://camera.local/live?passphrase=short", Err: nil},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Err, ValidateSRT(testCase.URI)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestValidateSRT", i))
+		}
+	}
+}
+
+func TestSplitPassphrase(t *testing.T) {
+	tt := []struct {
+		URI        string
+		Bare       string
+		Passphrase string
+	}{
+		{URI: "srt://encoder.local:9000", Bare: "srt://encoder.local:9000", Passphrase: ""},
+		{URI: "srt://encoder.local:9000?passphrase=p%40ss%26w0rd", Bare: "srt://encoder.local:9000", Passphrase: "p%40ss%26w0rd"},
+		{URI: "srt://encoder.local:9000?mode=caller&passphrase=0123456789&latency=1", Bare: "srt://encoder.local:9000?mode=caller&latency=1", Passphrase: "0123456789"},
+		{URI: "rtsp://camera.local/live?passphrase=0123456789", Bare: "rtsp://camera.local/live?passphrase=0123456789", Passphrase: ""},
+	}
+	for i, testCase := range tt {
+		bare, passphrase := SplitPassphrase(testCase.URI)
+		if !assert.Equal(t, testCase.Bare, bare) || !assert.Equal(t, testCase.Passphrase, passphrase) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestSplitPassphrase", i))
+		}
+	}
+}
+
+func TestSetQueryParam(t *testing.T) {
+	t.Run("Should replace the parameter and keep the others as they are", func(t *testing.T) {
+		assert.Equal(t, "srt://encoder.local:9000?streamid=a%2Fb&latency=200000", SetQueryParam("srt://encoder.local:9000?latency=1&streamid=a%2Fb", "latency", "200000"))
+		assert.Equal(t, "srt://encoder.local:9000?passphrase=0123456789", SetQueryParam("srt://encoder.local:9000", "passphrase", "0123456789"))
+	})
+}
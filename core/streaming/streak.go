@@ -0,0 +1,104 @@
+package streaming
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Roverr/hotstreak"
+)
+
+// ErrInvalidStreak describes an error for streak settings out of the accepted ranges
+var ErrInvalidStreak = errors.New("Streak hit limit has to be at least 1 and its hot wait at least 1 second")
+
+// defaultStreakLimit and defaultStreakHotWait are the settings of the streaks of the streams persisted before they were configurable
+const (
+	defaultStreakLimit   = 10
+	defaultStreakHotWait = time.Minute * 2
+)
+
+// StreakOptions describes the settings of the streak telling if the stream is watched. The streak goes inactive once
+// the files of the stream are not requested for its idle timeout, unless it turned hot
+type StreakOptions struct {
+	HitLimit int `json:"hitLimit"` // Number of requests of the files the streak turns hot after, the default one if 0
+	HotWait  int `json:"hotWait"`  // Seconds the hot streak stays active without requests, the default ones if 0
+}
+
+// StreakStatus describes the state of the streak of a stream
+type StreakStatus struct {
+	Active bool `json:"active"`
+	Hot    bool `json:"hot"`
+	// Hits is the number of requests of the files since the transcoding was started, LastHitAt is the time of the last one
+	Hits      int        `json:"hits"`
+	LastHitAt *time.Time `json:"lastHitAt,omitempty"`
+	// LastActivityAt is the last time the stream was requested or kept alive by a client
+	LastActivityAt time.Time `json:"lastActivityAt"`
+	// HitLimit, HotWait and ActiveWait are the settings of the streak, the waits are in seconds.
+	// ActiveWait is the idle timeout of the stream, 0 if the streak never goes inactive
+	HitLimit   int `json:"hitLimit"`
+	HotWait    int `json:"hotWait"`
+	ActiveWait int `json:"activeWait"`
+	// InactiveIn is the number of seconds left until the streak goes inactive without requests, unset if it is not going to
+	InactiveIn *int `json:"inactiveIn,omitempty"`
+}
+
+// streakConfig returns the config of the streak of the stream
+func (o Options) streakConfig() hotstreak.Config {
+	limit, hotWait := o.Streak.HitLimit, time.Duration(o.Streak.HotWait)*time.Second
+	if limit == 0 {
+		limit = defaultStreakLimit
+	}
+	if hotWait == 0 {
+		hotWait = defaultStreakHotWait
+	}
+	return hotstreak.Config{Limit: limit, HotWait: hotWait, ActiveWait: o.streakWait()}
+}
+
+// Hit records a request of the files of the stream made at the given time on its streak,
+// unless only the output of the stream counts as its activity
+func (strm *Stream) Hit(now time.Time) {
+	strm.Mux.Lock()
+	if !strm.Options.countsRequests() {
+		strm.Mux.Unlock()
+		return
+	}
+	strm.hits++
+	strm.lastHit = now
+	strm.Mux.Unlock()
+	strm.Streak.Hit()
+}
+
+// StreakStatus describes the streak of the stream at the given time
+func (strm *Stream) StreakStatus(now time.Time) StreakStatus {
+	strm.Mux.RLock()
+	config := strm.Options.streakConfig()
+	idle := strm.Options.IdleDuration()
+	hits, lastHit, since, lastActivity := strm.hits, strm.lastHit, strm.StartedAt, strm.LastActivity
+	strm.Mux.RUnlock()
+	status := StreakStatus{
+		Active:         strm.Streak.IsActive(),
+		Hot:            strm.Streak.IsHot(),
+		Hits:           hits,
+		LastActivityAt: lastActivity,
+		HitLimit:       config.Limit,
+		HotWait:        int(config.HotWait / time.Second),
+	}
+	if !lastHit.IsZero() {
+		status.LastHitAt = &lastHit
+		if lastHit.After(since) {
+			since = lastHit
+		}
+	}
+	if idle == 0 {
+		return status
+	}
+	status.ActiveWait = int(idle / time.Second)
+	// The hot streak stays active regardless of the idle timeout
+	if status.Active && !status.Hot {
+		seconds := int(since.Add(idle).Sub(now).Seconds())
+		if seconds < 0 {
+			seconds = 0
+		}
+		status.InactiveIn = &seconds
+	}
+	return status
+}
@@ -0,0 +1,72 @@
+package streaming
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roverr/hotstreak"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreakStatus(t *testing.T) {
+	started := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	newStream := func(opts Options) *Stream {
+		return &Stream{
+			Mux:          &sync.RWMutex{},
+			Streak:       hotstreak.New(opts.streakConfig()).Activate(),
+			Options:      opts,
+			StartedAt:    started,
+			LastActivity: started,
+		}
+	}
+	seconds := func(n int) *int { return &n }
+	after := func(n int) time.Time { return started.Add(time.Duration(n) * time.Second) }
+
+	t.Run("Should go inactive after the idle timeout without hits", func(t *testing.T) {
+		strm := newStream(Options{IdleTimeout: 60, Streak: StreakOptions{HitLimit: 3, HotWait: 120}})
+		assert.Equal(t, StreakStatus{
+			Active: true, LastActivityAt: started, HitLimit: 3, HotWait: 120, ActiveWait: 60, InactiveIn: seconds(50),
+		}, strm.StreakStatus(after(10)))
+
+		// Every hit starts the idle timeout again
+		strm.Hit(after(30))
+		status := strm.StreakStatus(after(40))
+		assert.Equal(t, 1, status.Hits)
+		assert.Equal(t, after(30), *status.LastHitAt)
+		assert.Equal(t, seconds(50), status.InactiveIn)
+		assert.Equal(t, seconds(0), strm.StreakStatus(after(120)).InactiveIn)
+
+		strm.Streak.Deactivate()
+		status = strm.StreakStatus(after(130))
+		assert.False(t, status.Active)
+		assert.Nil(t, status.InactiveIn)
+	})
+
+	t.Run("Should stay active regardless of the idle timeout once it is hot", func(t *testing.T) {
+		strm := newStream(Options{IdleTimeout: 60, Streak: StreakOptions{HitLimit: 3, HotWait: 120}})
+		for i := 1; i <= 3; i++ {
+			strm.Hit(after(i))
+			assert.Equal(t, i == 3, strm.StreakStatus(after(i)).Hot)
+		}
+		status := strm.StreakStatus(after(90))
+		assert.True(t, status.Active)
+		assert.Equal(t, 3, status.Hits)
+		assert.Nil(t, status.InactiveIn)
+	})
+
+	t.Run("Should never go inactive without an idle timeout", func(t *testing.T) {
+		strm := newStream(Options{Streak: StreakOptions{HitLimit: 3, HotWait: 120}})
+		status := strm.StreakStatus(after(3600))
+		assert.True(t, status.Active)
+		assert.Equal(t, 0, status.ActiveWait)
+		assert.Nil(t, status.InactiveIn)
+	})
+
+	t.Run("Should use the default settings for the streams persisted before they were configurable", func(t *testing.T) {
+		strm := newStream(Options{IdleTimeout: 60})
+		status := strm.StreakStatus(after(0))
+		assert.Equal(t, defaultStreakLimit, status.HitLimit)
+		assert.Equal(t, int(defaultStreakHotWait/time.Second), status.HotWait)
+	})
+}
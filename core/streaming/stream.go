@@ -1,10 +1,15 @@
 package streaming
 
 import (
+	"context"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/natefinch/lumberjack"
 	"github.com/sirupsen/logrus"
@@ -14,7 +19,9 @@ import (
 
 // Stream describes a given host's streaming
 type Stream struct {
-	CMD         *exec.Cmd            `json:"-"`
+	// Process is the running transcoding of the stream started by the Transcoder, nil until the stream is run
+	Process     Process              `json:"-"`
+	Transcoder  Transcoder           `json:"-"`
 	Mux         *sync.RWMutex        `json:"-"`
 	Path        string               `json:"path"`
 	Streak      *hotstreak.Hotstreak `json:"-"`
@@ -22,17 +29,424 @@ type Stream struct {
 	StorePath   string               `json:"-"`
 	KeepFiles   bool                 `json:"-"`
 	Logger      *lumberjack.Logger   `json:"-"`
+	Logs        *LogBuffer           `json:"-"`
+	StartedAt   time.Time            `json:"-"`
+	KeyPath     string               `json:"-"`
+	SDPPath     string               `json:"-"` // SDP file the processes read the source from, empty if the stream has none
+	Options     Options              `json:"options"`
+	CreatedAt   time.Time            `json:"-"`
+	// LastActivity is the last time the stream was requested or kept alive by a client
+	LastActivity time.Time `json:"-"`
+	// OnExit is called when the process of the stream exits without being stopped
+	OnExit   func(err error) `json:"-"`
+	Restarts int             `json:"restarts"` // Number of restarts after crashes
+	Errored  bool            `json:"errored"`  // Indicates if the restarts after crashes were exhausted
+	// StallTimeout is the time the running process can go without writing a segment before OnStall is called, 0 turns it off
+	StallTimeout  time.Duration `json:"-"`
+	OnStall       func()        `json:"-"`
+	StallRestarts int           `json:"stallRestarts"` // Number of restarts after the process stopped writing segments
+	// LastError is the error of the last unexpected exit of the process, LastErrorAt is the time of the exit
+	LastError   string    `json:"-"`
+	LastErrorAt time.Time `json:"-"`
+	// Command is the command line the transcoding process was started with, with the credentials redacted, and ProcessStartedAt
+	// the time it was started. Both are kept after the process exits, nil and zero if it was never started
+	Command          []string  `json:"-"`
+	ProcessStartedAt time.Time `json:"-"`
+	// RequestID is the id of the request that started the stream, the logs and the events of its background work carry it
+	RequestID string `json:"-"`
+	// Recorder writes the MP4 recording of the stream, it runs independently of the transcoding process
+	Recorder     *exec.Cmd `json:"-"`
+	RecordingDir string    `json:"-"` // Directory of the recorded files, empty if recording is disabled
+	// Metadata are the labels of the stream given by the clients, they do not affect the transcoding.
+	// The map is replaced as a whole, it is never modified
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Group is the name of the group the stream belongs to, the streams of a group can be stopped and restarted together. Empty if it has none
+	Group string `json:"-"`
+	// ExpiresAt is the end of the time to live of the stream, it is removed then even if it is watched. Zero if it has none
+	ExpiresAt time.Time `json:"-"`
+	// PlaybackToken is the token the files of the stream are served with if the playback tokens are enabled, empty if it was revoked
+	PlaybackToken string `json:"-"`
+	// Paused indicates if the transcoding was paused by a client, the stream is only started again by resuming it
+	Paused bool `json:"-"`
+	// Evicted indicates if the stream is paused to make room for a stream with a higher priority, it is resumed once a slot is free
+	Evicted bool `json:"-"`
+	// Disabled indicates if the stream is switched off by a client, it is paused until it is enabled again
+	Disabled bool `json:"-"`
+	// Relay delivers the MPEG-TS output of the transcoding to the connected clients, nil if the output is turned off
+	Relay *Relay `json:"-"`
+	// Limits are the limits the transcoding process runs with, the ones that could not be applied are left out
+	Limits Limits `json:"-"`
+	// Usage is the resource usage of the transcoding process, nil if it is not sampled
+	Usage *ResourceUsage `json:"-"`
+	// States stores the state of the transcoding process while it runs, nil if it is not stored
+	States *ProcessStates `json:"-"`
+	// KillGrace is the time the transcoding process has to exit after it is asked to, it is killed afterwards. 0 kills it right away
+	KillGrace time.Duration `json:"-"`
+	attempts  int
+	// failingSince is the time of the first of the consecutive crashes, retryAt the time the next restart is scheduled for
+	failingSince, retryAt time.Time
+	// retryChanged is closed when the retry policy of the stream is replaced, so the scheduled restart is timed again
+	retryChanged chan struct{}
+	stalls       []time.Time // Times of the recent stalls of the process
+	stopping     bool
+	removed      bool // Indicates if the files of the stream were removed by the cleanup
+	// thumbnails refreshes the poster image of the stream until the channel is closed, nil if it is turned off
+	thumbnails func(stop <-chan struct{})
+	// push forwards the stream to its push target until the channel is closed, nil if the stream is not pushed
+	push    func(stop <-chan struct{})
+	pushing *pushState
+	// hits is the number of requests of the files since the transcoding was started, lastHit is the time of the last one
+	hits    int
+	lastHit time.Time
+	// lastOutput is the last output of the transcoding recorded as the activity of the stream
+	lastOutput time.Time
+	authFailed bool // Indicates if the stream is errored because the source refused its credentials
 }
 
-// CleanProcess makes sure that the transcoding process is killed correctly
+// Touch records the activity of a client on the stream, unless only the output of the stream counts as its activity
+func (strm *Stream) Touch() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	if !strm.Options.countsRequests() {
+		return
+	}
+	strm.LastActivity = time.Now()
+}
+
+// IsAlive indicates if the stream is watched or it is still within its own idle timeout.
+// Streams without an idle timeout are never cleaned up automatically
+func (strm *Stream) IsAlive(now time.Time) bool {
+	strm.Mux.RLock()
+	idleTimeout := strm.Options.IdleDuration()
+	lastActivity := strm.LastActivity
+	strm.Mux.RUnlock()
+	if idleTimeout == 0 || strm.Streak.IsActive() {
+		return true
+	}
+	return now.Sub(lastActivity) < idleTimeout
+}
+
+// PlaylistFile returns the physical path of the playlist the clients start playing with
+func (strm *Stream) PlaylistFile() string {
+	return filepath.Join(strm.StorePath, filepath.Base(strm.Path))
+}
+
+// DASHPath returns the path of the MPEG-DASH manifest of the stream, empty if it is only written as HLS
+func (strm *Stream) DASHPath() string {
+	if strm.Options.OutputFormat() == FormatHLS {
+		return ""
+	}
+	return path.Join(path.Dir(strm.Path), dashManifest)
+}
+
+// HLSPath returns the path of the HLS playlist of the stream, empty if it is only written as MPEG-DASH
+func (strm *Stream) HLSPath() string {
+	if strm.Options.OutputFormat() == FormatDASH {
+		return ""
+	}
+	return strm.Path
+}
+
+// MediaPlaylistFile returns the physical path of a playlist that is updated with every segment.
+// Master playlists are only written once, so the playlist of the first rendition is used for them
+// and the playlist of the video for streams written by the DASH muxer. DASH manifests are rewritten with every segment
+func (strm *Stream) MediaPlaylistFile() string {
+	if strm.Options.UsesDASHMuxer() && strm.Options.OutputFormat() != FormatDASH {
+		return filepath.Join(strm.StorePath, dashMediaPlaylist)
+	}
+	if len(strm.Options.Renditions) == 0 {
+		return strm.PlaylistFile()
+	}
+	return filepath.Join(strm.StorePath, strm.Options.Renditions[0].Name(), indexPlaylist)
+}
+
+// NewestSegmentTime returns the wall clock time of the newest segment of the stream read from its media playlist,
+// nil if the playlist does not carry the time of its segments
+func (strm *Stream) NewestSegmentTime() *time.Time {
+	strm.Mux.RLock()
+	playlist := strm.MediaPlaylistFile()
+	strm.Mux.RUnlock()
+	return NewestSegmentTime(playlist)
+}
+
+// SnapshotInput returns the input the snapshots of the stream are taken from, which is the last segment listed
+// in its playlist. Encrypted segments and fragmented MP4 segments without their init section cannot be decoded,
+// so those streams are snapshotted from their source. Returns an empty string if the stream has not produced a segment yet
+func (strm *Stream) SnapshotInput() string {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	if strm.Options.FragmentedMP4() {
+		if _, err := os.Stat(strm.MediaPlaylistFile()); err != nil {
+			return ""
+		}
+		return strm.OriginalURI
+	}
+	refs := PlaylistReferences(strm.MediaPlaylistFile())
+	if len(refs) == 0 {
+		return ""
+	}
+	if strm.KeyPath != "" {
+		return strm.OriginalURI
+	}
+	return refs[len(refs)-1]
+}
+
+// HasSegment indicates if the stream has written a complete segment. The segments listed in the media playlist are
+// complete, streams only written as MPEG-DASH are checked for the chunks of their manifest
+func (strm *Stream) HasSegment() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	if strm.Options.OutputFormat() == FormatDASH {
+		chunks, _ := filepath.Glob(filepath.Join(strm.StorePath, "chunk-*.m4s"))
+		return len(chunks) > 0
+	}
+	for _, ref := range PlaylistReferences(strm.MediaPlaylistFile()) {
+		if _, err := os.Stat(ref); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IsProcessAlive indicates if the transcoding process of the stream is running
+func (strm *Stream) IsProcessAlive() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Process != nil && strm.Process.Healthy()
+}
+
+// Pid returns the id of the operating system process of the running transcoding, 0 if it is not running
+func (strm *Stream) Pid() int {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	if strm.Process == nil || !strm.Process.Healthy() {
+		return 0
+	}
+	return pidOf(strm.Process)
+}
+
+// IsAudioOnly indicates if only the audio of the source is streamed, so the stream has no frames to take images from
+func (strm *Stream) IsAudioOnly() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Options.AudioOnly
+}
+
+// IsRecording indicates if the recording process of the stream is running
+func (strm *Stream) IsRecording() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.recording()
+}
+
+// recording indicates if the recording process is running, the lock of the stream has to be held
+func (strm *Stream) recording() bool {
+	if strm.Recorder == nil || strm.Recorder.Process == nil {
+		return false
+	}
+	return strm.Recorder.Process.Signal(syscall.Signal(0)) == nil
+}
+
+// StopRecording kills the recording process of the stream. The recorded files are kept
+func (strm *Stream) StopRecording() error {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	if strm.Recorder == nil || strm.Recorder.Process == nil {
+		return nil
+	}
+	process := strm.Recorder.Process
+	strm.Recorder = nil
+	// The recordings that exited are not signalled, their pid can be reused
+	if process.Signal(syscall.Signal(0)) != nil {
+		return nil
+	}
+	return signalLeader(process.Pid, syscall.SIGKILL)
+}
+
+// CleanProcess stops the transcoding process, it is killed if it does not exit within the kill grace period
 func (strm *Stream) CleanProcess() error {
 	strm.Mux.Lock()
 	strm.Streak.Deactivate()
+	strm.stopping = true
+	strm.disconnectRelay()
+	defer strm.removeSDP()
 	if !strm.KeepFiles {
 		defer strm.cleanDir()
+	} else {
+		defer strm.removeThumbnail()
+	}
+	defer strm.Mux.Unlock()
+	// Process might have never started or has been stopped already
+	if strm.Process == nil {
+		return nil
+	}
+	killed, err := Terminate(context.Background(), strm.Process, strm.KillGrace)
+	if killed {
+		logrus.Debugf("%s did not exit in time, killing it", strm.Path)
+	}
+	return err
+}
+
+// disconnectRelay drops the clients of the MPEG-TS output, since the stream is stopped
+func (strm *Stream) disconnectRelay() {
+	if strm.Relay != nil {
+		strm.Relay.Disconnect()
+	}
+}
+
+// Stop terminates the transcoding process gracefully. The process is killed
+// if it does not exit within the kill grace period or before the context is done. The files of the stream are
+// kept if keepFiles is set, so the stream can be recovered later
+func (strm *Stream) Stop(ctx context.Context, keepFiles bool) error {
+	strm.Mux.Lock()
+	strm.Streak.Deactivate()
+	strm.stopping = true
+	strm.disconnectRelay()
+	defer strm.removeSDP()
+	if !strm.KeepFiles && !keepFiles {
+		defer strm.cleanDir()
+	} else {
+		defer strm.removeThumbnail()
+	}
+	defer strm.Mux.Unlock()
+	// Process might have never started or has been stopped already
+	if strm.Process == nil {
+		return nil
 	}
+	killed, err := Terminate(ctx, strm.Process, strm.KillGrace)
+	if killed {
+		logrus.Warnf("%s did not exit in time, killing it", strm.Path)
+	}
+	return err
+}
+
+// SetMetadata replaces the metadata of the stream
+func (strm *Stream) SetMetadata(metadata map[string]string) {
+	strm.Mux.Lock()
 	defer strm.Mux.Unlock()
-	if err := strm.CMD.Process.Kill(); err != nil {
+	strm.Metadata = metadata
+}
+
+// SetExpiry replaces the end of the time to live of the stream, zero removes it
+func (strm *Stream) SetExpiry(expiresAt time.Time) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.ExpiresAt = expiresAt
+}
+
+// GetExpiry returns the end of the time to live of the stream, zero if it has none
+func (strm *Stream) GetExpiry() time.Time {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.ExpiresAt
+}
+
+// SetPlaybackToken replaces the playback token of the stream
+func (strm *Stream) SetPlaybackToken(token string) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.PlaybackToken = token
+}
+
+// GetPlaybackToken returns the playback token of the stream
+func (strm *Stream) GetPlaybackToken() string {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.PlaybackToken
+}
+
+// SetPaused marks the stream as paused or resumed by a client, the stream is not evicted or disabled anymore then
+func (strm *Stream) SetPaused(paused bool) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Paused = paused
+	strm.Evicted = false
+	strm.Disabled = false
+}
+
+// Disable marks the stream as paused until it is enabled again by a client
+func (strm *Stream) Disable() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Paused = true
+	strm.Evicted = false
+	strm.Disabled = true
+}
+
+// IsDisabled indicates if the stream is paused because it was disabled
+func (strm *Stream) IsDisabled() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Disabled
+}
+
+// Evict marks the stream as paused to make room for a stream with a higher priority
+func (strm *Stream) Evict() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Paused = true
+	strm.Evicted = true
+}
+
+// IsEvicted indicates if the stream is paused because it was evicted
+func (strm *Stream) IsEvicted() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Evicted
+}
+
+// SetPriority changes the priority of the stream
+func (strm *Stream) SetPriority(priority int) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Options.Priority = priority
+}
+
+// IsPaused indicates if the transcoding of the stream was paused by a client
+func (strm *Stream) IsPaused() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Paused
+}
+
+// SetGroup replaces the group of the stream, empty removes it from its group
+func (strm *Stream) SetGroup(group string) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Group = group
+}
+
+// GetGroup returns the group of the stream, empty if it has none
+func (strm *Stream) GetGroup() string {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Group
+}
+
+// GetMetadata returns a copy of the metadata of the stream, so it can be changed without affecting the stream
+func (strm *Stream) GetMetadata() map[string]string {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	if strm.Metadata == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(strm.Metadata))
+	for key, value := range strm.Metadata {
+		copied[key] = value
+	}
+	return copied
+}
+
+// ClearFiles removes the segments, the playlists and the keys of the stopped stream
+func (strm *Stream) ClearFiles() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.cleanDir()
+}
+
+// killProcess kills the given process, ignoring the errors of processes that exited already
+func killProcess(process *os.Process) error {
+	if err := process.Kill(); err != nil {
 		if strings.Contains(err.Error(), "process already finished") {
 			return nil
 		}
@@ -50,4 +464,11 @@ func (strm *Stream) cleanDir() {
 	if err := os.RemoveAll(strm.StorePath); err != nil {
 		logrus.Error(err)
 	}
+	removeLayoutParents(strm.StorePath, strm.Options.Layout)
+	if strm.KeyPath == "" {
+		return
+	}
+	if err := os.RemoveAll(strm.KeyPath); err != nil {
+		logrus.Error(err)
+	}
 }
@@ -0,0 +1,238 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roverr/hotstreak"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamStop(t *testing.T) {
+	newStream := func(cmd *exec.Cmd) *Stream {
+		var process Process
+		if cmd != nil {
+			started, err := StartCommand(cmd)
+			assert.Nil(t, err)
+			process = started
+		}
+		return &Stream{
+			Process:   process,
+			Mux:       &sync.RWMutex{},
+			Streak:    hotstreak.New(hotstreak.Config{Limit: 10, HotWait: time.Minute, ActiveWait: time.Minute}).Activate(),
+			KeepFiles: true,
+		}
+	}
+
+	t.Run("Should stop processes gracefully", func(t *testing.T) {
+		strm := newStream(exec.Command("sleep", "20"))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		started := time.Now()
+		assert.Nil(t, strm.Stop(ctx, false))
+		assert.True(t, time.Since(started) < time.Second*5)
+		assert.False(t, strm.Streak.IsActive())
+	})
+
+	t.Run("Should kill processes ignoring the termination", func(t *testing.T) {
+		strm := newStream(exec.Command("sh", "-c", "trap '' TERM; sleep 20"))
+		exited := make(chan error, 1)
+		go func() { exited <- strm.Process.Wait() }()
+		// Give the shell time to set up the trap
+		<-time.After(time.Millisecond * 200)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+		defer cancel()
+		assert.Nil(t, strm.Stop(ctx, false))
+		select {
+		case err := <-exited:
+			assert.NotNil(t, err)
+		case <-time.After(time.Second * 5):
+			t.Error("Process has not been killed")
+		}
+	})
+
+	t.Run("Should not fail for streams that were never started", func(t *testing.T) {
+		strm := newStream(nil)
+		assert.Nil(t, strm.Stop(context.Background(), false))
+	})
+}
+
+func TestStreamRecording(t *testing.T) {
+	strm := &Stream{Mux: &sync.RWMutex{}}
+	assert.False(t, strm.IsRecording())
+	assert.Nil(t, strm.StopRecording())
+
+	recorder := exec.Command("sleep", "20")
+	assert.Nil(t, recorder.Start())
+	strm.Recorder = recorder
+	exited := make(chan error, 1)
+	go func() { exited <- recorder.Wait() }()
+	assert.True(t, strm.IsRecording())
+	assert.Nil(t, strm.StopRecording())
+	assert.False(t, strm.IsRecording())
+	select {
+	case err := <-exited:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second * 5):
+		t.Error("Recording has not been killed")
+	}
+}
+
+func TestStreamRun(t *testing.T) {
+	newStream := func(cmd *exec.Cmd, exits chan error) *Stream {
+		return &Stream{
+			Transcoder: TranscoderFunc(func(ctx context.Context, source, outDir string, opts Options) (Process, error) {
+				return StartCommand(cmd)
+			}),
+			Mux:       &sync.RWMutex{},
+			Streak:    hotstreak.New(hotstreak.Config{Limit: 10, HotWait: time.Minute, ActiveWait: time.Minute}).Activate(),
+			KeepFiles: true,
+			OnExit:    func(err error) { exits <- err },
+		}
+	}
+
+	t.Run("Should report processes exiting unexpectedly", func(t *testing.T) {
+		exits := make(chan error, 1)
+		strm := newStream(exec.Command("false"), exits)
+		assert.NotNil(t, strm.Run())
+		assert.NotNil(t, <-exits)
+		assert.Equal(t, "exit status 1", strm.LastError)
+		assert.False(t, strm.LastErrorAt.IsZero())
+	})
+
+	t.Run("Should not report processes that were stopped", func(t *testing.T) {
+		exits := make(chan error, 1)
+		strm := newStream(exec.Command("sleep", "20"), exits)
+		ran := make(chan error, 1)
+		go func() { ran <- strm.Run() }()
+		<-time.After(time.Millisecond * 100)
+		assert.Nil(t, strm.CleanProcess())
+		<-ran
+		assert.Empty(t, exits)
+		assert.Empty(t, strm.LastError)
+	})
+}
+
+func TestStreamHasSegment(t *testing.T) {
+	newStream := func(t *testing.T, format string) *Stream {
+		dir, err := ioutil.TempDir("", "segment")
+		assert.Nil(t, err)
+		return &Stream{Mux: &sync.RWMutex{}, Path: "/stream/id/index.m3u8", StorePath: dir, Options: Options{Format: format}}
+	}
+
+	t.Run("Should only count the segments of the playlist that were written", func(t *testing.T) {
+		strm := newStream(t, FormatHLS)
+		defer os.RemoveAll(strm.StorePath)
+		assert.False(t, strm.HasSegment())
+		assert.Nil(t, ioutil.WriteFile(strm.PlaylistFile(), []byte("#EXTM3U\n#EXTINF:2,\n0.ts\n"), 0644))
+		assert.False(t, strm.HasSegment())
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(strm.StorePath, "0.ts"), nil, 0644))
+		assert.True(t, strm.HasSegment())
+	})
+
+	t.Run("Should count the chunks of the streams only written as MPEG-DASH", func(t *testing.T) {
+		strm := newStream(t, FormatDASH)
+		defer os.RemoveAll(strm.StorePath)
+		assert.False(t, strm.HasSegment())
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(strm.StorePath, "chunk-0-00001.m4s"), nil, 0644))
+		assert.True(t, strm.HasSegment())
+	})
+}
+
+func TestStreamFail(t *testing.T) {
+	strm := &Stream{
+		Mux:    &sync.RWMutex{},
+		Streak: hotstreak.New(hotstreak.Config{Limit: 10, HotWait: time.Minute, ActiveWait: time.Minute}).Activate(),
+	}
+	strm.Fail("No segment was written within 20s")
+	assert.True(t, strm.IsErrored())
+	assert.False(t, strm.Streak.IsActive())
+	assert.Equal(t, "No segment was written within 20s", strm.LastError)
+	assert.False(t, strm.LastErrorAt.IsZero())
+}
+
+func TestStreamRemove(t *testing.T) {
+	newStream := func(t *testing.T) *Stream {
+		dir, err := ioutil.TempDir("", "remove")
+		assert.Nil(t, err)
+		return &Stream{
+			Mux:       &sync.RWMutex{},
+			StorePath: dir,
+			Streak:    hotstreak.New(hotstreak.Config{Limit: 10, HotWait: time.Minute, ActiveWait: time.Minute}).Activate(),
+			KeepFiles: true,
+		}
+	}
+
+	t.Run("Should remove the files of stopped streams and refuse to restart them", func(t *testing.T) {
+		strm := newStream(t)
+		assert.Nil(t, strm.CleanProcess())
+		assert.True(t, strm.Remove())
+		_, err := os.Stat(strm.StorePath)
+		assert.True(t, os.IsNotExist(err))
+		assert.Equal(t, ErrStreamRemoved, Processor{}.Restart(strm, "id"))
+	})
+
+	t.Run("Should keep the streams that were restarted", func(t *testing.T) {
+		strm := newStream(t)
+		defer os.RemoveAll(strm.StorePath)
+		assert.False(t, strm.Remove())
+		assert.Nil(t, strm.CleanProcess())
+		strm.Streak.Activate()
+		assert.False(t, strm.Remove())
+		_, err := os.Stat(strm.StorePath)
+		assert.Nil(t, err)
+	})
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Base: time.Second, Multiplier: 2, MaxAttempts: 5}
+	tt := []struct {
+		Attempt  int
+		Expected time.Duration
+	}{
+		{Attempt: 1, Expected: time.Second},
+		{Attempt: 2, Expected: time.Second * 2},
+		{Attempt: 3, Expected: time.Second * 4},
+		{Attempt: 5, Expected: time.Second * 16},
+	}
+	for _, testCase := range tt {
+		assert.Equal(t, testCase.Expected, backoff.Delay(testCase.Attempt))
+	}
+
+	capped := Backoff{Base: time.Second, Multiplier: 2, MaxAttempts: 100, MaxDelay: time.Second * 5}
+	assert.Equal(t, time.Second*4, capped.Delay(3))
+	assert.Equal(t, time.Second*5, capped.Delay(4))
+	assert.Equal(t, time.Second*5, capped.Delay(100))
+	jittered := Backoff{Base: time.Second, Multiplier: 1, Jitter: 0.5}
+	for i := 0; i < 20; i++ {
+		delay := jittered.Delay(1)
+		assert.True(t, delay >= 500*time.Millisecond && delay <= 1500*time.Millisecond)
+	}
+}
+
+func TestBackoffAllows(t *testing.T) {
+	backoff := Backoff{MaxAttempts: 3, GiveUpAfter: time.Minute}
+	tt := []struct {
+		Attempt      int
+		SinceFailure time.Duration
+		Expected     bool
+	}{
+		{Attempt: 1, SinceFailure: time.Second, Expected: true},
+		{Attempt: 3, SinceFailure: time.Minute, Expected: true},
+		{Attempt: 4, SinceFailure: time.Second, Expected: false},
+		{Attempt: 2, SinceFailure: time.Minute + time.Second, Expected: false},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Expected, backoff.Allows(testCase.Attempt, testCase.SinceFailure)) {
+			t.Error(fmt.Errorf("%d testcase is failing for Allows", i))
+		}
+	}
+	assert.True(t, Backoff{MaxAttempts: 3}.Allows(3, time.Hour))
+}
@@ -0,0 +1,224 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNoProcess describes an error for streams without a transcoding process
+var ErrNoProcess = errors.New("Stream has no process to run")
+
+// ErrStreamStopped describes an error for streams that were stopped before they were run
+var ErrStreamStopped = errors.New("Stream is stopped")
+
+// ErrStreamRemoved describes an error for streams that were removed by the cleanup, they cannot be restarted anymore
+var ErrStreamRemoved = errors.New("Stream is removed")
+
+// stableRunTime is the time after which a crashed process is not counted
+// as a consecutive failure of the previous restart anymore
+const stableRunTime = time.Minute
+
+// Backoff describes the delays between the restarts of crashed processes
+type Backoff struct {
+	Base        time.Duration `json:"base"`
+	Multiplier  float64       `json:"multiplier"`
+	MaxAttempts int           `json:"maxAttempts"`
+	MaxDelay    time.Duration `json:"maxDelay"`    // Longest delay between two attempts, 0 means no limit
+	Jitter      float64       `json:"jitter"`      // Fraction of the delay it is randomly lengthened or shortened by
+	GiveUpAfter time.Duration `json:"giveUpAfter"` // Time since the first failure the attempts can be made within, 0 means no limit
+}
+
+// Delay returns the time to wait before the given restart attempt, starting from 1
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := float64(b.Base) * math.Pow(b.Multiplier, float64(attempt-1))
+	if b.MaxDelay > 0 && delay > float64(b.MaxDelay) {
+		delay = float64(b.MaxDelay)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Allows tells if the given attempt can be made at the given time after the first failure
+func (b Backoff) Allows(attempt int, sinceFailure time.Duration) bool {
+	if attempt > b.MaxAttempts {
+		return false
+	}
+	return b.GiveUpAfter <= 0 || sinceFailure <= b.GiveUpAfter
+}
+
+// Run starts a new transcoding process of the stream with its transcoder and runs it until it exits.
+// OnExit is called if the process fails to start or exits without being stopped
+func (strm *Stream) Run() error {
+	strm.Mux.Lock()
+	if strm.Transcoder == nil {
+		strm.Mux.Unlock()
+		return ErrNoProcess
+	}
+	// Streams stopped before their process could start, like the aborted starts, are not started anymore
+	if strm.stopping {
+		strm.Mux.Unlock()
+		return ErrStreamStopped
+	}
+	workers := []func(stop <-chan struct{}){strm.thumbnails, strm.push, strm.watchdog}
+	stdout, stderr := outputWriters(strm.Logger, strm.Logs)
+	if strm.Usage != nil {
+		// The standard output carries the progress of the encoding then
+		strm.Usage.Reset()
+		stdout = strm.Usage.Progress()
+	}
+	ctx := WithOutput(context.Background(), stdout, stderr)
+	if strm.Relay != nil {
+		ctx = WithRelay(ctx, strm.Relay)
+	}
+	process, err := strm.Transcoder.Start(ctx, strm.OriginalURI, strm.StorePath, strm.Options)
+	if err == nil {
+		strm.Process = process
+		strm.Limits = limitsOf(process)
+		strm.Command = commandOf(process)
+		strm.ProcessStartedAt = time.Now()
+	}
+	states := strm.States
+	state := ProcessState{}
+	if err == nil && states != nil {
+		state = strm.stateOf(process)
+	}
+	strm.Mux.Unlock()
+	// Only the processes of the operating system are stored, like the ones of ffmpeg
+	if state.Pid > 0 {
+		if err := states.Save(strm.stateID(), state); err != nil {
+			logrus.Errorf("State of the process of %s could not be stored || Error: %s", strm.Path, err)
+		}
+	}
+	if err == nil {
+		err = wait(process, workers...)
+	}
+	if state.Pid > 0 {
+		if err := states.Remove(strm.stateID(), state.Pid); err != nil {
+			logrus.Errorf("State of the process of %s could not be removed || Error: %s", strm.Path, err)
+		}
+	}
+	strm.Mux.RLock()
+	// Failed starts leave the process empty, they are reported unless the stream was restarted meanwhile
+	unexpected := strm.Process == process && !strm.stopping
+	onExit := strm.OnExit
+	strm.Mux.RUnlock()
+	if unexpected && err != nil {
+		strm.Mux.Lock()
+		strm.LastError = err.Error()
+		strm.LastErrorAt = time.Now()
+		strm.Mux.Unlock()
+	}
+	if unexpected && onExit != nil {
+		onExit(err)
+	}
+	return err
+}
+
+// wait waits for the process to exit, the workers like the refresh of the poster image and the push
+// only run while the process is running
+func wait(process Process, workers ...func(stop <-chan struct{})) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, worker := range workers {
+		if worker != nil {
+			go worker(stop)
+		}
+	}
+	return process.Wait()
+}
+
+// RecordCrash counts the crash of the process and returns the number of consecutive crashes.
+// Crashes of processes that were running for a while start the counting again
+func (strm *Stream) RecordCrash() int {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	if time.Since(strm.StartedAt) > stableRunTime {
+		strm.attempts = 0
+	}
+	if strm.attempts == 0 {
+		strm.failingSince = time.Now()
+	}
+	strm.attempts++
+	return strm.attempts
+}
+
+// FailingSince returns the time of the first of the consecutive crashes, zero if the process did not crash
+func (strm *Stream) FailingSince() time.Time {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	if strm.attempts == 0 {
+		return time.Time{}
+	}
+	return strm.failingSince
+}
+
+// RecordRestart counts the restart of a crashed process
+func (strm *Stream) RecordRestart() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Restarts++
+}
+
+// MarkErrored marks the stream as errored, so it is only restarted explicitly
+func (strm *Stream) MarkErrored() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Streak.Deactivate()
+	strm.Errored = true
+	strm.retryAt = time.Time{}
+}
+
+// Fail marks the stream as errored with the given reason as its last error, so it is only restarted explicitly
+func (strm *Stream) Fail(reason string) {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Streak.Deactivate()
+	strm.Errored = true
+	strm.LastError = reason
+	strm.LastErrorAt = time.Now()
+}
+
+// ResetErrored clears the errored state, the consecutive crashes and the recent stalls of the stream
+func (strm *Stream) ResetErrored() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.Errored = false
+	strm.authFailed = false
+	strm.attempts = 0
+	strm.retryAt = time.Time{}
+	strm.stalls = nil
+}
+
+// IsErrored indicates if the restarts of the stream were exhausted
+func (strm *Stream) IsErrored() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.Errored
+}
+
+// Remove removes the files of the stopped stream and marks it as removed, so it cannot be restarted anymore.
+// The lock is held meanwhile, streams restarted since they were stopped are kept and false is returned for them
+func (strm *Stream) Remove() bool {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	if !strm.stopping || strm.Streak.IsActive() {
+		return false
+	}
+	strm.removed = true
+	strm.cleanDir()
+	return true
+}
+
+// IsStopping indicates if the process of the stream was stopped on purpose
+func (strm *Stream) IsStopping() bool {
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return strm.stopping
+}
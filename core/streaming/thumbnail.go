@@ -0,0 +1,66 @@
+package streaming
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ThumbnailFile is the name of the poster image written into the directory of the streams
+const ThumbnailFile = "thumb.jpg"
+
+// ThumbnailPath returns the physical path of the poster image of the stream
+func (strm *Stream) ThumbnailPath() string {
+	return filepath.Join(strm.StorePath, ThumbnailFile)
+}
+
+// removeThumbnail removes the poster image of the stream
+func (strm *Stream) removeThumbnail() {
+	if err := os.Remove(strm.ThumbnailPath()); err != nil && !os.IsNotExist(err) {
+		logrus.Error(err)
+	}
+}
+
+// refreshThumbnails writes the poster image of the stream periodically from its last segment, until the channel is closed
+func (p Processor) refreshThumbnails(strm *Stream, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(p.thumbnail.ThumbnailInterval):
+		}
+		input := strm.SnapshotInput()
+		if input == "" {
+			continue
+		}
+		strm.Mux.RLock()
+		opts := strm.Options
+		strm.Mux.RUnlock()
+		image, err := p.decodeFrame(input, opts, p.thumbnail.ThumbnailWidth, p.thumbnail.ThumbnailHeight, true)
+		if err != nil {
+			logrus.Debugf("Thumbnail of %s could not be taken || Error: %s", strm.Path, err)
+			continue
+		}
+		if err := writeThumbnail(strm.ThumbnailPath(), image, stop); err != nil {
+			logrus.Debugf("Thumbnail of %s could not be written || Error: %s", strm.Path, err)
+		}
+	}
+}
+
+// writeThumbnail replaces the poster image at once, so clients never get a partially written one.
+// The image is dropped if the stream was stopped while it was taken
+func writeThumbnail(path string, image []byte, stop <-chan struct{}) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, image, 0644); err != nil {
+		return err
+	}
+	select {
+	case <-stop:
+		return os.Remove(tmp)
+	default:
+	}
+	return os.Rename(tmp, path)
+}
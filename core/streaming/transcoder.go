@@ -0,0 +1,283 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TranscoderFFmpeg transcodes the streams with ffmpeg processes
+const TranscoderFFmpeg = "ffmpeg"
+
+// TranscoderFake runs no process, it only writes a playlist with an empty segment into the directory of the streams
+const TranscoderFake = "fake"
+
+// exitPollInterval is the time between the checks of the processes being stopped
+const exitPollInterval = 50 * time.Millisecond
+
+// killWait is the time the killed processes are waited for
+const killWait = 5 * time.Second
+
+// ErrProcessNotCreated describes an error for transcoding processes that could not be created
+var ErrProcessNotCreated = errors.New("Transcoding process could not be created")
+
+// Process describes a running transcoding of a stream
+type Process interface {
+	// Wait blocks until the process exits and returns the reason, it can be called more than once
+	Wait() error
+	// Stop asks the process to exit gracefully
+	Stop() error
+	// Kill makes the process exit immediately
+	Kill() error
+	// Healthy indicates if the process is still running
+	Healthy() bool
+}
+
+// Terminate stops the process gracefully, it is killed if it does not exit within the grace period or before the context is done.
+// Every stop of the transcoding goes through it. Returns true if the process had to be killed
+func Terminate(ctx context.Context, process Process, grace time.Duration) (bool, error) {
+	if err := process.Stop(); err != nil {
+		return true, kill(process)
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	for process.Healthy() {
+		select {
+		case <-ctx.Done():
+			return true, kill(process)
+		case <-timer.C:
+			return true, kill(process)
+		case <-time.After(exitPollInterval):
+		}
+	}
+	return false, nil
+}
+
+// kill kills the process and waits until it exits, so it does not overlap with the next process of the stream
+func kill(process Process) error {
+	if err := process.Kill(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		process.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(killWait):
+	}
+	return nil
+}
+
+// Transcoder describes the service starting the transcoding of the sources into the output directory of the streams.
+// The context only covers the start, the process keeps running after it is done
+type Transcoder interface {
+	Start(ctx context.Context, source, outDir string, opts Options) (Process, error)
+}
+
+// TranscoderFunc is an adapter to use an ordinary function as a Transcoder
+type TranscoderFunc func(ctx context.Context, source, outDir string, opts Options) (Process, error)
+
+// Start calls the function
+func (f TranscoderFunc) Start(ctx context.Context, source, outDir string, opts Options) (Process, error) {
+	return f(ctx, source, outDir, opts)
+}
+
+// outputKey is the key of the writers of the process output in the context
+type outputKey struct{}
+
+// output describes the writers of the standard output and the error output of a process
+type output struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// WithOutput returns a copy of the context carrying the writers the transcoder should direct the output of the process into
+func WithOutput(ctx context.Context, stdout, stderr io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, output{stdout, stderr})
+}
+
+// Output returns the writers of the process output carried by the context, they are nil if the output is not kept
+func Output(ctx context.Context) (stdout, stderr io.Writer) {
+	out, _ := ctx.Value(outputKey{}).(output)
+	return out.stdout, out.stderr
+}
+
+// commandProcess is a Process running an operating system command
+type commandProcess struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+// StartCommand starts the given command in its own process group and returns it as a Process.
+// The processes the command leaves in its group are killed when it exits
+func StartCommand(cmd *exec.Cmd) (Process, error) {
+	return startCommand(cmd, 0)
+}
+
+// startCommand starts the command in its own process group. The command is waited for right away, so it is reaped as soon as it exits,
+// and the processes it leaves in its group get the grace period to exit before they are killed. The command exits once they are gone
+func startCommand(cmd *exec.Cmd, grace time.Duration) (Process, error) {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	process := &commandProcess{cmd, make(chan struct{}), nil}
+	go func() {
+		process.err = cmd.Wait()
+		reapGroup(cmd.Process.Pid, grace)
+		close(process.done)
+	}()
+	return process, nil
+}
+
+// Wait blocks until the command and the processes of its group exit
+func (p *commandProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Stop sends SIGTERM to the process group of the command
+func (p *commandProcess) Stop() error {
+	return p.signal(syscall.SIGTERM)
+}
+
+// Kill kills the process group of the command
+func (p *commandProcess) Kill() error {
+	return p.signal(syscall.SIGKILL)
+}
+
+// signal sends the signal to the process group of the command, the exited commands are not signalled since their pid can be reused
+func (p *commandProcess) signal(signal syscall.Signal) error {
+	if !p.Healthy() {
+		return nil
+	}
+	return signalGroup(p.cmd.Process.Pid, signal)
+}
+
+// Pid returns the id of the operating system process of the command
+func (p *commandProcess) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Command returns the command line the command was started with, with the credentials redacted
+func (p *commandProcess) Command() []string {
+	command := make([]string, len(p.cmd.Args))
+	for i, arg := range p.cmd.Args {
+		command[i] = RedactURI(arg)
+	}
+	return command
+}
+
+// Healthy indicates if the command has not exited yet
+func (p *commandProcess) Healthy() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// ffmpegTranscoder starts the ffmpeg processes of the processor
+type ffmpegTranscoder struct {
+	processor Processor
+}
+
+// Start starts the ffmpeg process writing the stream into the output directory
+func (t ffmpegTranscoder) Start(ctx context.Context, source, outDir string, opts Options) (Process, error) {
+	cmd := t.processor.newProcess(source, opts, streamID(opts, outDir), outDir)
+	if cmd == nil {
+		return nil, ErrProcessNotCreated
+	}
+	cmd.Stdout, cmd.Stderr = Output(ctx)
+	relay := OutputRelay(ctx)
+	if relay == nil {
+		return t.processor.startLimited(cmd, streamID(opts, outDir), opts)
+	}
+	// The MPEG-TS output is written into a pipe passed as the third file descriptor, the process keeps the only write end
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Args = append(cmd.Args, getRelayArgs(opts)...)
+	cmd.ExtraFiles = []*os.File{w}
+	process, err := t.processor.startLimited(cmd, streamID(opts, outDir), opts)
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	go func() {
+		io.Copy(relay, r)
+		r.Close()
+	}()
+	return process, nil
+}
+
+// FakeTranscoder is a Transcoder that runs no process. It writes a playlist listing an empty segment,
+// so the streams can be started, served and stopped without ffmpeg or a reachable source
+type FakeTranscoder struct{}
+
+// Start writes the playlists of the stream into the output directory, the returned process runs until it is stopped
+func (FakeTranscoder) Start(ctx context.Context, source, outDir string, opts Options) (Process, error) {
+	if outDir != "" {
+		strm := Stream{Path: getPlaylistName(opts), StorePath: outDir, Options: opts}
+		playlist := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXTINF:%d,\n0.ts\n", opts.HLS.Time, opts.HLS.Time)
+		for _, file := range []string{strm.PlaylistFile(), strm.MediaPlaylistFile()} {
+			if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+				return nil, err
+			}
+			if err := ioutil.WriteFile(filepath.Join(filepath.Dir(file), "0.ts"), nil, os.ModePerm); err != nil {
+				return nil, err
+			}
+			if err := ioutil.WriteFile(file, []byte(playlist), os.ModePerm); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &fakeProcess{make(chan struct{}), &sync.Once{}}, nil
+}
+
+// fakeProcess is the Process of the FakeTranscoder
+type fakeProcess struct {
+	done chan struct{}
+	once *sync.Once
+}
+
+// Wait blocks until the process is stopped
+func (p *fakeProcess) Wait() error {
+	<-p.done
+	return nil
+}
+
+// Stop makes the process exit
+func (p *fakeProcess) Stop() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+// Kill makes the process exit
+func (p *fakeProcess) Kill() error {
+	return p.Stop()
+}
+
+// Healthy indicates if the process has not been stopped yet
+func (p *fakeProcess) Healthy() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
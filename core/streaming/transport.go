@@ -0,0 +1,70 @@
+package streaming
+
+import (
+	"errors"
+	"strings"
+)
+
+// TransportTCP interleaves the packets of the source into the RTSP connection
+const TransportTCP = "tcp"
+
+// TransportUDP receives the packets of the source over UDP
+const TransportUDP = "udp"
+
+// TransportUDPMulticast receives the packets of the source over UDP multicast
+const TransportUDPMulticast = "udp_multicast"
+
+// TransportHTTP tunnels the RTSP connection of the source through HTTP
+const TransportHTTP = "http"
+
+// TransportAuto probes the source over UDP first and falls back to TCP if it times out.
+// The transport is left to ffmpeg if the source is not probed
+const TransportAuto = "auto"
+
+// ErrInvalidTransport describes an error for unknown RTSP transports
+var ErrInvalidTransport = errors.New("Transport has to be tcp, udp, udp_multicast, http or auto")
+
+// validateTransport checks if the RTSP transport of the options is known
+func validateTransport(opts Options) error {
+	switch opts.Transport {
+	case "", TransportTCP, TransportUDP, TransportUDPMulticast, TransportHTTP, TransportAuto:
+		return nil
+	default:
+		return ErrInvalidTransport
+	}
+}
+
+// getExtraInputArgs returns the input arguments of the SDP files, the configuration and the stream. Only the sources get them,
+// not the segments the snapshots are taken from
+func (p Processor) getExtraInputArgs(input string, opts Options) []string {
+	if !strings.Contains(input, "://") {
+		return nil
+	}
+	return append(append(p.getSDPArgs(input, opts), p.ffmpeg.FFmpegInputArgs...), opts.InputArgs...)
+}
+
+// IsRTSP indicates if the source is received over RTSP, only those sources have a transport
+func IsRTSP(input string) bool {
+	return strings.HasPrefix(input, "rtsp://") || strings.HasPrefix(input, "rtsps://")
+}
+
+// IsRTMP indicates if the source is played from an RTMP server
+func IsRTMP(input string) bool {
+	return strings.HasPrefix(input, "rtmp://") || strings.HasPrefix(input, "rtmps://")
+}
+
+// getTransportArgs returns the input arguments of the protocol of the source. RTSP sources are received
+// with their transport, streams created without a transport are received over TCP. RTMP sources are
+// played as live streams, their transport is ignored. Other sources get no arguments
+func getTransportArgs(input, transport string) []string {
+	if IsRTMP(input) {
+		return []string{"-rtmp_live", "live"}
+	}
+	if !IsRTSP(input) || transport == TransportAuto {
+		return nil
+	}
+	if transport == "" {
+		transport = TransportTCP
+	}
+	return []string{"-rtsp_transport", transport}
+}
@@ -0,0 +1,125 @@
+package streaming
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidSDP describes an error for SDP contents the address and the port of the media cannot be read from
+var ErrInvalidSDP = errors.New("SDP has to start with v=0 and name the address of its connection and the port of its media")
+
+// IsUDP indicates if the source is received as raw UDP or RTP packets, like the multicast feeds of the local network
+func IsUDP(input string) bool {
+	return strings.HasPrefix(input, "udp://") || strings.HasPrefix(input, "rtp://")
+}
+
+// SDPURI returns the rtp:// URI of the first media of the SDP on the address of its connection, the streams started
+// from an SDP are known by it. The TTL and the number of the addresses are left out
+func SDPURI(sdp string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(sdp), "v=0") {
+		return "", ErrInvalidSDP
+	}
+	address, port := "", ""
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		fields := strings.Fields(line[2:])
+		switch {
+		case line[0] == 'c' && address == "" && len(fields) == 3:
+			address = strings.SplitN(fields[2], "/", 2)[0]
+		case line[0] == 'm' && port == "" && len(fields) >= 2:
+			port = strings.SplitN(fields[1], "/", 2)[0]
+		}
+	}
+	if value, err := strconv.Atoi(port); err != nil || value < 1 || value > 65535 || net.ParseIP(address) == nil {
+		return "", ErrInvalidSDP
+	}
+	return "rtp://" + net.JoinHostPort(address, port), nil
+}
+
+// sdpPath returns the path of the SDP file the processes of the stream read their source from, it is named after the id of the stream
+func (p Processor) sdpPath(URI string, opts Options) string {
+	dir := p.ffmpeg.SDPDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "rtsp-stream-sdp")
+	}
+	id := opts.Directory
+	if id == "" {
+		id, _ = GetURIDirectory(URI)
+	}
+	return filepath.Join(dir, id+".sdp")
+}
+
+// getSDPArgs returns the input arguments of the streams read from an SDP file. Only the protocols of the media can be
+// opened by the SDP, the multicast groups are joined on the configured local address
+func (p Processor) getSDPArgs(input string, opts Options) []string {
+	if opts.SDP == "" || !strings.Contains(input, "://") {
+		return nil
+	}
+	args := []string{"-protocol_whitelist", "file,udp,rtp"}
+	if p.ffmpeg.UDPLocalAddress != "" {
+		args = append(args, "-localaddr", p.ffmpeg.UDPLocalAddress)
+	}
+	return args
+}
+
+// input returns the input of the processes for the source. The SDP of the stream is written to its file, which is read
+// instead of the URI. The udp:// and rtp:// sources get the configured options in their query, the ones of the URI are kept
+func (p Processor) input(URI string, opts Options) string {
+	switch {
+	case opts.SDP != "" && strings.Contains(URI, "://"):
+		path := p.sdpPath(URI, opts)
+		if err := writeSDP(path, opts.SDP); err != nil {
+			logrus.Errorf("SDP file of %s could not be written || Error: %s", opts.Directory, err)
+		}
+		return path
+	case strings.HasPrefix(URI, "udp://"):
+		if p.ffmpeg.UDPFifoSize > 0 {
+			URI = withQueryDefault(URI, "fifo_size", strconv.Itoa(p.ffmpeg.UDPFifoSize))
+		}
+		if p.ffmpeg.UDPOverrunNonfatal {
+			URI = withQueryDefault(URI, "overrun_nonfatal", "1")
+		}
+		return withQueryDefault(URI, "localaddr", p.ffmpeg.UDPLocalAddress)
+	case strings.HasPrefix(URI, "rtp://"):
+		return withQueryDefault(URI, "localaddr", p.ffmpeg.UDPLocalAddress)
+	}
+	return sourceInput(URI)
+}
+
+// withQueryDefault sets the parameter of the query of the URI to the escaped value unless the URI has it already,
+// empty values are not set
+func withQueryDefault(URI, key, value string) string {
+	if value == "" || queryParam(URI, key) != "" {
+		return URI
+	}
+	return SetQueryParam(URI, key, url.QueryEscape(value))
+}
+
+// writeSDP writes the SDP into the file, the directory is created if it is missing
+func writeSDP(path, sdp string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(sdp), 0600)
+}
+
+// removeSDP removes the SDP file of the stream, it is written again when the process is started
+func (strm *Stream) removeSDP() {
+	if strm.SDPPath == "" {
+		return
+	}
+	if err := os.Remove(strm.SDPPath); err != nil && !os.IsNotExist(err) {
+		logrus.Error(err)
+	}
+}
@@ -0,0 +1,82 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSDP = "v=0\r\no=- 0 0 IN IP4 192.168.0.10\r\ns=Feed\r\nc=IN IP4 239.0.0.1/32\r\nt=0 0\r\nm=video 5004 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n"
+
+func TestSDPURI(t *testing.T) {
+	tt := []struct {
+		SDP      string
+		Expected string
+		Err      error
+	}{
+		{SDP: testSDP, Expected: "rtp://239.0.0.1:5004"},
+		{SDP: "v=0\nc=IN IP6 ff15::1\nm=audio 6000/2 RTP/AVP 97\nm=video 5004 RTP/AVP 96\n", Expected: "rtp://[ff15::1]:6000"},
+		{SDP: "c=IN IP4 239.0.0.1\nm=video 5004 RTP/AVP 96\n", Err: ErrInvalidSDP},
+		{SDP: "v=0\nm=video 5004 RTP/AVP 96\n", Err: ErrInvalidSDP},
+		{SDP: "v=0\nc=IN IP4 239.0.0.1\nm=video 0 RTP/AVP 96\n", Err: ErrInvalidSDP},
+		{SDP: "v=0\nc=IN IP4 feeds.local\nm=video 5004 RTP/AVP 96\n", Err: ErrInvalidSDP},
+	}
+	for i, testCase := range tt {
+		uri, err := SDPURI(testCase.SDP)
+		if !assert.Equal(t, testCase.Err, err) || !assert.Equal(t, testCase.Expected, uri) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestSDPURI", i))
+		}
+	}
+}
+
+func TestNewProcessWithUDP(t *testing.T) {
+	storeDir, sdpDir := "./test", "./test-sdp"
+	defer os.RemoveAll(storeDir)
+	defer os.RemoveAll(sdpDir)
+	ffmpeg := config.FFmpeg{UDPFifoSize: 50000, UDPOverrunNonfatal: true, UDPLocalAddress: "192.168.0.2", SDPDir: sdpDir}
+	processor := NewProcessor(storeDir, false, config.ProcessLogging{}, config.Encryption{}, config.Hardware{}, time.Second, "", config.Thumbnail{}, ffmpeg)
+	opts := Options{HLS: HLSOptions{Time: 1, ListSize: 3}}
+
+	t.Run("Should add the configured options to the query of the URI", func(t *testing.T) {
+		tt := []struct {
+			URI      string
+			Expected string
+		}{
+			{URI: "udp://239.0.0.1:5000", Expected: "-i udp://239.0.0.1:5000?fifo_size=50000&overrun_nonfatal=1&localaddr=192.168.0.2 "},
+			{URI: "udp://239.0.0.1:5000?fifo_size=1000", Expected: "-i udp://239.0.0.1:5000?fifo_size=1000&overrun_nonfatal=1&localaddr=192.168.0.2 "},
+			{URI: "rtp://239.0.0.1:5004", Expected: "-i rtp://239.0.0.1:5004?localaddr=192.168.0.2 "},
+		}
+		for i, testCase := range tt {
+			process := strings.Join(processor.NewProcess(testCase.URI, opts).Args[1:], " ")
+			if !assert.Contains(t, process, testCase.Expected) {
+				t.Error(fmt.Errorf("%d testcase is failing for TestNewProcessWithUDP", i))
+			}
+		}
+	})
+
+	t.Run("Should read the source from the SDP file of the stream", func(t *testing.T) {
+		sdpOpts := opts
+		sdpOpts.SDP, sdpOpts.Directory = testSDP, "feed"
+		path := filepath.Join(sdpDir, "feed.sdp")
+		process := strings.Join(processor.NewProcess("rtp://239.0.0.1:5004", sdpOpts).Args[1:], " ")
+		assert.Contains(t, process, "-protocol_whitelist file,udp,rtp -localaddr 192.168.0.2 -i "+path+" ")
+		b, err := ioutil.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, testSDP, string(b))
+
+		// The file is removed once the stream is stopped
+		strm, _ := processor.NewStream("rtp://239.0.0.1:5004", sdpOpts)
+		assert.Equal(t, path, strm.SDPPath)
+		assert.Nil(t, strm.Stop(context.Background(), false))
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,34 @@
+package streaming
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// FFmpegUnavailable is reported as the version of ffmpeg if the binary could not be run
+const FFmpegUnavailable = "unavailable"
+
+// FFmpegVersion runs ffmpeg -version with the given binary and returns the version it reports.
+// Returns FFmpegUnavailable if the binary is missing or it does not answer before the context is done
+func FFmpegVersion(ctx context.Context, path string) string {
+	out, err := exec.CommandContext(ctx, path, "-version").Output()
+	if err != nil {
+		return FFmpegUnavailable
+	}
+	return parseFFmpegVersion(string(out))
+}
+
+// parseFFmpegVersion returns the version from the first line of the output, like 4.2.2 from
+// "ffmpeg version 4.2.2 Copyright (c) 2000-2019 the FFmpeg developers". The whole line is returned for other formats
+func parseFFmpegVersion(out string) string {
+	line := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	fields := strings.Fields(line)
+	if len(fields) >= 3 && fields[1] == "version" {
+		return fields[2]
+	}
+	if line == "" {
+		return FFmpegUnavailable
+	}
+	return line
+}
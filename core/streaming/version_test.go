@@ -0,0 +1,32 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFFmpegVersion(t *testing.T) {
+	tt := []struct {
+		Output  string
+		Version string
+	}{
+		{Output: "ffmpeg version 4.2.2 Copyright (c) 2000-2019 the FFmpeg developers\nbuilt with gcc 9.2.0\n", Version: "4.2.2"},
+		{Output: "ffmpeg version n4.4-78-g031c0cb0b4-20210628 Copyright (c) 2000-2021\n", Version: "n4.4-78-g031c0cb0b4-20210628"},
+		{Output: "wrapped ffmpeg\n", Version: "wrapped ffmpeg"},
+		{Output: "", Version: FFmpegUnavailable},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Version, parseFFmpegVersion(testCase.Output)) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestParseFFmpegVersion", i))
+		}
+	}
+}
+
+func TestFFmpegVersion(t *testing.T) {
+	t.Run("Should report the missing binary as unavailable", func(t *testing.T) {
+		assert.Equal(t, FFmpegUnavailable, FFmpegVersion(context.Background(), "/not/existing/ffmpeg"))
+	})
+}
@@ -0,0 +1,77 @@
+package streaming
+
+import (
+	"os"
+	"time"
+)
+
+// minStallCheck is the shortest period the watchdog checks the output of the process with
+const minStallCheck = 50 * time.Millisecond
+
+// LastOutputAt returns the last time the process of the stream wrote output, which is the latest of its start,
+// the last segment it started writing and the last change of its media playlist
+func (strm *Stream) LastOutputAt() time.Time {
+	strm.Mux.RLock()
+	last := strm.StartedAt
+	playlist := strm.MediaPlaylistFile()
+	logs := strm.Logs
+	strm.Mux.RUnlock()
+	if logs != nil && logs.LastSegmentAt().After(last) {
+		last = logs.LastSegmentAt()
+	}
+	if info, err := os.Stat(playlist); err == nil && info.ModTime().After(last) {
+		last = info.ModTime()
+	}
+	return last
+}
+
+// watchdog calls OnStall once the running process has not written a segment for the stall timeout, until the channel is closed.
+// The process is left running, OnStall decides how the stalled stream is restarted
+func (strm *Stream) watchdog(stop <-chan struct{}) {
+	strm.Mux.RLock()
+	timeout, onStall := strm.StallTimeout, strm.OnStall
+	strm.Mux.RUnlock()
+	if timeout <= 0 || onStall == nil {
+		return
+	}
+	period := timeout / 4
+	if period < minStallCheck {
+		period = minStallCheck
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if strm.IsStopping() || time.Since(strm.LastOutputAt()) < timeout {
+				continue
+			}
+			onStall()
+			return
+		}
+	}
+}
+
+// RecordStall counts the stall of the process and returns the number of stalls within the given window
+func (strm *Stream) RecordStall(window time.Duration) int {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	now := time.Now()
+	recent := []time.Time{}
+	for _, stall := range strm.stalls {
+		if now.Sub(stall) < window {
+			recent = append(recent, stall)
+		}
+	}
+	strm.stalls = append(recent, now)
+	return len(strm.stalls)
+}
+
+// RecordStallRestart counts the restart of a stalled process
+func (strm *Stream) RecordStallRestart() {
+	strm.Mux.Lock()
+	defer strm.Mux.Unlock()
+	strm.StallRestarts++
+}
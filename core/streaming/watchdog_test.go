@@ -0,0 +1,84 @@
+package streaming
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roverr/hotstreak"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamWatchdog(t *testing.T) {
+	newStream := func(dir string, stalled chan struct{}) *Stream {
+		return &Stream{
+			Mux:          &sync.RWMutex{},
+			Streak:       hotstreak.New(hotstreak.Config{Limit: 10, HotWait: time.Minute, ActiveWait: time.Minute}).Activate(),
+			Path:         "/stream/watchdog/index.m3u8",
+			StorePath:    dir,
+			StartedAt:    time.Now(),
+			StallTimeout: time.Millisecond * 200,
+			OnStall:      func() { close(stalled) },
+		}
+	}
+
+	t.Run("Should report the processes that stopped writing segments", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "watchdog")
+		defer os.RemoveAll(dir)
+		stalled := make(chan struct{})
+		strm := newStream(dir, stalled)
+		stop := make(chan struct{})
+		defer close(stop)
+		go strm.watchdog(stop)
+		// The playlist is refreshed for a while, the stall is only counted from its last change
+		refreshed := time.Now()
+		for i := 0; i < 5; i++ {
+			<-time.After(time.Millisecond * 100)
+			assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U\n"), 0644))
+			refreshed = time.Now()
+		}
+		select {
+		case <-stalled:
+			assert.True(t, time.Since(refreshed) >= time.Millisecond*150)
+		case <-time.After(time.Second * 2):
+			t.Error("Stall is not reported")
+		}
+	})
+
+	t.Run("Should shut down once the process exits", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "watchdog")
+		defer os.RemoveAll(dir)
+		stalled := make(chan struct{})
+		strm := newStream(dir, stalled)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			strm.watchdog(stop)
+			close(done)
+		}()
+		close(stop)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Watchdog is still running")
+		}
+		select {
+		case <-stalled:
+			t.Error("Stall is reported after the process exited")
+		case <-time.After(time.Millisecond * 400):
+		}
+	})
+
+	t.Run("Should count the stalls within the window", func(t *testing.T) {
+		strm := &Stream{Mux: &sync.RWMutex{}}
+		assert.Equal(t, 1, strm.RecordStall(time.Minute))
+		assert.Equal(t, 2, strm.RecordStall(time.Minute))
+		<-time.After(time.Millisecond * 50)
+		assert.Equal(t, 1, strm.RecordStall(time.Millisecond*50))
+		strm.ResetErrored()
+		assert.Equal(t, 1, strm.RecordStall(time.Minute))
+	})
+}
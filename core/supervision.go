@@ -0,0 +1,231 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// supervise restarts the process of the stream if it crashes or stops writing segments and tracks the disk usage of its segments
+func (c *Controller) supervise(id string, strm *streaming.Stream) {
+	strm.OnExit = func(err error) {
+		go c.restartCrashed(id, strm, err)
+	}
+	strm.StallTimeout = c.spec().StallTimeout
+	strm.OnStall = func() {
+		go c.restartStalled(id, strm)
+	}
+	// The usage of the stream is tracked with every segment it writes
+	if strm.Logs != nil {
+		strm.Logs.OnSegment(func() { c.refreshUsage(id) })
+	}
+}
+
+// backoff returns the delays between the restarts of crashed processes, the retry policy of the configuration
+func (c *Controller) backoff() streaming.Backoff {
+	return streaming.Backoff{
+		Base:        c.spec().CrashBackoffBase,
+		Multiplier:  c.spec().CrashBackoffMultiplier,
+		MaxAttempts: c.spec().CrashMaxAttempts,
+		MaxDelay:    c.spec().CrashMaxDelay,
+		Jitter:      c.spec().CrashJitter,
+		GiveUpAfter: c.spec().CrashGiveUpAfter,
+	}
+}
+
+// retryPolicy returns the retry policy of the stream, the one of the configuration if it has none of its own
+func (c *Controller) retryPolicy(strm *streaming.Stream) streaming.Backoff {
+	if policy := strm.RetryPolicy(); policy != nil {
+		return *policy
+	}
+	return c.backoff()
+}
+
+// restartCrashed restarts the crashed process of the stream with the backoff of its retry policy, once it gets a reconnect slot.
+// The stream is marked as errored once the attempts are exhausted or they would take longer than the policy allows.
+// Restarts are abandoned if the stream is stopped, removed or the service is shutting down
+func (c *Controller) restartCrashed(id string, strm *streaming.Stream, err error) {
+	c.streamLog(strm).Errorf("%s exited unexpectedly || Error: %v", id, err)
+	// The refused credentials are not tried again with the backoff, the source would lock their account
+	if strm.RefusedCredentials() {
+		if !c.rotateCredentials(id, strm) {
+			return
+		}
+	} else if !c.waitForRetry(id, strm, strm.RecordCrash(), err) {
+		return
+	}
+	if current, ok := c.getStream(id); !ok || current != strm || strm.IsStopping() {
+		return
+	}
+	if !c.awaitReconnect(id, strm) {
+		return
+	}
+	// The slot is held until the restarted process connects to its source
+	restartedAt := time.Now()
+	defer func() { go c.releaseReconnect(strm, restartedAt) }()
+	// The crashed streams are not restarted while every stream is being stopped
+	if !c.spawns.enter() {
+		return
+	}
+	defer c.spawns.leave()
+	if host := sourceHost(strm.OriginalURI); host != "" {
+		c.metrics.Reconnecting(host)
+	}
+	if err := c.processor.Restart(strm, id); err != nil {
+		c.streamLog(strm).Error(err)
+		return
+	}
+	strm.RecordRestart()
+	c.metrics.Restarted(id)
+	c.publish(events.Restarted, id, strm, fmt.Sprint(err))
+}
+
+// waitForRetry waits until the given restart of the crashed process is due. The wait is timed again if the retry policy
+// of the stream is replaced meanwhile. The stream is marked as errored if the policy does not allow the restart, false is
+// returned then and if the service is shutting down
+func (c *Controller) waitForRetry(id string, strm *streaming.Stream, attempt int, err error) bool {
+	defer strm.CancelRetry()
+	crashed, since := time.Now(), strm.FailingSince()
+	for {
+		backoff := c.retryPolicy(strm)
+		at := crashed.Add(backoff.Delay(attempt))
+		if !backoff.Allows(attempt, at.Sub(since)) {
+			if attempt > backoff.MaxAttempts {
+				c.streamLog(strm).Errorf("%s is errored after %d restarts", id, backoff.MaxAttempts)
+			} else {
+				c.streamLog(strm).Errorf("%s is errored, it could not be restarted within %s", id, backoff.GiveUpAfter)
+			}
+			strm.MarkErrored()
+			c.publish(events.Errored, id, strm, fmt.Sprint(err))
+			c.persist()
+			return false
+		}
+		changed := strm.ScheduleRetry(at)
+		c.streamLog(strm).Infof("%s is getting restarted in %s, attempt %d", id, time.Until(at).Round(time.Millisecond), attempt)
+		select {
+		case <-time.After(time.Until(at)):
+			return true
+		case <-changed:
+		case <-c.done:
+			return false
+		}
+	}
+}
+
+// restartStalled restarts the process of the stream that is running without writing segments. The stream is marked as errored
+// instead once it stalls more than the allowed times within the stall window. Streams restarted meanwhile are left alone
+func (c *Controller) restartStalled(id string, strm *streaming.Stream) {
+	if current, ok := c.getStream(id); !ok || current != strm || strm.IsStopping() {
+		return
+	}
+	if !c.restarting.begin(id) {
+		return
+	}
+	defer c.restarting.end(id)
+	if !c.spawns.enter() {
+		return
+	}
+	defer c.spawns.leave()
+
+	timeout := c.spec().StallTimeout
+	c.streamLog(strm).Warnf("%s has not written a segment for %s", id, timeout)
+	c.publish(events.Stalled, id, strm, fmt.Sprintf("no segment for %s", timeout))
+	ctx, cancel := context.WithTimeout(context.Background(), c.spec().ShutdownGrace)
+	defer cancel()
+	if err := strm.Stop(ctx, true); err != nil {
+		c.streamLog(strm).Error(err)
+	}
+	stalls := strm.RecordStall(c.spec().StallWindow)
+	if stalls > c.spec().StallMaxRestarts {
+		reason := ErrStalledFn(stalls, c.spec().StallWindow).Error()
+		c.streamLog(strm).Errorf("%s is errored || Error: %s", id, reason)
+		strm.Fail(reason)
+		c.publish(events.Errored, id, strm, reason)
+		c.persist()
+		return
+	}
+	if err := c.processor.Restart(strm, id); err != nil {
+		c.streamLog(strm).Error(err)
+		return
+	}
+	strm.RecordStallRestart()
+	c.metrics.Stalled(id)
+	c.publish(events.Restarted, id, strm, "stalled")
+}
+
+// firstSegmentTail is the number of the last lines of the process output kept as the error of the streams without a first segment
+const firstSegmentTail = 5
+
+// watchFirstSegment fails the stream if its process does not write the first segment within the first segment timeout.
+// The process is killed and the stream is marked as errored with the end of its output, so it is only started explicitly
+func (c *Controller) watchFirstSegment(id string, strm *streaming.Stream) {
+	timeout := c.spec().FirstSegmentTimeout
+	if timeout <= 0 {
+		return
+	}
+	// The watch is over once the stream is stopped or replaced by another one
+	abandoned := func() bool {
+		current, ok := c.getStream(id)
+		return !ok || current != strm || strm.IsStopping()
+	}
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if strm.HasSegment() || abandoned() {
+				return
+			}
+		case <-deadline:
+			if strm.HasSegment() || abandoned() {
+				return
+			}
+			c.failFirstSegment(id, strm, timeout)
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// failFirstSegment kills the process of the stream that did not write its first segment and reports it as errored
+func (c *Controller) failFirstSegment(id string, strm *streaming.Stream, timeout time.Duration) {
+	tail := []string{}
+	if strm.Logs != nil {
+		tail = strm.Logs.Lines()
+	}
+	if len(tail) > firstSegmentTail {
+		tail = tail[len(tail)-firstSegmentTail:]
+	}
+	reason := ErrNoFirstSegmentFn(timeout, strings.Join(tail, "\n")).Error()
+	c.streamLog(strm).Errorf("%s is errored || Error: %s", id, reason)
+	// The stream is marked first, so the start waiting for it sees the reason once the process exits
+	strm.Fail(reason)
+	if err := strm.CleanProcess(); err != nil {
+		c.streamLog(strm).Error(err)
+	}
+	c.metrics.RemoveStream(id)
+	c.publish(events.Errored, id, strm, reason)
+	c.persist()
+}
+
+// firstSegmentError returns the error of the stream that was failed for not writing its first segment
+// or for the credentials refused by its source, nil otherwise
+func (c *Controller) firstSegmentError(id string) error {
+	strm, ok := c.getStream(id)
+	if !ok || !strm.IsErrored() {
+		return nil
+	}
+	if strm.AuthFailed() {
+		return streaming.ErrSourceAuthFailed
+	}
+	strm.Mux.RLock()
+	defer strm.Mux.RUnlock()
+	return errors.New(strm.LastError)
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+)
+
+func TestFirstSegment(t *testing.T) {
+	setup := func(manager func(ctrls *Controller) IManager) (*Controller, *events.Subscription, func()) {
+		spec := *config.InitConfig()
+		spec.FirstSegmentTimeout = time.Millisecond * 200
+		spec.StartTimeout = time.Second * 5
+		ctrls := NewController(&spec, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = manager(ctrls)
+		ctrls.processor = mockProcessor{}
+		sub := ctrls.events.Subscribe()
+		return ctrls, sub, func() {
+			ctrls.events.Unsubscribe(sub)
+			ctrls.Shutdown(context.Background())
+		}
+	}
+	start := func(ctrls *Controller, query string) (*httptest.ResponseRecorder, ErrorDto) {
+		b, _ := json.Marshal(StreamDto{URI: generateURI()})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start"+query, bytes.NewBuffer(b)), nil)
+		var errDto ErrorDto
+		json.Unmarshal(rr.Body.Bytes(), &errDto)
+		return rr, errDto
+	}
+	assertErrored := func(t *testing.T, ctrls *Controller, sub *events.Subscription) {
+		for {
+			select {
+			case event := <-sub.Events():
+				if event.Type != events.Errored {
+					continue
+				}
+				assert.Contains(t, event.Details, "No segment was written within 200ms")
+				assert.Len(t, ctrls.streams, 1)
+				for _, strm := range ctrls.snapshotStreams() {
+					assert.True(t, strm.IsErrored())
+					assert.True(t, strm.IsStopping())
+				}
+				return
+			case <-time.After(time.Second * 2):
+				t.Error("Errored event is not published")
+				return
+			}
+		}
+	}
+
+	t.Run("Should fail the start if the playlist is not written before the first segment timeout", func(t *testing.T) {
+		// The process of the stream exits once it is killed, like the ffmpeg ones
+		ctrls, sub, teardown := setup(func(ctrls *Controller) IManager {
+			instead := func(physicalPath string) chan bool {
+				ch := make(chan bool, 1)
+				go func() {
+					for ctrls.firstSegmentError(filepath.Base(filepath.Dir(physicalPath))) == nil {
+						<-time.After(time.Millisecond * 10)
+					}
+					ch <- false
+				}()
+				return ch
+			}
+			return mockManager{instead: &instead}
+		})
+		defer teardown()
+		started := time.Now()
+		rr, errDto := start(ctrls, "")
+		assert.True(t, time.Since(started) < time.Second*2)
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+		assert.Equal(t, "no_first_segment", errDto.Error.Code)
+		assertErrored(t, ctrls, sub)
+	})
+
+	t.Run("Should answer with the failure if it waits for the first segment", func(t *testing.T) {
+		ctrls, sub, teardown := setup(func(*Controller) IManager { return mockManager{resolve: true} })
+		defer teardown()
+		rr, errDto := start(ctrls, "?wait=true")
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+		assert.Equal(t, "no_first_segment", errDto.Error.Code)
+		assert.Contains(t, errDto.Error.Message, "No segment was written within 200ms")
+		assertErrored(t, ctrls, sub)
+	})
+
+	t.Run("Should answer right away and fail the stream later without waiting", func(t *testing.T) {
+		ctrls, sub, teardown := setup(func(*Controller) IManager { return mockManager{resolve: true} })
+		defer teardown()
+		rr, _ := start(ctrls, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assertErrored(t, ctrls, sub)
+		list := httptest.NewRecorder()
+		ctrls.ListStreamHandler(list, httptest.NewRequest(http.MethodGet, "/list", nil), nil)
+		assert.Contains(t, list.Body.String(), "No segment was written within 200ms")
+	})
+
+	t.Run("Should refuse the wait parameter if it is not a boolean", func(t *testing.T) {
+		ctrls, _, teardown := setup(func(*Controller) IManager { return mockManager{resolve: true} })
+		defer teardown()
+		rr, errDto := start(ctrls, "?wait=maybe")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "invalid_wait", errDto.Error.Code)
+	})
+}
+
+func TestStall(t *testing.T) {
+	spec := *config.InitConfig()
+	spec.StallTimeout = time.Second
+	spec.StallMaxRestarts = 2
+	// The processor of the service restarts the streams, their processes are not started without a transcoder
+	ctrls := NewController(&spec, WithFileServer(http.NotFoundHandler()))
+	sub := ctrls.events.Subscribe()
+	defer ctrls.Shutdown(context.Background())
+	defer ctrls.events.Unsubscribe(sub)
+	nextEvent := func() events.Event {
+		select {
+		case event := <-sub.Events():
+			return event
+		case <-time.After(time.Second * 2):
+			t.Error("Event is not published")
+			return events.Event{}
+		}
+	}
+
+	t.Run("Should restart the stalled processes until they stall too many times", func(t *testing.T) {
+		generated := generateStream(nil, "")
+		strm := &generated.strm
+		strm.StorePath, _ = ioutil.TempDir("", "stall")
+		defer os.RemoveAll(strm.StorePath)
+		strm.Streak.Activate()
+		ctrls.streams[generated.dirPath] = strm
+		ctrls.supervise(generated.dirPath, strm)
+		assert.Equal(t, time.Second, strm.StallTimeout)
+
+		for i := 0; i < 2; i++ {
+			ctrls.restartStalled(generated.dirPath, strm)
+			// The stall is published before its outcome
+			stalled := nextEvent()
+			assert.Equal(t, events.Stalled, stalled.Type)
+			assert.Equal(t, "no segment for 1s", stalled.Details)
+			event := nextEvent()
+			if !assert.Equal(t, events.Restarted, event.Type) || !assert.Equal(t, "stalled", event.Details) {
+				t.Error(fmt.Errorf("%d restart is failing for TestStall", i))
+			}
+			assert.True(t, strm.Streak.IsActive())
+		}
+		assert.Equal(t, 2, strm.StallRestarts)
+		assert.Equal(t, 0, strm.Restarts)
+		buf := &bytes.Buffer{}
+		assert.Nil(t, ctrls.metrics.Write(buf, 1))
+		assert.Contains(t, buf.String(), fmt.Sprintf("rtsp_stream_stall_restarts_total{stream=%q} 2\n", generated.dirPath))
+
+		ctrls.restartStalled(generated.dirPath, strm)
+		assert.Equal(t, events.Stalled, nextEvent().Type)
+		event := nextEvent()
+		assert.Equal(t, events.Errored, event.Type)
+		assert.Equal(t, "Process stopped writing segments 3 times within 10m0s", event.Details)
+		assert.True(t, strm.IsErrored())
+		assert.False(t, strm.Streak.IsActive())
+		assert.Equal(t, 2, strm.StallRestarts)
+
+		list := httptest.NewRecorder()
+		ctrls.ListStreamHandler(list, httptest.NewRequest(http.MethodGet, "/list", nil), nil)
+		assert.Contains(t, list.Body.String(), `"stallRestarts":2`)
+	})
+
+	t.Run("Should not restart the streams that were stopped", func(t *testing.T) {
+		generated := generateStream(nil, "")
+		strm := &generated.strm
+		ctrls.streams[generated.dirPath] = strm
+		assert.Nil(t, strm.Stop(context.Background(), true))
+		ctrls.restartStalled(generated.dirPath, strm)
+		assert.Equal(t, 0, strm.StallRestarts)
+		assert.False(t, strm.Streak.IsActive())
+	})
+}
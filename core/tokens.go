@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// issueToken gives the stream a new playback token if the tokens are enabled and it has none, like after its token was revoked.
+// The token is replaced if it has to be rotated
+func (c *Controller) issueToken(ctx context.Context, id string, strm *streaming.Stream, rotate bool) error {
+	if !c.spec().PlaybackTokens || (strm.GetPlaybackToken() != "" && !rotate) {
+		return nil
+	}
+	token, err := auth.NewPlaybackToken()
+	if err != nil {
+		return err
+	}
+	strm.SetPlaybackToken(token)
+	c.logger(ctx).Debugf("%s got a new playback token", id)
+	c.persist()
+	return nil
+}
+
+// checkPlaybackToken checks if the request has the playback token of the stream if the tokens are enabled.
+// Returns false if the request was refused and the error has been sent to the client
+func (c *Controller) checkPlaybackToken(w http.ResponseWriter, req *http.Request, id string, strm *streaming.Stream) bool {
+	if !c.spec().PlaybackTokens {
+		return true
+	}
+	if err := auth.VerifyPlaybackToken(req, strm.GetPlaybackToken()); err != nil {
+		c.logger(req.Context()).Errorf("%s could not be served, %s", id, err)
+		c.SendError(w, err, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// RevokeTokenHandler is the HTTP handler of the DELETE /stream/:id/token call. The files of the stream are refused
+// to every client until a new token is issued by starting the stream again or by restarting it
+func (c *Controller) RevokeTokenHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	strm, ok := c.getStream(id)
+	if !ok {
+		c.SendError(w, ErrNoStreamFn(id), http.StatusNotFound)
+		return
+	}
+	if !c.spec().PlaybackTokens {
+		c.SendError(w, ErrPlaybackTokensDisabled, http.StatusConflict)
+		return
+	}
+	strm.SetPlaybackToken("")
+	c.persist()
+	c.logger(r.Context()).Infof("Playback token of %s is revoked%s", id, requestedBy(apiKeyName(r)))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/auth"
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestPlaybackTokens(t *testing.T) {
+	setup := func(enabled, rotate bool) (*Controller, *httptest.Server, string) {
+		storeDir, _ := ioutil.TempDir("", "tokens")
+		conf := config.InitConfig()
+		conf.PlaybackTokens = enabled
+		conf.PlaybackRotate = rotate
+		ctrls := NewController(conf, WithFileServer(http.FileServer(http.Dir(storeDir))))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		router := httprouter.New()
+		router.POST("/start", ctrls.StartStreamHandler)
+		router.POST("/restart/:id", ctrls.RestartHandler)
+		router.GET("/stream/*filepath", ctrls.FileHandler)
+		router.DELETE("/stream/:id/token", ctrls.RevokeTokenHandler)
+		return ctrls, httptest.NewServer(router), storeDir
+	}
+	start := func(server *httptest.Server, dir, uri string) StreamDto {
+		b, _ := json.Marshal(StreamDto{URI: uri})
+		res, err := http.Post(fmt.Sprintf("%s/start", server.URL), "application/json", bytes.NewBuffer(b))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		var dto StreamDto
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&dto))
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, dto.ID), os.ModePerm))
+		playlist := "#EXTM3U\n#EXTINF:1.000000,\n0.ts\n"
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, dto.ID, "index.m3u8"), []byte(playlist), os.ModePerm))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, dto.ID, "0.ts"), []byte("segment"), os.ModePerm))
+		return dto
+	}
+	get := func(server *httptest.Server, path, query, header string) (int, string, string) {
+		if query != "" {
+			path = fmt.Sprintf("%s?token=%s", path, query)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if header != "" {
+			req.Header.Set(auth.PlaybackTokenHeader, header)
+		}
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(res.Body)
+		var errDto ErrorDto
+		json.Unmarshal(b, &errDto)
+		return res.StatusCode, errDto.Error.Code, string(b)
+	}
+
+	t.Run("Should only serve the files of the streams with their token", func(t *testing.T) {
+		ctrls, server, dir := setup(true, false)
+		defer os.RemoveAll(dir)
+		defer server.Close()
+		defer ctrls.Shutdown(context.Background())
+		dto := start(server, dir, generateURI())
+		other := start(server, dir, generateURI())
+		assert.Len(t, dto.Token, 64)
+		assert.NotEqual(t, dto.Token, other.Token)
+
+		tt := []struct {
+			Path   string
+			Query  string
+			Header string
+			Status int
+			Code   string
+		}{
+			{Path: dto.URI, Status: http.StatusForbidden, Code: "missing_playback_token"},
+			{Path: dto.URI, Query: other.Token, Status: http.StatusForbidden, Code: "invalid_playback_token"},
+			{Path: dto.URI, Header: other.Token, Status: http.StatusForbidden, Code: "invalid_playback_token"},
+			{Path: dto.URI, Query: dto.Token, Status: http.StatusOK},
+			{Path: dto.URI, Header: dto.Token, Status: http.StatusOK},
+			{Path: fmt.Sprintf("/stream/%s/0.ts", dto.ID), Header: dto.Token, Status: http.StatusOK},
+		}
+		for i, testCase := range tt {
+			status, code, _ := get(server, testCase.Path, testCase.Query, testCase.Header)
+			if !assert.Equal(t, testCase.Status, status) || !assert.Equal(t, testCase.Code, code) {
+				t.Error(fmt.Errorf("%d testcase is failing for serving the files with tokens", i))
+			}
+		}
+
+		// The segments of the playlists requested with the token in the query carry it as well
+		_, _, playlist := get(server, dto.URI, dto.Token, "")
+		assert.Equal(t, fmt.Sprintf("#EXTM3U\n#EXTINF:1.000000,\n0.ts?token=%s\n", dto.Token), playlist)
+		_, _, playlist = get(server, dto.URI, "", dto.Token)
+		assert.Equal(t, "#EXTM3U\n#EXTINF:1.000000,\n0.ts\n", playlist)
+	})
+
+	t.Run("Should refuse every client once the token is revoked", func(t *testing.T) {
+		ctrls, server, dir := setup(true, false)
+		defer os.RemoveAll(dir)
+		defer server.Close()
+		defer ctrls.Shutdown(context.Background())
+		uri := generateURI()
+		dto := start(server, dir, uri)
+		req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/stream/%s/token", server.URL, dto.ID), nil)
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		status, code, _ := get(server, dto.URI, dto.Token, "")
+		assert.Equal(t, http.StatusForbidden, status)
+		assert.Equal(t, "invalid_playback_token", code)
+
+		// Starting the stream again issues a new token
+		started := start(server, dir, uri)
+		assert.NotEmpty(t, started.Token)
+		assert.NotEqual(t, dto.Token, started.Token)
+		status, _, _ = get(server, dto.URI, started.Token, "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, started.Token, start(server, dir, uri).Token)
+	})
+
+	t.Run("Should rotate the tokens on restarts if it is enabled", func(t *testing.T) {
+		for _, rotate := range []bool{false, true} {
+			ctrls, server, dir := setup(true, rotate)
+			dto := start(server, dir, generateURI())
+			res, err := http.Post(fmt.Sprintf("%s/restart/%s", server.URL, dto.ID), "application/json", nil)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			var restarted StreamDto
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&restarted))
+			assert.NotEmpty(t, restarted.Token)
+			assert.Equal(t, rotate, dto.Token != restarted.Token)
+			server.Close()
+			ctrls.Shutdown(context.Background())
+			os.RemoveAll(dir)
+		}
+	})
+
+	t.Run("Should not issue tokens if they are disabled", func(t *testing.T) {
+		ctrls, server, dir := setup(false, false)
+		defer os.RemoveAll(dir)
+		defer server.Close()
+		defer ctrls.Shutdown(context.Background())
+		dto := start(server, dir, generateURI())
+		assert.Empty(t, dto.Token)
+		status, _, _ := get(server, dto.URI, "", "")
+		assert.Equal(t, http.StatusOK, status)
+		req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/stream/%s/token", server.URL, dto.ID), nil)
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+	})
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// expiryCheck is the period the streams are checked with for the end of their time to live
+const expiryCheck = time.Second
+
+// TTLDto describes the time to live of a stream given either as a number of seconds, like 600, or as a duration, like "10m"
+type TTLDto SecondsDto
+
+// UnmarshalJSON reads the time to live from a number or a duration
+func (t *TTLDto) UnmarshalJSON(b []byte) error {
+	var seconds SecondsDto
+	if err := seconds.UnmarshalJSON(b); err != nil || seconds < 0 {
+		return ErrInvalidTTL
+	}
+	*t = TTLDto(seconds)
+	return nil
+}
+
+// ExpiryDto describes the end of the time to live of a stream
+type ExpiryDto struct {
+	// ExpiresAt is the time the stream is removed at, ExpiresIn is the number of seconds left until then.
+	// Both are unset if the stream has no time to live
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	ExpiresIn *int       `json:"expiresIn,omitempty"`
+}
+
+// expiryDto describes the end of the time to live of the stream
+func (c *Controller) expiryDto(strm *streaming.Stream) ExpiryDto {
+	expiresAt := strm.GetExpiry()
+	if expiresAt.IsZero() {
+		return ExpiryDto{}
+	}
+	seconds := int(expiresAt.Sub(c.now()).Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	return ExpiryDto{ExpiresAt: &expiresAt, ExpiresIn: &seconds}
+}
+
+// expiryLoop removes the streams whose time to live is over until the service is shut down.
+// It runs regardless of the cleanup, the streams are removed even if they are watched
+func (c *Controller) expiryLoop() {
+	ticker := time.NewTicker(expiryCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.expireStreams()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// expireStreams stops and removes the streams whose time to live is over, like they were stopped by a client
+func (c *Controller) expireStreams() {
+	now := c.now()
+	for id, strm := range c.snapshotStreams() {
+		expiresAt := strm.GetExpiry()
+		if expiresAt.IsZero() || now.Before(expiresAt) {
+			continue
+		}
+		// The stream could have been stopped or started again meanwhile
+		if current, ok := c.getStream(id); !ok || current != strm {
+			continue
+		}
+		if _, ok := c.deleteStream(id); !ok {
+			continue
+		}
+		c.streamLog(strm).Infof("%s is getting removed, its time to live is over", id)
+		if err := c.removeStream(context.Background(), id, strm, c.spec().KeepRecordings); err != nil {
+			c.streamLog(strm).Error(err)
+		}
+		c.publish(events.Stopped, id, strm, "expired")
+	}
+}
+
+// isExpired indicates if the time to live of the stream stored with the given expiry is over
+func (c *Controller) isExpired(expiresAt *time.Time) bool {
+	return expiresAt != nil && !c.now().Before(*expiresAt)
+}
+
+// replaceTTL replaces the time to live of the stream with the given one, counted from now, or removes it if the new one is 0.
+// The transcoding is not affected
+func (c *Controller) replaceTTL(ctx context.Context, id string, strm *streaming.Stream, ttl TTLDto) ExpiryDto {
+	if ttl == 0 {
+		strm.SetExpiry(time.Time{})
+		c.logger(ctx).Infof("Time to live of %s is removed%s", id, requestedBy(apiKeyFromContext(ctx)))
+	} else {
+		strm.SetExpiry(c.now().Add(time.Duration(ttl) * time.Second))
+		c.logger(ctx).Infof("Time to live of %s is set to %ds%s", id, ttl, requestedBy(apiKeyFromContext(ctx)))
+	}
+	c.persist()
+	return c.expiryDto(strm)
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/Roverr/rtsp-stream/core/store"
+)
+
+func TestTTLDto(t *testing.T) {
+	tt := []struct {
+		JSON string
+		TTL  TTLDto
+		Err  error
+	}{
+		{JSON: `600`, TTL: 600},
+		{JSON: `"10m"`, TTL: 600},
+		{JSON: `0`, TTL: 0},
+		{JSON: `-5`, Err: ErrInvalidTTL},
+		{JSON: `"-1m"`, Err: ErrInvalidTTL},
+		{JSON: `"later"`, Err: ErrInvalidTTL},
+	}
+	for i, testCase := range tt {
+		var ttl TTLDto
+		err := json.Unmarshal([]byte(testCase.JSON), &ttl)
+		if !assert.Equal(t, testCase.Err, err) || !assert.Equal(t, testCase.TTL, ttl) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestTTLDto", i))
+		}
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	setup := func(t *testing.T) *testServer {
+		return newTestServer(t, nil, mockProcessor{}, func(router *httprouter.Router, ctrls *Controller) {
+			router.PATCH("/stream/:id", ctrls.PatchStreamHandler)
+		}, WithClock(func() time.Time { return clock() }))
+	}
+	patch := func(s *testServer, id, body string) (int, ExpiryDto) {
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("%s/stream/%s", s.server.URL, id), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		var dto ExpiryDto
+		json.NewDecoder(res.Body).Decode(&dto)
+		return res.StatusCode, dto
+	}
+	expiresIn := func(s *testServer) *int {
+		dto := s.list(t)
+		if !assert.Len(t, dto, 1) {
+			return nil
+		}
+		return dto[0].ExpiresIn
+	}
+
+	t.Run("Should remove the streams once their time to live is over", func(t *testing.T) {
+		s := setup(t)
+		defer s.close()
+		sub := s.ctrls.events.Subscribe()
+		defer s.ctrls.events.Unsubscribe(sub)
+		status, dto, _ := s.start(t, "", fmt.Sprintf(`{"uri": %q, "ttl": "10m"}`, generateURI()))
+		assert.Equal(t, http.StatusOK, status)
+		if remaining := expiresIn(s); assert.NotNil(t, remaining) {
+			assert.Equal(t, 600, *remaining)
+		}
+		strm, _ := s.ctrls.getStream(dto.ID)
+		strm.Touch()
+
+		now = now.Add(time.Minute * 9)
+		s.ctrls.expireStreams()
+		_, ok := s.ctrls.getStream(dto.ID)
+		assert.True(t, ok)
+
+		// The streams are removed even if they are watched
+		now = now.Add(time.Minute)
+		strm.Touch()
+		s.ctrls.expireStreams()
+		_, ok = s.ctrls.getStream(dto.ID)
+		assert.False(t, ok)
+		assert.False(t, strm.Streak.IsActive())
+		for {
+			select {
+			case event := <-sub.Events():
+				if event.Type != events.Stopped {
+					continue
+				}
+				assert.Equal(t, "expired", event.Details)
+			case <-time.After(time.Second * 2):
+				t.Error("Stopped event is not published")
+			}
+			break
+		}
+	})
+
+	t.Run("Should extend and remove the time to live", func(t *testing.T) {
+		s := setup(t)
+		defer s.close()
+		_, dto, _ := s.start(t, "", fmt.Sprintf(`{"uri": %q, "ttl": 60}`, generateURI()))
+
+		status, expiry := patch(s, dto.ID, `{"ttl": "1h"}`)
+		assert.Equal(t, http.StatusOK, status)
+		if assert.NotNil(t, expiry.ExpiresIn) && assert.NotNil(t, expiry.ExpiresAt) {
+			assert.Equal(t, 3600, *expiry.ExpiresIn)
+			assert.True(t, expiry.ExpiresAt.Equal(now.Add(time.Hour)))
+		}
+		now = now.Add(time.Minute * 2)
+		s.ctrls.expireStreams()
+		if remaining := expiresIn(s); assert.NotNil(t, remaining) {
+			assert.Equal(t, 3480, *remaining)
+		}
+
+		status, expiry = patch(s, dto.ID, `{"ttl": 0}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Nil(t, expiry.ExpiresIn)
+		assert.Nil(t, expiresIn(s))
+		now = now.Add(time.Hour * 2)
+		s.ctrls.expireStreams()
+		_, ok := s.ctrls.getStream(dto.ID)
+		assert.True(t, ok)
+	})
+
+	t.Run("Should refuse the invalid time to live", func(t *testing.T) {
+		s := setup(t)
+		defer s.close()
+		status, _, errDto := s.start(t, "", fmt.Sprintf(`{"uri": %q, "ttl": "soon"}`, generateURI()))
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_ttl", errDto.Error.Code)
+
+		_, dto, _ := s.start(t, "", fmt.Sprintf(`{"uri": %q}`, generateURI()))
+		tt := []struct {
+			ID     string
+			Body   string
+			Status int
+		}{
+			{ID: dto.ID, Body: `{"ttl": -1}`, Status: http.StatusBadRequest},
+			{ID: dto.ID, Body: `{}`, Status: http.StatusBadRequest},
+			{ID: "unknown", Body: `{"ttl": 60}`, Status: http.StatusNotFound},
+		}
+		for i, testCase := range tt {
+			if status, _ := patch(s, testCase.ID, testCase.Body); !assert.Equal(t, testCase.Status, status) {
+				t.Error(fmt.Errorf("%d testcase is failing for refusing the time to live", i))
+			}
+		}
+	})
+
+	t.Run("Should not recover the streams that expired while the service was down", func(t *testing.T) {
+		storeDir, _ := ioutil.TempDir("", "ttl")
+		defer os.RemoveAll(storeDir)
+		conf := config.InitConfig()
+		conf.Persistence = config.Persistence{Enabled: true, Path: filepath.Join(storeDir, "state", "streams.json"), PersistenceKey: persistenceKey}
+		past, future := now.Add(-time.Minute), now.Add(time.Hour)
+		expired := store.Record{ID: "expired", URI: generateURI(), Directory: filepath.Join(storeDir, "expired"), ExpiresAt: &past}
+		alive := store.Record{ID: "alive", URI: generateURI(), Directory: filepath.Join(storeDir, "alive"), ExpiresAt: &future}
+		for _, record := range []store.Record{expired, alive} {
+			assert.Nil(t, os.MkdirAll(record.Directory, os.ModePerm))
+		}
+		assert.Nil(t, newStore(conf.Persistence).Save([]store.Record{expired, alive}))
+
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()), WithClock(func() time.Time { return clock() }))
+		ctrls.processor = mockProcessor{}
+		ctrls.recoverStreams()
+		defer ctrls.Shutdown(context.Background())
+		_, ok := ctrls.getStream("expired")
+		assert.False(t, ok)
+		_, err := os.Stat(expired.Directory)
+		assert.True(t, os.IsNotExist(err))
+		strm, ok := ctrls.getStream("alive")
+		if assert.True(t, ok) {
+			assert.True(t, strm.GetExpiry().Equal(future))
+		}
+		records, err := newStore(conf.Persistence).Load()
+		assert.Nil(t, err)
+		if assert.Len(t, records, 1) && assert.NotNil(t, records[0].ExpiresAt) {
+			assert.True(t, records[0].ExpiresAt.Equal(future))
+		}
+	})
+}
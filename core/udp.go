@@ -0,0 +1,28 @@
+package core
+
+import "github.com/Roverr/rtsp-stream/core/streaming"
+
+// sdpSource sets the URI of the stream started from an SDP to the rtp:// URI read from the SDP, so its id has the address
+// and the port of the media. The scheme of the URI is checked like the ones of the other sources
+func sdpSource(dto *StreamDto) error {
+	if dto.SDP == "" {
+		return nil
+	}
+	if dto.URI != "" {
+		return ErrSDPWithURI
+	}
+	uri, err := streaming.SDPURI(dto.SDP)
+	if err != nil {
+		return err
+	}
+	dto.URI = uri
+	return nil
+}
+
+// sourceURI returns the normalized URI of the stream, the one of the streams started from an SDP is read from the SDP
+func (c *Controller) sourceURI(dto *StreamDto) (string, error) {
+	if err := sdpSource(dto); err != nil {
+		return "", err
+	}
+	return normalizeURI(dto.URI, c.spec().Schemes())
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartUDP(t *testing.T) {
+	const sdp = "v=0\r\no=- 0 0 IN IP4 192.168.0.10\r\ns=Feed\r\nc=IN IP4 239.0.0.1/32\r\nt=0 0\r\nm=video 5004 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n"
+	setup := func(enabled bool) *Controller {
+		conf := *config.InitConfig()
+		conf.UDPEnabled = enabled
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		return ctrls
+	}
+	start := func(ctrls *Controller, dto StreamDto) (int, ErrorDto) {
+		b, err := json.Marshal(dto)
+		assert.Nil(t, err)
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewReader(b)), nil)
+		var errDto ErrorDto
+		json.NewDecoder(rr.Body).Decode(&errDto)
+		return rr.Code, errDto
+	}
+
+	t.Run("Should start the multicast groups apart by their port", func(t *testing.T) {
+		ctrls := setup(true)
+		status, _ := start(ctrls, StreamDto{URI: "udp://239.0.0.1:5000"})
+		assert.Equal(t, http.StatusOK, status)
+		status, _ = start(ctrls, StreamDto{URI: "udp://239.0.0.1:5002"})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Len(t, ctrls.snapshotStreams(), 2)
+	})
+
+	t.Run("Should start the stream from the SDP by the URI of its media", func(t *testing.T) {
+		ctrls := setup(true)
+		status, _ := start(ctrls, StreamDto{SDP: sdp})
+		assert.Equal(t, http.StatusOK, status)
+		dir, err := streaming.GetURIDirectory("rtp://239.0.0.1:5004")
+		assert.Nil(t, err)
+		strm, ok := ctrls.getStream(dir)
+		if assert.True(t, ok) {
+			assert.Equal(t, sdp, strm.Options.SDP)
+		}
+	})
+
+	t.Run("Should refuse the sources while they are disabled", func(t *testing.T) {
+		for _, dto := range []StreamDto{{URI: "udp://239.0.0.1:5000"}, {SDP: sdp}} {
+			status, errDto := start(setup(false), dto)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, ErrUnsupportedScheme.Error(), errDto.Error.Message)
+		}
+	})
+
+	t.Run("Should refuse the invalid SDPs", func(t *testing.T) {
+		status, errDto := start(setup(true), StreamDto{URI: "rtp://239.0.0.1:5004", SDP: sdp})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_uri", errDto.Error.Code)
+		status, errDto = start(setup(true), StreamDto{SDP: "v=0\r\ns=Feed\r\n"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, ErrorBodyDto{"invalid_options", streaming.ErrInvalidSDP.Error(), ""}, errDto.Error)
+	})
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// defaultPorts are the ports the schemes use if the URI names none
+var defaultPorts = map[string]string{
+	"rtsp":  "554",
+	"rtsps": "322",
+	"rtmp":  "1935",
+	"rtmps": "443",
+	"http":  "80",
+	"https": "443",
+}
+
+// normalizeURI checks if the URI is an absolute one with one of the allowed schemes and a host. The scheme and the host
+// are lowercased and the default port of the scheme is dropped, so trivially different spellings belong to the same stream.
+// The credentials and the path are kept as they were sent
+func normalizeURI(uri string, schemes []string) (string, error) {
+	if uri == "" {
+		return "", ErrEmptyURI
+	}
+	if strings.IndexFunc(uri, unicode.IsSpace) >= 0 {
+		return "", ErrURIWhitespace
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", ErrInvalidURI
+	}
+	if !u.IsAbs() {
+		return "", ErrRelativeURI
+	}
+	// Local sources are not covered by the schemes, they are refused by the start if they are disabled
+	if u.Scheme == "file" {
+		return normalizeLocalURI(u)
+	}
+	allowed := false
+	for _, scheme := range schemes {
+		allowed = allowed || strings.ToLower(scheme) == u.Scheme
+	}
+	if !allowed {
+		return "", ErrUnsupportedScheme
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", ErrMissingHost
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	switch {
+	case port != "" && port != defaultPorts[u.Scheme]:
+		host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		host = "[" + host + "]"
+	}
+	// The authority is replaced in the original text, so the escaping of the credentials and the path is not changed
+	rest := uri[len(u.Scheme)+len("://"):]
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	userinfo := rest[:strings.LastIndex(rest[:end], "@")+1]
+	return u.Scheme + "://" + userinfo + host + rest[end:], nil
+}
+
+// joinCredentials puts the username and the password into the userinfo of the normalized URI, escaped, replacing the credentials
+// the URI carries. Returns the URI with the credentials, the URI without any and if the URI had credentials of its own
+func joinCredentials(uri, username, password string) (source, bare string, embedded bool) {
+	scheme := uri[:strings.Index(uri, "://")+len("://")]
+	rest := uri[len(scheme):]
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	at := strings.LastIndex(rest[:end], "@")
+	bare = scheme + rest[at+1:]
+	userinfo := url.User(username)
+	if password != "" {
+		userinfo = url.UserPassword(username, password)
+	}
+	return scheme + userinfo.String() + "@" + rest[at+1:], bare, at >= 0
+}
+
+// normalizeLocalURI checks if the file:// URI names an absolute path of the host itself. The path is cleaned,
+// so the same file cannot be started under different spellings
+func normalizeLocalURI(u *url.URL) (string, error) {
+	if u.Opaque != "" || (u.Host != "" && u.Host != "localhost") || !path.IsAbs(u.Path) {
+		return "", ErrInvalidLocalPath
+	}
+	return (&url.URL{Scheme: "file", Path: path.Clean(u.Path)}).String(), nil
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// usageTracker keeps the disk usage of the streams, so the directories are not scanned on every request.
+// The store is scanned once at boot and by every cleanup, the directory of a stream is scanned again
+// whenever its process writes a segment and once its files are removed
+type usageTracker struct {
+	mux     *sync.RWMutex
+	usages  map[string]streamUsage
+	scanned bool
+}
+
+// newUsageTracker creates a new tracker, its usage is scanned on the first use
+func newUsageTracker() *usageTracker {
+	return &usageTracker{&sync.RWMutex{}, map[string]streamUsage{}, false}
+}
+
+// reset replaces the usage of every stream with the scanned one
+func (t *usageTracker) reset(usages []streamUsage) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.usages = map[string]streamUsage{}
+	for _, usage := range usages {
+		t.usages[usage.id] = usage
+	}
+	t.scanned = true
+}
+
+// set replaces the usage of a given stream, streams without any files are dropped
+func (t *usageTracker) set(usage streamUsage) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if len(usage.segments) == 0 && len(usage.recordings) == 0 {
+		delete(t.usages, usage.id)
+		return
+	}
+	t.usages[usage.id] = usage
+}
+
+// all returns the usage of every stream sorted by their id
+func (t *usageTracker) all() []streamUsage {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	result := []streamUsage{}
+	for _, usage := range t.usages {
+		result = append(result, usage)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result
+}
+
+// storeSize returns the number of bytes used by the files in the store, the recordings are stored elsewhere
+func (t *usageTracker) storeSize() int64 {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	size := int64(0)
+	for _, usage := range t.usages {
+		size += sumSize(usage.segments)
+	}
+	return size
+}
+
+// isScanned indicates if the store was scanned already
+func (t *usageTracker) isScanned() bool {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	return t.scanned
+}
+
+// usages returns the tracked usage of every stream, the store is scanned if it has not been yet
+func (c *Controller) usages() []streamUsage {
+	if !c.usage.isScanned() {
+		c.usage.reset(c.storageUsage())
+	}
+	return c.usage.all()
+}
+
+// refreshUsage scans the files of the given stream again, then trims the store if it is above its limit
+func (c *Controller) refreshUsage(id string) {
+	if !c.usage.isScanned() {
+		c.usage.reset(c.storageUsage())
+	} else {
+		c.usage.set(c.scanStream(id))
+	}
+	if c.isStoreFull() {
+		go c.trimStore()
+	}
+}
+
+// scanStream scans the segments and the recordings of the given stream
+func (c *Controller) scanStream(id string) streamUsage {
+	strm, ok := c.getStream(id)
+	return c.withWindow(streamUsage{
+		id:         id,
+		segments:   scanSegments(c.storePathOf(id)),
+		recordings: scanRecordings(filepath.Join(c.spec().RecordingsDir, id), ok && strm.IsRecording()),
+	})
+}
+
+// storeLimit returns the number of bytes the files in the store can use, 0 if there is no limit
+func (c *Controller) storeLimit() int64 {
+	return int64(c.spec().RetentionStoreLimit) * megabyte
+}
+
+// isStoreFull indicates if the files in the store reached its limit
+func (c *Controller) isStoreFull() bool {
+	limit := c.storeLimit()
+	return limit > 0 && c.usage.storeSize() >= limit
+}
+
+// trimStore deletes the oldest segments of the streams until the store is below its limit.
+// Only one trimming runs at a time, the ones requested meanwhile are dropped
+func (c *Controller) trimStore() {
+	if !atomic.CompareAndSwapInt32(&c.trimming, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.trimming, 0)
+	usages := c.usages()
+	// The segments are not always named after the stream, the layout of the stream decides where they are
+	owners := map[string]string{}
+	for _, usage := range usages {
+		for _, file := range usage.segments {
+			owners[file.path] = usage.id
+		}
+	}
+	trimmed := map[string]bool{}
+	for _, file := range trimmedSegments(usages, c.storeLimit()) {
+		c.log.Debugf("%s is deleted, the store reached its limit", file.path)
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			c.log.Error(err)
+		}
+		trimmed[owners[file.path]] = true
+	}
+	for id := range trimmed {
+		c.usage.set(c.scanStream(id))
+	}
+	if c.isStoreFull() {
+		c.log.Warnf("Store is still above its limit of %d bytes, only the protected files are left", c.storeLimit())
+	}
+}
+
+// trimmedSegments returns the oldest deletable segments of every stream, which have to be deleted for
+// the files in the store to use less than the limit
+func trimmedSegments(usages []streamUsage, limit int64) []storedFile {
+	if limit <= 0 {
+		return []storedFile{}
+	}
+	total := int64(0)
+	deletable := []storedFile{}
+	for _, usage := range usages {
+		total += sumSize(usage.segments)
+		for _, file := range usage.segments {
+			if !file.protected {
+				deletable = append(deletable, file)
+			}
+		}
+	}
+	sortByAge(deletable)
+	trimmed := []storedFile{}
+	for _, file := range deletable {
+		if total < limit {
+			break
+		}
+		trimmed = append(trimmed, file)
+		total -= file.size
+	}
+	return trimmed
+}
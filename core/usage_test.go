@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestTrimmedSegments(t *testing.T) {
+	now := time.Now()
+	usages := []streamUsage{
+		{id: "a", segments: []storedFile{
+			{"a/0.ts", 40, now.Add(-time.Minute * 3), false},
+			{"a/index.m3u8", 10, now, true},
+		}},
+		{id: "b", segments: []storedFile{
+			{"b/0.ts", 40, now.Add(-time.Minute * 2), false},
+			{"b/1.ts", 40, now, true},
+		}, recordings: []storedFile{{"b/0.mp4", 500, now.Add(-time.Hour), false}}},
+	}
+	type testCase struct {
+		Limit    int64
+		Expected []string
+	}
+	tt := []testCase{
+		{Limit: 0, Expected: []string{}},
+		{Limit: 200, Expected: []string{}},
+		{Limit: 120, Expected: []string{"a/0.ts"}},
+		{Limit: 90, Expected: []string{"a/0.ts", "b/0.ts"}},
+		{Limit: 10, Expected: []string{"a/0.ts", "b/0.ts"}},
+	}
+	for i, testCase := range tt {
+		paths := []string{}
+		for _, file := range trimmedSegments(usages, testCase.Limit) {
+			paths = append(paths, file.path)
+		}
+		if !assert.Equal(t, testCase.Expected, paths) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestTrimmedSegments", i))
+		}
+	}
+}
+
+func TestStoreLimit(t *testing.T) {
+	root, err := ioutil.TempDir("", "usage")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	conf := *config.InitConfig()
+	conf.StoreDir = filepath.Join(root, "videos")
+	conf.RecordingsDir = filepath.Join(root, "recordings")
+	conf.RetentionStoreLimit = 1
+	ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+	ctrls.manager = mockManager{resolve: true}
+	ctrls.processor = mockProcessor{}
+
+	now := time.Now()
+	dir := filepath.Join(conf.StoreDir, "id")
+	assert.Nil(t, os.MkdirAll(dir, os.ModePerm))
+	writeAged(t, filepath.Join(dir, "0.ts"), int(megabyte), now.Add(-time.Minute*2))
+	writeAged(t, filepath.Join(dir, "1.ts"), 100, now.Add(-time.Minute))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U\n#EXTINF:1.0,\n1.ts\n"), 0644))
+	storage := func() StorageDto {
+		rr := httptest.NewRecorder()
+		ctrls.StorageHandler(rr, httptest.NewRequest(http.MethodGet, "/storage", nil), nil)
+		var dto StorageDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &dto))
+		return dto
+	}
+
+	t.Run("Should scan the store once and track it afterwards", func(t *testing.T) {
+		ctrls.Start()
+		defer ctrls.Stop()
+		dto := storage()
+		assert.Equal(t, megabyte+100+26, dto.Store)
+		assert.Equal(t, megabyte, dto.Limits.StoreSize)
+		// Files are not scanned again by the requests
+		writeAged(t, filepath.Join(dir, "2.ts"), 100, now)
+		assert.Equal(t, megabyte+100+26, storage().Store)
+	})
+
+	t.Run("Should refuse new streams while the store is full", func(t *testing.T) {
+		b, _ := json.Marshal(StreamDto{URI: generateURI()})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+		var errDto ErrorDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &errDto))
+		assert.Equal(t, "storage_full", errDto.Error.Code)
+	})
+
+	t.Run("Should trim the oldest segments once a stream writes a segment", func(t *testing.T) {
+		ctrls.refreshUsage("id")
+		assert.True(t, waitUntil(func() bool {
+			_, err := os.Stat(filepath.Join(dir, "0.ts"))
+			return os.IsNotExist(err)
+		}, time.Second*2))
+		assert.True(t, waitUntil(func() bool { return !ctrls.isStoreFull() }, time.Second*2))
+		// The segments listed by the playlist and the new ones are kept
+		for _, name := range []string{"1.ts", "2.ts", "index.m3u8"} {
+			_, err := os.Stat(filepath.Join(dir, name))
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, int64(226), storage().Store)
+
+		b, _ := json.Marshal(StreamDto{URI: generateURI()})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The build metadata of the service, injected at build time like
+// go build -ldflags "-X github.com/Roverr/rtsp-stream/core.Version=v2.1.0 -X github.com/Roverr/rtsp-stream/core.Commit=$(git rev-parse --short HEAD)"
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildDate = "dev"
+)
+
+// ffmpegDetectTimeout is the time ffmpeg -version can take before the version is reported as unavailable
+const ffmpegDetectTimeout = time.Second * 5
+
+// VersionDto describes the build of the service and the version of ffmpeg it runs
+type VersionDto struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	FFmpeg    string `json:"ffmpeg"`
+}
+
+// versionInfo returns the build of the service, ffmpeg is unavailable until it is detected
+func (c *Controller) versionInfo() VersionDto {
+	ffmpeg, _ := c.ffmpeg.Load().(string)
+	return VersionDto{Version, Commit, BuildDate, runtime.Version(), ffmpeg}
+}
+
+// detectFFmpeg captures the version of ffmpeg once and logs the build of the service with it.
+// It is run in the background by Start, so a missing or hanging binary does not hold up the startup
+func (c *Controller) detectFFmpeg() {
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegDetectTimeout)
+	defer cancel()
+	c.ffmpeg.Store(streaming.FFmpegVersion(ctx, c.spec().FFmpegPath))
+	info := c.versionInfo()
+	c.log.Infof("RTSP-STREAM %s (commit %s, built %s, %s) runs ffmpeg %s", info.Version, info.Commit, info.BuildDate, info.GoVersion, info.FFmpeg)
+}
+
+// VersionHandler is the HTTP handler of the /version call
+func (c *Controller) VersionHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !c.isAuthenticated(w, r) {
+		return
+	}
+	b, _ := json.Marshal(c.versionInfo())
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(b)
+}
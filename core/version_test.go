@@ -0,0 +1,55 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+func TestVersionHandler(t *testing.T) {
+	version := func(ctrls *Controller) VersionDto {
+		rr := httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var dto VersionDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &dto))
+		return dto
+	}
+
+	t.Run("Should report ffmpeg as unavailable if the binary is missing", func(t *testing.T) {
+		conf := *config.InitConfig()
+		conf.FFmpegPath = "/not/existing/ffmpeg"
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		defer ctrls.Shutdown(context.Background())
+		assert.Equal(t, VersionDto{"dev", "dev", "dev", runtime.Version(), streaming.FFmpegUnavailable}, version(ctrls))
+		ctrls.detectFFmpeg()
+		assert.Equal(t, streaming.FFmpegUnavailable, version(ctrls).FFmpeg)
+	})
+
+	t.Run("Should detect the version of ffmpeg in the background once started", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "version")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		binary := filepath.Join(dir, "ffmpeg")
+		script := "#!/bin/sh\necho 'ffmpeg version 4.2.2 Copyright (c) 2000-2019 the FFmpeg developers'\n"
+		assert.Nil(t, ioutil.WriteFile(binary, []byte(script), 0755))
+		conf := *config.InitConfig()
+		conf.FFmpegPath = binary
+		ctrls := NewController(&conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.Start()
+		defer ctrls.Shutdown(context.Background())
+		assert.True(t, waitUntil(func() bool { return version(ctrls).FFmpeg == "4.2.2" }, time.Second*2))
+	})
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// viewerTracker counts the distinct clients requesting the playlists of the streams within a sliding window.
+// The number of tracked sessions is bounded, so clients making up sessions cannot exhaust the memory
+type viewerTracker struct {
+	mux      *sync.Mutex
+	sessions map[string]map[uint64]time.Time // Last playlist request of the sessions, keyed by the stream
+	total    int
+	peaks    map[string]int
+	last     map[string]time.Time // Last playlist request of any session of the stream
+	ignored  []*net.IPNet         // Addresses of the clients that are not viewers
+}
+
+// newViewerTracker creates a new instance of viewerTracker, the clients of the ignored networks are not counted
+func newViewerTracker(ignored []*net.IPNet) *viewerTracker {
+	return &viewerTracker{&sync.Mutex{}, map[string]map[uint64]time.Time{}, 0, map[string]int{}, map[string]time.Time{}, ignored}
+}
+
+// viewerKey returns the key of the session of the client, the session query parameter if it is given,
+// the address and the user agent of the client otherwise. They are hashed, so long values are not kept
+func viewerKey(r *http.Request, ip string) uint64 {
+	h := fnv.New64a()
+	if session := r.URL.Query().Get("session"); session != "" {
+		h.Write([]byte("session\x00" + session))
+	} else {
+		h.Write([]byte(ip + "\x00" + r.UserAgent()))
+	}
+	return h.Sum64()
+}
+
+// see records the playlist request of the session of the stream and updates its peak.
+// max is the number of sessions tracked at the same time
+func (t *viewerTracker) see(stream string, key uint64, now time.Time, window time.Duration, max int) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	sessions, ok := t.sessions[stream]
+	if !ok {
+		sessions = map[uint64]time.Time{}
+		t.sessions[stream] = sessions
+	}
+	if _, ok := sessions[key]; !ok {
+		t.evict(now, window, max)
+		t.total++
+	}
+	sessions[key] = now
+	t.last[stream] = now
+	if current := t.expire(stream, now, window); current > t.peaks[stream] {
+		t.peaks[stream] = current
+	}
+}
+
+// evict makes room for a new session if the limit of tracked sessions is reached. The expired sessions
+// are dropped first, then the one that has not been seen for the longest time. Real viewers request
+// their playlist again and again, so the sessions seen only once are dropped before them
+func (t *viewerTracker) evict(now time.Time, window time.Duration, max int) {
+	if t.total < max {
+		return
+	}
+	var oldestStream string
+	var oldestKey uint64
+	var oldest time.Time
+	for stream := range t.sessions {
+		t.expire(stream, now, window)
+		for key, seen := range t.sessions[stream] {
+			if oldest.IsZero() || seen.Before(oldest) {
+				oldestStream, oldestKey, oldest = stream, key, seen
+			}
+		}
+	}
+	if t.total >= max && !oldest.IsZero() {
+		delete(t.sessions[oldestStream], oldestKey)
+		t.total--
+	}
+}
+
+// expire drops the sessions of the stream that were not seen within the window, returns the number of the remaining ones
+func (t *viewerTracker) expire(stream string, now time.Time, window time.Duration) int {
+	sessions := t.sessions[stream]
+	for key, seen := range sessions {
+		if now.Sub(seen) > window {
+			delete(sessions, key)
+			t.total--
+		}
+	}
+	return len(sessions)
+}
+
+// viewers returns the number of sessions of the stream seen within the window and the most seen at the same time
+func (t *viewerTracker) viewers(stream string, now time.Time, window time.Duration) (int, int) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.expire(stream, now, window), t.peaks[stream]
+}
+
+// remove drops the sessions and the peak of the stream
+func (t *viewerTracker) remove(stream string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.total -= len(t.sessions[stream])
+	delete(t.sessions, stream)
+	delete(t.peaks, stream)
+	delete(t.last, stream)
+}
+
+// lastSeen returns the last time a session of the stream was seen, the zero time if it has not been watched
+func (t *viewerTracker) lastSeen(stream string) time.Time {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.last[stream]
+}
+
+// isIgnored indicates if the address belongs to a client that is not a viewer
+func (t *viewerTracker) isIgnored(ip net.IP) bool {
+	for _, network := range t.ignored {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isViewer indicates if the client of the request counts as a viewer. The clients with an ignored
+// address or a user agent containing one of the ignored ones, like health checks, do not
+func (c *Controller) isViewer(r *http.Request) bool {
+	if c.viewers.isIgnored(c.current().access.ClientIP(r)) {
+		return false
+	}
+	agent := strings.ToLower(r.UserAgent())
+	for _, ignored := range c.spec().IgnoredAgents {
+		if ignored != "" && strings.Contains(agent, strings.ToLower(ignored)) {
+			return false
+		}
+	}
+	return true
+}
+
+// watched records the playlist request of the client as a viewer of the stream, unless it is ignored
+func (c *Controller) watched(id string, r *http.Request) {
+	if !c.isViewer(r) {
+		return
+	}
+	spec := c.spec()
+	key := viewerKey(r, c.clientAddress(r))
+	c.viewers.see(id, key, c.now(), spec.ViewerWindow, spec.ViewerMaxSessions)
+}
+
+// streamViewers returns the current and the peak number of viewers of the stream
+func (c *Controller) streamViewers(id string) (int, int) {
+	return c.viewers.viewers(id, c.now(), c.spec().ViewerWindow)
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+)
+
+func TestViewerKey(t *testing.T) {
+	request := func(target, agent string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("User-Agent", agent)
+		return r
+	}
+	base := viewerKey(request("/stream/id/index.m3u8", "VLC/3.0"), "203.0.113.9")
+	tt := []struct {
+		Request *http.Request
+		IP      string
+		Same    bool
+	}{
+		{Request: request("/stream/id/index.m3u8", "VLC/3.0"), IP: "203.0.113.9", Same: true},
+		{Request: request("/stream/id/720p/index.m3u8", "VLC/3.0"), IP: "203.0.113.9", Same: true},
+		{Request: request("/stream/id/index.m3u8", "Safari"), IP: "203.0.113.9", Same: false},
+		{Request: request("/stream/id/index.m3u8", "VLC/3.0"), IP: "203.0.113.10", Same: false},
+		{Request: request("/stream/id/index.m3u8?session=abc", "VLC/3.0"), IP: "203.0.113.9", Same: false},
+	}
+	for i, testCase := range tt {
+		if !assert.Equal(t, testCase.Same, viewerKey(testCase.Request, testCase.IP) == base) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestViewerKey", i))
+		}
+	}
+	// The same session is one viewer from every address
+	assert.Equal(t, viewerKey(request("/?session=abc", "VLC/3.0"), "203.0.113.9"), viewerKey(request("/?session=abc", "Safari"), "198.51.100.1"))
+}
+
+func TestViewerTracker(t *testing.T) {
+	now := time.Now()
+	window := 30 * time.Second
+
+	t.Run("Should count the sessions within the window and keep the peak", func(t *testing.T) {
+		tracker := newViewerTracker(nil)
+		tracker.see("first", 1, now, window, 100)
+		tracker.see("first", 2, now.Add(10*time.Second), window, 100)
+		tracker.see("first", 1, now.Add(20*time.Second), window, 100)
+		tracker.see("second", 1, now.Add(20*time.Second), window, 100)
+		current, peak := tracker.viewers("first", now.Add(20*time.Second), window)
+		assert.Equal(t, 2, current)
+		assert.Equal(t, 2, peak)
+		current, peak = tracker.viewers("first", now.Add(45*time.Second), window)
+		assert.Equal(t, 1, current)
+		assert.Equal(t, 2, peak)
+		current, peak = tracker.viewers("first", now.Add(time.Minute), window)
+		assert.Equal(t, 0, current)
+		assert.Equal(t, 2, peak)
+		current, _ = tracker.viewers("second", now.Add(time.Minute), window)
+		assert.Equal(t, 0, current)
+		assert.Equal(t, 0, tracker.total)
+	})
+
+	t.Run("Should bound the sessions and drop the least recently seen ones", func(t *testing.T) {
+		tracker := newViewerTracker(nil)
+		// The real viewers keep requesting the playlist while the made up sessions are only seen once
+		for i := 0; i < 1000; i++ {
+			at := now.Add(time.Duration(i) * time.Millisecond)
+			tracker.see("first", 1, at, window, 10)
+			tracker.see("first", 2, at, window, 10)
+			tracker.see("first", uint64(100+i), at, window, 10)
+		}
+		assert.Equal(t, 10, tracker.total)
+		assert.Len(t, tracker.sessions["first"], 10)
+		at := now.Add(time.Second)
+		_, seenFirst := tracker.sessions["first"][1]
+		_, seenSecond := tracker.sessions["first"][2]
+		assert.True(t, seenFirst)
+		assert.True(t, seenSecond)
+		current, peak := tracker.viewers("first", at, window)
+		assert.Equal(t, 10, current)
+		assert.Equal(t, 10, peak)
+	})
+
+	t.Run("Should forget the removed streams", func(t *testing.T) {
+		tracker := newViewerTracker(nil)
+		tracker.see("first", 1, now, window, 100)
+		tracker.remove("first")
+		current, peak := tracker.viewers("first", now, window)
+		assert.Equal(t, 0, current)
+		assert.Equal(t, 0, peak)
+		assert.Equal(t, 0, tracker.total)
+	})
+}
+
+func TestViewers(t *testing.T) {
+	t.Run("Should count the clients requesting the playlist of the stream", func(t *testing.T) {
+		now := time.Now()
+		spec := config.InitConfig()
+		spec.ListEndpoint = true
+		ctrls := NewController(spec, WithFileServer(http.NotFoundHandler()), WithClock(func() time.Time { return now }))
+		defer ctrls.Shutdown(context.Background())
+		generated := generateStream(nil, "")
+		generated.strm.Streak.Activate()
+		ctrls.streams[generated.dirPath] = &generated.strm
+		params := httprouter.Params{{Key: "filepath", Value: "/" + generated.dirPath + "/index.m3u8"}}
+		for _, agent := range []string{"VLC/3.0", "Safari", "VLC/3.0"} {
+			r := httptest.NewRequest(http.MethodGet, "/stream/"+generated.dirPath+"/index.m3u8", nil)
+			r.Header.Set("User-Agent", agent)
+			ctrls.FileHandler(httptest.NewRecorder(), r, params)
+		}
+		// Segments do not count as watching
+		segment := httptest.NewRequest(http.MethodGet, "/stream/"+generated.dirPath+"/0.ts", nil)
+		segment.Header.Set("User-Agent", "curl")
+		ctrls.FileHandler(httptest.NewRecorder(), segment, httprouter.Params{{Key: "filepath", Value: "/" + generated.dirPath + "/0.ts"}})
+
+		rr := httptest.NewRecorder()
+		ctrls.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status/"+generated.dirPath, nil), httprouter.Params{{Key: "id", Value: generated.dirPath}})
+		var status StatusDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		assert.Equal(t, 2, status.Viewers)
+		assert.Equal(t, 2, status.PeakViewers)
+
+		now = now.Add(spec.ViewerWindow + time.Second)
+		rr = httptest.NewRecorder()
+		ctrls.ListStreamHandler(rr, httptest.NewRequest(http.MethodGet, "/list", nil), nil)
+		var list []SummariseDto
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		assert.Len(t, list, 1)
+		assert.Equal(t, 0, list[0].Viewers)
+		assert.Equal(t, 2, list[0].PeakViewers)
+
+		rr = httptest.NewRecorder()
+		ctrls.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil), nil)
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf("rtsp_stream_peak_viewers{stream=%q} 2\n", generated.dirPath))
+	})
+}
@@ -0,0 +1,143 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/sirupsen/logrus"
+)
+
+// SignatureHeader is the header carrying the HMAC-SHA256 signature of the payload if a secret is configured
+const SignatureHeader = "X-RTSP-Stream-Signature"
+
+// ErrDeliveryFn is used to create dynamic errors for webhooks answering with an unsuccessful status
+var ErrDeliveryFn = func(url string, status int) error {
+	return fmt.Errorf("Webhook %s responded with %d", url, status)
+}
+
+// Payload describes the body posted to the webhooks
+type Payload struct {
+	Event     events.Type `json:"event"`
+	StreamID  string      `json:"streamID"`
+	URI       string      `json:"uri"`
+	Timestamp time.Time   `json:"timestamp"`
+	Details   string      `json:"details,omitempty"`
+	APIKey    string      `json:"apiKey,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// Notifier posts the lifecycle events of the streams to the configured webhooks
+type Notifier struct {
+	urls     []string
+	secret   string
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+// NewNotifier creates a new instance of Notifier
+func NewNotifier(spec config.Webhooks) *Notifier {
+	urls := []string{}
+	for _, url := range spec.WebhookURLs {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	attempts := spec.WebhookAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Notifier{
+		urls,
+		spec.WebhookSecret,
+		&http.Client{Timeout: spec.WebhookTimeout},
+		attempts,
+		spec.WebhookBackoff,
+	}
+}
+
+// Enabled indicates if there is any webhook to notify
+func (n *Notifier) Enabled() bool {
+	return len(n.urls) > 0
+}
+
+// Sign returns the value of the signature header of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run delivers the events of the subscription one by one until it is closed.
+// Retries waiting for their backoff are abandoned when done is closed
+func (n *Notifier) Run(sub *events.Subscription, done <-chan struct{}) {
+	for event := range sub.Events() {
+		n.Notify(event, done)
+	}
+}
+
+// Notify posts the event to every webhook, failed deliveries are logged and dropped
+func (n *Notifier) Notify(event events.Event, done <-chan struct{}) {
+	var log logrus.FieldLogger = logrus.StandardLogger()
+	if event.RequestID != "" {
+		log = log.WithField("requestId", event.RequestID)
+	}
+	body, err := json.Marshal(Payload{event.Type, event.StreamID, event.URI, event.Timestamp, event.Details, event.APIKey, event.RequestID})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, url := range n.urls {
+		if err := n.deliver(log, url, body, done); err != nil {
+			log.Errorf("%s event of %s could not be delivered to %s || Error: %s", event.Type, event.StreamID, url, err)
+		}
+	}
+}
+
+// deliver posts the body to the webhook, retrying with exponential backoff
+func (n *Notifier) deliver(log logrus.FieldLogger, url string, body []byte, done <-chan struct{}) error {
+	delay := n.backoff
+	for attempt := 1; ; attempt++ {
+		err := n.send(url, body)
+		if err == nil || attempt >= n.attempts {
+			return err
+		}
+		log.Debugf("Delivery to %s failed, attempt %d || Error: %s", url, attempt, err)
+		select {
+		case <-time.After(delay):
+		case <-done:
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// send posts the body to the webhook once
+func (n *Notifier) send(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.secret, body))
+	}
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return ErrDeliveryFn(url, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestNewNotifier(t *testing.T) {
+	assert.False(t, NewNotifier(config.Webhooks{WebhookURLs: []string{""}}).Enabled())
+	assert.True(t, NewNotifier(config.Webhooks{WebhookURLs: []string{"http://localhost"}}).Enabled())
+}
+
+func TestNotify(t *testing.T) {
+	spec := config.Webhooks{
+		WebhookSecret:   "secret",
+		WebhookTimeout:  time.Millisecond * 100,
+		WebhookAttempts: 3,
+		WebhookBackoff:  time.Millisecond,
+	}
+	event := events.New(events.Started, "id", "/stream/id/index.m3u8", "")
+
+	t.Run("Should post the signed payload of the event", func(t *testing.T) {
+		var payload Payload
+		var signature string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			signature = r.Header.Get(SignatureHeader)
+			assert.Equal(t, Sign("secret", body), signature)
+			assert.Nil(t, json.Unmarshal(body, &payload))
+		}))
+		defer server.Close()
+		conf := spec
+		conf.WebhookURLs = []string{server.URL}
+		NewNotifier(conf).Notify(event, nil)
+		assert.Equal(t, events.Started, payload.Event)
+		assert.Equal(t, "id", payload.StreamID)
+		assert.Equal(t, "/stream/id/index.m3u8", payload.URI)
+		assert.NotEmpty(t, signature)
+	})
+
+	t.Run("Should retry the failed deliveries", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer server.Close()
+		conf := spec
+		conf.WebhookURLs = []string{server.URL}
+		NewNotifier(conf).Notify(event, nil)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Should give up after the attempts and time out the slow webhooks", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			<-time.After(time.Millisecond * 300)
+		}))
+		defer server.Close()
+		conf := spec
+		conf.WebhookURLs = []string{server.URL}
+		started := time.Now()
+		NewNotifier(conf).Notify(event, nil)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		assert.True(t, time.Since(started) < time.Millisecond*900)
+	})
+
+	t.Run("Should abandon the retries when done is closed", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+		conf := spec
+		conf.WebhookURLs = []string{server.URL}
+		conf.WebhookBackoff = time.Hour
+		done := make(chan struct{})
+		close(done)
+		NewNotifier(conf).Notify(event, done)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
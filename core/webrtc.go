@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/Roverr/rtsp-stream/core/whep"
+)
+
+// maxOfferSize is the largest SDP offer accepted by the WHEP endpoint
+const maxOfferSize = 64 * 1024
+
+// answerTimeout is the time the negotiation of a WebRTC session can take, the gathering of its candidates included
+const answerTimeout = 10 * time.Second
+
+// isH264 indicates if the MPEG-TS output of the stream carries H.264 video, which is the only codec sent over WebRTC.
+// The video is copied into the output unless the stream is transcoded, so the codec of the source decides it
+func isH264(opts streaming.Options) bool {
+	if opts.Mode == streaming.ModeTranscode || len(opts.Renditions) > 0 {
+		return true
+	}
+	return opts.Source == nil || opts.Source.Video == "" || opts.Source.Video == "h264"
+}
+
+// WHEPHandler is the HTTP handler of the POST /whep/:id calls. It negotiates a WebRTC session playing the stream
+// from the SDP offer of the body and responds with the SDP answer, the session can be ended with the URL of its Location.
+// The video is taken from the running transcoding, the inactive streams are restarted like by the requests of their files
+func (c *Controller) WHEPHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id, s, ok := c.relayedStream(w, req, ps.ByName("id"), ErrNoWHEP)
+	if !ok {
+		return
+	}
+	if kind, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err != nil || kind != "application/sdp" {
+		c.SendError(w, ErrInvalidSDPType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offer, err := ioutil.ReadAll(io.LimitReader(req.Body, maxOfferSize))
+	if err != nil || len(offer) == 0 {
+		c.SendError(w, whep.ErrInvalidOffer, http.StatusBadRequest)
+		return
+	}
+	s.Mux.RLock()
+	opts := s.Options
+	s.Mux.RUnlock()
+	if opts.AudioOnly {
+		c.SendError(w, ErrAudioOnly, http.StatusConflict)
+		return
+	}
+	if !isH264(opts) {
+		c.SendError(w, ErrWHEPCodec, http.StatusConflict)
+		return
+	}
+	c.watched(id, req)
+	if !c.activate(w, req, id, s) {
+		return
+	}
+	// The sessions count as viewers and keep the stream running while they are connected
+	alive := func() {
+		c.watched(id, req)
+		s.Touch()
+		if s.Streak.IsActive() {
+			s.Hit(c.now())
+		}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), answerTimeout)
+	defer cancel()
+	answer, session, err := c.whep.Answer(ctx, whep.Stream{ID: id, Relay: s.Relay, Alive: alive}, string(offer))
+	switch err {
+	case nil:
+	case whep.ErrNotBuilt:
+		c.SendError(w, err, http.StatusNotImplemented)
+		return
+	case whep.ErrTooManyViewers:
+		c.SendError(w, err, http.StatusServiceUnavailable)
+		return
+	case whep.ErrInvalidOffer:
+		c.SendError(w, err, http.StatusBadRequest)
+		return
+	default:
+		c.logger(req.Context()).Errorf("WebRTC session of %s could not be negotiated || Error: %s", id, err)
+		c.SendError(w, ErrUnexpected, http.StatusInternalServerError)
+		return
+	}
+	c.logger(req.Context()).Debugf("WebRTC session %s of %s is negotiated", session, id)
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", c.prefixed(fmt.Sprintf("/whep/%s/%s", id, session)))
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(answer))
+}
+
+// WHEPSessionHandler is the HTTP handler of the DELETE /whep/:id/:session calls, which end the WebRTC session
+func (c *Controller) WHEPSessionHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if c.spec().JWTStreams && !c.isAuthenticated(w, req) {
+		return
+	}
+	id := c.resolveID(ps.ByName("id"))
+	if err := c.whep.Close(id, ps.ByName("session")); err != nil {
+		c.SendError(w, err, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
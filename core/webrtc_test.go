@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/streaming"
+	"github.com/Roverr/rtsp-stream/core/whep"
+)
+
+// mockWHEP answers every offer with the answer, unless the error is set. The streams of the sessions are sent to the channel if there is one
+type mockWHEP struct {
+	answer  string
+	err     error
+	streams chan whep.Stream
+}
+
+func (m mockWHEP) Answer(ctx context.Context, strm whep.Stream, offer string) (string, string, error) {
+	if m.streams != nil {
+		m.streams <- strm
+	}
+	if m.err != nil {
+		return "", "", m.err
+	}
+	return m.answer, "session", nil
+}
+
+func (m mockWHEP) Close(id, session string) error {
+	if session != "session" {
+		return whep.ErrNoSession
+	}
+	return nil
+}
+
+func (m mockWHEP) Sessions(id string) int {
+	return 0
+}
+
+func (m mockWHEP) Shutdown() {}
+
+func TestWHEPHandler(t *testing.T) {
+	setup := func(enabled bool, server whep.Server) *Controller {
+		conf := config.InitConfig()
+		conf.WHEPEnabled = enabled
+		ctrls := NewController(conf, WithFileServer(http.NotFoundHandler()))
+		ctrls.manager = mockManager{resolve: true}
+		ctrls.processor = mockProcessor{}
+		if server != nil {
+			ctrls.whep = server
+		}
+		return ctrls
+	}
+	start := func(ctrls *Controller, uri string) (*streaming.Stream, string) {
+		b, _ := json.Marshal(StreamDto{URI: uri})
+		rr := httptest.NewRecorder()
+		ctrls.StartStreamHandler(rr, newJSONRequest(http.MethodPost, "/start", bytes.NewBuffer(b)), nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		id, _ := streaming.GetURIDirectory(uri)
+		strm, _ := ctrls.getStream(id)
+		return strm, id
+	}
+	play := func(ctrls *Controller, id, contentType string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/whep/"+id, bytes.NewBufferString("v=0\r\n"))
+		req.Header.Set("Content-Type", contentType)
+		ctrls.Handler().ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Should answer the offers with the sessions of the stream", func(t *testing.T) {
+		streams := make(chan whep.Stream, 1)
+		ctrls := setup(true, mockWHEP{answer: "v=0\r\nanswer", streams: streams})
+		defer ctrls.Shutdown(context.Background())
+		strm, id := start(ctrls, "rtsp://192.168.0.1/whep")
+		if !assert.NotNil(t, strm.Relay) {
+			return
+		}
+		rr := play(ctrls, id, "application/sdp")
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "application/sdp", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "/whep/"+id+"/session", rr.Header().Get("Location"))
+		assert.Equal(t, "v=0\r\nanswer", rr.Body.String())
+		session := <-streams
+		assert.Equal(t, id, session.ID)
+		assert.Equal(t, strm.Relay, session.Relay)
+		// The connected sessions count as viewers
+		session.Alive()
+		viewers, _ := ctrls.streamViewers(id)
+		assert.Equal(t, 1, viewers)
+
+		rr = httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/whep/"+id+"/session", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = httptest.NewRecorder()
+		ctrls.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/whep/"+id+"/unknown", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Contains(t, rr.Body.String(), "session_not_found")
+	})
+
+	t.Run("Should refuse the offers that cannot be played", func(t *testing.T) {
+		tt := []struct {
+			Server      whep.Server
+			ContentType string
+			Change      func(strm *streaming.Stream)
+			Status      int
+			Code        string
+		}{
+			{Server: nil, ContentType: "application/sdp", Status: http.StatusNotImplemented, Code: "whep_not_built"},
+			{Server: mockWHEP{err: whep.ErrTooManyViewers}, ContentType: "application/sdp", Status: http.StatusServiceUnavailable, Code: "whep_viewers_reached"},
+			{Server: mockWHEP{err: whep.ErrInvalidOffer}, ContentType: "application/sdp", Status: http.StatusBadRequest, Code: "invalid_offer"},
+			{Server: mockWHEP{}, ContentType: "text/plain", Status: http.StatusUnsupportedMediaType, Code: "invalid_content_type"},
+			{Server: mockWHEP{}, ContentType: "application/sdp", Change: func(strm *streaming.Stream) { strm.Relay = nil }, Status: http.StatusConflict, Code: "whep_unavailable"},
+			{Server: mockWHEP{}, ContentType: "application/sdp", Change: func(strm *streaming.Stream) {
+				strm.Options.Source = &streaming.SourceInfo{Video: "hevc"}
+			}, Status: http.StatusConflict, Code: "whep_unsupported_codec"},
+			{Server: mockWHEP{}, ContentType: "application/sdp", Change: func(strm *streaming.Stream) { strm.Options.AudioOnly = true }, Status: http.StatusConflict, Code: "audio_only"},
+		}
+		for i, testCase := range tt {
+			ctrls := setup(true, testCase.Server)
+			strm, id := start(ctrls, "rtsp://192.168.0.2/whep")
+			if testCase.Change != nil {
+				testCase.Change(strm)
+			}
+			rr := play(ctrls, id, testCase.ContentType)
+			if !assert.Equal(t, testCase.Status, rr.Code) || !assert.Contains(t, rr.Body.String(), testCase.Code) {
+				t.Error(fmt.Errorf("%d testcase is failing for refusing the offers", i))
+			}
+			ctrls.Shutdown(context.Background())
+		}
+	})
+
+	t.Run("Should only be routed if it is enabled", func(t *testing.T) {
+		ctrls := setup(false, nil)
+		defer ctrls.Shutdown(context.Background())
+		strm, id := start(ctrls, "rtsp://192.168.0.3/whep")
+		assert.Nil(t, strm.Relay)
+		assert.Equal(t, http.StatusNotFound, play(ctrls, id, "application/sdp").Code)
+	})
+}
@@ -0,0 +1,171 @@
+package whep
+
+import (
+	"bytes"
+	"time"
+)
+
+const (
+	packetSize   = 188
+	syncByte     = 0x47
+	patPID       = 0
+	streamH264   = 0x1b
+	nalIDR       = 5
+	ptsClockRate = 90000
+)
+
+// AccessUnit is a frame of the H.264 video of the stream, written as Annex B NAL units
+type AccessUnit struct {
+	Data     []byte
+	PTS      time.Duration
+	Keyframe bool
+}
+
+// Demuxer extracts the H.264 access units from the MPEG-TS output of a stream. The packets are expected to be
+// whole, like the chunks of the relay. Every PES packet of the video is one access unit, like ffmpeg writes them
+type Demuxer struct {
+	pmtPID   int // PID of the program map table, -1 until the program association table is read
+	videoPID int // PID of the H.264 video, -1 until the program map table is read
+	pes      []byte
+	pts      time.Duration
+}
+
+// NewDemuxer creates a new instance of Demuxer
+func NewDemuxer() *Demuxer {
+	return &Demuxer{-1, -1, nil, 0}
+}
+
+// Write demuxes the packets of the chunk and returns the access units completed by them
+func (d *Demuxer) Write(chunk []byte) []AccessUnit {
+	units := []AccessUnit{}
+	for len(chunk) >= packetSize {
+		packet := chunk[:packetSize]
+		chunk = chunk[packetSize:]
+		if packet[0] != syncByte {
+			continue
+		}
+		start := packet[1]&0x40 != 0
+		pid := int(packet[1]&0x1f)<<8 | int(packet[2])
+		payload := packetPayload(packet)
+		if payload == nil {
+			continue
+		}
+		switch pid {
+		case patPID:
+			if start {
+				d.readPAT(payload)
+			}
+		case d.pmtPID:
+			if start {
+				d.readPMT(payload)
+			}
+		case d.videoPID:
+			if start {
+				if unit, ok := d.flush(); ok {
+					units = append(units, unit)
+				}
+				d.pes = append([]byte{}, payload...)
+			} else if d.pes != nil {
+				d.pes = append(d.pes, payload...)
+			}
+		}
+	}
+	return units
+}
+
+// packetPayload returns the payload of the packet after its adaptation field, nil if it has none
+func packetPayload(packet []byte) []byte {
+	control := (packet[3] >> 4) & 0x3
+	offset := 4
+	if control == 2 || control == 0 {
+		return nil
+	}
+	if control == 3 {
+		offset += 1 + int(packet[4])
+	}
+	if offset >= len(packet) {
+		return nil
+	}
+	return packet[offset:]
+}
+
+// section returns the table section of the payload after its pointer field, without the CRC
+func section(payload []byte) []byte {
+	if len(payload) < 1 || int(payload[0])+1 > len(payload) {
+		return nil
+	}
+	table := payload[1+int(payload[0]):]
+	if len(table) < 3 {
+		return nil
+	}
+	length := int(table[1]&0x0f)<<8 | int(table[2])
+	if length < 4 || 3+length > len(table) {
+		return nil
+	}
+	return table[:3+length-4]
+}
+
+// readPAT finds the PID of the program map table of the first program
+func (d *Demuxer) readPAT(payload []byte) {
+	table := section(payload)
+	for i := 8; i+4 <= len(table); i += 4 {
+		program := int(table[i])<<8 | int(table[i+1])
+		if program != 0 {
+			d.pmtPID = int(table[i+2]&0x1f)<<8 | int(table[i+3])
+			return
+		}
+	}
+}
+
+// readPMT finds the PID of the H.264 video of the program
+func (d *Demuxer) readPMT(payload []byte) {
+	table := section(payload)
+	if len(table) < 12 {
+		return
+	}
+	i := 12 + (int(table[10]&0x0f)<<8 | int(table[11]))
+	for i+5 <= len(table) {
+		kind := table[i]
+		pid := int(table[i+1]&0x1f)<<8 | int(table[i+2])
+		if kind == streamH264 {
+			d.videoPID = pid
+			return
+		}
+		i += 5 + (int(table[i+3]&0x0f)<<8 | int(table[i+4]))
+	}
+}
+
+// flush returns the access unit of the collected PES packet, false if there is none or it cannot be read
+func (d *Demuxer) flush() (AccessUnit, bool) {
+	pes := d.pes
+	d.pes = nil
+	if len(pes) < 9 || !bytes.HasPrefix(pes, []byte{0, 0, 1}) {
+		return AccessUnit{}, false
+	}
+	data := 9 + int(pes[8])
+	if data > len(pes) {
+		return AccessUnit{}, false
+	}
+	if pes[7]&0x80 != 0 && len(pes) >= 14 {
+		d.pts = readPTS(pes[9:14])
+	}
+	unit := AccessUnit{Data: pes[data:], PTS: d.pts}
+	unit.Keyframe = hasIDR(unit.Data)
+	return unit, len(unit.Data) > 0
+}
+
+// readPTS returns the presentation timestamp written in the 5 bytes of the PES header
+func readPTS(b []byte) time.Duration {
+	ticks := int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+	return time.Duration(ticks) * time.Second / ptsClockRate
+}
+
+// hasIDR indicates if the Annex B NAL units contain an IDR slice, which the decoders can start with
+func hasIDR(data []byte) bool {
+	for i := 0; i+3 < len(data); i++ {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 && data[i+3]&0x1f == nalIDR {
+			return true
+		}
+	}
+	return false
+}
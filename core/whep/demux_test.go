@@ -0,0 +1,138 @@
+package whep
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tsPacket writes a packet of the PID with the payload, the rest of the packet is filled with an adaptation field
+func tsPacket(pid int, start bool, payload []byte) []byte {
+	packet := []byte{syncByte, byte(pid>>8) & 0x1f, byte(pid), 0x10}
+	if start {
+		packet[1] |= 0x40
+	}
+	if stuffing := packetSize - 4 - len(payload); stuffing > 0 {
+		packet[3] = 0x30
+		field := make([]byte, stuffing)
+		field[0] = byte(stuffing - 1)
+		if stuffing > 1 {
+			field[1] = 0
+			for i := 2; i < stuffing; i++ {
+				field[i] = 0xff
+			}
+		}
+		packet = append(packet, field...)
+	}
+	return append(packet, payload...)
+}
+
+// psi writes the table section after its pointer field, with a CRC that is not checked
+func psi(table byte, body []byte) []byte {
+	length := len(body) + 5 + 4
+	section := []byte{0, table, 0xb0 | byte(length>>8), byte(length), 0, 1, 0xc1, 0, 0}
+	return append(append(section, body...), 0, 0, 0, 0)
+}
+
+// pes writes the video PES packet of the access unit with its timestamp
+func pes(pts time.Duration, data []byte) []byte {
+	ticks := int64(pts * ptsClockRate / time.Second)
+	header := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | (ticks>>29)&0x0e), byte(ticks >> 22), byte(0x01 | (ticks>>14)&0xfe), byte(ticks >> 7), byte(0x01 | (ticks<<1)&0xfe)}
+	return append(header, data...)
+}
+
+// videoPackets splits the PES packet into the packets of the video PID
+func videoPackets(pid int, packet []byte) []byte {
+	out := []byte{}
+	for start := true; len(packet) > 0; start = false {
+		n := len(packet)
+		if n > packetSize-4 {
+			n = packetSize - 4
+		}
+		out = append(out, tsPacket(pid, start, packet[:n])...)
+		packet = packet[n:]
+	}
+	return out
+}
+
+func TestDemuxer(t *testing.T) {
+	pat := tsPacket(patPID, true, psi(0, []byte{0, 1, 0xf0, 0x00}))
+	// The program carries an AAC audio and the H.264 video, the PCR is carried by the video
+	pmt := tsPacket(0x1000, true, psi(2, []byte{0xe1, 0x00, 0xf0, 0x00, 0x0f, 0xe1, 0x01, 0xf0, 0x00, streamH264, 0xe1, 0x00, 0xf0, 0x00}))
+	idr := append([]byte{0, 0, 0, 1, 0x67, 0x42}, append([]byte{0, 0, 0, 1, 0x68, 0xce}, append([]byte{0, 0, 0, 1, 0x65}, bytes.Repeat([]byte{0xaa}, 400)...)...)...)
+	slice := append([]byte{0, 0, 0, 1, 0x41}, bytes.Repeat([]byte{0xbb}, 100)...)
+	stream := append(append([]byte{}, pat...), pmt...)
+	stream = append(stream, tsPacket(0x101, true, []byte{0xff, 0xff})...)
+	stream = append(stream, videoPackets(0x100, pes(time.Second, idr))...)
+	stream = append(stream, videoPackets(0x100, pes(time.Second+40*time.Millisecond, slice))...)
+	stream = append(stream, videoPackets(0x100, pes(time.Second+80*time.Millisecond, slice))...)
+
+	tt := []struct {
+		Chunks   [][]byte
+		Expected []AccessUnit
+	}{
+		{Chunks: [][]byte{stream}, Expected: []AccessUnit{
+			{Data: idr, PTS: time.Second, Keyframe: true},
+			{Data: slice, PTS: time.Second + 40*time.Millisecond},
+		}},
+		{Chunks: [][]byte{stream[:3*packetSize], stream[3*packetSize : 5*packetSize], stream[5*packetSize:]}, Expected: []AccessUnit{
+			{Data: idr, PTS: time.Second, Keyframe: true},
+			{Data: slice, PTS: time.Second + 40*time.Millisecond},
+		}},
+		// The video cannot be found without the tables
+		{Chunks: [][]byte{stream[2*packetSize:]}, Expected: []AccessUnit{}},
+	}
+	for i, testCase := range tt {
+		demuxer := NewDemuxer()
+		units := []AccessUnit{}
+		for _, chunk := range testCase.Chunks {
+			units = append(units, demuxer.Write(chunk)...)
+		}
+		if !assert.Equal(t, testCase.Expected, units) {
+			t.Error(fmt.Errorf("%d testcase is failing for TestDemuxer", i))
+		}
+	}
+}
+
+type fakeSession struct {
+	closed *int
+}
+
+func (s fakeSession) close() {
+	*s.closed++
+}
+
+func TestRegistry(t *testing.T) {
+	sessions := newRegistry(2)
+	first, err := sessions.reserve("id")
+	assert.Nil(t, err)
+	second, err := sessions.reserve("id")
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+	_, err = sessions.reserve("id")
+	assert.Equal(t, ErrTooManyViewers, err)
+	_, err = sessions.reserve("other")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, sessions.count("id"))
+
+	closed := 0
+	assert.True(t, sessions.set("id", first, fakeSession{&closed}))
+	s, ok := sessions.release("id", second)
+	assert.True(t, ok)
+	assert.Nil(t, s)
+	assert.False(t, sessions.set("id", second, fakeSession{&closed}))
+	_, ok = sessions.release("id", second)
+	assert.False(t, ok)
+	assert.Equal(t, 1, sessions.count("id"))
+
+	for _, s := range sessions.clear() {
+		s.close()
+	}
+	assert.Equal(t, 1, closed)
+	assert.Equal(t, 0, sessions.count("id"))
+	assert.Equal(t, 0, sessions.count("other"))
+}
@@ -0,0 +1,225 @@
+//go:build webrtc
+// +build webrtc
+
+package whep
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultFrameDuration is the duration of the frames without a usable timestamp
+const defaultFrameDuration = time.Second / 30
+
+// pionServer is the Server of the binaries built with the webrtc tag, the sessions are peer connections of pion
+type pionServer struct {
+	conf     Config
+	api      *webrtc.API
+	sessions *registry
+}
+
+// New creates the Server of the sessions, the video of the streams is sent over the peer connections of pion
+func New(conf Config) Server {
+	engine := &webrtc.MediaEngine{}
+	if err := engine.RegisterDefaultCodecs(); err != nil {
+		logrus.Errorf("Codecs of WebRTC could not be registered || Error: %s", err)
+	}
+	return &pionServer{conf, webrtc.NewAPI(webrtc.WithMediaEngine(engine)), newRegistry(conf.MaxViewers)}
+}
+
+// Answer negotiates the peer connection of the offer, the answer is returned once its candidates are gathered
+func (s *pionServer) Answer(ctx context.Context, strm Stream, offer string) (string, string, error) {
+	id, err := s.sessions.reserve(strm.ID)
+	if err != nil {
+		return "", "", err
+	}
+	release := func() { s.sessions.release(strm.ID, id) }
+	answer, sess, err := s.negotiate(ctx, strm, offer, release)
+	if err != nil {
+		release()
+		return "", "", err
+	}
+	if !s.sessions.set(strm.ID, id, sess) {
+		sess.close()
+		return "", "", ErrNoSession
+	}
+	go sess.run(s.conf)
+	return answer, id, nil
+}
+
+// negotiate creates the peer connection sending the video of the stream to the client of the offer
+func (s *pionServer) negotiate(ctx context.Context, strm Stream, offer string, release func()) (string, *session, error) {
+	conf := webrtc.Configuration{}
+	if len(s.conf.ICEServers) > 0 {
+		conf.ICEServers = []webrtc.ICEServer{{URLs: s.conf.ICEServers}}
+	}
+	pc, err := s.api.NewPeerConnection(conf)
+	if err != nil {
+		return "", nil, err
+	}
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}, "video", "rtsp-stream")
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+	sender, err := pc.AddTrack(track)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+	sess := &session{pc, track, sender, strm, release, make(chan struct{}), make(chan struct{}), 0, 0}
+	// The session is torn down as soon as the connection of the client is lost, so its resources are released
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			if atomic.CompareAndSwapInt32(&sess.up, 0, 1) {
+				close(sess.connected)
+			}
+		case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			sess.close()
+		}
+	})
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		pc.Close()
+		return "", nil, ErrInvalidOffer
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		return "", nil, ErrInvalidOffer
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		pc.Close()
+		return "", nil, ctx.Err()
+	}
+	sdp := pc.LocalDescription().SDP
+	if !strings.Contains(sdp, "H264") {
+		pc.Close()
+		return "", nil, ErrInvalidOffer
+	}
+	return sdp, sess, nil
+}
+
+// Close ends the session and releases its peer connection
+func (s *pionServer) Close(id, session string) error {
+	sess, ok := s.sessions.release(id, session)
+	if !ok {
+		return ErrNoSession
+	}
+	if sess != nil {
+		sess.close()
+	}
+	return nil
+}
+
+// Sessions returns the number of sessions of the stream
+func (s *pionServer) Sessions(id string) int {
+	return s.sessions.count(id)
+}
+
+// Shutdown ends every session
+func (s *pionServer) Shutdown() {
+	for _, sess := range s.sessions.clear() {
+		sess.close()
+	}
+}
+
+// session is the peer connection of a viewer, it sends the video of the relay of the stream once the client is connected
+type session struct {
+	pc        *webrtc.PeerConnection
+	track     *webrtc.TrackLocalStaticSample
+	sender    *webrtc.RTPSender
+	strm      Stream
+	release   func()
+	done      chan struct{}
+	connected chan struct{}
+	up        int32 // Indicates if the client connected, the connected channel is closed then
+	closed    int32
+}
+
+// run sends the access units of the relay to the client until the session is closed. The video starts with a keyframe,
+// so the decoder of the client can start right away. The stream is kept alive while the client is connected
+func (s *session) run(conf Config) {
+	client := s.strm.Relay.Subscribe()
+	defer s.strm.Relay.Unsubscribe(client)
+	defer s.close()
+	// The RTCP packets of the client have to be read, so the interceptors of the sender can process them
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := s.sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	interval := conf.AliveInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	alive := time.NewTicker(interval)
+	defer alive.Stop()
+	connect := time.NewTimer(connectTimeout)
+	defer connect.Stop()
+	demuxer := NewDemuxer()
+	connected, started := s.connected, false
+	var last time.Duration
+	for {
+		select {
+		case chunk, ok := <-client.Chunks():
+			// The stream is stopped, or the session fell behind it
+			if !ok {
+				return
+			}
+			for _, unit := range demuxer.Write(chunk) {
+				if connected != nil || (!started && !unit.Keyframe) {
+					continue
+				}
+				duration := defaultFrameDuration
+				if started && unit.PTS > last {
+					duration = unit.PTS - last
+				}
+				started, last = true, unit.PTS
+				if err := s.track.WriteSample(media.Sample{Data: unit.Data, Duration: duration}); err != nil {
+					return
+				}
+			}
+		case <-connected:
+			connected = nil
+			s.strm.Alive()
+		case <-connect.C:
+			if connected != nil {
+				logrus.Debugf("WebRTC session of %s did not connect in time", s.strm.ID)
+				return
+			}
+		case <-alive.C:
+			if connected == nil {
+				s.strm.Alive()
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// close ends the session, it is safe to call it more than once and from the callbacks of the peer connection
+func (s *session) close() {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		return
+	}
+	close(s.done)
+	s.release()
+	s.pc.Close()
+}
@@ -0,0 +1,130 @@
+//go:build webrtc
+// +build webrtc
+
+package whep
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// offer creates the peer connection of a client receiving the video, the offer is returned once its candidates are gathered
+func offer(t *testing.T) (*webrtc.PeerConnection, string) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.Nil(t, err)
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	assert.Nil(t, err)
+	desc, err := pc.CreateOffer(nil)
+	assert.Nil(t, err)
+	gathered := webrtc.GatheringCompletePromise(pc)
+	assert.Nil(t, pc.SetLocalDescription(desc))
+	<-gathered
+	return pc, pc.LocalDescription().SDP
+}
+
+// waitFor waits until the condition is met, false if it is not met in time
+func waitFor(condition func() bool) bool {
+	for started := time.Now(); time.Since(started) < 30*time.Second; <-time.After(20 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPionServer(t *testing.T) {
+	relay := streaming.NewRelay()
+	alive := make(chan struct{}, 1)
+	strm := Stream{ID: "id", Relay: relay, Alive: func() {
+		select {
+		case alive <- struct{}{}:
+		default:
+		}
+	}}
+	server := New(Config{MaxViewers: 1, AliveInterval: 50 * time.Millisecond})
+	defer server.Shutdown()
+
+	t.Run("Should send the video of the relay to the client", func(t *testing.T) {
+		client, sdp := offer(t)
+		defer client.Close()
+		received := make(chan struct{})
+		client.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			if _, _, err := track.ReadRTP(); err == nil {
+				close(received)
+			}
+		})
+		answer, session, err := server.Answer(context.Background(), strm, sdp)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.NotEmpty(t, session)
+		assert.Contains(t, answer, "H264")
+		assert.Nil(t, client.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}))
+		assert.Equal(t, 1, server.Sessions("id"))
+
+		_, _, err = server.Answer(context.Background(), strm, sdp)
+		assert.Equal(t, ErrTooManyViewers, err)
+
+		pat := tsPacket(patPID, true, psi(0, []byte{0, 1, 0xf0, 0x00}))
+		pmt := tsPacket(0x1000, true, psi(2, []byte{0xe1, 0x00, 0xf0, 0x00, streamH264, 0xe1, 0x00, 0xf0, 0x00}))
+		idr := append([]byte{0, 0, 0, 1, 0x65}, bytes.Repeat([]byte{0xaa}, 400)...)
+		assert.True(t, waitFor(func() bool { return client.ConnectionState() == webrtc.PeerConnectionStateConnected }))
+		for i := 0; i < 50; i++ {
+			relay.Write(append(append(pat, pmt...), videoPackets(0x100, pes(time.Duration(i)*40*time.Millisecond, idr))...))
+			select {
+			case <-received:
+				i = 50
+			case <-time.After(40 * time.Millisecond):
+			}
+		}
+		select {
+		case <-received:
+		default:
+			t.Error("Video is not received")
+		}
+		assert.True(t, waitFor(func() bool { return len(alive) > 0 }))
+
+		assert.Nil(t, server.Close("id", session))
+		assert.Equal(t, ErrNoSession, server.Close("id", session))
+		assert.Equal(t, 0, server.Sessions("id"))
+	})
+
+	t.Run("Should refuse the offers that cannot be negotiated", func(t *testing.T) {
+		_, _, err := server.Answer(context.Background(), strm, "v=0")
+		assert.Equal(t, ErrInvalidOffer, err)
+		assert.Equal(t, 0, server.Sessions("id"))
+	})
+
+	t.Run("Should tear down the sessions once the stream is stopped", func(t *testing.T) {
+		client, sdp := offer(t)
+		defer client.Close()
+		answer, _, err := server.Answer(context.Background(), strm, sdp)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Nil(t, client.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}))
+		assert.True(t, waitFor(func() bool { return relay.Clients() == 1 }))
+		relay.Disconnect()
+		assert.True(t, waitFor(func() bool { return server.Sessions("id") == 0 }))
+	})
+
+	t.Run("Should tear down the sessions of the disconnected clients", func(t *testing.T) {
+		client, sdp := offer(t)
+		answer, _, err := server.Answer(context.Background(), strm, sdp)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Nil(t, client.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}))
+		assert.True(t, waitFor(func() bool { return client.ConnectionState() == webrtc.PeerConnectionStateConnected }))
+		assert.Nil(t, client.Close())
+		assert.True(t, waitFor(func() bool { return server.Sessions("id") == 0 }))
+		assert.True(t, waitFor(func() bool { return relay.Clients() == 0 }))
+	})
+}
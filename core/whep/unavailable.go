@@ -0,0 +1,29 @@
+//go:build !webrtc
+// +build !webrtc
+
+package whep
+
+import "context"
+
+// New creates the Server of the sessions. The binaries built without the webrtc tag refuse every session,
+// so the default build does not carry the WebRTC stack
+func New(conf Config) Server {
+	return unavailable{}
+}
+
+// unavailable is the Server of the binaries built without the webrtc tag
+type unavailable struct{}
+
+func (unavailable) Answer(ctx context.Context, strm Stream, offer string) (string, string, error) {
+	return "", "", ErrNotBuilt
+}
+
+func (unavailable) Close(id, session string) error {
+	return ErrNoSession
+}
+
+func (unavailable) Sessions(id string) int {
+	return 0
+}
+
+func (unavailable) Shutdown() {}
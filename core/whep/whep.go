@@ -0,0 +1,142 @@
+package whep
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Roverr/rtsp-stream/core/streaming"
+)
+
+// ErrNotBuilt describes an error for the sessions of the binaries built without the webrtc tag
+var ErrNotBuilt = errors.New("WebRTC playback is not built into this binary, it has to be built with the webrtc tag")
+
+// ErrTooManyViewers describes an error for the sessions of the streams playing to the maximum number of viewers
+var ErrTooManyViewers = errors.New("Stream is played to the maximum number of WebRTC viewers")
+
+// ErrInvalidOffer describes an error for the SDP offers a session cannot be negotiated from
+var ErrInvalidOffer = errors.New("SDP offer is invalid or it does not receive H.264 video")
+
+// ErrNoSession describes an error for the sessions that are not known, or ended already
+var ErrNoSession = errors.New("WebRTC session is not known")
+
+// connectTimeout is the time the client has to connect after the answer, the session is closed otherwise
+const connectTimeout = 30 * time.Second
+
+// Config describes the settings of the sessions
+type Config struct {
+	MaxViewers int      // Maximum number of sessions of a stream
+	ICEServers []string // STUN and TURN URLs of the peer connections
+	// AliveInterval is the time between the calls of the Alive function of the streams, while their sessions are connected
+	AliveInterval time.Duration
+}
+
+// Stream describes the stream a session plays
+type Stream struct {
+	ID string
+	// Relay delivers the MPEG-TS output of the running transcoding, the video of the session is taken from it
+	Relay *streaming.Relay
+	// Alive is called periodically while the session is connected, so it counts toward the activity of the stream
+	Alive func()
+}
+
+// Server negotiates and keeps the WebRTC sessions of the streams
+type Server interface {
+	// Answer creates the session of a viewer of the stream from its SDP offer, it returns the SDP answer and the id of the session
+	Answer(ctx context.Context, strm Stream, offer string) (answer string, session string, err error)
+	// Close ends the given session of the stream
+	Close(id, session string) error
+	// Sessions returns the number of sessions of the stream
+	Sessions(id string) int
+	// Shutdown ends every session
+	Shutdown()
+}
+
+// closer is a session the registry can end
+type closer interface {
+	close()
+}
+
+// registry keeps the sessions of the streams, the number of sessions of a stream is bounded
+type registry struct {
+	mux      *sync.Mutex
+	sessions map[string]map[string]closer
+	max      int
+}
+
+// newRegistry creates a new instance of registry
+func newRegistry(max int) *registry {
+	return &registry{&sync.Mutex{}, map[string]map[string]closer{}, max}
+}
+
+// reserve returns the id of a new session of the stream, or ErrTooManyViewers if the stream has no room for it.
+// The session is added once it is negotiated, reserving the id counts toward the limit already
+func (r *registry) reserve(id string) (string, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if len(r.sessions[id]) >= r.max {
+		return "", ErrTooManyViewers
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	session := hex.EncodeToString(b)
+	if r.sessions[id] == nil {
+		r.sessions[id] = map[string]closer{}
+	}
+	r.sessions[id][session] = nil
+	return session, nil
+}
+
+// set stores the negotiated session under its reserved id, false if it was released meanwhile
+func (r *registry) set(id, session string, s closer) bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.sessions[id][session]; !ok {
+		return false
+	}
+	r.sessions[id][session] = s
+	return true
+}
+
+// release removes the session and returns it, nil if it is not known or it was not negotiated yet
+func (r *registry) release(id, session string) (closer, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	s, ok := r.sessions[id][session]
+	if !ok {
+		return nil, false
+	}
+	delete(r.sessions[id], session)
+	if len(r.sessions[id]) == 0 {
+		delete(r.sessions, id)
+	}
+	return s, true
+}
+
+// count returns the number of sessions of the stream, the ones being negotiated included
+func (r *registry) count(id string) int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.sessions[id])
+}
+
+// clear removes every session and returns the negotiated ones
+func (r *registry) clear() []closer {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	all := []closer{}
+	for _, sessions := range r.sessions {
+		for _, s := range sessions {
+			if s != nil {
+				all = append(all, s)
+			}
+		}
+	}
+	r.sessions = map[string]map[string]closer{}
+	return all
+}
@@ -1,33 +1,163 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
-
-	"github.com/rs/cors"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
 
 	"github.com/Roverr/rtsp-stream/core"
+	"github.com/Roverr/rtsp-stream/core/certs"
 	"github.com/Roverr/rtsp-stream/core/config"
+	"github.com/Roverr/rtsp-stream/core/sockets"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	config := config.InitConfig()
+	flags := config.NewFlags(filepath.Base(os.Args[0]), os.Stdout)
+	if err := flags.Parse(os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	config, err := flags.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	core.SetupLogger(config)
-	router, ctrls := core.GetRouter(config)
-	done := ctrls.ExitHandler()
-	handler := cors.AllowAll().Handler(router)
-	if config.CORS.Enabled {
-		handler = cors.New(cors.Options{
-			AllowCredentials: config.CORS.AllowCredentials,
-			AllowedOrigins:   config.CORS.AllowedOrigins,
-			MaxAge:           config.CORS.MaxAge,
-		}).Handler(router)
-	}
-	logrus.Infof("RTSP-STREAM started on %d", config.Port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", config.Port), handler))
-	<-done
-	os.Exit(0)
+	handler, ctrls := core.GetRouter(config)
+	server := &http.Server{Handler: handler}
+	reloader, err := certs.NewReloader(config.TLS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	if reloader != nil {
+		server.TLSConfig = reloader.TLSConfig()
+		go reloader.Watch(config.TLSWatchInterval, done)
+	}
+	if err := core.ConfigureHTTP2(server, config); err != nil {
+		log.Fatal(err)
+	}
+	// The listeners are closed by the shutdown of the server, the socket file is removed with its listener
+	listeners := []net.Listener{}
+	if config.Port != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
+		if err != nil {
+			log.Fatal(err)
+		}
+		logrus.Infof("RTSP-STREAM started on %d", config.Port)
+		listeners = append(listeners, listener)
+	}
+	if config.ListenSocket != "" {
+		listener, err := sockets.Listen(config.ListenSocket, config.SocketMode())
+		if err != nil {
+			log.Fatal(err)
+		}
+		logrus.Infof("RTSP-STREAM started on %s", config.ListenSocket)
+		listeners = append(listeners, listener)
+	}
+	for _, listener := range listeners {
+		go serve(server, listener, reloader != nil)
+	}
+
+	// The endpoints that are not public get their own listener if it is configured, sharing the controller
+	servers := []*http.Server{server}
+	if config.AdminAddress != "" {
+		adminServer := &http.Server{Handler: ctrls.AdminHandler()}
+		if reloader != nil {
+			adminServer.TLSConfig = reloader.TLSConfig()
+		}
+		if err := core.ConfigureHTTP2(adminServer, config); err != nil {
+			log.Fatal(err)
+		}
+		listener, err := net.Listen("tcp", config.AdminAddress)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logrus.Infof("Admin endpoints are served on %s", config.AdminAddress)
+		go serve(adminServer, listener, reloader != nil)
+		servers = append(servers, adminServer)
+	}
+
+	// The debug endpoints get their own listener, so they are not exposed next to the API by accident
+	var debugServer *http.Server
+	if config.DebugEndpoint && config.DebugAddress != "" {
+		debugServer = &http.Server{Addr: config.DebugAddress, Handler: ctrls.DebugHandler()}
+		go func() {
+			logrus.Infof("Debug endpoints are served on %s", config.DebugAddress)
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// SIGHUP reloads the settings that can change at runtime
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	go func() {
+		for range reloads {
+			if _, err := ctrls.ReloadFromSource(); err != nil {
+				logrus.Errorf("Configuration could not be reloaded || Error: %s", err)
+			}
+			if reloader == nil {
+				continue
+			}
+			if err := reloader.Reload(); err != nil {
+				logrus.Errorf("Certificate could not be reloaded || Error: %s", err)
+			}
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	logrus.Info("RTSP-STREAM is shutting down")
+
+	// Let the in-flight requests of every listener finish before stopping the transcoding
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownGrace)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				logrus.Error(err)
+			}
+		}(s)
+	}
+	wg.Wait()
+	if debugServer != nil {
+		debugServer.Close()
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), config.ShutdownGrace)
+	defer cancel()
+	if err := ctrls.Shutdown(ctx); err != nil {
+		logrus.Error(err)
+		os.Exit(1)
+	}
+}
+
+// serve serves the requests of the listener until the server is shut down
+func serve(server *http.Server, listener net.Listener, tls bool) {
+	var err error
+	if tls {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 }